@@ -2,9 +2,11 @@ package api
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"strings"
 
+	"github.com/hydrocode-de/gorun/internal/app"
 	"github.com/hydrocode-de/gorun/internal/auth"
 	"github.com/hydrocode-de/gorun/internal/frontend"
 	"github.com/sirupsen/logrus"
@@ -13,79 +15,170 @@ import (
 
 var logger = logrus.New()
 
-func HandleApiKey(handler func(http.ResponseWriter, *http.Request)) func(http.ResponseWriter, *http.Request) {
-	return func(w http.ResponseWriter, r *http.Request) {
+// Server holds the application state the handlers operate on
+type Server struct {
+	*app.App
+}
+
+// HandleApiKey authenticates the request with its access token and passes the user of
+// the token on as X-User-ID. Requests without a valid token are rejected with 401.
+func (s *Server) HandleApiKey(handler HandlerFunc) HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		// the user is only ever taken from the token, never from the client
+		r.Header.Del("X-User-ID")
 		noAuth := viper.GetBool("no_auth")
 
 		if noAuth {
-			logger.Printf("no_auth is enabled, getting admin credentials")
-			credentials, err := auth.GetAdminCredentials(r.Context())
+			log := requestLogger(r)
+			log.Printf("no_auth is enabled, getting admin credentials")
+			credentials, err := auth.GetAdminCredentials(r.Context(), s.DB)
 			if err != nil {
-				logger.Printf("failed to get admin credentials: %v", err)
-				RespondWithError(w, http.StatusInternalServerError, "Failed to get admin credentials")
-				return
+				log.Printf("failed to get admin credentials: %v", err)
+				return StatusError(http.StatusInternalServerError, "Failed to get admin credentials")
 			}
-			logger.Printf("setting admin user ID: %s", credentials.UserID)
+			log.Printf("setting admin user ID: %s", credentials.UserID)
 			r.Header.Set("X-User-ID", credentials.UserID)
-			handler(w, r)
-			return
+			r = r.WithContext(auth.WithScopes(r.Context(), auth.TokenScopes{Scopes: auth.AllScopes}))
+			return handler(w, r)
 		}
 
 		authHeader := r.Header.Get("Authorization")
 		apiKey := strings.TrimPrefix(authHeader, "Bearer ")
 		secret := viper.GetString("secret")
+		if apiKey == "" {
+			return StatusError(http.StatusUnauthorized, "an access token is required")
+		}
+		userId, scopes, err := auth.ValidateScopedJWT(apiKey, secret)
+		if err != nil {
+			return StatusError(http.StatusUnauthorized, "the access token is invalid or expired")
+		}
+		r.Header.Set("X-User-ID", userId)
+		r = r.WithContext(auth.WithScopes(r.Context(), scopes))
+		return handler(w, r)
+	}
+}
 
+// WithTokenScopes reads the scopes of an optional access token, for the public endpoints.
+// Requests without a valid token are anonymous.
+func WithTokenScopes(handler HandlerFunc) HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		r.Header.Del("X-User-ID")
+		scopes := auth.TokenScopes{Anonymous: true}
+		apiKey := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
 		if apiKey != "" {
-			userId, err := auth.ValidateJWT(apiKey, secret)
-			if err == nil {
-				r.Header.Set("X-User-ID", userId)
+			if _, tokenScopes, err := auth.ValidateScopedJWT(apiKey, viper.GetString("secret")); err == nil {
+				scopes = tokenScopes
 			}
 		}
+		return handler(w, r.WithContext(auth.WithScopes(r.Context(), scopes)))
+	}
+}
 
-		handler(w, r)
+// RequireScope rejects requests whose access token lacks the scope with 403 insufficient_scope
+func RequireScope(scope string, handler HandlerFunc) HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		if !auth.HasScope(r.Context(), scope) {
+			return &ErrorResponse{
+				Code:    CodeInsufficientScope,
+				Message: fmt.Sprintf("the access token lacks the %s scope", scope),
+				Details: map[string]string{"missing_scope": scope},
+				status:  http.StatusForbidden,
+			}
+		}
+		return handler(w, r)
 	}
 }
 
-func CreateServer() (*http.ServeMux, error) {
+func CreateServer(application *app.App) (*http.ServeMux, error) {
+	s := &Server{App: application}
 	mux := http.NewServeMux()
 
 	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte("OK"))
 	})
+	mux.Handle("/ready", HandlerFunc(s.GetReadiness))
 
 	// add a FileServer to serve the manager
 	//mux.Handle("/manager/", http.StripPrefix("/manager/", http.FileServer(http.Dir("manager/build"))))
 	mux.Handle("/manager/", http.StripPrefix("/manager/", http.FileServerFS(frontend.GetManager())))
 
-	mux.HandleFunc("GET /runs", HandleApiKey(GetAllRuns))
-	mux.HandleFunc("POST /runs", HandleApiKey(CreateRun))
-	mux.HandleFunc("GET /runs/{id}", HandleApiKey(RunMiddleware(GetRunStatus)))
-	mux.HandleFunc("DELETE /runs/{id}", HandleApiKey(RunMiddleware(DeleteRun)))
-	mux.HandleFunc("POST /runs/{id}/start", HandleApiKey(RunMiddleware(HandleRunStart)))
-	mux.HandleFunc("GET /runs/{id}/results", HandleApiKey(RunMiddleware(ListRunResults)))
-	mux.HandleFunc("GET /runs/{id}/results/{filename}/preview", HandleApiKey(RunMiddleware(PreviewResultFile)))
-	mux.HandleFunc("GET /runs/{id}/results/{filename}", HandleApiKey(RunMiddleware(GetResultFile)))
-	mux.HandleFunc("POST /files", HandleApiKey(HandleFileUpload))
-	mux.HandleFunc("GET /files", HandleApiKey(FindFile))
-	mux.HandleFunc("GET /specs", ListToolSpecs)
-	mux.HandleFunc("GET /specs/{toolname}", GetToolSpec)
-	mux.HandleFunc("POST /auth/refresh", HandleRefreshToken)
-	mux.HandleFunc("POST /auth/login", HandleLogin)
-	return mux, nil
+	mux.Handle("GET /runs", s.HandleApiKey(RequireScope(auth.ScopeRunsRead, s.GetAllRuns)))
+	mux.Handle("POST /runs", s.HandleApiKey(RequireScope(auth.ScopeRunsWrite, s.CreateRun)))
+	mux.Handle("GET /runs/{id}", s.HandleApiKey(RequireScope(auth.ScopeRunsRead, s.TrashedRunMiddleware(s.GetRunStatus))))
+	mux.Handle("DELETE /runs/{id}", s.HandleApiKey(RequireScope(auth.ScopeRunsWrite, s.TrashedRunMiddleware(s.DeleteRun))))
+	mux.Handle("POST /runs/{id}/restore", s.HandleApiKey(RequireScope(auth.ScopeRunsWrite, s.TrashedRunMiddleware(s.RestoreRun))))
+	mux.Handle("POST /runs/{id}/start", s.HandleApiKey(RequireScope(auth.ScopeRunsWrite, s.RunMiddleware(s.HandleRunStart))))
+	mux.Handle("GET /runs/{id}/events", s.HandleApiKey(RequireScope(auth.ScopeRunsRead, s.RunMiddleware(s.GetRunEvents))))
+	mux.Handle("GET /runs/{id}/inputs", s.HandleApiKey(RequireScope(auth.ScopeRunsRead, s.RunMiddleware(s.GetRunInputs))))
+	mux.Handle("GET /runs/{id}/results", s.HandleApiKey(RequireScope(auth.ScopeResultsRead, s.RunMiddleware(s.ListRunResults))))
+	mux.Handle("GET /runs/{id}/results/{filename}/preview", s.HandleApiKey(RequireScope(auth.ScopeResultsRead, s.RunMiddleware(PreviewResultFile))))
+	mux.Handle("POST /runs/{id}/results/{filename}/query", s.HandleApiKey(RequireScope(auth.ScopeResultsRead, s.RunMiddleware(QueryResultFile))))
+	mux.Handle("GET /runs/{id}/results/{filename}", s.HandleApiKey(RequireScope(auth.ScopeResultsRead, s.RunMiddleware(s.GetResultFile))))
+	mux.Handle("PATCH /runs/{id}/results/{filename}", s.HandleApiKey(RequireScope(auth.ScopeRunsWrite, s.RunMiddleware(s.AnnotateResultFile))))
+	mux.Handle("GET /runs/{id}/files/{path...}", s.HandleFileAccess(RequireScope(auth.ScopeResultsRead, s.RunMiddleware(s.ServeRunFile))))
+	mux.Handle("POST /runs/{id}/files/sign", s.HandleApiKey(RequireScope(auth.ScopeResultsRead, s.RunMiddleware(s.ShareRunFiles))))
+	mux.Handle("POST /runs/{id}/share", s.HandleApiKey(RequireScope(auth.ScopeResultsRead, s.RunMiddleware(s.CreateRunShare))))
+	mux.Handle("GET /runs/{id}/shares", s.HandleApiKey(RequireScope(auth.ScopeResultsRead, s.OwnedRunMiddleware(s.ListRunShares))))
+	mux.Handle("DELETE /runs/{id}/shares/{token}", s.HandleApiKey(RequireScope(auth.ScopeResultsRead, s.RunMiddleware(s.RevokeRunShare))))
+	mux.Handle("GET /share/{token}", s.ShareMiddleware(s.GetSharedRun))
+	mux.Handle("GET /share/{token}/files/{path...}", s.ShareMiddleware(s.ServeSharedFile))
+	mux.Handle("GET /ws", s.HandleWebSocketAuth(RequireScope(auth.ScopeRunsRead, s.HandleWebSocket)))
+	mux.Handle("GET /notifications", s.HandleApiKey(RequireScope(auth.ScopeRunsRead, s.GetNotificationPreferences)))
+	mux.Handle("PUT /notifications", s.HandleApiKey(RequireScope(auth.ScopeRunsWrite, s.SetNotificationPreferences)))
+	mux.Handle("GET /me/settings", s.HandleApiKey(RequireScope(auth.ScopeRunsRead, s.GetUserSettings)))
+	mux.Handle("PUT /me/settings", s.HandleApiKey(RequireScope(auth.ScopeRunsWrite, s.SetUserSettings)))
+	mux.Handle("GET /projects", s.HandleApiKey(RequireScope(auth.ScopeRunsRead, s.ListProjects)))
+	mux.Handle("POST /projects", s.HandleApiKey(RequireScope(auth.ScopeRunsWrite, s.CreateProject)))
+	mux.Handle("GET /projects/{id}", s.HandleApiKey(RequireScope(auth.ScopeRunsRead, s.GetProject)))
+	mux.Handle("PUT /projects/{id}", s.HandleApiKey(RequireScope(auth.ScopeRunsWrite, s.UpdateProject)))
+	mux.Handle("DELETE /projects/{id}", s.HandleApiKey(RequireScope(auth.ScopeRunsWrite, s.DeleteProject)))
+	mux.Handle("POST /projects/{id}/members", s.HandleApiKey(RequireScope(auth.ScopeRunsWrite, s.AddProjectMember)))
+	mux.Handle("DELETE /projects/{id}/members/{user}", s.HandleApiKey(RequireScope(auth.ScopeRunsWrite, s.RemoveProjectMember)))
+	mux.Handle("GET /reports/usage", s.HandleApiKey(RequireScope(auth.ScopeRunsRead, s.GetUsageReport)))
+	mux.Handle("POST /files", s.HandleApiKey(RequireScope(auth.ScopeRunsWrite, HandleFileUpload)))
+	mux.Handle("GET /files", s.HandleApiKey(RequireScope(auth.ScopeRunsRead, FindFile)))
+	mux.Handle("GET /specs", WithTokenScopes(RequireScope(auth.ScopeSpecsRead, s.ListToolSpecs)))
+	mux.Handle("GET /specs/scan-status", WithTokenScopes(RequireScope(auth.ScopeSpecsRead, s.GetScanStatus)))
+	mux.Handle("GET /specs/{toolname}", WithTokenScopes(RequireScope(auth.ScopeSpecsRead, s.GetToolSpec)))
+	mux.Handle("POST /specs/{toolname}/scan", s.HandleApiKey(RequireScope(auth.ScopeAdmin, s.ScanToolImage)))
+	mux.Handle("GET /specs/{toolname}/stats", s.HandleApiKey(RequireScope(auth.ScopeSpecsRead, s.GetToolUsage)))
+	mux.Handle("GET /admin/stats/tools", s.HandleApiKey(RequireScope(auth.ScopeAdmin, s.ListToolUsage)))
+	mux.Handle("GET /admin/audit", s.HandleApiKey(RequireScope(auth.ScopeAdmin, s.GetAuditLog)))
+	mux.Handle("GET /admin/errors", s.HandleApiKey(RequireScope(auth.ScopeAdmin, s.GetErrorSummary)))
+	mux.Handle("GET /admin/support-bundle", s.HandleApiKey(RequireScope(auth.ScopeAdmin, s.GetSupportBundle)))
+	mux.Handle("GET /metrics", s.HandleApiKey(RequireScope(auth.ScopeAdmin, s.GetMetrics)))
+	mux.Handle("POST /auth/refresh", HandlerFunc(s.HandleRefreshToken))
+	mux.Handle("POST /auth/login", HandlerFunc(s.HandleLogin))
+
+	if viper.GetBool("ui.enabled") {
+		mux.Handle("GET /{$}", HandlerFunc(ServeUI))
+		mux.Handle("GET /ui/{version}/{file...}", HandlerFunc(ServeUIAsset))
+		mux.Handle("GET /ui-config.json", HandlerFunc(GetUIConfig))
+	}
+
+	basePath := BasePath()
+	if basePath == "" {
+		return mux, nil
+	}
+	root := http.NewServeMux()
+	root.Handle(basePath+"/", http.StripPrefix(basePath, mux))
+	return root, nil
 }
 
-func RespondWithError(w http.ResponseWriter, status int, err string) {
-	w.Header().Set("Content-Type", "text/plain")
+func respondWithRawJSON(w http.ResponseWriter, status int, body []byte) {
+	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
-	w.Write([]byte(err))
+	w.Write(body)
 }
 
-func RespondWithJSON(w http.ResponseWriter, status int, data interface{}) {
+// RespondWithJSON writes the response. The status is sent before the body is encoded, so
+// an encoding error is returned to be logged by the responder, not answered.
+func RespondWithJSON(w http.ResponseWriter, status int, data interface{}) error {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
-	err := json.NewEncoder(w).Encode(data)
-	if err != nil {
-		w.Write([]byte(`{"error": "Failed to encode response"}`))
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		return fmt.Errorf("failed to encode the response: %w", err)
 	}
+	return nil
 }
@@ -0,0 +1,117 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/hydrocode-de/gorun/internal/auth"
+	"github.com/spf13/viper"
+)
+
+func TestHandleApiKey(t *testing.T) {
+	s := newTestServer(t)
+	run := s.createRun(t, testUser, "finished")
+	path := fmt.Sprintf("/runs/%d", run.ID)
+	forged, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"user_id": testUser}).SignedString([]byte("another secret"))
+
+	tests := []struct {
+		name   string
+		token  string
+		header []string
+		want   int
+	}{
+		{name: "no token", want: http.StatusUnauthorized},
+		{name: "no token with a user header", header: []string{"X-User-ID", testUser}, want: http.StatusUnauthorized},
+		{name: "invalid token", token: "not-a-token", want: http.StatusUnauthorized},
+		{name: "forged token with a user header", token: forged, header: []string{"X-User-ID", testUser}, want: http.StatusUnauthorized},
+		{name: "owner", token: token(t, testUser), want: http.StatusOK},
+		// the header of the client must not replace the user of the token
+		{name: "other user claiming the owner", token: token(t, otherUser), header: []string{"X-User-ID", testUser}, want: http.StatusNotFound},
+		{name: "admin", token: token(t, testAdmin), want: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := s.do(http.MethodGet, path, tt.token, "", tt.header...); got.Code != tt.want {
+				t.Errorf("the request returned %d, want %d: %s", got.Code, tt.want, got.Body)
+			}
+		})
+	}
+}
+
+func TestRequireScope(t *testing.T) {
+	s := newTestServer(t)
+	run := s.createRun(t, testUser, "finished")
+	path := fmt.Sprintf("/runs/%d", run.ID)
+
+	tests := []struct {
+		name          string
+		scopes        []string
+		requireScopes bool
+		want          int
+	}{
+		{name: "unrestricted", want: http.StatusOK},
+		{name: "unrestricted with required scopes", requireScopes: true, want: http.StatusForbidden},
+		{name: "granted", scopes: []string{auth.ScopeRunsRead}, requireScopes: true, want: http.StatusOK},
+		{name: "other scope", scopes: []string{auth.ScopeResultsRead}, want: http.StatusForbidden},
+		{name: "no scopes", scopes: []string{}, want: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			viper.Set("auth.require_scopes", tt.requireScopes)
+			got := s.do(http.MethodGet, path, token(t, testUser, tt.scopes...), "")
+			if got.Code != tt.want {
+				t.Fatalf("the request returned %d, want %d: %s", got.Code, tt.want, got.Body)
+			}
+			if got.Code != http.StatusForbidden {
+				return
+			}
+			var response ErrorResponse
+			json.NewDecoder(got.Body).Decode(&response)
+			if response.Code != CodeInsufficientScope {
+				t.Errorf("the error code is %s, want %s", response.Code, CodeInsufficientScope)
+			}
+		})
+	}
+}
+
+// the scope check does not depend on an authentication in front of it
+func TestRequireScopeWithoutAuthentication(t *testing.T) {
+	newTestServer(t)
+	called := false
+	handler := RequireScope(auth.ScopeRunsRead, func(w http.ResponseWriter, r *http.Request) error {
+		called = true
+		return nil
+	})
+	s := &testServer{handler: handler}
+	if got := s.do(http.MethodGet, "/", "", ""); got.Code != http.StatusForbidden || called {
+		t.Errorf("the request without scopes returned %d and reached the handler: %v", got.Code, called)
+	}
+}
+
+func TestPublicSpecsAreAnonymous(t *testing.T) {
+	s := newTestServer(t)
+	if got := s.do(http.MethodGet, "/specs", "", ""); got.Code != http.StatusOK {
+		t.Errorf("the anonymous request returned %d: %s", got.Code, got.Body)
+	}
+	if got := s.do(http.MethodGet, "/specs", token(t, testUser, auth.ScopeRunsRead), ""); got.Code != http.StatusForbidden {
+		t.Errorf("a token without specs:read returned %d", got.Code)
+	}
+}
+
+func TestNoAuthUsesTheAdmin(t *testing.T) {
+	s := newTestServer(t)
+	run := s.createRun(t, testUser, "finished")
+	if _, err := auth.CreateAdminCredentials(context.Background(), s.DB); err != nil {
+		t.Fatal(err)
+	}
+	viper.Set("no_auth", true)
+	// the header of the client is dropped, the request is made as the admin
+	got := s.do(http.MethodGet, fmt.Sprintf("/runs/%d", run.ID), "", "", "X-User-ID", otherUser)
+	if got.Code != http.StatusOK {
+		t.Errorf("the request returned %d: %s", got.Code, got.Body)
+	}
+}
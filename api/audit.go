@@ -0,0 +1,85 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/hydrocode-de/gorun/internal/audit"
+	"github.com/hydrocode-de/gorun/internal/db"
+)
+
+type AuditLogResponse struct {
+	Count   int           `json:"count"`
+	Limit   int64         `json:"limit"`
+	Offset  int64         `json:"offset"`
+	Entries []db.AuditLog `json:"entries"`
+}
+
+// the audit log is queried without a window if from or to are missing
+const (
+	auditWindowStart = "0001-01-01 00:00:00"
+	auditWindowEnd   = "9999-12-31 23:59:59"
+)
+
+// recordAudit writes an audit entry for the request in the background
+func (s *Server) recordAudit(r *http.Request, userID string, action audit.Action, target string) {
+	audit.Record(r.Context(), s.DB, audit.Entry{
+		UserID:     userID,
+		Action:     action,
+		Target:     target,
+		RemoteAddr: r.RemoteAddr,
+		RequestID:  RequestID(r.Context()),
+	})
+}
+
+// GetAuditLog lists the audit log to admins, newest entries first
+func (s *Server) GetAuditLog(w http.ResponseWriter, r *http.Request) error {
+	user, err := s.DB.GetUserByID(r.Context(), r.Header.Get("X-User-ID"))
+	if err != nil || !user.IsAdmin {
+		return StatusError(http.StatusForbidden, "only admins may read the audit log")
+	}
+
+	query := r.URL.Query()
+	params := db.GetAuditLogParams{
+		UserID:      query.Get("user"),
+		Action:      query.Get("action"),
+		WindowStart: auditWindowStart,
+		WindowEnd:   auditWindowEnd,
+		Limit:       100,
+	}
+	for name, target := range map[string]*interface{}{"from": &params.WindowStart, "to": &params.WindowEnd} {
+		if value := query.Get(name); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return StatusError(http.StatusBadRequest, fmt.Sprintf("invalid %s %s. Use an RFC 3339 timestamp", name, value))
+			}
+			*target = parsed.UTC().Format(time.DateTime)
+		}
+	}
+	for name, target := range map[string]*int64{"limit": &params.Limit, "offset": &params.Offset} {
+		if value := query.Get(name); value != "" {
+			parsed, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || parsed < 0 {
+				return StatusError(http.StatusBadRequest, fmt.Sprintf("invalid %s %s", name, value))
+			}
+			*target = parsed
+		}
+	}
+	params.Limit = min(params.Limit, 1000)
+
+	entries, err := s.DB.GetAuditLog(r.Context(), params)
+	if err != nil {
+		return StatusError(http.StatusInternalServerError, err.Error())
+	}
+	if entries == nil {
+		entries = []db.AuditLog{}
+	}
+	return RespondWithJSON(w, http.StatusOK, AuditLogResponse{
+		Count:   len(entries),
+		Limit:   params.Limit,
+		Offset:  params.Offset,
+		Entries: entries,
+	})
+}
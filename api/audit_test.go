@@ -0,0 +1,235 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/hydrocode-de/gorun/internal/audit"
+	"github.com/hydrocode-de/gorun/internal/auth"
+	"github.com/hydrocode-de/gorun/internal/db"
+	"github.com/hydrocode-de/gorun/internal/dockertest"
+	"github.com/spf13/viper"
+)
+
+// lastAuditEntry waits for the entries recorded in the background and returns the newest one
+func (s *testServer) lastAuditEntry(t *testing.T) (db.AuditLog, bool) {
+	t.Helper()
+	audit.Wait()
+	entries, err := s.DB.GetAuditLog(context.Background(), db.GetAuditLogParams{
+		UserID:      "",
+		Action:      "",
+		WindowStart: auditWindowStart,
+		WindowEnd:   auditWindowEnd,
+		Limit:       1,
+	})
+	if err != nil {
+		t.Fatalf("cannot read the audit log: %v", err)
+	}
+	if len(entries) == 0 {
+		return db.AuditLog{}, false
+	}
+	return entries[0], true
+}
+
+// each sensitive request leaves an entry of its user, action and target
+func TestSensitiveRequestsAreAudited(t *testing.T) {
+	s := newTestServer(t)
+	daemon := dockertest.New(t)
+	daemon.AddImage(dockertest.Image{
+		RepoTags: []string{"gorun-test:1.0"},
+		Labels:   map[string]string{"org.toolspec.spec": "tools:\n  echo:\n    title: Echo\n    description: Echoes\n"},
+	})
+	for key, value := range map[string]any{
+		"run.trash_retention":    time.Hour,
+		"data_mode":              "copy",
+		"run.runtime":            "docker",
+		"images.spec_label":      "org.toolspec.spec",
+		"images.max_label_bytes": 1024,
+		"tools.load_on_demand":   true,
+		"tools.load_timeout":     10 * time.Second,
+	} {
+		viper.Set(key, value)
+	}
+	if _, err := auth.CreateUser(context.Background(), s.DB, "carol@example.org", "a password", false, testSecret); err != nil {
+		t.Fatal(err)
+	}
+	carol, err := s.DB.GetUserByEmail(context.Background(), "carol@example.org")
+	if err != nil {
+		t.Fatal(err)
+	}
+	finished := s.createFinishedRun(t, testUser, map[string]string{"data.csv": "a,b\n"})
+	trashed := s.createRun(t, testUser, "finished")
+	deleted := s.createRun(t, testUser, "finished")
+	pending := s.createRun(t, testUser, "pending")
+	var created db.Run
+	var shareToken string
+	var projectID int64
+
+	steps := []struct {
+		name string
+		// request sends the request, later steps use what earlier ones created
+		request func() *httptest.ResponseRecorder
+		user    string
+		action  audit.Action
+		// target is read after the request, once the IDs it creates are known
+		target func() string
+	}{
+		{
+			name: "login",
+			request: func() *httptest.ResponseRecorder {
+				return s.do(http.MethodPost, "/auth/login", "", `{"email": "carol@example.org", "password": "a password"}`)
+			},
+			user: carol.ID, action: audit.ActionTokenIssue, target: func() string { return "user:" + carol.ID },
+		},
+		{
+			name: "create",
+			request: func() *httptest.ResponseRecorder {
+				resp := s.do(http.MethodPost, "/runs", token(t, testUser), `{"name": "echo", "docker_image": "gorun-test:1.0"}`)
+				json.Unmarshal(resp.Body.Bytes(), &created)
+				return resp
+			},
+			user: testUser, action: audit.ActionRunCreate, target: func() string { return fmt.Sprintf("run:%d", created.ID) },
+		},
+		{
+			name: "start",
+			request: func() *httptest.ResponseRecorder {
+				return s.do(http.MethodPost, fmt.Sprintf("/runs/%d/start", pending.ID), token(t, testUser), "")
+			},
+			user: testUser, action: audit.ActionRunStart, target: func() string { return fmt.Sprintf("run:%d", pending.ID) },
+		},
+		{
+			name: "trash",
+			request: func() *httptest.ResponseRecorder {
+				return s.do(http.MethodDelete, fmt.Sprintf("/runs/%d", trashed.ID), token(t, testUser), "")
+			},
+			user: testUser, action: audit.ActionRunTrash, target: func() string { return fmt.Sprintf("run:%d", trashed.ID) },
+		},
+		{
+			name: "restore",
+			request: func() *httptest.ResponseRecorder {
+				return s.do(http.MethodPost, fmt.Sprintf("/runs/%d/restore", trashed.ID), token(t, testUser), "")
+			},
+			user: testUser, action: audit.ActionRunRestore, target: func() string { return fmt.Sprintf("run:%d", trashed.ID) },
+		},
+		{
+			name: "delete",
+			request: func() *httptest.ResponseRecorder {
+				return s.do(http.MethodDelete, fmt.Sprintf("/runs/%d?purge=true", deleted.ID), token(t, testUser), "")
+			},
+			user: testUser, action: audit.ActionRunDelete, target: func() string { return fmt.Sprintf("run:%d", deleted.ID) },
+		},
+		{
+			name: "result download",
+			request: func() *httptest.ResponseRecorder {
+				return s.do(http.MethodGet, fmt.Sprintf("/runs/%d/results/data.csv", finished.ID), token(t, testUser), "")
+			},
+			user: testUser, action: audit.ActionResultDownload, target: func() string { return fmt.Sprintf("run:%d/data.csv", finished.ID) },
+		},
+		{
+			name: "static file",
+			request: func() *httptest.ResponseRecorder {
+				return s.do(http.MethodGet, fmt.Sprintf("/runs/%d/files/data.csv", finished.ID), token(t, testUser), "")
+			},
+			user: testUser, action: audit.ActionResultDownload, target: func() string { return fmt.Sprintf("run:%d/data.csv", finished.ID) },
+		},
+		{
+			name: "annotation",
+			request: func() *httptest.ResponseRecorder {
+				return s.do(http.MethodPatch, fmt.Sprintf("/runs/%d/results/data.csv", finished.ID), token(t, testUser), `{"label": "the data"}`)
+			},
+			user: testUser, action: audit.ActionResultAnnotate, target: func() string { return fmt.Sprintf("run:%d/data.csv", finished.ID) },
+		},
+		{
+			name: "signed files",
+			request: func() *httptest.ResponseRecorder {
+				return s.do(http.MethodPost, fmt.Sprintf("/runs/%d/files/sign", finished.ID), token(t, testUser), "")
+			},
+			user: testUser, action: audit.ActionResultShare, target: func() string { return fmt.Sprintf("run:%d", finished.ID) },
+		},
+		{
+			name: "share",
+			request: func() *httptest.ResponseRecorder {
+				resp := s.do(http.MethodPost, fmt.Sprintf("/runs/%d/share", finished.ID), token(t, testUser), "")
+				var share RunShareResponse
+				json.Unmarshal(resp.Body.Bytes(), &share)
+				shareToken = share.Token
+				return resp
+			},
+			user: testUser, action: audit.ActionResultShare, target: func() string { return fmt.Sprintf("run:%d", finished.ID) },
+		},
+		{
+			name: "unshare",
+			request: func() *httptest.ResponseRecorder {
+				return s.do(http.MethodDelete, fmt.Sprintf("/runs/%d/shares/%s", finished.ID, shareToken), token(t, testUser), "")
+			},
+			user: testUser, action: audit.ActionResultUnshare, target: func() string { return fmt.Sprintf("run:%d", finished.ID) },
+		},
+		{
+			name: "project create",
+			request: func() *httptest.ResponseRecorder {
+				resp := s.do(http.MethodPost, "/projects", token(t, testUser), `{"name": "audited"}`)
+				var project struct {
+					ID int64 `json:"id"`
+				}
+				json.Unmarshal(resp.Body.Bytes(), &project)
+				projectID = project.ID
+				return resp
+			},
+			user: testUser, action: audit.ActionProjectCreate, target: func() string { return fmt.Sprintf("project:%d", projectID) },
+		},
+		{
+			name: "project update",
+			request: func() *httptest.ResponseRecorder {
+				return s.do(http.MethodPut, fmt.Sprintf("/projects/%d", projectID), token(t, testUser), `{"name": "renamed"}`)
+			},
+			user: testUser, action: audit.ActionProjectUpdate, target: func() string { return fmt.Sprintf("project:%d", projectID) },
+		},
+		{
+			name: "member add",
+			request: func() *httptest.ResponseRecorder {
+				return s.do(http.MethodPost, fmt.Sprintf("/projects/%d/members", projectID), token(t, testUser), `{"user_id": "bob"}`)
+			},
+			user: testUser, action: audit.ActionProjectMemberAdd, target: func() string { return fmt.Sprintf("project:%d/user:bob", projectID) },
+		},
+		{
+			name: "member remove",
+			request: func() *httptest.ResponseRecorder {
+				return s.do(http.MethodDelete, fmt.Sprintf("/projects/%d/members/bob", projectID), token(t, testUser), "")
+			},
+			user: testUser, action: audit.ActionProjectMemberDrop, target: func() string { return fmt.Sprintf("project:%d/user:bob", projectID) },
+		},
+		{
+			name: "project delete",
+			request: func() *httptest.ResponseRecorder {
+				return s.do(http.MethodDelete, fmt.Sprintf("/projects/%d", projectID), token(t, testUser), "")
+			},
+			user: testUser, action: audit.ActionProjectDelete, target: func() string { return fmt.Sprintf("project:%d", projectID) },
+		},
+		{
+			name: "support bundle",
+			request: func() *httptest.ResponseRecorder {
+				return s.do(http.MethodGet, "/admin/support-bundle", token(t, testAdmin), "")
+			},
+			user: testAdmin, action: audit.ActionSupportBundle, target: func() string { return "server" },
+		},
+	}
+	for _, step := range steps {
+		resp := step.request()
+		if resp.Code >= 300 {
+			t.Fatalf("the %s request answered %d: %s", step.name, resp.Code, resp.Body)
+		}
+		entry, ok := s.lastAuditEntry(t)
+		target := step.target()
+		if !ok || entry.UserID != step.user || entry.Action != string(step.action) || entry.Target != target {
+			t.Errorf("the %s request left the entry %+v, want %s of %s on %s", step.name, entry, step.action, step.user, target)
+		}
+		if entry.RemoteAddr == "" {
+			t.Errorf("the entry of the %s request has no remote address: %+v", step.name, entry)
+		}
+	}
+}
@@ -4,51 +4,60 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strings"
 
+	"github.com/hydrocode-de/gorun/internal/audit"
 	"github.com/hydrocode-de/gorun/internal/auth"
-	"github.com/hydrocode-de/gorun/internal/db"
 	"github.com/spf13/viper"
 )
 
-func HandleRefreshToken(w http.ResponseWriter, r *http.Request) {
+func (s *Server) HandleRefreshToken(w http.ResponseWriter, r *http.Request) error {
 	// the refresh token is sent as a JSON body
 	var refreshToken struct {
-		RefreshToken string `json:"refresh_token"`
+		RefreshToken string   `json:"refresh_token"`
+		Scopes       []string `json:"scopes"`
 	}
 	err := json.NewDecoder(r.Body).Decode(&refreshToken)
 	if err != nil {
-		RespondWithError(w, http.StatusBadRequest, "Invalid request body. A refresh token is required.")
+		return StatusError(http.StatusBadRequest, "Invalid request body. A refresh token is required.")
 	}
 
-	DB := viper.Get("db").(*db.Queries)
+	scopes, err := auth.ParseScopes(strings.Join(refreshToken.Scopes, ","))
+	if err != nil {
+		return StatusError(http.StatusBadRequest, err.Error())
+	}
 	secret := viper.GetString("secret")
 
-	response, err := auth.NewJWTFromRefreshToken(r.Context(), DB, refreshToken.RefreshToken, secret)
+	response, err := auth.NewScopedJWTFromRefreshToken(r.Context(), s.DB, refreshToken.RefreshToken, secret, scopes)
 	if err != nil {
-		RespondWithError(w, http.StatusUnauthorized, fmt.Sprintf("Invalid refresh token: %v", err))
+		return StatusError(http.StatusUnauthorized, fmt.Sprintf("Invalid refresh token: %v", err))
 	}
+	s.recordAudit(r, response.User.ID, audit.ActionTokenIssue, "user:"+response.User.ID)
 
-	RespondWithJSON(w, http.StatusOK, response)
+	return RespondWithJSON(w, http.StatusOK, response)
 }
 
-func HandleLogin(w http.ResponseWriter, r *http.Request) {
+func (s *Server) HandleLogin(w http.ResponseWriter, r *http.Request) error {
 	var loginRequest struct {
-		Email    string `json:"email"`
-		Password string `json:"password"`
+		Email    string   `json:"email"`
+		Password string   `json:"password"`
+		Scopes   []string `json:"scopes"`
 	}
 	err := json.NewDecoder(r.Body).Decode(&loginRequest)
 	if err != nil {
-		RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("Could not parse request body: %v", err))
-		return
+		return StatusError(http.StatusBadRequest, fmt.Sprintf("Could not parse request body: %v", err))
 	}
 
-	DB := viper.Get("db").(*db.Queries)
+	scopes, err := auth.ParseScopes(strings.Join(loginRequest.Scopes, ","))
+	if err != nil {
+		return StatusError(http.StatusBadRequest, err.Error())
+	}
 	secret := viper.GetString("secret")
-	response, err := auth.LoginUser(r.Context(), DB, loginRequest.Email, loginRequest.Password, secret)
+	response, err := auth.LoginUser(r.Context(), s.DB, loginRequest.Email, loginRequest.Password, secret, scopes)
 	if err != nil {
-		RespondWithError(w, http.StatusUnauthorized, fmt.Sprintf("Login attempt failed: %v", err))
-		return
+		return StatusError(http.StatusUnauthorized, fmt.Sprintf("Login attempt failed: %v", err))
 	}
+	s.recordAudit(r, response.User.ID, audit.ActionTokenIssue, "user:"+response.User.ID)
 
-	RespondWithJSON(w, http.StatusOK, response)
+	return RespondWithJSON(w, http.StatusOK, response)
 }
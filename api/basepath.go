@@ -0,0 +1,99 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// BasePath returns the normalized server.base_path, e.g. /gorun, or an empty string
+func BasePath() string {
+	base := strings.Trim(viper.GetString("server.base_path"), "/")
+	if base == "" {
+		return ""
+	}
+	return "/" + base
+}
+
+// TrustedProxies parses server.trusted_proxies, the addresses and CIDR ranges of the
+// reverse proxies whose X-Forwarded-* headers are honored. The list may also be given as
+// one comma separated string, like in GORUN_SERVER_TRUSTED_PROXIES.
+func TrustedProxies() ([]netip.Prefix, error) {
+	var proxies []netip.Prefix
+	for _, value := range viper.GetStringSlice("server.trusted_proxies") {
+		for _, entry := range strings.Split(value, ",") {
+			entry = strings.TrimSpace(entry)
+			if entry == "" {
+				continue
+			}
+			if strings.Contains(entry, "/") {
+				prefix, err := netip.ParsePrefix(entry)
+				if err != nil {
+					return nil, fmt.Errorf("invalid server.trusted_proxies entry %s: %w", entry, err)
+				}
+				proxies = append(proxies, prefix.Masked())
+				continue
+			}
+			addr, err := netip.ParseAddr(entry)
+			if err != nil {
+				return nil, fmt.Errorf("invalid server.trusted_proxies entry %s: %w", entry, err)
+			}
+			proxies = append(proxies, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+		}
+	}
+	return proxies, nil
+}
+
+// fromTrustedProxy tells if the request was sent by one of server.trusted_proxies. The
+// X-Forwarded-* headers of any other client are ignored, as it could point the links
+// gorun hands out to another host.
+func fromTrustedProxy(r *http.Request) bool {
+	remote, err := netip.ParseAddrPort(r.RemoteAddr)
+	if err != nil {
+		return false
+	}
+	proxies, _ := TrustedProxies()
+	for _, proxy := range proxies {
+		if proxy.Contains(remote.Addr().Unmap()) {
+			return true
+		}
+	}
+	return false
+}
+
+// forwarded returns the first value of the X-Forwarded-* header of a trusted proxy
+func forwarded(r *http.Request, header string) string {
+	if !fromTrustedProxy(r) {
+		return ""
+	}
+	return strings.TrimSpace(strings.Split(r.Header.Get(header), ",")[0])
+}
+
+// linkPrefix is the path prefix the client sees in front of the API routes.
+// A reverse proxy that strips the prefix announces it with X-Forwarded-Prefix.
+func linkPrefix(r *http.Request) string {
+	if prefix := strings.Trim(forwarded(r, "X-Forwarded-Prefix"), "/"); prefix != "" {
+		return "/" + prefix
+	}
+	return BasePath()
+}
+
+// absoluteURL builds a link to an API route as the client sees it, honoring
+// the base path and the X-Forwarded-* headers of a trusted reverse proxy.
+func absoluteURL(r *http.Request, route string) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if proto := forwarded(r, "X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+	host := r.Host
+	if forwardedHost := forwarded(r, "X-Forwarded-Host"); forwardedHost != "" {
+		host = forwardedHost
+	}
+	return scheme + "://" + host + linkPrefix(r) + "/" + strings.TrimPrefix(route, "/")
+}
@@ -0,0 +1,122 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+// proxyHeaders are the headers of a reverse proxy serving gorun as https://gorun.example.org/proxied
+var proxyHeaders = []string{"X-Forwarded-Proto", "https", "X-Forwarded-Host", "gorun.example.org", "X-Forwarded-Prefix", "/proxied"}
+
+func TestAbsoluteURLTrustsOnlyProxies(t *testing.T) {
+	const proxied = "https://gorun.example.org/proxied/runs/1"
+	tests := []struct {
+		name     string
+		proxies  interface{}
+		basePath string
+		want     string
+	}{
+		{name: "no trusted proxies", want: "http://example.com/runs/1"},
+		{name: "no trusted proxies with base path", basePath: "/gorun", want: "http://example.com/gorun/runs/1"},
+		{name: "other proxy", proxies: []string{"10.0.0.0/8"}, basePath: "/gorun", want: "http://example.com/gorun/runs/1"},
+		{name: "trusted address", proxies: []string{"192.0.2.1"}, want: proxied},
+		{name: "trusted range", proxies: []string{"192.0.2.0/24"}, basePath: "/gorun", want: proxied},
+		{name: "comma separated", proxies: "10.0.0.0/8, 192.0.2.1", want: proxied},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			viper.Reset()
+			t.Cleanup(viper.Reset)
+			viper.Set("server.trusted_proxies", tt.proxies)
+			viper.Set("server.base_path", tt.basePath)
+			// the requests of httptest come from 192.0.2.1
+			r := httptest.NewRequest(http.MethodGet, "/runs/1", nil)
+			for i := 0; i+1 < len(proxyHeaders); i += 2 {
+				r.Header.Set(proxyHeaders[i], proxyHeaders[i+1])
+			}
+			if got := absoluteURL(r, "/runs/1"); got != tt.want {
+				t.Errorf("the link is %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTrustedProxiesRejectsInvalidEntries(t *testing.T) {
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+	for _, value := range []string{"proxy.example.org", "10.0.0.0/33", "127.0.0.1,"} {
+		viper.Set("server.trusted_proxies", value)
+		_, err := TrustedProxies()
+		if wantErr := value != "127.0.0.1,"; (err != nil) != wantErr {
+			t.Errorf("the trusted proxies %q returned %v", value, err)
+		}
+	}
+}
+
+// every link gorun returns carries the base path, or the prefix of a trusted proxy
+func TestEmittedURLsCarryThePrefix(t *testing.T) {
+	tests := []struct {
+		name string
+		// basePath is the prefix of the routes, the links start with wantPrefix
+		basePath   string
+		proxies    []string
+		header     []string
+		wantPrefix string
+	}{
+		{name: "base path", basePath: "/gorun", wantPrefix: "http://example.com/gorun/"},
+		{name: "trusted proxy", proxies: []string{"192.0.2.1"}, header: proxyHeaders, wantPrefix: "https://gorun.example.org/proxied/"},
+		{name: "untrusted proxy", basePath: "/gorun", header: proxyHeaders, wantPrefix: "http://example.com/gorun/"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t)
+			startableImage(t)
+			viper.Set("server.base_path", tt.basePath)
+			viper.Set("server.trusted_proxies", tt.proxies)
+			handler, err := CreateServer(s.App)
+			if err != nil {
+				t.Fatal(err)
+			}
+			s.handler = handler
+			request := func(method string, path string, accessToken string) *httptest.ResponseRecorder {
+				t.Helper()
+				resp := s.do(method, tt.basePath+path, accessToken, "", tt.header...)
+				if resp.Code >= 300 {
+					t.Fatalf("%s %s answered %d: %s", method, path, resp.Code, resp.Body)
+				}
+				return resp
+			}
+			links := make(map[string]string)
+
+			run := s.createFinishedRun(t, testUser, map[string]string{"report.html": "<p>report</p>"})
+			var share RunShareResponse
+			json.Unmarshal(request(http.MethodPost, fmt.Sprintf("/runs/%d/share", run.ID), token(t, testUser)).Body.Bytes(), &share)
+			links["share"] = share.URL
+			var shared SharedRunResponse
+			json.Unmarshal(request(http.MethodGet, "/share/"+share.Token, "").Body.Bytes(), &shared)
+			if len(shared.Results) != 1 {
+				t.Fatalf("the shared run lists %+v", shared.Results)
+			}
+			links["shared file"] = shared.Results[0].URL
+			var signed ShareRunFilesResponse
+			json.Unmarshal(request(http.MethodPost, fmt.Sprintf("/runs/%d/files/sign", run.ID), token(t, testUser)).Body.Bytes(), &signed)
+			links["signed files"] = signed.URL
+
+			pending := s.createRun(t, testUser, "pending")
+			links["location"] = request(http.MethodPost, fmt.Sprintf("/runs/%d/start", pending.ID), token(t, testUser)).Header().Get("Location")
+			s.waitForRun(t, pending.ID)
+
+			for name, link := range links {
+				if !strings.HasPrefix(link, tt.wantPrefix) {
+					t.Errorf("the %s link is %q, want it to start with %s", name, link, tt.wantPrefix)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,165 @@
+package api
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/docker/docker/client"
+	"github.com/hydrocode-de/gorun/internal/tool"
+	"github.com/hydrocode-de/gorun/internal/toolImage"
+)
+
+// ErrorCode is a stable, machine-readable identifier of an error response
+type ErrorCode string
+
+const (
+	CodeBadRequest           ErrorCode = "bad_request"
+	CodeUnauthorized         ErrorCode = "unauthorized"
+	CodeForbidden            ErrorCode = "forbidden"
+	CodeInsufficientScope    ErrorCode = "insufficient_scope"
+	CodeNotFound             ErrorCode = "not_found"
+	CodeValidationFailed     ErrorCode = "validation_failed"
+	CodePolicyViolation      ErrorCode = "policy_violation"
+	CodeDockerUnavailable    ErrorCode = "docker_unavailable"
+	CodeRunConflict          ErrorCode = "run_conflict"
+	CodeRunExpired           ErrorCode = "run_expired"
+	CodeRateLimited          ErrorCode = "rate_limited"
+	CodePayloadTooLarge      ErrorCode = "payload_too_large"
+	CodeUnsupportedMediaType ErrorCode = "unsupported_media_type"
+	CodeInternalError        ErrorCode = "internal_error"
+)
+
+// ErrorResponse is the envelope of every error returned by the API. Handlers return it
+// as their error, along with the status it is answered with.
+type ErrorResponse struct {
+	Code    ErrorCode   `json:"code"`
+	Message string      `json:"message"`
+	Details interface{} `json:"details,omitempty"`
+	status  int
+}
+
+func (e *ErrorResponse) Error() string {
+	return e.Message
+}
+
+// StatusError is the error a handler returns to be answered with the status and message
+func StatusError(status int, message string) error {
+	return &ErrorResponse{
+		Code:    codeFromStatus(status),
+		Message: message,
+		status:  status,
+	}
+}
+
+// HandlerFunc is a handler which returns its error response instead of writing it, so
+// that a handler cannot go on after an error and answer a second time
+type HandlerFunc func(http.ResponseWriter, *http.Request) error
+
+// RunHandlerFunc is the HandlerFunc of a run, loaded by the RunMiddleware
+type RunHandlerFunc func(http.ResponseWriter, *http.Request, tool.Tool) error
+
+// ServeHTTP is the single responder of the errors returned by the handlers. An error
+// returned after the handler started its response cannot be answered anymore and is logged.
+func (h HandlerFunc) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	recorder := &statusRecorder{ResponseWriter: w}
+	err := h(recorder, r)
+	if err == nil {
+		return
+	}
+	if recorder.status != 0 {
+		requestLogger(r).Printf("the response was already sent with status %d, dropping the error: %v", recorder.status, err)
+		return
+	}
+	RespondWithError(w, err)
+}
+
+func codeFromStatus(status int) ErrorCode {
+	switch status {
+	case http.StatusBadRequest:
+		return CodeBadRequest
+	case http.StatusUnauthorized:
+		return CodeUnauthorized
+	case http.StatusForbidden:
+		return CodeForbidden
+	case http.StatusNotFound:
+		return CodeNotFound
+	case http.StatusConflict:
+		return CodeRunConflict
+	case http.StatusRequestEntityTooLarge:
+		return CodePayloadTooLarge
+	case http.StatusUnsupportedMediaType:
+		return CodeUnsupportedMediaType
+	case http.StatusTooManyRequests:
+		return CodeRateLimited
+	case http.StatusServiceUnavailable:
+		return CodeDockerUnavailable
+	default:
+		return CodeInternalError
+	}
+}
+
+// ErrorStatus maps an error returned by the tool package to the HTTP status and error code
+func ErrorStatus(err error) (int, ErrorCode) {
+	switch {
+	case tool.IsValidationError(err):
+		return http.StatusBadRequest, CodeValidationFailed
+	case tool.IsNotFound(err), errors.Is(err, toolImage.ErrToolNotFound):
+		return http.StatusNotFound, CodeNotFound
+	case tool.IsUnauthorized(err):
+		return http.StatusUnauthorized, CodeUnauthorized
+	case errors.Is(err, toolImage.ErrPolicyViolation):
+		return http.StatusForbidden, CodePolicyViolation
+	case errors.Is(err, tool.ErrForbidden):
+		return http.StatusForbidden, CodeForbidden
+	case errors.Is(err, tool.ErrRateLimited):
+		return http.StatusTooManyRequests, CodeRateLimited
+	case errors.Is(err, tool.ErrRunActive), errors.Is(err, tool.ErrProjectNotEmpty), errors.Is(err, tool.ErrNotTrashed), errors.Is(err, tool.ErrNotStartable):
+		return http.StatusConflict, CodeRunConflict
+	case errors.Is(err, tool.ErrRunExpired):
+		return http.StatusConflict, CodeRunExpired
+	case errors.Is(err, tool.ErrNotTabular):
+		return http.StatusUnsupportedMediaType, CodeUnsupportedMediaType
+	case errors.Is(err, tool.ErrResultTooLarge):
+		return http.StatusRequestEntityTooLarge, CodePayloadTooLarge
+	case client.IsErrConnectionFailed(err):
+		return http.StatusServiceUnavailable, CodeDockerUnavailable
+	default:
+		return http.StatusInternalServerError, CodeInternalError
+	}
+}
+
+// RespondWithError writes the error envelope. Errors returned by the tool package are
+// mapped by ErrorStatus: validation errors list every single problem in the details,
+// a missing tool the tools available in the image and a rate limit when to retry.
+func RespondWithError(w http.ResponseWriter, err error) {
+	var response *ErrorResponse
+	if errors.As(err, &response) {
+		RespondWithJSON(w, response.status, response)
+		return
+	}
+
+	status, code := ErrorStatus(err)
+	response = &ErrorResponse{
+		Code:    code,
+		Message: err.Error(),
+	}
+
+	var validationErr *tool.ValidationError
+	var toolNotFoundErr *tool.ToolNotFoundError
+	var rateLimitErr *tool.RateLimitError
+	if errors.As(err, &validationErr) {
+		response.Details = validationErr.Errors
+	} else if errors.As(err, &toolNotFoundErr) {
+		response.Details = toolNotFoundErr
+	} else if errors.As(err, &rateLimitErr) {
+		retryAfter := int64(math.Ceil(rateLimitErr.RetryAfter.Seconds()))
+		w.Header().Set("Retry-After", strconv.FormatInt(retryAfter, 10))
+		response.Details = map[string]int64{
+			"runs_per_minute":     rateLimitErr.Limit,
+			"retry_after_seconds": retryAfter,
+		}
+	}
+	RespondWithJSON(w, status, response)
+}
@@ -0,0 +1,279 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/client"
+	"github.com/hydrocode-de/gorun/internal/auth"
+	"github.com/hydrocode-de/gorun/internal/tool"
+	"github.com/hydrocode-de/gorun/internal/toolImage"
+)
+
+// singleResponse counts the status codes written, the httptest.ResponseRecorder
+// silently drops all but the first
+type singleResponse struct {
+	*httptest.ResponseRecorder
+	statuses int
+}
+
+func (w *singleResponse) WriteHeader(status int) {
+	w.statuses++
+	w.ResponseRecorder.WriteHeader(status)
+}
+
+func (w *singleResponse) Write(b []byte) (int, error) {
+	if w.statuses == 0 {
+		w.statuses++
+	}
+	return w.ResponseRecorder.Write(b)
+}
+
+// serveOnce sends the request to the handler and fails unless exactly one status was written
+func serveOnce(t *testing.T, handler http.Handler, request *http.Request) *httptest.ResponseRecorder {
+	t.Helper()
+	w := &singleResponse{ResponseRecorder: httptest.NewRecorder()}
+	handler.ServeHTTP(w, request)
+	if w.statuses != 1 {
+		t.Errorf("the handler wrote %d status codes, want 1", w.statuses)
+	}
+	return w.ResponseRecorder
+}
+
+// errorBody decodes the error envelope and fails if the body holds anything after it
+func errorBody(t *testing.T, resp *httptest.ResponseRecorder) ErrorResponse {
+	t.Helper()
+	var body ErrorResponse
+	decoder := json.NewDecoder(resp.Body)
+	if err := decoder.Decode(&body); err != nil {
+		t.Fatalf("the body is no error envelope: %v", err)
+	}
+	if decoder.More() {
+		t.Errorf("the body holds more than the error envelope")
+	}
+	return body
+}
+
+func TestHandlerFuncAnswersOnce(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler HandlerFunc
+		status  int
+		code    ErrorCode
+	}{
+		{
+			name: "status error",
+			handler: func(w http.ResponseWriter, r *http.Request) error {
+				return StatusError(http.StatusBadRequest, "bad")
+			},
+			status: http.StatusBadRequest, code: CodeBadRequest,
+		},
+		{
+			name: "service error",
+			handler: func(w http.ResponseWriter, r *http.Request) error {
+				return fmt.Errorf("the run 1 was not found: %w", tool.ErrNotFound)
+			},
+			status: http.StatusNotFound, code: CodeNotFound,
+		},
+		{
+			name: "unknown error",
+			handler: func(w http.ResponseWriter, r *http.Request) error {
+				return errors.New("disk on fire")
+			},
+			status: http.StatusInternalServerError, code: CodeInternalError,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := serveOnce(t, tt.handler, httptest.NewRequest(http.MethodGet, "/", nil))
+			if resp.Code != tt.status {
+				t.Errorf("the handler answered %d, want %d", resp.Code, tt.status)
+			}
+			if body := errorBody(t, resp); body.Code != tt.code {
+				t.Errorf("the error code is %s, want %s", body.Code, tt.code)
+			}
+		})
+	}
+}
+
+// an error returned after the response was started is logged, not answered a second time
+func TestHandlerFuncErrorAfterResponse(t *testing.T) {
+	tests := map[string]HandlerFunc{
+		"written": func(w http.ResponseWriter, r *http.Request) error {
+			RespondWithJSON(w, http.StatusOK, map[string]string{"message": "done"})
+			return errors.New("failed afterwards")
+		},
+		"encoding": func(w http.ResponseWriter, r *http.Request) error {
+			return RespondWithJSON(w, http.StatusOK, map[string]interface{}{"channel": make(chan int)})
+		},
+	}
+	for name, handler := range tests {
+		t.Run(name, func(t *testing.T) {
+			resp := serveOnce(t, handler, httptest.NewRequest(http.MethodGet, "/", nil))
+			if resp.Code != http.StatusOK {
+				t.Errorf("the handler answered %d, want the 200 it wrote", resp.Code)
+			}
+			var body ErrorResponse
+			if json.Unmarshal(resp.Body.Bytes(), &body) == nil && body.Code != "" {
+				t.Errorf("the error was answered after the response: %s", resp.Body)
+			}
+		})
+	}
+}
+
+// every error branch of the handlers answers with a single status and error envelope
+func TestHandlerErrorBranches(t *testing.T) {
+	s := newTestServer(t)
+	finished := s.createRun(t, testUser, "finished")
+	running := s.createRun(t, testUser, "running")
+	trashed := s.createRun(t, testUser, "finished")
+	if _, err := s.conn.Exec("UPDATE runs SET deleted_at = CURRENT_TIMESTAMP WHERE id = ?", trashed.ID); err != nil {
+		t.Fatal(err)
+	}
+	alice := token(t, testUser)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		body   string
+		status int
+		code   ErrorCode
+	}{
+		{name: "no token", method: http.MethodGet, path: "/runs", status: http.StatusUnauthorized, code: CodeUnauthorized},
+		{name: "invalid token", method: http.MethodGet, path: "/runs", token: "garbage", status: http.StatusUnauthorized, code: CodeUnauthorized},
+		{name: "missing scope", method: http.MethodGet, path: "/runs", token: token(t, testUser, auth.ScopeSpecsRead), status: http.StatusForbidden, code: CodeInsufficientScope},
+		{name: "list status", method: http.MethodGet, path: "/runs?status=bogus", token: alice, status: http.StatusBadRequest, code: CodeBadRequest},
+		{name: "list full", method: http.MethodGet, path: "/runs?full=maybe", token: alice, status: http.StatusBadRequest, code: CodeBadRequest},
+		{name: "list trashed", method: http.MethodGet, path: "/runs?trashed=maybe", token: alice, status: http.StatusBadRequest, code: CodeBadRequest},
+		{name: "list project", method: http.MethodGet, path: "/runs?project=mine", token: alice, status: http.StatusBadRequest, code: CodeBadRequest},
+		{name: "list kind", method: http.MethodGet, path: "/runs?kind=bogus", token: alice, status: http.StatusBadRequest, code: CodeBadRequest},
+		{name: "list sort", method: http.MethodGet, path: "/runs?sort=name", token: alice, status: http.StatusBadRequest, code: CodeBadRequest},
+		{name: "run id", method: http.MethodGet, path: "/runs/abc/events", token: alice, status: http.StatusBadRequest, code: CodeBadRequest},
+		{name: "unknown run", method: http.MethodGet, path: "/runs/9999/events", token: alice, status: http.StatusNotFound, code: CodeNotFound},
+		{name: "run of another user", method: http.MethodPost, path: fmt.Sprintf("/runs/%d/start", finished.ID), token: token(t, otherUser), status: http.StatusNotFound, code: CodeNotFound},
+		{name: "trashed run", method: http.MethodGet, path: fmt.Sprintf("/runs/%d/events", trashed.ID), token: alice, status: http.StatusNotFound, code: CodeNotFound},
+		{name: "include logs", method: http.MethodGet, path: fmt.Sprintf("/runs/%d?include_logs=all", finished.ID), token: alice, status: http.StatusBadRequest, code: CodeBadRequest},
+		{name: "delete force", method: http.MethodDelete, path: fmt.Sprintf("/runs/%d?force=maybe", finished.ID), token: alice, status: http.StatusBadRequest, code: CodeBadRequest},
+		{name: "delete purge", method: http.MethodDelete, path: fmt.Sprintf("/runs/%d?purge=maybe", finished.ID), token: alice, status: http.StatusBadRequest, code: CodeBadRequest},
+		{name: "delete running", method: http.MethodDelete, path: fmt.Sprintf("/runs/%d", running.ID), token: alice, status: http.StatusConflict, code: CodeRunConflict},
+		{name: "start finished", method: http.MethodPost, path: fmt.Sprintf("/runs/%d/start", finished.ID), token: alice, status: http.StatusConflict, code: CodeRunConflict},
+		{name: "create payload", method: http.MethodPost, path: "/runs", token: alice, body: "{", status: http.StatusBadRequest, code: CodeBadRequest},
+		{name: "results flat", method: http.MethodGet, path: fmt.Sprintf("/runs/%d/results?flat=maybe", finished.ID), token: alice, status: http.StatusBadRequest, code: CodeBadRequest},
+		{name: "annotation", method: http.MethodPatch, path: fmt.Sprintf("/runs/%d/results/data.csv", finished.ID), token: alice, body: "{}", status: http.StatusBadRequest, code: CodeBadRequest},
+		{name: "share unfinished", method: http.MethodPost, path: fmt.Sprintf("/runs/%d/share", running.ID), token: alice, status: http.StatusConflict, code: CodeRunConflict},
+		{name: "unknown share", method: http.MethodGet, path: "/share/unknown", status: http.StatusNotFound, code: CodeNotFound},
+		{name: "unknown spec", method: http.MethodGet, path: "/specs/unknown", status: http.StatusNotFound, code: CodeNotFound},
+		{name: "audit log", method: http.MethodGet, path: "/admin/audit", token: alice, status: http.StatusForbidden, code: CodeForbidden},
+		{name: "project id", method: http.MethodGet, path: "/projects/abc", token: alice, status: http.StatusBadRequest, code: CodeBadRequest},
+		{name: "file pattern", method: http.MethodGet, path: "/files", token: alice, status: http.StatusBadRequest, code: CodeBadRequest},
+		{name: "login", method: http.MethodPost, path: "/auth/login", body: `{"email": "nobody@example.org", "password": "x"}`, status: http.StatusUnauthorized, code: CodeUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var request *http.Request
+			if tt.body == "" {
+				request = httptest.NewRequest(tt.method, tt.path, nil)
+			} else {
+				request = httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+				request.Header.Set("Content-Type", "application/json")
+			}
+			if tt.token != "" {
+				request.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			resp := serveOnce(t, s.handler, request)
+			if resp.Code != tt.status {
+				t.Errorf("the request answered %d, want %d: %s", resp.Code, tt.status, resp.Body)
+			}
+			if body := errorBody(t, resp); body.Code != tt.code || body.Message == "" {
+				t.Errorf("the error envelope is %+v, want the code %s and a message", body, tt.code)
+			}
+		})
+	}
+}
+
+func TestErrorStatus(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		code   ErrorCode
+	}{
+		{"validation", &tool.ValidationError{Message: "invalid payload"}, http.StatusBadRequest, CodeValidationFailed},
+		{"not found", fmt.Errorf("run 1: %w", tool.ErrNotFound), http.StatusNotFound, CodeNotFound},
+		{"tool not found", &tool.ToolNotFoundError{Image: "gorun-test:1.0", Tool: "ecoh"}, http.StatusNotFound, CodeNotFound},
+		{"tool not in cache", fmt.Errorf("scan: %w", toolImage.ErrToolNotFound), http.StatusNotFound, CodeNotFound},
+		{"unauthorized", fmt.Errorf("login: %w", tool.ErrUnauthorized), http.StatusUnauthorized, CodeUnauthorized},
+		{"policy", fmt.Errorf("gorun-test:1.0: %w", toolImage.ErrPolicyViolation), http.StatusForbidden, CodePolicyViolation},
+		{"forbidden", fmt.Errorf("run 1: %w", tool.ErrForbidden), http.StatusForbidden, CodeForbidden},
+		{"rate limited", &tool.RateLimitError{Limit: 5, RetryAfter: 12 * time.Second}, http.StatusTooManyRequests, CodeRateLimited},
+		{"run active", fmt.Errorf("run 1: %w", tool.ErrRunActive), http.StatusConflict, CodeRunConflict},
+		{"project not empty", fmt.Errorf("project 1: %w", tool.ErrProjectNotEmpty), http.StatusConflict, CodeRunConflict},
+		{"not trashed", fmt.Errorf("run 1: %w", tool.ErrNotTrashed), http.StatusConflict, CodeRunConflict},
+		{"not startable", fmt.Errorf("run 1: %w", tool.ErrNotStartable), http.StatusConflict, CodeRunConflict},
+		{"expired", fmt.Errorf("run 1: %w", tool.ErrRunExpired), http.StatusConflict, CodeRunExpired},
+		{"not tabular", fmt.Errorf("data.bin: %w", tool.ErrNotTabular), http.StatusUnsupportedMediaType, CodeUnsupportedMediaType},
+		{"too large", fmt.Errorf("data.csv: %w", tool.ErrResultTooLarge), http.StatusRequestEntityTooLarge, CodePayloadTooLarge},
+		{"docker unavailable", client.ErrorConnectionFailed("unix:///var/run/docker.sock"), http.StatusServiceUnavailable, CodeDockerUnavailable},
+		{"other", errors.New("the network was not found"), http.StatusInternalServerError, CodeInternalError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, code := ErrorStatus(tt.err)
+			if status != tt.status || code != tt.code {
+				t.Errorf("ErrorStatus returned %d %s, want %d %s", status, code, tt.status, tt.code)
+			}
+			resp := serveOnce(t, HandlerFunc(func(w http.ResponseWriter, r *http.Request) error { return tt.err }), httptest.NewRequest(http.MethodGet, "/", nil))
+			if body := errorBody(t, resp); resp.Code != tt.status || body.Code != tt.code || body.Message != tt.err.Error() {
+				t.Errorf("the error was answered %d with %+v, want %d %s", resp.Code, body, tt.status, tt.code)
+			}
+		})
+	}
+}
+
+func TestRespondWithErrorDetails(t *testing.T) {
+	t.Run("validation", func(t *testing.T) {
+		resp := httptest.NewRecorder()
+		RespondWithError(resp, &tool.ValidationError{Message: "invalid payload", Errors: []error{errors.New("a"), errors.New("b")}})
+		var body struct {
+			Details []interface{} `json:"details"`
+		}
+		json.Unmarshal(resp.Body.Bytes(), &body)
+		if len(body.Details) != 2 {
+			t.Errorf("the details list %d problems, want 2: %s", len(body.Details), resp.Body)
+		}
+	})
+	t.Run("tool not found", func(t *testing.T) {
+		resp := httptest.NewRecorder()
+		RespondWithError(resp, &tool.ToolNotFoundError{Image: "gorun-test:1.0", Tool: "ecoh", AvailableTools: []string{"echo"}})
+		var body struct {
+			Details tool.ToolNotFoundError `json:"details"`
+		}
+		json.Unmarshal(resp.Body.Bytes(), &body)
+		if !slices.Equal(body.Details.AvailableTools, []string{"echo"}) {
+			t.Errorf("the details do not list the available tools: %s", resp.Body)
+		}
+	})
+	t.Run("rate limited", func(t *testing.T) {
+		resp := httptest.NewRecorder()
+		RespondWithError(resp, &tool.RateLimitError{Limit: 5, RetryAfter: 11500 * time.Millisecond})
+		if got := resp.Header().Get("Retry-After"); got != "12" {
+			t.Errorf("Retry-After is %q, want 12", got)
+		}
+		var body struct {
+			Details map[string]int64 `json:"details"`
+		}
+		json.Unmarshal(resp.Body.Bytes(), &body)
+		if body.Details["runs_per_minute"] != 5 || body.Details["retry_after_seconds"] != 12 {
+			t.Errorf("the details are %v", body.Details)
+		}
+	})
+}
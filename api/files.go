@@ -18,41 +18,48 @@ type FindFilesResponse struct {
 }
 
 // This function copies uploaded files into a temporary directory and returns the supplied file name and the path in a mapping
-func HandleFileUpload(w http.ResponseWriter, r *http.Request) {
+func HandleFileUpload(w http.ResponseWriter, r *http.Request) error {
 	maxUploadSize := viper.GetInt("max_upload_size")
 	tempPath := viper.GetString("temp_path")
 
 	if err := r.ParseMultipartForm(int64(maxUploadSize)); err != nil {
-		RespondWithError(w, 413, fmt.Sprintf("error parsing multipart form: %s", err))
+		return StatusError(413, fmt.Sprintf("error parsing multipart form: %s", err))
 	}
 
 	file, handler, err := r.FormFile("file")
 	if err != nil {
-		RespondWithError(w, 400, fmt.Sprintf("error reading uploaded file: %s", err))
+		return StatusError(400, fmt.Sprintf("error reading uploaded file: %s", err))
 	}
 	defer file.Close()
 
 	tempBaseDir := path.Join(tempPath, "uploads")
 	err = os.MkdirAll(tempBaseDir, 0755)
 	if err != nil {
-		RespondWithError(w, 500, fmt.Sprintf("error creating gorun temporary directory base: %s", err))
+		return StatusError(500, fmt.Sprintf("error creating gorun temporary directory base: %s", err))
 	}
 	tempDir, err := os.MkdirTemp(tempBaseDir, "")
 	if err != nil {
-		RespondWithError(w, 500, fmt.Sprintf("error creating temporary directory: %s", err))
+		return StatusError(500, fmt.Sprintf("error creating temporary directory: %s", err))
 	}
+	// keep the temp janitor away from the upload while it is written
+	defer files.HoldTemp(tempDir)()
+	markerPath := path.Join(tempDir, files.UploadMarker)
+	if err := os.WriteFile(markerPath, nil, 0644); err != nil {
+		return StatusError(500, fmt.Sprintf("error marking the upload: %s", err))
+	}
+	defer os.Remove(markerPath)
 	targetPath := path.Join(tempDir, handler.Filename)
 	openf, err := os.OpenFile(targetPath, os.O_CREATE|os.O_WRONLY, 0644)
 	if err != nil {
-		RespondWithError(w, 500, fmt.Sprintf("error creating target file: %s", err))
+		return StatusError(500, fmt.Sprintf("error creating target file: %s", err))
 	}
 	defer openf.Close()
 	writtenBytes, err := io.Copy(openf, file)
 	if err != nil {
-		RespondWithError(w, 500, fmt.Sprintf("error writing to target file: %s", err))
+		return StatusError(500, fmt.Sprintf("error writing to target file: %s", err))
 	}
 
-	RespondWithJSON(w, http.StatusCreated, map[string]interface{}{
+	return RespondWithJSON(w, http.StatusCreated, map[string]interface{}{
 		"path": targetPath,
 		"size": writtenBytes,
 		"name": handler.Filename,
@@ -60,11 +67,10 @@ func HandleFileUpload(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-func FindFile(w http.ResponseWriter, r *http.Request) {
+func FindFile(w http.ResponseWriter, r *http.Request) error {
 	pattern := r.URL.Query().Get("pattern")
 	if pattern == "" {
-		RespondWithError(w, http.StatusBadRequest, "missing pattern, you need to provide a 'pattern' query parameter")
-		return
+		return StatusError(http.StatusBadRequest, "missing pattern, you need to provide a 'pattern' query parameter")
 	}
 
 	target := r.URL.Query().Get("target")
@@ -79,13 +85,11 @@ func FindFile(w http.ResponseWriter, r *http.Request) {
 	mountPath := viper.GetString("mount_path")
 	matches, err := files.Find(pattern, mountPath, files.Target(target))
 	if err != nil {
-		RespondWithError(w, http.StatusInternalServerError, err.Error())
-		return
+		return StatusError(http.StatusInternalServerError, err.Error())
 	}
 
-	RespondWithJSON(w, http.StatusOK, FindFilesResponse{
+	return RespondWithJSON(w, http.StatusOK, FindFilesResponse{
 		Count: len(matches),
 		Files: matches,
 	})
-
 }
@@ -0,0 +1,158 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/hydrocode-de/gorun/internal/app"
+	"github.com/hydrocode-de/gorun/internal/audit"
+	"github.com/hydrocode-de/gorun/internal/cache"
+	"github.com/hydrocode-de/gorun/internal/db"
+	"github.com/hydrocode-de/gorun/internal/files"
+	gorunsql "github.com/hydrocode-de/gorun/sql"
+	"github.com/spf13/viper"
+)
+
+const (
+	testSecret = "test-secret"
+	testUser   = "alice"
+	otherUser  = "bob"
+	testAdmin  = "admin"
+)
+
+// testServer is the API on a new database, with the users testUser, otherUser and testAdmin
+type testServer struct {
+	*Server
+	conn    *sql.DB
+	handler http.Handler
+}
+
+func newTestServer(t testing.TB) *testServer {
+	t.Helper()
+	dir := t.TempDir()
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+	viper.Set("secret", testSecret)
+	viper.Set("path", dir)
+	viper.Set("mount_path", filepath.Join(dir, "mounts"))
+	viper.Set("temp_path", filepath.Join(dir, "temp"))
+	viper.Set("files.run_dir_template", files.DefaultRunDirTemplate)
+
+	conn, err := gorunsql.CreateDB(filepath.Join(dir, "gorun.db"))
+	if err != nil {
+		t.Fatalf("cannot create the database: %v", err)
+	}
+	// the audit entries of the last requests are written in the background
+	t.Cleanup(func() {
+		audit.Wait()
+		conn.Close()
+	})
+	conn.SetMaxOpenConns(1)
+	DB := db.New(conn)
+	for _, user := range []db.CreateUserParams{
+		{ID: testUser, Email: "alice@example.org", PasswordHash: "x"},
+		{ID: otherUser, Email: "bob@example.org", PasswordHash: "x"},
+		{ID: testAdmin, Email: "admin@example.org", PasswordHash: "x", IsAdmin: true},
+	} {
+		if _, err := DB.CreateUser(context.Background(), user); err != nil {
+			t.Fatalf("cannot create the user %s: %v", user.ID, err)
+		}
+	}
+	specCache := &cache.Cache{}
+	specCache.Reset()
+	application := app.New(DB, specCache)
+	handler, err := CreateServer(application)
+	if err != nil {
+		t.Fatalf("cannot create the server: %v", err)
+	}
+	return &testServer{Server: &Server{App: application}, conn: conn, handler: handler}
+}
+
+// token issues an access token of the user. Without scopes, the token is unrestricted.
+func token(t testing.TB, userID string, scopes ...string) string {
+	t.Helper()
+	claims := jwt.MapClaims{"user_id": userID, "exp": time.Now().Add(time.Hour).Unix()}
+	if scopes != nil {
+		claims["scopes"] = scopes
+	}
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(testSecret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+// do sends the request to the API, with the access token if it is not empty
+func (s *testServer) do(method string, path string, accessToken string, body string, header ...string) *httptest.ResponseRecorder {
+	var request *http.Request
+	if body == "" {
+		request = httptest.NewRequest(method, path, nil)
+	} else {
+		request = httptest.NewRequest(method, path, strings.NewReader(body))
+		request.Header.Set("Content-Type", "application/json")
+	}
+	if accessToken != "" {
+		request.Header.Set("Authorization", "Bearer "+accessToken)
+	}
+	for i := 0; i+1 < len(header); i += 2 {
+		request.Header.Set(header[i], header[i+1])
+	}
+	recorder := httptest.NewRecorder()
+	s.handler.ServeHTTP(recorder, request)
+	return recorder
+}
+
+// createRun adds a run of the user to the database, in the given status
+func (s *testServer) createRun(t *testing.T, userID string, status string) db.Run {
+	t.Helper()
+	run, err := s.DB.CreateRun(context.Background(), db.CreateRunParams{
+		Name:        "echo",
+		Title:       "Echo",
+		DockerImage: "gorun-test:1.0",
+		Parameters:  "{}",
+		Data:        "{}",
+		Mounts:      "{}",
+		Options:     "{}",
+		UserID:      userID,
+	})
+	if err != nil {
+		t.Fatalf("cannot create the run: %v", err)
+	}
+	if _, err := s.conn.Exec("UPDATE runs SET status = ? WHERE id = ?", status, run.ID); err != nil {
+		t.Fatal(err)
+	}
+	run.Status = status
+	return run
+}
+
+// createFinishedRun adds a finished run of the user, whose /out mount holds the result files
+func (s *testServer) createFinishedRun(t *testing.T, userID string, results map[string]string) db.Run {
+	t.Helper()
+	run := s.createRun(t, userID, "finished")
+	outDir := filepath.Join(viper.GetString("mount_path"), fmt.Sprintf("run-%d", run.ID), "out")
+	for name, content := range results {
+		path := filepath.Join(outDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mounts, _ := json.Marshal(map[string]string{"/out": outDir})
+	if _, err := s.conn.Exec("UPDATE runs SET mounts = ? WHERE id = ?", string(mounts), run.ID); err != nil {
+		t.Fatal(err)
+	}
+	run.Mounts = string(mounts)
+	return run
+}
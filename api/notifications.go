@@ -0,0 +1,69 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/hydrocode-de/gorun/internal/db"
+)
+
+// NotificationPreferences tells through which channels a user is notified when a run completed.
+// The Slack webhook and Matrix room replace the ones configured for the server.
+// The notify field of a run overrides them.
+type NotificationPreferences struct {
+	Email           bool   `json:"email"`
+	SlackWebhookURL string `json:"slack_webhook_url,omitempty"`
+	MatrixRoomID    string `json:"matrix_room_id,omitempty"`
+}
+
+func (s *Server) GetNotificationPreferences(w http.ResponseWriter, r *http.Request) error {
+	userID := r.Header.Get("X-User-ID")
+	if userID == "" {
+		return StatusError(http.StatusUnauthorized, "User ID is required")
+	}
+
+	preferences, err := s.DB.GetUserNotifications(r.Context(), userID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return StatusError(http.StatusInternalServerError, err.Error())
+	}
+	return RespondWithJSON(w, http.StatusOK, NotificationPreferences{
+		Email:           preferences.Email,
+		SlackWebhookURL: preferences.SlackWebhookUrl,
+		MatrixRoomID:    preferences.MatrixRoomID,
+	})
+}
+
+func (s *Server) SetNotificationPreferences(w http.ResponseWriter, r *http.Request) error {
+	userID := r.Header.Get("X-User-ID")
+	if userID == "" {
+		return StatusError(http.StatusUnauthorized, "User ID is required")
+	}
+
+	var payload NotificationPreferences
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		return StatusError(http.StatusBadRequest, err.Error())
+	}
+	if payload.SlackWebhookURL != "" {
+		if webhook, err := url.Parse(payload.SlackWebhookURL); err != nil || webhook.Scheme != "https" || webhook.Host == "" {
+			return StatusError(http.StatusBadRequest, fmt.Sprintf("invalid slack_webhook_url %s. It has to be an https URL", payload.SlackWebhookURL))
+		}
+	}
+	if payload.MatrixRoomID != "" && !strings.HasPrefix(payload.MatrixRoomID, "!") && !strings.HasPrefix(payload.MatrixRoomID, "#") {
+		return StatusError(http.StatusBadRequest, fmt.Sprintf("invalid matrix_room_id %s. Use a room ID like !abc:example.org or an alias like #room:example.org", payload.MatrixRoomID))
+	}
+	err := s.DB.SetUserNotifications(r.Context(), db.SetUserNotificationsParams{
+		UserID:          userID,
+		Email:           payload.Email,
+		SlackWebhookUrl: payload.SlackWebhookURL,
+		MatrixRoomID:    payload.MatrixRoomID,
+	})
+	if err != nil {
+		return StatusError(http.StatusInternalServerError, err.Error())
+	}
+	return RespondWithJSON(w, http.StatusOK, payload)
+}
@@ -0,0 +1,173 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/hydrocode-de/gorun/internal/audit"
+	"github.com/hydrocode-de/gorun/internal/tool"
+)
+
+type ProjectsResponse struct {
+	Count    int            `json:"count"`
+	Projects []tool.Project `json:"projects"`
+}
+
+type ProjectPayload struct {
+	Name        *string `json:"name"`
+	Description *string `json:"description"`
+}
+
+// ProjectMemberPayload names the user by ID or email
+type ProjectMemberPayload struct {
+	UserID string `json:"user_id"`
+	Email  string `json:"email"`
+}
+
+func projectID(r *http.Request) (int64, error) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("the passed project id is not a valid integer: %v", err)
+	}
+	return id, nil
+}
+
+// ListProjects lists the projects of the user. Admins list the projects of all users with ?all=true.
+func (s *Server) ListProjects(w http.ResponseWriter, r *http.Request) error {
+	userID := r.Header.Get("X-User-ID")
+	if userID == "" {
+		return StatusError(http.StatusUnauthorized, "User ID is required")
+	}
+	all := false
+	if raw := r.URL.Query().Get("all"); raw != "" {
+		parsed, err := strconv.ParseBool(raw)
+		if err != nil {
+			return StatusError(http.StatusBadRequest, "all must be a boolean")
+		}
+		all = parsed
+	}
+
+	projects, err := tool.ListProjects(r.Context(), s.DB, userID, all)
+	if err != nil {
+		return err
+	}
+	return RespondWithJSON(w, http.StatusOK, ProjectsResponse{Count: len(projects), Projects: projects})
+}
+
+func (s *Server) CreateProject(w http.ResponseWriter, r *http.Request) error {
+	userID := r.Header.Get("X-User-ID")
+	if userID == "" {
+		return StatusError(http.StatusUnauthorized, "User ID is required")
+	}
+	var payload ProjectPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		return StatusError(http.StatusBadRequest, err.Error())
+	}
+	if payload.Name == nil {
+		return StatusError(http.StatusBadRequest, "the name of the project is required")
+	}
+	description := ""
+	if payload.Description != nil {
+		description = *payload.Description
+	}
+
+	project, err := tool.CreateProject(r.Context(), s.DB, *payload.Name, description, userID)
+	if err != nil {
+		return err
+	}
+	s.recordAudit(r, userID, audit.ActionProjectCreate, fmt.Sprintf("project:%d", project.ID))
+	return RespondWithJSON(w, http.StatusCreated, project)
+}
+
+func (s *Server) GetProject(w http.ResponseWriter, r *http.Request) error {
+	id, err := projectID(r)
+	if err != nil {
+		return StatusError(http.StatusBadRequest, err.Error())
+	}
+	project, err := tool.GetProject(r.Context(), s.DB, id, r.Header.Get("X-User-ID"))
+	if err != nil {
+		return err
+	}
+	return RespondWithJSON(w, http.StatusOK, project)
+}
+
+func (s *Server) UpdateProject(w http.ResponseWriter, r *http.Request) error {
+	id, err := projectID(r)
+	if err != nil {
+		return StatusError(http.StatusBadRequest, err.Error())
+	}
+	var payload ProjectPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		return StatusError(http.StatusBadRequest, err.Error())
+	}
+
+	userID := r.Header.Get("X-User-ID")
+	project, err := tool.UpdateProject(r.Context(), s.DB, id, payload.Name, payload.Description, userID)
+	if err != nil {
+		return err
+	}
+	s.recordAudit(r, userID, audit.ActionProjectUpdate, fmt.Sprintf("project:%d", project.ID))
+	return RespondWithJSON(w, http.StatusOK, project)
+}
+
+// DeleteProject deletes a project without runs, personal projects cannot be deleted
+func (s *Server) DeleteProject(w http.ResponseWriter, r *http.Request) error {
+	id, err := projectID(r)
+	if err != nil {
+		return StatusError(http.StatusBadRequest, err.Error())
+	}
+	userID := r.Header.Get("X-User-ID")
+	if err := tool.DeleteProject(r.Context(), s.DB, id, userID); err != nil {
+		return err
+	}
+	s.recordAudit(r, userID, audit.ActionProjectDelete, fmt.Sprintf("project:%d", id))
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func (s *Server) AddProjectMember(w http.ResponseWriter, r *http.Request) error {
+	id, err := projectID(r)
+	if err != nil {
+		return StatusError(http.StatusBadRequest, err.Error())
+	}
+	var payload ProjectMemberPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		return StatusError(http.StatusBadRequest, err.Error())
+	}
+	memberID := payload.UserID
+	if memberID == "" {
+		if payload.Email == "" {
+			return StatusError(http.StatusBadRequest, "the user_id or email of the member is required")
+		}
+		user, err := s.DB.GetUserByEmail(r.Context(), payload.Email)
+		if err != nil {
+			return StatusError(http.StatusNotFound, fmt.Sprintf("the user %s was not found", payload.Email))
+		}
+		memberID = user.ID
+	}
+
+	userID := r.Header.Get("X-User-ID")
+	project, err := tool.AddProjectMember(r.Context(), s.DB, id, memberID, userID)
+	if err != nil {
+		return err
+	}
+	s.recordAudit(r, userID, audit.ActionProjectMemberAdd, fmt.Sprintf("project:%d/user:%s", id, memberID))
+	return RespondWithJSON(w, http.StatusOK, project)
+}
+
+func (s *Server) RemoveProjectMember(w http.ResponseWriter, r *http.Request) error {
+	id, err := projectID(r)
+	if err != nil {
+		return StatusError(http.StatusBadRequest, err.Error())
+	}
+	memberID := r.PathValue("user")
+	userID := r.Header.Get("X-User-ID")
+	project, err := tool.RemoveProjectMember(r.Context(), s.DB, id, memberID, userID)
+	if err != nil {
+		return err
+	}
+	s.recordAudit(r, userID, audit.ActionProjectMemberDrop, fmt.Sprintf("project:%d/user:%s", id, memberID))
+	return RespondWithJSON(w, http.StatusOK, project)
+}
@@ -0,0 +1,201 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/hydrocode-de/gorun/internal/files"
+	"github.com/hydrocode-de/gorun/internal/tool"
+)
+
+type UsageReportResponse struct {
+	From    time.Time         `json:"from"`
+	To      time.Time         `json:"to"`
+	GroupBy string            `json:"group_by"`
+	Groups  []tool.UsageGroup `json:"groups"`
+}
+
+// GetUsageReport aggregates the resource usage of the runs started within the window.
+// Admins see the runs of all users, everyone else only their own runs.
+func (s *Server) GetUsageReport(w http.ResponseWriter, r *http.Request) error {
+	userID := r.Header.Get("X-User-ID")
+	if userID == "" {
+		return StatusError(http.StatusUnauthorized, "User ID is required")
+	}
+	user, err := s.DB.GetUserByID(r.Context(), userID)
+	if err != nil {
+		return StatusError(http.StatusUnauthorized, "unknown user")
+	}
+
+	query := r.URL.Query()
+	from, to, err := tool.ParseUsageWindow(query.Get("from"), query.Get("to"))
+	if err != nil {
+		return StatusError(http.StatusBadRequest, err.Error())
+	}
+	groupBy := query.Get("group_by")
+	if groupBy == "" {
+		groupBy = "user"
+	}
+	if groupBy != "user" && groupBy != "tool" && groupBy != "project" {
+		return StatusError(http.StatusBadRequest, fmt.Sprintf("invalid group_by %s. Use 'user', 'tool' or 'project'", groupBy))
+	}
+
+	filterUser := userID
+	if user.IsAdmin {
+		filterUser = ""
+	}
+	groups, err := tool.UsageReport(r.Context(), s.DB, from, to, groupBy, filterUser)
+	if err != nil {
+		return err
+	}
+
+	if strings.Contains(r.Header.Get("Accept"), "text/csv") {
+		w.Header().Set("Content-Type", "text/csv")
+		w.WriteHeader(http.StatusOK)
+		if err := tool.WriteUsageCSV(w, groups); err != nil {
+			requestLogger(r).Printf("failed to write the usage report: %v", err)
+		}
+		return nil
+	}
+	return RespondWithJSON(w, http.StatusOK, UsageReportResponse{
+		From:    from,
+		To:      to,
+		GroupBy: groupBy,
+		Groups:  groups,
+	})
+}
+
+type ToolUsageResponse struct {
+	Count int              `json:"count"`
+	Tools []tool.ToolUsage `json:"tools"`
+}
+
+// GetToolUsage summarizes the runs of a tool from the daily rollup
+func (s *Server) GetToolUsage(w http.ResponseWriter, r *http.Request) error {
+	toolName := r.PathValue("toolname")
+	if _, ok := s.Cache.GetToolSpec(toolName); !ok {
+		return StatusError(http.StatusNotFound, "tool not found")
+	}
+	usage, err := tool.GetToolUsage(r.Context(), s.DB, toolName)
+	if err != nil {
+		return err
+	}
+	return RespondWithJSON(w, http.StatusOK, usage)
+}
+
+// ListToolUsage ranks all tools by their usage. ?refresh=true recomputes the rollup first.
+func (s *Server) ListToolUsage(w http.ResponseWriter, r *http.Request) error {
+	user, err := s.DB.GetUserByID(r.Context(), r.Header.Get("X-User-ID"))
+	if err != nil || !user.IsAdmin {
+		return StatusError(http.StatusForbidden, "only admins may read the usage of all tools")
+	}
+	if r.URL.Query().Get("refresh") == "true" {
+		if err := tool.RefreshToolUsage(r.Context(), s.DB); err != nil {
+			return err
+		}
+	}
+	usage, err := tool.ListToolUsage(r.Context(), s.DB)
+	if err != nil {
+		return err
+	}
+	return RespondWithJSON(w, http.StatusOK, ToolUsageResponse{Count: len(usage), Tools: usage})
+}
+
+type ErrorSummaryResponse struct {
+	From   time.Time         `json:"from"`
+	To     time.Time         `json:"to"`
+	Total  int64             `json:"total"`
+	Groups []tool.ErrorGroup `json:"groups"`
+}
+
+// GetErrorSummary groups the runs which errored within the window, by default the last
+// 24 hours, by their error kind and normalized message
+func (s *Server) GetErrorSummary(w http.ResponseWriter, r *http.Request) error {
+	user, err := s.DB.GetUserByID(r.Context(), r.Header.Get("X-User-ID"))
+	if err != nil || !user.IsAdmin {
+		return StatusError(http.StatusForbidden, "only admins may read the errors of all runs")
+	}
+	query := r.URL.Query()
+	from, to, err := tool.ParseErrorWindow(query.Get("from"), query.Get("to"))
+	if err != nil {
+		return StatusError(http.StatusBadRequest, err.Error())
+	}
+	groups, err := tool.ErrorSummary(r.Context(), s.DB, from, to)
+	if err != nil {
+		return err
+	}
+	var total int64
+	for _, group := range groups {
+		total += group.Count
+	}
+	return RespondWithJSON(w, http.StatusOK, ErrorSummaryResponse{From: from, To: to, Total: total, Groups: groups})
+}
+
+// GetMetrics exposes the errored runs of the last 15 minutes by kind, the expired runs and
+// the reaped containers in the text format of Prometheus
+func (s *Server) GetMetrics(w http.ResponseWriter, r *http.Request) error {
+	user, err := s.DB.GetUserByID(r.Context(), r.Header.Get("X-User-ID"))
+	if err != nil || !user.IsAdmin {
+		return StatusError(http.StatusForbidden, "only admins may read the metrics")
+	}
+	counts, err := tool.RecentErrorCounts(r.Context(), s.DB, 15*time.Minute)
+	if err != nil {
+		return err
+	}
+	expired, err := s.DB.CountExpiredRuns(r.Context())
+	if err != nil {
+		return err
+	}
+	// every kind is reported, so that a kind without errors reads 0 instead of vanishing
+	kinds := []tool.ErrorKind{tool.ErrorToolFailure, tool.ErrorInfrastructure, tool.ErrorTimeout, tool.ErrorCancelled, tool.ErrorValidation}
+	for kind := range counts {
+		if !slices.Contains(kinds, kind) {
+			kinds = append(kinds, kind)
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintln(w, "# HELP gorun_errored_runs_recent Runs which errored in the last 15 minutes by error kind.")
+	fmt.Fprintln(w, "# TYPE gorun_errored_runs_recent gauge")
+	for _, kind := range kinds {
+		label := string(kind)
+		if label == "" {
+			label = "unknown"
+		}
+		fmt.Fprintf(w, "gorun_errored_runs_recent{kind=%q} %d\n", label, counts[kind])
+	}
+	fmt.Fprintln(w, "# HELP gorun_expired_runs Runs which expired before they were started and are not in the trash.")
+	fmt.Fprintln(w, "# TYPE gorun_expired_runs gauge")
+	fmt.Fprintf(w, "gorun_expired_runs %d\n", expired)
+	fmt.Fprintln(w, "# HELP gorun_reaped_containers_total Stale containers gorun removed since the server started.")
+	fmt.Fprintln(w, "# TYPE gorun_reaped_containers_total counter")
+	fmt.Fprintf(w, "gorun_reaped_containers_total %d\n", tool.ReapedContainers())
+	fmt.Fprintln(w, "# HELP gorun_log_truncations_total Run logs truncated to run.max_log_bytes since the server started.")
+	fmt.Fprintln(w, "# TYPE gorun_log_truncations_total counter")
+	fmt.Fprintf(w, "gorun_log_truncations_total %d\n", tool.TruncatedLogCount())
+	fmt.Fprintln(w, "# HELP gorun_rate_limited_runs_total Run creations refused by the rate limit since the server started.")
+	fmt.Fprintln(w, "# TYPE gorun_rate_limited_runs_total counter")
+	fmt.Fprintf(w, "gorun_rate_limited_runs_total %d\n", tool.RateLimitedRuns())
+	buckets := tool.RunBuckets(time.Now())
+	fmt.Fprintln(w, "# HELP gorun_rate_limit_tokens Runs each user may create right now before the rate limit applies.")
+	fmt.Fprintln(w, "# TYPE gorun_rate_limit_tokens gauge")
+	for _, bucket := range buckets {
+		fmt.Fprintf(w, "gorun_rate_limit_tokens{user_id=%q} %g\n", bucket.UserID, bucket.Tokens)
+	}
+	fmt.Fprintln(w, "# HELP gorun_rate_limit_runs_per_minute The size of the token bucket of each user.")
+	fmt.Fprintln(w, "# TYPE gorun_rate_limit_runs_per_minute gauge")
+	for _, bucket := range buckets {
+		fmt.Fprintf(w, "gorun_rate_limit_runs_per_minute{user_id=%q} %d\n", bucket.UserID, bucket.Limit)
+	}
+	fmt.Fprintln(w, "# HELP gorun_temp_removed_entries_total Stale temporary entries gorun removed since the server started.")
+	fmt.Fprintln(w, "# TYPE gorun_temp_removed_entries_total counter")
+	fmt.Fprintf(w, "gorun_temp_removed_entries_total %d\n", files.RemovedTempEntries())
+	fmt.Fprintln(w, "# HELP gorun_temp_removed_bytes_total Size of the stale temporary entries gorun removed since the server started.")
+	fmt.Fprintln(w, "# TYPE gorun_temp_removed_bytes_total counter")
+	fmt.Fprintf(w, "gorun_temp_removed_bytes_total %d\n", files.RemovedTempBytes())
+	return nil
+}
@@ -0,0 +1,89 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// the usage report of a user covers their own runs, an admin sees the runs of all users
+func TestGetUsageReport(t *testing.T) {
+	s := newTestServer(t)
+	for _, userID := range []string{testUser, testUser, otherUser} {
+		run := s.createRun(t, userID, "finished")
+		if _, err := s.conn.Exec("UPDATE runs SET started_at = '2026-01-10 08:00:00', duration_ms = 60000 WHERE id = ?", run.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	const window = "/reports/usage?from=2026-01-01&to=2026-02-01"
+
+	groups := func(userID string, query string) []string {
+		t.Helper()
+		resp := s.do(http.MethodGet, window+query, token(t, userID), "")
+		if resp.Code != http.StatusOK {
+			t.Fatalf("the report of %s answered %d: %s", userID, resp.Code, resp.Body)
+		}
+		var report UsageReportResponse
+		if err := json.Unmarshal(resp.Body.Bytes(), &report); err != nil {
+			t.Fatal(err)
+		}
+		keys := make([]string, 0, len(report.Groups))
+		for _, group := range report.Groups {
+			keys = append(keys, group.Group)
+		}
+		return keys
+	}
+	if got := groups(testUser, ""); len(got) != 1 || got[0] != testUser {
+		t.Errorf("the user sees the groups %v, want only their own", got)
+	}
+	if got := groups(testAdmin, ""); len(got) != 2 {
+		t.Errorf("the admin sees the groups %v, want both users", got)
+	}
+	if got := groups(testAdmin, "&group_by=tool"); len(got) != 1 || got[0] != "gorun-test:1.0::echo" {
+		t.Errorf("the admin sees the tools %v", got)
+	}
+
+	resp := s.do(http.MethodGet, window, token(t, testUser), "", "Accept", "text/csv")
+	if resp.Code != http.StatusOK || resp.Header().Get("Content-Type") != "text/csv" {
+		t.Fatalf("the CSV report answered %d with %s", resp.Code, resp.Header().Get("Content-Type"))
+	}
+	want := "group,runs,duration_seconds,cpu_seconds,peak_memory_gb_hours\n" + testUser + ",2,120.000,0.000,0.000000\n"
+	if resp.Body.String() != want {
+		t.Errorf("the CSV report is\n%s\nwant\n%s", resp.Body, want)
+	}
+
+	for _, path := range []string{window + "&group_by=image", "/reports/usage?from=2026-02-01&to=2026-01-01"} {
+		if resp := s.do(http.MethodGet, path, token(t, testUser), ""); resp.Code != http.StatusBadRequest {
+			t.Errorf("the report %s answered %d, want 400", path, resp.Code)
+		}
+	}
+}
+
+func TestGetMetrics(t *testing.T) {
+	s := newTestServer(t)
+	if got := s.do(http.MethodGet, "/metrics", token(t, testUser), ""); got.Code != http.StatusForbidden {
+		t.Errorf("a user read the metrics with %d, want %d", got.Code, http.StatusForbidden)
+	}
+
+	got := s.do(http.MethodGet, "/metrics", token(t, testAdmin), "")
+	if got.Code != http.StatusOK {
+		t.Fatalf("the metrics returned %d: %s", got.Code, got.Body)
+	}
+	// the counters are reported from the start, so that a counter without events reads 0
+	for _, metric := range []string{
+		`gorun_errored_runs_recent{kind="tool_failure"} `,
+		"gorun_expired_runs ",
+		"gorun_reaped_containers_total ",
+		"gorun_log_truncations_total ",
+		"gorun_rate_limited_runs_total ",
+		"# TYPE gorun_rate_limit_tokens gauge",
+		"# TYPE gorun_rate_limit_runs_per_minute gauge",
+		"gorun_temp_removed_entries_total ",
+		"gorun_temp_removed_bytes_total ",
+	} {
+		if !strings.Contains(got.Body.String(), metric) {
+			t.Errorf("the metrics miss %q:\n%s", metric, got.Body)
+		}
+	}
+}
@@ -2,11 +2,18 @@ package api
 
 import (
 	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"mime"
 	"net/http"
 	"net/url"
+	"path"
+	"strconv"
 	"strings"
+	"unicode"
 
+	"github.com/hydrocode-de/gorun/internal/audit"
 	"github.com/hydrocode-de/gorun/internal/files"
 	"github.com/hydrocode-de/gorun/internal/tool"
 )
@@ -22,6 +29,7 @@ type PreviewResultResponse struct {
 	Encoding  string `json:"encoding"`
 	Truncated bool   `json:"truncated"`
 	Content   string `json:"content"`
+	Kind      string `json:"kind,omitempty"`
 }
 
 func resultPathFromRequest(r *http.Request) (string, error) {
@@ -37,59 +45,201 @@ func resultPathFromRequest(r *http.Request) (string, error) {
 	return strings.TrimPrefix(decoded, "/"), nil
 }
 
-func ListRunResults(w http.ResponseWriter, r *http.Request, tool tool.Tool) {
-	results, err := tool.ListResults()
+func (s *Server) ListRunResults(w http.ResponseWriter, r *http.Request, run tool.Tool) error {
+	flat := false
+	if value := r.URL.Query().Get("flat"); value != "" {
+		var err error
+		if flat, err = strconv.ParseBool(value); err != nil {
+			return StatusError(http.StatusBadRequest, fmt.Sprintf("invalid flat value %s. Use true or false", value))
+		}
+	}
+	results, err := run.DescribeResults(r.Context(), s.DB, flat)
 	if err != nil {
-		RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return StatusError(http.StatusInternalServerError, err.Error())
+	}
+
+	truncated := tool.TruncatedLogs(r.Context(), s.DB, run.ID)
+	for i := range results {
+		results[i].Truncated = truncated[results[i].RelPath]
 	}
 
-	RespondWithJSON(w, http.StatusOK, ListRunResultsResponse{
+	return RespondWithJSON(w, http.StatusOK, ListRunResultsResponse{
 		Count: len(results),
 		Files: results,
 	})
 }
 
-func GetResultFile(w http.ResponseWriter, r *http.Request, tool tool.Tool) {
+// wantsInline reads ?inline=true|false. Without it, files are shown inline if the
+// Accept header explicitly asks for their type, like a browser opening an HTML report.
+func wantsInline(r *http.Request, mimeType string) (bool, error) {
+	if value := r.URL.Query().Get("inline"); value != "" {
+		inline, err := strconv.ParseBool(value)
+		if err != nil {
+			return false, fmt.Errorf("invalid inline value %s. Use true or false", value)
+		}
+		return inline, nil
+	}
+
+	mediaType, _, err := mime.ParseMediaType(mimeType)
+	if err != nil {
+		return false, nil
+	}
+	for _, accepted := range strings.Split(r.Header.Get("Accept"), ",") {
+		acceptedType, _, err := mime.ParseMediaType(strings.TrimSpace(accepted))
+		if err == nil && acceptedType == mediaType {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// contentDisposition formats the header with the filename stripped of control characters.
+// Quotes and non-ASCII characters are encoded following RFC 2231.
+func contentDisposition(disposition string, filename string) string {
+	cleaned := strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || r == '/' || r == '\\' {
+			return -1
+		}
+		return r
+	}, filename)
+	if cleaned == "" {
+		cleaned = "download"
+	}
+	return mime.FormatMediaType(disposition, map[string]string{"filename": cleaned})
+}
+
+func (s *Server) GetResultFile(w http.ResponseWriter, r *http.Request, run tool.Tool) error {
 	filename, err := resultPathFromRequest(r)
 	if err != nil {
-		RespondWithError(w, http.StatusBadRequest, err.Error())
-		return
+		return StatusError(http.StatusBadRequest, err.Error())
 	}
 
 	var payload bytes.Buffer
-	info, err := tool.WriteResultFile(filename, &payload)
+	info, err := run.WriteResultFile(filename, &payload)
+	if errors.Is(err, tool.ErrNotFound) {
+		return s.redirectToStoredResult(w, r, run, filename, err)
+	}
+	if err != nil {
+		return err
+	}
+
+	inline, err := wantsInline(r, info.MimeType)
 	if err != nil {
-		RespondWithError(w, http.StatusInternalServerError, err.Error())
-		return
+		return StatusError(http.StatusBadRequest, err.Error())
+	}
+	disposition := "attachment"
+	if inline {
+		disposition = "inline"
+		// inline results, like HTML reports, must not run scripts with the origin of the API
+		w.Header().Set("Content-Security-Policy", "sandbox")
 	}
 
 	w.Header().Set("Content-Type", info.MimeType)
-	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s", info.Filename))
+	w.Header().Set("Content-Disposition", contentDisposition(disposition, info.Filename))
+	w.Header().Set("Content-Length", strconv.Itoa(payload.Len()))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
 	_, _ = w.Write(payload.Bytes())
+	s.recordAudit(r, r.Header.Get("X-User-ID"), audit.ActionResultDownload, fmt.Sprintf("run:%d/%s", run.ID, filename))
+	return nil
+}
+
+// redirectToStoredResult sends the client to a presigned URL of a result whose local copy was
+// removed after its upload to the object storage, so that large files are not proxied.
+// Results which were never uploaded are answered with notFoundErr.
+func (s *Server) redirectToStoredResult(w http.ResponseWriter, r *http.Request, run tool.Tool, filename string, notFoundErr error) error {
+	record, err := run.StoredResult(r.Context(), s.DB, filename)
+	if errors.Is(err, tool.ErrNotFound) {
+		err = notFoundErr
+	}
+	if err != nil {
+		return err
+	}
+
+	inline, err := wantsInline(r, record.MimeType)
+	if err != nil {
+		return StatusError(http.StatusBadRequest, err.Error())
+	}
+	// inline results are served from the origin of the object storage, not the one of the API
+	disposition := "attachment"
+	if inline {
+		disposition = "inline"
+	}
+	location, err := tool.PresignResult(record, contentDisposition(disposition, path.Base(record.RelPath)))
+	if err != nil {
+		return err
+	}
+	http.Redirect(w, r, location, http.StatusFound)
+	s.recordAudit(r, r.Header.Get("X-User-ID"), audit.ActionResultDownload, fmt.Sprintf("run:%d/%s", run.ID, filename))
+	return nil
+}
+
+// AnnotateResultPayload marks a result as primary or labels it, fields which are not set are kept
+type AnnotateResultPayload struct {
+	Primary *bool   `json:"primary"`
+	Label   *string `json:"label"`
+}
+
+// AnnotateResultFile stores the annotation of a result by the user, which the tool cannot replace
+func (s *Server) AnnotateResultFile(w http.ResponseWriter, r *http.Request, run tool.Tool) error {
+	filename, err := resultPathFromRequest(r)
+	if err != nil {
+		return StatusError(http.StatusBadRequest, err.Error())
+	}
+
+	var payload AnnotateResultPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		return StatusError(http.StatusBadRequest, fmt.Sprintf("invalid annotation: %v", err))
+	}
+	if payload.Primary == nil && payload.Label == nil {
+		return StatusError(http.StatusBadRequest, "the annotation needs primary or label")
+	}
+
+	annotation, err := run.AnnotateResult(r.Context(), s.DB, filename, payload.Primary, payload.Label)
+	if err != nil {
+		return err
+	}
+	s.recordAudit(r, r.Header.Get("X-User-ID"), audit.ActionResultAnnotate, fmt.Sprintf("run:%d/%s", run.ID, annotation.File))
+	return RespondWithJSON(w, http.StatusOK, annotation)
+}
+
+func QueryResultFile(w http.ResponseWriter, r *http.Request, run tool.Tool) error {
+	filename, err := resultPathFromRequest(r)
+	if err != nil {
+		return StatusError(http.StatusBadRequest, err.Error())
+	}
+
+	var query tool.TableQuery
+	if err := json.NewDecoder(r.Body).Decode(&query); err != nil {
+		return StatusError(http.StatusBadRequest, fmt.Sprintf("invalid query: %v", err))
+	}
+
+	result, err := run.QueryResultFile(filename, query)
+	if err != nil {
+		return err
+	}
+	return RespondWithJSON(w, http.StatusOK, result)
 }
 
-func PreviewResultFile(w http.ResponseWriter, r *http.Request, tool tool.Tool) {
+func PreviewResultFile(w http.ResponseWriter, r *http.Request, run tool.Tool) error {
 	filename, err := resultPathFromRequest(r)
 	if err != nil {
-		RespondWithError(w, http.StatusBadRequest, err.Error())
-		return
+		return StatusError(http.StatusBadRequest, err.Error())
 	}
 
-	preview, err := tool.PreviewResultFile(filename)
+	preview, err := run.PreviewResultFile(filename)
 	if err != nil {
-		if strings.Contains(err.Error(), "preview is not available") {
-			RespondWithError(w, http.StatusUnsupportedMediaType, err.Error())
-			return
+		if errors.Is(err, tool.ErrPreviewUnavailable) {
+			return StatusError(http.StatusUnsupportedMediaType, err.Error())
 		}
-		RespondWithError(w, http.StatusInternalServerError, err.Error())
-		return
+		return err
 	}
 
-	RespondWithJSON(w, http.StatusOK, PreviewResultResponse{
+	return RespondWithJSON(w, http.StatusOK, PreviewResultResponse{
 		Filename:  preview.Filename,
 		MimeType:  preview.MimeType,
 		Encoding:  preview.Encoding,
 		Truncated: preview.Truncated,
 		Content:   preview.Content,
+		Kind:      preview.Kind,
 	})
 }
@@ -0,0 +1,205 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestContentDisposition(t *testing.T) {
+	for filename, want := range map[string]string{
+		"report.csv":                        "report.csv",
+		`quoted "name".csv`:                 `quoted "name".csv`,
+		"line\r\nSet-Cookie: session=1.csv": "lineSet-Cookie: session=1.csv",
+		"nested/../name.csv":                "nested..name.csv",
+		"\n":                                "download",
+		"résumé.pdf":                        "résumé.pdf",
+	} {
+		header := contentDisposition("attachment", filename)
+		if strings.ContainsAny(header, "\r\n") {
+			t.Errorf("the header of %q breaks the line: %q", filename, header)
+		}
+		disposition, params, err := mime.ParseMediaType(header)
+		if err != nil {
+			t.Errorf("the header of %q cannot be parsed: %q, %v", filename, header, err)
+			continue
+		}
+		if disposition != "attachment" || params["filename"] != want {
+			t.Errorf("the header of %q names %s %q, want attachment %q", filename, disposition, params["filename"], want)
+		}
+	}
+}
+
+func TestGetResultFileWithCraftedName(t *testing.T) {
+	s := newTestServer(t)
+	name := "re\"port\nSet-Cookie: session=1.csv"
+	run := s.createFinishedRun(t, testUser, map[string]string{name: "a,b\n"})
+
+	resp := s.do(http.MethodGet, fmt.Sprintf("/runs/%d/results/%s", run.ID, url.PathEscape(name)), token(t, testUser), "")
+	if resp.Code != http.StatusOK {
+		t.Fatalf("the download answered %d: %s", resp.Code, resp.Body)
+	}
+	if cookie := resp.Header().Get("Set-Cookie"); cookie != "" {
+		t.Errorf("the filename injected the header Set-Cookie: %s", cookie)
+	}
+	_, params, err := mime.ParseMediaType(resp.Header().Get("Content-Disposition"))
+	if err != nil || params["filename"] != "re\"portSet-Cookie: session=1.csv" {
+		t.Errorf("the Content-Disposition %q names %q, %v", resp.Header().Get("Content-Disposition"), params["filename"], err)
+	}
+	if length := resp.Header().Get("Content-Length"); length != "4" {
+		t.Errorf("the Content-Length is %q, want 4", length)
+	}
+}
+
+func TestGetResultFileInline(t *testing.T) {
+	s := newTestServer(t)
+	run := s.createFinishedRun(t, testUser, map[string]string{
+		"report.html": "<html><body><script>alert(1)</script></body></html>",
+		"noextension": "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR",
+	})
+	path := fmt.Sprintf("/runs/%d/results/", run.ID)
+
+	tests := []struct {
+		name        string
+		file        string
+		query       string
+		header      []string
+		disposition string
+		contentType string
+	}{
+		{name: "attachment by default", file: "report.html", disposition: "attachment", contentType: "text/html; charset=utf-8"},
+		{name: "inline by query", file: "report.html", query: "?inline=true", disposition: "inline", contentType: "text/html; charset=utf-8"},
+		{name: "inline by accept", file: "report.html", header: []string{"Accept", "text/html,application/xhtml+xml"}, disposition: "inline", contentType: "text/html; charset=utf-8"},
+		{name: "attachment despite accept", file: "report.html", query: "?inline=false", header: []string{"Accept", "text/html"}, disposition: "attachment", contentType: "text/html; charset=utf-8"},
+		{name: "sniffed without extension", file: "noextension", disposition: "attachment", contentType: "image/png"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := s.do(http.MethodGet, path+tt.file+tt.query, token(t, testUser), "", tt.header...)
+			if resp.Code != http.StatusOK {
+				t.Fatalf("the download answered %d: %s", resp.Code, resp.Body)
+			}
+			if disposition, _, _ := mime.ParseMediaType(resp.Header().Get("Content-Disposition")); disposition != tt.disposition {
+				t.Errorf("the file is served as %s, want %s", disposition, tt.disposition)
+			}
+			if contentType := resp.Header().Get("Content-Type"); contentType != tt.contentType {
+				t.Errorf("the Content-Type is %q, want %q", contentType, tt.contentType)
+			}
+			if tt.disposition == "inline" && resp.Header().Get("Content-Security-Policy") != "sandbox" {
+				t.Errorf("the inline file is not sandboxed: %q", resp.Header().Get("Content-Security-Policy"))
+			}
+			if sniff := resp.Header().Get("X-Content-Type-Options"); sniff != "nosniff" {
+				t.Errorf("the X-Content-Type-Options is %q, want nosniff", sniff)
+			}
+		})
+	}
+}
+
+func TestGetResultFileInvalidInline(t *testing.T) {
+	s := newTestServer(t)
+	run := s.createFinishedRun(t, testUser, map[string]string{"report.html": "<html></html>"})
+	if resp := s.do(http.MethodGet, fmt.Sprintf("/runs/%d/results/report.html?inline=maybe", run.ID), token(t, testUser), ""); resp.Code != http.StatusBadRequest {
+		t.Errorf("an invalid inline value answered %d, want %d", resp.Code, http.StatusBadRequest)
+	}
+}
+
+// listedResult is a file of the results listing, with the members of a grouped entry
+type listedResult struct {
+	RelPath  string         `json:"relPath"`
+	Format   string         `json:"format"`
+	MimeType string         `json:"mimeType"`
+	Size     int64          `json:"size"`
+	Members  []listedResult `json:"members"`
+}
+
+// the listing reports the format of each result and groups the files of a Zarr store and
+// of a shapefile, the downloads are served with the detected type
+func TestResultFormats(t *testing.T) {
+	s := newTestServer(t)
+	run := s.createFinishedRun(t, testUser, map[string]string{
+		"model.out":             "CDF\x01" + strings.Repeat("\x00", 28),
+		"table.parquet":         "PAR1\x00\x00\x00\x00PAR1",
+		"roads.shp":             "\x00\x00\x27\x0a" + strings.Repeat("\x00", 96),
+		"roads.shx":             "\x00\x00\x27\x0a" + strings.Repeat("\x00", 96),
+		"roads.dbf":             "\x03\x7e\x01\x01",
+		"grid.zarr/.zgroup":     `{"zarr_format": 2}`,
+		"grid.zarr/t/.zarray":   `{"zarr_format": 2}`,
+		"grid.zarr/t/0":         "\x00\x00\x48\x41",
+		"forecast/latest.grib2": "GRIB\x00\x00\x00\x02\x00\x00\x00\x00\x00\x00\x00\x147777",
+	})
+	list := func(query string) map[string]listedResult {
+		t.Helper()
+		resp := s.do(http.MethodGet, fmt.Sprintf("/runs/%d/results%s", run.ID, query), token(t, testUser), "")
+		if resp.Code != http.StatusOK {
+			t.Fatalf("the listing answered %d: %s", resp.Code, resp.Body)
+		}
+		var body struct {
+			Count int            `json:"count"`
+			Files []listedResult `json:"files"`
+		}
+		if err := json.Unmarshal(resp.Body.Bytes(), &body); err != nil {
+			t.Fatal(err)
+		}
+		if body.Count != len(body.Files) {
+			t.Errorf("the listing counts %d of its %d files", body.Count, len(body.Files))
+		}
+		listed := make(map[string]listedResult, len(body.Files))
+		for _, file := range body.Files {
+			listed[file.RelPath] = file
+		}
+		return listed
+	}
+
+	grouped := list("")
+	want := map[string]struct {
+		format, mimeType string
+		members          []string
+	}{
+		"model.out":             {"netcdf", "application/x-netcdf", nil},
+		"table.parquet":         {"parquet", "application/vnd.apache.parquet", nil},
+		"forecast/latest.grib2": {"grib", "application/x-grib", nil},
+		"roads.shp":             {"shapefile", "application/vnd.shp", []string{"roads.dbf", "roads.shp", "roads.shx"}},
+		"grid.zarr":             {"zarr", "application/vnd.zarr", []string{"grid.zarr/.zgroup", "grid.zarr/t/.zarray", "grid.zarr/t/0"}},
+	}
+	if len(grouped) != len(want) {
+		t.Errorf("the results are listed as %d entries, want %d: %v", len(grouped), len(want), grouped)
+	}
+	for relPath, w := range want {
+		got, ok := grouped[relPath]
+		if !ok {
+			t.Errorf("%s is not listed", relPath)
+			continue
+		}
+		members := make([]string, 0, len(got.Members))
+		for _, member := range got.Members {
+			members = append(members, member.RelPath)
+		}
+		if got.Format != w.format || got.MimeType != w.mimeType || strings.Join(members, ",") != strings.Join(w.members, ",") {
+			t.Errorf("%s is listed as %s of %s with the members %v, want %s of %s with %v", relPath, got.Format, got.MimeType, members, w.format, w.mimeType, w.members)
+		}
+	}
+	if flat := list("?flat=true"); len(flat) != 9 || flat["roads.dbf"].MimeType != "application/vnd.dbf" {
+		t.Errorf("the flat listing has %d files: %v", len(flat), flat)
+	}
+	if resp := s.do(http.MethodGet, fmt.Sprintf("/runs/%d/results?flat=maybe", run.ID), token(t, testUser), ""); resp.Code != http.StatusBadRequest {
+		t.Errorf("an invalid flat value answered %d, want %d", resp.Code, http.StatusBadRequest)
+	}
+
+	for file, contentType := range map[string]string{
+		"model.out":             "application/x-netcdf",
+		"table.parquet":         "application/vnd.apache.parquet",
+		"forecast/latest.grib2": "application/x-grib",
+	} {
+		resp := s.do(http.MethodGet, fmt.Sprintf("/runs/%d/results/%s", run.ID, url.PathEscape(file)), token(t, testUser), "")
+		if resp.Code != http.StatusOK {
+			t.Fatalf("the download of %s answered %d: %s", file, resp.Code, resp.Body)
+		}
+		if got := resp.Header().Get("Content-Type"); got != contentType {
+			t.Errorf("%s is served as %q, want %q", file, got, contentType)
+		}
+	}
+}
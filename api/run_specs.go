@@ -1,136 +1,377 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 
-	"github.com/hydrocode-de/gorun/internal/cache"
+	"github.com/hydrocode-de/gorun/internal/audit"
 	"github.com/hydrocode-de/gorun/internal/db"
+	"github.com/hydrocode-de/gorun/internal/specversion"
 	"github.com/hydrocode-de/gorun/internal/tool"
+	"github.com/hydrocode-de/gorun/internal/toolImage"
 	toolspec "github.com/hydrocode-de/tool-spec-go"
-	"github.com/hydrocode-de/tool-spec-go/validate"
-	"github.com/spf13/viper"
 )
 
 type ListToolSpecResponse struct {
-	Count int                 `json:"count"`
-	Tools []toolspec.ToolSpec `json:"tools"`
+	Count int                `json:"count"`
+	Tools []ToolSpecResponse `json:"tools"`
+	// Generation changes whenever the cached specs change
+	Generation uint64 `json:"generation"`
+	// ScanStatus tells if the list is still filled by the scan of the local images
+	ScanStatus toolImage.ScanStatus `json:"scan_status"`
+}
+
+// ToolSpecResponse is the tool spec along with the assessment of its spec version
+type ToolSpecResponse struct {
+	toolspec.ToolSpec
+	Compatibility *specversion.Compatibility `json:"compatibility,omitempty"`
+	Platform      string                     `json:"platform,omitempty"`
+	Scan          *db.ImageScan              `json:"scan,omitempty"`
+	// Source is local, registry or catalog, Available tells if the Docker host has the image
+	Source    string `json:"source,omitempty"`
+	Available bool   `json:"available"`
+	// SpecReader is label, gotap or file for local images
+	SpecReader string `json:"spec_reader,omitempty"`
+	// CanonicalSlug is the slug the spec is cached under, Aliases are the slugs of the other tags of the image
+	CanonicalSlug string   `json:"canonical_slug,omitempty"`
+	Aliases       []string `json:"aliases,omitempty"`
+	// Usage is only included with ?stats=true
+	Usage      *tool.ToolUsage `json:"usage,omitempty"`
+	Generation uint64          `json:"generation,omitempty"`
+}
+
+func (s *Server) toolSpecResponse(ctx context.Context, spec toolspec.ToolSpec) ToolSpecResponse {
+	resp := ToolSpecResponse{ToolSpec: spec, CanonicalSlug: spec.ID}
+	if _, toolName, ok := strings.Cut(spec.ID, "::"); ok {
+		for _, alias := range s.Cache.GetImageAliases(spec.ID) {
+			resp.Aliases = append(resp.Aliases, alias+"::"+toolName)
+		}
+	}
+	if compat, ok := s.Cache.GetCompatibility(spec.ID); ok {
+		resp.Compatibility = &compat
+	}
+	resp.Platform, _ = s.Cache.GetPlatform(spec.ID)
+	if origin, ok := s.Cache.GetOrigin(spec.ID); ok {
+		resp.Source, resp.Available, resp.SpecReader = origin.Source, origin.Available, origin.Reader
+	}
+	if scan, ok := toolImage.GetImageScan(ctx, s.DB, s.Cache, spec.ID); ok {
+		resp.Scan = &scan
+	}
+	return resp
 }
 
 type CreateRunPayload struct {
-	ToolName    string                 `json:"name"`
-	DockerImage string                 `json:"docker_image"`
-	Parameters  map[string]interface{} `json:"parameters"`
-	DataPaths   map[string]string      `json:"data"`
+	ToolName    string                     `json:"name"`
+	DockerImage string                     `json:"docker_image"`
+	Parameters  map[string]interface{}     `json:"parameters"`
+	DataPaths   map[string]tool.DatasetRef `json:"data"`
+	ScratchGB   int                        `json:"scratch_gb,omitempty"`
+	DataMode    string                     `json:"data_mode,omitempty"`
+	RunAsRoot   bool                       `json:"run_as_root,omitempty"`
+	Hardening   *tool.HardeningOverride    `json:"hardening,omitempty"`
+	MaxRetries  int                        `json:"max_retries,omitempty"`
+	Notify      *bool                      `json:"notify,omitempty"`
+	// MaxOutputBytes lowers run.max_output_bytes for this run
+	MaxOutputBytes int64 `json:"max_output_bytes,omitempty"`
+	// CommandOverride replaces the entrypoint and cmd of the image, admins only
+	CommandOverride *tool.CommandOverride `json:"command_override,omitempty"`
+	// Runtime is docker, apptainer or ssh, the server default if empty
+	Runtime string `json:"runtime,omitempty"`
+	// UsePrepare runs gotap prepare before the tool, the server default if empty
+	UsePrepare *bool `json:"use_prepare,omitempty"`
+	// ParamEnv exports the parameters as environment variables, the param_env flag of the spec if empty
+	ParamEnv *bool `json:"param_env,omitempty"`
+	// ProjectID is the project the run is created in, the personal project if empty
+	ProjectID int64 `json:"project_id,omitempty"`
+	// Priority is low, normal or high, only admins may set high
+	Priority string `json:"priority,omitempty"`
+	// DryRun returns the plan of the container instead of creating the run
+	DryRun bool `json:"dry_run,omitempty"`
 }
 
-func RunMiddleware(handler func(http.ResponseWriter, *http.Request, tool.Tool)) func(http.ResponseWriter, *http.Request) {
-	return func(w http.ResponseWriter, r *http.Request) {
+// newCreateRunPayload fills the fields of a payload from the settings of the user
+func newCreateRunPayload(settings tool.UserSettings) CreateRunPayload {
+	payload := CreateRunPayload{
+		Notify:     settings.Notify,
+		UsePrepare: settings.UsePrepare,
+	}
+	if settings.ScratchGB != nil {
+		payload.ScratchGB = *settings.ScratchGB
+	}
+	if settings.DataMode != nil {
+		payload.DataMode = *settings.DataMode
+	}
+	if settings.MaxRetries != nil {
+		payload.MaxRetries = *settings.MaxRetries
+	}
+	if settings.ProjectID != nil {
+		payload.ProjectID = *settings.ProjectID
+	}
+	if settings.Runtime != nil {
+		payload.Runtime = *settings.Runtime
+	}
+	if settings.Priority != nil {
+		payload.Priority = *settings.Priority
+	}
+	return payload
+}
+
+// RunMiddleware loads the run of the path for the handler. Runs in the trash are not found.
+func (s *Server) RunMiddleware(handler RunHandlerFunc) HandlerFunc {
+	return s.runMiddleware(handler, false, false)
+}
+
+// TrashedRunMiddleware is the RunMiddleware of the handlers which also accept runs in the trash
+func (s *Server) TrashedRunMiddleware(handler RunHandlerFunc) HandlerFunc {
+	return s.runMiddleware(handler, true, false)
+}
+
+// OwnedRunMiddleware is the RunMiddleware of the handlers which only the owner of the run and
+// admins may use, even to read, like the listing of its share links
+func (s *Server) OwnedRunMiddleware(handler RunHandlerFunc) HandlerFunc {
+	return s.runMiddleware(handler, false, true)
+}
+
+func (s *Server) runMiddleware(handler RunHandlerFunc, allowTrashed bool, ownerOnly bool) HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) error {
 		user_id := r.Header.Get("X-User-ID")
 		if user_id == "" {
-			RespondWithError(w, http.StatusUnauthorized, "User ID is required")
-			return
+			return StatusError(http.StatusUnauthorized, "User ID is required")
 		}
-		DB := viper.Get("db").(*db.Queries)
 
 		idPath := r.PathValue("id")
 		if idPath == "" {
-			RespondWithError(w, http.StatusBadRequest, "missing run id")
-			return
+			return StatusError(http.StatusBadRequest, "missing run id")
 		}
 		id, err := strconv.ParseInt(idPath, 10, 64)
 		if err != nil {
-			RespondWithError(w, http.StatusBadRequest, fmt.Sprintf("the passed run id is not a valid integer: %v", err))
+			return StatusError(http.StatusBadRequest, fmt.Sprintf("the passed run id is not a valid integer: %v", err))
 		}
 
-		run, err := DB.GetRun(r.Context(), db.GetRunParams{
-			ID:     id,
-			UserID: user_id,
-		})
+		getRun := tool.GetRun
+		if (r.Method == http.MethodGet || r.Method == http.MethodHead) && !ownerOnly {
+			// the members of the project of a run may read it, only its owner and admins change it
+			getRun = tool.GetVisibleRun
+		}
+		run, err := getRun(r.Context(), s.DB, id, user_id)
 		if err != nil {
-			RespondWithError(w, http.StatusNotFound, err.Error())
-			return
+			return err
+		}
+
+		if run.DeletedAt.Valid && !allowTrashed {
+			return StatusError(http.StatusNotFound, fmt.Sprintf("the run %d is in the trash, restore it first", id))
 		}
 
 		tool, err := tool.FromDBRun(run)
 		if err != nil {
-			RespondWithError(w, http.StatusInternalServerError, err.Error())
+			return StatusError(http.StatusInternalServerError, err.Error())
 		}
 
-		handler(w, r, tool)
+		return handler(w, r, tool)
 	}
 }
 
-func GetToolSpec(w http.ResponseWriter, r *http.Request) {
+func (s *Server) GetToolSpec(w http.ResponseWriter, r *http.Request) error {
 	toolName := r.PathValue("toolname")
 	if toolName == "" {
-		RespondWithError(w, http.StatusNotFound, "missing tool name")
+		return StatusError(http.StatusNotFound, "missing tool name")
 	}
 
-	Cache := viper.Get("cache").(*cache.Cache)
-	spec, wasFound := Cache.GetToolSpec(toolName)
-	if !wasFound {
-		RespondWithError(w, http.StatusNotFound, "tool not found")
+	// while the initial scan is running, the image of the tool is read on demand
+	if _, ok := s.Cache.GetToolSpec(toolName); !ok && !s.Cache.IsInitialised() && strings.Contains(toolName, "::") {
+		if _, err := tool.LoadToolSpec(r.Context(), s.DB, s.Cache, toolName); err != nil {
+			return err
+		}
 	}
-	RespondWithJSON(w, http.StatusOK, spec)
+
+	return s.respondWithCachedSpecs(w, "specs/"+toolName, func(generation uint64) (interface{}, bool) {
+		spec, wasFound := s.Cache.GetToolSpec(toolName)
+		if !wasFound {
+			return nil, false
+		}
+		resp := s.toolSpecResponse(r.Context(), *spec)
+		resp.Generation = generation
+		return resp, true
+	})
 }
 
-func ListToolSpecs(w http.ResponseWriter, r *http.Request) {
-	Cache := viper.Get("cache").(*cache.Cache)
-	specs := Cache.ListToolSpecs()
+// GetScanStatus reports the progress of the scan of the local images
+func (s *Server) GetScanStatus(w http.ResponseWriter, r *http.Request) error {
+	return RespondWithJSON(w, http.StatusOK, toolImage.CurrentScan())
+}
 
-	RespondWithJSON(w, http.StatusOK, ListToolSpecResponse{
-		Count: len(specs),
-		Tools: specs,
-	})
+// GetReadiness answers 503 with the scan status until the local images were scanned once
+func (s *Server) GetReadiness(w http.ResponseWriter, r *http.Request) error {
+	status := http.StatusOK
+	if !s.Cache.IsInitialised() {
+		status = http.StatusServiceUnavailable
+	}
+	return RespondWithJSON(w, status, toolImage.CurrentScan())
 }
 
-func CreateRun(w http.ResponseWriter, r *http.Request) {
-	user_id := r.Header.Get("X-User-ID")
-	if user_id == "" {
-		RespondWithError(w, http.StatusUnauthorized, "User ID is required")
-		return
+// respondWithCachedSpecs reuses the serialized response of an earlier request in the same
+// cache generation. build returns false if the spec was not found.
+func (s *Server) respondWithCachedSpecs(w http.ResponseWriter, key string, build func(generation uint64) (interface{}, bool)) error {
+	if body, ok := s.Cache.GetResponse(key); ok {
+		respondWithRawJSON(w, http.StatusOK, body)
+		return nil
 	}
 
-	var payload CreateRunPayload
-	err := json.NewDecoder(r.Body).Decode(&payload)
+	generation := s.Cache.Generation()
+	resp, found := build(generation)
+	if !found {
+		return StatusError(http.StatusNotFound, "tool not found")
+	}
+	body, err := json.Marshal(resp)
 	if err != nil {
-		RespondWithError(w, http.StatusBadRequest, err.Error())
-		return
+		return StatusError(http.StatusInternalServerError, err.Error())
 	}
+	body = append(body, '\n')
+	s.Cache.SetResponse(key, generation, body)
+	respondWithRawJSON(w, http.StatusOK, body)
+	return nil
+}
 
-	Cache := viper.Get("cache").(*cache.Cache)
-	toolSlug := fmt.Sprintf("%s::%s", payload.DockerImage, payload.ToolName)
-	toolSpec, wasFound := Cache.GetToolSpec(toolSlug)
+// ScanToolImage scans the image of the tool for vulnerabilities with the configured scanner
+func (s *Server) ScanToolImage(w http.ResponseWriter, r *http.Request) error {
+	user, err := s.DB.GetUserByID(r.Context(), r.Header.Get("X-User-ID"))
+	if err != nil || !user.IsAdmin {
+		return StatusError(http.StatusForbidden, "only admins may scan tool images")
+	}
+
+	toolName := r.PathValue("toolname")
+	spec, wasFound := s.Cache.GetToolSpec(toolName)
 	if !wasFound {
-		RespondWithError(w, http.StatusNotFound, fmt.Sprintf("a tool %s was not found in the cache", toolSlug))
-		return
+		return StatusError(http.StatusNotFound, "tool not found")
 	}
-	hasErrors, errs := validate.ValidateInputs(*toolSpec, toolspec.ToolInput{
-		Parameters: payload.Parameters,
-		Datasets:   payload.DataPaths,
-	})
-	if hasErrors {
-		RespondWithJSON(w, http.StatusBadRequest, map[string]interface{}{
-			"message": fmt.Sprintf("the provided payload is invalid for the tool %s", toolSlug),
-			"errors":  errs,
-		})
-		return
+	scanner := toolImage.ScannerFromConfig()
+	if scanner == nil {
+		return StatusError(http.StatusServiceUnavailable, "no vulnerability scanner is configured on this server")
+	}
+
+	imageName, _, _ := strings.Cut(spec.ID, "::")
+	scan, err := toolImage.ScanImage(r.Context(), s.DB, s.Cache, scanner, imageName)
+	if err != nil {
+		return err
+	}
+	s.recordAudit(r, user.ID, audit.ActionImageScan, "image:"+imageName)
+	return RespondWithJSON(w, http.StatusOK, scan)
+}
+
+// ListToolSpecs lists the cached tools. With ?available=true or false, only the tools
+// whose image is or is not on the Docker host are listed.
+func (s *Server) ListToolSpecs(w http.ResponseWriter, r *http.Request) error {
+	key := "specs"
+	var available *bool
+	if value := r.URL.Query().Get("available"); value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return StatusError(http.StatusBadRequest, fmt.Sprintf("invalid available filter %q, has to be true or false", value))
+		}
+		available = &parsed
+		key = fmt.Sprintf("specs?available=%t", parsed)
+	}
+	withStats := r.URL.Query().Get("stats") == "true"
+
+	build := func(generation uint64) (interface{}, bool) {
+		specs := s.Cache.ListToolSpecs()
+		tools := make([]ToolSpecResponse, 0, len(specs))
+		var usage map[string]tool.ToolUsage
+		if withStats {
+			usage = make(map[string]tool.ToolUsage)
+			if ranked, err := tool.ListToolUsage(r.Context(), s.DB); err == nil {
+				for _, u := range ranked {
+					usage[u.Tool] = u
+				}
+			} else {
+				requestLogger(r).Printf("could not read the tool usage: %v", err)
+			}
+		}
+		for _, spec := range specs {
+			resp := s.toolSpecResponse(r.Context(), spec)
+			if available != nil && resp.Available != *available {
+				continue
+			}
+			if withStats {
+				u, ok := usage[spec.ID]
+				if !ok {
+					u = tool.ToolUsage{Tool: spec.ID}
+				}
+				resp.Usage = &u
+			}
+			tools = append(tools, resp)
+		}
+		return ListToolSpecResponse{
+			Count:      len(tools),
+			Tools:      tools,
+			Generation: generation,
+			ScanStatus: toolImage.CurrentScan(),
+		}, true
+	}
+	// the usage changes without the specs, as does the progress of a running scan, so these responses are not cached
+	if withStats || toolImage.CurrentScan().State != toolImage.ScanComplete {
+		resp, _ := build(s.Cache.Generation())
+		return RespondWithJSON(w, http.StatusOK, resp)
+	}
+	return s.respondWithCachedSpecs(w, key, build)
+}
+
+func (s *Server) CreateRun(w http.ResponseWriter, r *http.Request) error {
+	user_id := r.Header.Get("X-User-ID")
+	if user_id == "" {
+		return StatusError(http.StatusUnauthorized, "User ID is required")
+	}
+
+	settings, err := tool.GetUserSettings(r.Context(), s.DB, user_id)
+	if err != nil {
+		return err
+	}
+	// the payload is decoded over the defaults of the user, so the fields it sets win
+	payload := newCreateRunPayload(settings)
+	err = json.NewDecoder(r.Body).Decode(&payload)
+	if err != nil {
+		return StatusError(http.StatusBadRequest, err.Error())
 	}
 
-	// create the mount paths with random strategy
 	opts := tool.CreateRunOptions{
 		Name:       payload.ToolName,
 		Image:      payload.DockerImage,
 		Parameters: payload.Parameters,
 		Datasets:   payload.DataPaths,
+		ScratchGB:  payload.ScratchGB,
+		DataMode:   payload.DataMode,
+		RunAsRoot:  payload.RunAsRoot,
+		Hardening:  payload.Hardening,
+		MaxRetries: payload.MaxRetries,
+		Notify:     payload.Notify,
+
+		CommandOverride: payload.CommandOverride,
+		Runtime:         payload.Runtime,
+		UsePrepare:      payload.UsePrepare,
+		ParamEnv:        payload.ParamEnv,
+		ProjectID:       payload.ProjectID,
+		Priority:        payload.Priority,
+		MaxOutputBytes:  payload.MaxOutputBytes,
 	}
-	runData, err := tool.CreateToolRun(r.Context(), "_random", opts, user_id)
+	if payload.DryRun {
+		plan, err := tool.PlanRun(r.Context(), s.DB, s.Cache, opts, user_id)
+		if err != nil {
+			return err
+		}
+		return RespondWithJSON(w, http.StatusOK, plan)
+	}
+	runData, err := tool.ValidateAndCreateRun(r.Context(), s.DB, s.Cache, opts, user_id)
 	if err != nil {
-		RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return err
+	}
+	s.recordAudit(r, user_id, audit.ActionRunCreate, fmt.Sprintf("run:%d", runData.ID))
+	if payload.CommandOverride != nil {
+		s.recordAudit(r, user_id, audit.ActionRunCommandOverride, fmt.Sprintf("run:%d %s", runData.ID, payload.CommandOverride))
 	}
 
-	RespondWithJSON(w, http.StatusCreated, runData)
+	return RespondWithJSON(w, http.StatusCreated, runData)
 }
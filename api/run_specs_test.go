@@ -0,0 +1,141 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/hydrocode-de/gorun/internal/dockertest"
+	"github.com/hydrocode-de/gorun/internal/toolImage"
+	toolspec "github.com/hydrocode-de/tool-spec-go"
+	"github.com/spf13/viper"
+)
+
+// newSpecServer is a test server whose cache holds the specs of a completed scan of the
+// fake daemon, so that the spec responses are cached
+func newSpecServer(t testing.TB) *testServer {
+	t.Helper()
+	s := newTestServer(t)
+	daemon := dockertest.New(t)
+	daemon.AddImage(dockertest.Image{
+		RepoTags: []string{"gorun-test:1.0"},
+		Labels:   map[string]string{"org.toolspec.spec": "tools:\n  echo:\n    title: Echo\n    description: Echoes\n"},
+	})
+	for key, value := range map[string]any{
+		"images.spec_label":      "org.toolspec.spec",
+		"images.max_label_bytes": 1024,
+		"tools.load_timeout":     10 * time.Second,
+	} {
+		viper.Set(key, value)
+	}
+	if _, err := toolImage.ReadAllTools(context.Background(), s.Cache, toolImage.Policy{}, false); err != nil {
+		t.Fatalf("cannot scan the images: %v", err)
+	}
+	return s
+}
+
+// getSpecs sends the request and returns the raw body of the response
+func getSpecs(t *testing.T, s *testServer, path string) []byte {
+	t.Helper()
+	resp := s.do(http.MethodGet, path, token(t, testUser), "")
+	if resp.Code != http.StatusOK {
+		t.Fatalf("%s answered %d: %s", path, resp.Code, resp.Body)
+	}
+	return resp.Body.Bytes()
+}
+
+func TestSpecResponsesPerGeneration(t *testing.T) {
+	s := newSpecServer(t)
+	const slugPath = "/specs/gorun-test:1.0::echo"
+	var list ListToolSpecResponse
+	var spec ToolSpecResponse
+	read := func() {
+		t.Helper()
+		if err := json.Unmarshal(getSpecs(t, s, "/specs"), &list); err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal(getSpecs(t, s, slugPath), &spec); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	read()
+	generation := list.Generation
+	if list.Count != 1 || spec.Generation != generation {
+		t.Fatalf("the specs of generation %d are %+v and %+v", generation, list, spec)
+	}
+	// within a generation, the same serialized response is returned
+	if first, second := getSpecs(t, s, "/specs"), getSpecs(t, s, "/specs"); !bytes.Equal(first, second) {
+		t.Errorf("the list changed within a generation:\n%s\n%s", first, second)
+	}
+	if _, ok := s.Cache.GetResponse("specs"); !ok {
+		t.Errorf("the list of the generation was not stored")
+	}
+
+	s.Cache.SetToolSpec("gorun-test:1.0::other", &toolspec.ToolSpec{ID: "gorun-test:1.0::other", Name: "other", Title: "Other"})
+	read()
+	if list.Generation <= generation || list.Count != 2 || spec.Generation != list.Generation {
+		t.Errorf("after adding a tool the list has %d specs in generation %d and the spec is of generation %d, want 2 specs after %d", list.Count, list.Generation, spec.Generation, generation)
+	}
+
+	generation = list.Generation
+	s.Cache.SetImagePlatform("gorun-test:1.0", "linux/arm64")
+	read()
+	if list.Generation <= generation || spec.Platform != "linux/arm64" {
+		t.Errorf("after changing the platform the spec of generation %d has the platform %q", spec.Generation, spec.Platform)
+	}
+
+	s.Cache.RemoveImage("gorun-test:1.0")
+	if err := json.Unmarshal(getSpecs(t, s, "/specs"), &list); err != nil {
+		t.Fatal(err)
+	}
+	if list.Count != 0 {
+		t.Errorf("the removed image still lists %d specs", list.Count)
+	}
+	if resp := s.do(http.MethodGet, slugPath, token(t, testUser), ""); resp.Code != http.StatusNotFound {
+		t.Errorf("the spec of the removed image answered %d, want 404", resp.Code)
+	}
+}
+
+// BenchmarkListToolSpecs compares the list of 500 specs served from the stored response
+// with the list serialized again for every request
+func BenchmarkListToolSpecs(b *testing.B) {
+	s := newSpecServer(b)
+	for i := range 500 {
+		slug := fmt.Sprintf("gorun-test:1.0::tool%03d", i)
+		s.Cache.SetToolSpec(slug, &toolspec.ToolSpec{
+			ID:          slug,
+			Name:        fmt.Sprintf("tool%03d", i),
+			Title:       "Benchmark tool",
+			Description: "A tool of the benchmark with a few parameters",
+			Parameters: map[string]toolspec.ParameterSpec{
+				"message": {Name: "message", ToolType: "string"},
+				"count":   {Name: "count", ToolType: "integer", Default: 1},
+			},
+		})
+	}
+	accessToken := token(b, testUser)
+
+	b.Run("cached", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			if resp := s.do(http.MethodGet, "/specs", accessToken, ""); resp.Code != http.StatusOK {
+				b.Fatalf("the list answered %d", resp.Code)
+			}
+		}
+	})
+	b.Run("uncached", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			// a new generation drops the stored response
+			s.Cache.SetImagePlatform("gorun-test:1.0", "linux/amd64")
+			if resp := s.do(http.MethodGet, "/specs", accessToken, ""); resp.Code != http.StatusOK {
+				b.Fatalf("the list answered %d", resp.Code)
+			}
+		}
+	})
+}
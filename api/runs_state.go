@@ -1,16 +1,22 @@
 package api
 
 import (
+	"cmp"
 	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
-	"os"
-	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/hydrocode-de/gorun/internal/audit"
 	"github.com/hydrocode-de/gorun/internal/db"
+	"github.com/hydrocode-de/gorun/internal/outputs"
 	"github.com/hydrocode-de/gorun/internal/tool"
 	"github.com/spf13/viper"
 )
@@ -19,11 +25,25 @@ type RunsResponse struct {
 	Count  int           `json:"count"`
 	Status string        `json:"status"`
 	Runs   []RunListItem `json:"runs"`
+	// ExpiredCount are the visible runs which expired before they were started, whatever the filters
+	ExpiredCount int `json:"expired_count"`
 }
 
 type RunDetailResponse struct {
 	tool.Tool
-	GotapMetadata interface{} `json:"gotap_metadata,omitempty"`
+	GotapMetadata        *tool.GotapMetadata        `json:"gotap_metadata,omitempty"`
+	GotapMetadataRaw     json.RawMessage            `json:"gotap_metadata_raw,omitempty"`
+	ExecutionEnvironment *tool.ExecutionEnvironment `json:"execution_environment,omitempty"`
+	Stats                *db.RunStat                `json:"stats,omitempty"`
+	OutputsComplete      *bool                      `json:"outputs_complete,omitempty"`
+	Outputs              *outputs.Verification      `json:"outputs,omitempty"`
+	StdoutTail           *string                    `json:"stdout_tail,omitempty"`
+	StderrTail           *string                    `json:"stderr_tail,omitempty"`
+}
+
+type RunEventsResponse struct {
+	Count  int           `json:"count"`
+	Events []db.RunEvent `json:"events"`
 }
 
 type RunResultSummary struct {
@@ -34,10 +54,22 @@ type RunResultSummary struct {
 	TotalSize     int64 `json:"total_size"`
 }
 
+// RunListItem is a run in the listing. The JSON columns of the runs are only parsed
+// into the RunListDetails with ?full=true
 type RunListItem struct {
-	tool.Tool
-	GotapMetadata interface{}       `json:"gotap_metadata,omitempty"`
-	ResultSummary *RunResultSummary `json:"result_summary,omitempty"`
+	tool.RunSummary
+	*RunListDetails
+	GotapMetadata    *tool.GotapMetadata `json:"gotap_metadata,omitempty"`
+	GotapMetadataRaw json.RawMessage     `json:"gotap_metadata_raw,omitempty"`
+	ResultSummary    *RunResultSummary   `json:"result_summary,omitempty"`
+	PeakMemoryBytes  *int64              `json:"peak_memory_bytes,omitempty"`
+}
+
+type RunListDetails struct {
+	Parameters map[string]interface{}     `json:"parameters,omitempty"`
+	Data       map[string]tool.DatasetRef `json:"data,omitempty"`
+	Mounts     map[string]string          `json:"mounts,omitempty"`
+	Options    tool.RunOptions            `json:"options"`
 }
 
 func classifyResultFile(name string) string {
@@ -53,7 +85,7 @@ func classifyResultFile(name string) string {
 	return "artifact"
 }
 
-func summarizeResults(run tool.Tool) *RunResultSummary {
+func summarizeResults(run tool.RunSummary) *RunResultSummary {
 	results, err := run.ListResults()
 	if err != nil {
 		return nil
@@ -77,167 +109,374 @@ func summarizeResults(run tool.Tool) *RunResultSummary {
 	return summary
 }
 
-func appendMetadataFields(run db.Run, item *RunListItem) {
-	if !run.GotapMetadata.Valid {
-		return
+// parseMetadataFields returns the typed gotap metadata of a run. If the stored
+// JSON does not match the known format, it is passed on as raw JSON instead.
+func parseMetadataFields(runID int64, raw sql.NullString) (*tool.GotapMetadata, json.RawMessage) {
+	if !raw.Valid {
+		return nil, nil
+	}
+
+	metadata, err := tool.ParseGotapMetadata(raw.String)
+	if err != nil {
+		log.Printf("failed parsing gotap metadata for run %d: %v", runID, err)
+		if json.Valid([]byte(raw.String)) {
+			return nil, json.RawMessage(raw.String)
+		}
+		return nil, nil
+	}
+	return metadata, nil
+}
+
+// listRunItems loads the runs of the user for the listing. They are read as summaries,
+// unless full asks for the parsed parameters, data, mounts and options of each run.
+func (s *Server) listRunItems(ctx context.Context, userID string, full bool) ([]RunListItem, error) {
+	items := make([]RunListItem, 0)
+	if !full {
+		rows, err := s.DB.GetRunSummaries(ctx, db.GetRunSummariesParams{UserID: userID, UserID_2: userID})
+		if err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			item := RunListItem{RunSummary: tool.SummaryFromDBRow(row)}
+			item.GotapMetadata, item.GotapMetadataRaw = parseMetadataFields(row.ID, row.GotapMetadata)
+			items = append(items, item)
+		}
+		return items, nil
 	}
 
-	var metadata interface{}
-	if err := json.Unmarshal([]byte(run.GotapMetadata.String), &metadata); err != nil {
-		log.Printf("failed parsing gotap metadata for run %d: %v", run.ID, err)
-		return
+	runs, err := s.DB.GetAllRuns(ctx, db.GetAllRunsParams{UserID: userID, UserID_2: userID})
+	if err != nil {
+		return nil, err
 	}
-	item.GotapMetadata = metadata
+	for _, dbRun := range runs {
+		toolRun, err := tool.FromDBRun(dbRun)
+		if err != nil {
+			log.Printf("Error while loading tool run: %s", err)
+			continue
+		}
+		item := RunListItem{
+			RunSummary: toolRun.Summary(),
+			RunListDetails: &RunListDetails{
+				Parameters: toolRun.Parameters,
+				Data:       toolRun.Data,
+				Mounts:     toolRun.Mounts,
+				Options:    toolRun.Options,
+			},
+		}
+		item.GotapMetadata, item.GotapMetadataRaw = parseMetadataFields(dbRun.ID, dbRun.GotapMetadata)
+		items = append(items, item)
+	}
+	return items, nil
 }
 
-func GetAllRuns(w http.ResponseWriter, r *http.Request) {
+func (s *Server) GetAllRuns(w http.ResponseWriter, r *http.Request) error {
 	filter := r.URL.Query().Get("status")
-	DB := viper.Get("db").(*db.Queries)
 
 	user_id := r.Header.Get("X-User-ID")
 	log.Printf("user_id: %s", user_id)
 	log.Printf("r.Header: %v", r.Header)
 	if user_id == "" {
-		RespondWithError(w, http.StatusUnauthorized, "User ID is required")
-		return
+		return StatusError(http.StatusUnauthorized, "User ID is required")
+	}
+
+	var status tool.RunStatus
+	if filter != "" && filter != "all" {
+		parsed, err := tool.ParseRunStatus(filter)
+		if err != nil {
+			return StatusError(http.StatusBadRequest, err.Error())
+		}
+		status = parsed
+	}
+
+	full := false
+	if raw := r.URL.Query().Get("full"); raw != "" {
+		parsed, err := strconv.ParseBool(raw)
+		if err != nil {
+			return StatusError(http.StatusBadRequest, "full must be a boolean")
+		}
+		full = parsed
 	}
 
-	var runs []db.Run
-	var err error
-	switch filter {
-	case "pending":
-		runs, err = DB.GetIdleRuns(r.Context(), db.GetIdleRunsParams{
-			UserID: user_id,
+	items, err := s.listRunItems(r.Context(), user_id, full)
+	if err != nil {
+		return StatusError(http.StatusInternalServerError, err.Error())
+	}
+	expiredCount := 0
+	for _, item := range items {
+		if tool.RunStatus(item.Status) == tool.StatusExpired && item.DeletedAt == nil {
+			expiredCount++
+		}
+	}
+	if status != "" {
+		items = slices.DeleteFunc(items, func(item RunListItem) bool {
+			return tool.RunStatus(item.Status) != status
 		})
-	case "running":
-		runs, err = DB.GetRunning(r.Context(), db.GetRunningParams{
-			UserID: user_id,
+	}
+
+	// trashed runs are only listed with ?trashed=true, and then only those
+	trashed := false
+	if raw := r.URL.Query().Get("trashed"); raw != "" {
+		parsed, err := strconv.ParseBool(raw)
+		if err != nil {
+			return StatusError(http.StatusBadRequest, "trashed must be a boolean")
+		}
+		trashed = parsed
+	}
+	items = slices.DeleteFunc(items, func(item RunListItem) bool {
+		return (item.DeletedAt != nil) != trashed
+	})
+
+	if projectFilter := r.URL.Query().Get("project"); projectFilter != "" {
+		projectID, err := strconv.ParseInt(projectFilter, 10, 64)
+		if err != nil {
+			return StatusError(http.StatusBadRequest, "project must be the ID of a project")
+		}
+		items = slices.DeleteFunc(items, func(item RunListItem) bool {
+			return item.ProjectID == nil || *item.ProjectID != projectID
 		})
-	case "finished":
-		runs, err = DB.GetFinishedRuns(r.Context(), db.GetFinishedRunsParams{
-			UserID: user_id,
+	}
+
+	if kindFilter := r.URL.Query().Get("kind"); kindFilter != "" {
+		kind, err := tool.ParseErrorKind(kindFilter)
+		if err != nil {
+			return StatusError(http.StatusBadRequest, err.Error())
+		}
+		items = slices.DeleteFunc(items, func(item RunListItem) bool {
+			return item.ErrorKind != kind
 		})
-	case "errored":
-		runs, err = DB.GetErroredRuns(r.Context(), db.GetErroredRunsParams{
-			UserID: user_id,
+	}
+
+	sortBy := r.URL.Query().Get("sort")
+	switch sortBy {
+	case "":
+	case "duration", "-duration":
+		// runs without a duration are listed last in both directions
+		slices.SortStableFunc(items, func(a, b RunListItem) int {
+			if (a.DurationMs != nil) != (b.DurationMs != nil) {
+				if a.DurationMs != nil {
+					return -1
+				}
+				return 1
+			}
+			if a.DurationMs == nil {
+				return 0
+			}
+			if sortBy == "-duration" {
+				return cmp.Compare(*b.DurationMs, *a.DurationMs)
+			}
+			return cmp.Compare(*a.DurationMs, *b.DurationMs)
 		})
 	default:
-		runs, err = DB.GetAllRuns(r.Context(), db.GetAllRunsParams{
-			UserID: user_id,
-		})
+		return StatusError(http.StatusBadRequest, fmt.Sprintf("invalid sort %s. Use 'duration' or '-duration'", sortBy))
 	}
-	if err != nil {
-		RespondWithError(w, http.StatusInternalServerError, err.Error())
+
+	peakMemory := make(map[int64]int64)
+	if stats, err := s.DB.GetRunStatsByUser(r.Context(), user_id); err == nil {
+		for _, stat := range stats {
+			peakMemory[stat.RunID] = stat.PeakMemoryBytes
+		}
+	} else {
+		log.Printf("failed to read the resource usage of the runs: %v", err)
 	}
 
-	var toolRuns []RunListItem
-	for _, dbRun := range runs {
-		toolRun, err := tool.FromDBRun(dbRun)
-		if err != nil {
-			log.Printf("Error while loading tool run: %s", err)
-			continue
+	for i := range items {
+		items[i].ResultSummary = summarizeResults(items[i].RunSummary)
+		if peak, ok := peakMemory[items[i].ID]; ok {
+			items[i].PeakMemoryBytes = &peak
 		}
-		item := RunListItem{Tool: toolRun}
-		appendMetadataFields(dbRun, &item)
-		item.ResultSummary = summarizeResults(toolRun)
-		toolRuns = append(toolRuns, item)
 	}
 
-	RespondWithJSON(w, http.StatusOK, RunsResponse{
-		Count:  len(runs),
-		Status: filter,
-		Runs:   toolRuns,
+	return RespondWithJSON(w, http.StatusOK, RunsResponse{
+		Count:        len(items),
+		Status:       filter,
+		Runs:         items,
+		ExpiredCount: expiredCount,
 	})
 }
 
-func DeleteRun(w http.ResponseWriter, r *http.Request, tool tool.Tool) {
+func (s *Server) DeleteRun(w http.ResponseWriter, r *http.Request, run tool.Tool) error {
 	user_id := r.Header.Get("X-User-ID")
 	if user_id == "" {
-		RespondWithError(w, http.StatusUnauthorized, "User ID is required")
-		return
+		return StatusError(http.StatusUnauthorized, "User ID is required")
 	}
-	DB := viper.Get("db").(*db.Queries)
 
-	// the tool may have a saved mount point, so we delete it first
-	_, ok := tool.Mounts["/in"]
-	if ok {
-		parent := filepath.Dir(tool.Mounts["/in"])
-		err := os.RemoveAll(parent)
+	force := false
+	if raw := r.URL.Query().Get("force"); raw != "" {
+		parsed, err := strconv.ParseBool(raw)
 		if err != nil {
-			RespondWithError(w, http.StatusInternalServerError, err.Error())
+			return StatusError(http.StatusBadRequest, "force must be a boolean")
 		}
+		force = parsed
+	}
 
+	purge := false
+	if raw := r.URL.Query().Get("purge"); raw != "" {
+		parsed, err := strconv.ParseBool(raw)
+		if err != nil {
+			return StatusError(http.StatusBadRequest, "purge must be a boolean")
+		}
+		purge = parsed
 	}
 
-	err := DB.DeleteRun(r.Context(), db.DeleteRunParams{
-		ID:     tool.ID,
-		UserID: user_id,
-	})
-	if err != nil {
-		RespondWithError(w, http.StatusInternalServerError, err.Error())
+	// without a retention, there is no trash and runs are deleted right away
+	if !purge && viper.GetDuration("run.trash_retention") > 0 {
+		if err := tool.TrashRun(r.Context(), s.DB, run, user_id, force); err != nil {
+			return err
+		}
+		s.recordAudit(r, user_id, audit.ActionRunTrash, fmt.Sprintf("run:%d", run.ID))
+		return RespondWithJSON(w, http.StatusOK, map[string]string{
+			"message": "Run moved to the trash",
+		})
 	}
-	RespondWithJSON(w, http.StatusOK, map[string]string{
+
+	// a failed deletion reports its step, deleting the run again resumes there
+	if err := tool.DeleteRun(r.Context(), s.DB, run, user_id, force); err != nil {
+		return err
+	}
+	s.recordAudit(r, user_id, audit.ActionRunDelete, fmt.Sprintf("run:%d", run.ID))
+	return RespondWithJSON(w, http.StatusOK, map[string]string{
 		"message": "Run deleted",
 	})
+}
 
+// RestoreRun takes a run out of the trash, before its files were removed
+func (s *Server) RestoreRun(w http.ResponseWriter, r *http.Request, run tool.Tool) error {
+	if err := tool.RestoreRun(r.Context(), s.DB, run); err != nil {
+		return err
+	}
+	userID := r.Header.Get("X-User-ID")
+	s.recordAudit(r, userID, audit.ActionRunRestore, fmt.Sprintf("run:%d", run.ID))
+
+	restored, err := tool.GetRun(r.Context(), s.DB, run.ID, userID)
+	if err != nil {
+		return err
+	}
+	toolRun, err := tool.FromDBRun(restored)
+	if err != nil {
+		return StatusError(http.StatusInternalServerError, err.Error())
+	}
+	return RespondWithJSON(w, http.StatusOK, toolRun)
 }
 
-func GetRunStatus(w http.ResponseWriter, r *http.Request, run tool.Tool) {
+func (s *Server) GetRunStatus(w http.ResponseWriter, r *http.Request, run tool.Tool) error {
 	userID := r.Header.Get("X-User-ID")
 	if userID == "" {
-		RespondWithError(w, http.StatusUnauthorized, "User ID is required")
-		return
+		return StatusError(http.StatusUnauthorized, "User ID is required")
 	}
-	DB := viper.Get("db").(*db.Queries)
 
-	dbRun, err := DB.GetRun(r.Context(), db.GetRunParams{
-		ID:     run.ID,
-		UserID: userID,
-	})
+	dbRun, err := tool.GetVisibleRun(r.Context(), s.DB, run.ID, userID)
 	if err != nil {
-		RespondWithError(w, http.StatusInternalServerError, err.Error())
-		return
+		return err
 	}
 
 	resp := RunDetailResponse{Tool: run}
-	if dbRun.GotapMetadata.Valid {
-		var metadata interface{}
-		if err := json.Unmarshal([]byte(dbRun.GotapMetadata.String), &metadata); err != nil {
-			log.Printf("failed parsing gotap metadata for run %d: %v", run.ID, err)
-		} else {
-			resp.GotapMetadata = metadata
+	resp.GotapMetadata, resp.GotapMetadataRaw = parseMetadataFields(dbRun.ID, dbRun.GotapMetadata)
+	if dbRun.ExecutionEnvironment.Valid {
+		var env tool.ExecutionEnvironment
+		if err := json.Unmarshal([]byte(dbRun.ExecutionEnvironment.String), &env); err == nil {
+			resp.ExecutionEnvironment = &env
 		}
 	}
+	if stats, err := s.DB.GetRunStats(r.Context(), run.ID); err == nil {
+		resp.Stats = &stats
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		log.Printf("failed to read the resource usage of run %d: %v", run.ID, err)
+	}
+	if verification, err := tool.RunOutputs(r.Context(), s.DB, run.ID); err == nil {
+		resp.OutputsComplete = &verification.Complete
+		resp.Outputs = &verification
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		log.Printf("failed to read the output verification of run %d: %v", run.ID, err)
+	}
 
-	RespondWithJSON(w, http.StatusOK, resp)
+	switch includeLogs := r.URL.Query().Get("include_logs"); includeLogs {
+	case "":
+	case "tail":
+		lines := viper.GetInt("run.log_tail_lines")
+		if resp.StdoutTail, err = logTail(run, "STDOUT.log", lines); err != nil {
+			return err
+		}
+		if resp.StderrTail, err = logTail(run, "STDERR.log", lines); err != nil {
+			return err
+		}
+	default:
+		return StatusError(http.StatusBadRequest, fmt.Sprintf("unknown include_logs value %s. Use 'tail'", includeLogs))
+	}
+
+	return RespondWithJSON(w, http.StatusOK, resp)
+}
+
+// logTail returns nil if the run has no such log, so that the field is omitted
+func logTail(run tool.Tool, name string, lines int) (*string, error) {
+	tail, found, err := run.LogTail(name, lines)
+	if err != nil || !found {
+		return nil, err
+	}
+	return &tail, nil
 }
 
-func HandleRunStart(w http.ResponseWriter, r *http.Request, run tool.Tool) {
+// HandleRunStart launches the run in the background and responds with 202 Accepted.
+// The body contains the run record right after the launch, the Location header
+// points to the run, which can be polled for the current status.
+func (s *Server) HandleRunStart(w http.ResponseWriter, r *http.Request, run tool.Tool) error {
 	user_id := r.Header.Get("X-User-ID")
 	if user_id == "" {
-		RespondWithError(w, http.StatusUnauthorized, "User ID is required")
-		return
+		return StatusError(http.StatusUnauthorized, "User ID is required")
 	}
-	DB := viper.Get("db").(*db.Queries)
 
 	opt := tool.RunToolOptions{
-		DB:   DB,
+		DB:   s.DB,
 		Tool: run,
 		Env:  []string{},
 		// Cmd:  []string{},
-		UserId: user_id,
+		UserId:    user_id,
+		RequestID: RequestID(r.Context()),
+	}
+	// only one of concurrent starts claims the run, the others are refused with 409
+	if err := tool.ClaimRun(r.Context(), s.DB, run.ID); err != nil {
+		return err
 	}
+	opt.Claimed = true
 
-	go tool.RunTool(context.Background(), opt)
+	tool.StartRun(opt)
+	s.recordAudit(r, user_id, audit.ActionRunStart, fmt.Sprintf("run:%d", run.ID))
 
 	// wait a few miliseconds to make sure the container is started
 	time.Sleep(time.Millisecond * 100)
-	started, err := DB.GetRun(r.Context(), db.GetRunParams{
-		ID:     run.ID,
-		UserID: user_id,
+	started, err := tool.GetRun(r.Context(), s.DB, run.ID, user_id)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Location", absoluteURL(r, fmt.Sprintf("/runs/%d", run.ID)))
+	return RespondWithJSON(w, http.StatusAccepted, started)
+}
+
+func (s *Server) GetRunEvents(w http.ResponseWriter, r *http.Request, run tool.Tool) error {
+	events, err := s.DB.GetRunEvents(r.Context(), run.ID)
+	if err != nil {
+		return err
+	}
+	if events == nil {
+		events = []db.RunEvent{}
+	}
+
+	return RespondWithJSON(w, http.StatusOK, RunEventsResponse{
+		Count:  len(events),
+		Events: events,
 	})
+}
+
+// GetRunInputs responds with the inputs.json the tool received. Parameters named like
+// secrets are redacted, the file in the /in mount is left untouched.
+func (s *Server) GetRunInputs(w http.ResponseWriter, r *http.Request, run tool.Tool) error {
+	inputs, err := tool.RunInputs(r.Context(), s.DB, run)
 	if err != nil {
-		RespondWithError(w, http.StatusInternalServerError, err.Error())
+		return err
 	}
-	RespondWithJSON(w, http.StatusProcessing, started)
+	redacted, err := tool.RedactInputs(inputs)
+	if err != nil {
+		return StatusError(http.StatusInternalServerError, err.Error())
+	}
+
+	return RespondWithJSON(w, http.StatusOK, json.RawMessage(redacted))
 }
@@ -0,0 +1,268 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hydrocode-de/gorun/internal/db"
+	"github.com/hydrocode-de/gorun/internal/dockertest"
+	"github.com/spf13/viper"
+)
+
+// runStatuses lists the statuses of the runs the request responds with, in their order
+func runStatuses(t *testing.T, s *testServer, path string) []string {
+	t.Helper()
+	resp := s.do(http.MethodGet, path, token(t, testUser), "")
+	if resp.Code != http.StatusOK {
+		t.Fatalf("listing %s answered %d: %s", path, resp.Code, resp.Body)
+	}
+	var body RunsResponse
+	if err := json.Unmarshal(resp.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	statuses := make([]string, 0, len(body.Runs))
+	for _, run := range body.Runs {
+		statuses = append(statuses, run.Status)
+	}
+	slices.Sort(statuses)
+	return statuses
+}
+
+func TestGetAllRunsStatusFilter(t *testing.T) {
+	s := newTestServer(t)
+	for _, status := range []string{"pending", "running", "finished", "finished", "errored"} {
+		s.createRun(t, testUser, status)
+	}
+	s.createRun(t, otherUser, "finished")
+
+	tests := map[string][]string{
+		"/runs":                 {"errored", "finished", "finished", "pending", "running"},
+		"/runs?status=all":      {"errored", "finished", "finished", "pending", "running"},
+		"/runs?status=finished": {"finished", "finished"},
+		"/runs?status=running":  {"running"},
+		"/runs?status=purged":   {},
+	}
+	for path, want := range tests {
+		if got := runStatuses(t, s, path); !slices.Equal(got, want) {
+			t.Errorf("%s listed the statuses %v, want %v", path, got, want)
+		}
+	}
+	if resp := s.do(http.MethodGet, "/runs?status=done", token(t, testUser), ""); resp.Code != http.StatusBadRequest {
+		t.Errorf("an unknown status answered %d, want 400", resp.Code)
+	}
+}
+
+// startableImage adds the image of the runs created by createRun to a fake daemon, so
+// that they can be started
+func startableImage(t *testing.T) *dockertest.Daemon {
+	t.Helper()
+	daemon := dockertest.New(t)
+	daemon.AddImage(dockertest.Image{
+		RepoTags: []string{"gorun-test:1.0"},
+		Labels:   map[string]string{"org.toolspec.spec": "tools:\n  echo:\n    title: Echo\n    description: Echoes\n"},
+	})
+	for key, value := range map[string]any{
+		"data_mode":              "copy",
+		"run.runtime":            "docker",
+		"images.spec_label":      "org.toolspec.spec",
+		"images.max_label_bytes": 1024,
+		"run.max_log_bytes":      1024,
+		"run.stats_interval":     time.Hour,
+	} {
+		viper.Set(key, value)
+	}
+	return daemon
+}
+
+// waitForRun waits until the started run left the pending, queued and running states
+func (s *testServer) waitForRun(t *testing.T, runID int64) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		current, err := s.DB.GetRun(context.Background(), db.GetRunParams{ID: runID, UserID: testUser})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if current.Status != "pending" && current.Status != "queued" && current.Status != "running" {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("the run is still %s", current.Status)
+		}
+	}
+}
+
+// concurrent starts of a run launch a single container, the other starts are refused with 409
+func TestHandleRunStartConcurrently(t *testing.T) {
+	s := newTestServer(t)
+	daemon := startableImage(t)
+	run := s.createRun(t, testUser, "pending")
+	path := fmt.Sprintf("/runs/%d/start", run.ID)
+
+	const starts = 8
+	codes := make(chan int, starts)
+	var ready sync.WaitGroup
+	ready.Add(starts)
+	for range starts {
+		go func() {
+			ready.Done()
+			ready.Wait()
+			resp := s.do(http.MethodPost, path, token(t, testUser), "")
+			if resp.Code == http.StatusConflict {
+				var body ErrorResponse
+				json.Unmarshal(resp.Body.Bytes(), &body)
+				if body.Code != CodeRunConflict {
+					t.Errorf("the refused start has the code %s, want %s", body.Code, CodeRunConflict)
+				}
+			}
+			codes <- resp.Code
+		}()
+	}
+	accepted := 0
+	for range starts {
+		switch code := <-codes; code {
+		case http.StatusAccepted:
+			accepted++
+		case http.StatusConflict:
+		default:
+			t.Errorf("a start answered %d, want 202 or 409", code)
+		}
+	}
+	if accepted != 1 {
+		t.Errorf("%d of the concurrent starts were accepted, want 1", accepted)
+	}
+
+	// the run finishes in the background
+	s.waitForRun(t, run.ID)
+	if n := daemon.Calls("create_run"); n != 1 {
+		t.Errorf("%d run containers were created, want 1", n)
+	}
+	if resp := s.do(http.MethodPost, path, token(t, testUser), ""); resp.Code != http.StatusConflict {
+		t.Errorf("starting the completed run answered %d, want 409", resp.Code)
+	}
+}
+
+// the listing leaves out the JSON columns of the runs, unless ?full=true asks for them
+func TestGetAllRunsFull(t *testing.T) {
+	s := newTestServer(t)
+	run := s.createRun(t, testUser, "finished")
+	if _, err := s.conn.Exec(`UPDATE runs SET parameters = '{"message": "hi"}', mounts = '{"/out": "/data/out"}' WHERE id = ?`, run.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	list := func(path string) map[string]json.RawMessage {
+		t.Helper()
+		resp := s.do(http.MethodGet, path, token(t, testUser), "")
+		if resp.Code != http.StatusOK {
+			t.Fatalf("%s answered %d: %s", path, resp.Code, resp.Body)
+		}
+		var body struct {
+			Runs []map[string]json.RawMessage `json:"runs"`
+		}
+		if err := json.Unmarshal(resp.Body.Bytes(), &body); err != nil {
+			t.Fatal(err)
+		}
+		if len(body.Runs) != 1 {
+			t.Fatalf("%s listed %d runs, want 1", path, len(body.Runs))
+		}
+		return body.Runs[0]
+	}
+	summary, full := list("/runs"), list("/runs?full=true")
+	for _, field := range []string{"parameters", "mounts", "options"} {
+		if _, ok := summary[field]; ok {
+			t.Errorf("the summary lists the %s of the run", field)
+		}
+		if _, ok := full[field]; !ok {
+			t.Errorf("the full listing misses the %s of the run", field)
+		}
+	}
+	for _, field := range []string{"id", "name", "status", "created_at"} {
+		if string(summary[field]) != string(full[field]) {
+			t.Errorf("the %s of the summary is %s, the full listing has %s", field, summary[field], full[field])
+		}
+	}
+	if resp := s.do(http.MethodGet, "/runs?full=yes", token(t, testUser), ""); resp.Code != http.StatusBadRequest {
+		t.Errorf("an invalid full answered %d, want 400", resp.Code)
+	}
+}
+
+// the listing and the metrics count the expired runs, and an expired run cannot be started
+func TestExpiredRuns(t *testing.T) {
+	s := newTestServer(t)
+	expired := s.createRun(t, testUser, "expired")
+	s.createRun(t, testUser, "expired")
+	s.createRun(t, testUser, "finished")
+	s.createRun(t, otherUser, "expired")
+	trashed := s.createRun(t, testUser, "expired")
+	if _, err := s.DB.TrashRun(context.Background(), trashed.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{"/runs", "/runs?status=finished"} {
+		resp := s.do(http.MethodGet, path, token(t, testUser), "")
+		var body RunsResponse
+		if err := json.Unmarshal(resp.Body.Bytes(), &body); err != nil {
+			t.Fatal(err)
+		}
+		if body.ExpiredCount != 2 {
+			t.Errorf("%s counts %d expired runs, want the 2 of the user whatever the filter", path, body.ExpiredCount)
+		}
+	}
+
+	resp := s.do(http.MethodGet, "/metrics", token(t, testAdmin), "")
+	if resp.Code != http.StatusOK {
+		t.Fatalf("the metrics answered %d: %s", resp.Code, resp.Body)
+	}
+	if !strings.Contains(resp.Body.String(), "\ngorun_expired_runs 3\n") {
+		t.Errorf("the metrics do not count the 3 expired runs outside the trash:\n%s", resp.Body)
+	}
+
+	resp = s.do(http.MethodPost, fmt.Sprintf("/runs/%d/start", expired.ID), token(t, testUser), "")
+	var body ErrorResponse
+	json.Unmarshal(resp.Body.Bytes(), &body)
+	if resp.Code != http.StatusConflict || body.Code != CodeRunExpired {
+		t.Errorf("starting the expired run answered %d with %s, want 409 with %s", resp.Code, body.Code, CodeRunExpired)
+	}
+}
+
+// metadata gorun cannot parse is passed on as raw JSON, unless it is no JSON at all
+func TestParseMetadataFieldsFallsBackToRawJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     sql.NullString
+		wantRaw string
+		wantNil bool
+	}{
+		{name: "no metadata", raw: sql.NullString{}, wantNil: true},
+		{name: "mismatched field", raw: sql.NullString{String: `{"tool": "echo", "exit_code": "zero"}`, Valid: true}, wantRaw: `{"tool": "echo", "exit_code": "zero"}`},
+		{name: "not an object", raw: sql.NullString{String: `["result.json"]`, Valid: true}, wantRaw: `["result.json"]`},
+		{name: "invalid JSON", raw: sql.NullString{String: `{"tool": `, Valid: true}, wantNil: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metadata, raw := parseMetadataFields(1, tt.raw)
+			if metadata != nil {
+				t.Errorf("the metadata is parsed as %+v", metadata)
+			}
+			if tt.wantNil && raw != nil {
+				t.Errorf("the raw metadata is %s, want none", raw)
+			}
+			if !tt.wantNil && string(raw) != tt.wantRaw {
+				t.Errorf("the raw metadata is %s, want %s", raw, tt.wantRaw)
+			}
+		})
+	}
+
+	// the known format is parsed, and not passed on as raw JSON
+	metadata, raw := parseMetadataFields(1, sql.NullString{String: `{"tool": "echo", "exit_code": 0, "unknown": {"nested": true}}`, Valid: true})
+	if metadata == nil || metadata.Tool != "echo" || raw != nil {
+		t.Errorf("the metadata is parsed as %+v with the raw %s", metadata, raw)
+	}
+}
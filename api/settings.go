@@ -0,0 +1,40 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/hydrocode-de/gorun/internal/tool"
+)
+
+// GetUserSettings responds with the defaults of the user for new runs
+func (s *Server) GetUserSettings(w http.ResponseWriter, r *http.Request) error {
+	userID := r.Header.Get("X-User-ID")
+	if userID == "" {
+		return StatusError(http.StatusUnauthorized, "User ID is required")
+	}
+
+	settings, err := tool.GetUserSettings(r.Context(), s.DB, userID)
+	if err != nil {
+		return err
+	}
+	return RespondWithJSON(w, http.StatusOK, settings)
+}
+
+// SetUserSettings replaces the defaults of the user, omitted fields are unset
+func (s *Server) SetUserSettings(w http.ResponseWriter, r *http.Request) error {
+	userID := r.Header.Get("X-User-ID")
+	if userID == "" {
+		return StatusError(http.StatusUnauthorized, "User ID is required")
+	}
+
+	var payload tool.UserSettings
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		return StatusError(http.StatusBadRequest, err.Error())
+	}
+	settings, err := tool.SetUserSettings(r.Context(), s.DB, userID, payload)
+	if err != nil {
+		return err
+	}
+	return RespondWithJSON(w, http.StatusOK, settings)
+}
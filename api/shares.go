@@ -0,0 +1,213 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/hydrocode-de/gorun/internal/audit"
+	"github.com/hydrocode-de/gorun/internal/db"
+	"github.com/hydrocode-de/gorun/internal/helper"
+	"github.com/hydrocode-de/gorun/internal/tool"
+)
+
+type RunShareResponse struct {
+	Token     string     `json:"token"`
+	RunID     int64      `json:"run_id"`
+	URL       string     `json:"url"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+type ListRunSharesResponse struct {
+	Count  int                `json:"count"`
+	Shares []RunShareResponse `json:"shares"`
+}
+
+// SharedRunResponse is the read-only view of a shared run. It leaves out the mounts
+// and data paths, which point to the host.
+type SharedRunResponse struct {
+	ID          int64                  `json:"id"`
+	Name        string                 `json:"name"`
+	Title       string                 `json:"title"`
+	Description string                 `json:"description"`
+	Image       string                 `json:"image"`
+	Parameters  map[string]interface{} `json:"parameters,omitempty"`
+	Status      string                 `json:"status"`
+	CreatedAt   time.Time              `json:"created_at"`
+	StartedAt   time.Time              `json:"started_at,omitempty"`
+	FinishedAt  time.Time              `json:"finished_at,omitempty"`
+	DurationMs  *int64                 `json:"duration_ms,omitempty"`
+	ExitCode    *int64                 `json:"exit_code,omitempty"`
+	Error       string                 `json:"error,omitempty"`
+	Results     []SharedResultFile     `json:"results"`
+}
+
+type SharedResultFile struct {
+	Name         string    `json:"name"`
+	Path         string    `json:"path"`
+	Size         int64     `json:"size"`
+	LastModified time.Time `json:"last_modified"`
+	URL          string    `json:"url"`
+}
+
+func runShareResponse(r *http.Request, share db.RunShare) RunShareResponse {
+	resp := RunShareResponse{
+		Token:     share.Token,
+		RunID:     share.RunID,
+		URL:       absoluteURL(r, "/share/"+share.Token),
+		CreatedAt: share.CreatedAt,
+	}
+	if share.ExpiresAt.Valid {
+		resp.ExpiresAt = &share.ExpiresAt.Time
+	}
+	return resp
+}
+
+// CreateRunShare creates a read-only link to a finished run, which expires after
+// ?expires_in= or never. It is revoked by DELETE /runs/{id}/shares/{token}.
+func (s *Server) CreateRunShare(w http.ResponseWriter, r *http.Request, run tool.Tool) error {
+	if run.Status != string(tool.StatusFinished) && run.Status != string(tool.StatusErrored) {
+		return StatusError(http.StatusConflict, fmt.Sprintf("the run %d has not finished yet", run.ID))
+	}
+
+	var expiresAt sql.NullTime
+	if value := r.URL.Query().Get("expires_in"); value != "" {
+		ttl, err := time.ParseDuration(value)
+		if err != nil || ttl <= 0 {
+			return StatusError(http.StatusBadRequest, fmt.Sprintf("invalid expires_in %s. Use a duration like 72h", value))
+		}
+		expiresAt = sql.NullTime{Time: time.Now().Add(ttl).UTC().Truncate(time.Second), Valid: true}
+	}
+
+	userID := r.Header.Get("X-User-ID")
+	share, err := s.DB.CreateRunShare(r.Context(), db.CreateRunShareParams{
+		Token:     helper.GetRandomString(32),
+		RunID:     run.ID,
+		UserID:    userID,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		return StatusError(http.StatusInternalServerError, err.Error())
+	}
+	s.recordAudit(r, userID, audit.ActionResultShare, fmt.Sprintf("run:%d", run.ID))
+
+	return RespondWithJSON(w, http.StatusCreated, runShareResponse(r, share))
+}
+
+func (s *Server) ListRunShares(w http.ResponseWriter, r *http.Request, run tool.Tool) error {
+	shares, err := s.DB.GetRunShares(r.Context(), run.ID)
+	if err != nil {
+		return StatusError(http.StatusInternalServerError, err.Error())
+	}
+
+	resp := ListRunSharesResponse{Count: len(shares), Shares: make([]RunShareResponse, 0, len(shares))}
+	for _, share := range shares {
+		resp.Shares = append(resp.Shares, runShareResponse(r, share))
+	}
+	return RespondWithJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) RevokeRunShare(w http.ResponseWriter, r *http.Request, run tool.Tool) error {
+	deleted, err := s.DB.DeleteRunShare(r.Context(), db.DeleteRunShareParams{
+		Token: r.PathValue("token"),
+		RunID: run.ID,
+	})
+	if err != nil {
+		return StatusError(http.StatusInternalServerError, err.Error())
+	}
+	if deleted == 0 {
+		return StatusError(http.StatusNotFound, "share not found")
+	}
+	s.recordAudit(r, r.Header.Get("X-User-ID"), audit.ActionResultUnshare, fmt.Sprintf("run:%d", run.ID))
+
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// ShareMiddleware loads the run of the share token in the path without authentication.
+// Unknown and expired tokens are not distinguished.
+func (s *Server) ShareMiddleware(handler RunHandlerFunc) HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		share, err := s.DB.GetRunShare(r.Context(), r.PathValue("token"))
+		if errors.Is(err, sql.ErrNoRows) || (err == nil && share.ExpiresAt.Valid && time.Now().After(share.ExpiresAt.Time)) {
+			return StatusError(http.StatusNotFound, "share not found")
+		}
+		if err != nil {
+			return StatusError(http.StatusInternalServerError, err.Error())
+		}
+
+		owner, err := s.DB.GetRunOwner(r.Context(), share.RunID)
+		if err != nil {
+			return StatusError(http.StatusNotFound, "share not found")
+		}
+		run, err := tool.GetRun(r.Context(), s.DB, share.RunID, owner)
+		if err != nil {
+			return err
+		}
+		// the links of a run in the trash are suspended until it is restored
+		if run.DeletedAt.Valid {
+			return StatusError(http.StatusNotFound, "share not found")
+		}
+		shared, err := tool.FromDBRun(run)
+		if err != nil {
+			return StatusError(http.StatusInternalServerError, err.Error())
+		}
+
+		r.Header.Set("X-User-ID", owner)
+		return handler(w, r, shared)
+	}
+}
+
+func (s *Server) GetSharedRun(w http.ResponseWriter, r *http.Request, run tool.Tool) error {
+	results, err := run.DescribeResults(r.Context(), s.DB, true)
+	if err != nil {
+		return StatusError(http.StatusConflict, err.Error())
+	}
+
+	resp := SharedRunResponse{
+		ID:          run.ID,
+		Name:        run.Name,
+		Title:       run.Title,
+		Description: run.Description,
+		Image:       run.Image,
+		Parameters:  run.Parameters,
+		Status:      run.Status,
+		CreatedAt:   run.CreatedAt,
+		StartedAt:   run.StartedAt,
+		FinishedAt:  run.FinishedAt,
+		DurationMs:  run.DurationMs,
+		ExitCode:    run.ExitCode,
+		Error:       run.Error,
+		Results:     make([]SharedResultFile, 0, len(results)),
+	}
+	for _, result := range results {
+		resp.Results = append(resp.Results, SharedResultFile{
+			Name:         result.Name,
+			Path:         result.RelPath,
+			Size:         result.Size,
+			LastModified: result.LastModified,
+			URL:          absoluteURL(r, fmt.Sprintf("/share/%s/files/%s", r.PathValue("token"), result.RelPath)),
+		})
+	}
+	return RespondWithJSON(w, http.StatusOK, resp)
+}
+
+// ServeSharedFile serves a single result file of the shared run. Directories are
+// listed by GET /share/{token} only.
+func (s *Server) ServeSharedFile(w http.ResponseWriter, r *http.Request, run tool.Tool) error {
+	filePath := strings.Trim(r.PathValue("path"), "/")
+	results, err := run.DescribeResults(r.Context(), s.DB, true)
+	if err != nil {
+		return StatusError(http.StatusConflict, err.Error())
+	}
+	for _, result := range results {
+		if result.RelPath == filePath {
+			return s.serveResultFile(w, r, run, result)
+		}
+	}
+	return StatusError(http.StatusNotFound, fmt.Sprintf("the result file %s was not found", filePath))
+}
@@ -0,0 +1,89 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hydrocode-de/gorun/internal/db"
+	"github.com/spf13/viper"
+)
+
+func TestListRunSharesOnlyForOwnerAndAdmins(t *testing.T) {
+	s := newTestServer(t)
+	ctx := context.Background()
+	run := s.createFinishedRun(t, testUser, map[string]string{"report.html": "<p>report</p>"})
+	project, err := s.DB.CreateProject(ctx, db.CreateProjectParams{Name: "shared", OwnerID: testUser})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DB.AddProjectMember(ctx, db.AddProjectMemberParams{ProjectID: project.ID, UserID: otherUser}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.conn.Exec("UPDATE runs SET project_id = ? WHERE id = ?", project.ID, run.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.DB.CreateRunShare(ctx, db.CreateRunShareParams{Token: "share-token", RunID: run.ID, UserID: testUser}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the project member reads the run, but not the tokens of its share links
+	if resp := s.do(http.MethodGet, fmt.Sprintf("/runs/%d", run.ID), token(t, otherUser), ""); resp.Code != http.StatusOK {
+		t.Fatalf("the project member cannot read the run: %d %s", resp.Code, resp.Body)
+	}
+	for user, want := range map[string]int{testUser: http.StatusOK, testAdmin: http.StatusOK, otherUser: http.StatusNotFound} {
+		resp := s.do(http.MethodGet, fmt.Sprintf("/runs/%d/shares", run.ID), token(t, user), "")
+		if resp.Code != want {
+			t.Errorf("%s listed the shares with %d, want %d: %s", user, resp.Code, want, resp.Body)
+		}
+	}
+}
+
+// plantSymlinks links the results secret.yaml and linked/ of the run to a file and a
+// directory outside of its /out, like a tool could do to leak files of the host
+func plantSymlinks(t *testing.T, run db.Run) {
+	t.Helper()
+	var mounts map[string]string
+	if err := json.Unmarshal([]byte(run.Mounts), &mounts); err != nil {
+		t.Fatal(err)
+	}
+	hostDir := filepath.Join(viper.GetString("mount_path"), "host")
+	if err := os.MkdirAll(hostDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(hostDir, "config.yaml"), []byte("secret: leaked"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(hostDir, "config.yaml"), filepath.Join(mounts["/out"], "secret.yaml")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(hostDir, filepath.Join(mounts["/out"], "linked")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// symlinks in the results are neither listed nor served through the unauthenticated route
+func TestServeSharedFileRefusesSymlinks(t *testing.T) {
+	s := newTestServer(t)
+	run := s.createFinishedRun(t, testUser, map[string]string{"report.html": "<p>report</p>"})
+	plantSymlinks(t, run)
+	if _, err := s.DB.CreateRunShare(context.Background(), db.CreateRunShareParams{Token: "share-token", RunID: run.ID, UserID: testUser}); err != nil {
+		t.Fatal(err)
+	}
+
+	shared := s.do(http.MethodGet, "/share/share-token", "", "")
+	if shared.Code != http.StatusOK || strings.Contains(shared.Body.String(), "secret.yaml") || strings.Contains(shared.Body.String(), "config.yaml") {
+		t.Errorf("the shared run lists the symlinks: %d %s", shared.Code, shared.Body)
+	}
+	for _, file := range []string{"secret.yaml", "linked/config.yaml"} {
+		resp := s.do(http.MethodGet, "/share/share-token/files/"+file, "", "")
+		if resp.Code != http.StatusNotFound || strings.Contains(resp.Body.String(), "leaked") {
+			t.Errorf("GET of the shared symlink %s answered %d: %s", file, resp.Code, resp.Body)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hydrocode-de/gorun/internal/audit"
+	"github.com/hydrocode-de/gorun/internal/auth"
+	"github.com/hydrocode-de/gorun/internal/files"
+	"github.com/hydrocode-de/gorun/internal/tool"
+	"github.com/spf13/viper"
+)
+
+type RunFilesIndexResponse struct {
+	Path  string             `json:"path"`
+	Count int                `json:"count"`
+	Files []files.ResultFile `json:"files"`
+}
+
+// ShareRunFilesResponse links the index of the results. Single files are shared by
+// appending their path to the URL, keeping the Query.
+type ShareRunFilesResponse struct {
+	URL       string    `json:"url"`
+	Query     string    `json:"query"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// HandleFileAccess authenticates the static result files. Besides the Authorization
+// header, the access token may be passed as ?token= for embedding, or the request
+// may carry the ?expires=&signature= of a URL created by POST /runs/{id}/files/sign.
+func (s *Server) HandleFileAccess(handler HandlerFunc) HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		query := r.URL.Query()
+		if signature := query.Get("signature"); signature != "" {
+			runID, idErr := strconv.ParseInt(r.PathValue("id"), 10, 64)
+			expires, expiresErr := strconv.ParseInt(query.Get("expires"), 10, 64)
+			if idErr != nil || expiresErr != nil || !auth.VerifyRunFiles(runID, expires, signature, viper.GetString("secret")) {
+				return StatusError(http.StatusForbidden, "the signed URL is invalid or expired")
+			}
+			// the signature is revoked by deleting the run
+			owner, err := s.DB.GetRunOwner(r.Context(), runID)
+			if err != nil {
+				return StatusError(http.StatusNotFound, "run not found")
+			}
+			// the signature grants reading the results of the run, nothing else
+			r.Header.Set("X-User-ID", owner)
+			return handler(w, r.WithContext(auth.WithScopes(r.Context(), auth.TokenScopes{Scopes: []string{auth.ScopeResultsRead}})))
+		}
+
+		if token := query.Get("token"); token != "" && r.Header.Get("Authorization") == "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		return s.HandleApiKey(handler)(w, r)
+	}
+}
+
+// ServeRunFile serves a result file of a finished run with its MIME type, or the
+// JSON index of a directory of the results. Results whose local copy was removed after
+// their upload are redirected to the object storage.
+func (s *Server) ServeRunFile(w http.ResponseWriter, r *http.Request, run tool.Tool) error {
+	filePath := strings.Trim(r.PathValue("path"), "/")
+	results, err := run.DescribeResults(r.Context(), s.DB, true)
+	if err != nil {
+		return StatusError(http.StatusConflict, err.Error())
+	}
+
+	index := make([]files.ResultFile, 0)
+	for _, result := range results {
+		if result.RelPath == filePath {
+			return s.serveResultFile(w, r, run, result)
+		}
+		if filePath == "" || strings.HasPrefix(result.RelPath, filePath+"/") {
+			index = append(index, result)
+		}
+	}
+	if len(index) == 0 {
+		return StatusError(http.StatusNotFound, fmt.Sprintf("the result file %s was not found", filePath))
+	}
+	return RespondWithJSON(w, http.StatusOK, RunFilesIndexResponse{
+		Path:  filePath,
+		Count: len(index),
+		Files: index,
+	})
+}
+
+// serveResultFile serves a result of the listing by DescribeResults
+func (s *Server) serveResultFile(w http.ResponseWriter, r *http.Request, run tool.Tool, listed files.ResultFile) error {
+	filePath := listed.RelPath
+	if listed.Storage == tool.StorageS3 {
+		return s.redirectToStoredResult(w, r, run, filePath, fmt.Errorf("the result file %s was not found: %w", filePath, tool.ErrNotFound))
+	}
+	file, result, err := run.OpenResultFile(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	// results of finished runs do not change anymore, the uploaded ones are tagged by their checksum
+	etag := fmt.Sprintf(`"%x-%x"`, result.Size, result.LastModified.UnixNano())
+	if listed.Checksum != "" {
+		etag = fmt.Sprintf(`"%s"`, listed.Checksum)
+	}
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "private, max-age=3600")
+	// the files are served inline for embedding, HTML reports must not run scripts with the origin of the API
+	w.Header().Set("Content-Security-Policy", "sandbox")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	s.recordAudit(r, r.Header.Get("X-User-ID"), audit.ActionResultDownload, fmt.Sprintf("run:%d/%s", run.ID, filePath))
+	// ServeContent sets the MIME type from the extension and answers conditional and range requests
+	http.ServeContent(w, r, result.Name, result.LastModified, file)
+	return nil
+}
+
+// ShareRunFiles creates a signed URL to the static result files of the run. It expires
+// after ?expires_in= or files.share_ttl, at most after files.share_max_ttl.
+func (s *Server) ShareRunFiles(w http.ResponseWriter, r *http.Request, run tool.Tool) error {
+	ttl := viper.GetDuration("files.share_ttl")
+	if value := r.URL.Query().Get("expires_in"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 {
+			return StatusError(http.StatusBadRequest, fmt.Sprintf("invalid expires_in %s. Use a duration like 15m", value))
+		}
+		ttl = parsed
+	}
+	if maxTTL := viper.GetDuration("files.share_max_ttl"); ttl > maxTTL {
+		return StatusError(http.StatusBadRequest, fmt.Sprintf("signed URLs may be valid for at most %s", maxTTL))
+	}
+
+	expiresAt := time.Now().Add(ttl).Truncate(time.Second)
+	signature := auth.SignRunFiles(run.ID, expiresAt, viper.GetString("secret"))
+	query := fmt.Sprintf("expires=%d&signature=%s", expiresAt.Unix(), signature)
+	s.recordAudit(r, r.Header.Get("X-User-ID"), audit.ActionResultShare, fmt.Sprintf("run:%d", run.ID))
+
+	return RespondWithJSON(w, http.StatusCreated, ShareRunFilesResponse{
+		URL:       absoluteURL(r, fmt.Sprintf("/runs/%d/files/", run.ID)) + "?" + query,
+		Query:     query,
+		ExpiresAt: expiresAt.UTC(),
+	})
+}
@@ -0,0 +1,154 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hydrocode-de/gorun/internal/db"
+	"github.com/spf13/viper"
+)
+
+func TestServeRunFileHeaders(t *testing.T) {
+	s := newTestServer(t)
+	run := s.createFinishedRun(t, testUser, map[string]string{"report.html": "<script>alert(1)</script>", "data.csv": "a,b\n"})
+	// the uploaded result is tagged with its checksum
+	err := s.DB.SetRunResult(context.Background(), db.SetRunResultParams{RunID: run.ID, RelPath: "report.html", ObjectKey: "runs/report.html", Size: 25, Checksum: "sha256:abc", MimeType: "text/html"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for file, etag := range map[string]string{"report.html": `"sha256:abc"`, "data.csv": ""} {
+		resp := s.do(http.MethodGet, fmt.Sprintf("/runs/%d/files/%s", run.ID, file), token(t, testUser), "")
+		if resp.Code != http.StatusOK {
+			t.Fatalf("GET %s answered %d: %s", file, resp.Code, resp.Body)
+		}
+		for header, want := range map[string]string{"Content-Security-Policy": "sandbox", "X-Content-Type-Options": "nosniff"} {
+			if got := resp.Header().Get(header); got != want {
+				t.Errorf("%s of %s is %q, want %q", header, file, got, want)
+			}
+		}
+		got := resp.Header().Get("ETag")
+		if got == "" || (etag != "" && got != etag) {
+			t.Errorf("the ETag of %s is %q, want %q", file, got, etag)
+		}
+		if cached := s.do(http.MethodGet, fmt.Sprintf("/runs/%d/files/%s", run.ID, file), token(t, testUser), "", "If-None-Match", got); cached.Code != http.StatusNotModified {
+			t.Errorf("the conditional GET of %s answered %d, want %d", file, cached.Code, http.StatusNotModified)
+		}
+	}
+}
+
+func TestServeSharedFileHeaders(t *testing.T) {
+	s := newTestServer(t)
+	run := s.createFinishedRun(t, testUser, map[string]string{"report.html": "<script>alert(1)</script>"})
+	if _, err := s.DB.CreateRunShare(context.Background(), db.CreateRunShareParams{Token: "share-token", RunID: run.ID, UserID: testUser}); err != nil {
+		t.Fatal(err)
+	}
+
+	resp := s.do(http.MethodGet, "/share/share-token/files/report.html", "", "")
+	if resp.Code != http.StatusOK {
+		t.Fatalf("GET of the shared file answered %d: %s", resp.Code, resp.Body)
+	}
+	if csp := resp.Header().Get("Content-Security-Policy"); csp != "sandbox" {
+		t.Errorf("the shared file has the Content-Security-Policy %q, want sandbox", csp)
+	}
+	if sniff := resp.Header().Get("X-Content-Type-Options"); sniff != "nosniff" {
+		t.Errorf("the shared file has the X-Content-Type-Options %q, want nosniff", sniff)
+	}
+}
+
+// uploadedResult records the upload of a result whose local copy was removed
+func uploadedResult(t *testing.T, s *testServer, runID int64, relPath string) {
+	t.Helper()
+	viper.Set("storage.s3.endpoint", "https://s3.example.org")
+	viper.Set("storage.s3.bucket", "results")
+	viper.Set("storage.s3.region", "us-east-1")
+	viper.Set("storage.s3.path_style", true)
+	viper.Set("storage.s3.presign_expiry", time.Hour)
+	err := s.DB.SetRunResult(context.Background(), db.SetRunResultParams{RunID: runID, RelPath: relPath, ObjectKey: "runs/" + relPath, Size: 4, Checksum: "sha256:abc", MimeType: "text/csv"})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestServeRunFileRedirectsUploadedResults(t *testing.T) {
+	s := newTestServer(t)
+	run := s.createFinishedRun(t, testUser, map[string]string{"local.txt": "data"})
+	uploadedResult(t, s, run.ID, "stored/data.csv")
+
+	index := s.do(http.MethodGet, fmt.Sprintf("/runs/%d/files/stored", run.ID), token(t, testUser), "")
+	if index.Code != http.StatusOK || !strings.Contains(index.Body.String(), "stored/data.csv") {
+		t.Errorf("the index does not list the uploaded result: %d %s", index.Code, index.Body)
+	}
+	resp := s.do(http.MethodGet, fmt.Sprintf("/runs/%d/files/stored/data.csv", run.ID), token(t, testUser), "")
+	if resp.Code != http.StatusFound || !strings.HasPrefix(resp.Header().Get("Location"), "https://s3.example.org/") {
+		t.Fatalf("GET of the uploaded result answered %d with the location %q", resp.Code, resp.Header().Get("Location"))
+	}
+}
+
+func TestSharedRunListsUploadedResults(t *testing.T) {
+	s := newTestServer(t)
+	run := s.createFinishedRun(t, testUser, map[string]string{"local.txt": "data"})
+	uploadedResult(t, s, run.ID, "data.csv")
+	if _, err := s.DB.CreateRunShare(context.Background(), db.CreateRunShareParams{Token: "share-token", RunID: run.ID, UserID: testUser}); err != nil {
+		t.Fatal(err)
+	}
+
+	shared := s.do(http.MethodGet, "/share/share-token", "", "")
+	if shared.Code != http.StatusOK || !strings.Contains(shared.Body.String(), "/share/share-token/files/data.csv") {
+		t.Errorf("the shared run does not list the uploaded result: %d %s", shared.Code, shared.Body)
+	}
+	resp := s.do(http.MethodGet, "/share/share-token/files/data.csv", "", "")
+	if resp.Code != http.StatusFound || !strings.HasPrefix(resp.Header().Get("Location"), "https://s3.example.org/") {
+		t.Fatalf("GET of the shared uploaded result answered %d with the location %q", resp.Code, resp.Header().Get("Location"))
+	}
+	if missing := s.do(http.MethodGet, "/share/share-token/files/missing.csv", "", ""); missing.Code != http.StatusNotFound {
+		t.Errorf("GET of a missing shared file answered %d, want %d", missing.Code, http.StatusNotFound)
+	}
+}
+
+// the symlinks planted in the results are not served by any route reading the result files
+func TestServeRunFileRefusesSymlinks(t *testing.T) {
+	s := newTestServer(t)
+	run := s.createFinishedRun(t, testUser, map[string]string{"report.html": "<p>report</p>"})
+	plantSymlinks(t, run)
+	signed := s.do(http.MethodPost, fmt.Sprintf("/runs/%d/files/sign", run.ID), token(t, testUser), "")
+	var share ShareRunFilesResponse
+	if err := json.Unmarshal(signed.Body.Bytes(), &share); err != nil || signed.Code != http.StatusCreated {
+		t.Fatalf("signing the files answered %d: %s", signed.Code, signed.Body)
+	}
+
+	access := map[string]func(file string) *httptest.ResponseRecorder{
+		"signed URL": func(file string) *httptest.ResponseRecorder {
+			return s.do(http.MethodGet, fmt.Sprintf("/runs/%d/files/%s?%s", run.ID, file, share.Query), "", "")
+		},
+		"token query": func(file string) *httptest.ResponseRecorder {
+			return s.do(http.MethodGet, fmt.Sprintf("/runs/%d/files/%s?token=%s", run.ID, file, token(t, testUser)), "", "")
+		},
+		"download": func(file string) *httptest.ResponseRecorder {
+			return s.do(http.MethodGet, fmt.Sprintf("/runs/%d/results/%s", run.ID, url.PathEscape(file)), token(t, testUser), "")
+		},
+		"preview": func(file string) *httptest.ResponseRecorder {
+			return s.do(http.MethodGet, fmt.Sprintf("/runs/%d/results/%s/preview", run.ID, url.PathEscape(file)), token(t, testUser), "")
+		},
+	}
+	for name, get := range access {
+		t.Run(name, func(t *testing.T) {
+			if resp := get("report.html"); resp.Code != http.StatusOK {
+				t.Fatalf("GET of the result answered %d: %s", resp.Code, resp.Body)
+			}
+			for _, file := range []string{"secret.yaml", "linked/config.yaml"} {
+				resp := get(file)
+				if resp.Code != http.StatusNotFound || strings.Contains(resp.Body.String(), "leaked") {
+					t.Errorf("GET of the symlink %s answered %d: %s", file, resp.Code, resp.Body)
+				}
+			}
+		})
+	}
+}
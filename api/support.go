@@ -0,0 +1,50 @@
+package api
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/hydrocode-de/gorun/internal/audit"
+	"github.com/hydrocode-de/gorun/internal/support"
+)
+
+// GetSupportBundle sends admins a redacted zip of the configuration, health and logs of the
+// server, with the detail, events and log tails of the run given as run_id
+func (s *Server) GetSupportBundle(w http.ResponseWriter, r *http.Request) error {
+	userID := r.Header.Get("X-User-ID")
+	user, err := s.DB.GetUserByID(r.Context(), userID)
+	if err != nil || !user.IsAdmin {
+		return StatusError(http.StatusForbidden, "only admins may create support bundles")
+	}
+
+	var opts support.Options
+	if runID := r.URL.Query().Get("run_id"); runID != "" {
+		opts.RunID, err = strconv.ParseInt(runID, 10, 64)
+		if err != nil || opts.RunID <= 0 {
+			return StatusError(http.StatusBadRequest, fmt.Sprintf("invalid run_id %q", runID))
+		}
+	}
+
+	// the bundle is built first, so that a failure is still answered as JSON
+	var bundle bytes.Buffer
+	if err := support.Build(r.Context(), s.DB, opts, &bundle); err != nil {
+		if errors.Is(err, support.ErrBusy) {
+			w.Header().Set("Retry-After", "10")
+			return StatusError(http.StatusTooManyRequests, err.Error())
+		}
+		return err
+	}
+	s.recordAudit(r, userID, audit.ActionSupportBundle, opts.Target())
+
+	filename := fmt.Sprintf("gorun-support-%s.zip", time.Now().Format("20060102-150405"))
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", contentDisposition("attachment", filename))
+	w.Header().Set("Content-Length", strconv.Itoa(bundle.Len()))
+	w.WriteHeader(http.StatusOK)
+	w.Write(bundle.Bytes())
+	return nil
+}
@@ -0,0 +1,76 @@
+package api
+
+import (
+	"fmt"
+	"html/template"
+	"io/fs"
+	"net/http"
+
+	"github.com/hydrocode-de/gorun/internal/frontend"
+	"github.com/spf13/viper"
+)
+
+// UIConfig tells the UI where the API is and which features the server has enabled
+type UIConfig struct {
+	BasePath string          `json:"base_path"`
+	Version  string          `json:"version"`
+	Features map[string]bool `json:"features"`
+}
+
+var uiIndex = template.Must(template.ParseFS(frontend.GetUI(), "index.html"))
+
+func uiConfig(r *http.Request) UIConfig {
+	return UIConfig{
+		BasePath: linkPrefix(r),
+		Version:  frontend.UIVersion(),
+		Features: map[string]bool{
+			"no_auth":  viper.GetBool("no_auth"),
+			"projects": true,
+			"trash":    viper.GetDuration("run.trash_retention") > 0,
+		},
+	}
+}
+
+// GetUIConfig serves /ui-config.json
+func GetUIConfig(w http.ResponseWriter, r *http.Request) error {
+	w.Header().Set("Cache-Control", "no-cache")
+	return RespondWithJSON(w, http.StatusOK, uiConfig(r))
+}
+
+// ServeUI serves the index of the UI. It is never cached, as it links the assets of the
+// current version.
+func ServeUI(w http.ResponseWriter, r *http.Request) error {
+	config := uiConfig(r)
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	err := uiIndex.Execute(w, map[string]interface{}{
+		"Assets": config.BasePath + "/ui/" + config.Version,
+		"Config": config,
+	})
+	if err != nil {
+		return fmt.Errorf("could not render the UI: %w", err)
+	}
+	return nil
+}
+
+// ServeUIAsset serves the files of the UI below /ui/{version}/. The version in the
+// path busts the caches, so assets of the current version are cached for a year.
+// Assets requested with an outdated version are served but not cached.
+func ServeUIAsset(w http.ResponseWriter, r *http.Request) error {
+	name := r.PathValue("file")
+	if name == "index.html" {
+		http.NotFound(w, r)
+		return nil
+	}
+	if _, err := fs.Stat(frontend.GetUI(), name); err != nil {
+		http.NotFound(w, r)
+		return nil
+	}
+	if r.PathValue("version") == frontend.UIVersion() {
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	} else {
+		w.Header().Set("Cache-Control", "no-cache")
+	}
+	http.ServeFileFS(w, r, frontend.GetUI(), name)
+	return nil
+}
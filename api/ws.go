@@ -0,0 +1,184 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/hydrocode-de/gorun/internal/auth"
+	"github.com/hydrocode-de/gorun/internal/events"
+	"github.com/hydrocode-de/gorun/internal/tool"
+	"github.com/hydrocode-de/gorun/internal/websocket"
+	"github.com/spf13/viper"
+)
+
+// the channels a single websocket may subscribe to
+const maxWebSocketChannels = 100
+
+// WebSocketRequest is sent by the client to subscribe to or unsubscribe from a channel
+type WebSocketRequest struct {
+	Action  string `json:"action"`
+	Channel string `json:"channel"`
+}
+
+// HandleWebSocketAuth authenticates the upgrade. Browsers cannot set headers on a
+// websocket, so the access token may be passed as ?token= instead.
+func (s *Server) HandleWebSocketAuth(handler HandlerFunc) HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		if token := r.URL.Query().Get("token"); token != "" && r.Header.Get("Authorization") == "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		return s.HandleApiKey(handler)(w, r)
+	}
+}
+
+// HandleWebSocket upgrades to a websocket, on which the client subscribes to the
+// run:{id}:status, run:{id}:logs and run:{id}:stats channels of the runs it may read
+func (s *Server) HandleWebSocket(w http.ResponseWriter, r *http.Request) error {
+	userID := r.Header.Get("X-User-ID")
+	if userID == "" {
+		return StatusError(http.StatusUnauthorized, "User ID is required")
+	}
+	conn, err := websocket.Upgrade(w, r)
+	if err != nil {
+		requestLogger(r).Printf("websocket upgrade failed: %v", err)
+		return nil
+	}
+	subscriber := events.NewSubscriber(viper.GetInt("ws.buffer"))
+	defer subscriber.Close()
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	// the client has to answer the pings, or send anything else, within two intervals
+	interval := viper.GetDuration("ws.ping_interval")
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+	alive := func() {
+		conn.SetReadDeadline(time.Now().Add(2 * interval))
+	}
+	alive()
+	conn.OnPong = alive
+	go pingWebSocket(ctx, conn, interval)
+	go forwardEvents(ctx, cancel, conn, subscriber)
+
+	for {
+		raw, err := conn.ReadMessage()
+		if err != nil {
+			if !errors.Is(err, websocket.ErrClosed) {
+				requestLogger(r).Printf("closing the websocket of user %s: %v", userID, err)
+			}
+			break
+		}
+		alive()
+		var request WebSocketRequest
+		if err := json.Unmarshal(raw, &request); err != nil {
+			sendWebSocket(conn, events.Message{Type: "error", Data: "the message has to be a JSON object with action and channel"})
+			continue
+		}
+		s.handleWebSocketRequest(r, conn, subscriber, userID, request)
+	}
+	cancel()
+	conn.Close(websocket.CloseNormal, "")
+	return nil
+}
+
+func (s *Server) handleWebSocketRequest(r *http.Request, conn *websocket.Conn, subscriber *events.Subscriber, userID string, request WebSocketRequest) {
+	reply := events.Message{Channel: request.Channel, Time: time.Now().UTC()}
+	switch request.Action {
+	case "subscribe":
+		data, err := s.authorizeChannel(r, userID, request.Channel)
+		if err == nil && subscriber.Channels() >= maxWebSocketChannels {
+			err = fmt.Errorf("a websocket may subscribe to at most %d channels", maxWebSocketChannels)
+		}
+		if err != nil {
+			reply.Type, reply.Data = "error", err.Error()
+			break
+		}
+		subscriber.Subscribe(request.Channel)
+		reply.Type, reply.Data = "subscribed", data
+	case "unsubscribe":
+		subscriber.Unsubscribe(request.Channel)
+		reply.Type = "unsubscribed"
+	default:
+		reply.Type, reply.Data = "error", fmt.Sprintf("unknown action %q, use subscribe or unsubscribe", request.Action)
+	}
+	sendWebSocket(conn, reply)
+}
+
+// authorizeChannel checks that the user may read the run of the channel. Logs are part of
+// the results and need the results:read scope. The status channel replies with the
+// current status of the run.
+func (s *Server) authorizeChannel(r *http.Request, userID string, channel string) (interface{}, error) {
+	runID, topic, err := events.ParseRunChannel(channel)
+	if err != nil {
+		return nil, err
+	}
+	if topic == events.TopicLogs && !auth.HasScope(r.Context(), auth.ScopeResultsRead) {
+		return nil, fmt.Errorf("the access token lacks the %s scope", auth.ScopeResultsRead)
+	}
+	run, err := tool.GetVisibleRun(r.Context(), s.DB, runID, userID)
+	if err == nil && run.DeletedAt.Valid {
+		err = fmt.Errorf("the run %d is in the trash, restore it first", runID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if topic == events.TopicStatus {
+		return map[string]string{"status": run.Status}, nil
+	}
+	return nil, nil
+}
+
+func sendWebSocket(conn *websocket.Conn, message events.Message) error {
+	if message.Time.IsZero() {
+		message.Time = time.Now().UTC()
+	}
+	payload, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	return conn.WriteText(payload)
+}
+
+// forwardEvents writes the messages of the subscriber to the websocket. A client too
+// slow to keep up is told how many messages were dropped.
+func forwardEvents(ctx context.Context, cancel context.CancelFunc, conn *websocket.Conn, subscriber *events.Subscriber) {
+	defer cancel()
+	for {
+		messages, dropped, err := subscriber.Next(ctx)
+		if err != nil {
+			return
+		}
+		if dropped > 0 {
+			if sendWebSocket(conn, events.Message{Type: "dropped", Data: map[string]int{"count": dropped}}) != nil {
+				conn.Close(websocket.CloseGoingAway, "")
+				return
+			}
+		}
+		for _, message := range messages {
+			if sendWebSocket(conn, message) != nil {
+				conn.Close(websocket.CloseGoingAway, "")
+				return
+			}
+		}
+	}
+}
+
+func pingWebSocket(ctx context.Context, conn *websocket.Conn, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if conn.Ping() != nil {
+				return
+			}
+		}
+	}
+}
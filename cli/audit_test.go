@@ -0,0 +1,71 @@
+package cli
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hydrocode-de/gorun/internal/audit"
+	"github.com/hydrocode-de/gorun/internal/db"
+	"github.com/spf13/cobra"
+)
+
+// runCommand runs the command like cobra does after parsing its flags
+func runCommand(cmd *cobra.Command, args ...string) {
+	cmd.SetContext(context.Background())
+	cmd.Run(cmd, args)
+}
+
+// the actions of admins on the command line leave an entry with the cli as remote address
+func TestCLIActionsAreAudited(t *testing.T) {
+	loadTestConfig(t, nil)
+	t.Cleanup(func() { password, isAdmin, delete, resetLimit = "", false, false, false })
+
+	password = "a password"
+	runCommand(createUserCmd, "carol@example.org")
+	carol, err := application.DB.GetUserByEmail(context.Background(), "carol@example.org")
+	if err != nil {
+		t.Fatalf("the user was not created: %v", err)
+	}
+
+	steps := []struct {
+		name   string
+		run    func()
+		action audit.Action
+		target string
+	}{
+		{name: "user create", run: func() {}, action: audit.ActionUserCreate, target: "user:" + carol.ID + " admin=false"},
+		{name: "password", run: func() { runCommand(userCmd, carol.ID) }, action: audit.ActionUserPassword, target: "user:" + carol.ID},
+		{name: "rate limit", run: func() {
+			password = ""
+			setFlag(t, userCmd, "runs-per-minute", "5")
+			runCommand(userCmd, carol.ID)
+		}, action: audit.ActionUserRateLimit, target: "user:" + carol.ID + " runs_per_minute=5"},
+		{name: "rate limit reset", run: func() {
+			userCmd.Flag("runs-per-minute").Changed = false
+			resetLimit = true
+			runCommand(userCmd, carol.ID)
+		}, action: audit.ActionUserRateLimit, target: "user:" + carol.ID + " reset"},
+		{name: "user delete", run: func() {
+			resetLimit, delete = false, true
+			runCommand(userCmd, carol.ID)
+		}, action: audit.ActionUserDelete, target: "user:" + carol.ID},
+		{name: "image allow", run: func() { runCommand(allowImageCmd, "ghcr.io/org/*") }, action: audit.ActionImageAllow, target: "image:ghcr.io/org/*"},
+		{name: "image deny", run: func() { runCommand(denyImageCmd, "ghcr.io/org/*") }, action: audit.ActionImageDeny, target: "image:ghcr.io/org/*"},
+	}
+	for _, step := range steps {
+		step.run()
+		entries, err := application.DB.GetAuditLog(context.Background(), db.GetAuditLogParams{
+			UserID:      "",
+			Action:      "",
+			WindowStart: "0001-01-01 00:00:00",
+			WindowEnd:   "9999-12-31 23:59:59",
+			Limit:       1,
+		})
+		if err != nil {
+			t.Fatalf("cannot read the audit log: %v", err)
+		}
+		if len(entries) == 0 || entries[0].Action != string(step.action) || entries[0].Target != step.target || entries[0].RemoteAddr != audit.RemoteCLI {
+			t.Errorf("the %s command left the entries %+v, want %s on %s", step.name, entries, step.action, step.target)
+		}
+	}
+}
@@ -5,11 +5,18 @@ import (
 	"fmt"
 	"os"
 	"path"
+	"strings"
 	"time"
 
+	"github.com/hydrocode-de/gorun/api"
+	"github.com/hydrocode-de/gorun/internal/app"
 	"github.com/hydrocode-de/gorun/internal/auth"
 	"github.com/hydrocode-de/gorun/internal/cache"
 	"github.com/hydrocode-de/gorun/internal/db"
+	"github.com/hydrocode-de/gorun/internal/files"
+	"github.com/hydrocode-de/gorun/internal/storage"
+	"github.com/hydrocode-de/gorun/internal/tool"
+	"github.com/hydrocode-de/gorun/internal/toolImage"
 	"github.com/hydrocode-de/gorun/sql"
 	"github.com/hydrocode-de/gorun/version"
 	"github.com/joho/godotenv"
@@ -27,6 +34,9 @@ const banner = `
 `
 
 var debug bool
+
+// application holds the database and the tool cache of this gorun instance
+var application *app.App
 var rootCmd = &cobra.Command{
 	Use:   "gorun",
 	Short: "GoRun operates tool-spec compliant research tools",
@@ -55,6 +65,7 @@ func init() {
 	rootCmd.PersistentFlags().BoolVar(&debug, "debug", false, "enable debug output")
 	rootCmd.PersistentFlags().String("path", "", "the path to use as the gorun base directory")
 	rootCmd.PersistentFlags().String("db_path", "", "the path to use as the database file")
+	rootCmd.PersistentFlags().String("config", "", "the config file to use, defaults to config.yaml in the gorun path")
 
 	rootCmd.PersistentFlags().BoolP("version", "v", false, "print the version number of gorun")
 	rootCmd.PersistentPreRun = func(cmd *cobra.Command, args []string) {
@@ -67,6 +78,7 @@ func init() {
 	viper.BindPFlag("debug", rootCmd.PersistentFlags().Lookup("debug"))
 	viper.BindPFlag("path", rootCmd.PersistentFlags().Lookup("path"))
 	viper.BindPFlag("db_path", rootCmd.PersistentFlags().Lookup("db_path"))
+	viper.BindPFlag("config", rootCmd.PersistentFlags().Lookup("config"))
 }
 
 func initApplicationConfig() {
@@ -74,23 +86,148 @@ func initApplicationConfig() {
 	godotenv.Load()
 
 	viper.SetEnvPrefix("gorun")
+	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
 	viper.AutomaticEnv()
 
 	viper.SetDefault("port", 8080)
 	viper.SetDefault("host", "127.0.0.1")
 	viper.SetDefault("no_auth", false)
+	viper.SetDefault("server.base_path", "")
+	viper.SetDefault("server.listen", "")
+	viper.SetDefault("server.trusted_proxies", []string{})
+	viper.SetDefault("ui.enabled", true)
+	viper.SetDefault("ws.ping_interval", 30*time.Second)
+	viper.SetDefault("ws.buffer", 256)
+	viper.SetDefault("tls.cert_file", "")
+	viper.SetDefault("tls.key_file", "")
+	viper.SetDefault("tls.self_signed", false)
+	viper.SetDefault("tls.redirect_port", 0)
 	viper.SetDefault("debug", false)
 	viper.SetDefault("path", path.Join(os.Getenv("HOME"), ".gorun"))
-	viper.SetDefault("db_path", path.Join(viper.GetString("path"), "gorun.db"))
-	viper.SetDefault("mount_path", path.Join(viper.GetString("path"), "mounts"))
+	setPathDefaults()
 	viper.SetDefault("temp_path", path.Join(os.TempDir(), "gorun"))
 	viper.SetDefault("max_upload_size", 1024*1024*1024*2) // 2GB
 	viper.SetDefault("max_temp_age", 12*time.Hour)
 	viper.SetDefault("secret", "")
+	viper.SetDefault("scratch_mode", "host")
+	viper.SetDefault("max_scratch_gb", 100)
+	viper.SetDefault("max_dataset_files", 1000)
+	viper.SetDefault("datasets.max_inline_bytes", 1024*1024) // 1MB
+	viper.SetDefault("datasets.zenodo_api", "https://zenodo.org/api")
+	viper.SetDefault("datasets.doi_resolver", "https://doi.org")
+	viper.SetDefault("datasets.doi_timeout", 30*time.Minute)
+	viper.SetDefault("data_mode", "copy")
+	viper.SetDefault("files.share_ttl", 15*time.Minute)
+	viper.SetDefault("files.share_max_ttl", 24*time.Hour)
+	viper.SetDefault("files.run_dir_template", files.DefaultRunDirTemplate)
+	viper.SetDefault("files.prune_orphans", true)
+	viper.SetDefault("files.orphan_grace_period", 24*time.Hour)
+	viper.SetDefault("security.disallow_host_mounts", false)
+	viper.SetDefault("run.user", "")
+	viper.SetDefault("run.allow_emulation", false)
+	viper.SetDefault("run.allow_user_command_override", false)
+	viper.SetDefault("run.runtime", "docker")
+	viper.SetDefault("apptainer.binary", "apptainer")
+	viper.SetDefault("runtime.ssh.host", "")
+	viper.SetDefault("runtime.ssh.port", 22)
+	viper.SetDefault("runtime.ssh.user", "")
+	viper.SetDefault("runtime.ssh.key_file", "")
+	viper.SetDefault("runtime.ssh.insecure_ignore_host_key", false)
+	if home, err := os.UserHomeDir(); err == nil {
+		viper.SetDefault("runtime.ssh.known_hosts", path.Join(home, ".ssh", "known_hosts"))
+	}
+	viper.SetDefault("runtime.ssh.docker_socket", "/var/run/docker.sock")
+	viper.SetDefault("runtime.ssh.work_path", "/tmp/gorun")
+	viper.SetDefault("runtime.ssh.connect_timeout", 10*time.Second)
+	viper.SetDefault("runtime.ssh.keepalive_interval", 30*time.Second)
+	viper.SetDefault("runtime.ssh.reconnect_attempts", 5)
+	viper.SetDefault("run.spec_entry", "auto")
+	viper.SetDefault("gotap.probe_names", []string{"gotap"})
+	viper.SetDefault("gotap.run_args", []string{})
+	viper.SetDefault("run.use_prepare", false)
+	viper.SetDefault("run.param_env_max_bytes", 4096)
+	viper.SetDefault("run.interactive_commands", []string{"sh", "bash", "ash", "zsh", "python", "python3", "R", "node", "octave"})
+	viper.SetDefault("run.max_retries", 3)
+	viper.SetDefault("run.max_concurrent", 0)
+	viper.SetDefault("run.priority_aging", 10*time.Minute)
+	viper.SetDefault("run.strict_outputs", false)
+	viper.SetDefault("results.query_max_rows", 1000)
+	viper.SetDefault("results.query_max_bytes", 512*1024*1024) // 512MB
+	viper.SetDefault("previews.enabled", true)
+	viper.SetDefault("previews.timeout", time.Minute)
+	viper.SetDefault("previews.max_bytes", 50*1024*1024) // 50MB
+	viper.SetDefault("run.retry_backoff", 10*time.Second)
+	viper.SetDefault("run.max_log_bytes", 100*1024*1024) // 100MB
+	viper.SetDefault("run.log_tail_lines", 100)
+	viper.SetDefault("run.stats_interval", 10*time.Second)
+	viper.SetDefault("run.watchdog_interval", 30*time.Second)
+	viper.SetDefault("run.max_runtime", 0)
+	viper.SetDefault("run.stall_threshold", time.Hour)
+	viper.SetDefault("run.max_output_bytes", 0)
+	viper.SetDefault("run.trash_retention", 7*24*time.Hour)
+	viper.SetDefault("run.pending_ttl", 0)
+	viper.SetDefault("run.expired_inputs", tool.ExpiredInputsDelete)
+	viper.SetDefault("run.reap_containers", true)
+	viper.SetDefault("run.reap_grace_period", time.Hour)
+	viper.SetDefault("auth.require_scopes", false)
+	viper.SetDefault("limits.runs_per_minute", 0)
+	viper.SetDefault("audit.retention", 0)
+	viper.SetDefault("support.max_bytes", 20*1024*1024) // 20MB
+	viper.SetDefault("storage.s3.endpoint", "")
+	viper.SetDefault("storage.s3.public_endpoint", "")
+	viper.SetDefault("storage.s3.region", "us-east-1")
+	viper.SetDefault("storage.s3.bucket", "")
+	viper.SetDefault("storage.s3.access_key", "")
+	viper.SetDefault("storage.s3.secret_key", "")
+	viper.SetDefault("storage.s3.path_style", true)
+	viper.SetDefault("storage.s3.timeout", 30*time.Minute)
+	viper.SetDefault("storage.s3.presign_expiry", 15*time.Minute)
+	viper.SetDefault("storage.s3.delete_local_after", 0)
+	viper.SetDefault("support.timeout", 30*time.Second)
+	viper.SetDefault("notify.base_url", "")
+	viper.SetDefault("notify.smtp.host", "")
+	viper.SetDefault("notify.smtp.port", 587)
+	viper.SetDefault("notify.smtp.username", "")
+	viper.SetDefault("notify.smtp.password", "")
+	viper.SetDefault("notify.smtp.from", "")
+	viper.SetDefault("notify.slack.webhook_url", "")
+	viper.SetDefault("notify.matrix.homeserver", "")
+	viper.SetDefault("notify.matrix.room_id", "")
+	viper.SetDefault("notify.matrix.access_token", "")
+	viper.SetDefault("notify.digest_threshold", 5)
+	viper.SetDefault("images.allowlist", []string{})
+	viper.SetDefault("images.require_digest", false)
+	viper.SetDefault("scan.trivy_path", "")
+	viper.SetDefault("scan.trivy_server", "")
+	viper.SetDefault("scan.on_discovery", true)
+	viper.SetDefault("scan.block_severity", "")
+	viper.SetDefault("scan.probe_timeout", 30*time.Second)
+	viper.SetDefault("tools.load_on_demand", true)
+	viper.SetDefault("tools.load_timeout", 2*time.Minute)
+	viper.SetDefault("tools.check_image_id", true)
+	viper.SetDefault("catalog.repositories", []string{})
+	viper.SetDefault("catalog.interval", time.Hour)
+	viper.SetDefault("catalog.timeout", 5*time.Minute)
+	viper.SetDefault("catalog.insecure_registries", []string{})
+	viper.SetDefault("catalog.index_url", "")
+	viper.SetDefault("images.pull_missing", true)
+	viper.SetDefault("images.spec_label", "org.toolspec.spec")
+	viper.SetDefault("images.citation_label", "org.toolspec.citation")
+	viper.SetDefault("images.max_label_bytes", 256*1024) // 256KB
+	viper.SetDefault("validation.coerce_types", false)
+	// run containers are hardened unless the options are disabled explicitly
+	viper.SetDefault("security.drop_all_caps", true)
+	viper.SetDefault("security.cap_add", []string{})
+	viper.SetDefault("security.no_new_privileges", true)
+	viper.SetDefault("security.seccomp_profile", "")
+	viper.SetDefault("security.read_only_rootfs", false)
+	viper.SetDefault("security.pids_limit", 0)
 
-	c := &cache.Cache{}
-	c.Reset()
-	viper.Set("cache", c)
+	// the config file has precedence over the defaults only
+	cobra.CheckErr(loadConfigFile())
+	if viper.InConfig("path") {
+		setPathDefaults()
+	}
 
 	err := os.MkdirAll(viper.GetString("path"), 0755)
 	if err != nil {
@@ -119,37 +256,83 @@ func initApplicationConfig() {
 	// Initialize the database driver
 	drv, err := sql.CreateDB(viper.GetString("db_path"))
 	if err != nil {
-		cobra.CheckErr(fmt.Errorf("failed to create database driver: %w", err))
+		cobra.CheckErr(fmt.Errorf("failed to create the database %s: %w. Run 'gorun init' to set up a new installation", viper.GetString("db_path"), err))
 	}
-	dbQueries := db.New(drv)
-	viper.Set("db", dbQueries)
+	c := &cache.Cache{}
+	c.Reset()
+	application = app.New(db.New(drv), c)
 
-	// validate the config
-	cobra.CheckErr(validateConfig())
+	// validate the config, unless the command creates or inspects it
+	if !skipsValidation() {
+		cobra.CheckErr(validateConfig())
+	}
 
 	// Print debug info if enabled
 	printViperState()
 }
 
+// commands annotated with skipValidation run without a valid configuration
+const skipValidation = "skip_validation"
+
+func skipsValidation() bool {
+	cmd, _, err := rootCmd.Find(os.Args[1:])
+	return err == nil && cmd.Annotations[skipValidation] == "true"
+}
+
+// setPathDefaults derives the default locations from the gorun path
+func setPathDefaults() {
+	viper.SetDefault("db_path", path.Join(viper.GetString("path"), "gorun.db"))
+	viper.SetDefault("mount_path", path.Join(viper.GetString("path"), "mounts"))
+	viper.SetDefault("apptainer.cache_path", path.Join(viper.GetString("path"), "sif"))
+	viper.SetDefault("datasets.cache_path", path.Join(viper.GetString("path"), "datasets"))
+}
+
 func validateConfig() error {
 	if viper.GetInt("port") == 0 {
 		return fmt.Errorf("port is required")
 	}
 
-	// check if it is a valid sqlite3 connection string
-	dbPath := viper.GetString("db_path")
-	if _, err := os.Stat(dbPath); os.IsNotExist(err) {
-		return fmt.Errorf("the database file %s does not exist", dbPath)
+	if viper.GetString("secret") == "" {
+		return fmt.Errorf("the secret is required. Run 'gorun init' to create a configuration")
 	}
 
-	if viper.GetString("secret") == "" {
-		return fmt.Errorf("the secret is required")
+	if _, err := files.ExtraMountsFromConfig(); err != nil {
+		return err
+	}
+
+	// the template is checked with a sample run, the runs would fail to be created otherwise
+	if _, err := files.RunDir(viper.GetString("files.run_dir_template"), viper.GetString("mount_path"), 1, "user", "tool"); err != nil {
+		return fmt.Errorf("invalid files.run_dir_template: %w", err)
+	}
+
+	if err := toolImage.ValidateGotapConfig(); err != nil {
+		return err
+	}
+
+	if _, err := storage.S3FromConfig(); err != nil {
+		return err
+	}
+
+	if _, err := api.TrustedProxies(); err != nil {
+		return err
+	}
+
+	switch strings.ToLower(viper.GetString("scan.block_severity")) {
+	case "", "critical", "high":
+	default:
+		return fmt.Errorf("invalid scan.block_severity %s. Use 'critical' or 'high'", viper.GetString("scan.block_severity"))
+	}
+
+	switch viper.GetString("run.expired_inputs") {
+	case tool.ExpiredInputsDelete, tool.ExpiredInputsKeep:
+	default:
+		return fmt.Errorf("invalid run.expired_inputs %s. Use 'delete' or 'keep'", viper.GetString("run.expired_inputs"))
 	}
 
 	//make sure the AdminCredentials do exist
 	ctx := context.Background()
-	if _, err := auth.GetAdminCredentials(ctx); err != nil {
-		if _, err := auth.CreateAdminCredentials(ctx); err != nil {
+	if _, err := auth.GetAdminCredentials(ctx, application.DB); err != nil {
+		if _, err := auth.CreateAdminCredentials(ctx, application.DB); err != nil {
 			return fmt.Errorf("failed to create admin credentials: %w", err)
 		}
 	}
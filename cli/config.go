@@ -0,0 +1,101 @@
+package cli
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/hydrocode-de/gorun/internal/helper"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// keys that are valid in a config file, but have no default
+var optionalConfigKeys = []string{"extra_mounts"}
+
+// configFilePath returns the file given by --config or GORUN_CONFIG,
+// or config.yaml in the gorun path
+func configFilePath() string {
+	if configFile := viper.GetString("config"); configFile != "" {
+		return configFile
+	}
+	return path.Join(viper.GetString("path"), "config.yaml")
+}
+
+// loadConfigFile merges the config file into viper. As the file has a lower precedence
+// than flags and environment variables, only defaults are overwritten.
+// Unknown keys are reported, as they are most likely typos.
+func loadConfigFile() error {
+	configFile := configFilePath()
+	if _, err := os.Stat(configFile); err != nil {
+		if os.IsNotExist(err) && viper.GetString("config") == "" {
+			return nil
+		}
+		return fmt.Errorf("failed to read the configuration %s: %w", configFile, err)
+	}
+
+	knownKeys := append(viper.AllKeys(), optionalConfigKeys...)
+	viper.SetConfigFile(configFile)
+	if err := viper.ReadInConfig(); err != nil {
+		return fmt.Errorf("failed to read the configuration %s: %w", configFile, err)
+	}
+
+	fileConfig := viper.New()
+	fileConfig.SetConfigFile(configFile)
+	if err := fileConfig.ReadInConfig(); err != nil {
+		return fmt.Errorf("failed to read the configuration %s: %w", configFile, err)
+	}
+	fileKeys := fileConfig.AllKeys()
+	sort.Strings(fileKeys)
+	for _, key := range fileKeys {
+		known := slices.ContainsFunc(knownKeys, func(knownKey string) bool {
+			return key == knownKey || strings.HasPrefix(key, knownKey+".")
+		})
+		if !known {
+			log.Printf("WARNING: unknown key %s in the configuration %s", key, configFile)
+		}
+	}
+	return nil
+}
+
+func isSecretKey(key string) bool {
+	return helper.IsSecretName(key[strings.LastIndex(key, ".")+1:])
+}
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Inspect the GoRun configuration",
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Help()
+	},
+}
+
+var configShowCmd = &cobra.Command{
+	Use:         "show",
+	Short:       "Print the effective configuration, with secrets redacted",
+	Annotations: map[string]string{skipValidation: "true"},
+	Run: func(cmd *cobra.Command, args []string) {
+		if file := viper.ConfigFileUsed(); file != "" {
+			fmt.Printf("# config file: %s\n", file)
+		}
+
+		keys := viper.AllKeys()
+		sort.Strings(keys)
+		for _, key := range keys {
+			value := viper.Get(key)
+			if isSecretKey(key) && fmt.Sprint(value) != "" {
+				value = "[redacted]"
+			}
+			fmt.Printf("%s: %v\n", key, value)
+		}
+	},
+}
+
+func init() {
+	configCmd.AddCommand(configShowCmd)
+	rootCmd.AddCommand(configCmd)
+}
@@ -0,0 +1,149 @@
+package cli
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// loadTestConfig initializes the configuration like a command does, below a temporary gorun
+// path and with the given environment
+func loadTestConfig(t *testing.T, env map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+	// the reset drops the flags bound by init
+	viper.BindPFlag("path", rootCmd.Flag("path"))
+	viper.BindPFlag("config", rootCmd.Flag("config"))
+	viper.BindPFlag("port", serveCmd.Flag("port"))
+	t.Setenv("HOME", dir)
+	t.Setenv("GORUN_PATH", dir)
+	t.Setenv("GORUN_TEMP_PATH", filepath.Join(dir, "temp"))
+	t.Setenv("GORUN_SECRET", "test-secret")
+	for key, value := range env {
+		t.Setenv(key, value)
+	}
+	initApplicationConfig()
+	return dir
+}
+
+func TestSecurityDefaults(t *testing.T) {
+	loadTestConfig(t, nil)
+	if !viper.GetBool("security.drop_all_caps") || !viper.GetBool("security.no_new_privileges") {
+		t.Errorf("run containers are not hardened by default: drop_all_caps %v, no_new_privileges %v", viper.GetBool("security.drop_all_caps"), viper.GetBool("security.no_new_privileges"))
+	}
+}
+
+func TestSecurityOptOut(t *testing.T) {
+	loadTestConfig(t, map[string]string{"GORUN_SECURITY_DROP_ALL_CAPS": "false", "GORUN_SECURITY_NO_NEW_PRIVILEGES": "false"})
+	if viper.GetBool("security.drop_all_caps") || viper.GetBool("security.no_new_privileges") {
+		t.Errorf("the hardening cannot be disabled: drop_all_caps %v, no_new_privileges %v", viper.GetBool("security.drop_all_caps"), viper.GetBool("security.no_new_privileges"))
+	}
+}
+
+// setFlag sets the flag of the command as if it was passed, until the test ends
+func setFlag(t *testing.T, cmd *cobra.Command, name string, value string) {
+	t.Helper()
+	flag := cmd.Flag(name)
+	previous := flag.Value.String()
+	if err := flag.Value.Set(value); err != nil {
+		t.Fatal(err)
+	}
+	flag.Changed = true
+	t.Cleanup(func() {
+		flag.Value.Set(previous)
+		flag.Changed = false
+	})
+}
+
+// writeConfigFile writes a config file outside the gorun path and returns its path
+func writeConfigFile(t *testing.T, name string, content string) string {
+	t.Helper()
+	configFile := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(configFile, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return configFile
+}
+
+func TestConfigPrecedence(t *testing.T) {
+	other := t.TempDir()
+	configFile := writeConfigFile(t, "config.yaml", "port: 9000\npath: "+filepath.Join(other, "file")+"\nserver:\n  base_path: /file\n")
+
+	tests := []struct {
+		name  string
+		env   map[string]string
+		flags map[string]string
+		key   string
+		want  string
+	}{
+		{name: "port default", env: map[string]string{"GORUN_CONFIG": ""}, key: "port", want: "8080"},
+		{name: "port file over default", key: "port", want: "9000"},
+		{name: "port env over file", env: map[string]string{"GORUN_PORT": "9100"}, key: "port", want: "9100"},
+		{name: "port flag over env", env: map[string]string{"GORUN_PORT": "9100"}, flags: map[string]string{"port": "9200"}, key: "port", want: "9200"},
+		{name: "path file over default", env: map[string]string{"GORUN_PATH": ""}, key: "path", want: filepath.Join(other, "file")},
+		{name: "path derived from the file", env: map[string]string{"GORUN_PATH": ""}, key: "db_path", want: filepath.Join(other, "file", "gorun.db")},
+		{name: "path env over file", env: map[string]string{"GORUN_PATH": filepath.Join(other, "env")}, key: "path", want: filepath.Join(other, "env")},
+		{name: "path flag over env", env: map[string]string{"GORUN_PATH": filepath.Join(other, "env")}, flags: map[string]string{"path": filepath.Join(other, "flag")}, key: "path", want: filepath.Join(other, "flag")},
+		{name: "nested file over default", key: "server.base_path", want: "/file"},
+		{name: "nested env over file", env: map[string]string{"GORUN_SERVER_BASE_PATH": "/env"}, key: "server.base_path", want: "/env"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := map[string]string{"GORUN_CONFIG": configFile}
+			for key, value := range tt.env {
+				env[key] = value
+			}
+			for name, value := range tt.flags {
+				cmd := serveCmd
+				if name == "path" {
+					cmd = rootCmd
+				}
+				setFlag(t, cmd, name, value)
+			}
+			loadTestConfig(t, env)
+			if got := viper.GetString(tt.key); got != tt.want {
+				t.Errorf("%s is %q, want %q", tt.key, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfigFileFormats(t *testing.T) {
+	for name, content := range map[string]string{
+		"config.yaml": "port: 9000\nrun:\n  runtime: apptainer\n",
+		"config.toml": "port = 9000\n[run]\nruntime = \"apptainer\"\n",
+	} {
+		t.Run(name, func(t *testing.T) {
+			loadTestConfig(t, map[string]string{"GORUN_CONFIG": writeConfigFile(t, name, content)})
+			if viper.GetInt("port") != 9000 || viper.GetString("run.runtime") != "apptainer" {
+				t.Errorf("the %s config is port %d and run.runtime %s", name, viper.GetInt("port"), viper.GetString("run.runtime"))
+			}
+		})
+	}
+}
+
+func TestConfigFileWarnsAboutUnknownKeys(t *testing.T) {
+	var output bytes.Buffer
+	log.SetOutput(&output)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	// gorun has no MCP server, so the mcp section is as unknown as a typo
+	configFile := writeConfigFile(t, "config.yaml", "port: 9000\nprot: 9001\nmcp:\n  enabled: true\nrun:\n  runtim: docker\n")
+	loadTestConfig(t, map[string]string{"GORUN_CONFIG": configFile})
+	for _, key := range []string{"prot", "mcp.enabled", "run.runtim"} {
+		if !strings.Contains(output.String(), "unknown key "+key+" ") {
+			t.Errorf("no warning about the unknown key %s: %s", key, output.String())
+		}
+	}
+	if strings.Contains(output.String(), "unknown key port ") {
+		t.Errorf("the known key port was reported: %s", output.String())
+	}
+}
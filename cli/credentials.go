@@ -3,24 +3,37 @@ package cli
 import (
 	"fmt"
 	"os"
+	"strings"
 
+	"github.com/hydrocode-de/gorun/internal/audit"
 	"github.com/hydrocode-de/gorun/internal/auth"
 	"github.com/jedib0t/go-pretty/v6/table"
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 )
 
 var (
 	refreshToken bool
 	accessToken  bool
+	tokenScopes  string
 )
 
 var credentialsCmd = &cobra.Command{
 	Use:   "credentials",
 	Short: "Show Admin credentials for GoRun",
 	Run: func(cmd *cobra.Command, args []string) {
-		credentials, err := auth.GetAdminCredentials(cmd.Context())
+		credentials, err := auth.GetAdminCredentials(cmd.Context(), application.DB)
 		cobra.CheckErr(err)
 
+		if tokenScopes != "" {
+			scopes, err := auth.ParseScopes(tokenScopes)
+			cobra.CheckErr(err)
+			response, err := auth.NewScopedJWTFromRefreshToken(cmd.Context(), application.DB, credentials.RefreshToken, viper.GetString("secret"), scopes)
+			cobra.CheckErr(err)
+			recordCLIAudit(cmd, audit.ActionTokenIssue, fmt.Sprintf("user:%s scopes=%s", credentials.UserID, strings.Join(scopes, ",")))
+			credentials.AccessToken, credentials.ExpiresAt = response.AccessToken, response.ExpiresAt
+		}
+
 		if refreshToken {
 			fmt.Println(credentials.RefreshToken)
 			return
@@ -49,6 +62,7 @@ var credentialsCmd = &cobra.Command{
 func init() {
 	credentialsCmd.Flags().BoolVar(&refreshToken, "refresh-token", false, "Show only the refresh token")
 	credentialsCmd.Flags().BoolVar(&accessToken, "access-token", false, "Show only the access token")
+	credentialsCmd.Flags().StringVar(&tokenScopes, "scopes", "", "Issue a new access token restricted to these comma separated scopes, like runs:read,results:read")
 
 	rootCmd.AddCommand(credentialsCmd)
 }
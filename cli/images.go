@@ -0,0 +1,77 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/hydrocode-de/gorun/internal/audit"
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var imagesCmd = &cobra.Command{
+	Use:   "images",
+	Short: "Manage the image allowlist of the server",
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Help()
+	},
+}
+
+var allowImageCmd = &cobra.Command{
+	Use:   "allow <pattern>",
+	Short: "Allow images matching a repository glob like ghcr.io/org/* or a digest like sha256:...",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		err := application.DB.AllowImage(cmd.Context(), args[0])
+		cobra.CheckErr(err)
+		recordCLIAudit(cmd, audit.ActionImageAllow, "image:"+args[0])
+		fmt.Printf("Images matching %s are allowed\n", args[0])
+	},
+}
+
+var denyImageCmd = &cobra.Command{
+	Use:   "deny <pattern>",
+	Short: "Remove a pattern from the image allowlist",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		removed, err := application.DB.DenyImage(cmd.Context(), args[0])
+		cobra.CheckErr(err)
+		if removed == 0 {
+			cobra.CheckErr(fmt.Errorf("the pattern %s is not on the stored allowlist. Patterns of images.allowlist have to be removed from the config", args[0]))
+		}
+		recordCLIAudit(cmd, audit.ActionImageDeny, "image:"+args[0])
+		fmt.Printf("Removed %s from the image allowlist\n", args[0])
+	},
+}
+
+var listPolicyCmd = &cobra.Command{
+	Use:   "list-policy",
+	Short: "Show the effective image policy",
+	Run: func(cmd *cobra.Command, args []string) {
+		stored, err := application.DB.GetImagePolicy(cmd.Context())
+		cobra.CheckErr(err)
+
+		t := table.NewWriter()
+		t.SetStyle(table.StyleColoredMagentaWhiteOnBlack)
+		t.AppendHeader(table.Row{"Pattern", "Source"})
+		for _, pattern := range viper.GetStringSlice("images.allowlist") {
+			t.AppendRow(table.Row{pattern, "config"})
+		}
+		for _, entry := range stored {
+			t.AppendRow(table.Row{entry.Pattern, "database"})
+		}
+		fmt.Println(t.Render())
+
+		if t.Length() == 0 {
+			fmt.Println("The allowlist is empty, all images are allowed")
+		}
+		fmt.Printf("Require digest: %v\n", viper.GetBool("images.require_digest"))
+	},
+}
+
+func init() {
+	imagesCmd.AddCommand(allowImageCmd)
+	imagesCmd.AddCommand(denyImageCmd)
+	imagesCmd.AddCommand(listPolicyCmd)
+	rootCmd.AddCommand(imagesCmd)
+}
@@ -0,0 +1,108 @@
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/hydrocode-de/gorun/internal/auth"
+	"github.com/hydrocode-de/gorun/internal/helper"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var (
+	initSecret         string
+	initNonInteractive bool
+	initForce          bool
+)
+
+var initCmd = &cobra.Command{
+	Use:         "init",
+	Short:       "Create a configuration, the database and admin credentials for GoRun",
+	Annotations: map[string]string{skipValidation: "true"},
+	Long: `Bootstraps a new GoRun installation. A random secret is generated and written
+together with host and port to config.yaml in the gorun path. The command creates
+the directories, the database and the admin credentials and prints the admin token.
+With --force, an existing configuration keeps all other settings.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		configFile := configFilePath()
+		if _, err := os.Stat(configFile); err == nil && !initForce {
+			cobra.CheckErr(fmt.Errorf("the configuration %s already exists. Use --force to overwrite it", configFile))
+		}
+
+		secret := initSecret
+		if secret == "" {
+			secret = viper.GetString("secret")
+		}
+		if secret == "" {
+			secret = helper.GetRandomString(48)
+		}
+		host := viper.GetString("host")
+		port := viper.GetInt("port")
+
+		if !initNonInteractive {
+			reader := bufio.NewReader(os.Stdin)
+			host = prompt(reader, "Host to listen on", host)
+			portValue := prompt(reader, "Port to listen on", strconv.Itoa(port))
+			parsedPort, err := strconv.Atoi(portValue)
+			if err != nil {
+				cobra.CheckErr(fmt.Errorf("the port %s is not a valid number", portValue))
+			}
+			port = parsedPort
+		}
+
+		cobra.CheckErr(writeInitConfig(configFile, secret, host, port))
+		fmt.Printf("Configuration written to %s\n", configFile)
+
+		viper.Set("secret", secret)
+		viper.Set("host", host)
+		viper.Set("port", port)
+		cobra.CheckErr(validateConfig())
+
+		credentials, err := auth.GetAdminCredentials(cmd.Context(), application.DB)
+		cobra.CheckErr(err)
+		fmt.Printf("\nAdmin user: %s\n", credentials.Email)
+		fmt.Printf("Admin access token:\n%s\n", credentials.AccessToken)
+		fmt.Println("\nStart the server with 'gorun serve'")
+	},
+}
+
+// writeInitConfig writes the secret, host and port to the config file. The other keys
+// of an existing file are kept, so that --force only replaces what init sets.
+func writeInitConfig(configFile string, secret string, host string, port int) error {
+	config := viper.New()
+	if _, err := os.Stat(configFile); err == nil {
+		config.SetConfigFile(configFile)
+		if err := config.ReadInConfig(); err != nil {
+			return fmt.Errorf("cannot read the existing configuration %s: %w. Fix or remove it before running init", configFile, err)
+		}
+	}
+	config.Set("secret", secret)
+	config.Set("host", host)
+	config.Set("port", port)
+	if err := config.WriteConfigAs(configFile); err != nil {
+		return err
+	}
+	return os.Chmod(configFile, 0600)
+}
+
+func prompt(reader *bufio.Reader, question string, defaultValue string) string {
+	fmt.Printf("%s [%s]: ", question, defaultValue)
+	answer, err := reader.ReadString('\n')
+	answer = strings.TrimSpace(answer)
+	if err != nil || answer == "" {
+		return defaultValue
+	}
+	return answer
+}
+
+func init() {
+	initCmd.Flags().StringVar(&initSecret, "secret", "", "Use this secret instead of a random one")
+	initCmd.Flags().BoolVar(&initNonInteractive, "non-interactive", false, "Do not prompt, use flags, environment and defaults")
+	initCmd.Flags().BoolVar(&initForce, "force", false, "Overwrite the secret, host and port of an existing configuration")
+
+	rootCmd.AddCommand(initCmd)
+}
@@ -0,0 +1,47 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+// init --force replaces the secret, host and port, every other setting stays
+func TestInitForceKeepsTheConfiguration(t *testing.T) {
+	dir := loadTestConfig(t, nil)
+	t.Cleanup(func() { initForce, initNonInteractive = false, false })
+	configFile := filepath.Join(dir, "config.yaml")
+	populated := "secret: old-secret\nport: 9000\nserver:\n  base_path: /gorun\nstorage:\n  s3:\n    bucket: results\nlimits:\n  runs_per_minute: 5\n"
+	if err := os.WriteFile(configFile, []byte(populated), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	initForce, initNonInteractive = true, true
+	runCommand(initCmd)
+
+	written := viper.New()
+	written.SetConfigFile(configFile)
+	if err := written.ReadInConfig(); err != nil {
+		t.Fatal(err)
+	}
+	for key, want := range map[string]interface{}{
+		"secret":                 "test-secret",
+		"port":                   viper.GetInt("port"),
+		"server.base_path":       "/gorun",
+		"storage.s3.bucket":      "results",
+		"limits.runs_per_minute": 5,
+	} {
+		if got := written.Get(key); got != want {
+			t.Errorf("%s is written as %v, want %v", key, got, want)
+		}
+	}
+	info, err := os.Stat(configFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := info.Mode().Perm(); mode != 0600 {
+		t.Errorf("the configuration is written with the mode %v, want 0600", mode)
+	}
+}
@@ -12,14 +12,23 @@ var image string
 var verbose bool
 
 var inspectCmd = &cobra.Command{
-	Use:   "inspect",
-	Short: "Inspect a docker image to be tool-spec compliant",
+	Use:     "inspect",
+	Aliases: []string{"validate-image"},
+	Short:   "Inspect a docker image to be tool-spec compliant",
 	Run: func(cmd *cobra.Command, args []string) {
-		spec, err := toolImage.ReadToolSpec(cmd.Context(), image)
+		spec, compat, err := toolImage.ReadToolSpec(cmd.Context(), image)
 		if err != nil {
 			fmt.Println("The tool image is not tool-spec compliant")
 		} else {
 			fmt.Println("The tool image is tool-spec compliant")
+			version := compat.Version
+			if version == "" {
+				version = "not declared"
+			}
+			fmt.Printf("Spec version: %s (%s)\n", version, compat.Status)
+			for _, reason := range compat.Reasons {
+				fmt.Printf("  - %s\n", reason)
+			}
 		}
 		if verbose {
 			cobra.CheckErr(err)
@@ -0,0 +1,103 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/hydrocode-de/gorun/api"
+	"github.com/hydrocode-de/gorun/internal/auth"
+	"github.com/spf13/viper"
+)
+
+const unixScheme = "unix://"
+
+// socketPath returns the unix socket path of server.listen, if it is one
+func socketPath(listen string) (string, bool) {
+	if !strings.HasPrefix(listen, unixScheme) {
+		return "", false
+	}
+	return strings.TrimPrefix(listen, unixScheme), true
+}
+
+// listen opens the listener of the API server. server.listen may be a unix socket
+// like unix:///home/me/.gorun/gorun.sock, otherwise host and port are used.
+func listen() (net.Listener, string, error) {
+	listenOn := viper.GetString("server.listen")
+	socket, isSocket := socketPath(listenOn)
+	if !isSocket {
+		if listenOn == "" {
+			listenOn = fmt.Sprintf("%s:%d", viper.GetString("host"), viper.GetInt("port"))
+		}
+		listener, err := net.Listen("tcp", listenOn)
+		return listener, listenOn, err
+	}
+
+	// remove a stale socket of a server that did not shut down cleanly
+	if info, err := os.Stat(socket); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, "", fmt.Errorf("%s exists and is not a socket", socket)
+		}
+		if conn, err := net.Dial("unix", socket); err == nil {
+			conn.Close()
+			return nil, "", fmt.Errorf("another server is already listening on %s", socket)
+		}
+		if err := os.Remove(socket); err != nil {
+			return nil, "", fmt.Errorf("failed to remove the stale socket %s: %w", socket, err)
+		}
+	}
+
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		return nil, "", err
+	}
+	if err := os.Chmod(socket, 0600); err != nil {
+		listener.Close()
+		return nil, "", err
+	}
+	return listener, listenOn, nil
+}
+
+// remoteGet requests an API route from the local server listening on the unix socket of server.listen
+func remoteGet(ctx context.Context, route string, target interface{}) error {
+	socket, isSocket := socketPath(viper.GetString("server.listen"))
+	if !isSocket {
+		return fmt.Errorf("--remote requires server.listen to be a unix socket, like unix:///path/to/gorun.sock")
+	}
+	credentials, err := auth.GetAdminCredentials(ctx, application.DB)
+	if err != nil {
+		return err
+	}
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var dialer net.Dialer
+				return dialer.DialContext(ctx, "unix", socket)
+			},
+		},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://gorun"+api.BasePath()+route, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+credentials.AccessToken)
+
+	res, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach the gorun server at %s: %w", socket, err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		var apiErr struct {
+			Message string `json:"message"`
+		}
+		json.NewDecoder(res.Body).Decode(&apiErr)
+		return fmt.Errorf("the gorun server responded with %s: %s", res.Status, apiErr.Message)
+	}
+	return json.NewDecoder(res.Body).Decode(target)
+}
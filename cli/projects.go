@@ -0,0 +1,207 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/hydrocode-de/gorun/internal/audit"
+	"github.com/hydrocode-de/gorun/internal/auth"
+	"github.com/hydrocode-de/gorun/internal/db"
+	"github.com/hydrocode-de/gorun/internal/tool"
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/spf13/cobra"
+)
+
+var (
+	projectOwner       string
+	projectName        string
+	projectDescription string
+)
+
+var projectCmd = &cobra.Command{
+	Use:   "project",
+	Short: "Manage the projects grouping the runs of the server",
+	Long: `Manage the projects grouping the runs of the server. The members of a project
+see each other's runs and may run tools in it. Every user has a personal
+project, which new runs are created in unless another project is given.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Help()
+	},
+}
+
+var listProjectsCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the projects of all users",
+	Run: func(cmd *cobra.Command, args []string) {
+		credentials, err := auth.GetAdminCredentials(cmd.Context(), application.DB)
+		cobra.CheckErr(err)
+		projects, err := tool.ListProjects(cmd.Context(), application.DB, credentials.UserID, true)
+		cobra.CheckErr(err)
+
+		t := table.NewWriter()
+		t.SetStyle(table.StyleColoredMagentaWhiteOnBlack)
+		t.AppendHeader(table.Row{"ID", "Name", "Owner", "Personal", "Description"})
+		for _, project := range projects {
+			t.AppendRow(table.Row{project.ID, project.Name, project.OwnerID, project.Personal, project.Description})
+		}
+		fmt.Println(t.Render())
+	},
+}
+
+var showProjectCmd = &cobra.Command{
+	Use:   "show <id>",
+	Short: "Show a project and its members",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		credentials, err := auth.GetAdminCredentials(cmd.Context(), application.DB)
+		cobra.CheckErr(err)
+		project, err := tool.GetProject(cmd.Context(), application.DB, parseProjectID(args[0]), credentials.UserID)
+		cobra.CheckErr(err)
+
+		fmt.Printf("Project %d: %s\n", project.ID, project.Name)
+		if project.Description != "" {
+			fmt.Println(project.Description)
+		}
+		t := table.NewWriter()
+		t.SetStyle(table.StyleColoredMagentaWhiteOnBlack)
+		t.AppendHeader(table.Row{"User ID", "Email", "Owner", "Member since"})
+		for _, member := range project.Members {
+			t.AppendRow(table.Row{member.UserID, member.Email, member.UserID == project.OwnerID, member.CreatedAt})
+		}
+		fmt.Println(t.Render())
+	},
+}
+
+var createProjectCmd = &cobra.Command{
+	Use:   "create <name>",
+	Short: "Create a project, owned by the admin user or --owner",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		credentials, err := auth.GetAdminCredentials(cmd.Context(), application.DB)
+		cobra.CheckErr(err)
+		ownerID := credentials.UserID
+		if projectOwner != "" {
+			owner, err := lookupUser(cmd.Context(), projectOwner)
+			cobra.CheckErr(err)
+			ownerID = owner.ID
+		}
+
+		project, err := tool.CreateProject(cmd.Context(), application.DB, args[0], projectDescription, ownerID)
+		cobra.CheckErr(err)
+		recordCLIAudit(cmd, audit.ActionProjectCreate, fmt.Sprintf("project:%d", project.ID))
+		fmt.Printf("Created the project %d: %s\n", project.ID, project.Name)
+	},
+}
+
+var updateProjectCmd = &cobra.Command{
+	Use:   "update <id>",
+	Short: "Change the name or description of a project",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		credentials, err := auth.GetAdminCredentials(cmd.Context(), application.DB)
+		cobra.CheckErr(err)
+		var name, description *string
+		if cmd.Flags().Changed("name") {
+			name = &projectName
+		}
+		if cmd.Flags().Changed("description") {
+			description = &projectDescription
+		}
+
+		project, err := tool.UpdateProject(cmd.Context(), application.DB, parseProjectID(args[0]), name, description, credentials.UserID)
+		cobra.CheckErr(err)
+		recordCLIAudit(cmd, audit.ActionProjectUpdate, fmt.Sprintf("project:%d", project.ID))
+		fmt.Printf("Updated the project %d: %s\n", project.ID, project.Name)
+	},
+}
+
+var deleteProjectCmd = &cobra.Command{
+	Use:   "delete <id>",
+	Short: "Delete a project without runs",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		credentials, err := auth.GetAdminCredentials(cmd.Context(), application.DB)
+		cobra.CheckErr(err)
+		id := parseProjectID(args[0])
+		cobra.CheckErr(tool.DeleteProject(cmd.Context(), application.DB, id, credentials.UserID))
+		recordCLIAudit(cmd, audit.ActionProjectDelete, fmt.Sprintf("project:%d", id))
+		fmt.Printf("Deleted the project %d\n", id)
+	},
+}
+
+var addProjectMemberCmd = &cobra.Command{
+	Use:   "add-member <id> <user>",
+	Short: "Add a user, by ID or email, to a project",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		credentials, err := auth.GetAdminCredentials(cmd.Context(), application.DB)
+		cobra.CheckErr(err)
+		member, err := lookupUser(cmd.Context(), args[1])
+		cobra.CheckErr(err)
+		id := parseProjectID(args[0])
+
+		_, err = tool.AddProjectMember(cmd.Context(), application.DB, id, member.ID, credentials.UserID)
+		cobra.CheckErr(err)
+		recordCLIAudit(cmd, audit.ActionProjectMemberAdd, fmt.Sprintf("project:%d/user:%s", id, member.ID))
+		fmt.Printf("Added %s to the project %d\n", member.Email, id)
+	},
+}
+
+var removeProjectMemberCmd = &cobra.Command{
+	Use:   "remove-member <id> <user>",
+	Short: "Remove a user, by ID or email, from a project",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		credentials, err := auth.GetAdminCredentials(cmd.Context(), application.DB)
+		cobra.CheckErr(err)
+		member, err := lookupUser(cmd.Context(), args[1])
+		cobra.CheckErr(err)
+		id := parseProjectID(args[0])
+
+		_, err = tool.RemoveProjectMember(cmd.Context(), application.DB, id, member.ID, credentials.UserID)
+		cobra.CheckErr(err)
+		recordCLIAudit(cmd, audit.ActionProjectMemberDrop, fmt.Sprintf("project:%d/user:%s", id, member.ID))
+		fmt.Printf("Removed %s from the project %d\n", member.Email, id)
+	},
+}
+
+func parseProjectID(arg string) int64 {
+	id, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil {
+		cobra.CheckErr(fmt.Errorf("invalid project id %s", arg))
+	}
+	return id
+}
+
+// lookupUser finds the user by email or ID, like gorun user
+func lookupUser(ctx context.Context, user string) (db.User, error) {
+	var found db.User
+	var err error
+	if strings.Contains(user, "@") {
+		found, err = application.DB.GetUserByEmail(ctx, user)
+	} else {
+		found, err = application.DB.GetUserByID(ctx, user)
+	}
+	if err != nil {
+		return db.User{}, fmt.Errorf("user %s not found", user)
+	}
+	return found, nil
+}
+
+func init() {
+	createProjectCmd.Flags().StringVar(&projectOwner, "owner", "", "The ID or email of the owner, defaults to the admin user")
+	createProjectCmd.Flags().StringVar(&projectDescription, "description", "", "The description of the project")
+	updateProjectCmd.Flags().StringVar(&projectName, "name", "", "The new name of the project")
+	updateProjectCmd.Flags().StringVar(&projectDescription, "description", "", "The new description of the project")
+
+	projectCmd.AddCommand(listProjectsCmd)
+	projectCmd.AddCommand(showProjectCmd)
+	projectCmd.AddCommand(createProjectCmd)
+	projectCmd.AddCommand(updateProjectCmd)
+	projectCmd.AddCommand(deleteProjectCmd)
+	projectCmd.AddCommand(addProjectMemberCmd)
+	projectCmd.AddCommand(removeProjectMemberCmd)
+	rootCmd.AddCommand(projectCmd)
+}
@@ -0,0 +1,114 @@
+package cli
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hydrocode-de/gorun/internal/files"
+	"github.com/hydrocode-de/gorun/internal/tool"
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var (
+	pruneDryRun      bool
+	pruneGracePeriod time.Duration
+	pruneTemp        bool
+	pruneContainers  bool
+)
+
+var pruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Remove run directories which no run owns, stale temporary files and containers",
+	Long: `Remove the directories below the mount path which do not belong to any run
+and were not modified within the grace period. They are left behind if a run is
+deleted from the database directly or its creation failed half way.
+With --temp, the uploads and other entries of the temp path older than
+max_temp_age are removed instead. With --containers, the containers gorun left
+behind in the created or exited state are removed once they are older than
+run.reap_grace_period, except those of runs which are not finished.
+With --dry-run, they are only listed.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if pruneContainers {
+			gracePeriod := viper.GetDuration("run.reap_grace_period")
+			if cmd.Flags().Changed("grace-period") {
+				gracePeriod = pruneGracePeriod
+			}
+			stale, err := tool.ReapContainers(cmd.Context(), application.DB, gracePeriod, pruneDryRun)
+			cobra.CheckErr(err)
+			if len(stale) == 0 {
+				fmt.Println("no stale containers found")
+				return
+			}
+
+			t := table.NewWriter()
+			t.SetStyle(table.StyleColoredMagentaWhiteOnBlack)
+			t.AppendHeader(table.Row{"Container", "Purpose", "Run ID", "State", "Created", "Removed"})
+			for _, cont := range stale {
+				runID := ""
+				if cont.RunID != nil {
+					runID = fmt.Sprint(*cont.RunID)
+				}
+				t.AppendRow(table.Row{cont.ID[:min(len(cont.ID), 12)], cont.Purpose, runID, cont.State, cont.CreatedAt, cont.Removed})
+			}
+			fmt.Println(t.Render())
+			return
+		}
+		if pruneTemp {
+			maxAge := viper.GetDuration("max_temp_age")
+			if cmd.Flags().Changed("grace-period") {
+				maxAge = pruneGracePeriod
+			}
+			held, err := tool.HeldTempPaths(cmd.Context(), application.DB)
+			cobra.CheckErr(err)
+			stale, err := files.CleanTemp(viper.GetString("temp_path"), maxAge, time.Now(), pruneDryRun, held...)
+			cobra.CheckErr(err)
+			if len(stale) == 0 {
+				fmt.Println("no stale temporary files found")
+				return
+			}
+
+			t := table.NewWriter()
+			t.SetStyle(table.StyleColoredMagentaWhiteOnBlack)
+			t.AppendHeader(table.Row{"Path", "Size", "Modified", "Removed"})
+			for _, entry := range stale {
+				t.AppendRow(table.Row{entry.Path, formatBytes(entry.Size), entry.ModifiedAt, entry.Removed})
+			}
+			fmt.Println(t.Render())
+			return
+		}
+
+		gracePeriod := viper.GetDuration("files.orphan_grace_period")
+		if cmd.Flags().Changed("grace-period") {
+			gracePeriod = pruneGracePeriod
+		}
+		orphaned, err := tool.PruneRunDirs(cmd.Context(), application.DB, gracePeriod, pruneDryRun)
+		cobra.CheckErr(err)
+		if len(orphaned) == 0 {
+			fmt.Println("no orphaned run directories found")
+			return
+		}
+
+		t := table.NewWriter()
+		t.SetStyle(table.StyleColoredMagentaWhiteOnBlack)
+		t.AppendHeader(table.Row{"Path", "Run ID", "Modified", "Removed"})
+		for _, dir := range orphaned {
+			runID := ""
+			if dir.RunID != nil {
+				runID = fmt.Sprint(*dir.RunID)
+			}
+			t.AppendRow(table.Row{dir.Path, runID, dir.ModifiedAt, dir.Removed})
+		}
+		fmt.Println(t.Render())
+	},
+}
+
+func init() {
+	pruneCmd.Flags().BoolVar(&pruneDryRun, "dry-run", false, "Only list what would be removed")
+	pruneCmd.Flags().DurationVar(&pruneGracePeriod, "grace-period", 24*time.Hour, "Keep orphaned directories modified more recently")
+	pruneCmd.Flags().BoolVar(&pruneTemp, "temp", false, "Remove stale uploads from the temp path instead, --grace-period overrides max_temp_age")
+	pruneCmd.Flags().BoolVar(&pruneContainers, "containers", false, "Remove stale containers gorun created instead, --grace-period overrides run.reap_grace_period")
+
+	rootCmd.AddCommand(pruneCmd)
+}
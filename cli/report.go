@@ -0,0 +1,66 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/hydrocode-de/gorun/internal/tool"
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/spf13/cobra"
+)
+
+var (
+	reportFrom    string
+	reportTo      string
+	reportGroupBy string
+	reportCSV     bool
+)
+
+var reportCmd = &cobra.Command{
+	Use:   "report",
+	Short: "Report on the runs of the server",
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Help()
+	},
+}
+
+var usageReportCmd = &cobra.Command{
+	Use:   "usage",
+	Short: "Aggregate the CPU time, memory and duration of all runs per user, tool or project",
+	Run: func(cmd *cobra.Command, args []string) {
+		from, to, err := tool.ParseUsageWindow(reportFrom, reportTo)
+		cobra.CheckErr(err)
+		groups, err := tool.UsageReport(cmd.Context(), application.DB, from, to, reportGroupBy, "")
+		cobra.CheckErr(err)
+
+		if reportCSV {
+			cobra.CheckErr(tool.WriteUsageCSV(os.Stdout, groups))
+			return
+		}
+
+		t := table.NewWriter()
+		t.SetStyle(table.StyleColoredMagentaWhiteOnBlack)
+		t.AppendHeader(table.Row{reportGroupBy, "Runs", "Duration (s)", "CPU (s)", "Peak memory (GB h)"})
+		for _, group := range groups {
+			t.AppendRow(table.Row{
+				group.Group,
+				group.Runs,
+				fmt.Sprintf("%.1f", group.DurationSeconds),
+				fmt.Sprintf("%.1f", group.CPUSeconds),
+				fmt.Sprintf("%.4f", group.PeakMemoryGBHours),
+			})
+		}
+		fmt.Println(t.Render())
+		fmt.Printf("Runs started from %s to %s\n", from.Format("2006-01-02 15:04:05"), to.Format("2006-01-02 15:04:05"))
+	},
+}
+
+func init() {
+	usageReportCmd.Flags().StringVar(&reportFrom, "from", "", "Start of the window as date or RFC 3339 timestamp (default: 30 days before --to)")
+	usageReportCmd.Flags().StringVar(&reportTo, "to", "", "End of the window, exclusive (default: now)")
+	usageReportCmd.Flags().StringVar(&reportGroupBy, "group-by", "user", "Aggregate per 'user', 'tool' or 'project'")
+	usageReportCmd.Flags().BoolVar(&reportCSV, "csv", false, "Print the report as CSV")
+
+	reportCmd.AddCommand(usageReportCmd)
+	rootCmd.AddCommand(reportCmd)
+}
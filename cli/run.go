@@ -0,0 +1,128 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/hydrocode-de/gorun/internal/auth"
+	"github.com/hydrocode-de/gorun/internal/tool"
+	"github.com/hydrocode-de/gorun/internal/toolImage"
+	"github.com/spf13/cobra"
+)
+
+var (
+	runParams   []string
+	runDatasets []string
+	runDataMode string
+	runRuntime  string
+	runPrepare  bool
+	runParamEnv bool
+	runProject  int64
+	dryRun      bool
+)
+
+var runCmd = &cobra.Command{
+	Use:   "run <image> <tool>",
+	Short: "Run a tool of an image as the admin user",
+	Long: `Run a tool of an image as the admin user and wait until it is finished.
+With --dry-run, the container is not created. The plan of the run and an
+equivalent docker run command line are printed instead.`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		credentials, err := auth.GetAdminCredentials(cmd.Context(), application.DB)
+		cobra.CheckErr(err)
+
+		opts := tool.CreateRunOptions{
+			Image:      args[0],
+			Name:       args[1],
+			Parameters: make(map[string]interface{}),
+			Datasets:   make(map[string]tool.DatasetRef),
+			DataMode:   runDataMode,
+			Runtime:    runRuntime,
+			ProjectID:  runProject,
+		}
+		if cmd.Flags().Changed("use-prepare") {
+			opts.UsePrepare = &runPrepare
+		}
+		if cmd.Flags().Changed("param-env") {
+			opts.ParamEnv = &runParamEnv
+		}
+		for _, param := range runParams {
+			name, value, ok := strings.Cut(param, "=")
+			if !ok {
+				cobra.CheckErr(fmt.Errorf("invalid --param %s. Use name=value", param))
+			}
+			// values are read as JSON if possible, like 42, true or [1, 2], otherwise as string
+			var parsed interface{}
+			if err := json.Unmarshal([]byte(value), &parsed); err != nil {
+				parsed = value
+			}
+			opts.Parameters[name] = parsed
+		}
+		for _, dataset := range runDatasets {
+			name, dataPaths, ok := strings.Cut(dataset, "=")
+			if !ok {
+				cobra.CheckErr(fmt.Errorf("invalid --data %s. Use name=path or name=path1,path2", dataset))
+			}
+			if strings.Contains(dataPaths, ",") {
+				opts.Datasets[name] = tool.DatasetRef{Paths: strings.Split(dataPaths, ","), List: true}
+			} else {
+				opts.Datasets[name] = tool.SinglePath(dataPaths)
+			}
+		}
+
+		// the CLI has no warm cache like the server, so the tool-spec of the image is read first
+		runtime, err := tool.ResolveRuntime(opts.Runtime)
+		cobra.CheckErr(err)
+		toolSlug := fmt.Sprintf("%s::%s", opts.Image, opts.Name)
+		if runtime == tool.RuntimeApptainer {
+			cobra.CheckErr(toolImage.LoadApptainerToolSpec(cmd.Context(), toolSlug, application.Cache))
+		} else {
+			c, err := tool.RuntimeClient(runtime)
+			cobra.CheckErr(err)
+			_, err = toolImage.LoadToolSpec(cmd.Context(), c, toolSlug, application.Cache)
+			cobra.CheckErr(err)
+		}
+
+		if dryRun {
+			plan, err := tool.PlanRun(cmd.Context(), application.DB, application.Cache, opts, credentials.UserID)
+			cobra.CheckErr(err)
+			planJSON, err := json.MarshalIndent(plan, "", "  ")
+			cobra.CheckErr(err)
+			fmt.Println(string(planJSON))
+			fmt.Printf("\n%s\n", plan.CommandLine())
+			return
+		}
+
+		runData, err := tool.ValidateAndCreateRun(cmd.Context(), application.DB, application.Cache, opts, credentials.UserID)
+		cobra.CheckErr(err)
+		run, err := tool.FromDBRun(runData)
+		cobra.CheckErr(err)
+		fmt.Printf("created run %d\n", run.ID)
+
+		runErr := tool.RunTool(cmd.Context(), tool.RunToolOptions{
+			DB:     application.DB,
+			Tool:   run,
+			Env:    []string{},
+			UserId: credentials.UserID,
+		})
+		finished, err := tool.GetRun(cmd.Context(), application.DB, run.ID, credentials.UserID)
+		cobra.CheckErr(err)
+		fmt.Printf("run %d %s\n", finished.ID, finished.Status)
+		cobra.CheckErr(runErr)
+	},
+}
+
+func init() {
+	runCmd.Flags().StringArrayVar(&runParams, "param", nil, "A parameter of the tool as name=value, may be repeated")
+	runCmd.Flags().StringArrayVar(&runDatasets, "data", nil, "A dataset of the tool as name=path, or name=path1,path2 for multiple files. May be repeated")
+	runCmd.Flags().StringVar(&runDataMode, "data-mode", "", "Copy the datasets into the run or mount them (copy, mount)")
+	runCmd.Flags().StringVar(&runRuntime, "runtime", "", "Execute the run with docker, apptainer or ssh, defaults to run.runtime")
+	runCmd.Flags().BoolVar(&runPrepare, "use-prepare", false, "Prepare the inputs with gotap prepare before the run, defaults to run.use_prepare")
+	runCmd.Flags().BoolVar(&runParamEnv, "param-env", false, "Export the parameters and datasets as TOOL_PARAM_ and TOOL_DATA_ environment variables, defaults to param_env of the spec")
+	runCmd.Flags().Int64Var(&runProject, "project", 0, "The ID of the project to run the tool in, defaults to the personal project")
+	runCmd.Flags().BoolVar(&dryRun, "dry-run", false, "Print the plan of the container without creating it")
+
+	rootCmd.AddCommand(runCmd)
+}
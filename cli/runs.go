@@ -3,42 +3,105 @@ package cli
 import (
 	"fmt"
 
+	"github.com/hydrocode-de/gorun/api"
+	"github.com/hydrocode-de/gorun/internal/audit"
 	"github.com/hydrocode-de/gorun/internal/auth"
 	"github.com/hydrocode-de/gorun/internal/db"
+	"github.com/hydrocode-de/gorun/internal/tool"
 	"github.com/jedib0t/go-pretty/v6/table"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
 
 var (
-	listRuns bool
-	filter   string
+	listRuns   bool
+	filter     string
+	remoteRuns bool
+	deleteRun  int64
+	forceRun   bool
+	purgeRun   bool
+	restoreRun int64
 )
 
 var runsCmd = &cobra.Command{
 	Use:   "runs",
 	Short: "Manage job runs",
 	Run: func(cmd *cobra.Command, args []string) {
-		DB := viper.Get("db").(*db.Queries)
-		credentials, err := auth.GetAdminCredentials(cmd.Context())
+		if listRuns && remoteRuns {
+			var response api.RunsResponse
+			cobra.CheckErr(remoteGet(cmd.Context(), "/runs", &response))
+
+			t := table.NewWriter()
+			t.SetStyle(table.StyleColoredMagentaWhiteOnBlack)
+			t.AppendHeader(table.Row{"ID", "Name", "Title", "Created", "Status", "Peak memory"})
+			for _, run := range response.Runs {
+				peakMemory := ""
+				if run.PeakMemoryBytes != nil {
+					peakMemory = formatBytes(*run.PeakMemoryBytes)
+				}
+				t.AppendRow(table.Row{run.ID, run.Name, run.Title, run.CreatedAt, run.Status, peakMemory})
+			}
+			fmt.Println(t.Render())
+			return
+		}
+
+		credentials, err := auth.GetAdminCredentials(cmd.Context(), application.DB)
 		cobra.CheckErr(err)
 
+		if deleteRun != 0 {
+			dbRun, err := tool.GetRun(cmd.Context(), application.DB, deleteRun, credentials.UserID)
+			cobra.CheckErr(err)
+			run, err := tool.FromDBRun(dbRun)
+			cobra.CheckErr(err)
+			if !purgeRun && viper.GetDuration("run.trash_retention") > 0 {
+				cobra.CheckErr(tool.TrashRun(cmd.Context(), application.DB, run, credentials.UserID, forceRun))
+				recordCLIAudit(cmd, audit.ActionRunTrash, fmt.Sprintf("run:%d", run.ID))
+				fmt.Printf("Moved run %d to the trash, restore it with --restore %d\n", run.ID, run.ID)
+				return
+			}
+			cobra.CheckErr(tool.DeleteRun(cmd.Context(), application.DB, run, credentials.UserID, forceRun))
+			recordCLIAudit(cmd, audit.ActionRunDelete, fmt.Sprintf("run:%d", run.ID))
+			fmt.Printf("Deleted run %d\n", run.ID)
+			return
+		}
+
+		if restoreRun != 0 {
+			dbRun, err := tool.GetRun(cmd.Context(), application.DB, restoreRun, credentials.UserID)
+			cobra.CheckErr(err)
+			run, err := tool.FromDBRun(dbRun)
+			cobra.CheckErr(err)
+			cobra.CheckErr(tool.RestoreRun(cmd.Context(), application.DB, run))
+			recordCLIAudit(cmd, audit.ActionRunRestore, fmt.Sprintf("run:%d", run.ID))
+			fmt.Printf("Restored run %d\n", run.ID)
+			return
+		}
+
 		if listRuns {
 			var runs []db.Run
 
 			switch filter {
 			case "":
-				runs, err = DB.GetAllRuns(cmd.Context(), db.GetAllRunsParams{
-					UserID: credentials.UserID,
+				runs, err = application.DB.GetAllRuns(cmd.Context(), db.GetAllRunsParams{
+					UserID:   credentials.UserID,
+					UserID_2: credentials.UserID,
 				})
 			}
 			cobra.CheckErr(err)
+			stats, err := application.DB.GetRunStatsByUser(cmd.Context(), credentials.UserID)
+			cobra.CheckErr(err)
+			peakMemory := make(map[int64]string, len(stats))
+			for _, stat := range stats {
+				peakMemory[stat.RunID] = formatBytes(stat.PeakMemoryBytes)
+			}
 
 			t := table.NewWriter()
 			t.SetStyle(table.StyleColoredMagentaWhiteOnBlack)
-			t.AppendHeader(table.Row{"ID", "Name", "Title", "Created", "Status"})
+			t.AppendHeader(table.Row{"ID", "Name", "Title", "Created", "Status", "Peak memory"})
 			for _, run := range runs {
-				t.AppendRow(table.Row{run.ID, run.Name, run.Title, run.CreatedAt, run.Status})
+				if run.DeletedAt.Valid {
+					continue
+				}
+				t.AppendRow(table.Row{run.ID, run.Name, run.Title, run.CreatedAt, run.Status, peakMemory[run.ID]})
 			}
 			fmt.Println(t.Render())
 			return
@@ -49,8 +112,27 @@ var runsCmd = &cobra.Command{
 	},
 }
 
+// formatBytes prints a size with binary units, like 512.0 MiB
+func formatBytes(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
+
 func init() {
 	runsCmd.Flags().BoolVarP(&listRuns, "list", "l", false, "List all available runs")
+	runsCmd.Flags().Int64Var(&deleteRun, "delete", 0, "Move the run with this ID to the trash, its files and records are removed after run.trash_retention")
+	runsCmd.Flags().BoolVar(&forceRun, "force", false, "Cancel the run first if it is still running")
+	runsCmd.Flags().BoolVar(&purgeRun, "purge", false, "Delete the run, its files and its records right away instead of moving it to the trash")
+	runsCmd.Flags().Int64Var(&restoreRun, "restore", 0, "Restore the run with this ID from the trash")
+	runsCmd.Flags().BoolVar(&remoteRuns, "remote", false, "Ask the server listening on the server.listen unix socket")
 
 	rootCmd.AddCommand(runsCmd)
 }
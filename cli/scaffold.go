@@ -0,0 +1,56 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hydrocode-de/gorun/internal/scaffold"
+	"github.com/spf13/cobra"
+)
+
+var (
+	scaffoldName      string
+	scaffoldLanguage  string
+	scaffoldOut       string
+	scaffoldWithGotap bool
+)
+
+var scaffoldCmd = &cobra.Command{
+	Use:         "scaffold",
+	Short:       "Generate the directory of a new tool-spec tool",
+	Annotations: map[string]string{skipValidation: "true"},
+	Long: `Generate a starting point for a new tool: a tool.yml with example parameters of
+each type, a run file reading /in/inputs.json and writing to /out, a Dockerfile,
+a CITATION.cff skeleton and a README describing how to test the image with
+gorun validate-image and gorun run. With --with-gotap, the Dockerfile installs
+gotap. The output directory must not exist or be empty.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		out := scaffoldOut
+		if out == "" {
+			out = scaffoldName
+		}
+		written, err := scaffold.Generate(scaffold.Options{
+			Name:      scaffoldName,
+			Language:  scaffoldLanguage,
+			Out:       out,
+			WithGotap: scaffoldWithGotap,
+		})
+		cobra.CheckErr(err)
+
+		fmt.Printf("Generated the tool %s in %s:\n", scaffoldName, out)
+		for _, name := range written {
+			fmt.Printf("  %s\n", name)
+		}
+		fmt.Printf("\nBuild the image with 'docker build -t %s:latest %s'\n", scaffoldName, out)
+	},
+}
+
+func init() {
+	scaffoldCmd.Flags().StringVar(&scaffoldName, "name", "", "The name of the tool")
+	scaffoldCmd.MarkFlagRequired("name")
+	scaffoldCmd.Flags().StringVar(&scaffoldLanguage, "language", "python", fmt.Sprintf("The language of the tool (%s)", strings.Join(scaffold.LanguageNames(), ", ")))
+	scaffoldCmd.Flags().StringVar(&scaffoldOut, "out", "", "The directory to generate the tool in, defaults to ./<name>")
+	scaffoldCmd.Flags().BoolVar(&scaffoldWithGotap, "with-gotap", false, "Install gotap in the image")
+
+	rootCmd.AddCommand(scaffoldCmd)
+}
@@ -0,0 +1,68 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/hydrocode-de/gorun/internal/auth"
+	"github.com/hydrocode-de/gorun/internal/selftest"
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/spf13/cobra"
+)
+
+var (
+	selftestTimeout    time.Duration
+	selftestKeepImages bool
+)
+
+var selftestCmd = &cobra.Command{
+	Use:   "selftest",
+	Short: "Check that gorun works against the Docker daemon",
+	Long: `Build a small test image, once without and once with a gotap shim, and run its
+tool as the admin user: spec discovery, validation, run creation, execution,
+result listing, metadata handling and deletion. A report is printed and the
+command exits non-zero if any check failed. The base image busybox is pulled
+if it is not available.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		credentials, err := auth.GetAdminCredentials(cmd.Context(), application.DB)
+		cobra.CheckErr(err)
+
+		ctx, cancel := context.WithTimeout(cmd.Context(), selftestTimeout)
+		defer cancel()
+		checks := selftest.Run(ctx, selftest.Options{
+			DB:         application.DB,
+			Cache:      application.Cache,
+			UserID:     credentials.UserID,
+			KeepImages: selftestKeepImages,
+		})
+
+		t := table.NewWriter()
+		t.SetStyle(table.StyleColoredMagentaWhiteOnBlack)
+		t.AppendHeader(table.Row{"Image", "Check", "Result", "Duration", "Error"})
+		for _, check := range checks {
+			result, message := "ok", ""
+			if check.Skipped {
+				result = "skipped"
+			} else if check.Err != nil {
+				result, message = "failed", check.Err.Error()
+			}
+			t.AppendRow(table.Row{check.Variant, check.Name, result, check.Duration.Round(time.Millisecond), message})
+		}
+		fmt.Println(t.Render())
+
+		if selftest.Failed(checks) {
+			fmt.Println("selftest failed")
+			os.Exit(1)
+		}
+		fmt.Println("selftest passed")
+	},
+}
+
+func init() {
+	selftestCmd.Flags().DurationVar(&selftestTimeout, "timeout", 2*time.Minute, "Abort the checks after this duration")
+	selftestCmd.Flags().BoolVar(&selftestKeepImages, "keep-images", false, "Keep the test images for the next selftest")
+
+	rootCmd.AddCommand(selftestCmd)
+}
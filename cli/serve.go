@@ -4,13 +4,21 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/hydrocode-de/gorun/api"
+	"github.com/hydrocode-de/gorun/internal/audit"
 	"github.com/hydrocode-de/gorun/internal/auth"
-	"github.com/hydrocode-de/gorun/internal/cache"
+	"github.com/hydrocode-de/gorun/internal/dockerclient"
 	"github.com/hydrocode-de/gorun/internal/files"
+	"github.com/hydrocode-de/gorun/internal/support"
+	"github.com/hydrocode-de/gorun/internal/tool"
 	"github.com/hydrocode-de/gorun/internal/toolImage"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -28,6 +36,7 @@ var serveCmd = &cobra.Command{
 		serverHost := viper.GetString("host")
 		serverPort := viper.GetInt("port")
 		serverNoAuth := viper.GetBool("no_auth")
+		support.CaptureLogs()
 
 		if serverNoAuth && serverHost != "127.0.0.1" {
 			log.Printf("WARNING: You are running the server with no authentication and a non-localhost host. This is not recommended and might expose your server to the public internet.")
@@ -41,42 +50,110 @@ var serveCmd = &cobra.Command{
 			startBackgroundTasks(cmd.Context())
 		}
 
-		mux, err := api.CreateServer()
+		mux, err := api.CreateServer(application)
 		cobra.CheckErr(err)
 
-		server := api.EnableCORS(mux, "*")
-		log.Printf("GoRun server listening on  http://%s:%d\n", serverHost, serverPort)
-		log.Fatal(http.ListenAndServe(fmt.Sprintf("%s:%d", serverHost, serverPort), server))
+		tlsConfig, err := tlsConfigFromViper()
+		cobra.CheckErr(err)
+
+		listener, address, err := listen()
+		cobra.CheckErr(err)
+
+		server := &http.Server{
+			Handler:   api.RequestLogger(api.EnableCORS(mux, "*")),
+			TLSConfig: tlsConfig,
+		}
+		stopped := make(chan struct{})
+		go func() {
+			shutdownOnSignal(server)
+			close(stopped)
+		}()
+
+		if tlsConfig == nil {
+			log.Printf("GoRun server listening on  http://%s%s\n", address, api.BasePath())
+			err = server.Serve(listener)
+		} else {
+			if redirectPort := viper.GetInt("tls.redirect_port"); redirectPort != 0 {
+				go serveHTTPSRedirect(serverHost, redirectPort, serverPort)
+			}
+			log.Printf("GoRun server listening on  https://%s%s\n", address, api.BasePath())
+			// the certificate is provided by the TLSConfig
+			err = server.ServeTLS(listener, "", "")
+		}
+		if err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
+		// Serve returns once the shutdown began, the requests it waits for may still write
+		<-stopped
 	},
 }
 
-func startBackgroundTasks(ctx context.Context) {
-	// Initial cache population
+// shutdownOnSignal gracefully stops the server on SIGINT or SIGTERM, and waits for the
+// audit entries of the last requests. Closing the listener removes a unix socket as well.
+func shutdownOnSignal(server *http.Server) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	<-ctx.Done()
+
+	log.Println("Shutting down the server...")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("failed to shut down the server gracefully: %v", err)
+	}
+	// the requests are done, their audit entries must not be lost
+	audit.Wait()
+}
+
+// serveHTTPSRedirect redirects plain HTTP requests to the TLS port
+func serveHTTPSRedirect(serverHost string, redirectPort int, tlsPort int) {
+	redirect := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			host = r.Host
+		}
+		target := fmt.Sprintf("https://%s:%d%s", host, tlsPort, r.URL.RequestURI())
+		http.Redirect(w, r, target, http.StatusPermanentRedirect)
+	})
+	log.Printf("Redirecting http://%s:%d to HTTPS\n", serverHost, redirectPort)
+	log.Fatal(http.ListenAndServe(fmt.Sprintf("%s:%d", serverHost, redirectPort), redirect))
+}
+
+// toolsMutex makes sure only one read of the local images runs at a time
+var toolsMutex sync.Mutex
+
+// initToolCache reads the local images into the cache. Their progress is reported by
+// GET /specs/scan-status, requests for single tools read their image on demand meanwhile.
+func initToolCache(ctx context.Context) {
+	toolsMutex.Lock()
+	defer toolsMutex.Unlock()
+
 	log.Println("Initializing tool cache...")
-	cacheInstance := viper.Get("cache").(*cache.Cache)
-	_, err := toolImage.ReadAllTools(ctx, cacheInstance, false)
+	_, err := readAllTools(ctx, false)
+	status := toolImage.CurrentScan()
 	if err != nil {
 		log.Printf("Warning: Failed to initialize tool cache: %v", err)
 	} else {
-		log.Println("Tool cache initialized successfully")
+		log.Printf("Tool cache initialized successfully, read %d images with %d tools in %s", status.Done, status.Tools, status.FinishedAt.Sub(*status.StartedAt).Round(time.Millisecond))
 	}
+}
+
+func startBackgroundTasks(ctx context.Context) {
+	// the server starts right away, the initial scan may take a while on hosts with many images
+	go func() {
+		initToolCache(ctx)
+		scanNewImages(ctx)
+	}()
 
 	startPeriodicTasks(ctx)
 }
 
 func startBackgroundTasksAndWait(ctx context.Context) {
 	// Initial cache population with waiting
-	log.Println("Initializing tool cache...")
-	cacheInstance := viper.Get("cache").(*cache.Cache)
-	_, err := toolImage.ReadAllTools(ctx, cacheInstance, false)
-	if err != nil {
-		log.Printf("Warning: Failed to initialize tool cache: %v", err)
-	} else {
-		log.Println("Tool cache initialized successfully")
-	}
+	initToolCache(ctx)
 
 	// Wait for cache to be marked as initialized
-	for !cacheInstance.IsInitialised() {
+	for !application.Cache.IsInitialised() {
 		log.Println("Waiting for cache initialization to complete...")
 		time.Sleep(time.Second)
 	}
@@ -85,31 +162,191 @@ func startBackgroundTasksAndWait(ctx context.Context) {
 	startPeriodicTasks(ctx)
 }
 
+// scanMutex makes sure only one scan of the cached images runs at a time
+var scanMutex sync.Mutex
+
+// scanNewImages scans the cached images without a scan result in the background,
+// if a scanner is configured and scan.on_discovery is enabled
+func scanNewImages(ctx context.Context) {
+	scanner := toolImage.ScannerFromConfig()
+	if scanner == nil || !viper.GetBool("scan.on_discovery") {
+		return
+	}
+	go func() {
+		if !scanMutex.TryLock() {
+			return
+		}
+		defer scanMutex.Unlock()
+		toolImage.ScanUnscannedImages(ctx, application.DB, application.Cache, scanner)
+	}()
+}
+
+// pruneOrphanedRunDirs removes the run directories without a run after files.orphan_grace_period
+func pruneOrphanedRunDirs(ctx context.Context) {
+	orphaned, err := tool.PruneRunDirs(ctx, application.DB, viper.GetDuration("files.orphan_grace_period"), false)
+	if err != nil {
+		log.Printf("failed to prune orphaned run directories: %v", err)
+		return
+	}
+	for _, dir := range orphaned {
+		if dir.Removed {
+			log.Printf("removed the orphaned run directory %s", dir.Path)
+		}
+	}
+}
+
+// storageMutex makes sure only one sync of the object storage runs at a time
+var storageMutex sync.Mutex
+
+// syncResultStorage retries the failed uploads of results in the background and removes
+// the local copies uploaded for longer than storage.s3.delete_local_after
+func syncResultStorage(ctx context.Context) {
+	go func() {
+		if !storageMutex.TryLock() {
+			return
+		}
+		defer storageMutex.Unlock()
+		if err := tool.RetryPendingUploads(ctx, application.DB); err != nil {
+			log.Printf("failed to upload the results of runs: %v", err)
+		}
+		grace := viper.GetDuration("storage.s3.delete_local_after")
+		if grace <= 0 {
+			return
+		}
+		removed, err := tool.RemoveUploadedResults(ctx, application.DB, grace)
+		if err != nil {
+			log.Printf("failed to remove the uploaded results of runs: %v", err)
+		}
+		for _, runID := range removed {
+			log.Printf("removed the local copies of the uploaded results of run %d", runID)
+		}
+	}()
+}
+
+// purgeTrashedRuns deletes the runs which are in the trash for longer than run.trash_retention
+func purgeTrashedRuns(ctx context.Context) {
+	retention := viper.GetDuration("run.trash_retention")
+	if retention <= 0 {
+		return
+	}
+	purged, err := tool.PurgeTrashedRuns(ctx, application.DB, retention)
+	if err != nil {
+		log.Printf("failed to purge trashed runs: %v", err)
+	}
+	for _, runID := range purged {
+		log.Printf("purged the trashed run %d", runID)
+	}
+}
+
+// expirePendingRuns expires the runs which were not started within run.pending_ttl
+func expirePendingRuns(ctx context.Context) {
+	ttl := viper.GetDuration("run.pending_ttl")
+	if ttl <= 0 {
+		return
+	}
+	expired, err := tool.ExpirePendingRuns(ctx, application.DB, ttl)
+	if err != nil {
+		log.Printf("failed to expire pending runs: %v", err)
+	}
+	for _, runID := range expired {
+		log.Printf("expired the pending run %d, it was not started within %s", runID, ttl)
+	}
+}
+
+// reapStaleContainers removes the containers gorun left behind after run.reap_grace_period
+func reapStaleContainers(ctx context.Context) {
+	stale, err := tool.ReapContainers(ctx, application.DB, viper.GetDuration("run.reap_grace_period"), false)
+	if err != nil {
+		log.Printf("failed to reap stale containers: %v", err)
+		return
+	}
+	for _, cont := range stale {
+		if cont.Removed {
+			log.Printf("removed the stale %s container %s", cont.Purpose, cont.ID)
+		}
+	}
+}
+
+// resumeQueuedRuns executes the runs again which were queued when the server stopped
+func resumeQueuedRuns(ctx context.Context) {
+	resumed, err := tool.ResumeQueuedRuns(ctx, application.DB)
+	if err != nil {
+		log.Printf("failed to resume the queued runs: %v", err)
+	}
+	for _, runID := range resumed {
+		log.Printf("resumed the queued run %d", runID)
+	}
+}
+
 func startPeriodicTasks(ctx context.Context) {
+	scanNewImages(ctx)
+	resumeQueuedRuns(ctx)
+
 	cleanupTicker := time.NewTicker(time.Minute * 5)
 	go func() {
 		for range cleanupTicker.C {
 			log.Println("Running cleanup")
-			err := files.Cleanup()
-			cobra.CheckErr(err)
+			if held, err := tool.HeldTempPaths(ctx, application.DB); err != nil {
+				log.Printf("failed to read the uploads of the unfinished runs, skipping the temp path: %v", err)
+			} else if err := files.Cleanup(held...); err != nil {
+				log.Printf("failed to clean the temp path: %v", err)
+			}
+			audit.Prune(ctx, application.DB)
+			purgeTrashedRuns(ctx)
+			expirePendingRuns(ctx)
+			syncResultStorage(ctx)
+			if viper.GetBool("files.prune_orphans") {
+				pruneOrphanedRunDirs(ctx)
+			}
+			if viper.GetBool("run.reap_containers") {
+				reapStaleContainers(ctx)
+			}
 		}
 	}()
 
 	toolsTicker := time.NewTicker(time.Minute * 5)
 	go func() {
 		for range toolsTicker.C {
+			// the initial scan may still be running on hosts with many images
+			if !toolsMutex.TryLock() {
+				continue
+			}
 			log.Println("Checking for new tools")
-			cacheInstance := viper.Get("cache").(*cache.Cache)
-			_, err := toolImage.ReadAllTools(ctx, cacheInstance, false)
-			cobra.CheckErr(err)
+			// an unreachable daemon must not stop the endpoints which do not need it
+			if _, err := readAllTools(ctx, false); err != nil {
+				log.Printf("failed to check for new tools: %v", err)
+			}
+			toolsMutex.Unlock()
+			scanNewImages(ctx)
 		}
 	}()
 
+	// the repositories of the catalog are read from their registries, the images are not pulled
+	if len(viper.GetStringSlice("catalog.repositories")) > 0 || viper.GetString("catalog.index_url") != "" {
+		go func() {
+			discoverCatalog(ctx)
+			scanNewImages(ctx)
+			catalogTicker := time.NewTicker(viper.GetDuration("catalog.interval"))
+			defer catalogTicker.Stop()
+			for range catalogTicker.C {
+				log.Println("Discovering the tools of the catalog")
+				discoverCatalog(ctx)
+				scanNewImages(ctx)
+			}
+		}()
+	}
+
+	// a single watchdog loop checks the containers of all running runs
+	go tool.NewWatchdog(application.DB).Run(ctx)
+
+	// the docker client is shared by the process, it is replaced while the daemon is unreachable
+	go dockerclient.Watch(ctx, 30*time.Second)
+
 	adminTicker := time.NewTicker(time.Minute * 50)
 	go func() {
 		for range adminTicker.C {
 			log.Println("Renewing admin credentials")
-			if _, err := auth.GetAdminCredentials(ctx); err != nil {
+			if _, err := auth.GetAdminCredentials(ctx, application.DB); err != nil {
 				log.Printf("Failed to renew admin credentials: %v...\n", err)
 			}
 		}
@@ -0,0 +1,51 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/hydrocode-de/gorun/internal/audit"
+	"github.com/hydrocode-de/gorun/internal/support"
+	"github.com/spf13/cobra"
+)
+
+var (
+	supportRunID     int64
+	supportOutput    string
+	supportServerLog string
+)
+
+var supportBundleCmd = &cobra.Command{
+	Use:   "support-bundle",
+	Short: "Write a redacted zip of the configuration, health and logs of the server for bug reports",
+	Run: func(cmd *cobra.Command, args []string) {
+		output := supportOutput
+		if output == "" {
+			output = fmt.Sprintf("gorun-support-%s.zip", time.Now().Format("20060102-150405"))
+		}
+		file, err := os.OpenFile(output, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		cobra.CheckErr(err)
+
+		opts := support.Options{RunID: supportRunID, ServerLog: supportServerLog}
+		err = support.Build(cmd.Context(), application.DB, opts, file)
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			os.Remove(output)
+			cobra.CheckErr(err)
+		}
+		recordCLIAudit(cmd, audit.ActionSupportBundle, opts.Target())
+		fmt.Printf("Wrote the support bundle %s\n", output)
+		fmt.Println("Secrets, tokens, e-mail addresses and home directories are redacted, check the bundle before sharing it.")
+	},
+}
+
+func init() {
+	supportBundleCmd.Flags().Int64Var(&supportRunID, "run", 0, "Add the detail, events and log tails of this run")
+	supportBundleCmd.Flags().StringVarP(&supportOutput, "output", "o", "", "The zip file to write (default: gorun-support-<timestamp>.zip)")
+	supportBundleCmd.Flags().StringVar(&supportServerLog, "server-log", "", "The log file of the server to include")
+
+	rootCmd.AddCommand(supportBundleCmd)
+}
@@ -1,15 +1,26 @@
 package cli
 
 import (
+	"context"
 	"fmt"
+	"log"
+	"slices"
 
-	"github.com/hydrocode-de/gorun/internal/cache"
+	"github.com/hydrocode-de/gorun/api"
+	"github.com/hydrocode-de/gorun/internal/db"
 	"github.com/hydrocode-de/gorun/internal/files"
+	"github.com/hydrocode-de/gorun/internal/tool"
 	"github.com/hydrocode-de/gorun/internal/toolImage"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
 
+var (
+	remoteTools  bool
+	discoverTags bool
+	toolStats    bool
+)
+
 var toolsCmd = &cobra.Command{
 	Use:   "tools",
 	Short: "Manage tools from the command line",
@@ -22,23 +33,140 @@ var listCmd = &cobra.Command{
 	Use:   "list",
 	Short: "List all available tools",
 	Run: func(cmd *cobra.Command, args []string) {
-		cache := viper.Get("cache").(*cache.Cache)
-		tools, err := toolImage.ReadAllTools(cmd.Context(), cache, viper.GetBool("verbose"))
+		if remoteTools {
+			var response api.ListToolSpecResponse
+			path := "/specs"
+			if toolStats {
+				path += "?stats=true"
+			}
+			cobra.CheckErr(remoteGet(cmd.Context(), path, &response))
+			if scan := response.ScanStatus; scan.State == toolImage.ScanInProgress {
+				fmt.Printf("The server is still scanning its images (%d of %d read), the list is incomplete\n", scan.Done, scan.Total)
+			}
+
+			fmt.Printf("Found %d tools:\n", response.Count)
+			for _, spec := range response.Tools {
+				fmt.Printf("|- %s%s%s%s\n", spec.ID, platformSuffix(spec.Platform), scanSuffix(spec.Scan), usageSuffix(spec.Usage))
+			}
+			return
+		}
+
+		tools, err := readAllTools(cmd.Context(), viper.GetBool("verbose"))
+		cobra.CheckErr(err)
+
+		fmt.Printf("Found %d tools:\n", len(tools))
+		for _, name := range tools {
+			platform, _ := application.Cache.GetPlatform(name)
+			var scan *db.ImageScan
+			if result, ok := toolImage.GetImageScan(cmd.Context(), application.DB, application.Cache, name); ok {
+				scan = &result
+			}
+			var usage *tool.ToolUsage
+			if toolStats {
+				result, err := tool.GetToolUsage(cmd.Context(), application.DB, name)
+				cobra.CheckErr(err)
+				usage = &result
+			}
+			fmt.Printf("|- %s%s%s%s\n", name, platformSuffix(platform), scanSuffix(scan), usageSuffix(usage))
+		}
+	},
+}
+
+// readAllTools scans the local images, which are allowed by the image policy
+func readAllTools(ctx context.Context, verbose bool) ([]string, error) {
+	policy, err := toolImage.LoadPolicy(ctx, application.DB)
+	if err != nil {
+		return nil, err
+	}
+	return toolImage.ReadAllTools(ctx, application.Cache, policy, verbose)
+}
+
+var discoverCmd = &cobra.Command{
+	Use:   "discover <registry/repository>",
+	Short: "Read the tool-specs of an image from its registry without pulling it",
+	Long: `Fetch the manifest of the image from the registry and read /src/tool.yml and
+/src/CITATION.cff from its layers, newest first, downloading only the layers up to
+the one containing the tool-spec. Without a tag, latest is read, --all-tags reads
+every tag of the repository. The logins of docker login are used.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		policy, err := toolImage.LoadPolicy(cmd.Context(), application.DB)
 		cobra.CheckErr(err)
+		tools, err := toolImage.DiscoverRegistryTools(cmd.Context(), args[0], discoverTags, application.Cache, policy)
+		if err != nil && len(tools) == 0 {
+			cobra.CheckErr(err)
+		}
+		if err != nil {
+			fmt.Printf("some images failed: %v\n", err)
+		}
 
+		slices.Sort(tools)
 		fmt.Printf("Found %d tools:\n", len(tools))
 		for _, name := range tools {
-			fmt.Printf("|- %s\n", name)
+			platform, _ := application.Cache.GetPlatform(name)
+			fmt.Printf("|- %s%s\n", name, platformSuffix(platform))
 		}
 	},
 }
 
+// discoverCatalog reads the tool-specs of the catalog.repositories from their registries
+// and merges the index of catalog.index_url
+func discoverCatalog(ctx context.Context) {
+	repositories := viper.GetStringSlice("catalog.repositories")
+	indexURL := viper.GetString("catalog.index_url")
+	if len(repositories) == 0 && indexURL == "" {
+		return
+	}
+	policy, err := toolImage.LoadPolicy(ctx, application.DB)
+	if err != nil {
+		log.Printf("failed to load the image policy: %v", err)
+		return
+	}
+	if indexURL != "" {
+		if _, err := toolImage.SyncCatalog(ctx, indexURL, application.Cache, policy); err != nil {
+			log.Printf("failed to sync the catalog %s: %v", indexURL, err)
+		}
+	}
+	for _, repository := range repositories {
+		if _, err := toolImage.DiscoverRegistryTools(ctx, repository, false, application.Cache, policy); err != nil {
+			log.Printf("failed to discover the tools of %s: %v", repository, err)
+		}
+	}
+}
+
+func scanSuffix(scan *db.ImageScan) string {
+	if scan == nil {
+		return ""
+	}
+	return fmt.Sprintf(" [%d critical, %d high vulnerabilities]", scan.Critical, scan.High)
+}
+
+func usageSuffix(usage *tool.ToolUsage) string {
+	if usage == nil {
+		return ""
+	}
+	suffix := fmt.Sprintf(" {%d runs, %d in the last 30 days, %d users", usage.TotalRuns, usage.RecentRuns, usage.DistinctUsers)
+	if usage.SuccessRate != nil {
+		suffix += fmt.Sprintf(", %.0f%% succeeded", *usage.SuccessRate*100)
+	}
+	return suffix + "}"
+}
+
+func platformSuffix(platform string) string {
+	if platform == "" {
+		return ""
+	}
+	return fmt.Sprintf(" (%s)", platform)
+}
+
 var cleanupCmd = &cobra.Command{
 	Use:   "cleanup",
 	Short: "Clean up temporary files",
 	Run: func(cmd *cobra.Command, args []string) {
 		fmt.Println("Running cleanup...")
-		err := files.Cleanup()
+		held, err := tool.HeldTempPaths(cmd.Context(), application.DB)
+		cobra.CheckErr(err)
+		err = files.Cleanup(held...)
 		cobra.CheckErr(err)
 		fmt.Println("Cleanup completed successfully")
 	},
@@ -47,8 +175,13 @@ var cleanupCmd = &cobra.Command{
 func init() {
 	listCmd.Flags().BoolVar(&verbose, "verbose", false, "Verbose output")
 	viper.BindPFlag("verbose", listCmd.Flags().Lookup("verbose"))
+	listCmd.Flags().BoolVar(&remoteTools, "remote", false, "Ask the server listening on the server.listen unix socket")
+	listCmd.Flags().BoolVar(&toolStats, "stats", false, "Include the runs and success rate of each tool")
+
+	discoverCmd.Flags().BoolVar(&discoverTags, "all-tags", false, "Read every tag of the repository")
 
 	toolsCmd.AddCommand(listCmd)
+	toolsCmd.AddCommand(discoverCmd)
 	toolsCmd.AddCommand(cleanupCmd)
 	rootCmd.AddCommand(toolsCmd)
 }
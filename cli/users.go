@@ -1,11 +1,15 @@
 package cli
 
 import (
+	"database/sql"
+	"errors"
 	"fmt"
 	"strings"
 
+	"github.com/hydrocode-de/gorun/internal/audit"
 	"github.com/hydrocode-de/gorun/internal/auth"
 	"github.com/hydrocode-de/gorun/internal/db"
+	"github.com/hydrocode-de/gorun/internal/tool"
 	"github.com/jedib0t/go-pretty/v6/table"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -17,16 +21,19 @@ var (
 	password  string
 	isAdmin   bool
 	delete    bool
+
+	runsPerMinute int64
+	resetLimit    bool
+	notifyEmail   bool
 )
 
 var userCmd = &cobra.Command{
 	Use:   "user",
 	Short: "Manage GoRun users",
 	Run: func(cmd *cobra.Command, args []string) {
-		DB := viper.Get("db").(*db.Queries)
 
 		if listUsers {
-			users, err := DB.GetAllUsers(cmd.Context())
+			users, err := application.DB.GetAllUsers(cmd.Context())
 			cobra.CheckErr(err)
 
 			t := table.NewWriter()
@@ -48,9 +55,9 @@ var userCmd = &cobra.Command{
 		var user db.User
 		var err error
 		if strings.Contains(args[0], "@") {
-			user, err = DB.GetUserByEmail(cmd.Context(), args[0])
+			user, err = application.DB.GetUserByEmail(cmd.Context(), args[0])
 		} else {
-			user, err = DB.GetUserByID(cmd.Context(), args[0])
+			user, err = application.DB.GetUserByID(cmd.Context(), args[0])
 		}
 		cobra.CheckErr(err)
 		if user == (db.User{}) {
@@ -58,8 +65,9 @@ var userCmd = &cobra.Command{
 		}
 
 		if delete {
-			err = DB.DeleteUser(cmd.Context(), user.ID)
+			err = application.DB.DeleteUser(cmd.Context(), user.ID)
 			cobra.CheckErr(err)
+			recordCLIAudit(cmd, audit.ActionUserDelete, "user:"+user.ID)
 			fmt.Println("User deleted successfully!")
 			return
 		}
@@ -67,14 +75,48 @@ var userCmd = &cobra.Command{
 		if password != "" {
 			hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 			cobra.CheckErr(err)
-			user, err = DB.UpdateUserPassword(cmd.Context(), db.UpdateUserPasswordParams{
+			user, err = application.DB.UpdateUserPassword(cmd.Context(), db.UpdateUserPasswordParams{
 				ID:           user.ID,
 				PasswordHash: string(hashedPassword),
 			})
 			cobra.CheckErr(err)
+			recordCLIAudit(cmd, audit.ActionUserPassword, "user:"+user.ID)
 			fmt.Println("Password updated!")
 		}
 
+		if cmd.Flags().Changed("runs-per-minute") {
+			err = application.DB.SetUserRunLimit(cmd.Context(), db.SetUserRunLimitParams{
+				UserID:        user.ID,
+				RunsPerMinute: runsPerMinute,
+			})
+			cobra.CheckErr(err)
+			recordCLIAudit(cmd, audit.ActionUserRateLimit, fmt.Sprintf("user:%s runs_per_minute=%d", user.ID, runsPerMinute))
+			fmt.Println("Rate limit updated!")
+		} else if resetLimit {
+			err = application.DB.DeleteUserRunLimit(cmd.Context(), user.ID)
+			cobra.CheckErr(err)
+			recordCLIAudit(cmd, audit.ActionUserRateLimit, "user:"+user.ID+" reset")
+			fmt.Println("Rate limit reset to limits.runs_per_minute!")
+		}
+		if cmd.Flags().Changed("notify-email") {
+			err = application.DB.SetUserEmailNotifications(cmd.Context(), db.SetUserEmailNotificationsParams{
+				UserID: user.ID,
+				Email:  notifyEmail,
+			})
+			cobra.CheckErr(err)
+			fmt.Println("Notification preference updated!")
+		}
+		preferences, err := application.DB.GetUserNotifications(cmd.Context(), user.ID)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			cobra.CheckErr(err)
+		}
+		limit, err := tool.RunLimit(cmd.Context(), application.DB, user.ID)
+		cobra.CheckErr(err)
+		limitText := "unlimited"
+		if limit > 0 {
+			limitText = fmt.Sprintf("%d", limit)
+		}
+
 		t := table.NewWriter()
 		t.SetStyle(table.StyleColoredMagentaWhiteOnBlack)
 		t.AppendHeader(table.Row{"Key", "Value"})
@@ -82,6 +124,8 @@ var userCmd = &cobra.Command{
 			{"ID", user.ID},
 			{"Email", user.Email},
 			{"Is Admin", user.IsAdmin},
+			{"Runs per minute", limitText},
+			{"Email notifications", preferences.Email},
 		})
 		fmt.Println(t.Render())
 	},
@@ -95,19 +139,31 @@ var createUserCmd = &cobra.Command{
 			cobra.CheckErr(fmt.Errorf("email is required"))
 		}
 
-		DB := viper.Get("db").(*db.Queries)
 		secret := viper.GetString("secret")
 
-		_, err := auth.CreateUser(cmd.Context(), DB, args[0], password, isAdmin, secret)
+		created, err := auth.CreateUser(cmd.Context(), application.DB, args[0], password, isAdmin, secret)
 		cobra.CheckErr(err)
+		recordCLIAudit(cmd, audit.ActionUserCreate, fmt.Sprintf("user:%s admin=%v", created.User.ID, isAdmin))
 		fmt.Println("User created successfully!")
 	},
 }
 
+// recordCLIAudit writes the audit entry of an action done on the command line
+func recordCLIAudit(cmd *cobra.Command, action audit.Action, target string) {
+	audit.Write(cmd.Context(), application.DB, audit.Entry{
+		Action:     action,
+		Target:     target,
+		RemoteAddr: audit.RemoteCLI,
+	})
+}
+
 func init() {
 	userCmd.Flags().BoolVarP(&listUsers, "list", "l", false, "List all users")
 	userCmd.Flags().StringVar(&password, "password", "", "Change the password for the selected user")
 	userCmd.Flags().BoolVarP(&delete, "delete", "d", false, "Delete the selected user")
+	userCmd.Flags().Int64Var(&runsPerMinute, "runs-per-minute", 0, "Override limits.runs_per_minute for the selected user, 0 means unlimited")
+	userCmd.Flags().BoolVar(&resetLimit, "reset-limit", false, "Remove the rate limit override of the selected user")
+	userCmd.Flags().BoolVar(&notifyEmail, "notify-email", false, "Email the selected user when a run completed")
 
 	createUserCmd.Flags().BoolVar(&isAdmin, "admin", false, "Create an admin user")
 	createUserCmd.Flags().StringVar(&password, "password", "", "The password for the new user")
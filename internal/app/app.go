@@ -0,0 +1,20 @@
+package app
+
+import (
+	"github.com/hydrocode-de/gorun/internal/cache"
+	"github.com/hydrocode-de/gorun/internal/db"
+)
+
+// App holds the live objects of a running gorun instance. It is created once
+// by the CLI and passed on, while viper only holds the configuration.
+type App struct {
+	DB    *db.Queries
+	Cache *cache.Cache
+}
+
+func New(DB *db.Queries, Cache *cache.Cache) *App {
+	return &App{
+		DB:    DB,
+		Cache: Cache,
+	}
+}
@@ -0,0 +1,159 @@
+package apptainer
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/spf13/viper"
+	"golang.org/x/sync/singleflight"
+)
+
+// Binary is the apptainer executable, set by apptainer.binary
+func Binary() string {
+	if binary := viper.GetString("apptainer.binary"); binary != "" {
+		return binary
+	}
+	return "apptainer"
+}
+
+// Version returns the version the apptainer executable reports
+func Version(ctx context.Context) (string, error) {
+	out, err := exec.CommandContext(ctx, Binary(), "--version").Output()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+var unsafeName = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// SIFPath is the file the image is converted to below apptainer.cache_path. The name is
+// made unique with a hash of the reference, as the sanitized references may collide.
+func SIFPath(imageName string) string {
+	sum := sha256.Sum256([]byte(imageName))
+	name := fmt.Sprintf("%s-%s.sif", unsafeName.ReplaceAllString(imageName, "_"), hex.EncodeToString(sum[:6]))
+	return filepath.Join(viper.GetString("apptainer.cache_path"), name)
+}
+
+// concurrent runs of the same image wait for a single pull
+var pulls singleflight.Group
+
+// Pull converts the Docker image into a SIF, unless it was converted already. The SIF
+// is written next to its final path first, so that an interrupted pull is not used.
+func Pull(ctx context.Context, imageName string) (string, error) {
+	sif := SIFPath(imageName)
+	if _, err := os.Stat(sif); err == nil {
+		return sif, nil
+	}
+	_, err, _ := pulls.Do(sif, func() (interface{}, error) {
+		if _, err := os.Stat(sif); err == nil {
+			return nil, nil
+		}
+		if err := os.MkdirAll(filepath.Dir(sif), 0o755); err != nil {
+			return nil, err
+		}
+		pulling := sif + ".pulling"
+		os.Remove(pulling)
+		out, err := exec.CommandContext(ctx, Binary(), "pull", "--force", pulling, "docker://"+imageName).CombinedOutput()
+		if err != nil {
+			os.Remove(pulling)
+			return nil, fmt.Errorf("apptainer could not pull %s: %w: %s", imageName, err, strings.TrimSpace(string(out)))
+		}
+		return nil, os.Rename(pulling, sif)
+	})
+	if err != nil {
+		return "", err
+	}
+	return sif, nil
+}
+
+// Bind is a host path bound into the container
+type Bind struct {
+	Source   string
+	Target   string
+	ReadOnly bool
+}
+
+func (b Bind) String() string {
+	if b.ReadOnly {
+		return fmt.Sprintf("%s:%s:ro", b.Source, b.Target)
+	}
+	return fmt.Sprintf("%s:%s", b.Source, b.Target)
+}
+
+// ExecOptions describe a single execution of a SIF
+type ExecOptions struct {
+	SIF     string
+	Binds   []Bind
+	Env     []string
+	WorkDir string
+	// Command is executed with apptainer exec. Without it, the runscript of the image is
+	// started, which runs the entrypoint and CMD of the Docker image.
+	Command []string
+	Stdout  io.Writer
+	Stderr  io.Writer
+}
+
+// Args are the arguments of the apptainer invocation. The container is isolated from the
+// home directory, the environment and the /tmp of the host.
+func (o ExecOptions) Args() []string {
+	args := []string{"run"}
+	if len(o.Command) != 0 {
+		args = []string{"exec"}
+	}
+	args = append(args, "--containall")
+	if o.WorkDir != "" {
+		args = append(args, "--pwd", o.WorkDir)
+	}
+	for _, env := range o.Env {
+		args = append(args, "--env", env)
+	}
+	for _, bind := range o.Binds {
+		args = append(args, "--bind", bind.String())
+	}
+	args = append(args, o.SIF)
+	return append(args, o.Command...)
+}
+
+// Exec runs the SIF and returns the exit code of the command. An error is only returned
+// if apptainer could not be started or ctx is done.
+func Exec(ctx context.Context, opts ExecOptions) (int64, error) {
+	cmd := exec.CommandContext(ctx, Binary(), opts.Args()...)
+	cmd.Stdout, cmd.Stderr = opts.Stdout, opts.Stderr
+	err := cmd.Run()
+	if ctx.Err() != nil {
+		return -1, ctx.Err()
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return int64(exitErr.ExitCode()), nil
+	}
+	if err != nil {
+		return -1, err
+	}
+	return 0, nil
+}
+
+// Output executes the command in the SIF and returns its stdout. A non-zero exit code is
+// returned as error along with stderr.
+func Output(ctx context.Context, sif string, command ...string) ([]byte, error) {
+	stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+	exitCode, err := Exec(ctx, ExecOptions{SIF: sif, Command: command, Stdout: stdout, Stderr: stderr})
+	if err != nil {
+		return nil, err
+	}
+	if exitCode != 0 {
+		return stdout.Bytes(), fmt.Errorf("%s exited with status %d in %s: %s", command[0], exitCode, sif, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
@@ -0,0 +1,103 @@
+package audit
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/hydrocode-de/gorun/internal/db"
+	"github.com/spf13/viper"
+)
+
+// Action identifies a security relevant action in the audit log
+type Action string
+
+const (
+	ActionRunCreate          Action = "run.create"
+	ActionRunStart           Action = "run.start"
+	ActionRunDelete          Action = "run.delete"
+	ActionRunTrash           Action = "run.trash"
+	ActionRunRestore         Action = "run.restore"
+	ActionRunPurge           Action = "run.purge"
+	ActionRunCommandOverride Action = "run.command_override"
+	ActionResultDownload     Action = "result.download"
+	ActionResultShare        Action = "result.share"
+	ActionResultUnshare      Action = "result.unshare"
+	ActionResultAnnotate     Action = "result.annotate"
+	ActionTokenIssue         Action = "token.issue"
+	ActionUserCreate         Action = "user.create"
+	ActionUserDelete         Action = "user.delete"
+	ActionUserPassword       Action = "user.password"
+	ActionUserRateLimit      Action = "user.rate_limit"
+	ActionImageAllow         Action = "image.allow"
+	ActionImageDeny          Action = "image.deny"
+	ActionImageScan          Action = "image.scan"
+	ActionProjectCreate      Action = "project.create"
+	ActionProjectUpdate      Action = "project.update"
+	ActionProjectDelete      Action = "project.delete"
+	ActionProjectMemberAdd   Action = "project.member_add"
+	ActionProjectMemberDrop  Action = "project.member_remove"
+	ActionSupportBundle      Action = "support.bundle"
+)
+
+// RemoteCLI is recorded as the remote address of actions done with the gorun CLI
+const RemoteCLI = "cli"
+
+// Entry is a single record of who did what to which target
+type Entry struct {
+	UserID     string
+	Action     Action
+	Target     string
+	RemoteAddr string
+	RequestID  string
+}
+
+// Write stores the entry. Failures are logged and never returned, as the audit
+// log must not fail the action itself.
+func Write(ctx context.Context, DB *db.Queries, entry Entry) {
+	err := DB.CreateAuditEntry(ctx, db.CreateAuditEntryParams{
+		UserID:     entry.UserID,
+		Action:     string(entry.Action),
+		Target:     entry.Target,
+		RemoteAddr: entry.RemoteAddr,
+		RequestID:  entry.RequestID,
+	})
+	if err != nil {
+		log.Printf("failed to write the audit entry %s %s of user %s: %v", entry.Action, entry.Target, entry.UserID, err)
+	}
+}
+
+// pending counts the entries Record is still writing
+var pending sync.WaitGroup
+
+// Record writes the entry in the background, so that the request does not wait for it
+func Record(ctx context.Context, DB *db.Queries, entry Entry) {
+	pending.Add(1)
+	go func() {
+		defer pending.Done()
+		Write(context.WithoutCancel(ctx), DB, entry)
+	}()
+}
+
+// Wait blocks until the entries recorded in the background are written
+func Wait() {
+	pending.Wait()
+}
+
+// Prune deletes the entries older than audit.retention. A retention of 0 keeps all entries.
+func Prune(ctx context.Context, DB *db.Queries) {
+	retention := viper.GetDuration("audit.retention")
+	if retention <= 0 {
+		return
+	}
+	cutoff := time.Now().UTC().Add(-retention).Format(time.DateTime)
+	deleted, err := DB.DeleteAuditEntriesBefore(ctx, cutoff)
+	if err != nil {
+		log.Printf("failed to prune the audit log: %v", err)
+		return
+	}
+	if deleted > 0 {
+		log.Printf("pruned %d audit entries older than %s", deleted, retention)
+	}
+}
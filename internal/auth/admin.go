@@ -21,8 +21,7 @@ type AdminCredentials struct {
 	ExpiresAt    time.Time `json:"expiresAt"`
 }
 
-func createNewAdminUser(ctx context.Context) (UserLoginResponse, error) {
-	DB := viper.Get("db").(*db.Queries)
+func createNewAdminUser(ctx context.Context, DB *db.Queries) (UserLoginResponse, error) {
 	JWTSecret := viper.GetString("secret")
 
 	// Generate a random password for the admin user
@@ -49,9 +48,8 @@ func createNewAdminUser(ctx context.Context) (UserLoginResponse, error) {
 	return response, nil
 }
 
-func CreateAdminCredentials(ctx context.Context) (*AdminCredentials, error) {
+func CreateAdminCredentials(ctx context.Context, DB *db.Queries) (*AdminCredentials, error) {
 	basePath := viper.GetString("path")
-	DB := viper.Get("db").(*db.Queries)
 
 	// Check if admin credentials file exists
 	credentialsPath := filepath.Join(basePath, "admin_credentials.json")
@@ -59,7 +57,7 @@ func CreateAdminCredentials(ctx context.Context) (*AdminCredentials, error) {
 	// Try to load existing credentials
 	if _, err := os.Stat(credentialsPath); err == nil {
 		// File exists, try to load it
-		credentials, err := GetAdminCredentials(ctx)
+		credentials, err := GetAdminCredentials(ctx, DB)
 		if err == nil && credentials != nil {
 			// Check if the credentials are still valid
 			if time.Now().Before(credentials.ExpiresAt) {
@@ -74,7 +72,7 @@ func CreateAdminCredentials(ctx context.Context) (*AdminCredentials, error) {
 
 	if err != nil {
 		// Admin user doesn't exist, create it
-		adminResponse, err = createNewAdminUser(ctx)
+		adminResponse, err = createNewAdminUser(ctx, DB)
 		if err != nil {
 			return nil, fmt.Errorf("failed to create admin user: %w", err)
 		}
@@ -123,7 +121,7 @@ func CreateAdminCredentials(ctx context.Context) (*AdminCredentials, error) {
 	return credentials, nil
 }
 
-func GetAdminCredentials(ctx context.Context) (*AdminCredentials, error) {
+func GetAdminCredentials(ctx context.Context, DB *db.Queries) (*AdminCredentials, error) {
 	basePath := viper.GetString("path")
 	credentialsPath := filepath.Join(basePath, "admin_credentials.json")
 
@@ -147,7 +145,6 @@ func GetAdminCredentials(ctx context.Context) (*AdminCredentials, error) {
 
 	// Check if credentials are expired
 	if time.Now().After(credentials.ExpiresAt) {
-		DB := viper.Get("db").(*db.Queries)
 		JWTSecret := viper.GetString("secret")
 
 		// Try to refresh the token
@@ -3,22 +3,32 @@ package auth
 import (
 	"context"
 	"fmt"
+	"slices"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/hydrocode-de/gorun/internal/db"
 )
 
-func CreateJWT(refreshToken string, secretKey string, validFor time.Duration, DB *db.Queries, ctx context.Context) (string, error) {
+// CreateJWT issues an access token for the user of the refresh token. If scopes is
+// not nil, the token is restricted to these scopes.
+func CreateJWT(refreshToken string, secretKey string, validFor time.Duration, scopes []string, DB *db.Queries, ctx context.Context) (string, error) {
 	user, err := DB.GetRefreshTokenUser(ctx, refreshToken)
 	if err != nil {
 		return "", err
 	}
+	if slices.Contains(scopes, ScopeAdmin) && !user.IsAdmin {
+		return "", fmt.Errorf("the %s scope can only be granted to admins", ScopeAdmin)
+	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+	claims := jwt.MapClaims{
 		"user_id": user.ID,
 		"exp":     time.Now().Add(validFor).Unix(),
-	})
+	}
+	if scopes != nil {
+		claims["scopes"] = scopes
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	tokenString, err := token.SignedString([]byte(secretKey))
 	if err != nil {
 		return "", err
@@ -28,22 +38,38 @@ func CreateJWT(refreshToken string, secretKey string, validFor time.Duration, DB
 }
 
 func ValidateJWT(tokenString string, secretKey string) (string, error) {
+	userId, _, err := ValidateScopedJWT(tokenString, secretKey)
+	return userId, err
+}
+
+// ValidateScopedJWT validates the access token and returns its user and scopes
+func ValidateScopedJWT(tokenString string, secretKey string) (string, TokenScopes, error) {
 	var claims jwt.MapClaims
 	token, err := jwt.ParseWithClaims(tokenString, &claims, func(token *jwt.Token) (interface{}, error) {
 		return []byte(secretKey), nil
 	})
 	if err != nil {
-		return "", err
+		return "", TokenScopes{}, err
 	}
 
 	if !token.Valid {
-		return "", fmt.Errorf("invalid token")
+		return "", TokenScopes{}, fmt.Errorf("invalid token")
 	}
 
 	userId, ok := claims["user_id"].(string)
 	if !ok {
-		return "", fmt.Errorf("user_id claim not found")
+		return "", TokenScopes{}, fmt.Errorf("user_id claim not found")
 	}
 
-	return userId, nil
+	claimed, ok := claims["scopes"].([]interface{})
+	if !ok {
+		return userId, TokenScopes{Unrestricted: true}, nil
+	}
+	scopes := TokenScopes{Scopes: make([]string, 0, len(claimed))}
+	for _, scope := range claimed {
+		if name, ok := scope.(string); ok {
+			scopes.Scopes = append(scopes.Scopes, name)
+		}
+	}
+	return userId, scopes, nil
 }
@@ -0,0 +1,74 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+const (
+	ScopeRunsRead    = "runs:read"
+	ScopeRunsWrite   = "runs:write"
+	ScopeResultsRead = "results:read"
+	ScopeSpecsRead   = "specs:read"
+	// ScopeAdmin grants the admin only endpoints to tokens of admins
+	ScopeAdmin = "admin"
+)
+
+var AllScopes = []string{ScopeRunsRead, ScopeRunsWrite, ScopeResultsRead, ScopeSpecsRead, ScopeAdmin}
+
+// ParseScopes reads a comma separated list of scopes. An empty list returns nil,
+// which issues a token without a scopes claim.
+func ParseScopes(list string) ([]string, error) {
+	var scopes []string
+	for _, scope := range strings.Split(list, ",") {
+		scope = strings.TrimSpace(scope)
+		if scope == "" {
+			continue
+		}
+		if !slices.Contains(AllScopes, scope) {
+			return nil, fmt.Errorf("unknown scope %s. Use one of %s", scope, strings.Join(AllScopes, ", "))
+		}
+		if !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes, nil
+}
+
+type scopesKey struct{}
+
+// TokenScopes are the scopes of the access token of a request. Unrestricted tokens
+// were issued without a scopes claim. Anonymous requests carry no valid token, they
+// only reach the public endpoints.
+type TokenScopes struct {
+	Scopes       []string
+	Unrestricted bool
+	Anonymous    bool
+}
+
+// WithScopes stores the scopes of the validated access token in the context
+func WithScopes(ctx context.Context, scopes TokenScopes) context.Context {
+	return context.WithValue(ctx, scopesKey{}, scopes)
+}
+
+// HasScope checks the scopes of the access token of the request. Requests which were
+// not authenticated have no scopes and are denied, anonymous requests of the public
+// endpoints pass. Tokens without a scopes claim have full access, unless
+// auth.require_scopes is set.
+func HasScope(ctx context.Context, scope string) bool {
+	scopes, ok := ctx.Value(scopesKey{}).(TokenScopes)
+	if !ok {
+		return false
+	}
+	if scopes.Anonymous {
+		return true
+	}
+	if scopes.Unrestricted {
+		return !viper.GetBool("auth.require_scopes")
+	}
+	return slices.Contains(scopes.Scopes, scope)
+}
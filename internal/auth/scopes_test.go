@@ -0,0 +1,50 @@
+package auth
+
+import (
+	"context"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestHasScope(t *testing.T) {
+	tests := []struct {
+		name          string
+		ctx           context.Context
+		requireScopes bool
+		want          bool
+	}{
+		{name: "no token", ctx: context.Background(), want: false},
+		{name: "anonymous", ctx: WithScopes(context.Background(), TokenScopes{Anonymous: true}), want: true},
+		{name: "unrestricted", ctx: WithScopes(context.Background(), TokenScopes{Unrestricted: true}), want: true},
+		{name: "unrestricted with required scopes", ctx: WithScopes(context.Background(), TokenScopes{Unrestricted: true}), requireScopes: true, want: false},
+		{name: "granted", ctx: WithScopes(context.Background(), TokenScopes{Scopes: []string{ScopeRunsRead, ScopeRunsWrite}}), want: true},
+		{name: "not granted", ctx: WithScopes(context.Background(), TokenScopes{Scopes: []string{ScopeResultsRead}}), want: false},
+		{name: "empty scopes", ctx: WithScopes(context.Background(), TokenScopes{Scopes: []string{}}), requireScopes: true, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			viper.Set("auth.require_scopes", tt.requireScopes)
+			t.Cleanup(viper.Reset)
+			if got := HasScope(tt.ctx, ScopeRunsWrite); got != tt.want {
+				t.Errorf("HasScope is %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseScopes(t *testing.T) {
+	scopes, err := ParseScopes(" runs:read, results:read,runs:read,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(scopes) != 2 || scopes[0] != ScopeRunsRead || scopes[1] != ScopeResultsRead {
+		t.Errorf("the scopes are %v", scopes)
+	}
+	if scopes, err := ParseScopes(""); err != nil || scopes != nil {
+		t.Errorf("an empty list returned %v, %v", scopes, err)
+	}
+	if _, err := ParseScopes("runs:delete"); err == nil {
+		t.Error("an unknown scope was accepted")
+	}
+}
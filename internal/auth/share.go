@@ -0,0 +1,26 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
+// SignRunFiles signs the access to the result files of a single run until expires.
+// The signature is revoked with the run, as run IDs are never reused.
+func SignRunFiles(runID int64, expires time.Time, secretKey string) string {
+	mac := hmac.New(sha256.New, []byte(secretKey))
+	fmt.Fprintf(mac, "run-files:%d:%d", runID, expires.Unix())
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyRunFiles checks a signature created by SignRunFiles and its expiry
+func VerifyRunFiles(runID int64, expires int64, signature string, secretKey string) bool {
+	if time.Now().Unix() > expires {
+		return false
+	}
+	expected := SignRunFiles(runID, time.Unix(expires, 0), secretKey)
+	return hmac.Equal([]byte(expected), []byte(signature))
+}
@@ -15,6 +15,7 @@ type UserLoginResponse struct {
 	AccessToken  string    `json:"access_token"`
 	ExpiresAt    time.Time `json:"expires_at"`
 	RefreshToken string    `json:"refresh_token"`
+	Scopes       []string  `json:"scopes,omitempty"`
 }
 
 func CreateUser(ctx context.Context, DB *db.Queries, email, password string, isAdmin bool, jwtSecret string) (UserLoginResponse, error) {
@@ -46,7 +47,8 @@ func CreateUser(ctx context.Context, DB *db.Queries, email, password string, isA
 	return NewJWTFromRefreshToken(ctx, DB, refreshToken, jwtSecret)
 }
 
-func LoginUser(ctx context.Context, DB *db.Queries, email, password, jwtSecret string) (UserLoginResponse, error) {
+// LoginUser issues an access token for the user. If scopes is not nil, the token is restricted to these scopes.
+func LoginUser(ctx context.Context, DB *db.Queries, email, password, jwtSecret string, scopes []string) (UserLoginResponse, error) {
 	user, err := DB.GetUserByEmail(ctx, email)
 	if err != nil {
 		return UserLoginResponse{}, fmt.Errorf("user not found")
@@ -62,16 +64,21 @@ func LoginUser(ctx context.Context, DB *db.Queries, email, password, jwtSecret s
 		return UserLoginResponse{}, fmt.Errorf("failed to get refresh tokens. Contact an admin to set a new refresh token")
 	}
 
-	return NewJWTFromRefreshToken(ctx, DB, refreshTokens[0].Token, jwtSecret)
+	return NewScopedJWTFromRefreshToken(ctx, DB, refreshTokens[0].Token, jwtSecret, scopes)
 }
 
 func NewJWTFromRefreshToken(ctx context.Context, DB *db.Queries, refreshToken string, jwtSecret string) (UserLoginResponse, error) {
+	return NewScopedJWTFromRefreshToken(ctx, DB, refreshToken, jwtSecret, nil)
+}
+
+// NewScopedJWTFromRefreshToken issues an access token restricted to the scopes, or an unrestricted one if scopes is nil
+func NewScopedJWTFromRefreshToken(ctx context.Context, DB *db.Queries, refreshToken string, jwtSecret string, scopes []string) (UserLoginResponse, error) {
 	user, err := DB.GetRefreshTokenUser(ctx, refreshToken)
 	if err != nil {
 		return UserLoginResponse{}, err
 	}
 
-	accessToken, err := CreateJWT(refreshToken, jwtSecret, time.Hour*1, DB, ctx)
+	accessToken, err := CreateJWT(refreshToken, jwtSecret, time.Hour*1, scopes, DB, ctx)
 	if err != nil {
 		return UserLoginResponse{}, err
 	}
@@ -85,5 +92,6 @@ func NewJWTFromRefreshToken(ctx context.Context, DB *db.Queries, refreshToken st
 		AccessToken:  accessToken,
 		ExpiresAt:    time.Now().Add(time.Hour * 1),
 		RefreshToken: refreshToken,
+		Scopes:       scopes,
 	}, nil
 }
@@ -1,29 +1,79 @@
 package cache
 
 import (
+	"slices"
+	"strings"
 	"sync"
 
+	"github.com/hydrocode-de/gorun/internal/db"
+	"github.com/hydrocode-de/gorun/internal/outputs"
+	"github.com/hydrocode-de/gorun/internal/specversion"
 	toolspec "github.com/hydrocode-de/tool-spec-go"
 )
 
+// the sources a spec is read from
+const (
+	SourceLocal    = "local"
+	SourceRegistry = "registry"
+	SourceCatalog  = "catalog"
+)
+
+// Origin tells where the spec of an image was read from and if the image is on the Docker host
+type Origin struct {
+	Source    string
+	Available bool
+	// Reader is how a local spec was read: from a label, with gotap or from /src/tool.yml
+	Reader string
+	// ImageID is the ID of the local image the spec was read from, to notice rebuilt tags
+	ImageID string
+}
+
 type Cache struct {
-	mu          sync.RWMutex
-	images      map[string]toolspec.SpecFile
-	tools       map[string]toolspec.ToolSpec
+	mu        sync.RWMutex
+	images    map[string]toolspec.SpecFile
+	tools     map[string]toolspec.ToolSpec
+	compat    map[string]specversion.Compatibility
+	platforms map[string]string
+	scans     map[string]db.ImageScan
+	outputs   map[string]map[string]map[string]outputs.Spec
+	commands  map[string]map[string][]string
+	paramEnv  map[string]map[string]bool
+	origins   map[string]Origin
+	// aliases map the other tags of an image to the canonical tag its spec is cached under
+	aliases     map[string]string
 	Initialised bool
+
+	// generation is bumped by every change of the cached specs and invalidates the responses
+	generation uint64
+	responses  map[string][]byte
+}
+
+// resolve replaces an alias tag of an image or of a tool slug by its canonical tag.
+// The caller holds the lock.
+func (c *Cache) resolve(key string) string {
+	imageName, toolName, isSlug := strings.Cut(key, "::")
+	canonical, ok := c.aliases[imageName]
+	if !ok {
+		return key
+	}
+	if isSlug {
+		return canonical + "::" + toolName
+	}
+	return canonical
 }
 
 func (c *Cache) GetToolSpec(key string) (*toolspec.ToolSpec, bool) {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 
-	spec, ok := c.tools[key]
+	spec, ok := c.tools[c.resolve(key)]
 	return &spec, ok
 }
 
 func (c *Cache) SetToolSpec(key string, spec *toolspec.ToolSpec) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
+	c.bump()
 
 	c.tools[key] = *spec
 }
@@ -32,8 +82,23 @@ func (c *Cache) ListToolSpecs() []toolspec.ToolSpec {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 
+	// the local images cached under several tags are listed once, by their ID
+	listed := make(map[string]string)
+	for imageName, origin := range c.origins {
+		if origin.Source != SourceLocal || origin.ImageID == "" {
+			continue
+		}
+		if other, ok := listed[origin.ImageID]; !ok || imageName < other {
+			listed[origin.ImageID] = imageName
+		}
+	}
+
 	specs := make([]toolspec.ToolSpec, 0)
-	for _, spec := range c.tools {
+	for slug, spec := range c.tools {
+		imageName, _, _ := strings.Cut(slug, "::")
+		if origin, ok := c.origins[imageName]; ok && origin.Source == SourceLocal && origin.ImageID != "" && listed[origin.ImageID] != imageName {
+			continue
+		}
 		specs = append(specs, spec)
 	}
 	return specs
@@ -43,24 +108,299 @@ func (c *Cache) GetImageSpec(key string) (*toolspec.SpecFile, bool) {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 
-	spec, ok := c.images[key]
+	spec, ok := c.images[c.resolve(key)]
 	return &spec, ok
 }
 
 func (c *Cache) SetImageSpec(key string, spec toolspec.SpecFile) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
+	c.bump()
 
 	c.images[key] = spec
 }
 
+func (c *Cache) SetImageCompatibility(key string, compat specversion.Compatibility) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.bump()
+
+	c.compat[key] = compat
+}
+
+// GetCompatibility returns the spec version assessment of an image or of a
+// tool slug like <image-name>::<tool-name>
+func (c *Cache) GetCompatibility(key string) (specversion.Compatibility, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	imageName, _, _ := strings.Cut(c.resolve(key), "::")
+	compat, ok := c.compat[imageName]
+	return compat, ok
+}
+
+func (c *Cache) SetImagePlatform(key string, platform string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.bump()
+
+	c.platforms[key] = platform
+}
+
+// GetPlatform returns the os/arch platform of an image or of a tool slug
+func (c *Cache) GetPlatform(key string) (string, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	imageName, _, _ := strings.Cut(c.resolve(key), "::")
+	platform, ok := c.platforms[imageName]
+	return platform, ok
+}
+
+func (c *Cache) SetImageScan(key string, scan db.ImageScan) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.bump()
+
+	c.scans[key] = scan
+}
+
+// GetScan returns the vulnerability scan of an image or of a tool slug
+func (c *Cache) GetScan(key string) (db.ImageScan, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	imageName, _, _ := strings.Cut(c.resolve(key), "::")
+	scan, ok := c.scans[imageName]
+	return scan, ok
+}
+
+// SetImageOutputs stores the declared outputs of the tools of an image
+func (c *Cache) SetImageOutputs(key string, declared map[string]map[string]outputs.Spec) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.bump()
+
+	c.outputs[key] = declared
+}
+
+// GetOutputs returns the declared outputs of a tool slug like <image-name>::<tool-name>
+func (c *Cache) GetOutputs(key string) (map[string]outputs.Spec, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	imageName, toolName, _ := strings.Cut(c.resolve(key), "::")
+	declared, ok := c.outputs[imageName][toolName]
+	return declared, ok
+}
+
+// SetImageCommands stores the commands the tools of an image declare
+func (c *Cache) SetImageCommands(key string, declared map[string][]string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.bump()
+
+	c.commands[key] = declared
+}
+
+// GetCommand returns the declared command of a tool slug like <image-name>::<tool-name>
+func (c *Cache) GetCommand(key string) ([]string, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	imageName, toolName, _ := strings.Cut(c.resolve(key), "::")
+	command, ok := c.commands[imageName][toolName]
+	return command, ok
+}
+
+// SetImageParamEnv stores which tools of an image ask for their parameters as environment variables
+func (c *Cache) SetImageParamEnv(key string, declared map[string]bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.bump()
+
+	c.paramEnv[key] = declared
+}
+
+// GetParamEnv tells if the tool slug like <image-name>::<tool-name> asks for its parameters as environment variables
+func (c *Cache) GetParamEnv(key string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	imageName, toolName, _ := strings.Cut(c.resolve(key), "::")
+	return c.paramEnv[imageName][toolName]
+}
+
+// SetImageOrigin stores where the spec of an image was read from
+func (c *Cache) SetImageOrigin(key string, origin Origin) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.bump()
+
+	c.origins[key] = origin
+}
+
+// GetOrigin returns the origin of an image or of a tool slug
+func (c *Cache) GetOrigin(key string) (Origin, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	imageName, _, _ := strings.Cut(c.resolve(key), "::")
+	origin, ok := c.origins[imageName]
+	return origin, ok
+}
+
+// SetImageAliases replaces the other tags of the image with the canonical tag. The specs
+// cached under these tags before are dropped, they resolve to the canonical one now.
+func (c *Cache) SetImageAliases(canonical string, aliases []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.bump()
+
+	for alias, target := range c.aliases {
+		if target == canonical {
+			delete(c.aliases, alias)
+		}
+	}
+	for _, alias := range aliases {
+		if alias == canonical {
+			continue
+		}
+		c.removeImage(alias)
+		c.aliases[alias] = canonical
+	}
+}
+
+// AddImageAlias lets another tag of an image resolve to its canonical tag
+func (c *Cache) AddImageAlias(alias string, canonical string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.bump()
+
+	c.removeImage(alias)
+	c.aliases[alias] = canonical
+}
+
+// GetImageAliases returns the other tags of an image or of a tool slug, sorted
+func (c *Cache) GetImageAliases(key string) []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	canonical, _, _ := strings.Cut(c.resolve(key), "::")
+	aliases := make([]string, 0)
+	for alias, target := range c.aliases {
+		if target == canonical {
+			aliases = append(aliases, alias)
+		}
+	}
+	slices.Sort(aliases)
+	return aliases
+}
+
+// FindLocalImage returns the tag the spec of a local image is cached under, by the image ID
+func (c *Cache) FindLocalImage(imageID string) (string, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	for imageName, origin := range c.origins {
+		if origin.Source == SourceLocal && origin.ImageID == imageID {
+			return imageName, true
+		}
+	}
+	return "", false
+}
+
+// RemoveImage drops the spec of an image and its tools, e.g. before a rebuilt image is read again
+func (c *Cache) RemoveImage(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.bump()
+
+	c.removeImage(key)
+	for alias, target := range c.aliases {
+		if target == key {
+			delete(c.aliases, alias)
+		}
+	}
+}
+
+// removeImage drops the entries cached under the tag, the caller holds the lock
+func (c *Cache) removeImage(key string) {
+	delete(c.aliases, key)
+	delete(c.images, key)
+	delete(c.compat, key)
+	delete(c.platforms, key)
+	delete(c.outputs, key)
+	delete(c.commands, key)
+	delete(c.paramEnv, key)
+	delete(c.origins, key)
+	for slug := range c.tools {
+		if imageName, _, _ := strings.Cut(slug, "::"); imageName == key {
+			delete(c.tools, slug)
+		}
+	}
+}
+
+func (c *Cache) ListImageNames() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	names := make([]string, 0, len(c.images))
+	for name := range c.images {
+		names = append(names, name)
+	}
+	return names
+}
+
 func (c *Cache) Reset() {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
 	c.tools = make(map[string]toolspec.ToolSpec)
 	c.images = make(map[string]toolspec.SpecFile)
+	c.compat = make(map[string]specversion.Compatibility)
+	c.platforms = make(map[string]string)
+	c.scans = make(map[string]db.ImageScan)
+	c.outputs = make(map[string]map[string]map[string]outputs.Spec)
+	c.commands = make(map[string]map[string][]string)
+	c.paramEnv = make(map[string]map[string]bool)
+	c.origins = make(map[string]Origin)
+	c.aliases = make(map[string]string)
 	c.Initialised = false
+	c.bump()
+}
+
+// bump starts a new generation, the caller holds the write lock
+func (c *Cache) bump() {
+	c.generation++
+	c.responses = make(map[string][]byte)
+}
+
+// Generation changes whenever the cached specs change
+func (c *Cache) Generation() uint64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.generation
+}
+
+// GetResponse returns a serialized response stored in the current generation
+func (c *Cache) GetResponse(key string) ([]byte, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	body, ok := c.responses[key]
+	return body, ok
+}
+
+// SetResponse stores a serialized response, unless the cache changed since generation
+func (c *Cache) SetResponse(key string, generation uint64, body []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if generation == c.generation {
+		c.responses[key] = body
+	}
 }
 
 func (c *Cache) IsInitialised() bool {
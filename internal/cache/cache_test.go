@@ -0,0 +1,72 @@
+package cache
+
+import (
+	"testing"
+
+	"github.com/hydrocode-de/gorun/internal/db"
+	"github.com/hydrocode-de/gorun/internal/specversion"
+	toolspec "github.com/hydrocode-de/tool-spec-go"
+)
+
+// every change of the cached specs starts a new generation and drops the stored responses
+func TestGenerationInvalidatesResponses(t *testing.T) {
+	changes := map[string]func(c *Cache){
+		"tool spec":     func(c *Cache) { c.SetToolSpec("img:1::echo", &toolspec.ToolSpec{ID: "img:1::echo"}) },
+		"image spec":    func(c *Cache) { c.SetImageSpec("img:1", toolspec.SpecFile{}) },
+		"compatibility": func(c *Cache) { c.SetImageCompatibility("img:1", specversion.Compatibility{}) },
+		"platform":      func(c *Cache) { c.SetImagePlatform("img:1", "linux/amd64") },
+		"scan":          func(c *Cache) { c.SetImageScan("img:1", db.ImageScan{}) },
+		"outputs":       func(c *Cache) { c.SetImageOutputs("img:1", nil) },
+		"commands":      func(c *Cache) { c.SetImageCommands("img:1", nil) },
+		"param env":     func(c *Cache) { c.SetImageParamEnv("img:1", nil) },
+		"origin":        func(c *Cache) { c.SetImageOrigin("img:1", Origin{Source: SourceLocal}) },
+		"aliases":       func(c *Cache) { c.SetImageAliases("img:1", []string{"img:latest"}) },
+		"alias":         func(c *Cache) { c.AddImageAlias("img:latest", "img:1") },
+		"removal":       func(c *Cache) { c.RemoveImage("img:1") },
+		"reset":         func(c *Cache) { c.Reset() },
+	}
+	for name, change := range changes {
+		t.Run(name, func(t *testing.T) {
+			c := &Cache{}
+			c.Reset()
+			generation := c.Generation()
+			c.SetResponse("specs", generation, []byte("{}"))
+			if _, ok := c.GetResponse("specs"); !ok {
+				t.Fatal("the response of the current generation was not stored")
+			}
+
+			change(c)
+			if c.Generation() <= generation {
+				t.Errorf("the generation stayed at %d", c.Generation())
+			}
+			if _, ok := c.GetResponse("specs"); ok {
+				t.Errorf("the response of the last generation is still returned")
+			}
+			// a response built before the change is not stored
+			c.SetResponse("specs", generation, []byte("{}"))
+			if _, ok := c.GetResponse("specs"); ok {
+				t.Errorf("a response of the last generation was stored")
+			}
+		})
+	}
+}
+
+// reading the cache does not change the generation
+func TestGenerationOfReads(t *testing.T) {
+	c := &Cache{}
+	c.Reset()
+	c.SetToolSpec("img:1::echo", &toolspec.ToolSpec{ID: "img:1::echo"})
+	generation := c.Generation()
+	c.SetResponse("specs", generation, []byte("{}"))
+
+	c.GetToolSpec("img:1::echo")
+	c.ListToolSpecs()
+	c.GetImageAliases("img:1")
+	c.SetInitialised(true)
+	if c.Generation() != generation {
+		t.Errorf("the reads changed the generation from %d to %d", generation, c.Generation())
+	}
+	if _, ok := c.GetResponse("specs"); !ok {
+		t.Errorf("the reads dropped the stored response")
+	}
+}
@@ -9,6 +9,44 @@ import (
 	"time"
 )
 
+type AuditLog struct {
+	ID         int64     `json:"id"`
+	UserID     string    `json:"userId"`
+	Action     string    `json:"action"`
+	Target     string    `json:"target"`
+	RemoteAddr string    `json:"remoteAddr"`
+	RequestID  string    `json:"requestId"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+type ImagePolicy struct {
+	Pattern   string    `json:"pattern"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type ImageScan struct {
+	Image     string    `json:"image"`
+	Scanner   string    `json:"scanner"`
+	Critical  int64     `json:"critical"`
+	High      int64     `json:"high"`
+	ScannedAt time.Time `json:"scannedAt"`
+}
+
+type Project struct {
+	ID          int64     `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	OwnerID     string    `json:"ownerId"`
+	Personal    bool      `json:"personal"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+type ProjectMember struct {
+	ProjectID int64     `json:"projectId"`
+	UserID    string    `json:"userId"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
 type RefreshToken struct {
 	ID        int64     `json:"id"`
 	UserID    string    `json:"userId"`
@@ -19,22 +57,117 @@ type RefreshToken struct {
 }
 
 type Run struct {
-	ID            int64          `json:"id"`
-	Name          string         `json:"name"`
-	Title         string         `json:"title"`
-	Description   string         `json:"description"`
-	DockerImage   string         `json:"dockerImage"`
-	Mounts        string         `json:"mounts"`
-	Parameters    string         `json:"parameters"`
-	Data          string         `json:"data"`
-	CreatedAt     time.Time      `json:"createdAt"`
-	StartedAt     sql.NullTime   `json:"startedAt"`
-	FinishedAt    sql.NullTime   `json:"finishedAt"`
-	Status        string         `json:"status"`
-	HasErrored    bool           `json:"hasErrored"`
-	ErrorMessage  sql.NullString `json:"errorMessage"`
-	UserID        string         `json:"userId"`
-	GotapMetadata sql.NullString `json:"gotapMetadata"`
+	ID                   int64           `json:"id"`
+	Name                 string          `json:"name"`
+	Title                string          `json:"title"`
+	Description          string          `json:"description"`
+	DockerImage          string          `json:"dockerImage"`
+	Mounts               string          `json:"mounts"`
+	Parameters           string          `json:"parameters"`
+	Data                 string          `json:"data"`
+	CreatedAt            time.Time       `json:"createdAt"`
+	StartedAt            sql.NullTime    `json:"startedAt"`
+	FinishedAt           sql.NullTime    `json:"finishedAt"`
+	Status               string          `json:"status"`
+	HasErrored           bool            `json:"hasErrored"`
+	ErrorMessage         sql.NullString  `json:"errorMessage"`
+	UserID               string          `json:"userId"`
+	GotapMetadata        sql.NullString  `json:"gotapMetadata"`
+	DurationMs           sql.NullInt64   `json:"durationMs"`
+	Options              string          `json:"options"`
+	ExitCode             sql.NullInt64   `json:"exitCode"`
+	ErrorKind            sql.NullString  `json:"errorKind"`
+	Attempts             int64           `json:"attempts"`
+	ContainerID          sql.NullString  `json:"containerId"`
+	ExecutionEnvironment sql.NullString  `json:"executionEnvironment"`
+	ExecutionStrategy    sql.NullString  `json:"executionStrategy"`
+	ProjectID            sql.NullInt64   `json:"projectId"`
+	DeletedAt            sql.NullTime    `json:"deletedAt"`
+	Progress             sql.NullFloat64 `json:"progress"`
+	StoragePending       bool            `json:"storagePending"`
+	ImageDigest          sql.NullString  `json:"imageDigest"`
+	RunDir               sql.NullString  `json:"runDir"`
+}
+
+type RunDeletion struct {
+	RunID     int64     `json:"runId"`
+	Step      string    `json:"step"`
+	Error     string    `json:"error"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+type RunEvent struct {
+	ID        int64     `json:"id"`
+	RunID     int64     `json:"runId"`
+	Type      string    `json:"type"`
+	Message   string    `json:"message"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type RunInput struct {
+	RunID   int64  `json:"runId"`
+	Content string `json:"content"`
+}
+
+type RunOutput struct {
+	RunID        int64     `json:"runId"`
+	Complete     bool      `json:"complete"`
+	Verification string    `json:"verification"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+type RunResult struct {
+	RunID        int64     `json:"runId"`
+	RelPath      string    `json:"relPath"`
+	ObjectKey    string    `json:"objectKey"`
+	Size         int64     `json:"size"`
+	Checksum     string    `json:"checksum"`
+	Format       string    `json:"format"`
+	MimeType     string    `json:"mimeType"`
+	UploadedAt   time.Time `json:"uploadedAt"`
+	LocalRemoved bool      `json:"localRemoved"`
+}
+
+type RunResultAnnotation struct {
+	RunID     int64     `json:"runId"`
+	RelPath   string    `json:"relPath"`
+	IsPrimary bool      `json:"isPrimary"`
+	Label     string    `json:"label"`
+	Source    string    `json:"source"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+type RunShare struct {
+	Token     string       `json:"token"`
+	RunID     int64        `json:"runId"`
+	UserID    string       `json:"userId"`
+	CreatedAt time.Time    `json:"createdAt"`
+	ExpiresAt sql.NullTime `json:"expiresAt"`
+}
+
+type RunStat struct {
+	RunID           int64     `json:"runId"`
+	Samples         int64     `json:"samples"`
+	PeakMemoryBytes int64     `json:"peakMemoryBytes"`
+	AvgCpuPercent   float64   `json:"avgCpuPercent"`
+	BlockReadBytes  int64     `json:"blockReadBytes"`
+	BlockWriteBytes int64     `json:"blockWriteBytes"`
+	NetRxBytes      int64     `json:"netRxBytes"`
+	NetTxBytes      int64     `json:"netTxBytes"`
+	Finalized       bool      `json:"finalized"`
+	UpdatedAt       time.Time `json:"updatedAt"`
+	OutputBytes     int64     `json:"outputBytes"`
+}
+
+type ToolUsage struct {
+	Tool             string        `json:"tool"`
+	TotalRuns        int64         `json:"totalRuns"`
+	RecentRuns       int64         `json:"recentRuns"`
+	FinishedRuns     int64         `json:"finishedRuns"`
+	ErroredRuns      int64         `json:"erroredRuns"`
+	MedianDurationMs sql.NullInt64 `json:"medianDurationMs"`
+	DistinctUsers    int64         `json:"distinctUsers"`
+	ComputedAt       time.Time     `json:"computedAt"`
 }
 
 type User struct {
@@ -45,3 +178,21 @@ type User struct {
 	CreatedAt    time.Time    `json:"createdAt"`
 	LastLogin    sql.NullTime `json:"lastLogin"`
 }
+
+type UserLimit struct {
+	UserID        string `json:"userId"`
+	RunsPerMinute int64  `json:"runsPerMinute"`
+}
+
+type UserNotification struct {
+	UserID          string `json:"userId"`
+	Email           bool   `json:"email"`
+	SlackWebhookUrl string `json:"slackWebhookUrl"`
+	MatrixRoomID    string `json:"matrixRoomId"`
+}
+
+type UserSetting struct {
+	UserID    string    `json:"userId"`
+	Settings  string    `json:"settings"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
@@ -8,23 +8,69 @@ package db
 import (
 	"context"
 	"database/sql"
+	"time"
 )
 
+const cancelRun = `-- name: CancelRun :execrows
+UPDATE runs SET status = 'cancelled', error_message = ?, error_kind = 'cancelled', finished_at = datetime('now')
+WHERE runs.id = ? AND runs.status IN ('pending', 'queued', 'running')
+`
+
+type CancelRunParams struct {
+	ErrorMessage sql.NullString `json:"errorMessage"`
+	ID           int64          `json:"id"`
+}
+
+func (q *Queries) CancelRun(ctx context.Context, arg CancelRunParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, cancelRun, arg.ErrorMessage, arg.ID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const claimRun = `-- name: ClaimRun :execrows
+UPDATE runs SET status = 'queued'
+WHERE id = ? AND status = 'pending' AND deleted_at IS NULL
+`
+
+func (q *Queries) ClaimRun(ctx context.Context, id int64) (int64, error) {
+	result, err := q.db.ExecContext(ctx, claimRun, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const countExpiredRuns = `-- name: CountExpiredRuns :one
+SELECT COUNT(*) FROM runs
+WHERE status = 'expired' AND deleted_at IS NULL
+`
+
+func (q *Queries) CountExpiredRuns(ctx context.Context) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countExpiredRuns)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
 const createRun = `-- name: CreateRun :one
-INSERT INTO runs (name, title, description, docker_image, parameters, data, mounts, created_at, user_id)
-VALUES (?,?,?,?,?,?,?,datetime('now'),?)
-RETURNING id, name, title, description, docker_image, mounts, parameters, data, created_at, started_at, finished_at, status, has_errored, error_message, user_id, gotap_metadata
+INSERT INTO runs (name, title, description, docker_image, parameters, data, mounts, options, created_at, user_id, project_id)
+VALUES (?,?,?,?,?,?,?,?,datetime('now'),?,?)
+RETURNING id, name, title, description, docker_image, mounts, parameters, data, created_at, started_at, finished_at, status, has_errored, error_message, user_id, gotap_metadata, duration_ms, options, exit_code, error_kind, attempts, container_id, execution_environment, execution_strategy, project_id, deleted_at, progress, storage_pending, image_digest, run_dir
 `
 
 type CreateRunParams struct {
-	Name        string `json:"name"`
-	Title       string `json:"title"`
-	Description string `json:"description"`
-	DockerImage string `json:"dockerImage"`
-	Parameters  string `json:"parameters"`
-	Data        string `json:"data"`
-	Mounts      string `json:"mounts"`
-	UserID      string `json:"userId"`
+	Name        string        `json:"name"`
+	Title       string        `json:"title"`
+	Description string        `json:"description"`
+	DockerImage string        `json:"dockerImage"`
+	Parameters  string        `json:"parameters"`
+	Data        string        `json:"data"`
+	Mounts      string        `json:"mounts"`
+	Options     string        `json:"options"`
+	UserID      string        `json:"userId"`
+	ProjectID   sql.NullInt64 `json:"projectId"`
 }
 
 func (q *Queries) CreateRun(ctx context.Context, arg CreateRunParams) (Run, error) {
@@ -36,7 +82,9 @@ func (q *Queries) CreateRun(ctx context.Context, arg CreateRunParams) (Run, erro
 		arg.Parameters,
 		arg.Data,
 		arg.Mounts,
+		arg.Options,
 		arg.UserID,
+		arg.ProjectID,
 	)
 	var i Run
 	err := row.Scan(
@@ -56,6 +104,20 @@ func (q *Queries) CreateRun(ctx context.Context, arg CreateRunParams) (Run, erro
 		&i.ErrorMessage,
 		&i.UserID,
 		&i.GotapMetadata,
+		&i.DurationMs,
+		&i.Options,
+		&i.ExitCode,
+		&i.ErrorKind,
+		&i.Attempts,
+		&i.ContainerID,
+		&i.ExecutionEnvironment,
+		&i.ExecutionStrategy,
+		&i.ProjectID,
+		&i.DeletedAt,
+		&i.Progress,
+		&i.StoragePending,
+		&i.ImageDigest,
+		&i.RunDir,
 	)
 	return i, err
 }
@@ -79,49 +141,111 @@ func (q *Queries) DeleteRun(ctx context.Context, arg DeleteRunParams) error {
 	return err
 }
 
-const finishRun = `-- name: FinishRun :one
+const expireRun = `-- name: ExpireRun :execrows
+UPDATE runs SET status = 'expired', error_message = ?
+WHERE id = ? AND status = 'pending'
+`
+
+type ExpireRunParams struct {
+	ErrorMessage sql.NullString
+	ID           int64
+}
+
+func (q *Queries) ExpireRun(ctx context.Context, arg ExpireRunParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, expireRun, arg.ErrorMessage, arg.ID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const finishRun = `-- name: FinishRun :execrows
 UPDATE runs SET status = 'finished', finished_at = datetime('now')
-WHERE runs.id = ?
-RETURNING id, name, title, description, docker_image, mounts, parameters, data, created_at, started_at, finished_at, status, has_errored, error_message, user_id, gotap_metadata
+WHERE runs.id = ? AND runs.status = 'running'
 `
 
-func (q *Queries) FinishRun(ctx context.Context, id int64) (Run, error) {
-	row := q.db.QueryRowContext(ctx, finishRun, id)
-	var i Run
-	err := row.Scan(
-		&i.ID,
-		&i.Name,
-		&i.Title,
-		&i.Description,
-		&i.DockerImage,
-		&i.Mounts,
-		&i.Parameters,
-		&i.Data,
-		&i.CreatedAt,
-		&i.StartedAt,
-		&i.FinishedAt,
-		&i.Status,
-		&i.HasErrored,
-		&i.ErrorMessage,
-		&i.UserID,
-		&i.GotapMetadata,
-	)
-	return i, err
+func (q *Queries) FinishRun(ctx context.Context, id int64) (int64, error) {
+	result, err := q.db.ExecContext(ctx, finishRun, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const getActiveRuns = `-- name: GetActiveRuns :many
+SELECT id, name, title, description, docker_image, mounts, parameters, data, created_at, started_at, finished_at, status, has_errored, error_message, user_id, gotap_metadata, duration_ms, options, exit_code, error_kind, attempts, container_id, execution_environment, execution_strategy, project_id, deleted_at, progress, storage_pending, image_digest, run_dir FROM runs
+WHERE status = 'running'
+`
+
+func (q *Queries) GetActiveRuns(ctx context.Context) ([]Run, error) {
+	rows, err := q.db.QueryContext(ctx, getActiveRuns)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Run
+	for rows.Next() {
+		var i Run
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.Title,
+			&i.Description,
+			&i.DockerImage,
+			&i.Mounts,
+			&i.Parameters,
+			&i.Data,
+			&i.CreatedAt,
+			&i.StartedAt,
+			&i.FinishedAt,
+			&i.Status,
+			&i.HasErrored,
+			&i.ErrorMessage,
+			&i.UserID,
+			&i.GotapMetadata,
+			&i.DurationMs,
+			&i.Options,
+			&i.ExitCode,
+			&i.ErrorKind,
+			&i.Attempts,
+			&i.ContainerID,
+			&i.ExecutionEnvironment,
+			&i.ExecutionStrategy,
+			&i.ProjectID,
+			&i.DeletedAt,
+			&i.Progress,
+			&i.StoragePending,
+			&i.ImageDigest,
+			&i.RunDir,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
 }
 
 const getAllRuns = `-- name: GetAllRuns :many
-SELECT r.id, r.name, r.title, r.description, r.docker_image, r.mounts, r.parameters, r.data, r.created_at, r.started_at, r.finished_at, r.status, r.has_errored, r.error_message, r.user_id, r.gotap_metadata FROM runs r
+SELECT r.id, r.name, r.title, r.description, r.docker_image, r.mounts, r.parameters, r.data, r.created_at, r.started_at, r.finished_at, r.status, r.has_errored, r.error_message, r.user_id, r.gotap_metadata, r.duration_ms, r.options, r.exit_code, r.error_kind, r.attempts, r.container_id, r.execution_environment, r.execution_strategy, r.project_id, r.deleted_at, r.progress, r.storage_pending, r.image_digest, r.run_dir FROM runs r
 WHERE (SELECT u.is_admin FROM users u WHERE u.id = ?) = TRUE 
    OR r.user_id = ?
+   OR r.project_id IN (SELECT m.project_id FROM project_members m WHERE m.user_id = ?)
 `
 
 type GetAllRunsParams struct {
-	ID     string `json:"id"`
-	UserID string `json:"userId"`
+	ID       string `json:"id"`
+	UserID   string `json:"userId"`
+	UserID_2 string `json:"userId2"`
 }
 
 func (q *Queries) GetAllRuns(ctx context.Context, arg GetAllRunsParams) ([]Run, error) {
-	rows, err := q.db.QueryContext(ctx, getAllRuns, arg.ID, arg.UserID)
+	rows, err := q.db.QueryContext(ctx, getAllRuns, arg.ID, arg.UserID, arg.UserID_2)
 	if err != nil {
 		return nil, err
 	}
@@ -146,6 +270,20 @@ func (q *Queries) GetAllRuns(ctx context.Context, arg GetAllRunsParams) ([]Run,
 			&i.ErrorMessage,
 			&i.UserID,
 			&i.GotapMetadata,
+			&i.DurationMs,
+			&i.Options,
+			&i.ExitCode,
+			&i.ErrorKind,
+			&i.Attempts,
+			&i.ContainerID,
+			&i.ExecutionEnvironment,
+			&i.ExecutionStrategy,
+			&i.ProjectID,
+			&i.DeletedAt,
+			&i.Progress,
+			&i.StoragePending,
+			&i.ImageDigest,
+			&i.RunDir,
 		); err != nil {
 			return nil, err
 		}
@@ -161,7 +299,7 @@ func (q *Queries) GetAllRuns(ctx context.Context, arg GetAllRunsParams) ([]Run,
 }
 
 const getErroredRuns = `-- name: GetErroredRuns :many
-SELECT r.id, r.name, r.title, r.description, r.docker_image, r.mounts, r.parameters, r.data, r.created_at, r.started_at, r.finished_at, r.status, r.has_errored, r.error_message, r.user_id, r.gotap_metadata FROM runs r
+SELECT r.id, r.name, r.title, r.description, r.docker_image, r.mounts, r.parameters, r.data, r.created_at, r.started_at, r.finished_at, r.status, r.has_errored, r.error_message, r.user_id, r.gotap_metadata, r.duration_ms, r.options, r.exit_code, r.error_kind, r.attempts, r.container_id, r.execution_environment, r.execution_strategy, r.project_id, r.deleted_at, r.progress, r.storage_pending, r.image_digest, r.run_dir FROM runs r
 WHERE r.status = 'errored' AND (
   (SELECT u.is_admin FROM users u WHERE u.id = ?) = TRUE 
   OR r.user_id = ?
@@ -199,6 +337,79 @@ func (q *Queries) GetErroredRuns(ctx context.Context, arg GetErroredRunsParams)
 			&i.ErrorMessage,
 			&i.UserID,
 			&i.GotapMetadata,
+			&i.DurationMs,
+			&i.Options,
+			&i.ExitCode,
+			&i.ErrorKind,
+			&i.Attempts,
+			&i.ContainerID,
+			&i.ExecutionEnvironment,
+			&i.ExecutionStrategy,
+			&i.ProjectID,
+			&i.DeletedAt,
+			&i.Progress,
+			&i.StoragePending,
+			&i.ImageDigest,
+			&i.RunDir,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getExpiredTrashedRuns = `-- name: GetExpiredTrashedRuns :many
+SELECT id, name, title, description, docker_image, mounts, parameters, data, created_at, started_at, finished_at, status, has_errored, error_message, user_id, gotap_metadata, duration_ms, options, exit_code, error_kind, attempts, container_id, execution_environment, execution_strategy, project_id, deleted_at, progress, storage_pending, image_digest, run_dir FROM runs
+WHERE deleted_at IS NOT NULL AND datetime(deleted_at) < datetime(?1)
+`
+
+func (q *Queries) GetExpiredTrashedRuns(ctx context.Context, cutoff interface{}) ([]Run, error) {
+	rows, err := q.db.QueryContext(ctx, getExpiredTrashedRuns, cutoff)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Run
+	for rows.Next() {
+		var i Run
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.Title,
+			&i.Description,
+			&i.DockerImage,
+			&i.Mounts,
+			&i.Parameters,
+			&i.Data,
+			&i.CreatedAt,
+			&i.StartedAt,
+			&i.FinishedAt,
+			&i.Status,
+			&i.HasErrored,
+			&i.ErrorMessage,
+			&i.UserID,
+			&i.GotapMetadata,
+			&i.DurationMs,
+			&i.Options,
+			&i.ExitCode,
+			&i.ErrorKind,
+			&i.Attempts,
+			&i.ContainerID,
+			&i.ExecutionEnvironment,
+			&i.ExecutionStrategy,
+			&i.ProjectID,
+			&i.DeletedAt,
+			&i.Progress,
+			&i.StoragePending,
+			&i.ImageDigest,
+			&i.RunDir,
 		); err != nil {
 			return nil, err
 		}
@@ -214,7 +425,7 @@ func (q *Queries) GetErroredRuns(ctx context.Context, arg GetErroredRunsParams)
 }
 
 const getFinishedRuns = `-- name: GetFinishedRuns :many
-SELECT r.id, r.name, r.title, r.description, r.docker_image, r.mounts, r.parameters, r.data, r.created_at, r.started_at, r.finished_at, r.status, r.has_errored, r.error_message, r.user_id, r.gotap_metadata FROM runs r
+SELECT r.id, r.name, r.title, r.description, r.docker_image, r.mounts, r.parameters, r.data, r.created_at, r.started_at, r.finished_at, r.status, r.has_errored, r.error_message, r.user_id, r.gotap_metadata, r.duration_ms, r.options, r.exit_code, r.error_kind, r.attempts, r.container_id, r.execution_environment, r.execution_strategy, r.project_id, r.deleted_at, r.progress, r.storage_pending, r.image_digest, r.run_dir FROM runs r
 WHERE r.status = 'finished' AND (
   (SELECT u.is_admin FROM users u WHERE u.id = ?) = TRUE 
   OR r.user_id = ?
@@ -252,6 +463,20 @@ func (q *Queries) GetFinishedRuns(ctx context.Context, arg GetFinishedRunsParams
 			&i.ErrorMessage,
 			&i.UserID,
 			&i.GotapMetadata,
+			&i.DurationMs,
+			&i.Options,
+			&i.ExitCode,
+			&i.ErrorKind,
+			&i.Attempts,
+			&i.ContainerID,
+			&i.ExecutionEnvironment,
+			&i.ExecutionStrategy,
+			&i.ProjectID,
+			&i.DeletedAt,
+			&i.Progress,
+			&i.StoragePending,
+			&i.ImageDigest,
+			&i.RunDir,
 		); err != nil {
 			return nil, err
 		}
@@ -267,7 +492,7 @@ func (q *Queries) GetFinishedRuns(ctx context.Context, arg GetFinishedRunsParams
 }
 
 const getIdleRuns = `-- name: GetIdleRuns :many
-SELECT r.id, r.name, r.title, r.description, r.docker_image, r.mounts, r.parameters, r.data, r.created_at, r.started_at, r.finished_at, r.status, r.has_errored, r.error_message, r.user_id, r.gotap_metadata FROM runs r
+SELECT r.id, r.name, r.title, r.description, r.docker_image, r.mounts, r.parameters, r.data, r.created_at, r.started_at, r.finished_at, r.status, r.has_errored, r.error_message, r.user_id, r.gotap_metadata, r.duration_ms, r.options, r.exit_code, r.error_kind, r.attempts, r.container_id, r.execution_environment, r.execution_strategy, r.project_id, r.deleted_at, r.progress, r.storage_pending, r.image_digest, r.run_dir FROM runs r
 WHERE r.status = 'pending' AND (
   (SELECT u.is_admin FROM users u WHERE u.id = ?) = TRUE 
   OR r.user_id = ?
@@ -305,6 +530,129 @@ func (q *Queries) GetIdleRuns(ctx context.Context, arg GetIdleRunsParams) ([]Run
 			&i.ErrorMessage,
 			&i.UserID,
 			&i.GotapMetadata,
+			&i.DurationMs,
+			&i.Options,
+			&i.ExitCode,
+			&i.ErrorKind,
+			&i.Attempts,
+			&i.ContainerID,
+			&i.ExecutionEnvironment,
+			&i.ExecutionStrategy,
+			&i.ProjectID,
+			&i.DeletedAt,
+			&i.Progress,
+			&i.StoragePending,
+			&i.ImageDigest,
+			&i.RunDir,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getProjectRun = `-- name: GetProjectRun :one
+SELECT r.id, r.name, r.title, r.description, r.docker_image, r.mounts, r.parameters, r.data, r.created_at, r.started_at, r.finished_at, r.status, r.has_errored, r.error_message, r.user_id, r.gotap_metadata, r.duration_ms, r.options, r.exit_code, r.error_kind, r.attempts, r.container_id, r.execution_environment, r.execution_strategy, r.project_id, r.deleted_at, r.progress, r.storage_pending, r.image_digest, r.run_dir FROM runs r
+JOIN project_members m ON m.project_id = r.project_id
+WHERE r.id = ? AND m.user_id = ?
+`
+
+type GetProjectRunParams struct {
+	ID     int64  `json:"id"`
+	UserID string `json:"userId"`
+}
+
+func (q *Queries) GetProjectRun(ctx context.Context, arg GetProjectRunParams) (Run, error) {
+	row := q.db.QueryRowContext(ctx, getProjectRun, arg.ID, arg.UserID)
+	var i Run
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.Title,
+		&i.Description,
+		&i.DockerImage,
+		&i.Mounts,
+		&i.Parameters,
+		&i.Data,
+		&i.CreatedAt,
+		&i.StartedAt,
+		&i.FinishedAt,
+		&i.Status,
+		&i.HasErrored,
+		&i.ErrorMessage,
+		&i.UserID,
+		&i.GotapMetadata,
+		&i.DurationMs,
+		&i.Options,
+		&i.ExitCode,
+		&i.ErrorKind,
+		&i.Attempts,
+		&i.ContainerID,
+		&i.ExecutionEnvironment,
+		&i.ExecutionStrategy,
+		&i.ProjectID,
+		&i.DeletedAt,
+		&i.Progress,
+		&i.StoragePending,
+		&i.ImageDigest,
+		&i.RunDir,
+	)
+	return i, err
+}
+
+const getQueuedRuns = `-- name: GetQueuedRuns :many
+SELECT id, name, title, description, docker_image, mounts, parameters, data, created_at, started_at, finished_at, status, has_errored, error_message, user_id, gotap_metadata, duration_ms, options, exit_code, error_kind, attempts, container_id, execution_environment, execution_strategy, project_id, deleted_at, progress, storage_pending, image_digest, run_dir FROM runs
+WHERE status = 'queued'
+ORDER BY id
+`
+
+func (q *Queries) GetQueuedRuns(ctx context.Context) ([]Run, error) {
+	rows, err := q.db.QueryContext(ctx, getQueuedRuns)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Run
+	for rows.Next() {
+		var i Run
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.Title,
+			&i.Description,
+			&i.DockerImage,
+			&i.Mounts,
+			&i.Parameters,
+			&i.Data,
+			&i.CreatedAt,
+			&i.StartedAt,
+			&i.FinishedAt,
+			&i.Status,
+			&i.HasErrored,
+			&i.ErrorMessage,
+			&i.UserID,
+			&i.GotapMetadata,
+			&i.DurationMs,
+			&i.Options,
+			&i.ExitCode,
+			&i.ErrorKind,
+			&i.Attempts,
+			&i.ContainerID,
+			&i.ExecutionEnvironment,
+			&i.ExecutionStrategy,
+			&i.ProjectID,
+			&i.DeletedAt,
+			&i.Progress,
+			&i.StoragePending,
+			&i.ImageDigest,
+			&i.RunDir,
 		); err != nil {
 			return nil, err
 		}
@@ -320,7 +668,7 @@ func (q *Queries) GetIdleRuns(ctx context.Context, arg GetIdleRunsParams) ([]Run
 }
 
 const getRun = `-- name: GetRun :one
-SELECT r.id, r.name, r.title, r.description, r.docker_image, r.mounts, r.parameters, r.data, r.created_at, r.started_at, r.finished_at, r.status, r.has_errored, r.error_message, r.user_id, r.gotap_metadata FROM runs r
+SELECT r.id, r.name, r.title, r.description, r.docker_image, r.mounts, r.parameters, r.data, r.created_at, r.started_at, r.finished_at, r.status, r.has_errored, r.error_message, r.user_id, r.gotap_metadata, r.duration_ms, r.options, r.exit_code, r.error_kind, r.attempts, r.container_id, r.execution_environment, r.execution_strategy, r.project_id, r.deleted_at, r.progress, r.storage_pending, r.image_digest, r.run_dir FROM runs r
 WHERE r.id = ? AND (
   (SELECT u.is_admin FROM users u WHERE u.id = ?) = TRUE 
   OR r.user_id = ?
@@ -353,12 +701,219 @@ func (q *Queries) GetRun(ctx context.Context, arg GetRunParams) (Run, error) {
 		&i.ErrorMessage,
 		&i.UserID,
 		&i.GotapMetadata,
+		&i.DurationMs,
+		&i.Options,
+		&i.ExitCode,
+		&i.ErrorKind,
+		&i.Attempts,
+		&i.ContainerID,
+		&i.ExecutionEnvironment,
+		&i.ExecutionStrategy,
+		&i.ProjectID,
+		&i.DeletedAt,
+		&i.Progress,
+		&i.StoragePending,
+		&i.ImageDigest,
+		&i.RunDir,
 	)
 	return i, err
 }
 
+const getRunErrors = `-- name: GetRunErrors :many
+SELECT id, user_id,
+    CAST(COALESCE(error_kind, '') AS TEXT) AS error_kind,
+    CAST(COALESCE(error_message, '') AS TEXT) AS error_message,
+    finished_at
+FROM runs
+WHERE status = 'errored'
+AND datetime(finished_at) >= datetime(?1)
+AND datetime(finished_at) < datetime(?2)
+ORDER BY finished_at, id
+`
+
+type GetRunErrorsParams struct {
+	WindowStart interface{} `json:"windowStart"`
+	WindowEnd   interface{} `json:"windowEnd"`
+}
+
+type GetRunErrorsRow struct {
+	ID           int64        `json:"id"`
+	UserID       string       `json:"userId"`
+	ErrorKind    string       `json:"errorKind"`
+	ErrorMessage string       `json:"errorMessage"`
+	FinishedAt   sql.NullTime `json:"finishedAt"`
+}
+
+func (q *Queries) GetRunErrors(ctx context.Context, arg GetRunErrorsParams) ([]GetRunErrorsRow, error) {
+	rows, err := q.db.QueryContext(ctx, getRunErrors, arg.WindowStart, arg.WindowEnd)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetRunErrorsRow
+	for rows.Next() {
+		var i GetRunErrorsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.ErrorKind,
+			&i.ErrorMessage,
+			&i.FinishedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getRunMounts = `-- name: GetRunMounts :many
+SELECT id, mounts FROM runs
+`
+
+type GetRunMountsRow struct {
+	ID     int64  `json:"id"`
+	Mounts string `json:"mounts"`
+}
+
+func (q *Queries) GetRunMounts(ctx context.Context) ([]GetRunMountsRow, error) {
+	rows, err := q.db.QueryContext(ctx, getRunMounts)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetRunMountsRow
+	for rows.Next() {
+		var i GetRunMountsRow
+		if err := rows.Scan(&i.ID, &i.Mounts); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getRunOwner = `-- name: GetRunOwner :one
+SELECT user_id FROM runs
+WHERE id = ?
+`
+
+func (q *Queries) GetRunOwner(ctx context.Context, id int64) (string, error) {
+	row := q.db.QueryRowContext(ctx, getRunOwner, id)
+	var user_id string
+	err := row.Scan(&user_id)
+	return user_id, err
+}
+
+const getRunStatusByID = `-- name: GetRunStatusByID :one
+SELECT status FROM runs
+WHERE id = ?
+`
+
+func (q *Queries) GetRunStatusByID(ctx context.Context, id int64) (string, error) {
+	row := q.db.QueryRowContext(ctx, getRunStatusByID, id)
+	var status string
+	err := row.Scan(&status)
+	return status, err
+}
+
+const getRunSummaries = `-- name: GetRunSummaries :many
+SELECT r.id, r.name, r.title, r.description, r.docker_image, r.created_at, r.started_at, r.finished_at, r.status,
+  r.gotap_metadata, r.duration_ms, r.exit_code, r.error_message, r.error_kind, r.attempts, r.execution_strategy, r.project_id, r.deleted_at, r.progress,
+  CAST(COALESCE(json_extract(r.mounts, '$."/out"'), '') AS TEXT) AS out_path
+FROM runs r
+WHERE (SELECT u.is_admin FROM users u WHERE u.id = ?) = TRUE 
+   OR r.user_id = ?
+   OR r.project_id IN (SELECT m.project_id FROM project_members m WHERE m.user_id = ?)
+`
+
+type GetRunSummariesParams struct {
+	ID       string `json:"id"`
+	UserID   string `json:"userId"`
+	UserID_2 string `json:"userId2"`
+}
+
+type GetRunSummariesRow struct {
+	ID                int64           `json:"id"`
+	Name              string          `json:"name"`
+	Title             string          `json:"title"`
+	Description       string          `json:"description"`
+	DockerImage       string          `json:"dockerImage"`
+	CreatedAt         time.Time       `json:"createdAt"`
+	StartedAt         sql.NullTime    `json:"startedAt"`
+	FinishedAt        sql.NullTime    `json:"finishedAt"`
+	Status            string          `json:"status"`
+	GotapMetadata     sql.NullString  `json:"gotapMetadata"`
+	DurationMs        sql.NullInt64   `json:"durationMs"`
+	ExitCode          sql.NullInt64   `json:"exitCode"`
+	ErrorMessage      sql.NullString  `json:"errorMessage"`
+	ErrorKind         sql.NullString  `json:"errorKind"`
+	Attempts          int64           `json:"attempts"`
+	ExecutionStrategy sql.NullString  `json:"executionStrategy"`
+	ProjectID         sql.NullInt64   `json:"projectId"`
+	DeletedAt         sql.NullTime    `json:"deletedAt"`
+	Progress          sql.NullFloat64 `json:"progress"`
+	OutPath           string          `json:"outPath"`
+}
+
+func (q *Queries) GetRunSummaries(ctx context.Context, arg GetRunSummariesParams) ([]GetRunSummariesRow, error) {
+	rows, err := q.db.QueryContext(ctx, getRunSummaries, arg.ID, arg.UserID, arg.UserID_2)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetRunSummariesRow
+	for rows.Next() {
+		var i GetRunSummariesRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.Title,
+			&i.Description,
+			&i.DockerImage,
+			&i.CreatedAt,
+			&i.StartedAt,
+			&i.FinishedAt,
+			&i.Status,
+			&i.GotapMetadata,
+			&i.DurationMs,
+			&i.ExitCode,
+			&i.ErrorMessage,
+			&i.ErrorKind,
+			&i.Attempts,
+			&i.ExecutionStrategy,
+			&i.ProjectID,
+			&i.DeletedAt,
+			&i.Progress,
+			&i.OutPath,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getRunning = `-- name: GetRunning :many
-SELECT r.id, r.name, r.title, r.description, r.docker_image, r.mounts, r.parameters, r.data, r.created_at, r.started_at, r.finished_at, r.status, r.has_errored, r.error_message, r.user_id, r.gotap_metadata FROM runs r
+SELECT r.id, r.name, r.title, r.description, r.docker_image, r.mounts, r.parameters, r.data, r.created_at, r.started_at, r.finished_at, r.status, r.has_errored, r.error_message, r.user_id, r.gotap_metadata, r.duration_ms, r.options, r.exit_code, r.error_kind, r.attempts, r.container_id, r.execution_environment, r.execution_strategy, r.project_id, r.deleted_at, r.progress, r.storage_pending, r.image_digest, r.run_dir FROM runs r
 WHERE r.status = 'running' AND (
   (SELECT u.is_admin FROM users u WHERE u.id = ?) = TRUE 
   OR r.user_id = ?
@@ -396,6 +951,20 @@ func (q *Queries) GetRunning(ctx context.Context, arg GetRunningParams) ([]Run,
 			&i.ErrorMessage,
 			&i.UserID,
 			&i.GotapMetadata,
+			&i.DurationMs,
+			&i.Options,
+			&i.ExitCode,
+			&i.ErrorKind,
+			&i.Attempts,
+			&i.ContainerID,
+			&i.ExecutionEnvironment,
+			&i.ExecutionStrategy,
+			&i.ProjectID,
+			&i.DeletedAt,
+			&i.Progress,
+			&i.StoragePending,
+			&i.ImageDigest,
+			&i.RunDir,
 		); err != nil {
 			return nil, err
 		}
@@ -410,19 +979,339 @@ func (q *Queries) GetRunning(ctx context.Context, arg GetRunningParams) ([]Run,
 	return items, nil
 }
 
-const runErrored = `-- name: RunErrored :one
-UPDATE runs SET status = 'errored', error_message = ?, finished_at = datetime('now'), has_errored = TRUE
-WHERE runs.id = ?
-RETURNING id, name, title, description, docker_image, mounts, parameters, data, created_at, started_at, finished_at, status, has_errored, error_message, user_id, gotap_metadata
+const getStalePendingRuns = `-- name: GetStalePendingRuns :many
+SELECT id, name, title, description, docker_image, mounts, parameters, data, created_at, started_at, finished_at, status, has_errored, error_message, user_id, gotap_metadata, duration_ms, options, exit_code, error_kind, attempts, container_id, execution_environment, execution_strategy, project_id, deleted_at, progress, storage_pending, image_digest, run_dir FROM runs
+WHERE status = 'pending' AND deleted_at IS NULL AND datetime(created_at) < datetime(?1)
+ORDER BY id
+`
+
+func (q *Queries) GetStalePendingRuns(ctx context.Context, cutoff interface{}) ([]Run, error) {
+	rows, err := q.db.QueryContext(ctx, getStalePendingRuns, cutoff)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Run
+	for rows.Next() {
+		var i Run
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.Title,
+			&i.Description,
+			&i.DockerImage,
+			&i.Mounts,
+			&i.Parameters,
+			&i.Data,
+			&i.CreatedAt,
+			&i.StartedAt,
+			&i.FinishedAt,
+			&i.Status,
+			&i.HasErrored,
+			&i.ErrorMessage,
+			&i.UserID,
+			&i.GotapMetadata,
+			&i.DurationMs,
+			&i.Options,
+			&i.ExitCode,
+			&i.ErrorKind,
+			&i.Attempts,
+			&i.ContainerID,
+			&i.ExecutionEnvironment,
+			&i.ExecutionStrategy,
+			&i.ProjectID,
+			&i.DeletedAt,
+			&i.Progress,
+			&i.StoragePending,
+			&i.ImageDigest,
+			&i.RunDir,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getStoragePendingRuns = `-- name: GetStoragePendingRuns :many
+SELECT id, name, title, description, docker_image, mounts, parameters, data, created_at, started_at, finished_at, status, has_errored, error_message, user_id, gotap_metadata, duration_ms, options, exit_code, error_kind, attempts, container_id, execution_environment, execution_strategy, project_id, deleted_at, progress, storage_pending, image_digest, run_dir FROM runs
+WHERE storage_pending = TRUE AND deleted_at IS NULL
+ORDER BY id
+`
+
+func (q *Queries) GetStoragePendingRuns(ctx context.Context) ([]Run, error) {
+	rows, err := q.db.QueryContext(ctx, getStoragePendingRuns)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Run
+	for rows.Next() {
+		var i Run
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.Title,
+			&i.Description,
+			&i.DockerImage,
+			&i.Mounts,
+			&i.Parameters,
+			&i.Data,
+			&i.CreatedAt,
+			&i.StartedAt,
+			&i.FinishedAt,
+			&i.Status,
+			&i.HasErrored,
+			&i.ErrorMessage,
+			&i.UserID,
+			&i.GotapMetadata,
+			&i.DurationMs,
+			&i.Options,
+			&i.ExitCode,
+			&i.ErrorKind,
+			&i.Attempts,
+			&i.ContainerID,
+			&i.ExecutionEnvironment,
+			&i.ExecutionStrategy,
+			&i.ProjectID,
+			&i.DeletedAt,
+			&i.Progress,
+			&i.StoragePending,
+			&i.ImageDigest,
+			&i.RunDir,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getUnfinishedRunMounts = `-- name: GetUnfinishedRunMounts :many
+SELECT id, mounts FROM runs
+WHERE status IN ('pending', 'queued', 'running')
+`
+
+type GetUnfinishedRunMountsRow struct {
+	ID     int64  `json:"id"`
+	Mounts string `json:"mounts"`
+}
+
+func (q *Queries) GetUnfinishedRunMounts(ctx context.Context) ([]GetUnfinishedRunMountsRow, error) {
+	rows, err := q.db.QueryContext(ctx, getUnfinishedRunMounts)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetUnfinishedRunMountsRow
+	for rows.Next() {
+		var i GetUnfinishedRunMountsRow
+		if err := rows.Scan(&i.ID, &i.Mounts); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const queueRun = `-- name: QueueRun :execrows
+UPDATE runs SET status = 'queued'
+WHERE runs.id = ? AND runs.status IN ('pending', 'running')
+`
+
+func (q *Queries) QueueRun(ctx context.Context, id int64) (int64, error) {
+	result, err := q.db.ExecContext(ctx, queueRun, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const restoreRun = `-- name: RestoreRun :execrows
+UPDATE runs SET deleted_at = NULL
+WHERE id = ? AND deleted_at IS NOT NULL
+`
+
+func (q *Queries) RestoreRun(ctx context.Context, id int64) (int64, error) {
+	result, err := q.db.ExecContext(ctx, restoreRun, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const runErrored = `-- name: RunErrored :execrows
+UPDATE runs SET status = 'errored', error_message = ?, error_kind = ?, finished_at = datetime('now'), has_errored = TRUE
+WHERE runs.id = ? AND runs.status IN ('pending', 'queued', 'running')
 `
 
 type RunErroredParams struct {
 	ErrorMessage sql.NullString `json:"errorMessage"`
+	ErrorKind    sql.NullString `json:"errorKind"`
 	ID           int64          `json:"id"`
 }
 
-func (q *Queries) RunErrored(ctx context.Context, arg RunErroredParams) (Run, error) {
-	row := q.db.QueryRowContext(ctx, runErrored, arg.ErrorMessage, arg.ID)
+func (q *Queries) RunErrored(ctx context.Context, arg RunErroredParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, runErrored, arg.ErrorMessage, arg.ErrorKind, arg.ID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const setRunAttempts = `-- name: SetRunAttempts :exec
+UPDATE runs SET attempts = ?
+WHERE runs.id = ?
+`
+
+type SetRunAttemptsParams struct {
+	Attempts int64 `json:"attempts"`
+	ID       int64 `json:"id"`
+}
+
+func (q *Queries) SetRunAttempts(ctx context.Context, arg SetRunAttemptsParams) error {
+	_, err := q.db.ExecContext(ctx, setRunAttempts, arg.Attempts, arg.ID)
+	return err
+}
+
+const setRunContainerID = `-- name: SetRunContainerID :exec
+UPDATE runs SET container_id = ?
+WHERE runs.id = ?
+`
+
+type SetRunContainerIDParams struct {
+	ContainerID sql.NullString `json:"containerId"`
+	ID          int64          `json:"id"`
+}
+
+func (q *Queries) SetRunContainerID(ctx context.Context, arg SetRunContainerIDParams) error {
+	_, err := q.db.ExecContext(ctx, setRunContainerID, arg.ContainerID, arg.ID)
+	return err
+}
+
+const setRunExecutionEnvironment = `-- name: SetRunExecutionEnvironment :exec
+UPDATE runs SET execution_environment = ?
+WHERE runs.id = ?
+`
+
+type SetRunExecutionEnvironmentParams struct {
+	ExecutionEnvironment sql.NullString `json:"executionEnvironment"`
+	ID                   int64          `json:"id"`
+}
+
+func (q *Queries) SetRunExecutionEnvironment(ctx context.Context, arg SetRunExecutionEnvironmentParams) error {
+	_, err := q.db.ExecContext(ctx, setRunExecutionEnvironment, arg.ExecutionEnvironment, arg.ID)
+	return err
+}
+
+const setRunExecutionStrategy = `-- name: SetRunExecutionStrategy :exec
+UPDATE runs SET execution_strategy = ?
+WHERE runs.id = ?
+`
+
+type SetRunExecutionStrategyParams struct {
+	ExecutionStrategy sql.NullString `json:"executionStrategy"`
+	ID                int64          `json:"id"`
+}
+
+func (q *Queries) SetRunExecutionStrategy(ctx context.Context, arg SetRunExecutionStrategyParams) error {
+	_, err := q.db.ExecContext(ctx, setRunExecutionStrategy, arg.ExecutionStrategy, arg.ID)
+	return err
+}
+
+const setRunImageDigest = `-- name: SetRunImageDigest :exec
+UPDATE runs SET image_digest = ?
+WHERE runs.id = ?
+`
+
+type SetRunImageDigestParams struct {
+	ImageDigest sql.NullString `json:"imageDigest"`
+	ID          int64          `json:"id"`
+}
+
+func (q *Queries) SetRunImageDigest(ctx context.Context, arg SetRunImageDigestParams) error {
+	_, err := q.db.ExecContext(ctx, setRunImageDigest, arg.ImageDigest, arg.ID)
+	return err
+}
+
+const setRunDir = `-- name: SetRunDir :exec
+UPDATE runs SET run_dir = ?
+WHERE runs.id = ?
+`
+
+type SetRunDirParams struct {
+	RunDir sql.NullString `json:"runDir"`
+	ID     int64          `json:"id"`
+}
+
+func (q *Queries) SetRunDir(ctx context.Context, arg SetRunDirParams) error {
+	_, err := q.db.ExecContext(ctx, setRunDir, arg.RunDir, arg.ID)
+	return err
+}
+
+const setRunProgress = `-- name: SetRunProgress :exec
+UPDATE runs SET progress = ?
+WHERE runs.id = ?
+`
+
+type SetRunProgressParams struct {
+	Progress sql.NullFloat64 `json:"progress"`
+	ID       int64           `json:"id"`
+}
+
+func (q *Queries) SetRunProgress(ctx context.Context, arg SetRunProgressParams) error {
+	_, err := q.db.ExecContext(ctx, setRunProgress, arg.Progress, arg.ID)
+	return err
+}
+
+const setRunLayout = `-- name: SetRunLayout :exec
+UPDATE runs SET data = ?, mounts = ?
+WHERE runs.id = ?
+`
+
+type SetRunLayoutParams struct {
+	Data   string `json:"data"`
+	Mounts string `json:"mounts"`
+	ID     int64  `json:"id"`
+}
+
+func (q *Queries) SetRunLayout(ctx context.Context, arg SetRunLayoutParams) error {
+	_, err := q.db.ExecContext(ctx, setRunLayout, arg.Data, arg.Mounts, arg.ID)
+	return err
+}
+
+const setRunExitCode = `-- name: SetRunExitCode :one
+UPDATE runs SET exit_code = ?, duration_ms = ?
+WHERE runs.id = ?
+RETURNING id, name, title, description, docker_image, mounts, parameters, data, created_at, started_at, finished_at, status, has_errored, error_message, user_id, gotap_metadata, duration_ms, options, exit_code, error_kind, attempts, container_id, execution_environment, execution_strategy, project_id, deleted_at, progress, storage_pending, image_digest, run_dir
+`
+
+type SetRunExitCodeParams struct {
+	ExitCode   sql.NullInt64 `json:"exitCode"`
+	DurationMs sql.NullInt64 `json:"durationMs"`
+	ID         int64         `json:"id"`
+}
+
+func (q *Queries) SetRunExitCode(ctx context.Context, arg SetRunExitCodeParams) (Run, error) {
+	row := q.db.QueryRowContext(ctx, setRunExitCode, arg.ExitCode, arg.DurationMs, arg.ID)
 	var i Run
 	err := row.Scan(
 		&i.ID,
@@ -441,23 +1330,38 @@ func (q *Queries) RunErrored(ctx context.Context, arg RunErroredParams) (Run, er
 		&i.ErrorMessage,
 		&i.UserID,
 		&i.GotapMetadata,
+		&i.DurationMs,
+		&i.Options,
+		&i.ExitCode,
+		&i.ErrorKind,
+		&i.Attempts,
+		&i.ContainerID,
+		&i.ExecutionEnvironment,
+		&i.ExecutionStrategy,
+		&i.ProjectID,
+		&i.DeletedAt,
+		&i.Progress,
+		&i.StoragePending,
+		&i.ImageDigest,
+		&i.RunDir,
 	)
 	return i, err
 }
 
 const setRunGotapMetadata = `-- name: SetRunGotapMetadata :one
-UPDATE runs SET gotap_metadata = ?
+UPDATE runs SET gotap_metadata = ?, duration_ms = COALESCE(?, duration_ms)
 WHERE runs.id = ?
-RETURNING id, name, title, description, docker_image, mounts, parameters, data, created_at, started_at, finished_at, status, has_errored, error_message, user_id, gotap_metadata
+RETURNING id, name, title, description, docker_image, mounts, parameters, data, created_at, started_at, finished_at, status, has_errored, error_message, user_id, gotap_metadata, duration_ms, options, exit_code, error_kind, attempts, container_id, execution_environment, execution_strategy, project_id, deleted_at, progress, storage_pending, image_digest, run_dir
 `
 
 type SetRunGotapMetadataParams struct {
 	GotapMetadata sql.NullString `json:"gotapMetadata"`
+	DurationMs    sql.NullInt64  `json:"durationMs"`
 	ID            int64          `json:"id"`
 }
 
 func (q *Queries) SetRunGotapMetadata(ctx context.Context, arg SetRunGotapMetadataParams) (Run, error) {
-	row := q.db.QueryRowContext(ctx, setRunGotapMetadata, arg.GotapMetadata, arg.ID)
+	row := q.db.QueryRowContext(ctx, setRunGotapMetadata, arg.GotapMetadata, arg.DurationMs, arg.ID)
 	var i Run
 	err := row.Scan(
 		&i.ID,
@@ -476,18 +1380,47 @@ func (q *Queries) SetRunGotapMetadata(ctx context.Context, arg SetRunGotapMetada
 		&i.ErrorMessage,
 		&i.UserID,
 		&i.GotapMetadata,
+		&i.DurationMs,
+		&i.Options,
+		&i.ExitCode,
+		&i.ErrorKind,
+		&i.Attempts,
+		&i.ContainerID,
+		&i.ExecutionEnvironment,
+		&i.ExecutionStrategy,
+		&i.ProjectID,
+		&i.DeletedAt,
+		&i.Progress,
+		&i.StoragePending,
+		&i.ImageDigest,
+		&i.RunDir,
 	)
 	return i, err
 }
 
+const setRunStoragePending = `-- name: SetRunStoragePending :exec
+UPDATE runs SET storage_pending = ?
+WHERE runs.id = ?
+`
+
+type SetRunStoragePendingParams struct {
+	StoragePending bool  `json:"storagePending"`
+	ID             int64 `json:"id"`
+}
+
+func (q *Queries) SetRunStoragePending(ctx context.Context, arg SetRunStoragePendingParams) error {
+	_, err := q.db.ExecContext(ctx, setRunStoragePending, arg.StoragePending, arg.ID)
+	return err
+}
+
 const startRun = `-- name: StartRun :one
 UPDATE runs
 SET status = 'running', started_at = datetime('now')
-WHERE runs.id = ? AND (
+WHERE runs.id = ? AND runs.status IN ('pending', 'queued') AND runs.deleted_at IS NULL AND (
   (SELECT u.is_admin FROM users u WHERE u.id = ?) = TRUE 
   OR runs.user_id = ?
 )
-RETURNING id, name, title, description, docker_image, mounts, parameters, data, created_at, started_at, finished_at, status, has_errored, error_message, user_id, gotap_metadata
+RETURNING id, name, title, description, docker_image, mounts, parameters, data, created_at, started_at, finished_at, status, has_errored, error_message, user_id, gotap_metadata, duration_ms, options, exit_code, error_kind, attempts, container_id, execution_environment, execution_strategy, project_id, deleted_at, progress, storage_pending, image_digest, run_dir
 `
 
 type StartRunParams struct {
@@ -516,6 +1449,33 @@ func (q *Queries) StartRun(ctx context.Context, arg StartRunParams) (Run, error)
 		&i.ErrorMessage,
 		&i.UserID,
 		&i.GotapMetadata,
+		&i.DurationMs,
+		&i.Options,
+		&i.ExitCode,
+		&i.ErrorKind,
+		&i.Attempts,
+		&i.ContainerID,
+		&i.ExecutionEnvironment,
+		&i.ExecutionStrategy,
+		&i.ProjectID,
+		&i.DeletedAt,
+		&i.Progress,
+		&i.StoragePending,
+		&i.ImageDigest,
+		&i.RunDir,
 	)
 	return i, err
 }
+
+const trashRun = `-- name: TrashRun :execrows
+UPDATE runs SET deleted_at = datetime('now')
+WHERE id = ? AND deleted_at IS NULL
+`
+
+func (q *Queries) TrashRun(ctx context.Context, id int64) (int64, error) {
+	result, err := q.db.ExecContext(ctx, trashRun, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
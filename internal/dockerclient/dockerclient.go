@@ -0,0 +1,96 @@
+package dockerclient
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/client"
+)
+
+// the client shared by the whole process. It negotiates the API version once,
+// and is replaced after the daemon was unreachable, so that it negotiates again.
+var shared struct {
+	sync.Mutex
+	c           *client.Client
+	unreachable bool
+}
+
+// Get returns the Docker client of the process, which is created on first use.
+// The client must not be closed by the caller.
+func Get() (*client.Client, error) {
+	shared.Lock()
+	defer shared.Unlock()
+	if shared.c != nil {
+		return shared.c, nil
+	}
+	c, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		return nil, err
+	}
+	shared.c = c
+	return c, nil
+}
+
+// Use replaces the shared client, e.g. by the client of a fake daemon in tests.
+// With nil, the next Get connects to the daemon of the environment again.
+func Use(c *client.Client) {
+	shared.Lock()
+	defer shared.Unlock()
+	shared.c = c
+	shared.unreachable = false
+}
+
+// reset drops the shared client, the next Get connects again
+func reset() {
+	shared.Lock()
+	defer shared.Unlock()
+	if shared.c != nil {
+		shared.c.Close()
+		shared.c = nil
+	}
+}
+
+// Check pings the daemon. If it is unreachable, the shared client is dropped,
+// so that the next Get reconnects once the daemon is back.
+func Check(ctx context.Context) error {
+	c, err := Get()
+	if err != nil {
+		return err
+	}
+	_, err = c.Ping(ctx)
+
+	shared.Lock()
+	wasUnreachable := shared.unreachable
+	shared.unreachable = err != nil
+	shared.Unlock()
+
+	if err != nil {
+		if !wasUnreachable {
+			log.Printf("the docker daemon is unreachable: %v", err)
+		}
+		reset()
+		return err
+	}
+	if wasUnreachable {
+		log.Println("the docker daemon is reachable again")
+	}
+	return nil
+}
+
+// Watch checks the daemon every interval until ctx is done
+func Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			pingCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+			Check(pingCtx)
+			cancel()
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package dockerclient
+
+import "github.com/hydrocode-de/gorun/version"
+
+// the labels of every container gorun creates, so that left over containers can be found
+const (
+	LabelManaged = "de.hydrocode.gorun"
+	LabelPurpose = "de.hydrocode.gorun.purpose"
+	LabelVersion = "de.hydrocode.gorun.version"
+	LabelRunID   = "de.hydrocode.gorun.run_id"
+	LabelUserID  = "de.hydrocode.gorun.user_id"
+)
+
+// the purposes a container is created for
+const (
+	PurposeRun     = "run"
+	PurposePrepare = "prepare"
+	PurposeProbe   = "probe"
+)
+
+// Labels returns the labels of a new container created for the purpose
+func Labels(purpose string) map[string]string {
+	return map[string]string{
+		LabelManaged: "true",
+		LabelPurpose: purpose,
+		LabelVersion: version.Version,
+	}
+}
@@ -0,0 +1,739 @@
+// Package dockertest is an in-process fake of the Docker Engine API for tests. It speaks
+// enough of the API for gorun to create, start, wait for, inspect, kill and remove
+// containers, read their logs and stats, and to list and inspect images. What a container
+// does once it is started is scripted per test.
+package dockertest
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/hydrocode-de/gorun/internal/dockerclient"
+)
+
+// APIVersion is the version of the Engine API the fake daemon reports
+const APIVersion = "1.47"
+
+// Image is a local image of the fake daemon
+type Image struct {
+	ID          string
+	RepoTags    []string
+	RepoDigests []string
+	Labels      map[string]string
+	Entrypoint  []string
+	Cmd         []string
+	// Files are the files in the image, which are served to cat and stat
+	Files map[string]string
+	// Commands script the containers by their joined entrypoint and command, e.g. "gotap -v"
+	Commands map[string]Result
+	// Run scripts the containers of runs, which are labeled with the run purpose
+	Run Script
+}
+
+// Result is what a started container does
+type Result struct {
+	// StartError fails the start of the container, like a missing executable
+	StartError string
+	ExitCode   int64
+	Stdout     string
+	Stderr     string
+	OOMKilled  bool
+	// OOMEvent reports the OOM kill of a child process of the container as an event,
+	// while State.OOMKilled stays false
+	OOMEvent bool
+	// Duration delays the exit, Hang keeps the container running until it is killed
+	Duration time.Duration
+	Hang     bool
+}
+
+// Script decides what a started container does. It may write files into the host paths of
+// the mounts of the container, see Container.HostPath.
+type Script func(c *Container) Result
+
+// Container is a container created on the fake daemon
+type Container struct {
+	ID         string
+	Image      string
+	Config     container.Config
+	HostConfig container.HostConfig
+	Platform   string
+
+	state     string
+	createdAt time.Time
+	exitCode  int64
+	oomKilled bool
+	oomEvent  bool
+	stdout    string
+	stderr    string
+	startedAt time.Time
+	exited    chan struct{}
+	removed   bool
+}
+
+// HostPath returns the host directory mounted at the target, or an empty string
+func (c *Container) HostPath(target string) string {
+	for _, m := range c.HostConfig.Mounts {
+		if m.Target == target {
+			return m.Source
+		}
+	}
+	for _, bind := range c.HostConfig.Binds {
+		parts := strings.Split(bind, ":")
+		if len(parts) >= 2 && parts[1] == target {
+			return parts[0]
+		}
+	}
+	return ""
+}
+
+// Purpose is the purpose label gorun set on the container
+func (c *Container) Purpose() string {
+	return c.Config.Labels[dockerclient.LabelPurpose]
+}
+
+// Command is the entrypoint and command of the container joined by spaces
+func (c *Container) Command() string {
+	return strings.Join(append(append([]string{}, c.Config.Entrypoint...), c.Config.Cmd...), " ")
+}
+
+// Daemon is the fake Docker daemon
+type Daemon struct {
+	// Script replaces the scripts of the images for every started container, if set
+	Script Script
+	// Fail answers the calls of an endpoint, like "create" or "start", with a server error.
+	// "create_run" only fails the creation of the containers of runs, not of the probes.
+	Fail map[string]string
+
+	server     *httptest.Server
+	mu         sync.Mutex
+	images     []*Image
+	containers map[string]*Container
+	created    []*Container
+	calls      map[string]int
+	nextID     int
+}
+
+// New starts a fake daemon and makes it the Docker daemon of the process until the test ends
+func New(t testing.TB) *Daemon {
+	t.Helper()
+	d := &Daemon{
+		Fail:       make(map[string]string),
+		containers: make(map[string]*Container),
+		calls:      make(map[string]int),
+	}
+	d.server = httptest.NewServer(http.HandlerFunc(d.serve))
+	c, err := client.NewClientWithOpts(
+		client.WithHost("tcp://"+strings.TrimPrefix(d.server.URL, "http://")),
+		client.WithHTTPClient(d.server.Client()),
+		client.WithAPIVersionNegotiation(),
+	)
+	if err != nil {
+		t.Fatalf("cannot create the client of the fake daemon: %v", err)
+	}
+	dockerclient.Use(c)
+	t.Cleanup(func() {
+		dockerclient.Use(nil)
+		d.mu.Lock()
+		for _, cont := range d.containers {
+			cont.exit(137, false)
+		}
+		d.mu.Unlock()
+		d.server.CloseClientConnections()
+		d.server.Close()
+	})
+	return d
+}
+
+// Client returns a new client of the fake daemon
+func (d *Daemon) Client() *client.Client {
+	c, _ := client.NewClientWithOpts(
+		client.WithHost("tcp://"+strings.TrimPrefix(d.server.URL, "http://")),
+		client.WithHTTPClient(d.server.Client()),
+		client.WithAPIVersionNegotiation(),
+	)
+	return c
+}
+
+// imageIDs numbers the images of all daemons, gorun caches its probes per image ID
+var imageIDs atomic.Int64
+
+// AddImage adds a local image. Its ID defaults to a new digest.
+func (d *Daemon) AddImage(image Image) *Image {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if image.ID == "" {
+		image.ID = fmt.Sprintf("sha256:%064x", imageIDs.Add(1))
+	}
+	added := &image
+	d.images = append(d.images, added)
+	return added
+}
+
+// Tag adds the tag to the image with the ID and removes it from any other image
+func (d *Daemon) Tag(imageID string, tag string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, img := range d.images {
+		img.RepoTags = without(img.RepoTags, tag)
+		if img.ID == imageID {
+			img.RepoTags = append(img.RepoTags, tag)
+		}
+	}
+}
+
+// Calls tells how often an endpoint, like "create" or "start", was called
+func (d *Daemon) Calls(endpoint string) int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.calls[endpoint]
+}
+
+// Created returns the containers created so far, including the removed ones
+func (d *Daemon) Created() []*Container {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]*Container{}, d.created...)
+}
+
+// Running returns the containers which are started and did not exit yet
+func (d *Daemon) Running() []*Container {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	running := make([]*Container, 0)
+	for _, c := range d.created {
+		if c.state == "running" {
+			running = append(running, c)
+		}
+	}
+	return running
+}
+
+// Removed tells if the container was removed
+func (d *Daemon) Removed(id string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, c := range d.created {
+		if c.ID == id {
+			return c.removed
+		}
+	}
+	return false
+}
+
+// the paths of the API, after the version prefix is stripped
+var (
+	versionPrefix  = regexp.MustCompile(`^/v[0-9.]+`)
+	containerRoute = regexp.MustCompile(`^/containers/([^/]+)/(start|wait|logs|json|kill|stop|stats|archive)$`)
+	containerPath  = regexp.MustCompile(`^/containers/([^/]+)$`)
+)
+
+func (d *Daemon) serve(w http.ResponseWriter, r *http.Request) {
+	path := versionPrefix.ReplaceAllString(r.URL.Path, "")
+	w.Header().Set("Api-Version", APIVersion)
+	w.Header().Set("Ostype", "linux")
+
+	switch {
+	case path == "/_ping":
+		d.count("ping")
+		w.Write([]byte("OK"))
+	case path == "/info" && r.Method == http.MethodGet:
+		d.handle(w, "info", func() (any, int, error) { return d.info(), http.StatusOK, nil })
+	case path == "/version" && r.Method == http.MethodGet:
+		d.handle(w, "version", func() (any, int, error) { return d.version(), http.StatusOK, nil })
+	case path == "/images/json" && r.Method == http.MethodGet:
+		d.handle(w, "images", func() (any, int, error) { return d.listImages(), http.StatusOK, nil })
+	case strings.HasPrefix(path, "/images/") && strings.HasSuffix(path, "/json") && r.Method == http.MethodGet:
+		name := strings.TrimSuffix(strings.TrimPrefix(path, "/images/"), "/json")
+		d.handle(w, "image_inspect", func() (any, int, error) { return d.inspectImage(name) })
+	case path == "/containers/create" && r.Method == http.MethodPost:
+		d.handle(w, "create", func() (any, int, error) { return d.create(r) })
+	case path == "/containers/json" && r.Method == http.MethodGet:
+		d.handle(w, "list", func() (any, int, error) { return d.list(r) })
+	case path == "/events" && r.Method == http.MethodGet:
+		d.events(w, r)
+	case containerPath.MatchString(path) && r.Method == http.MethodDelete:
+		id := containerPath.FindStringSubmatch(path)[1]
+		d.handle(w, "remove", func() (any, int, error) { return d.remove(id, r.URL.Query().Get("force") == "1") })
+	case containerRoute.MatchString(path):
+		match := containerRoute.FindStringSubmatch(path)
+		d.container(w, r, match[1], match[2])
+	default:
+		writeError(w, http.StatusNotFound, fmt.Sprintf("the fake daemon does not implement %s %s", r.Method, path))
+	}
+}
+
+func (d *Daemon) container(w http.ResponseWriter, r *http.Request, id string, action string) {
+	switch action {
+	case "start":
+		d.handle(w, "start", func() (any, int, error) { return d.start(id) })
+	case "wait":
+		d.wait(w, r, id)
+	case "logs":
+		d.logs(w, id)
+	case "json":
+		d.handle(w, "inspect", func() (any, int, error) { return d.inspect(id) })
+	case "kill", "stop":
+		d.handle(w, action, func() (any, int, error) {
+			c, err := d.lookup(id)
+			if err != nil {
+				return nil, http.StatusNotFound, err
+			}
+			d.mu.Lock()
+			defer d.mu.Unlock()
+			c.exit(137, false)
+			return nil, http.StatusNoContent, nil
+		})
+	case "stats":
+		d.handle(w, "stats", func() (any, int, error) {
+			if _, err := d.lookup(id); err != nil {
+				return nil, http.StatusNotFound, err
+			}
+			return container.StatsResponse{Read: time.Now()}, http.StatusOK, nil
+		})
+	case "archive":
+		d.stat(w, id, r.URL.Query().Get("path"))
+	}
+}
+
+// count records a call and returns the scripted failure of the endpoint
+func (d *Daemon) count(endpoint string) string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.calls[endpoint]++
+	return d.Fail[endpoint]
+}
+
+func (d *Daemon) handle(w http.ResponseWriter, endpoint string, serve func() (any, int, error)) {
+	if failure := d.count(endpoint); failure != "" {
+		writeError(w, http.StatusInternalServerError, failure)
+		return
+	}
+	body, status, err := serve()
+	if err != nil {
+		writeError(w, status, err.Error())
+		return
+	}
+	if body == nil {
+		w.WriteHeader(status)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"message": message})
+}
+
+func (d *Daemon) info() map[string]any {
+	return map[string]any{
+		"ID":              "fake",
+		"ServerVersion":   "28.3.1-fake",
+		"OperatingSystem": "Fake Linux",
+		"OSType":          "linux",
+		"Architecture":    "x86_64",
+		"KernelVersion":   "6.0.0-fake",
+		"Driver":          "overlay2",
+		"NCPU":            4,
+		"MemTotal":        8 << 30,
+	}
+}
+
+func (d *Daemon) version() map[string]any {
+	return map[string]any{
+		"Platform":   map[string]string{"Name": "Fake Engine"},
+		"Version":    "28.3.1-fake",
+		"ApiVersion": APIVersion,
+		"Os":         "linux",
+		"Arch":       "amd64",
+	}
+}
+
+// findImage looks up an image by tag, ID or short ID, d.mu has to be held
+func (d *Daemon) findImage(name string) *Image {
+	for _, img := range d.images {
+		if img.ID == name || strings.TrimPrefix(img.ID, "sha256:") == name || (len(name) >= 12 && strings.HasPrefix(strings.TrimPrefix(img.ID, "sha256:"), name)) {
+			return img
+		}
+		for _, tag := range img.RepoTags {
+			if tag == name || (!strings.Contains(name, ":") && tag == name+":latest") {
+				return img
+			}
+		}
+	}
+	return nil
+}
+
+func (d *Daemon) listImages() []map[string]any {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	summaries := make([]map[string]any, 0, len(d.images))
+	for _, img := range d.images {
+		summaries = append(summaries, map[string]any{
+			"Id":          img.ID,
+			"RepoTags":    img.RepoTags,
+			"RepoDigests": img.RepoDigests,
+			"Labels":      img.Labels,
+			"Created":     time.Now().Unix(),
+		})
+	}
+	return summaries
+}
+
+func (d *Daemon) inspectImage(name string) (any, int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	img := d.findImage(name)
+	if img == nil {
+		return nil, http.StatusNotFound, fmt.Errorf("No such image: %s", name)
+	}
+	return map[string]any{
+		"Id":           img.ID,
+		"RepoTags":     img.RepoTags,
+		"RepoDigests":  img.RepoDigests,
+		"Architecture": "amd64",
+		"Os":           "linux",
+		"Config": map[string]any{
+			"Labels":     img.Labels,
+			"Entrypoint": img.Entrypoint,
+			"Cmd":        img.Cmd,
+		},
+	}, http.StatusOK, nil
+}
+
+func (d *Daemon) create(r *http.Request) (any, int, error) {
+	var request struct {
+		container.Config
+		HostConfig       *container.HostConfig
+		NetworkingConfig *network.NetworkingConfig
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	if request.Labels[dockerclient.LabelPurpose] == dockerclient.PurposeRun {
+		if failure := d.count("create_run"); failure != "" {
+			return nil, http.StatusInternalServerError, fmt.Errorf("%s", failure)
+		}
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.findImage(request.Image) == nil {
+		return nil, http.StatusNotFound, fmt.Errorf("No such image: %s", request.Image)
+	}
+	d.nextID++
+	c := &Container{
+		ID:        fmt.Sprintf("%064x", d.nextID),
+		Image:     request.Image,
+		Config:    request.Config,
+		Platform:  r.URL.Query().Get("platform"),
+		state:     "created",
+		createdAt: time.Now(),
+		exited:    make(chan struct{}),
+	}
+	if request.HostConfig != nil {
+		c.HostConfig = *request.HostConfig
+	}
+	d.containers[c.ID] = c
+	d.created = append(d.created, c)
+	return container.CreateResponse{ID: c.ID, Warnings: []string{}}, http.StatusCreated, nil
+}
+
+func (d *Daemon) lookup(id string) (*Container, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if c, ok := d.containers[id]; ok {
+		return c, nil
+	}
+	for cid, c := range d.containers {
+		if len(id) >= 12 && strings.HasPrefix(cid, id) {
+			return c, nil
+		}
+	}
+	return nil, fmt.Errorf("No such container: %s", id)
+}
+
+// script returns what the container does, d.mu has to be held
+func (d *Daemon) script(c *Container) Script {
+	if d.Script != nil {
+		return d.Script
+	}
+	img := d.findImage(c.Image)
+	if img == nil {
+		return func(*Container) Result { return Result{StartError: "the image is gone"} }
+	}
+	if c.Purpose() == dockerclient.PurposeRun && img.Run != nil {
+		return img.Run
+	}
+	return img.command
+}
+
+// command runs the commands of the image, cat serves its files
+func (img *Image) command(c *Container) Result {
+	if result, ok := img.Commands[c.Command()]; ok {
+		return result
+	}
+	args := append(append([]string{}, c.Config.Entrypoint...), c.Config.Cmd...)
+	if len(args) == 2 && args[0] == "cat" {
+		if content, ok := img.Files[args[1]]; ok {
+			return Result{Stdout: content}
+		}
+		return Result{ExitCode: 1, Stderr: fmt.Sprintf("cat: %s: No such file or directory\n", args[1])}
+	}
+	if len(args) == 0 {
+		return Result{}
+	}
+	return Result{StartError: fmt.Sprintf("failed to create task for container: exec: %q: executable file not found in $PATH", args[0])}
+}
+
+func (d *Daemon) start(id string) (any, int, error) {
+	c, err := d.lookup(id)
+	if err != nil {
+		return nil, http.StatusNotFound, err
+	}
+	d.mu.Lock()
+	if c.state != "created" {
+		d.mu.Unlock()
+		return nil, http.StatusNotModified, nil
+	}
+	script := d.script(c)
+	d.mu.Unlock()
+
+	// the script runs outside the lock, as it may call back into the daemon or block
+	result := script(c)
+	if result.StartError != "" {
+		return nil, http.StatusBadRequest, fmt.Errorf("%s", result.StartError)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	c.state, c.startedAt = "running", time.Now()
+	c.stdout, c.stderr, c.oomEvent = result.Stdout, result.Stderr, result.OOMEvent
+	switch {
+	case result.Hang:
+	case result.Duration > 0:
+		go func() {
+			select {
+			case <-time.After(result.Duration):
+				d.mu.Lock()
+				c.exit(result.ExitCode, result.OOMKilled)
+				d.mu.Unlock()
+			case <-c.exited:
+			}
+		}()
+	default:
+		c.exit(result.ExitCode, result.OOMKilled)
+	}
+	return nil, http.StatusNoContent, nil
+}
+
+// exit stops the container once, d.mu has to be held
+func (c *Container) exit(exitCode int64, oomKilled bool) {
+	select {
+	case <-c.exited:
+		return
+	default:
+	}
+	c.state, c.exitCode, c.oomKilled = "exited", exitCode, oomKilled
+	close(c.exited)
+}
+
+func (d *Daemon) wait(w http.ResponseWriter, r *http.Request, id string) {
+	if failure := d.count("wait"); failure != "" {
+		writeError(w, http.StatusInternalServerError, failure)
+		return
+	}
+	c, err := d.lookup(id)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	// like the daemon, the header is sent at once and the status once the container exited
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.(http.Flusher).Flush()
+	select {
+	case <-c.exited:
+	case <-r.Context().Done():
+		return
+	}
+	d.mu.Lock()
+	exitCode := c.exitCode
+	d.mu.Unlock()
+	json.NewEncoder(w).Encode(container.WaitResponse{StatusCode: exitCode})
+}
+
+func (d *Daemon) logs(w http.ResponseWriter, id string) {
+	if failure := d.count("logs"); failure != "" {
+		writeError(w, http.StatusInternalServerError, failure)
+		return
+	}
+	c, err := d.lookup(id)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	d.mu.Lock()
+	stdout, stderr := c.stdout, c.stderr
+	d.mu.Unlock()
+	w.Header().Set("Content-Type", "application/vnd.docker.multiplexed-stream")
+	w.WriteHeader(http.StatusOK)
+	if stdout != "" {
+		io.WriteString(stdcopy.NewStdWriter(w, stdcopy.Stdout), stdout)
+	}
+	if stderr != "" {
+		io.WriteString(stdcopy.NewStdWriter(w, stdcopy.Stderr), stderr)
+	}
+}
+
+func (d *Daemon) inspect(id string) (any, int, error) {
+	c, err := d.lookup(id)
+	if err != nil {
+		return nil, http.StatusNotFound, err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return map[string]any{
+		"Id":    c.ID,
+		"Image": c.Image,
+		"State": map[string]any{
+			"Status":    c.state,
+			"Running":   c.state == "running",
+			"ExitCode":  c.exitCode,
+			"OOMKilled": c.oomKilled,
+			"StartedAt": c.startedAt.UTC().Format(time.RFC3339Nano),
+		},
+		"Config":     c.Config,
+		"HostConfig": c.HostConfig,
+	}, http.StatusOK, nil
+}
+
+func (d *Daemon) remove(id string, force bool) (any, int, error) {
+	c, err := d.lookup(id)
+	if err != nil {
+		return nil, http.StatusNotFound, err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if c.state == "running" && !force {
+		return nil, http.StatusConflict, fmt.Errorf("cannot remove container %s: container is running: stop the container before removing or force remove", id)
+	}
+	c.exit(137, false)
+	c.removed = true
+	delete(d.containers, c.ID)
+	return nil, http.StatusNoContent, nil
+}
+
+func (d *Daemon) list(r *http.Request) (any, int, error) {
+	args, err := filters.FromJSON(r.URL.Query().Get("filters"))
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	all := r.URL.Query().Get("all") == "1"
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	ids := make([]string, 0, len(d.containers))
+	for id := range d.containers {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	summaries := make([]container.Summary, 0)
+	for _, id := range ids {
+		c := d.containers[id]
+		if !all && c.state != "running" {
+			continue
+		}
+		if args.Contains("status") && !args.ExactMatch("status", c.state) {
+			continue
+		}
+		if args.Contains("label") && !args.MatchKVList("label", c.Config.Labels) {
+			continue
+		}
+		summaries = append(summaries, container.Summary{
+			ID:      c.ID,
+			Image:   c.Image,
+			Labels:  c.Config.Labels,
+			State:   container.ContainerState(c.state),
+			Created: c.createdAt.Unix(),
+		})
+	}
+	return summaries, http.StatusOK, nil
+}
+
+// events sends an oom event for the containers which were OOM killed or whose child
+// processes were, then ends the stream
+func (d *Daemon) events(w http.ResponseWriter, r *http.Request) {
+	d.count("events")
+	args, _ := filters.FromJSON(r.URL.Query().Get("filters"))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, c := range d.created {
+		if !(c.oomKilled || c.oomEvent) || (args.Contains("container") && !args.ExactMatch("container", c.ID)) {
+			continue
+		}
+		json.NewEncoder(w).Encode(events.Message{
+			Type:   events.ContainerEventType,
+			Action: events.ActionOOM,
+			Actor:  events.Actor{ID: c.ID},
+		})
+	}
+}
+
+func (d *Daemon) stat(w http.ResponseWriter, id string, path string) {
+	if failure := d.count("stat"); failure != "" {
+		writeError(w, http.StatusInternalServerError, failure)
+		return
+	}
+	c, err := d.lookup(id)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	d.mu.Lock()
+	img := d.findImage(c.Image)
+	d.mu.Unlock()
+	content, ok := "", false
+	if img != nil {
+		content, ok = img.Files[path]
+	}
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	stat, _ := json.Marshal(container.PathStat{Name: path[strings.LastIndex(path, "/")+1:], Size: int64(len(content)), Mode: 0o644})
+	w.Header().Set("X-Docker-Container-Path-Stat", base64.StdEncoding.EncodeToString(stat))
+	w.WriteHeader(http.StatusOK)
+}
+
+func without(values []string, value string) []string {
+	kept := make([]string, 0, len(values))
+	for _, v := range values {
+		if v != value {
+			kept = append(kept, v)
+		}
+	}
+	return kept
+}
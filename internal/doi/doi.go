@@ -0,0 +1,322 @@
+package doi
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// Prefix marks the datasets which reference a file of a deposit by its DOI,
+// like doi:10.5281/zenodo.123456#forcing.csv
+const Prefix = "doi:"
+
+var (
+	// ErrNotFound is returned for DOIs which are not registered or whose record is gone
+	ErrNotFound = errors.New("the DOI could not be resolved")
+	// ErrUnsupported is returned for DOIs of other repositories than Zenodo
+	ErrUnsupported = errors.New("the DOI does not reference a supported repository")
+)
+
+// Reference is a dataset given as doi:<doi>#<file>, the file may be omitted for
+// deposits of a single file
+type Reference struct {
+	DOI  string
+	File string
+}
+
+// IsReference tells if the path of a dataset is a DOI reference
+func IsReference(dataPath string) bool {
+	return strings.HasPrefix(dataPath, Prefix)
+}
+
+// ParseReference reads a doi: reference. DOIs are case insensitive and lower cased,
+// a leading https://doi.org/ is accepted as well.
+func ParseReference(ref string) (Reference, error) {
+	value, ok := strings.CutPrefix(ref, Prefix)
+	if !ok {
+		return Reference{}, fmt.Errorf("%s is not a doi: reference", ref)
+	}
+	doi, file, _ := strings.Cut(value, "#")
+	for _, resolver := range []string{"https://doi.org/", "http://doi.org/", "https://dx.doi.org/"} {
+		doi = strings.TrimPrefix(doi, resolver)
+	}
+	doi = strings.ToLower(strings.TrimSpace(doi))
+	prefix, suffix, ok := strings.Cut(doi, "/")
+	if !ok || !strings.HasPrefix(prefix, "10.") || suffix == "" {
+		return Reference{}, fmt.Errorf("%s is not a valid DOI, expected doi:10.<registrant>/<suffix>#<file>", ref)
+	}
+	if unescaped, err := url.PathUnescape(file); err == nil {
+		file = unescaped
+	}
+	return Reference{DOI: doi, File: file}, nil
+}
+
+func (r Reference) String() string {
+	if r.File == "" {
+		return Prefix + r.DOI
+	}
+	return Prefix + r.DOI + "#" + r.File
+}
+
+// File is a file of a deposit as the repository lists it
+type File struct {
+	Key  string `json:"key"`
+	Size int64  `json:"size"`
+	// Checksum is <algorithm>:<hex>, like md5:...
+	Checksum string `json:"checksum"`
+	URL      string `json:"url"`
+}
+
+// Deposit is the record a DOI resolved to, with its public files
+type Deposit struct {
+	DOI        string `json:"doi"`
+	Repository string `json:"repository"`
+	RecordURL  string `json:"record_url"`
+	Files      []File `json:"files"`
+}
+
+// Select returns the file of the deposit with the given key. Without a key, the
+// deposit has to hold exactly one file.
+func (d Deposit) Select(key string) (File, error) {
+	if key == "" {
+		if len(d.Files) == 1 {
+			return d.Files[0], nil
+		}
+		return File{}, fmt.Errorf("the deposit %s holds %d files, select one like doi:%s#<file> from %s", d.DOI, len(d.Files), d.DOI, d.fileList())
+	}
+	for _, file := range d.Files {
+		if file.Key == key {
+			return file, nil
+		}
+	}
+	return File{}, fmt.Errorf("the deposit %s has no file %s, it holds %s", d.DOI, key, d.fileList())
+}
+
+func (d Deposit) fileList() string {
+	if len(d.Files) == 0 {
+		return "no public files"
+	}
+	keys := make([]string, len(d.Files))
+	for i, file := range d.Files {
+		keys[i] = file.Key
+	}
+	return strings.Join(keys, ", ")
+}
+
+// Client resolves DOIs and reads the deposits from the API of the repository
+type Client struct {
+	// Resolver is the handle API of doi.org, for DOIs whose repository is not known from their prefix
+	Resolver string
+	// ZenodoAPI is the REST API of Zenodo, or of an InvenioRDM instance using its API
+	ZenodoAPI string
+	HTTP      *http.Client
+}
+
+// ClientFromConfig returns a client for datasets.doi_resolver and datasets.zenodo_api
+func ClientFromConfig() *Client {
+	return &Client{
+		Resolver:  strings.TrimSuffix(viper.GetString("datasets.doi_resolver"), "/"),
+		ZenodoAPI: strings.TrimSuffix(viper.GetString("datasets.zenodo_api"), "/"),
+		HTTP:      &http.Client{Timeout: viper.GetDuration("datasets.doi_timeout")},
+	}
+}
+
+// the DOIs Zenodo mints carry the ID of the record, 10.5072 is the prefix of its sandbox
+var zenodoDOI = regexp.MustCompile(`^10\.(5281|5072)/zenodo\.(\d+)$`)
+
+// the landing pages of Zenodo records, which doi.org resolves other DOIs of Zenodo to
+var zenodoRecordPath = regexp.MustCompile(`^/records?/(\d+)/?$`)
+
+// Resolve looks up the deposit of the DOI and lists its files
+func (c *Client) Resolve(ctx context.Context, doi string) (Deposit, error) {
+	if match := zenodoDOI.FindStringSubmatch(doi); match != nil {
+		return c.zenodoRecord(ctx, doi, match[2])
+	}
+	landingPage, err := c.resolveHandle(ctx, doi)
+	if err != nil {
+		return Deposit{}, err
+	}
+	if zenodo, err := url.Parse(c.ZenodoAPI); err == nil && strings.EqualFold(landingPage.Host, zenodo.Host) {
+		if match := zenodoRecordPath.FindStringSubmatch(landingPage.Path); match != nil {
+			return c.zenodoRecord(ctx, doi, match[1])
+		}
+	}
+	return Deposit{}, fmt.Errorf("%w: %s resolves to %s, only Zenodo deposits can be fetched", ErrUnsupported, doi, landingPage)
+}
+
+// resolveHandle returns the landing page the DOI is registered with
+func (c *Client) resolveHandle(ctx context.Context, doi string) (*url.URL, error) {
+	var handle struct {
+		ResponseCode int `json:"responseCode"`
+		Values       []struct {
+			Type string `json:"type"`
+			Data struct {
+				Value string `json:"value"`
+			} `json:"data"`
+		} `json:"values"`
+	}
+	status, err := c.getJSON(ctx, c.Resolver+"/api/handles/"+doi+"?type=URL", &handle)
+	if status == http.StatusNotFound || (err == nil && handle.ResponseCode == 100) {
+		return nil, fmt.Errorf("%w: %s is not registered", ErrNotFound, doi)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not resolve %s: %w", doi, err)
+	}
+	for _, value := range handle.Values {
+		if value.Type == "URL" {
+			return url.Parse(value.Data.Value)
+		}
+	}
+	return nil, fmt.Errorf("%w: %s is registered without a landing page", ErrNotFound, doi)
+}
+
+func (c *Client) zenodoRecord(ctx context.Context, doi string, recordID string) (Deposit, error) {
+	// the current API lists key, checksum and links.self, the legacy one filename, filesize and links.download
+	var record struct {
+		Links struct {
+			HTML string `json:"html"`
+		} `json:"links"`
+		Files []struct {
+			Key      string `json:"key"`
+			Filename string `json:"filename"`
+			Size     int64  `json:"size"`
+			Filesize int64  `json:"filesize"`
+			Checksum string `json:"checksum"`
+			Links    struct {
+				Self     string `json:"self"`
+				Content  string `json:"content"`
+				Download string `json:"download"`
+			} `json:"links"`
+		} `json:"files"`
+	}
+	status, err := c.getJSON(ctx, c.ZenodoAPI+"/records/"+recordID, &record)
+	if status == http.StatusNotFound || status == http.StatusGone {
+		return Deposit{}, fmt.Errorf("%w: the Zenodo record %s of %s does not exist or was removed", ErrNotFound, recordID, doi)
+	}
+	if err != nil {
+		return Deposit{}, fmt.Errorf("could not read the Zenodo record %s of %s: %w", recordID, doi, err)
+	}
+
+	deposit := Deposit{DOI: doi, Repository: "zenodo", RecordURL: record.Links.HTML}
+	for _, entry := range record.Files {
+		file := File{Key: entry.Key, Size: entry.Size, Checksum: entry.Checksum}
+		if file.Key == "" {
+			file.Key, file.Size = entry.Filename, entry.Filesize
+		}
+		// the legacy API lists the bare MD5
+		if file.Checksum != "" && !strings.Contains(file.Checksum, ":") {
+			file.Checksum = "md5:" + file.Checksum
+		}
+		for _, link := range []string{entry.Links.Content, entry.Links.Self, entry.Links.Download} {
+			if link != "" {
+				file.URL = link
+				break
+			}
+		}
+		// the self link of the current API is the metadata of the file, its content is below
+		if file.URL == entry.Links.Self && entry.Key != "" && !strings.HasSuffix(file.URL, "/content") {
+			file.URL += "/content"
+		}
+		deposit.Files = append(deposit.Files, file)
+	}
+	return deposit, nil
+}
+
+func (c *Client) getJSON(ctx context.Context, endpoint string, target interface{}) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return resp.StatusCode, fmt.Errorf("%s answered %s", req.URL.Host, resp.Status)
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 16*1024*1024)).Decode(target); err != nil {
+		return resp.StatusCode, fmt.Errorf("the answer of %s is invalid: %w", req.URL.Host, err)
+	}
+	return resp.StatusCode, nil
+}
+
+// Download writes the file to dest and verifies its size and checksum. The content is
+// written next to dest first, so that dest only ever holds a verified file.
+func (c *Client) Download(ctx context.Context, file File, dest string) error {
+	algorithm, expected, ok := strings.Cut(file.Checksum, ":")
+	hasher := newHash(algorithm)
+	if !ok || hasher == nil {
+		return fmt.Errorf("the checksum %q of %s cannot be verified", file.Checksum, file.Key)
+	}
+	if file.URL == "" {
+		return fmt.Errorf("the repository lists no download for %s", file.Key)
+	}
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, file.URL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("the download of %s answered %s", file.Key, resp.Status)
+	}
+
+	partial, err := os.CreateTemp(filepath.Dir(dest), ".download-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(partial.Name())
+	size, err := io.Copy(io.MultiWriter(partial, hasher), resp.Body)
+	if closeErr := partial.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("the download of %s failed: %w", file.Key, err)
+	}
+	if file.Size > 0 && size != file.Size {
+		return fmt.Errorf("the download of %s has %d bytes, the repository lists %d", file.Key, size, file.Size)
+	}
+	if actual := hex.EncodeToString(hasher.Sum(nil)); !strings.EqualFold(actual, expected) {
+		return fmt.Errorf("the checksum of the download of %s is %s:%s, the repository lists %s", file.Key, algorithm, actual, file.Checksum)
+	}
+	if err := os.Chmod(partial.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(partial.Name(), dest)
+}
+
+func newHash(algorithm string) hash.Hash {
+	switch strings.ToLower(algorithm) {
+	case "md5":
+		return md5.New()
+	case "sha1":
+		return sha1.New()
+	case "sha256":
+		return sha256.New()
+	}
+	return nil
+}
@@ -0,0 +1,186 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// the topics of a run, subscribed to as run:{id}:{topic}
+const (
+	TopicStatus = "status"
+	TopicLogs   = "logs"
+	TopicStats  = "stats"
+)
+
+// Message is published on a channel and delivered to its subscribers as JSON
+type Message struct {
+	Channel string      `json:"channel"`
+	Type    string      `json:"type"`
+	Data    interface{} `json:"data,omitempty"`
+	Time    time.Time   `json:"time"`
+}
+
+// RunChannel names the channel of a topic of the run
+func RunChannel(runID int64, topic string) string {
+	return fmt.Sprintf("run:%d:%s", runID, topic)
+}
+
+// ParseRunChannel splits run:{id}:{topic} into the run ID and a known topic
+func ParseRunChannel(channel string) (int64, string, error) {
+	parts := strings.Split(channel, ":")
+	if len(parts) != 3 || parts[0] != "run" {
+		return 0, "", fmt.Errorf("invalid channel %q, use run:{id}:{topic}", channel)
+	}
+	runID, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return 0, "", fmt.Errorf("invalid run id in channel %q", channel)
+	}
+	switch parts[2] {
+	case TopicStatus, TopicLogs, TopicStats:
+		return runID, parts[2], nil
+	}
+	return 0, "", fmt.Errorf("unknown topic %q, use %s, %s or %s", parts[2], TopicStatus, TopicLogs, TopicStats)
+}
+
+// the process wide bus. Runs publish to it without knowing about any subscriber.
+var bus = struct {
+	mu          sync.RWMutex
+	subscribers map[string]map[*Subscriber]struct{}
+}{subscribers: make(map[string]map[*Subscriber]struct{})}
+
+// Publish delivers the message to all subscribers of the channel. It never blocks,
+// slow subscribers drop messages instead.
+func Publish(channel string, messageType string, data interface{}) {
+	bus.mu.RLock()
+	defer bus.mu.RUnlock()
+	subscribers := bus.subscribers[channel]
+	if len(subscribers) == 0 {
+		return
+	}
+	message := Message{Channel: channel, Type: messageType, Data: data, Time: time.Now().UTC()}
+	for subscriber := range subscribers {
+		subscriber.push(message)
+	}
+}
+
+// HasSubscribers tells if publishing on the channel reaches anybody
+func HasSubscribers(channel string) bool {
+	bus.mu.RLock()
+	defer bus.mu.RUnlock()
+	return len(bus.subscribers[channel]) > 0
+}
+
+// Subscriber queues the messages of its channels until they are read with Next.
+// Once limit messages are queued, the oldest log message is dropped to make room,
+// or the oldest message if none is queued.
+type Subscriber struct {
+	mu       sync.Mutex
+	channels map[string]struct{}
+	queue    []Message
+	limit    int
+	dropped  int
+	notify   chan struct{}
+}
+
+func NewSubscriber(limit int) *Subscriber {
+	return &Subscriber{
+		channels: make(map[string]struct{}),
+		limit:    max(limit, 1),
+		notify:   make(chan struct{}, 1),
+	}
+}
+
+// Subscribe adds the channel, whose messages are queued from now on
+func (s *Subscriber) Subscribe(channel string) {
+	s.mu.Lock()
+	s.channels[channel] = struct{}{}
+	s.mu.Unlock()
+
+	bus.mu.Lock()
+	defer bus.mu.Unlock()
+	if bus.subscribers[channel] == nil {
+		bus.subscribers[channel] = make(map[*Subscriber]struct{})
+	}
+	bus.subscribers[channel][s] = struct{}{}
+}
+
+// Unsubscribe removes the channel, messages already queued are still delivered
+func (s *Subscriber) Unsubscribe(channel string) {
+	s.mu.Lock()
+	delete(s.channels, channel)
+	s.mu.Unlock()
+
+	bus.mu.Lock()
+	defer bus.mu.Unlock()
+	delete(bus.subscribers[channel], s)
+	if len(bus.subscribers[channel]) == 0 {
+		delete(bus.subscribers, channel)
+	}
+}
+
+// Channels returns the number of subscribed channels
+func (s *Subscriber) Channels() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.channels)
+}
+
+// Close unsubscribes from all channels
+func (s *Subscriber) Close() {
+	s.mu.Lock()
+	channels := make([]string, 0, len(s.channels))
+	for channel := range s.channels {
+		channels = append(channels, channel)
+	}
+	s.mu.Unlock()
+	for _, channel := range channels {
+		s.Unsubscribe(channel)
+	}
+}
+
+func (s *Subscriber) push(message Message) {
+	s.mu.Lock()
+	if len(s.queue) >= s.limit {
+		drop := 0
+		for i, queued := range s.queue {
+			if strings.HasSuffix(queued.Channel, ":"+TopicLogs) {
+				drop = i
+				break
+			}
+		}
+		s.queue = append(s.queue[:drop], s.queue[drop+1:]...)
+		s.dropped++
+	}
+	s.queue = append(s.queue, message)
+	s.mu.Unlock()
+
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+}
+
+// Next waits for queued messages and returns them along with the number of messages
+// dropped since the last call
+func (s *Subscriber) Next(ctx context.Context) ([]Message, int, error) {
+	for {
+		s.mu.Lock()
+		if len(s.queue) > 0 || s.dropped > 0 {
+			messages, dropped := s.queue, s.dropped
+			s.queue, s.dropped = nil, 0
+			s.mu.Unlock()
+			return messages, dropped, nil
+		}
+		s.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return nil, 0, ctx.Err()
+		case <-s.notify:
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package files
+
+import (
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"syscall"
+)
+
+// FreeBytes is the space left to unprivileged users on the filesystem of the path
+func FreeBytes(path string) (uint64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return 0, err
+	}
+	return uint64(stat.Bavail) * uint64(stat.Bsize), nil
+}
+
+// DiskUsage sums the space the files below dir take on disk, like du. Sparse files count
+// with their allocated blocks. Files removed during the walk are skipped.
+func DiskUsage(dir string) (int64, error) {
+	var usage int64
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if p != dir && errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		info, err := d.Info()
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+			usage += stat.Blocks * 512
+		} else if info.Mode().IsRegular() {
+			usage += info.Size()
+		}
+		return nil
+	})
+	return usage, err
+}
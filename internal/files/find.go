@@ -1,6 +1,7 @@
 package files
 
 import (
+	"errors"
 	"fmt"
 	"io/fs"
 	"os"
@@ -16,8 +17,30 @@ type ResultFile struct {
 	AbsPath      string    `json:"absPath"`
 	Size         int64     `json:"size"`
 	LastModified time.Time `json:"lastModified"`
+	// Truncated is set for logs which exceeded run.max_log_bytes
+	Truncated bool `json:"truncated,omitempty"`
+	// HasPreview is set if a preview was generated for the file after the run finished
+	HasPreview bool `json:"has_preview"`
+	// Format and MimeType are set by the result listing, see DetectFormat
+	Format   string `json:"format,omitempty"`
+	MimeType string `json:"mimeType,omitempty"`
+	// Members are the files of a Zarr store or shapefile listed as one entry
+	Members []ResultFile `json:"members,omitempty"`
+	// Checksum is the SHA-256 of a result uploaded to the object storage
+	Checksum string `json:"checksum,omitempty"`
+	// Storage is "s3" for results whose local copy was removed after the upload
+	Storage string `json:"storage,omitempty"`
+	// Primary and Label are set by the result listing for annotated results
+	Primary bool   `json:"primary,omitempty"`
+	Label   string `json:"label,omitempty"`
 }
 
+// ErrOutsideDir is returned for a path which resolves to a file outside of the directory
+// it belongs to, like a symlink a tool placed into /out
+var ErrOutsideDir = errors.New("the path resolves outside of its directory")
+
+// ReadDir lists the files of the directory. Symlinks are skipped, they may point anywhere
+// on the host.
 func ReadDir(dirname string, recursive bool, toolBasePath string) ([]ResultFile, error) {
 	files, err := os.ReadDir(dirname)
 	if err != nil {
@@ -26,6 +49,9 @@ func ReadDir(dirname string, recursive bool, toolBasePath string) ([]ResultFile,
 
 	var result []ResultFile
 	for _, file := range files {
+		if file.Type()&fs.ModeSymlink != 0 {
+			continue
+		}
 		if file.IsDir() && recursive {
 			subResults, err := ReadDir(path.Join(dirname, file.Name()), recursive, toolBasePath)
 			if err != nil {
@@ -49,6 +75,34 @@ func ReadDir(dirname string, recursive bool, toolBasePath string) ([]ResultFile,
 	return result, nil
 }
 
+// ResolveContained resolves the symlinks of the path and returns the resolved path, if it
+// is still inside of dir
+func ResolveContained(dir, p string) (string, error) {
+	root, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return "", err
+	}
+	resolved, err := filepath.EvalSymlinks(p)
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(root, resolved)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s: %w", p, ErrOutsideDir)
+	}
+	return resolved, nil
+}
+
+// OpenContained opens the file at the path for reading, refusing files which resolve
+// outside of dir
+func OpenContained(dir, p string) (*os.File, error) {
+	resolved, err := ResolveContained(dir, p)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(resolved)
+}
+
 type Target string
 
 const (
@@ -0,0 +1,78 @@
+package files
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// contained creates a directory with a file, a file and a directory outside of it, and
+// symlinks to each of them
+func contained(t *testing.T) (dir, outside string) {
+	t.Helper()
+	base := t.TempDir()
+	dir, outside = filepath.Join(base, "out"), filepath.Join(base, "host")
+	for _, d := range []string{filepath.Join(dir, "nested"), outside} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, file := range []string{filepath.Join(dir, "nested", "result.txt"), filepath.Join(outside, "config.yaml")} {
+		if err := os.WriteFile(file, []byte("content"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	links := map[string]string{
+		"inner.txt":   filepath.Join(dir, "nested", "result.txt"),
+		"secret.yaml": filepath.Join(outside, "config.yaml"),
+		"linked":      outside,
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(dir, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir, outside
+}
+
+func TestReadDirSkipsSymlinks(t *testing.T) {
+	dir, _ := contained(t)
+	results, err := ReadDir(dir, true, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := relPaths(results); !slices.Equal(got, []string{"nested/result.txt"}) {
+		t.Errorf("the directory is listed as %v", got)
+	}
+}
+
+func TestResolveContained(t *testing.T) {
+	dir, _ := contained(t)
+	tests := []struct {
+		path    string
+		wantErr error
+	}{
+		{"nested/result.txt", nil},
+		{"inner.txt", nil},
+		{"secret.yaml", ErrOutsideDir},
+		{"linked/config.yaml", ErrOutsideDir},
+		{"missing.txt", os.ErrNotExist},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			file, err := OpenContained(dir, filepath.Join(dir, tt.path))
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("opening %s returned %v, want %v", tt.path, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			file.Close()
+		})
+	}
+}
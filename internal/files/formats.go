@@ -0,0 +1,221 @@
+package files
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	FormatNetCDF     = "netcdf"
+	FormatHDF5       = "hdf5"
+	FormatGeoTIFF    = "geotiff"
+	FormatTIFF       = "tiff"
+	FormatParquet    = "parquet"
+	FormatGRIB       = "grib"
+	FormatZarr       = "zarr"
+	FormatShapefile  = "shapefile"
+	FormatGeoJSON    = "geojson"
+	FormatGeoPackage = "geopackage"
+	FormatCSV        = "csv"
+	FormatTSV        = "tsv"
+	FormatJSON       = "json"
+	FormatMarkdown   = "markdown"
+	FormatText       = "text"
+	FormatPNG        = "png"
+	FormatJPEG       = "jpeg"
+	FormatGIF        = "gif"
+)
+
+// the bytes read from the start of a file to sniff its format
+const formatHeadBytes = 512
+
+// Format is the file format of a result, as told by its magic bytes or its extension
+type Format struct {
+	// Name is empty for formats gorun does not know, their MimeType comes from the
+	// extension or is sniffed by net/http
+	Name     string `json:"name,omitempty"`
+	MimeType string `json:"mimeType"`
+}
+
+// IsText tells if the file can be shown as text
+func (f Format) IsText() bool {
+	return strings.HasPrefix(f.MimeType, "text/") || f.Name == FormatJSON || f.Name == FormatGeoJSON
+}
+
+var (
+	netCDFFormat = Format{Name: FormatNetCDF, MimeType: "application/x-netcdf"}
+	hdf5Format   = Format{Name: FormatHDF5, MimeType: "application/x-hdf5"}
+	tiffFormat   = Format{Name: FormatTIFF, MimeType: "image/tiff"}
+	// the GeoTIFF profile of image/tiff registered by the OGC
+	geoTIFFFormat = Format{Name: FormatGeoTIFF, MimeType: "image/tiff; application=geotiff"}
+	parquetFormat = Format{Name: FormatParquet, MimeType: "application/vnd.apache.parquet"}
+	gribFormat    = Format{Name: FormatGRIB, MimeType: "application/x-grib"}
+	// ZarrFormat is the format of a Zarr store, which is a directory
+	ZarrFormat = Format{Name: FormatZarr, MimeType: "application/vnd.zarr"}
+)
+
+// formatsByExtension are the formats of the results gorun knows by their extension
+var formatsByExtension = map[string]Format{
+	".nc":      netCDFFormat,
+	".nc4":     netCDFFormat,
+	".cdf":     netCDFFormat,
+	".h5":      hdf5Format,
+	".hdf5":    hdf5Format,
+	".he5":     hdf5Format,
+	".tif":     tiffFormat,
+	".tiff":    tiffFormat,
+	".parquet": parquetFormat,
+	".grib":    gribFormat,
+	".grb":     gribFormat,
+	".grib2":   gribFormat,
+	".grb2":    gribFormat,
+	".zarr":    ZarrFormat,
+	".shp":     {Name: FormatShapefile, MimeType: "application/vnd.shp"},
+	".shx":     {MimeType: "application/vnd.shx"},
+	".dbf":     {MimeType: "application/vnd.dbf"},
+	".prj":     {MimeType: "text/plain"},
+	".geojson": {Name: FormatGeoJSON, MimeType: "application/geo+json"},
+	".gpkg":    {Name: FormatGeoPackage, MimeType: "application/geopackage+sqlite3"},
+	".csv":     {Name: FormatCSV, MimeType: "text/csv"},
+	".tsv":     {Name: FormatTSV, MimeType: "text/tab-separated-values"},
+	".json":    {Name: FormatJSON, MimeType: "application/json"},
+	".md":      {Name: FormatMarkdown, MimeType: "text/markdown"},
+	".txt":     {Name: FormatText, MimeType: "text/plain"},
+	".log":     {Name: FormatText, MimeType: "text/plain"},
+	".png":     {Name: FormatPNG, MimeType: "image/png"},
+	".jpg":     {Name: FormatJPEG, MimeType: "image/jpeg"},
+	".jpeg":    {Name: FormatJPEG, MimeType: "image/jpeg"},
+	".gif":     {Name: FormatGIF, MimeType: "image/gif"},
+}
+
+// formatByExtension returns the known format of the extension of name, if any
+func formatByExtension(name string) (Format, bool) {
+	format, ok := formatsByExtension[strings.ToLower(path.Ext(name))]
+	return format, ok
+}
+
+var hdf5Signature = []byte("\x89HDF\r\n\x1a\n")
+
+// sniffFormat reads the magic bytes of the scientific formats. The content wins over the
+// extension, only netCDF-4 files are HDF5 files told apart by their extension.
+func sniffFormat(name string, r io.ReaderAt) (Format, bool) {
+	head := make([]byte, 8)
+	n, _ := r.ReadAt(head, 0)
+	head = head[:n]
+	switch {
+	case bytes.HasPrefix(head, []byte("CDF\x01")), bytes.HasPrefix(head, []byte("CDF\x02")), bytes.HasPrefix(head, []byte("CDF\x05")):
+		return netCDFFormat, true
+	case bytes.HasPrefix(head, hdf5Signature):
+		if format, ok := formatByExtension(name); ok && format.Name == FormatNetCDF {
+			return netCDFFormat, true
+		}
+		return hdf5Format, true
+	case bytes.HasPrefix(head, []byte("PAR1")):
+		return parquetFormat, true
+	case bytes.HasPrefix(head, []byte("GRIB")):
+		return gribFormat, true
+	case bytes.HasPrefix(head, []byte("II*\x00")), bytes.HasPrefix(head, []byte("MM\x00*")),
+		bytes.HasPrefix(head, []byte("II+\x00")), bytes.HasPrefix(head, []byte("MM\x00+")):
+		if isGeoTIFF(r, head) {
+			return geoTIFFFormat, true
+		}
+		return tiffFormat, true
+	}
+	return Format{}, false
+}
+
+// the TIFF tags which georeference an image
+var geoTIFFTags = map[uint16]bool{
+	33550: true, // ModelPixelScale
+	33922: true, // ModelTiepoint
+	34264: true, // ModelTransformation
+	34735: true, // GeoKeyDirectory
+}
+
+// isGeoTIFF looks for the GeoTIFF tags in the first directory of a TIFF or BigTIFF file
+func isGeoTIFF(r io.ReaderAt, head []byte) bool {
+	if len(head) < 8 {
+		return false
+	}
+	var order binary.ByteOrder = binary.LittleEndian
+	if head[0] == 'M' {
+		order = binary.BigEndian
+	}
+	bigTIFF := order.Uint16(head[2:4]) == 43
+
+	var offset, count int64
+	entrySize := int64(12)
+	if bigTIFF {
+		header := make([]byte, 16)
+		if _, err := r.ReadAt(header, 0); err != nil {
+			return false
+		}
+		offset = int64(order.Uint64(header[8:16]))
+		counter := make([]byte, 8)
+		if _, err := r.ReadAt(counter, offset); err != nil {
+			return false
+		}
+		count, offset, entrySize = int64(order.Uint64(counter)), offset+8, 20
+	} else {
+		offset = int64(order.Uint32(head[4:8]))
+		counter := make([]byte, 2)
+		if _, err := r.ReadAt(counter, offset); err != nil {
+			return false
+		}
+		count, offset = int64(order.Uint16(counter)), offset+2
+	}
+	// a directory has far less entries, more are a corrupt file
+	if count <= 0 || count > 1024 {
+		return false
+	}
+	entries := make([]byte, count*entrySize)
+	if _, err := r.ReadAt(entries, offset); err != nil {
+		return false
+	}
+	for i := int64(0); i < count; i++ {
+		if geoTIFFTags[order.Uint16(entries[i*entrySize:])] {
+			return true
+		}
+	}
+	return false
+}
+
+// DetectFormat tells the format of a file from its content and name. The magic bytes of
+// the scientific formats come first, then the known extensions and the MIME types of the
+// system. Others are sniffed by net/http. Text types carry their charset.
+func DetectFormat(name string, r io.ReaderAt) Format {
+	format, ok := sniffFormat(name, r)
+	if !ok {
+		format, ok = formatByExtension(name)
+	}
+	head := make([]byte, formatHeadBytes)
+	n, _ := r.ReadAt(head, 0)
+	head = head[:n]
+	if !ok {
+		format.MimeType = mime.TypeByExtension(strings.ToLower(path.Ext(name)))
+		if format.MimeType == "" {
+			format.MimeType = http.DetectContentType(head)
+		}
+	}
+	if strings.HasPrefix(format.MimeType, "text/") && !strings.Contains(format.MimeType, "charset=") && utf8.Valid(head) {
+		format.MimeType += "; charset=utf-8"
+	}
+	return format
+}
+
+// DetectFileFormat opens the file to tell its format like DetectFormat
+func DetectFileFormat(filePath string) (Format, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return Format{}, err
+	}
+	defer file.Close()
+	return DetectFormat(filePath, file), nil
+}
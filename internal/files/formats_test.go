@@ -0,0 +1,203 @@
+package files
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// the fixtures are the smallest files of each format which still carry its magic bytes,
+// the results are the files a run leaves with a shapefile and two Zarr stores
+const (
+	formatFixtures = "testdata/formats"
+	resultFixtures = "testdata/results"
+)
+
+func TestDetectFileFormat(t *testing.T) {
+	tests := []struct {
+		file         string
+		wantName     string
+		wantMimeType string
+	}{
+		{"classic.nc", FormatNetCDF, "application/x-netcdf"},
+		{"offset.nc", FormatNetCDF, "application/x-netcdf"},
+		{"model.nc", FormatNetCDF, "application/x-netcdf"},
+		{"grid.h5", FormatHDF5, "application/x-hdf5"},
+		{"table.parquet", FormatParquet, "application/vnd.apache.parquet"},
+		{"forecast.grib2", FormatGRIB, "application/x-grib"},
+		{"elevation.tif", FormatGeoTIFF, "image/tiff; application=geotiff"},
+		{"geokeys.tif", FormatGeoTIFF, "image/tiff; application=geotiff"},
+		{"mosaic.tif", FormatGeoTIFF, "image/tiff; application=geotiff"},
+		{"scan.tif", FormatTIFF, "image/tiff"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			format, err := DetectFileFormat(filepath.Join(formatFixtures, tt.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if format.Name != tt.wantName || format.MimeType != tt.wantMimeType {
+				t.Errorf("%s is detected as %+v, want %s of %s", tt.file, format, tt.wantName, tt.wantMimeType)
+			}
+		})
+	}
+	if _, err := DetectFileFormat(filepath.Join(formatFixtures, "missing.nc")); !os.IsNotExist(err) {
+		t.Errorf("a missing file returned %v", err)
+	}
+}
+
+// the magic bytes win over a missing or wrong extension, the extension tells the formats
+// without magic bytes
+func TestDetectFormatByContentAndName(t *testing.T) {
+	fixture := func(name string) []byte {
+		t.Helper()
+		content, err := os.ReadFile(filepath.Join(formatFixtures, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return content
+	}
+	tests := []struct {
+		name         string
+		content      []byte
+		wantName     string
+		wantMimeType string
+	}{
+		{"download", fixture("classic.nc"), FormatNetCDF, "application/x-netcdf"},
+		{"table.csv", fixture("table.parquet"), FormatParquet, "application/vnd.apache.parquet"},
+		{"grid.nc4", fixture("grid.h5"), FormatNetCDF, "application/x-netcdf"},
+		{"grid.hdf5", fixture("model.nc"), FormatHDF5, "application/x-hdf5"},
+		{"forecast.bin", fixture("forecast.grib2"), FormatGRIB, "application/x-grib"},
+		{"elevation.TIF", fixture("elevation.tif"), FormatGeoTIFF, "image/tiff; application=geotiff"},
+		// a truncated TIFF has no directory to look for the tags in
+		{"cut.tif", fixture("elevation.tif")[:10], FormatTIFF, "image/tiff"},
+		{"roads.geojson", []byte(`{"type": "FeatureCollection", "features": []}`), FormatGeoJSON, "application/geo+json"},
+		{"layers.gpkg", []byte("SQLite format 3\x00"), FormatGeoPackage, "application/geopackage+sqlite3"},
+		{"summary.csv", []byte("station,mean\nA,12.75\n"), FormatCSV, "text/csv; charset=utf-8"},
+		{"notes.md", []byte("# Notes\n"), FormatMarkdown, "text/markdown; charset=utf-8"},
+		{"latin1.txt", []byte("caf\xe9\n"), FormatText, "text/plain"},
+		{"unknown", []byte("plain text\n"), "", "text/plain; charset=utf-8"},
+		{"blob", []byte{0, 1, 2, 3}, "", "application/octet-stream"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			format := DetectFormat(tt.name, bytes.NewReader(tt.content))
+			if format.Name != tt.wantName || format.MimeType != tt.wantMimeType {
+				t.Errorf("%s is detected as %+v, want %q of %s", tt.name, format, tt.wantName, tt.wantMimeType)
+			}
+		})
+	}
+}
+
+func TestFormatIsText(t *testing.T) {
+	for format, want := range map[Format]bool{
+		{Name: FormatCSV, MimeType: "text/csv; charset=utf-8"}:    true,
+		{Name: FormatGeoJSON, MimeType: "application/geo+json"}:   true,
+		{Name: FormatJSON, MimeType: "application/json"}:          true,
+		{Name: FormatText, MimeType: "text/plain; charset=utf-8"}: true,
+		netCDFFormat:                           false,
+		geoTIFFFormat:                          false,
+		{MimeType: "application/octet-stream"}: false,
+	} {
+		if got := format.IsText(); got != want {
+			t.Errorf("%+v.IsText() = %v, want %v", format, got, want)
+		}
+	}
+}
+
+// describedResults lists the result fixtures with their detected format, like the results
+// listing of a run
+func describedResults(t *testing.T) []ResultFile {
+	t.Helper()
+	results, err := ReadDir(resultFixtures, true, resultFixtures)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range results {
+		format, err := DetectFileFormat(results[i].AbsPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		results[i].Format, results[i].MimeType = format.Name, format.MimeType
+	}
+	return results
+}
+
+func relPaths(results []ResultFile) []string {
+	paths := make([]string, 0, len(results))
+	for _, result := range results {
+		paths = append(paths, filepath.ToSlash(result.RelPath))
+	}
+	return paths
+}
+
+func TestGroupResults(t *testing.T) {
+	results := describedResults(t)
+	sizes := make(map[string]int64)
+	for _, result := range results {
+		sizes[strings.SplitN(filepath.ToSlash(result.RelPath), "/", 2)[0]] += result.Size
+	}
+	grouped := GroupResults(results)
+
+	type entry struct {
+		format, mimeType string
+		size             int64
+		members          []string
+	}
+	want := map[string]entry{
+		"roads.shp": {
+			format: FormatShapefile, mimeType: "application/vnd.shp",
+			size:    sizes["roads.dbf"] + sizes["roads.prj"] + sizes["roads.shp"] + sizes["roads.shx"],
+			members: []string{"roads.dbf", "roads.prj", "roads.shp", "roads.shx"},
+		},
+		"store": {
+			format: FormatZarr, mimeType: "application/vnd.zarr",
+			size:    sizes["store"],
+			members: []string{"store/precip/c/0", "store/precip/zarr.json", "store/zarr.json"},
+		},
+		"summary.csv": {
+			format: FormatCSV, mimeType: "text/csv; charset=utf-8",
+			size: sizes["summary.csv"],
+		},
+		"temperature.zarr": {
+			format: FormatZarr, mimeType: "application/vnd.zarr",
+			size:    sizes["temperature.zarr"],
+			members: []string{"temperature.zarr/.zattrs", "temperature.zarr/.zgroup", "temperature.zarr/t/.zarray", "temperature.zarr/t/0"},
+		},
+	}
+	if got := relPaths(grouped); !slices.Equal(got, []string{"roads.shp", "store", "summary.csv", "temperature.zarr"}) {
+		t.Fatalf("the results are grouped into %v", got)
+	}
+	for _, result := range grouped {
+		relPath := filepath.ToSlash(result.RelPath)
+		w := want[relPath]
+		if result.Format != w.format || result.MimeType != w.mimeType || result.Size != w.size {
+			t.Errorf("%s is listed as %s of %s with %d bytes, want %s of %s with %d bytes",
+				relPath, result.Format, result.MimeType, result.Size, w.format, w.mimeType, w.size)
+		}
+		if got := relPaths(result.Members); !slices.Equal(got, w.members) && len(got)+len(w.members) > 0 {
+			t.Errorf("%s has the members %v, want %v", relPath, got, w.members)
+		}
+	}
+	if store := grouped[3]; store.Name != "temperature.zarr" || store.AbsPath != filepath.Join(resultFixtures, "temperature.zarr") {
+		t.Errorf("the Zarr store is named %s at %s", store.Name, store.AbsPath)
+	}
+}
+
+// a lonely sidecar stays a file of its own, and so does a directory which only looks like
+// a store
+func TestGroupResultsLeavesOtherFiles(t *testing.T) {
+	results := []ResultFile{
+		{Name: "notes.prj", RelPath: "notes.prj"},
+		{Name: "zarr.txt", RelPath: "zarr/zarr.txt"},
+		{Name: "roads.dbf", RelPath: "old/roads.dbf"},
+		{Name: "roads.shp", RelPath: "roads.shp"},
+	}
+	grouped := GroupResults(results)
+	if got := relPaths(grouped); !slices.Equal(got, []string{"notes.prj", "zarr/zarr.txt", "old/roads.dbf", "roads.shp"}) {
+		t.Errorf("the results are grouped into %v", got)
+	}
+}
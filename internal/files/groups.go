@@ -0,0 +1,118 @@
+package files
+
+import (
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// the files which mark a directory as Zarr store, of version 2 and 3
+var zarrMarkers = map[string]bool{".zgroup": true, ".zarray": true, "zarr.json": true}
+
+// the sidecar files of a shapefile, which share the name of its .shp file
+var shapefileSidecars = []string{".shx", ".dbf", ".prj", ".cpg", ".sbn", ".sbx", ".qix", ".fbn", ".fbx", ".ain", ".aih", ".atx", ".ixs", ".mxs", ".shp.xml"}
+
+// GroupResults lists the files of a Zarr store and of a shapefile as single entries, with
+// the files nested as their Members. The entry of a Zarr store is its directory, the entry
+// of a shapefile stays at its .shp file. Entries sum the size of their members.
+func GroupResults(results []ResultFile) []ResultFile {
+	stores := zarrStores(results)
+	shapefiles := make(map[string]bool)
+	for _, result := range results {
+		if strings.EqualFold(path.Ext(result.RelPath), ".shp") {
+			shapefiles[shapefileStem(filepath.ToSlash(result.RelPath))] = true
+		}
+	}
+
+	grouped := make([]ResultFile, 0, len(results))
+	entries := make(map[string]int)
+	for _, result := range results {
+		relPath := filepath.ToSlash(result.RelPath)
+		var key string
+		var entry ResultFile
+		if store := zarrStoreOf(relPath, stores); store != "" {
+			key = "zarr:" + store
+			entry = ResultFile{
+				Name:     path.Base(store),
+				RelPath:  store,
+				AbsPath:  strings.TrimSuffix(result.AbsPath, strings.TrimPrefix(relPath, store)),
+				Format:   ZarrFormat.Name,
+				MimeType: ZarrFormat.MimeType,
+			}
+		} else if stem := shapefileStem(relPath); stem != relPath && shapefiles[stem] {
+			key = "shapefile:" + stem
+			entry = ResultFile{Name: path.Base(stem) + ".shp", RelPath: stem + ".shp", Format: FormatShapefile}
+		} else {
+			grouped = append(grouped, result)
+			continue
+		}
+
+		i, ok := entries[key]
+		if !ok {
+			i = len(grouped)
+			entries[key] = i
+			grouped = append(grouped, entry)
+		}
+		group := &grouped[i]
+		// the shapefile entry is the .shp file, with the size of all its files
+		if group.Format == FormatShapefile && strings.EqualFold(path.Ext(relPath), ".shp") {
+			group.Name, group.RelPath, group.AbsPath = result.Name, result.RelPath, result.AbsPath
+			group.MimeType, group.HasPreview = result.MimeType, result.HasPreview
+		}
+		group.Size += result.Size
+		if result.LastModified.After(group.LastModified) {
+			group.LastModified = result.LastModified
+		}
+		group.Members = append(group.Members, result)
+	}
+	for i := range grouped {
+		sort.Slice(grouped[i].Members, func(a, b int) bool { return grouped[i].Members[a].RelPath < grouped[i].Members[b].RelPath })
+	}
+	return grouped
+}
+
+// zarrStores are the directories named *.zarr or holding the metadata of a Zarr store
+func zarrStores(results []ResultFile) map[string]bool {
+	stores := make(map[string]bool)
+	for _, result := range results {
+		relPath := filepath.ToSlash(result.RelPath)
+		if zarrMarkers[path.Base(relPath)] && path.Dir(relPath) != "." {
+			stores[path.Dir(relPath)] = true
+		}
+		dir := path.Dir(relPath)
+		for dir != "." && dir != "/" {
+			if strings.EqualFold(path.Ext(dir), ".zarr") {
+				stores[dir] = true
+			}
+			dir = path.Dir(dir)
+		}
+	}
+	return stores
+}
+
+// zarrStoreOf returns the outermost store the file is in, the groups and arrays of a store
+// are stores themselves
+func zarrStoreOf(relPath string, stores map[string]bool) string {
+	var store string
+	for dir := path.Dir(relPath); dir != "." && dir != "/"; dir = path.Dir(dir) {
+		if stores[dir] {
+			store = dir
+		}
+	}
+	return store
+}
+
+// shapefileStem strips the extension of a shapefile or its sidecars, other paths are kept
+func shapefileStem(relPath string) string {
+	lower := strings.ToLower(relPath)
+	if strings.HasSuffix(lower, ".shp") {
+		return relPath[:len(relPath)-len(".shp")]
+	}
+	for _, sidecar := range shapefileSidecars {
+		if strings.HasSuffix(lower, sidecar) {
+			return relPath[:len(relPath)-len(sidecar)]
+		}
+	}
+	return relPath
+}
@@ -1,24 +1,296 @@
 package files
 
 import (
+	"errors"
+	"fmt"
+	"io/fs"
 	"os"
 	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
 
 	"github.com/hydrocode-de/gorun/internal/helper"
+	"github.com/spf13/viper"
 )
 
+// the container paths managed by gorun, which may not be shadowed by other mounts
+var reservedContainerPaths = []string{"/in", "/out", "/src"}
+
+const ScratchContainerPath = "/tmp/scratch"
+
+type ExtraMount struct {
+	HostPath      string `json:"host_path" mapstructure:"host_path"`
+	ContainerPath string `json:"container_path" mapstructure:"container_path"`
+	ReadOnly      bool   `json:"read_only" mapstructure:"read_only"`
+}
+
 func CreateNewMountPaths(mountPath string, level string) map[string]string {
-	mounts := make(map[string]string)
+	mounts := NewMountPaths(mountPath, level)
+	for _, hostPath := range mounts {
+		os.MkdirAll(hostPath, 0755)
+	}
+
+	return mounts
+}
 
+// NewMountPaths returns the in and out mounts of a new run without creating them
+func NewMountPaths(mountPath string, level string) map[string]string {
 	if level == "_random" {
 		level = helper.GetRandomString(12)
 	}
-	mounts["/in"] = path.Join(mountPath, level, "in")
-	mounts["/out"] = path.Join(mountPath, level, "out")
+	return map[string]string{
+		"/in":  path.Join(mountPath, level, "in"),
+		"/out": path.Join(mountPath, level, "out"),
+	}
+}
 
-	for _, hostPath := range mounts {
-		os.MkdirAll(hostPath, 0755)
+// DefaultRunDirTemplate is the layout of the run directories if files.run_dir_template is not set
+const DefaultRunDirTemplate = "{mount_path}/run-{run_id}"
+
+// RunDirName is the directory below the mount path holding the mounts of a run in the default layout
+func RunDirName(runID int64) string {
+	return fmt.Sprintf("run-%d", runID)
+}
+
+// ParseRunDirName returns the ID of the run a directory below the mount path belongs to.
+// Both run-<id> and a bare ID, as written by a template ending in {run_id}, are understood.
+func ParseRunDirName(name string) (int64, bool) {
+	id := strings.TrimPrefix(name, "run-")
+	runID, err := strconv.ParseInt(id, 10, 64)
+	if err != nil || runID <= 0 {
+		return 0, false
 	}
+	return runID, true
+}
 
-	return mounts
+// sanitizePathComponent replaces everything but letters, digits, dots, dashes and underscores,
+// so that a value can neither add directories nor climb out of the mount path
+func sanitizePathComponent(value string) string {
+	sanitized := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '-', r == '_':
+			return r
+		default:
+			return '_'
+		}
+	}, value)
+	sanitized = strings.TrimLeft(sanitized, ".")
+	if sanitized == "" {
+		return "_"
+	}
+	return sanitized
+}
+
+// RunDir fills the placeholders {mount_path}, {user_id}, {run_id} and {tool} of a run directory
+// template. The template has to contain {run_id} and no .. components, and the directory has to
+// be below the mount path and still end up in the directory named by {run_id}. Otherwise
+// deleting the run could remove the directories of other runs.
+func RunDir(template string, mountPath string, runID int64, userID string, toolName string) (string, error) {
+	if template == "" {
+		template = DefaultRunDirTemplate
+	}
+	if !strings.Contains(template, "{run_id}") {
+		return "", fmt.Errorf("the run directory template %s has to contain {run_id}", template)
+	}
+	segments := strings.Split(filepath.ToSlash(template), "/")
+	if slices.Contains(segments, "..") {
+		return "", fmt.Errorf("the run directory template %s may not contain .. components", template)
+	}
+	mountPath, err := filepath.Abs(mountPath)
+	if err != nil {
+		return "", err
+	}
+
+	replacer := strings.NewReplacer(
+		"{mount_path}", mountPath,
+		"{user_id}", sanitizePathComponent(userID),
+		"{run_id}", strconv.FormatInt(runID, 10),
+		"{tool}", sanitizePathComponent(toolName),
+	)
+	runDir := filepath.Clean(replacer.Replace(template))
+	if !filepath.IsAbs(runDir) {
+		runDir = filepath.Join(mountPath, runDir)
+	}
+	rel, err := filepath.Rel(mountPath, runDir)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("the run directory template %s does not resolve to a directory below the mount path %s", template, mountPath)
+	}
+	// the segment holding {run_id} has to be a directory of its own below the mount path
+	relSegments := strings.Split(filepath.ToSlash(rel), "/")
+	for _, segment := range segments {
+		if strings.Contains(segment, "{run_id}") && !slices.Contains(relSegments, replacer.Replace(segment)) {
+			return "", fmt.Errorf("the run directory template %s does not place every run in a directory named by {run_id}", template)
+		}
+	}
+	return runDir, nil
+}
+
+// ScratchPath returns the scratch directory next to the in and out mounts of a run
+func ScratchPath(mounts map[string]string) string {
+	return path.Join(path.Dir(mounts["/in"]), "scratch")
+}
+
+// CreateScratchPath creates a scratch directory next to the in and out mounts of a run
+func CreateScratchPath(mounts map[string]string) (string, error) {
+	scratchPath := ScratchPath(mounts)
+	if err := os.MkdirAll(scratchPath, 0755); err != nil {
+		return "", err
+	}
+	return scratchPath, nil
+}
+
+func ValidateContainerPath(containerPath string) error {
+	if !path.IsAbs(containerPath) {
+		return fmt.Errorf("the container path %s has to be absolute", containerPath)
+	}
+
+	cleaned := path.Clean(containerPath)
+	for _, reserved := range append(reservedContainerPaths, ScratchContainerPath) {
+		if cleaned == reserved || strings.HasPrefix(cleaned, reserved+"/") {
+			return fmt.Errorf("the container path %s would shadow the gorun managed path %s", containerPath, reserved)
+		}
+	}
+	return nil
+}
+
+// ParseExtraMounts parses mounts given as host:container[:ro], separated by semicolons
+func ParseExtraMounts(value string) ([]ExtraMount, error) {
+	mounts := make([]ExtraMount, 0)
+	for _, chunk := range strings.Split(value, ";") {
+		chunk = strings.TrimSpace(chunk)
+		if chunk == "" {
+			continue
+		}
+		parts := strings.Split(chunk, ":")
+		if len(parts) < 2 || len(parts) > 3 {
+			return nil, fmt.Errorf("invalid extra mount %s. Use the form host:container[:ro]", chunk)
+		}
+		mount := ExtraMount{HostPath: parts[0], ContainerPath: parts[1]}
+		if len(parts) == 3 {
+			if parts[2] != "ro" && parts[2] != "rw" {
+				return nil, fmt.Errorf("invalid mount mode %s for extra mount %s. Use 'ro' or 'rw'", parts[2], chunk)
+			}
+			mount.ReadOnly = parts[2] == "ro"
+		}
+		mounts = append(mounts, mount)
+	}
+	return mounts, nil
+}
+
+// ExtraMountsFromConfig reads the server-level extra_mounts, which are applied to every run
+func ExtraMountsFromConfig() ([]ExtraMount, error) {
+	var mounts []ExtraMount
+	switch value := viper.Get("extra_mounts").(type) {
+	case nil:
+		return nil, nil
+	case string:
+		parsed, err := ParseExtraMounts(value)
+		if err != nil {
+			return nil, err
+		}
+		mounts = parsed
+	default:
+		if err := viper.UnmarshalKey("extra_mounts", &mounts); err != nil {
+			return nil, fmt.Errorf("invalid extra_mounts configuration: %w", err)
+		}
+	}
+
+	for _, mount := range mounts {
+		if !path.IsAbs(mount.HostPath) {
+			return nil, fmt.Errorf("the host path %s of an extra mount has to be absolute", mount.HostPath)
+		}
+		if err := ValidateContainerPath(mount.ContainerPath); err != nil {
+			return nil, err
+		}
+	}
+	return mounts, nil
+}
+
+// DefaultRunUser returns uid:gid of the gorun process, which is used for run containers by default
+func DefaultRunUser() string {
+	uid, gid := os.Getuid(), os.Getgid()
+	if uid < 0 || gid < 0 {
+		return ""
+	}
+	return fmt.Sprintf("%d:%d", uid, gid)
+}
+
+// lchown is replaced by the tests, which cannot drop the permission to change owners
+var lchown = os.Lchown
+
+// PrepareMountOwnership hands the given host directories to a numeric uid:gid user. If
+// changing the owner is not permitted, the files are handed to the group and made
+// group-writable instead, which needs gorun to be a member of the group. The permissions
+// are never widened to other users.
+func PrepareMountOwnership(hostPaths []string, user string) error {
+	uid, gid, ok := parseNumericUser(user)
+	if !ok {
+		return nil
+	}
+
+	for _, hostPath := range hostPaths {
+		err := filepath.WalkDir(hostPath, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			return lchown(p, uid, gid)
+		})
+		if err == nil {
+			continue
+		}
+		if !errors.Is(err, fs.ErrPermission) {
+			return err
+		}
+		if err := shareWithGroup(hostPath, gid); err != nil {
+			return fmt.Errorf("cannot hand %s to the run user %s, gorun may not change its owner and %w. Run gorun with the permission to change owners, or use a group of gorun in run.user", hostPath, user, err)
+		}
+	}
+	return nil
+}
+
+// shareWithGroup hands the files below hostPath to the group and makes them group-writable.
+// The directories are setgid, so that the files created in them belong to the group as well.
+func shareWithGroup(hostPath string, gid int) error {
+	groups, _ := os.Getgroups()
+	if gid != os.Getgid() && !slices.Contains(groups, gid) {
+		return fmt.Errorf("gorun is not a member of the group %d", gid)
+	}
+	return filepath.WalkDir(hostPath, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := lchown(p, -1, gid); err != nil {
+			return err
+		}
+		if d.Type()&fs.ModeSymlink != 0 {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		mode := info.Mode().Perm() | 0060
+		if d.IsDir() {
+			mode |= 0010 | os.ModeSetgid
+		}
+		return os.Chmod(p, mode)
+	})
+}
+
+func parseNumericUser(user string) (int, int, bool) {
+	parts := strings.SplitN(user, ":", 2)
+	uid, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, 0, false
+	}
+	gid := uid
+	if len(parts) == 2 {
+		gid, err = strconv.Atoi(parts[1])
+		if err != nil {
+			return 0, 0, false
+		}
+	}
+	return uid, gid, true
 }
@@ -0,0 +1,147 @@
+package files
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+// denyChown makes changing the owner fail like for an unprivileged gorun, the group may still be changed
+func denyChown(t *testing.T) {
+	t.Helper()
+	t.Cleanup(func() { lchown = os.Lchown })
+	lchown = func(name string, uid int, gid int) error {
+		if uid != -1 {
+			return &fs.PathError{Op: "lchown", Path: name, Err: syscall.EPERM}
+		}
+		return os.Lchown(name, uid, gid)
+	}
+}
+
+// mountDir creates a run mount with a nested directory and a file
+func mountDir(t *testing.T) string {
+	t.Helper()
+	dir := filepath.Join(t.TempDir(), "out")
+	if err := os.MkdirAll(filepath.Join(dir, "nested"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "nested", "file.txt"), []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestPrepareMountOwnershipSharesWithGroup(t *testing.T) {
+	denyChown(t)
+	dir := mountDir(t)
+	gid := os.Getgid()
+
+	if err := PrepareMountOwnership([]string{dir}, fmt.Sprintf("%d:%d", os.Getuid()+1000, gid)); err != nil {
+		t.Fatalf("PrepareMountOwnership failed: %v", err)
+	}
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		stat := info.Sys().(*syscall.Stat_t)
+		if int(stat.Gid) != gid {
+			t.Errorf("%s belongs to the group %d, want %d", p, stat.Gid, gid)
+		}
+		if info.Mode().Perm()&0020 == 0 {
+			t.Errorf("%s is not group-writable: %s", p, info.Mode())
+		}
+		if info.Mode().Perm()&0002 != 0 {
+			t.Errorf("%s is world-writable: %s", p, info.Mode())
+		}
+		if d.IsDir() && info.Mode()&os.ModeSetgid == 0 {
+			t.Errorf("the directory %s is not setgid: %s", p, info.Mode())
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPrepareMountOwnershipFailsWithoutGroup(t *testing.T) {
+	denyChown(t)
+	dir := mountDir(t)
+	groups, _ := os.Getgroups()
+	gid := 54321
+	for gid == os.Getgid() || slices.Contains(groups, gid) {
+		gid++
+	}
+
+	err := PrepareMountOwnership([]string{dir}, fmt.Sprintf("%d:%d", os.Getuid()+1000, gid))
+	if err == nil || !strings.Contains(err.Error(), "run.user") {
+		t.Fatalf("PrepareMountOwnership returned %v, want an error naming run.user", err)
+	}
+	info, err := os.Stat(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0755 {
+		t.Errorf("the permissions of the mount changed to %s", info.Mode())
+	}
+}
+
+func TestPrepareMountOwnershipIgnoresNamedUsers(t *testing.T) {
+	denyChown(t)
+	dir := mountDir(t)
+	if err := PrepareMountOwnership([]string{dir}, "nobody"); err != nil {
+		t.Fatalf("PrepareMountOwnership failed for a named user: %v", err)
+	}
+}
+
+func TestRunDir(t *testing.T) {
+	mountPath := t.TempDir()
+	tests := []struct {
+		template string
+		want     string
+		// wantErr is a part of the error, if the template is refused
+		wantErr string
+	}{
+		{template: "", want: "run-7"},
+		{template: "{mount_path}/{user_id}/{tool}/run-{run_id}", want: "alice/echo/run-7"},
+		{template: "{user_id}/{run_id}", want: "alice/7"},
+		{template: "{mount_path}/./{user_id}//{run_id}/", want: "alice/7"},
+		{template: "{mount_path}/{user_id}", wantErr: "has to contain {run_id}"},
+		{template: "{mount_path}/{user_id}/{run_id}/..", wantErr: "may not contain .. components"},
+		{template: "{mount_path}/../{run_id}", wantErr: "may not contain .. components"},
+		{template: "/elsewhere/{run_id}", wantErr: "below the mount path"},
+		{template: "{mount_path}-{run_id}", wantErr: "below the mount path"},
+		{template: "{mount_path}{run_id}/x", wantErr: "below the mount path"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.template, func(t *testing.T) {
+			got, err := RunDir(tt.template, mountPath, 7, "alice", "echo")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("the template resolved to %q, %v, want an error with %q", got, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := filepath.Join(mountPath, tt.want); got != want {
+				t.Errorf("the template resolved to %s, want %s", got, want)
+			}
+		})
+	}
+
+	// the owner and the tool name cannot add directories
+	got, err := RunDir("{mount_path}/{user_id}/{tool}/{run_id}", mountPath, 7, "../..", "a/b")
+	if err != nil || got != filepath.Join(mountPath, "_..", "a_b", "7") {
+		t.Errorf("the sanitized template resolved to %s, %v", got, err)
+	}
+}
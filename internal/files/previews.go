@@ -0,0 +1,269 @@
+package files
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif"
+	_ "image/jpeg"
+	"image/png"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// PreviewDir is the directory in /out the generated previews are stored in.
+// It is excluded from the results of a run.
+const PreviewDir = ".previews"
+
+const (
+	PreviewThumbnail = "thumbnail"
+	PreviewTable     = "table"
+	PreviewText      = "text"
+)
+
+const (
+	thumbnailSize    = 256
+	maxImagePixels   = 50_000_000
+	tablePreviewRows = 20
+	textPreviewBytes = 4096
+)
+
+// previewExtensions maps the kind of a preview to the extension of its file in PreviewDir
+var previewExtensions = map[string]string{
+	PreviewThumbnail: ".png",
+	PreviewTable:     ".json",
+	PreviewText:      ".txt",
+}
+
+// TablePreview holds the first rows of a CSV file
+type TablePreview struct {
+	Columns   []string   `json:"columns"`
+	Rows      [][]string `json:"rows"`
+	Truncated bool       `json:"truncated"`
+}
+
+// previewKind returns the kind of preview generated for a result file, or an empty string
+func previewKind(relPath string) string {
+	// the kind has to be known without reading the file, so it follows the extension
+	format, _ := formatByExtension(relPath)
+	switch format.Name {
+	case FormatPNG, FormatJPEG, FormatGIF:
+		return PreviewThumbnail
+	case FormatCSV:
+		return PreviewTable
+	case FormatText, FormatJSON, FormatMarkdown:
+		return PreviewText
+	}
+	return ""
+}
+
+// PreviewPath returns the path of the generated preview of a result file and its kind.
+// The preview is not checked to exist.
+func PreviewPath(outDir string, relPath string) (string, string, bool) {
+	kind := previewKind(relPath)
+	if kind == "" {
+		return "", "", false
+	}
+	return filepath.Join(outDir, PreviewDir, filepath.FromSlash(relPath)+previewExtensions[kind]), kind, true
+}
+
+// IsPreview reports if a path relative to /out is inside PreviewDir
+func IsPreview(relPath string) bool {
+	return strings.HasPrefix(filepath.ToSlash(relPath), PreviewDir+"/")
+}
+
+// GeneratePreviews writes previews of the known file types in outDir into PreviewDir.
+// Files larger than maxBytes are skipped. Generation stops once ctx is done.
+func GeneratePreviews(ctx context.Context, outDir string, maxBytes int64) (int, error) {
+	generated := 0
+	err := filepath.WalkDir(outDir, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		rel, err := filepath.Rel(outDir, filePath)
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			if rel == PreviewDir {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		previewPath, kind, ok := PreviewPath(outDir, rel)
+		if !ok {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil || (maxBytes > 0 && info.Size() > maxBytes) {
+			return nil
+		}
+
+		if err := writePreview(filePath, previewPath, kind); err != nil {
+			// a file that cannot be previewed does not stop the others
+			return nil
+		}
+		generated++
+		return nil
+	})
+	return generated, err
+}
+
+// writePreview renders the preview into a temporary file first, so that it is never read half written
+func writePreview(filePath string, previewPath string, kind string) error {
+	if err := os.MkdirAll(filepath.Dir(previewPath), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(previewPath), ".preview-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	switch kind {
+	case PreviewThumbnail:
+		err = writeThumbnail(filePath, tmp)
+	case PreviewTable:
+		err = writeTablePreview(filePath, tmp)
+	case PreviewText:
+		err = writeTextPreview(filePath, tmp)
+	default:
+		err = fmt.Errorf("unknown preview kind %s", kind)
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), previewPath)
+}
+
+func writeThumbnail(filePath string, w io.Writer) error {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	// the dimensions are checked first, as decoding allocates the full image
+	config, _, err := image.DecodeConfig(file)
+	if err != nil {
+		return err
+	}
+	if config.Width*config.Height > maxImagePixels {
+		return fmt.Errorf("the image %s is too large for a thumbnail", filePath)
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	img, _, err := image.Decode(file)
+	if err != nil {
+		return err
+	}
+	return png.Encode(w, downscale(img, thumbnailSize))
+}
+
+// downscale averages the pixels of img into an image whose longer side is at most size
+func downscale(img image.Image, size int) image.Image {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width <= size && height <= size {
+		return img
+	}
+	scaledWidth, scaledHeight := size, height*size/width
+	if height > width {
+		scaledWidth, scaledHeight = width*size/height, size
+	}
+	scaledWidth, scaledHeight = max(scaledWidth, 1), max(scaledHeight, 1)
+
+	scaled := image.NewRGBA(image.Rect(0, 0, scaledWidth, scaledHeight))
+	for y := 0; y < scaledHeight; y++ {
+		y0, y1 := y*height/scaledHeight, max((y+1)*height/scaledHeight, y*height/scaledHeight+1)
+		for x := 0; x < scaledWidth; x++ {
+			x0, x1 := x*width/scaledWidth, max((x+1)*width/scaledWidth, x*width/scaledWidth+1)
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					pr, pg, pb, pa := img.At(bounds.Min.X+sx, bounds.Min.Y+sy).RGBA()
+					r, g, b, a, n = r+uint64(pr), g+uint64(pg), b+uint64(pb), a+uint64(pa), n+1
+				}
+			}
+			scaled.Set(x, y, color.RGBA64{R: uint16(r / n), G: uint16(g / n), B: uint16(b / n), A: uint16(a / n)})
+		}
+	}
+	return scaled
+}
+
+func writeTablePreview(filePath string, w io.Writer) error {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(bufio.NewReader(file))
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	columns, err := reader.Read()
+	if err != nil {
+		return err
+	}
+
+	preview := TablePreview{Columns: columns, Rows: make([][]string, 0, tablePreviewRows)}
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if len(preview.Rows) == tablePreviewRows {
+			preview.Truncated = true
+			break
+		}
+		preview.Rows = append(preview.Rows, record)
+	}
+	return json.NewEncoder(w).Encode(preview)
+}
+
+func writeTextPreview(filePath string, w io.Writer) error {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	head := make([]byte, textPreviewBytes)
+	n, err := io.ReadFull(file, head)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return err
+	}
+	head = head[:n]
+	// cut a full head at the last complete line
+	if n == textPreviewBytes {
+		if i := strings.LastIndexByte(string(head), '\n'); i > 0 {
+			head = head[:i+1]
+		}
+	}
+	_, err = w.Write(head)
+	return err
+}
@@ -0,0 +1,192 @@
+package files
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// UploadMarker is written into the directory of an upload while it is written.
+// Other processes cleaning the temp path skip directories with a fresh marker.
+const UploadMarker = ".uploading"
+
+// held counts the paths below the temp path an upload or run creation of this process uses
+var held = struct {
+	sync.Mutex
+	paths map[string]int
+}{paths: make(map[string]int)}
+
+// HoldTemp protects paths from CleanTemp until the returned release is called
+func HoldTemp(paths ...string) func() {
+	cleaned := make([]string, 0, len(paths))
+	held.Lock()
+	for _, p := range paths {
+		if abs, err := filepath.Abs(p); err == nil {
+			held.paths[abs]++
+			cleaned = append(cleaned, abs)
+		}
+	}
+	held.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			held.Lock()
+			defer held.Unlock()
+			for _, p := range cleaned {
+				if held.paths[p]--; held.paths[p] <= 0 {
+					delete(held.paths, p)
+				}
+			}
+		})
+	}
+}
+
+// removedTempEntries and removedTempBytes count what CleanTemp removed since the process started
+var removedTempEntries, removedTempBytes atomic.Int64
+
+// RemovedTempEntries returns the number of stale temp entries removed since the process started
+func RemovedTempEntries() int64 {
+	return removedTempEntries.Load()
+}
+
+// RemovedTempBytes returns the size of the stale temp entries removed since the process started
+func RemovedTempBytes() int64 {
+	return removedTempBytes.Load()
+}
+
+// isHeld reports if entry or any path below it is held by this process or in keep
+func isHeld(entry string, keep []string) bool {
+	held.Lock()
+	defer held.Unlock()
+	for p := range held.paths {
+		if isBelow(p, entry) {
+			return true
+		}
+	}
+	for _, p := range keep {
+		if isBelow(p, entry) {
+			return true
+		}
+	}
+	return false
+}
+
+// isBelow reports if p is entry or a path below it
+func isBelow(p string, entry string) bool {
+	return p == entry || strings.HasPrefix(p, entry+string(filepath.Separator))
+}
+
+// TempEntry is a stale file or directory in the temp path
+type TempEntry struct {
+	Path       string    `json:"path"`
+	Size       int64     `json:"size"`
+	ModifiedAt time.Time `json:"modified_at"`
+	Removed    bool      `json:"removed"`
+}
+
+// tempEntries lists the upload directories and the other top level entries of tempPath
+func tempEntries(tempPath string) ([]string, error) {
+	entries, err := os.ReadDir(tempPath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	paths := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if entry.Name() != "uploads" || !entry.IsDir() {
+			paths = append(paths, filepath.Join(tempPath, entry.Name()))
+			continue
+		}
+		uploads, err := os.ReadDir(filepath.Join(tempPath, "uploads"))
+		if err != nil {
+			return nil, err
+		}
+		for _, upload := range uploads {
+			paths = append(paths, filepath.Join(tempPath, "uploads", upload.Name()))
+		}
+	}
+	return paths, nil
+}
+
+// lastModified returns the latest modification time of entry and all files below it, and their size
+func lastModified(entry string) (time.Time, int64, error) {
+	var latest time.Time
+	var size int64
+	err := filepath.WalkDir(entry, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+		if info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return latest, size, err
+}
+
+// CleanTemp removes the entries of tempPath which were not modified within maxAge before now.
+// Uploads held by this process, entries holding one of the keep paths and directories with an
+// UploadMarker younger than maxAge are kept. With dryRun, the stale entries are only listed.
+func CleanTemp(tempPath string, maxAge time.Duration, now time.Time, dryRun bool, keep ...string) ([]TempEntry, error) {
+	tempPath, err := filepath.Abs(tempPath)
+	if err != nil {
+		return nil, err
+	}
+	kept := make([]string, 0, len(keep))
+	for _, p := range keep {
+		if abs, err := filepath.Abs(p); err == nil {
+			kept = append(kept, abs)
+		}
+	}
+	paths, err := tempEntries(tempPath)
+	if err != nil {
+		return nil, err
+	}
+
+	stale := make([]TempEntry, 0)
+	cutoff := now.Add(-maxAge)
+	for _, entry := range paths {
+		if isHeld(entry, kept) {
+			continue
+		}
+		if info, err := os.Stat(filepath.Join(entry, UploadMarker)); err == nil && info.ModTime().After(cutoff) {
+			continue
+		}
+		modified, size, err := lastModified(entry)
+		if err != nil {
+			// the entry may have been removed in the meantime
+			continue
+		}
+		if modified.After(cutoff) {
+			continue
+		}
+
+		cleaned := TempEntry{Path: entry, Size: size, ModifiedAt: modified}
+		if !dryRun {
+			if err := os.RemoveAll(entry); err != nil {
+				return stale, err
+			}
+			cleaned.Removed = true
+			removedTempEntries.Add(1)
+			removedTempBytes.Add(size)
+		}
+		stale = append(stale, cleaned)
+	}
+	sort.Slice(stale, func(i, j int) bool { return stale[i].Path < stale[j].Path })
+	return stale, nil
+}
@@ -0,0 +1,131 @@
+package files
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// epoch is the fake clock of the tests, the entries are dated relative to it
+var epoch = time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+// tempUpload writes an upload with a file of size bytes below tempPath, last modified at modified
+func tempUpload(t *testing.T, tempPath string, name string, size int, modified time.Time) string {
+	t.Helper()
+	dir := filepath.Join(tempPath, "uploads", name)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(dir, "data.txt")
+	if err := os.WriteFile(file, make([]byte, size), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{file, dir} {
+		if err := os.Chtimes(p, modified, modified); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// entryPaths lists the paths of the entries
+func entryPaths(entries []TempEntry) []string {
+	paths := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		paths = append(paths, entry.Path)
+	}
+	return paths
+}
+
+func TestCleanTempRemovesStaleEntries(t *testing.T) {
+	tempPath := t.TempDir()
+	stale := tempUpload(t, tempPath, "stale", 10, epoch.Add(-2*time.Hour))
+	fresh := tempUpload(t, tempPath, "fresh", 20, epoch.Add(-30*time.Minute))
+	entries, bytes := RemovedTempEntries(), RemovedTempBytes()
+
+	removed, err := CleanTemp(tempPath, time.Hour, epoch, false)
+	if err != nil {
+		t.Fatalf("CleanTemp failed: %v", err)
+	}
+	if paths := entryPaths(removed); !slices.Equal(paths, []string{stale}) {
+		t.Errorf("CleanTemp removed %v, want %v", paths, []string{stale})
+	}
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Errorf("the stale upload still exists: %v", err)
+	}
+	if _, err := os.Stat(fresh); err != nil {
+		t.Errorf("the fresh upload was removed: %v", err)
+	}
+	if n := RemovedTempEntries() - entries; n != 1 {
+		t.Errorf("%d removed entries were counted, want 1", n)
+	}
+	if n := RemovedTempBytes() - bytes; n != 10 {
+		t.Errorf("%d removed bytes were counted, want 10", n)
+	}
+
+	// the fresh upload turns stale once the clock passes its age
+	removed, err = CleanTemp(tempPath, time.Hour, epoch.Add(time.Hour), false)
+	if err != nil {
+		t.Fatalf("CleanTemp failed: %v", err)
+	}
+	if paths := entryPaths(removed); !slices.Equal(paths, []string{fresh}) {
+		t.Errorf("CleanTemp removed %v an hour later, want %v", paths, []string{fresh})
+	}
+}
+
+func TestCleanTempKeepsUsedEntries(t *testing.T) {
+	tempPath := t.TempDir()
+	old := epoch.Add(-2 * time.Hour)
+	held := tempUpload(t, tempPath, "held", 10, old)
+	kept := tempUpload(t, tempPath, "kept", 10, old)
+	marked := tempUpload(t, tempPath, "marked", 10, old)
+	if err := os.WriteFile(filepath.Join(marked, UploadMarker), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(filepath.Join(marked, UploadMarker), epoch, epoch); err != nil {
+		t.Fatal(err)
+	}
+	stale := tempUpload(t, tempPath, "stale", 10, old)
+
+	release := HoldTemp(held)
+	removed, err := CleanTemp(tempPath, time.Hour, epoch, false, filepath.Join(kept, "data.txt"))
+	if err != nil {
+		t.Fatalf("CleanTemp failed: %v", err)
+	}
+	if paths := entryPaths(removed); !slices.Equal(paths, []string{stale}) {
+		t.Errorf("CleanTemp removed %v, want %v", paths, []string{stale})
+	}
+
+	// once released, the upload is stale like any other
+	release()
+	removed, err = CleanTemp(tempPath, time.Hour, epoch, false)
+	if err != nil {
+		t.Fatalf("CleanTemp failed: %v", err)
+	}
+	want := []string{held, kept}
+	if paths := entryPaths(removed); !slices.Equal(paths, want) {
+		t.Errorf("CleanTemp removed %v after the release, want %v", paths, want)
+	}
+}
+
+func TestCleanTempDryRun(t *testing.T) {
+	tempPath := t.TempDir()
+	stale := tempUpload(t, tempPath, "stale", 10, epoch.Add(-2*time.Hour))
+	entries := RemovedTempEntries()
+
+	listed, err := CleanTemp(tempPath, time.Hour, epoch, true)
+	if err != nil {
+		t.Fatalf("CleanTemp failed: %v", err)
+	}
+	if len(listed) != 1 || listed[0].Path != stale || listed[0].Removed {
+		t.Errorf("the dry run listed %+v, want the stale upload, not removed", listed)
+	}
+	if _, err := os.Stat(stale); err != nil {
+		t.Errorf("the dry run removed the upload: %v", err)
+	}
+	if n := RemovedTempEntries() - entries; n != 0 {
+		t.Errorf("the dry run counted %d removed entries", n)
+	}
+}
@@ -1,14 +1,22 @@
 package frontend
 
 import (
+	"crypto/sha256"
 	"embed"
+	"encoding/hex"
 	"io/fs"
+	"sync"
 )
 
 //go:embed all:manager/**/*
 //go:embed all:manager/*
 var manager embed.FS
 
+// the minimal UI served at the root by gorun serve, plain files without a build step
+//
+//go:embed ui
+var ui embed.FS
+
 func GetManager() fs.FS {
 	managerFS, err := fs.Sub(manager, "manager")
 	if err != nil {
@@ -16,3 +24,34 @@ func GetManager() fs.FS {
 	}
 	return managerFS
 }
+
+func GetUI() fs.FS {
+	uiFS, err := fs.Sub(ui, "ui")
+	if err != nil {
+		panic(err)
+	}
+	return uiFS
+}
+
+var uiVersion = sync.OnceValue(func() string {
+	hash := sha256.New()
+	fs.WalkDir(ui, "ui", func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		content, err := ui.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		hash.Write([]byte(path))
+		hash.Write(content)
+		return nil
+	})
+	return hex.EncodeToString(hash.Sum(nil))[:12]
+})
+
+// UIVersion is a hash of the UI files. It is part of the asset URLs, which therefore
+// change with every release of the UI and can be cached forever.
+func UIVersion() string {
+	return uiVersion()
+}
@@ -0,0 +1,249 @@
+// The minimal gorun UI. It talks to the REST API of the server it is served by, the
+// config is injected into index.html and can be reloaded from /ui-config.json.
+(function () {
+  "use strict";
+
+  const config = window.GORUN_UI || { base_path: "", features: {} };
+  const terminal = ["finished", "errored", "cancelled", "expired", "purged"];
+  const pollInterval = 2000;
+  let pollTimer = null;
+
+  const $ = (id) => document.getElementById(id);
+
+  function token() {
+    return localStorage.getItem("gorun.token");
+  }
+
+  function url(route) {
+    return config.base_path + route;
+  }
+
+  async function api(method, route, body) {
+    const headers = {};
+    if (token()) {
+      headers["Authorization"] = "Bearer " + token();
+    }
+    if (body !== undefined) {
+      headers["Content-Type"] = "application/json";
+    }
+    const res = await fetch(url(route), {
+      method: method,
+      headers: headers,
+      body: body === undefined ? undefined : JSON.stringify(body),
+    });
+    if (res.status === 401) {
+      localStorage.removeItem("gorun.token");
+      location.hash = "#/login";
+    }
+    const data = res.status === 204 ? null : await res.json();
+    if (!res.ok) {
+      throw new Error((data && (data.message || data.error)) || res.statusText);
+    }
+    return data;
+  }
+
+  function show(section) {
+    for (const id of ["login", "tools", "tool", "run"]) {
+      $(id).hidden = id !== section;
+    }
+    $("logout").hidden = section === "login" || config.features.no_auth;
+  }
+
+  function el(tag, props, children) {
+    const node = Object.assign(document.createElement(tag), props || {});
+    for (const child of children || []) {
+      node.append(child);
+    }
+    return node;
+  }
+
+  // login
+
+  $("login-form").addEventListener("submit", async (event) => {
+    event.preventDefault();
+    const form = event.target;
+    $("login-error").textContent = "";
+    if (form.token.value) {
+      localStorage.setItem("gorun.token", form.token.value.trim());
+      location.hash = "#/tools";
+      return;
+    }
+    try {
+      const res = await api("POST", "/auth/login", { email: form.email.value, password: form.password.value });
+      localStorage.setItem("gorun.token", res.access_token);
+      location.hash = "#/tools";
+    } catch (err) {
+      $("login-error").textContent = err.message;
+    }
+  });
+
+  $("logout").addEventListener("click", () => {
+    localStorage.removeItem("gorun.token");
+    location.hash = "#/login";
+  });
+
+  // tools
+
+  async function showTools() {
+    show("tools");
+    const list = $("tool-list");
+    list.replaceChildren();
+    const res = await api("GET", "/specs");
+    for (const spec of res.tools) {
+      const link = el("a", { href: "#/tools/" + encodeURIComponent(spec.id), textContent: spec.title || spec.name });
+      const note = spec.available ? "" : " (image not pulled)";
+      list.append(el("li", {}, [link, note]));
+    }
+    if (res.tools.length === 0) {
+      list.append(el("li", { textContent: "No tools are loaded on the server." }));
+    }
+  }
+
+  // inputField renders a parameter of the tool-spec as form field
+  function inputField(name, param) {
+    let input;
+    if (param.values && param.values.length > 0) {
+      input = el("select", { name: name }, param.values.map((v) => el("option", { value: v, textContent: v })));
+    } else if (param.type === "boolean") {
+      input = el("input", { name: name, type: "checkbox", checked: param.default === true });
+    } else if (param.type === "integer" || param.type === "float") {
+      input = el("input", { name: name, type: "number", step: param.type === "integer" ? "1" : "any" });
+      if (param.min !== undefined) input.min = param.min;
+      if (param.max !== undefined) input.max = param.max;
+    } else {
+      input = el("input", { name: name, type: "text" });
+    }
+    if (param.array) {
+      input = el("input", { name: name, type: "text", placeholder: "comma separated" });
+    }
+    if (param.default !== undefined && input.type !== "checkbox") {
+      input.value = Array.isArray(param.default) ? param.default.join(",") : param.default;
+    }
+    input.required = !param.optional && param.default === undefined && input.type !== "checkbox";
+    input.dataset.type = param.type;
+    input.dataset.array = param.array ? "true" : "";
+    const label = param.name || name;
+    return el("label", { title: param.description || "" }, [label, input]);
+  }
+
+  function readValue(input) {
+    if (input.type === "checkbox") {
+      return input.checked;
+    }
+    const parse = (raw) => (input.dataset.type === "integer" || input.dataset.type === "float" ? Number(raw) : raw);
+    if (input.dataset.array) {
+      return input.value.split(",").map((v) => parse(v.trim())).filter((v) => v !== "");
+    }
+    return parse(input.value);
+  }
+
+  async function showTool(name) {
+    show("tool");
+    $("run-error").textContent = "";
+    const spec = await api("GET", "/specs/" + encodeURIComponent(name));
+    $("tool-title").textContent = spec.title || spec.name;
+    $("tool-description").textContent = spec.description || "";
+
+    const form = $("run-form");
+    form.replaceChildren();
+    const params = el("fieldset", {}, [el("legend", { textContent: "Parameters" })]);
+    for (const [key, param] of Object.entries(spec.parameters || {})) {
+      params.append(inputField(key, param));
+    }
+    const data = el("fieldset", {}, [el("legend", { textContent: "Data" })]);
+    for (const [key, dataset] of Object.entries(spec.data || {})) {
+      const input = el("input", { name: "data:" + key, type: "text", placeholder: dataset.example || "path on the server" });
+      data.append(el("label", { title: dataset.description || "" }, [key, input]));
+    }
+    form.append(params, data, el("button", { type: "submit", textContent: "Start run" }));
+
+    form.onsubmit = async (event) => {
+      event.preventDefault();
+      const payload = { name: spec.name, docker_image: spec.id.split("::")[0], parameters: {}, data: {} };
+      for (const input of form.querySelectorAll("input, select")) {
+        if (input.name.startsWith("data:")) {
+          if (input.value) payload.data[input.name.slice(5)] = input.value;
+        } else if (input.value !== "" || input.type === "checkbox") {
+          payload.parameters[input.name] = readValue(input);
+        }
+      }
+      try {
+        const run = await api("POST", "/runs", payload);
+        await api("POST", "/runs/" + run.id + "/start");
+        location.hash = "#/runs/" + run.id;
+      } catch (err) {
+        $("run-error").textContent = err.message;
+      }
+    };
+  }
+
+  // runs are polled until they finished, the API has no stream of the status
+
+  async function showRun(id) {
+    show("run");
+    $("run-title").textContent = "Run " + id;
+    $("run-results").replaceChildren();
+    const run = await api("GET", "/runs/" + id);
+    $("run-title").textContent = "Run " + id + ": " + (run.title || run.name);
+    const progress = run.progress != null && run.status === "running" ? " (" + Math.round(run.progress * 100) + "%)" : "";
+    const position = run.queue_position != null ? " (#" + run.queue_position + " in the queue)" : "";
+    $("run-status").textContent = run.status + progress + position;
+    $("run-message").textContent = run.error || "";
+    if (!terminal.includes(run.status)) {
+      pollTimer = setTimeout(() => showRun(id), pollInterval);
+      return;
+    }
+    if (run.status !== "finished") {
+      return;
+    }
+    const res = await api("GET", "/runs/" + id + "/results");
+    for (const file of res.files) {
+      $("run-results").append(resultItem(id, file));
+    }
+  }
+
+  // Zarr stores and shapefiles are listed with their files nested
+  function resultItem(id, file) {
+    const format = file.format ? ", " + file.format : "";
+    const label = " (" + file.size + " bytes" + format + ")";
+    if (file.members && file.format === "zarr") {
+      const members = el("ul", {}, file.members.map((member) => resultItem(id, member)));
+      return el("li", {}, [file.relPath + label, members]);
+    }
+    const href = url("/runs/" + id + "/files/" + file.relPath.split("/").map(encodeURIComponent).join("/") +
+      "?token=" + encodeURIComponent(token() || ""));
+    const link = el("a", { href: href, download: file.name, textContent: file.relPath });
+    if (file.members) {
+      const others = file.members.filter((member) => member.relPath !== file.relPath);
+      return el("li", {}, [link, label, el("ul", {}, others.map((member) => resultItem(id, member)))]);
+    }
+    return el("li", {}, [link, label]);
+  }
+
+  async function route() {
+    clearTimeout(pollTimer);
+    const path = location.hash.replace(/^#/, "") || "/tools";
+    if (!token() && !config.features.no_auth) {
+      show("login");
+      return;
+    }
+    const parts = path.split("/").filter(Boolean);
+    try {
+      if (parts[0] === "tools" && parts[1]) {
+        await showTool(decodeURIComponent(parts[1]));
+      } else if (parts[0] === "runs" && parts[1]) {
+        await showRun(parts[1]);
+      } else if (parts[0] === "login") {
+        show("login");
+      } else {
+        await showTools();
+      }
+    } catch (err) {
+      $("run-error").textContent = err.message;
+      $("run-message").textContent = err.message;
+    }
+  }
+
+  window.addEventListener("hashchange", route);
+  route();
+})();
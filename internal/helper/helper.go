@@ -3,7 +3,10 @@ package helper
 import (
 	"crypto/rand"
 	"io"
+	"io/fs"
 	"os"
+	"path/filepath"
+	"strings"
 )
 
 func GetRandomString(length int) string {
@@ -16,6 +19,18 @@ func GetRandomString(length int) string {
 	return string(bytes)
 }
 
+// IsSecretName reports if a config key or parameter is named like a secret, e.g. api_token.
+// The values of such names are redacted whenever they are shown.
+func IsSecretName(name string) bool {
+	name = strings.ToLower(name)
+	for _, secret := range []string{"secret", "token", "password"} {
+		if strings.Contains(name, secret) {
+			return true
+		}
+	}
+	return false
+}
+
 func CopyFile(src, dst string) error {
 	srcFile, err := os.Open(src)
 	if err != nil {
@@ -32,3 +47,29 @@ func CopyFile(src, dst string) error {
 	_, err = io.Copy(dstFile, srcFile)
 	return err
 }
+
+// CopyPath copies a single file or a whole directory tree from src to dst
+func CopyPath(src, dst string) error {
+	info, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return CopyFile(src, dst)
+	}
+
+	return filepath.WalkDir(src, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		if d.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		return CopyFile(p, target)
+	})
+}
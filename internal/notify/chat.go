@@ -0,0 +1,51 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// the number of STDERR.log lines posted to chat channels
+const chatErrorLines = 10
+
+var chatClient = &http.Client{Timeout: 30 * time.Second}
+
+// postJSON sends the body to a chat API and fails on non 2xx responses
+func postJSON(ctx context.Context, method string, url string, token string, body interface{}) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := chatClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s responded with %s: %s", req.URL.Host, resp.Status, bytes.TrimSpace(message))
+	}
+	return nil
+}
+
+// durationText is empty for runs that never started a container
+func durationText(n Notification) string {
+	if n.Duration == 0 {
+		return ""
+	}
+	return " after " + n.Duration.Round(time.Second).String()
+}
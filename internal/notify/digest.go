@@ -0,0 +1,105 @@
+package notify
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+const digestWindow = time.Minute
+
+// FailureFunc is called for every run whose notification could not be delivered
+type FailureFunc func(runID int64, notifier string, err error)
+
+// userWindow tracks the messages sent to a user within the last minute
+type userWindow struct {
+	sent      []time.Time
+	pending   []Notification
+	notifiers []Notifier
+	failed    FailureFunc
+}
+
+var (
+	windowsMu sync.Mutex
+	windows   = make(map[string]*userWindow)
+)
+
+// Dispatch delivers the notification through the notifiers of the user. Once
+// notify.digest_threshold messages were sent to the user within a minute, further
+// completions are collected and sent as one digest when the minute is over.
+func Dispatch(ctx context.Context, userID string, notifiers []Notifier, n Notification, failed FailureFunc) {
+	threshold := viper.GetInt("notify.digest_threshold")
+	if threshold <= 0 {
+		deliver(ctx, notifiers, []Notification{n}, failed)
+		return
+	}
+
+	windowsMu.Lock()
+	now := time.Now()
+	window, ok := windows[userID]
+	if !ok {
+		window = &userWindow{}
+		windows[userID] = window
+	}
+	window.sent = withinWindow(window.sent, now)
+	if len(window.pending) == 0 && len(window.sent) < threshold {
+		window.sent = append(window.sent, now)
+		windowsMu.Unlock()
+		deliver(ctx, notifiers, []Notification{n}, failed)
+		return
+	}
+
+	// the digest goes to the channels of the latest completion
+	window.pending = append(window.pending, n)
+	window.notifiers, window.failed = notifiers, failed
+	if len(window.pending) == 1 {
+		wait := window.sent[0].Add(digestWindow).Sub(now)
+		flushCtx := context.WithoutCancel(ctx)
+		time.AfterFunc(wait, func() { flushDigest(flushCtx, userID) })
+	}
+	windowsMu.Unlock()
+}
+
+func flushDigest(ctx context.Context, userID string) {
+	windowsMu.Lock()
+	window := windows[userID]
+	pending, notifiers, failed := window.pending, window.notifiers, window.failed
+	window.pending, window.notifiers, window.failed = nil, nil, nil
+	window.sent = append(withinWindow(window.sent, time.Now()), time.Now())
+	windowsMu.Unlock()
+
+	if len(pending) > 0 {
+		deliver(ctx, notifiers, pending, failed)
+	}
+}
+
+// withinWindow drops the messages sent more than a minute ago
+func withinWindow(sent []time.Time, now time.Time) []time.Time {
+	recent := sent[:0]
+	for _, at := range sent {
+		if now.Sub(at) < digestWindow {
+			recent = append(recent, at)
+		}
+	}
+	return recent
+}
+
+func deliver(ctx context.Context, notifiers []Notifier, ns []Notification, failed FailureFunc) {
+	for _, notifier := range notifiers {
+		sendCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+		var err error
+		if len(ns) == 1 {
+			err = notifier.Notify(sendCtx, ns[0])
+		} else {
+			err = notifier.NotifyDigest(sendCtx, ns)
+		}
+		cancel()
+		if err != nil {
+			for _, n := range ns {
+				failed(n.RunID, notifier.Name(), err)
+			}
+		}
+	}
+}
@@ -0,0 +1,250 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"text/template"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// EmailNotifier sends notifications to the owner of the run via SMTP
+type EmailNotifier struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+}
+
+// EmailFromConfig returns nil if notify.smtp.host is not set
+func EmailFromConfig() *EmailNotifier {
+	host := viper.GetString("notify.smtp.host")
+	if host == "" {
+		return nil
+	}
+	return &EmailNotifier{
+		Host:     host,
+		Port:     viper.GetInt("notify.smtp.port"),
+		Username: viper.GetString("notify.smtp.username"),
+		Password: viper.GetString("notify.smtp.password"),
+		From:     viper.GetString("notify.smtp.from"),
+	}
+}
+
+func (e *EmailNotifier) Name() string {
+	return "email"
+}
+
+const emailText = `Your run {{.Title}} (#{{.RunID}}) has {{.Status}}.
+
+Tool:     {{.Tool}}
+Status:   {{.Status}}
+{{- if .ErrorKind}}
+Error:    {{.ErrorKind}}{{end}}
+{{- if .Duration}}
+Duration: {{.Duration}}{{end}}
+{{- if .Error}}
+
+{{.Error}}{{end}}
+{{- if .ErrorTail}}
+
+Last lines of STDERR.log:
+
+{{.ErrorTail}}{{end}}
+{{- if .ResultsURL}}
+
+Results: {{.ResultsURL}}{{end}}
+`
+
+const emailHTML = `<!DOCTYPE html>
+<html>
+<body style="font-family: sans-serif;">
+<p>Your run <strong>{{.Title}}</strong> (#{{.RunID}}) has {{.Status}}.</p>
+<table>
+<tr><td>Tool</td><td>{{.Tool}}</td></tr>
+<tr><td>Status</td><td>{{.Status}}</td></tr>
+{{- if .ErrorKind}}
+<tr><td>Error</td><td>{{.ErrorKind}}</td></tr>{{end}}
+{{- if .Duration}}
+<tr><td>Duration</td><td>{{.Duration}}</td></tr>{{end}}
+</table>
+{{- if .Error}}
+<p>{{.Error}}</p>{{end}}
+{{- if .ErrorTail}}
+<p>Last lines of STDERR.log:</p>
+<pre>{{.ErrorTail}}</pre>{{end}}
+{{- if .ResultsURL}}
+<p><a href="{{.ResultsURL}}">Open the results</a></p>{{end}}
+</body>
+</html>
+`
+
+const emailDigestText = `{{len .}} of your runs completed within a minute.
+{{range .}}
+{{.Status}}: {{.Title}} (#{{.RunID}}){{if .Duration}} after {{.Duration}}{{end}}{{if .ResultsURL}} - {{.ResultsURL}}{{end}}{{end}}
+`
+
+const emailDigestHTML = `<!DOCTYPE html>
+<html>
+<body style="font-family: sans-serif;">
+<p>{{len .}} of your runs completed within a minute.</p>
+<table>
+{{- range .}}
+<tr><td>{{.Status}}</td><td>{{if .ResultsURL}}<a href="{{.ResultsURL}}">{{.Title}}</a>{{else}}{{.Title}}{{end}} (#{{.RunID}})</td><td>{{.Duration}}</td></tr>{{end}}
+</table>
+</body>
+</html>
+`
+
+var (
+	emailTextTemplate       = template.Must(template.New("text").Parse(emailText))
+	emailHTMLTemplate       = htmltemplate.Must(htmltemplate.New("html").Parse(emailHTML))
+	emailDigestTextTemplate = template.Must(template.New("digest-text").Parse(emailDigestText))
+	emailDigestHTMLTemplate = htmltemplate.Must(htmltemplate.New("digest-html").Parse(emailDigestHTML))
+)
+
+func (e *EmailNotifier) Notify(ctx context.Context, n Notification) error {
+	n.Duration = n.Duration.Round(time.Second)
+	subject := fmt.Sprintf("[gorun] %s %s", n.Title, n.Status)
+	return e.deliver(ctx, n.Email, subject, n, emailTextTemplate, emailHTMLTemplate)
+}
+
+func (e *EmailNotifier) NotifyDigest(ctx context.Context, ns []Notification) error {
+	rounded := make([]Notification, 0, len(ns))
+	for _, n := range ns {
+		n.Duration = n.Duration.Round(time.Second)
+		rounded = append(rounded, n)
+	}
+	subject := fmt.Sprintf("[gorun] %d runs completed", len(ns))
+	return e.deliver(ctx, ns[0].Email, subject, rounded, emailDigestTextTemplate, emailDigestHTMLTemplate)
+}
+
+func (e *EmailNotifier) deliver(ctx context.Context, to string, subject string, data interface{}, text *template.Template, html *htmltemplate.Template) error {
+	if to == "" {
+		return errors.New("the owner of the run has no email address")
+	}
+	if e.From == "" {
+		return errors.New("notify.smtp.from is not set")
+	}
+
+	message, err := e.message(to, subject, data, text, html)
+	if err != nil {
+		return err
+	}
+	return e.send(ctx, to, message)
+}
+
+// message renders the mail as multipart/alternative with a plain text and an HTML part
+func (e *EmailNotifier) message(to string, subject string, data interface{}, text *template.Template, html *htmltemplate.Template) ([]byte, error) {
+	var body bytes.Buffer
+	parts := multipart.NewWriter(&body)
+	for _, part := range []struct {
+		contentType string
+		execute     func(*bytes.Buffer) error
+	}{
+		{"text/plain", func(buf *bytes.Buffer) error { return text.Execute(buf, data) }},
+		{"text/html", func(buf *bytes.Buffer) error { return html.Execute(buf, data) }},
+	} {
+		var rendered bytes.Buffer
+		if err := part.execute(&rendered); err != nil {
+			return nil, err
+		}
+		writer, err := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType + "; charset=utf-8"},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		encoder := quotedprintable.NewWriter(writer)
+		if _, err := encoder.Write(rendered.Bytes()); err != nil {
+			return nil, err
+		}
+		if err := encoder.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := parts.Close(); err != nil {
+		return nil, err
+	}
+
+	var message bytes.Buffer
+	fmt.Fprintf(&message, "From: %s\r\n", e.From)
+	fmt.Fprintf(&message, "To: %s\r\n", to)
+	fmt.Fprintf(&message, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&message, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&message, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&message, "Content-Type: multipart/alternative; boundary=%s\r\n\r\n", parts.Boundary())
+	message.Write(body.Bytes())
+	return message.Bytes(), nil
+}
+
+// send delivers the message within the deadline of the context. Port 465 uses implicit TLS,
+// other ports upgrade with STARTTLS if the server offers it.
+func (e *EmailNotifier) send(ctx context.Context, to string, message []byte) error {
+	addr := net.JoinHostPort(e.Host, strconv.Itoa(e.Port))
+	dialer := &net.Dialer{}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	if e.Port == 465 {
+		conn = tls.Client(conn, &tls.Config{ServerName: e.Host})
+	}
+
+	c, err := smtp.NewClient(conn, e.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok && e.Port != 465 {
+		if err := c.StartTLS(&tls.Config{ServerName: e.Host}); err != nil {
+			return err
+		}
+	}
+	if e.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", e.Username, e.Password, e.Host)); err != nil {
+			return err
+		}
+	}
+	from, err := mail.ParseAddress(e.From)
+	if err != nil {
+		return fmt.Errorf("invalid notify.smtp.from %s: %w", e.From, err)
+	}
+	if err := c.Mail(from.Address); err != nil {
+		return err
+	}
+	if err := c.Rcpt(to); err != nil {
+		return err
+	}
+	data, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := data.Write(message); err != nil {
+		return err
+	}
+	if err := data.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
@@ -0,0 +1,90 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// MatrixNotifier sends messages to a Matrix room as the user of notify.matrix.access_token
+type MatrixNotifier struct {
+	Homeserver  string
+	AccessToken string
+	RoomID      string
+}
+
+// the transaction IDs make retried requests idempotent on the homeserver
+var matrixTxn atomic.Int64
+
+// MatrixFromConfig prefers the room of the user over notify.matrix.room_id. It returns
+// nil if no room or no homeserver and access token are configured.
+func MatrixFromConfig(userRoomID string) *MatrixNotifier {
+	roomID := userRoomID
+	if roomID == "" {
+		roomID = viper.GetString("notify.matrix.room_id")
+	}
+	homeserver := strings.TrimSuffix(viper.GetString("notify.matrix.homeserver"), "/")
+	token := viper.GetString("notify.matrix.access_token")
+	if roomID == "" || homeserver == "" || token == "" {
+		return nil
+	}
+	return &MatrixNotifier{Homeserver: homeserver, AccessToken: token, RoomID: roomID}
+}
+
+func (m *MatrixNotifier) Name() string {
+	return "matrix"
+}
+
+func (m *MatrixNotifier) Notify(ctx context.Context, n Notification) error {
+	var plain, formatted strings.Builder
+	fmt.Fprintf(&plain, "%s %s (#%d) %s%s\nTool: %s", statusEmoji(n), n.Title, n.RunID, n.Status, durationText(n), n.Tool)
+	fmt.Fprintf(&formatted, "%s <strong>%s</strong> (#%d) %s%s<br>Tool: <code>%s</code>", statusEmoji(n), html.EscapeString(n.Title), n.RunID, n.Status, durationText(n), html.EscapeString(n.Tool))
+	if n.ResultsURL != "" {
+		fmt.Fprintf(&plain, "\nResults: %s", n.ResultsURL)
+		fmt.Fprintf(&formatted, `<br><a href="%s">Open the results</a>`, html.EscapeString(n.ResultsURL))
+	}
+	if n.ErrorKind != "" {
+		fmt.Fprintf(&plain, "\nError (%s): %s", n.ErrorKind, n.Error)
+		fmt.Fprintf(&formatted, "<br>Error (<code>%s</code>): %s", html.EscapeString(n.ErrorKind), html.EscapeString(n.Error))
+	}
+	if n.ErrorTail != "" {
+		tail := lastLines(n.ErrorTail, chatErrorLines)
+		fmt.Fprintf(&plain, "\n\n%s", tail)
+		fmt.Fprintf(&formatted, "<pre><code>%s</code></pre>", html.EscapeString(tail))
+	}
+	return m.send(ctx, plain.String(), formatted.String())
+}
+
+func (m *MatrixNotifier) NotifyDigest(ctx context.Context, ns []Notification) error {
+	var plain, formatted strings.Builder
+	fmt.Fprintf(&plain, "%d runs completed within a minute", len(ns))
+	fmt.Fprintf(&formatted, "%d runs completed within a minute<ul>", len(ns))
+	for _, n := range ns {
+		fmt.Fprintf(&plain, "\n%s %s (#%d) %s%s", statusEmoji(n), n.Title, n.RunID, n.Status, durationText(n))
+		title := html.EscapeString(n.Title)
+		if n.ResultsURL != "" {
+			title = fmt.Sprintf(`<a href="%s">%s</a>`, html.EscapeString(n.ResultsURL), title)
+		}
+		fmt.Fprintf(&formatted, "<li>%s %s (#%d) %s%s</li>", statusEmoji(n), title, n.RunID, n.Status, durationText(n))
+	}
+	formatted.WriteString("</ul>")
+	return m.send(ctx, plain.String(), formatted.String())
+}
+
+func (m *MatrixNotifier) send(ctx context.Context, plain string, formatted string) error {
+	txnID := fmt.Sprintf("gorun-%d-%d", time.Now().UnixNano(), matrixTxn.Add(1))
+	endpoint := fmt.Sprintf("%s/_matrix/client/v3/rooms/%s/send/m.room.message/%s", m.Homeserver, url.PathEscape(m.RoomID), txnID)
+	return postJSON(ctx, http.MethodPut, endpoint, m.AccessToken, map[string]string{
+		"msgtype":        "m.text",
+		"body":           plain,
+		"format":         "org.matrix.custom.html",
+		"formatted_body": formatted,
+	})
+}
@@ -0,0 +1,55 @@
+package notify
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// Notification summarizes a completed run for its owner
+type Notification struct {
+	RunID  int64
+	Tool   string
+	Title  string
+	Status string
+	// Duration is 0 if the container never ran
+	Duration time.Duration
+	Error    string
+	// ErrorKind classifies the error of a failed run, like oom_killed or disk_full
+	ErrorKind string
+	// ErrorTail holds the last lines of STDERR.log of a failed run
+	ErrorTail string
+	// ResultsURL is empty unless notify.base_url is set
+	ResultsURL string
+	Email      string
+}
+
+// Failed reports if the run did not finish successfully
+func (n Notification) Failed() bool {
+	return n.Status != "finished"
+}
+
+// Notifier delivers notifications through one channel. NotifyDigest collapses the
+// completions of a batch of runs into a single message.
+type Notifier interface {
+	Name() string
+	Notify(ctx context.Context, n Notification) error
+	NotifyDigest(ctx context.Context, ns []Notification) error
+}
+
+// statusEmoji marks the outcome of a run in chat messages
+func statusEmoji(n Notification) string {
+	if n.Failed() {
+		return "❌"
+	}
+	return "✅"
+}
+
+// lastLines keeps the last lines of a log for chat messages
+func lastLines(log string, lines int) string {
+	split := strings.Split(strings.TrimRight(log, "\n"), "\n")
+	if len(split) > lines {
+		split = split[len(split)-lines:]
+	}
+	return strings.Join(split, "\n")
+}
@@ -0,0 +1,65 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// SlackNotifier posts to a Slack incoming webhook
+type SlackNotifier struct {
+	WebhookURL string
+}
+
+// SlackFromConfig prefers the webhook of the user over notify.slack.webhook_url.
+// It returns nil if neither is set.
+func SlackFromConfig(userWebhookURL string) *SlackNotifier {
+	webhookURL := userWebhookURL
+	if webhookURL == "" {
+		webhookURL = viper.GetString("notify.slack.webhook_url")
+	}
+	if webhookURL == "" {
+		return nil
+	}
+	return &SlackNotifier{WebhookURL: webhookURL}
+}
+
+func (s *SlackNotifier) Name() string {
+	return "slack"
+}
+
+func (s *SlackNotifier) Notify(ctx context.Context, n Notification) error {
+	var text strings.Builder
+	fmt.Fprintf(&text, "%s *%s* (#%d) %s%s\nTool: `%s`", statusEmoji(n), slackEscape(n.Title), n.RunID, n.Status, durationText(n), slackEscape(n.Tool))
+	if n.ResultsURL != "" {
+		fmt.Fprintf(&text, "\n<%s|Open the results>", n.ResultsURL)
+	}
+	if n.ErrorKind != "" {
+		fmt.Fprintf(&text, "\nError (`%s`): %s", n.ErrorKind, slackEscape(n.Error))
+	}
+	if n.ErrorTail != "" {
+		fmt.Fprintf(&text, "\n```%s```", slackEscape(lastLines(n.ErrorTail, chatErrorLines)))
+	}
+	return postJSON(ctx, http.MethodPost, s.WebhookURL, "", map[string]string{"text": text.String()})
+}
+
+func (s *SlackNotifier) NotifyDigest(ctx context.Context, ns []Notification) error {
+	var text strings.Builder
+	fmt.Fprintf(&text, "%d runs completed within a minute", len(ns))
+	for _, n := range ns {
+		title := slackEscape(n.Title)
+		if n.ResultsURL != "" {
+			title = fmt.Sprintf("<%s|%s>", n.ResultsURL, title)
+		}
+		fmt.Fprintf(&text, "\n%s %s (#%d) %s%s", statusEmoji(n), title, n.RunID, n.Status, durationText(n))
+	}
+	return postJSON(ctx, http.MethodPost, s.WebhookURL, "", map[string]string{"text": text.String()})
+}
+
+// slackEscape escapes the control characters of the mrkdwn format
+func slackEscape(text string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(text)
+}
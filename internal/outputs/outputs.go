@@ -0,0 +1,143 @@
+package outputs
+
+import (
+	"io/fs"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Spec is an output a tool declares in its tool.yml. tool-spec-go does not model
+// outputs yet, so they are read from the raw spec:
+//
+//	tools:
+//	  my_tool:
+//	    outputs:
+//	      result:
+//	        path: result.csv
+//	      figures:
+//	        path: "*.png"
+//	        optional: true
+type Spec struct {
+	// Path is a file name, directory or glob pattern relative to /out.
+	// The name of the output is used if it is empty.
+	Path        string `yaml:"path" json:"path"`
+	Description string `yaml:"description" json:"description,omitempty"`
+	Optional    bool   `yaml:"optional" json:"optional,omitempty"`
+}
+
+// ignored are the files gorun itself writes into /out
+var ignored = map[string]bool{
+	"STDOUT.log":     true,
+	"STDERR.log":     true,
+	"_metadata.json": true,
+	"_events.jsonl":  true,
+}
+
+// IsGorunFile tells if gorun itself wrote the file, given relative to /out
+func IsGorunFile(rel string) bool {
+	return ignored[rel]
+}
+
+// FromSpec reads the declared outputs of each tool of a raw tool.yml.
+// Tools without outputs are left out.
+func FromSpec(raw []byte) map[string]map[string]Spec {
+	var spec struct {
+		Tools map[string]struct {
+			Outputs map[string]Spec `yaml:"outputs"`
+		} `yaml:"tools"`
+	}
+	declared := make(map[string]map[string]Spec)
+	if err := yaml.Unmarshal(raw, &spec); err != nil {
+		return declared
+	}
+	for name, tool := range spec.Tools {
+		if len(tool.Outputs) == 0 {
+			continue
+		}
+		for outputName, output := range tool.Outputs {
+			if output.Path == "" {
+				output.Path = outputName
+			}
+			output.Path = strings.TrimPrefix(path.Clean("/"+filepath.ToSlash(output.Path)), "/")
+			tool.Outputs[outputName] = output
+		}
+		declared[name] = tool.Outputs
+	}
+	return declared
+}
+
+// Verification compares the files of /out with the declared outputs
+type Verification struct {
+	Complete bool `json:"complete"`
+	// Missing are the required outputs no file matched
+	Missing []string `json:"missing"`
+	// Unexpected are the files which do not belong to any declared output
+	Unexpected []string `json:"unexpected"`
+	// Matched lists the files of each output that was found
+	Matched map[string][]string `json:"matched"`
+}
+
+// matches reports if the file, or one of the directories it is in, matches the pattern
+func matches(pattern string, file string) bool {
+	for candidate := file; candidate != "." && candidate != "/"; candidate = path.Dir(candidate) {
+		if ok, err := path.Match(pattern, candidate); err == nil && ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Verify walks the out directory of a run and matches its files against the declared outputs
+func Verify(outDir string, declared map[string]Spec) (Verification, error) {
+	verification := Verification{
+		Missing:    make([]string, 0),
+		Unexpected: make([]string, 0),
+		Matched:    make(map[string][]string),
+	}
+
+	err := filepath.WalkDir(outDir, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(outDir, filePath)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if ignored[rel] {
+			return nil
+		}
+
+		found := false
+		for name, output := range declared {
+			if matches(output.Path, rel) {
+				verification.Matched[name] = append(verification.Matched[name], rel)
+				found = true
+			}
+		}
+		if !found {
+			verification.Unexpected = append(verification.Unexpected, rel)
+		}
+		return nil
+	})
+	if err != nil {
+		return Verification{}, err
+	}
+
+	for name, output := range declared {
+		if _, ok := verification.Matched[name]; !ok && !output.Optional {
+			verification.Missing = append(verification.Missing, name)
+		}
+	}
+	sort.Strings(verification.Missing)
+	sort.Strings(verification.Unexpected)
+	verification.Complete = len(verification.Missing) == 0
+	return verification, nil
+}
@@ -0,0 +1,221 @@
+package registry
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"runtime"
+	"strings"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// the Docker media types the registries still serve next to the OCI ones
+const (
+	dockerManifest     = "application/vnd.docker.distribution.manifest.v2+json"
+	dockerManifestList = "application/vnd.docker.distribution.manifest.list.v2+json"
+	dockerLayerGzip    = "application/vnd.docker.image.rootfs.diff.tar.gzip"
+)
+
+var manifestTypes = []string{ocispec.MediaTypeImageManifest, ocispec.MediaTypeImageIndex, dockerManifest, dockerManifestList}
+
+// Image is the manifest of one platform of an image
+type Image struct {
+	// Digest of the manifest, not of the index it was picked from
+	Digest   string
+	Manifest ocispec.Manifest
+	Platform string
+}
+
+// Tags lists the tags of the repository
+func (c *Client) Tags(ctx context.Context, ref Reference) ([]string, error) {
+	resp, err := c.get(ctx, ref.Repository, "tags/list", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var list struct {
+		Tags []string `json:"tags"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return nil, err
+	}
+	return list.Tags, nil
+}
+
+// Image fetches the manifest of the reference. Of multi-platform images, the manifest of
+// linux on the architecture of gorun is used, the tool-spec is the same for all of them.
+func (c *Client) Image(ctx context.Context, ref Reference) (Image, error) {
+	resp, err := c.get(ctx, ref.Repository, "manifests/"+ref.id(), manifestTypes)
+	if err != nil {
+		return Image{}, err
+	}
+	defer resp.Body.Close()
+	content, err := io.ReadAll(io.LimitReader(resp.Body, 4<<20))
+	if err != nil {
+		return Image{}, err
+	}
+
+	mediaType := strings.TrimSpace(strings.Split(resp.Header.Get("Content-Type"), ";")[0])
+	var probe struct {
+		MediaType string `json:"mediaType"`
+	}
+	if json.Unmarshal(content, &probe) == nil && probe.MediaType != "" {
+		mediaType = probe.MediaType
+	}
+
+	switch mediaType {
+	case ocispec.MediaTypeImageIndex, dockerManifestList:
+		var index ocispec.Index
+		if err := json.Unmarshal(content, &index); err != nil {
+			return Image{}, err
+		}
+		descriptor, err := pickPlatform(index)
+		if err != nil {
+			return Image{}, fmt.Errorf("%s: %w", ref.Name, err)
+		}
+		platformRef := ref
+		platformRef.Digest = descriptor.Digest.String()
+		return c.Image(ctx, platformRef)
+	case ocispec.MediaTypeImageManifest, dockerManifest:
+		var manifest ocispec.Manifest
+		if err := json.Unmarshal(content, &manifest); err != nil {
+			return Image{}, err
+		}
+		digest := resp.Header.Get("Docker-Content-Digest")
+		if ref.Digest != "" {
+			digest = ref.Digest
+		}
+		image := Image{Digest: digest, Manifest: manifest}
+		if config, err := c.config(ctx, ref, manifest.Config); err == nil {
+			image.Platform = config.OS + "/" + config.Architecture
+		}
+		return image, nil
+	default:
+		return Image{}, fmt.Errorf("the manifest of %s has the unsupported media type %q", ref.Name, mediaType)
+	}
+}
+
+func pickPlatform(index ocispec.Index) (ocispec.Descriptor, error) {
+	for _, descriptor := range index.Manifests {
+		if descriptor.Platform != nil && descriptor.Platform.OS == "linux" && descriptor.Platform.Architecture == runtime.GOARCH {
+			return descriptor, nil
+		}
+	}
+	for _, descriptor := range index.Manifests {
+		// attestations are listed as platform unknown/unknown
+		if descriptor.Platform != nil && descriptor.Platform.OS == "linux" {
+			return descriptor, nil
+		}
+	}
+	return ocispec.Descriptor{}, fmt.Errorf("the image index has no linux manifest")
+}
+
+func (c *Client) config(ctx context.Context, ref Reference, descriptor ocispec.Descriptor) (ocispec.Image, error) {
+	resp, err := c.get(ctx, ref.Repository, "blobs/"+descriptor.Digest.String(), nil)
+	if err != nil {
+		return ocispec.Image{}, err
+	}
+	defer resp.Body.Close()
+	var config ocispec.Image
+	err = json.NewDecoder(io.LimitReader(resp.Body, 4<<20)).Decode(&config)
+	return config, err
+}
+
+// ReadFiles returns the content of the files from the layers of the image, newest layer
+// first. Only the layers up to the one containing the first file are downloaded, the
+// other files are optional and only taken from these layers. Files deleted by a newer
+// layer are not found.
+func (c *Client) ReadFiles(ctx context.Context, ref Reference, image Image, files []string) (map[string][]byte, error) {
+	found := make(map[string][]byte, len(files))
+	// files which were found or deleted in a newer layer
+	resolved := make(map[string]bool, len(files))
+	required := strings.TrimPrefix(files[0], "/")
+
+	layers := image.Manifest.Layers
+	for i := len(layers) - 1; i >= 0 && !resolved[required]; i-- {
+		if err := c.readLayer(ctx, ref, layers[i], files, found, resolved); err != nil {
+			return nil, err
+		}
+	}
+	if _, ok := found[required]; !ok {
+		return nil, fmt.Errorf("the image %s does not contain %s: %w", ref.Name, files[0], ErrNotFound)
+	}
+	result := make(map[string][]byte, len(found))
+	for name, content := range found {
+		result["/"+name] = content
+	}
+	return result, nil
+}
+
+// readLayer streams the layer and stops once every file was resolved
+func (c *Client) readLayer(ctx context.Context, ref Reference, layer ocispec.Descriptor, files []string, found map[string][]byte, resolved map[string]bool) error {
+	switch layer.MediaType {
+	case ocispec.MediaTypeImageLayerGzip, dockerLayerGzip, ocispec.MediaTypeImageLayer:
+	default:
+		return fmt.Errorf("the layer %s of %s has the unsupported media type %q", layer.Digest, ref.Name, layer.MediaType)
+	}
+	resp, err := c.get(ctx, ref.Repository, "blobs/"+layer.Digest.String(), nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var reader io.Reader = resp.Body
+	if layer.MediaType != ocispec.MediaTypeImageLayer {
+		gz, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			return fmt.Errorf("the layer %s of %s is not gzipped: %w", layer.Digest, ref.Name, err)
+		}
+		defer gz.Close()
+		reader = gz
+	}
+
+	wanted := make(map[string]bool, len(files))
+	for _, file := range files {
+		if name := strings.TrimPrefix(file, "/"); !resolved[name] {
+			wanted[name] = true
+		}
+	}
+	// whiteouts only hide the files of the older layers, not those of the same layer
+	archive := tar.NewReader(reader)
+	for len(wanted) > 0 {
+		header, err := archive.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("could not read the layer %s of %s: %w", layer.Digest, ref.Name, err)
+		}
+		name := strings.TrimPrefix(path.Clean("/"+header.Name), "/")
+		dir, base := path.Split(name)
+		switch {
+		case base == ".wh..wh..opq":
+			// an opaque directory hides the files of the older layers
+			for file := range wanted {
+				if strings.HasPrefix(file, dir) {
+					resolved[file] = true
+				}
+			}
+		case strings.HasPrefix(base, ".wh."):
+			deleted := dir + strings.TrimPrefix(base, ".wh.")
+			if wanted[deleted] {
+				resolved[deleted] = true
+				delete(wanted, deleted)
+			}
+		case wanted[name] && header.Typeflag == tar.TypeReg:
+			content, err := io.ReadAll(io.LimitReader(archive, 1<<20))
+			if err != nil {
+				return err
+			}
+			found[name] = content
+			resolved[name] = true
+			delete(wanted, name)
+		}
+	}
+	return nil
+}
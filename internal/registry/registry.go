@@ -0,0 +1,289 @@
+package registry
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/distribution/reference"
+	dockerregistry "github.com/docker/docker/api/types/registry"
+	"github.com/spf13/viper"
+)
+
+// the host the Docker Hub API is served from, docker.io is only its name
+const dockerHubHost = "registry-1.docker.io"
+
+// Reference is a parsed image reference like ghcr.io/org/tool:1.0
+type Reference struct {
+	// Name is the familiar reference Docker tags the image with, like busybox:latest
+	Name       string
+	Host       string
+	Repository string
+	// Tag or digest of the image
+	Tag    string
+	Digest string
+}
+
+// ParseReference normalizes the reference. Without tag and digest, the tag latest is used.
+func ParseReference(ref string) (Reference, error) {
+	named, err := reference.ParseNormalizedNamed(ref)
+	if err != nil {
+		return Reference{}, fmt.Errorf("invalid image reference %s: %w", ref, err)
+	}
+	named = reference.TagNameOnly(named)
+	parsed := Reference{
+		Name:       reference.FamiliarString(named),
+		Host:       reference.Domain(named),
+		Repository: reference.Path(named),
+	}
+	if tagged, ok := named.(reference.Tagged); ok {
+		parsed.Tag = tagged.Tag()
+	}
+	if digested, ok := named.(reference.Digested); ok {
+		parsed.Digest = digested.Digest().String()
+	}
+	if parsed.Host == "docker.io" {
+		parsed.Host = dockerHubHost
+	}
+	return parsed, nil
+}
+
+// WithTag returns the reference of another tag of the same repository
+func (r Reference) WithTag(tag string) (Reference, error) {
+	named, err := reference.ParseNormalizedNamed(r.Name)
+	if err != nil {
+		return Reference{}, err
+	}
+	tagged, err := reference.WithTag(reference.TrimNamed(named), tag)
+	if err != nil {
+		return Reference{}, err
+	}
+	return ParseReference(tagged.String())
+}
+
+// id is the tag or the digest, as used in the manifest URL
+func (r Reference) id() string {
+	if r.Digest != "" {
+		return r.Digest
+	}
+	return r.Tag
+}
+
+// Client talks to one registry with the distribution API. Bearer tokens are requested
+// on the first 401 and reused per repository.
+type Client struct {
+	http   *http.Client
+	host   string
+	scheme string
+	auth   string
+
+	mu     sync.Mutex
+	tokens map[string]string
+}
+
+// NewClient connects to the registry of the reference with the credentials Docker
+// stores for it. Registries in catalog.insecure_registries are reached over plain http.
+func NewClient(ref Reference) *Client {
+	scheme := "https"
+	if slices.Contains(viper.GetStringSlice("catalog.insecure_registries"), ref.Host) {
+		scheme = "http"
+	}
+	return &Client{
+		http:   &http.Client{Timeout: viper.GetDuration("catalog.timeout")},
+		host:   ref.Host,
+		scheme: scheme,
+		auth:   dockerCredentials(ref.Host),
+		tokens: make(map[string]string),
+	}
+}
+
+// dockerConfig is the part of ~/.docker/config.json holding the registry logins
+type dockerConfig struct {
+	Auths map[string]struct {
+		Auth string `json:"auth"`
+	} `json:"auths"`
+}
+
+// dockerCredentials returns the base64 user:password of docker login for the host, which
+// is read from $DOCKER_CONFIG/config.json. Credential helpers are not supported.
+func dockerCredentials(host string) string {
+	dir := os.Getenv("DOCKER_CONFIG")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		dir = filepath.Join(home, ".docker")
+	}
+	content, err := os.ReadFile(filepath.Join(dir, "config.json"))
+	if err != nil {
+		return ""
+	}
+	var config dockerConfig
+	if err := json.Unmarshal(content, &config); err != nil {
+		return ""
+	}
+	candidates := []string{host, "https://" + host, "http://" + host}
+	if host == dockerHubHost {
+		candidates = append(candidates, "https://index.docker.io/v1/", "docker.io", "index.docker.io")
+	}
+	for _, candidate := range candidates {
+		if entry, ok := config.Auths[candidate]; ok && entry.Auth != "" {
+			return entry.Auth
+		}
+	}
+	return ""
+}
+
+// ErrNotFound is returned if the registry does not know the manifest or blob
+var ErrNotFound = errors.New("not found in the registry")
+
+// get requests the path of the repository, authenticating on a 401 challenge
+func (c *Client) get(ctx context.Context, repository string, path string, accept []string) (*http.Response, error) {
+	do := func() (*http.Response, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s://%s/v2/%s/%s", c.scheme, c.host, repository, path), nil)
+		if err != nil {
+			return nil, err
+		}
+		for _, mediaType := range accept {
+			req.Header.Add("Accept", mediaType)
+		}
+		c.mu.Lock()
+		token := c.tokens[repository]
+		c.mu.Unlock()
+		if token != "" {
+			req.Header.Set("Authorization", token)
+		}
+		return c.http.Do(req)
+	}
+
+	resp, err := do()
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		challenge := resp.Header.Get("WWW-Authenticate")
+		resp.Body.Close()
+		token, err := c.authenticate(ctx, challenge, repository)
+		if err != nil {
+			return nil, err
+		}
+		c.mu.Lock()
+		c.tokens[repository] = token
+		c.mu.Unlock()
+		if resp, err = do(); err != nil {
+			return nil, err
+		}
+	}
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s of %s/%s: %w", path, c.host, repository, ErrNotFound)
+	case resp.StatusCode >= 400:
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		resp.Body.Close()
+		return nil, fmt.Errorf("the registry %s responded with %s: %s", c.host, resp.Status, strings.TrimSpace(string(message)))
+	}
+	return resp, nil
+}
+
+// authenticate answers the challenge of the registry with the Authorization header to use
+func (c *Client) authenticate(ctx context.Context, challenge string, repository string) (string, error) {
+	scheme, params := parseChallenge(challenge)
+	switch strings.ToLower(scheme) {
+	case "basic":
+		if c.auth == "" {
+			return "", fmt.Errorf("the registry %s requires a login, run docker login %s", c.host, c.host)
+		}
+		return "Basic " + c.auth, nil
+	case "bearer":
+	default:
+		return "", fmt.Errorf("the registry %s asks for the unsupported authentication %q", c.host, challenge)
+	}
+
+	realm, err := url.Parse(params["realm"])
+	if err != nil || params["realm"] == "" {
+		return "", fmt.Errorf("the registry %s sent an invalid token realm %q", c.host, params["realm"])
+	}
+	query := realm.Query()
+	if service := params["service"]; service != "" {
+		query.Set("service", service)
+	}
+	query.Set("scope", fmt.Sprintf("repository:%s:pull", repository))
+	realm.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, realm.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	if c.auth != "" {
+		req.Header.Set("Authorization", "Basic "+c.auth)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("the registry %s refused a pull token for %s: %s", c.host, repository, resp.Status)
+	}
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", err
+	}
+	if token.Token == "" {
+		token.Token = token.AccessToken
+	}
+	return "Bearer " + token.Token, nil
+}
+
+// parseChallenge splits a WWW-Authenticate header like Bearer realm="...",service="..."
+func parseChallenge(challenge string) (string, map[string]string) {
+	scheme, rest, _ := strings.Cut(strings.TrimSpace(challenge), " ")
+	params := make(map[string]string)
+	for rest != "" {
+		var key, value string
+		key, rest, _ = strings.Cut(strings.TrimLeft(rest, " ,"), "=")
+		if strings.HasPrefix(rest, `"`) {
+			value, rest, _ = strings.Cut(rest[1:], `"`)
+		} else {
+			value, rest, _ = strings.Cut(rest, ",")
+		}
+		if key != "" {
+			params[strings.ToLower(strings.TrimSpace(key))] = value
+		}
+	}
+	return scheme, params
+}
+
+// PullAuth encodes the login of docker login for the host of the reference as the
+// RegistryAuth of the Docker API. It is empty if there is no login.
+func PullAuth(ref Reference) (string, error) {
+	encoded := dockerCredentials(ref.Host)
+	if encoded == "" {
+		return "", nil
+	}
+	decoded, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", fmt.Errorf("the docker login of %s is invalid: %w", ref.Host, err)
+	}
+	username, password, _ := strings.Cut(string(decoded), ":")
+	return dockerregistry.EncodeAuthConfig(dockerregistry.AuthConfig{
+		Username:      username,
+		Password:      password,
+		ServerAddress: ref.Host,
+	})
+}
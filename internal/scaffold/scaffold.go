@@ -0,0 +1,150 @@
+package scaffold
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"text/template"
+
+	"github.com/hydrocode-de/gorun/internal/specversion"
+	"github.com/hydrocode-de/gorun/internal/toolImage"
+	toolspec "github.com/hydrocode-de/tool-spec-go"
+)
+
+// the templates of the generated files, common ones and one directory per language
+//
+//go:embed templates
+var templates embed.FS
+
+// Languages maps the names used with --language to the run file of the tool. gorun starts
+// these files with their interpreter in images without gotap.
+var Languages = map[string]string{
+	"python": "/src/run.py",
+	"r":      "/src/run.R",
+}
+
+// LanguageNames returns the names of the Languages, sorted
+func LanguageNames() []string {
+	names := make([]string, 0, len(Languages))
+	for name := range Languages {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// tool names are used as key of tool.yml and as image name
+var namePattern = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+type Options struct {
+	Name     string
+	Language string
+	// Out is the directory the tool is generated in, it must not exist or be empty
+	Out       string
+	WithGotap bool
+}
+
+// templateData is what the templates are rendered with
+type templateData struct {
+	Name        string
+	SpecVersion string
+	Command     []string
+	Extension   string
+	WithGotap   bool
+}
+
+// Generate renders the templates of the language into opts.Out and returns the files
+// written, relative to opts.Out. The generated tool.yml is checked to parse as tool-spec
+// before anything is written.
+func Generate(opts Options) ([]string, error) {
+	if !namePattern.MatchString(opts.Name) {
+		return nil, fmt.Errorf("invalid tool name %q, use lowercase letters, digits and underscores, starting with a letter", opts.Name)
+	}
+	language := strings.ToLower(opts.Language)
+	runFile, ok := Languages[language]
+	if !ok {
+		return nil, fmt.Errorf("unsupported language %q, use one of %s", opts.Language, strings.Join(LanguageNames(), ", "))
+	}
+	entries, err := os.ReadDir(opts.Out)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if len(entries) > 0 {
+		return nil, fmt.Errorf("the directory %s is not empty", opts.Out)
+	}
+
+	i := slices.IndexFunc(toolImage.EntryFiles, func(e toolImage.EntryFile) bool { return e.Path == runFile })
+	data := templateData{
+		Name:        opts.Name,
+		SpecVersion: specversion.LatestSupported.String(),
+		Command:     toolImage.EntryFiles[i].Command(),
+		Extension:   strings.TrimPrefix(path.Ext(runFile), "."),
+		WithGotap:   opts.WithGotap,
+	}
+	// the generated files and their templates
+	sources := map[string]string{
+		"src/tool.yml":                   "common/tool.yml.tmpl",
+		"src/CITATION.cff":               "common/CITATION.cff.tmpl",
+		"in/input.csv":                   "common/input.csv.tmpl",
+		"README.md":                      "common/README.md.tmpl",
+		"Dockerfile":                     language + "/Dockerfile.tmpl",
+		strings.TrimPrefix(runFile, "/"): language + "/" + path.Base(runFile) + ".tmpl",
+	}
+
+	rendered := make(map[string][]byte, len(sources))
+	for name, source := range sources {
+		tmpl, err := template.ParseFS(templates, path.Join("templates", source))
+		if err != nil {
+			return nil, err
+		}
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, data); err != nil {
+			return nil, fmt.Errorf("could not render %s: %w", name, err)
+		}
+		rendered[name] = buf.Bytes()
+	}
+	if err := checkSpec(opts.Name, rendered["src/tool.yml"]); err != nil {
+		return nil, err
+	}
+
+	written := make([]string, 0, len(rendered))
+	for name := range rendered {
+		written = append(written, name)
+	}
+	slices.Sort(written)
+	for _, name := range written {
+		target := filepath.Join(opts.Out, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(target, rendered[name], 0644); err != nil {
+			return nil, err
+		}
+	}
+	return written, nil
+}
+
+// checkSpec makes sure the generated tool.yml is read by gorun like the one of an image
+func checkSpec(name string, raw []byte) error {
+	spec, err := toolspec.LoadToolSpec(raw)
+	if err != nil {
+		return fmt.Errorf("the generated tool.yml is not a valid tool-spec: %w", err)
+	}
+	if _, ok := spec.Tools[name]; !ok {
+		return fmt.Errorf("the generated tool.yml does not contain the tool %s", name)
+	}
+	if compat := specversion.FromSpec(raw); compat.Status != specversion.StatusSupported {
+		return fmt.Errorf("the generated tool.yml is %s: %s", compat.Status, strings.Join(compat.Reasons, "; "))
+	}
+	if commands := toolImage.CommandsFromSpec(raw); len(commands[name]) == 0 {
+		return fmt.Errorf("the generated tool.yml does not declare a command for %s", name)
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package scaffold
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	toolspec "github.com/hydrocode-de/tool-spec-go"
+
+	"github.com/hydrocode-de/gorun/internal/toolImage"
+)
+
+// every language renders a tool.yml which is read by the tool-spec loader like the one of an image
+func TestGenerate(t *testing.T) {
+	for _, language := range LanguageNames() {
+		for _, withGotap := range []bool{false, true} {
+			name := language
+			if withGotap {
+				name += " with gotap"
+			}
+			t.Run(name, func(t *testing.T) {
+				out := filepath.Join(t.TempDir(), "tool")
+				written, err := Generate(Options{Name: "my_tool", Language: language, Out: out, WithGotap: withGotap})
+				if err != nil {
+					t.Fatal(err)
+				}
+				runFile := strings.TrimPrefix(Languages[language], "/")
+				for _, want := range []string{"src/tool.yml", "src/CITATION.cff", "in/input.csv", "README.md", "Dockerfile", runFile} {
+					if !slices.Contains(written, want) {
+						t.Errorf("%s is not in the written files %v", want, written)
+					}
+					if _, err := os.Stat(filepath.Join(out, filepath.FromSlash(want))); err != nil {
+						t.Errorf("%s is not written: %v", want, err)
+					}
+				}
+
+				raw, err := os.ReadFile(filepath.Join(out, "src", "tool.yml"))
+				if err != nil {
+					t.Fatal(err)
+				}
+				spec, err := toolspec.LoadToolSpec(raw)
+				if err != nil {
+					t.Fatalf("the tool.yml is not parsed: %v\n%s", err, raw)
+				}
+				tool, ok := spec.Tools["my_tool"]
+				if !ok {
+					t.Fatalf("the tool.yml declares the tools %v", spec.Tools)
+				}
+				for _, param := range []string{"message", "iterations", "threshold", "verbose", "method", "weights", "start_date", "start_time", "timestamp"} {
+					if _, ok := tool.Parameters[param]; !ok {
+						t.Errorf("the parameter %s is not declared", param)
+					}
+				}
+				if input, ok := tool.Data["input"]; !ok || !slices.Equal(input.Extensions, []string{"csv"}) {
+					t.Errorf("the input is declared as %+v", tool.Data)
+				}
+				entry := toolImage.EntryFiles[slices.IndexFunc(toolImage.EntryFiles, func(e toolImage.EntryFile) bool { return e.Path == Languages[language] })]
+				if command := toolImage.CommandsFromSpec(raw)["my_tool"]; !slices.Equal(command, entry.Command()) {
+					t.Errorf("the command is %v, want %v", command, entry.Command())
+				}
+
+				dockerfile, err := os.ReadFile(filepath.Join(out, "Dockerfile"))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := strings.Contains(string(dockerfile), "/usr/local/bin/gotap"); got != withGotap {
+					t.Errorf("the Dockerfile installs gotap: %v, want %v\n%s", got, withGotap, dockerfile)
+				}
+			})
+		}
+	}
+}
+
+func TestGenerateRefuses(t *testing.T) {
+	nonEmpty := t.TempDir()
+	if err := os.WriteFile(filepath.Join(nonEmpty, "keep.txt"), []byte("keep"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		opts Options
+		want string
+	}{
+		{name: "invalid name", opts: Options{Name: "My-Tool", Language: "python"}, want: "invalid tool name"},
+		{name: "unsupported language", opts: Options{Name: "my_tool", Language: "cobol"}, want: "unsupported language"},
+		{name: "non-empty directory", opts: Options{Name: "my_tool", Language: "python", Out: nonEmpty}, want: "is not empty"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.opts.Out == "" {
+				tt.opts.Out = filepath.Join(t.TempDir(), "tool")
+			}
+			if _, err := Generate(tt.opts); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Generate returned %v, want an error containing %q", err, tt.want)
+			}
+		})
+	}
+	if entries, _ := os.ReadDir(nonEmpty); len(entries) != 1 {
+		t.Errorf("the refused directory contains %v", entries)
+	}
+}
@@ -0,0 +1,13 @@
+#!/bin/sh
+# copy the staged input to /out, the only dataset is input
+set -e
+echo '{"message": "copying the input", "progress": 0.5}' >> /out/_events.jsonl
+for f in /in/*; do
+    case "$(basename "$f")" in
+        inputs.json) cp "$f" /out/inputs.json ;;
+        _manifest.json) ;;
+        *) cp "$f" /out/output.txt ;;
+    esac
+done
+echo '{"message": "done", "progress": 1}' >> /out/_events.jsonl
+echo "gorun selftest finished"
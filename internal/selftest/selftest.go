@@ -0,0 +1,422 @@
+package selftest
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/build"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/jsonmessage"
+	"github.com/hydrocode-de/gorun/internal/cache"
+	"github.com/hydrocode-de/gorun/internal/db"
+	"github.com/hydrocode-de/gorun/internal/dockerclient"
+	"github.com/hydrocode-de/gorun/internal/tool"
+	"github.com/hydrocode-de/gorun/internal/toolImage"
+	"github.com/spf13/viper"
+)
+
+// the build context of the test image, see image/Dockerfile
+//
+//go:embed image/*
+var imageFiles embed.FS
+
+const (
+	ImageRepository = "gorun-selftest"
+	ToolName        = "selftest"
+
+	inputContent = "gorun selftest input\n"
+	message      = "hello from gorun selftest"
+)
+
+// Variant is one flavor of the test image
+type Variant struct {
+	Name  string
+	Gotap bool
+}
+
+// Variants checks the test image without and with the gotap shim
+var Variants = []Variant{
+	{Name: "plain", Gotap: false},
+	{Name: "gotap", Gotap: true},
+}
+
+func (v Variant) Image() string {
+	return fmt.Sprintf("%s:%s", ImageRepository, v.Name)
+}
+
+// Check is the outcome of one step of the self test
+type Check struct {
+	Variant  string
+	Name     string
+	Duration time.Duration
+	Err      error
+	Skipped  bool
+}
+
+type Options struct {
+	DB     *db.Queries
+	Cache  *cache.Cache
+	UserID string
+	// KeepImages leaves the built test images in place for the next self test
+	KeepImages bool
+}
+
+// Failed reports if any check of the report failed
+func Failed(checks []Check) bool {
+	for _, check := range checks {
+		if check.Err != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// variantTest carries the state between the checks of one variant
+type variantTest struct {
+	opts    Options
+	c       *client.Client
+	variant Variant
+	tempDir string
+	run     *tool.Tool
+}
+
+// Run builds the test images and runs the tool of each through validation, creation, execution,
+// result listing and deletion. The checks of a variant after a failed one are skipped, the
+// clean up is always done. The run is bounded by the deadline of ctx.
+func Run(ctx context.Context, opts Options) []Check {
+	checks := make([]Check, 0)
+	c, err := dockerclient.Get()
+	if err == nil {
+		_, err = c.Ping(ctx)
+	}
+	if err != nil {
+		return append(checks, Check{Name: "connect to docker", Err: err})
+	}
+
+	for _, variant := range Variants {
+		test := &variantTest{opts: opts, c: c, variant: variant}
+		steps := []struct {
+			name string
+			fn   func(context.Context) error
+		}{
+			{"build image", test.buildImage},
+			{"discover spec", test.discoverSpec},
+			{"reject invalid payload", test.rejectInvalid},
+			{"create run", test.createRun},
+			{"execute run", test.executeRun},
+			{"list results", test.listResults},
+			{"gotap metadata", test.checkMetadata},
+			{"tool events", test.checkToolEvents},
+		}
+		failed := false
+		for _, step := range steps {
+			if failed {
+				checks = append(checks, Check{Variant: variant.Name, Name: step.name, Skipped: true})
+				continue
+			}
+			check := runCheck(ctx, variant.Name, step.name, step.fn)
+			failed = check.Err != nil
+			checks = append(checks, check)
+		}
+		// clean up with a fresh deadline, so that a timeout does not leave the run behind
+		cleanupCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 30*time.Second)
+		checks = append(checks, runCheck(cleanupCtx, variant.Name, "clean up", test.cleanup))
+		cancel()
+	}
+	return checks
+}
+
+func runCheck(ctx context.Context, variant string, name string, fn func(context.Context) error) Check {
+	started := time.Now()
+	err := fn(ctx)
+	if err == nil && ctx.Err() != nil {
+		err = ctx.Err()
+	}
+	return Check{Variant: variant, Name: name, Duration: time.Since(started), Err: err}
+}
+
+// buildContext packs the embedded image files as the tar archive the build API expects
+func buildContext() (io.Reader, error) {
+	var buf bytes.Buffer
+	archive := tar.NewWriter(&buf)
+	err := fs.WalkDir(imageFiles, "image", func(p string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		content, err := imageFiles.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		header := &tar.Header{
+			Name:    strings.TrimPrefix(p, "image/"),
+			Mode:    0o755,
+			Size:    int64(len(content)),
+			ModTime: time.Unix(0, 0),
+		}
+		if err := archive.WriteHeader(header); err != nil {
+			return err
+		}
+		_, err = archive.Write(content)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+	return &buf, nil
+}
+
+func (t *variantTest) buildImage(ctx context.Context) error {
+	buildCtx, err := buildContext()
+	if err != nil {
+		return err
+	}
+	withGotap := fmt.Sprint(t.variant.Gotap)
+	resp, err := t.c.ImageBuild(ctx, buildCtx, build.ImageBuildOptions{
+		Tags:        []string{t.variant.Image()},
+		BuildArgs:   map[string]*string{"WITH_GOTAP": &withGotap},
+		Remove:      true,
+		ForceRemove: true,
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// the build reports its errors in the stream of messages
+	return jsonmessage.DisplayJSONMessagesStream(resp.Body, io.Discard, 0, false, nil)
+}
+
+func (t *variantTest) discoverSpec(ctx context.Context) error {
+	spec, err := toolImage.LoadToolSpec(ctx, t.c, fmt.Sprintf("%s::%s", t.variant.Image(), ToolName), t.opts.Cache)
+	if err != nil {
+		return err
+	}
+	if _, ok := spec.Parameters["message"]; !ok {
+		return fmt.Errorf("the spec of %s has no parameter message", t.variant.Image())
+	}
+	if _, ok := spec.Data["input"]; !ok {
+		return fmt.Errorf("the spec of %s has no data input", t.variant.Image())
+	}
+	return nil
+}
+
+func (t *variantTest) runOptions(withData bool) (tool.CreateRunOptions, error) {
+	opts := tool.CreateRunOptions{
+		Image:      t.variant.Image(),
+		Name:       ToolName,
+		Parameters: map[string]interface{}{"message": message},
+		Datasets:   make(map[string]tool.DatasetRef),
+	}
+	if !withData {
+		return opts, nil
+	}
+	if t.tempDir == "" {
+		if err := os.MkdirAll(viper.GetString("temp_path"), 0o755); err != nil {
+			return opts, err
+		}
+		tempDir, err := os.MkdirTemp(viper.GetString("temp_path"), "selftest-")
+		if err != nil {
+			return opts, err
+		}
+		t.tempDir = tempDir
+	}
+	inputPath := filepath.Join(t.tempDir, "input.txt")
+	if err := os.WriteFile(inputPath, []byte(inputContent), 0o644); err != nil {
+		return opts, err
+	}
+	opts.Datasets["input"] = tool.SinglePath(inputPath)
+	return opts, nil
+}
+
+func (t *variantTest) rejectInvalid(ctx context.Context) error {
+	opts, err := t.runOptions(false)
+	if err != nil {
+		return err
+	}
+	runData, err := tool.ValidateAndCreateRun(ctx, t.opts.DB, t.opts.Cache, opts, t.opts.UserID)
+	if err == nil {
+		// the run must not exist, remove it again
+		if run, convErr := tool.FromDBRun(runData); convErr == nil {
+			t.run = &run
+		}
+		return fmt.Errorf("a run without the required data input was accepted")
+	}
+	if !tool.IsValidationError(err) {
+		return fmt.Errorf("expected a validation error, got: %w", err)
+	}
+	return nil
+}
+
+func (t *variantTest) createRun(ctx context.Context) error {
+	opts, err := t.runOptions(true)
+	if err != nil {
+		return err
+	}
+	runData, err := tool.ValidateAndCreateRun(ctx, t.opts.DB, t.opts.Cache, opts, t.opts.UserID)
+	if err != nil {
+		return err
+	}
+	run, err := tool.FromDBRun(runData)
+	if err != nil {
+		return err
+	}
+	t.run = &run
+	return nil
+}
+
+func (t *variantTest) executeRun(ctx context.Context) error {
+	err := tool.RunTool(ctx, tool.RunToolOptions{
+		DB:     t.opts.DB,
+		Tool:   *t.run,
+		Env:    []string{},
+		UserId: t.opts.UserID,
+	})
+	if err != nil {
+		return err
+	}
+	finished, err := tool.GetRun(ctx, t.opts.DB, t.run.ID, t.opts.UserID)
+	if err != nil {
+		return err
+	}
+	if tool.RunStatus(finished.Status) != tool.StatusFinished {
+		return fmt.Errorf("the run %d is %s instead of finished", finished.ID, finished.Status)
+	}
+	run, err := tool.FromDBRun(finished)
+	if err != nil {
+		return err
+	}
+	t.run = &run
+	return nil
+}
+
+func (t *variantTest) listResults(ctx context.Context) error {
+	results, err := t.run.ListResults()
+	if err != nil {
+		return err
+	}
+	found := make(map[string]string, len(results))
+	for _, result := range results {
+		found[result.RelPath] = result.AbsPath
+	}
+	for _, name := range []string{"output.txt", "inputs.json", "STDOUT.log"} {
+		if _, ok := found[name]; !ok {
+			return fmt.Errorf("the results of run %d do not contain %s", t.run.ID, name)
+		}
+	}
+
+	output, err := os.ReadFile(found["output.txt"])
+	if err != nil {
+		return err
+	}
+	if string(output) != inputContent {
+		return fmt.Errorf("output.txt does not match the staged input: %q", string(output))
+	}
+	inputs, err := os.ReadFile(found["inputs.json"])
+	if err != nil {
+		return err
+	}
+	if !strings.Contains(string(inputs), message) {
+		return fmt.Errorf("the inputs.json seen by the tool does not contain the parameter message")
+	}
+	stdout, err := os.ReadFile(found["STDOUT.log"])
+	if err != nil {
+		return err
+	}
+	if !strings.Contains(string(stdout), "gorun selftest finished") {
+		return fmt.Errorf("STDOUT.log does not contain the output of the tool")
+	}
+
+	verification, err := tool.RunOutputs(ctx, t.opts.DB, t.run.ID)
+	if err != nil {
+		return fmt.Errorf("the outputs of run %d were not verified: %w", t.run.ID, err)
+	}
+	if !verification.Complete {
+		return fmt.Errorf("the outputs %s of run %d are missing", strings.Join(verification.Missing, ", "), t.run.ID)
+	}
+	return nil
+}
+
+func (t *variantTest) checkMetadata(ctx context.Context) error {
+	dbRun, err := tool.GetRun(ctx, t.opts.DB, t.run.ID, t.opts.UserID)
+	if err != nil {
+		return err
+	}
+	if !dbRun.GotapMetadata.Valid {
+		return fmt.Errorf("no metadata was recorded for run %d", t.run.ID)
+	}
+	metadata, err := tool.ParseGotapMetadata(dbRun.GotapMetadata.String)
+	if err != nil {
+		return err
+	}
+	expected := "gorun"
+	if t.variant.Gotap {
+		expected = "gotap"
+	}
+	if metadata.GeneratedBy != expected {
+		return fmt.Errorf("the metadata of run %d was generated by %q instead of %q", t.run.ID, metadata.GeneratedBy, expected)
+	}
+	return nil
+}
+
+// checkToolEvents verifies that the lines the tool appended to /out/_events.jsonl were
+// recorded as run events and the last progress was kept on the run
+func (t *variantTest) checkToolEvents(ctx context.Context) error {
+	if t.run.Progress == nil || *t.run.Progress != 1 {
+		return fmt.Errorf("the run %d did not keep the progress 1 reported by the tool", t.run.ID)
+	}
+	runEvents, err := t.opts.DB.GetRunEvents(ctx, t.run.ID)
+	if err != nil {
+		return err
+	}
+	reported := 0
+	for _, event := range runEvents {
+		switch event.Type {
+		case tool.EventToolEvent:
+			reported++
+		case tool.EventToolEventMalformed:
+			return fmt.Errorf("the events of run %d were not parsed: %s", t.run.ID, event.Message)
+		}
+	}
+	if reported != 2 {
+		return fmt.Errorf("the run %d recorded %d of the 2 events reported by the tool", t.run.ID, reported)
+	}
+	return nil
+}
+
+func (t *variantTest) cleanup(ctx context.Context) error {
+	var errs []error
+	if t.run != nil {
+		if err := tool.DeleteRun(ctx, t.opts.DB, *t.run, t.opts.UserID, true); err != nil {
+			errs = append(errs, err)
+		} else if runDir, ok := t.run.RunDir(); ok {
+			if _, err := os.Stat(runDir); !os.IsNotExist(err) {
+				errs = append(errs, fmt.Errorf("the directory %s of the deleted run is left behind", runDir))
+			}
+		}
+	}
+	if t.tempDir != "" {
+		if err := os.RemoveAll(t.tempDir); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if !t.opts.KeepImages {
+		_, err := t.c.ImageRemove(ctx, t.variant.Image(), image.RemoveOptions{Force: true, PruneChildren: true})
+		if err != nil && !client.IsErrNotFound(err) {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
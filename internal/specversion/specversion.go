@@ -0,0 +1,112 @@
+package specversion
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+type Status string
+
+const (
+	StatusSupported   Status = "supported"
+	StatusDegraded    Status = "degraded"
+	StatusUnsupported Status = "unsupported"
+)
+
+// The tool-spec versions gorun understands. Specs up to LatestSupported are fully
+// supported, newer minor versions of the same major version may use fields gorun ignores.
+var (
+	MinSupported    = Version{Major: 0, Minor: 1}
+	LatestSupported = Version{Major: 1, Minor: 0}
+)
+
+type Version struct {
+	Major int
+	Minor int
+}
+
+func (v Version) String() string {
+	return fmt.Sprintf("%d.%d", v.Major, v.Minor)
+}
+
+func (v Version) less(other Version) bool {
+	if v.Major != other.Major {
+		return v.Major < other.Major
+	}
+	return v.Minor < other.Minor
+}
+
+// Parse reads versions like 1, 1.2, 1.2.3 or v1.2. The patch level is ignored
+func Parse(version string) (Version, error) {
+	parts := strings.Split(strings.TrimPrefix(strings.TrimSpace(version), "v"), ".")
+	if len(parts) > 3 {
+		return Version{}, fmt.Errorf("invalid version %s", version)
+	}
+	numbers := make([]int, len(parts))
+	for i, part := range parts {
+		number, err := strconv.Atoi(part)
+		if err != nil || number < 0 {
+			return Version{}, fmt.Errorf("invalid version %s", version)
+		}
+		numbers[i] = number
+	}
+
+	parsed := Version{Major: numbers[0]}
+	if len(numbers) > 1 {
+		parsed.Minor = numbers[1]
+	}
+	return parsed, nil
+}
+
+// Compatibility is the assessment of the version a tool spec declares
+type Compatibility struct {
+	Status  Status   `json:"status"`
+	Version string   `json:"version,omitempty"`
+	Reasons []string `json:"reasons,omitempty"`
+}
+
+func (c Compatibility) IsSupported() bool {
+	return c.Status != StatusUnsupported
+}
+
+// Assess compares the declared version against the supported range.
+// Specs without a version are assumed to match the latest supported version.
+func Assess(version string) Compatibility {
+	if strings.TrimSpace(version) == "" {
+		return Compatibility{Status: StatusSupported}
+	}
+
+	compat := Compatibility{Version: version}
+	parsed, err := Parse(version)
+	switch {
+	case err != nil:
+		compat.Status = StatusUnsupported
+		compat.Reasons = []string{fmt.Sprintf("the declared version %s cannot be parsed", version)}
+	case parsed.less(MinSupported):
+		compat.Status = StatusUnsupported
+		compat.Reasons = []string{fmt.Sprintf("version %s is older than the oldest supported version %s", version, MinSupported)}
+	case parsed.Major > LatestSupported.Major:
+		compat.Status = StatusUnsupported
+		compat.Reasons = []string{fmt.Sprintf("version %s is a new major version, gorun supports up to %s", version, LatestSupported)}
+	case LatestSupported.less(parsed):
+		compat.Status = StatusDegraded
+		compat.Reasons = []string{fmt.Sprintf("version %s is newer than %s, fields unknown to gorun are ignored", version, LatestSupported)}
+	default:
+		compat.Status = StatusSupported
+	}
+	return compat
+}
+
+// FromSpec reads the top-level version field of a raw tool.yml and assesses it
+func FromSpec(raw []byte) Compatibility {
+	var spec struct {
+		Version string `yaml:"version"`
+	}
+	if err := yaml.Unmarshal(raw, &spec); err != nil {
+		return Assess("")
+	}
+	return Assess(spec.Version)
+}
@@ -0,0 +1,206 @@
+package sshremote
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/client"
+	"github.com/spf13/viper"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// ErrNotConfigured is returned if runtime.ssh.host is not set
+var ErrNotConfigured = errors.New("the ssh runtime is not configured, set runtime.ssh.host")
+
+// the connection shared by all ssh runs. It is replaced after it was lost.
+var shared struct {
+	sync.Mutex
+	conn   *ssh.Client
+	docker *client.Client
+}
+
+// Configured reports if a remote host is set
+func Configured() bool {
+	return viper.GetString("runtime.ssh.host") != ""
+}
+
+// Host is the address of the remote host as host:port
+func Host() string {
+	return net.JoinHostPort(viper.GetString("runtime.ssh.host"), strconv.Itoa(viper.GetInt("runtime.ssh.port")))
+}
+
+// clientConfig authenticates with the key runtime.ssh.key_file and verifies the host
+// against runtime.ssh.known_hosts, unless runtime.ssh.insecure_ignore_host_key is set
+func clientConfig() (*ssh.ClientConfig, error) {
+	keyFile := viper.GetString("runtime.ssh.key_file")
+	if keyFile == "" {
+		return nil, fmt.Errorf("the ssh runtime needs a private key, set runtime.ssh.key_file")
+	}
+	key, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("could not read the ssh key %s: %w", keyFile, err)
+	}
+	signer, err := ssh.ParsePrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse the ssh key %s: %w", keyFile, err)
+	}
+
+	hostKeyCallback := ssh.InsecureIgnoreHostKey()
+	if !viper.GetBool("runtime.ssh.insecure_ignore_host_key") {
+		hostKeyCallback, err = knownhosts.New(viper.GetString("runtime.ssh.known_hosts"))
+		if err != nil {
+			return nil, fmt.Errorf("could not read the known hosts of the ssh runtime: %w", err)
+		}
+	}
+	return &ssh.ClientConfig{
+		User:            viper.GetString("runtime.ssh.user"),
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         viper.GetDuration("runtime.ssh.connect_timeout"),
+	}, nil
+}
+
+// Connect returns the connection to the remote host, which is opened on first use
+func Connect() (*ssh.Client, error) {
+	shared.Lock()
+	defer shared.Unlock()
+	if shared.conn != nil {
+		return shared.conn, nil
+	}
+	if !Configured() {
+		return nil, ErrNotConfigured
+	}
+	config, err := clientConfig()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := ssh.Dial("tcp", Host(), config)
+	if err != nil {
+		return nil, fmt.Errorf("could not connect to %s: %w", Host(), err)
+	}
+	shared.conn = conn
+	go keepAlive(conn)
+	return conn, nil
+}
+
+// keepAlive notices a dead connection between the calls, so that the next one reconnects
+func keepAlive(conn *ssh.Client) {
+	interval := viper.GetDuration("runtime.ssh.keepalive_interval")
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if _, _, err := conn.SendRequest("keepalive@openssh.com", true, nil); err != nil {
+			Reset(conn)
+			return
+		}
+	}
+}
+
+// Reset drops the connection, if it is still the shared one. The next call connects again.
+func Reset(conn *ssh.Client) {
+	shared.Lock()
+	defer shared.Unlock()
+	if shared.conn == conn && conn != nil {
+		conn.Close()
+		shared.conn = nil
+	}
+}
+
+// DockerClient returns a Docker client talking to the daemon socket runtime.ssh.docker_socket
+// of the remote host. Each request dials through the current connection, so the client
+// keeps working after a reconnect. The client must not be closed by the caller.
+func DockerClient() (*client.Client, error) {
+	shared.Lock()
+	defer shared.Unlock()
+	if shared.docker != nil {
+		return shared.docker, nil
+	}
+	socket := viper.GetString("runtime.ssh.docker_socket")
+	dial := func(ctx context.Context, network string, addr string) (net.Conn, error) {
+		conn, err := Connect()
+		if err != nil {
+			return nil, err
+		}
+		remote, err := conn.DialContext(ctx, "unix", socket)
+		if err != nil {
+			Reset(conn)
+			return nil, err
+		}
+		return remote, nil
+	}
+	c, err := client.NewClientWithOpts(
+		client.WithHost("unix://"+socket),
+		client.WithDialContext(dial),
+		client.WithAPIVersionNegotiation(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	shared.docker = c
+	return c, nil
+}
+
+// IsConnectionLoss reports if the error was caused by the connection to the remote host
+// and not by the remote daemon, so that the call may succeed after a reconnect
+func IsConnectionLoss(err error) bool {
+	if err == nil {
+		return false
+	}
+	var netErr net.Error
+	var exitErr *ssh.ExitMissingError
+	return client.IsErrConnectionFailed(err) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, net.ErrClosed) ||
+		errors.As(err, &netErr) ||
+		errors.As(err, &exitErr)
+}
+
+// Run executes the shell command on the remote host. The session is closed once ctx
+// is done, as ssh sessions do not take a context.
+func Run(ctx context.Context, command string, stdin io.Reader, stdout io.Writer) error {
+	conn, err := Connect()
+	if err != nil {
+		return err
+	}
+	session, err := conn.NewSession()
+	if err != nil {
+		Reset(conn)
+		return err
+	}
+	defer session.Close()
+
+	var stderr strings.Builder
+	session.Stdin, session.Stdout, session.Stderr = stdin, stdout, &stderr
+	done := make(chan error, 1)
+	go func() { done <- session.Run(command) }()
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		session.Close()
+		return ctx.Err()
+	}
+
+	var exitErr *ssh.ExitError
+	if errors.As(err, &exitErr) {
+		return fmt.Errorf("the remote command %q exited with status %d: %s", command, exitErr.ExitStatus(), strings.TrimSpace(stderr.String()))
+	}
+	return err
+}
+
+// Quote escapes the value for a POSIX shell on the remote host
+func Quote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
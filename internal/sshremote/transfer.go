@@ -0,0 +1,157 @@
+package sshremote
+
+import (
+	"archive/tar"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Upload copies the local file or directory to the remote path. It is streamed as a tar
+// archive into tar on the remote host, which needs no rsync or sftp server there.
+func Upload(ctx context.Context, localPath string, remotePath string) error {
+	info, err := os.Stat(localPath)
+	if err != nil {
+		return err
+	}
+	target, name := remotePath, "."
+	if !info.IsDir() {
+		target, name = path.Dir(remotePath), path.Base(remotePath)
+	}
+
+	reader, writer := io.Pipe()
+	go func() {
+		writer.CloseWithError(writeArchive(writer, localPath, name, info))
+	}()
+	defer reader.Close()
+	command := fmt.Sprintf("mkdir -p %s && tar -x -m -C %s", Quote(target), Quote(target))
+	return Run(ctx, command, reader, io.Discard)
+}
+
+// writeArchive packs the file or the content of the directory. Only regular files and
+// directories are copied, links could point outside of the run on the remote host.
+func writeArchive(w io.Writer, localPath string, name string, info fs.FileInfo) error {
+	archive := tar.NewWriter(w)
+	if !info.IsDir() {
+		if err := writeFile(archive, localPath, name, info); err != nil {
+			return err
+		}
+		return archive.Close()
+	}
+
+	err := filepath.WalkDir(localPath, func(p string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(localPath, p)
+		if err != nil || rel == "." {
+			return err
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			return archive.WriteHeader(&tar.Header{
+				Typeflag: tar.TypeDir,
+				Name:     filepath.ToSlash(rel) + "/",
+				Mode:     int64(info.Mode().Perm()),
+				ModTime:  info.ModTime(),
+			})
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		return writeFile(archive, p, filepath.ToSlash(rel), info)
+	})
+	if err != nil {
+		return err
+	}
+	return archive.Close()
+}
+
+func writeFile(archive *tar.Writer, localPath string, name string, info fs.FileInfo) error {
+	f, err := os.Open(localPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	err = archive.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Mode:     int64(info.Mode().Perm()),
+		Size:     info.Size(),
+		ModTime:  info.ModTime(),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(archive, f)
+	return err
+}
+
+// Download copies the content of the remote directory into the local directory
+func Download(ctx context.Context, remotePath string, localPath string) error {
+	reader, writer := io.Pipe()
+	extracted := make(chan error, 1)
+	go func() {
+		err := extractArchive(reader, localPath)
+		// drain the archive, so that the remote tar does not block on a failed extraction
+		io.Copy(io.Discard, reader)
+		extracted <- err
+	}()
+	err := Run(ctx, fmt.Sprintf("tar -c -C %s .", Quote(remotePath)), nil, writer)
+	writer.CloseWithError(err)
+	if extractErr := <-extracted; err == nil {
+		err = extractErr
+	}
+	return err
+}
+
+// extractArchive writes the regular files and directories of the archive below dir.
+// Entries leaving dir are rejected.
+func extractArchive(r io.Reader, dir string) error {
+	archive := tar.NewReader(r)
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		name := filepath.Clean(filepath.FromSlash(header.Name))
+		if name == "." {
+			continue
+		}
+		if filepath.IsAbs(name) || name == ".." || strings.HasPrefix(name, ".."+string(filepath.Separator)) {
+			return fmt.Errorf("the remote archive contains the entry %s outside of the directory", header.Name)
+		}
+		target := filepath.Join(dir, name)
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0o755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+				return err
+			}
+			f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, fs.FileMode(header.Mode).Perm()|0o600)
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(f, archive)
+			f.Close()
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,268 @@
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// S3 stores objects in a bucket of an S3 compatible service, like MinIO. The requests are
+// signed with AWS Signature Version 4.
+type S3 struct {
+	Endpoint *url.URL
+	// PublicEndpoint is used for presigned URLs instead of Endpoint, if clients reach the
+	// service under another name than gorun
+	PublicEndpoint *url.URL
+	Region         string
+	Bucket         string
+	AccessKey      string
+	SecretKey      string
+	// PathStyle addresses the bucket in the path, as MinIO expects, instead of the host name
+	PathStyle bool
+	Client    *http.Client
+}
+
+// S3FromConfig returns the bucket of storage.s3.*, or nil if no endpoint and bucket are configured
+func S3FromConfig() (*S3, error) {
+	endpoint := viper.GetString("storage.s3.endpoint")
+	bucket := viper.GetString("storage.s3.bucket")
+	if endpoint == "" || bucket == "" {
+		return nil, nil
+	}
+	if viper.GetString("storage.s3.region") == "" {
+		return nil, fmt.Errorf("storage.s3.region is required to sign the requests to the object storage")
+	}
+	s := &S3{
+		Region:    viper.GetString("storage.s3.region"),
+		Bucket:    bucket,
+		AccessKey: viper.GetString("storage.s3.access_key"),
+		SecretKey: viper.GetString("storage.s3.secret_key"),
+		PathStyle: viper.GetBool("storage.s3.path_style"),
+		Client:    &http.Client{Timeout: viper.GetDuration("storage.s3.timeout")},
+	}
+	var err error
+	if s.Endpoint, err = parseEndpoint(endpoint); err != nil {
+		return nil, fmt.Errorf("invalid storage.s3.endpoint: %w", err)
+	}
+	s.PublicEndpoint = s.Endpoint
+	if public := viper.GetString("storage.s3.public_endpoint"); public != "" {
+		if s.PublicEndpoint, err = parseEndpoint(public); err != nil {
+			return nil, fmt.Errorf("invalid storage.s3.public_endpoint: %w", err)
+		}
+	}
+	return s, nil
+}
+
+func parseEndpoint(endpoint string) (*url.URL, error) {
+	u, err := url.Parse(strings.TrimSuffix(endpoint, "/"))
+	if err != nil {
+		return nil, err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("%s is not an http or https URL", endpoint)
+	}
+	return u, nil
+}
+
+// Error is the error response of the service
+type Error struct {
+	StatusCode int
+	Code       string `xml:"Code"`
+	Message    string `xml:"Message"`
+}
+
+func (e *Error) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("the object storage answered %d", e.StatusCode)
+	}
+	return fmt.Sprintf("the object storage answered %d %s: %s", e.StatusCode, e.Code, e.Message)
+}
+
+// Put uploads the object. The checksum is the hex encoded SHA-256 of the content, which
+// the service verifies before it stores the object.
+func (s *S3) Put(ctx context.Context, key string, body io.Reader, size int64, checksum string, contentType string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, s.objectURL(s.Endpoint, key).String(), body)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	return s.do(req, checksum)
+}
+
+// Delete removes the object, removing a missing object is no error
+func (s *S3) Delete(ctx context.Context, key string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, s.objectURL(s.Endpoint, key).String(), nil)
+	if err != nil {
+		return err
+	}
+	return s.do(req, emptySHA256)
+}
+
+// Check tells if the bucket is reachable with the credentials
+func (s *S3) Check(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, s.objectURL(s.Endpoint, "").String(), nil)
+	if err != nil {
+		return err
+	}
+	return s.do(req, emptySHA256)
+}
+
+// PresignGet returns a URL which downloads the object without credentials until it expires.
+// The params, like response-content-disposition, are signed into the URL.
+func (s *S3) PresignGet(key string, expires time.Duration, params url.Values) string {
+	u := s.objectURL(s.PublicEndpoint, key)
+	amzDate := now().UTC().Format("20060102T150405Z")
+	scope := s.scope(amzDate[:8])
+
+	query := url.Values{}
+	for name, values := range params {
+		query[name] = values
+	}
+	query.Set("X-Amz-Algorithm", "AWS4-HMAC-SHA256")
+	query.Set("X-Amz-Credential", s.AccessKey+"/"+scope)
+	query.Set("X-Amz-Date", amzDate)
+	query.Set("X-Amz-Expires", strconv.FormatInt(int64(expires.Seconds()), 10))
+	query.Set("X-Amz-SignedHeaders", "host")
+
+	canonicalQuery := canonicalQueryString(query)
+	canonicalRequest := strings.Join([]string{
+		http.MethodGet,
+		u.EscapedPath(),
+		canonicalQuery,
+		"host:" + u.Host + "\n",
+		"host",
+		"UNSIGNED-PAYLOAD",
+	}, "\n")
+	u.RawQuery = canonicalQuery + "&X-Amz-Signature=" + s.signature(amzDate, scope, canonicalRequest)
+	return u.String()
+}
+
+// now is the time the requests are signed at, replaced by the tests
+var now = time.Now
+
+// the SHA-256 of a request without body
+const emptySHA256 = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+func (s *S3) do(req *http.Request, payloadHash string) error {
+	s.sign(req, payloadHash)
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 300 {
+		io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	s3Err := &Error{StatusCode: resp.StatusCode}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	xml.Unmarshal(body, s3Err)
+	return s3Err
+}
+
+// objectURL addresses the key in the bucket, the segments of the key are escaped as
+// Signature Version 4 expects it
+func (s *S3) objectURL(endpoint *url.URL, key string) *url.URL {
+	u := *endpoint
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = uriEncode(segment)
+	}
+	escapedKey := strings.Join(segments, "/")
+	if s.PathStyle {
+		u.RawPath = strings.TrimSuffix(u.EscapedPath(), "/") + "/" + uriEncode(s.Bucket) + "/" + escapedKey
+	} else {
+		u.Host = s.Bucket + "." + u.Host
+		u.RawPath = strings.TrimSuffix(u.EscapedPath(), "/") + "/" + escapedKey
+	}
+	u.Path, _ = url.PathUnescape(u.RawPath)
+	return &u
+}
+
+func (s *S3) sign(req *http.Request, payloadHash string) {
+	amzDate := now().UTC().Format("20060102T150405Z")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+	canonicalHeaders := "host:" + req.URL.Host + "\n" +
+		"x-amz-content-sha256:" + payloadHash + "\n" +
+		"x-amz-date:" + amzDate + "\n"
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		canonicalQueryString(req.URL.Query()),
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := s.scope(amzDate[:8])
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.AccessKey, scope, signedHeaders, s.signature(amzDate, scope, canonicalRequest)))
+}
+
+func (s *S3) scope(date string) string {
+	return date + "/" + s.Region + "/s3/aws4_request"
+}
+
+func (s *S3) signature(amzDate string, scope string, canonicalRequest string) string {
+	hashed := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(hashed[:])
+	key := hmacSHA256([]byte("AWS4"+s.SecretKey), amzDate[:8])
+	for _, part := range []string{s.Region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// canonicalQueryString sorts the parameters by name and escapes them like uriEncode
+func canonicalQueryString(query url.Values) string {
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var parts []string
+	for _, name := range names {
+		values := append([]string(nil), query[name]...)
+		sort.Strings(values)
+		for _, value := range values {
+			parts = append(parts, uriEncode(name)+"="+uriEncode(value))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// uriEncode escapes all but the unreserved characters of RFC 3986
+func uriEncode(value string) string {
+	var encoded strings.Builder
+	for _, b := range []byte(value) {
+		if ('A' <= b && b <= 'Z') || ('a' <= b && b <= 'z') || ('0' <= b && b <= '9') || b == '-' || b == '_' || b == '.' || b == '~' {
+			encoded.WriteByte(b)
+		} else {
+			fmt.Fprintf(&encoded, "%%%02X", b)
+		}
+	}
+	return encoded.String()
+}
@@ -0,0 +1,63 @@
+package support
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"os"
+	"sync"
+)
+
+// the server log lines kept for support bundles
+const logBufferLines = 2000
+
+// LogBuffer keeps the last lines written to the log of the server in memory
+type LogBuffer struct {
+	mu      sync.Mutex
+	lines   [][]byte
+	next    int
+	partial []byte
+}
+
+// serverLogs is set while the server captures its log
+var serverLogs *LogBuffer
+
+// CaptureLogs copies the standard logger into a buffer, which the bundles of this
+// process include as server log
+func CaptureLogs() {
+	serverLogs = &LogBuffer{lines: make([][]byte, 0, logBufferLines)}
+	log.SetOutput(io.MultiWriter(os.Stderr, serverLogs))
+}
+
+func (b *LogBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	data := append(b.partial, p...)
+	for {
+		newline := bytes.IndexByte(data, '\n')
+		if newline < 0 {
+			break
+		}
+		line := append([]byte(nil), data[:newline+1]...)
+		if len(b.lines) < logBufferLines {
+			b.lines = append(b.lines, line)
+		} else {
+			b.lines[b.next] = line
+			b.next = (b.next + 1) % logBufferLines
+		}
+		data = data[newline+1:]
+	}
+	b.partial = append([]byte(nil), data...)
+	return len(p), nil
+}
+
+// Bytes returns the buffered lines, the oldest first
+func (b *LogBuffer) Bytes() []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var content bytes.Buffer
+	for i := range b.lines {
+		content.Write(b.lines[(b.next+i)%len(b.lines)])
+	}
+	return content.Bytes()
+}
@@ -0,0 +1,341 @@
+package support
+
+import (
+	"archive/zip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hydrocode-de/gorun/internal/db"
+	"github.com/hydrocode-de/gorun/internal/dockerclient"
+	"github.com/hydrocode-de/gorun/internal/files"
+	"github.com/hydrocode-de/gorun/internal/helper"
+	"github.com/hydrocode-de/gorun/internal/storage"
+	"github.com/hydrocode-de/gorun/internal/tool"
+	gorunsql "github.com/hydrocode-de/gorun/sql"
+	"github.com/hydrocode-de/gorun/version"
+	"github.com/spf13/viper"
+)
+
+// the lines of the logs of a run in a bundle
+const runLogTailLines = 200
+
+// ErrBusy is returned while another bundle is built
+var ErrBusy = errors.New("a support bundle is being built already, try again later")
+
+// only one bundle is built at a time, so that bundles never compete with the runs
+var building sync.Mutex
+
+// Options select what goes into a bundle besides the state of the server
+type Options struct {
+	// RunID adds the detail, events and log tails of the run, if not 0
+	RunID int64
+	// ServerLog is a log file of the server, the log this process captured is used otherwise
+	ServerLog string
+}
+
+// Target is the audit target of the bundle, the run it includes if any
+func (o Options) Target() string {
+	if o.RunID == 0 {
+		return "server"
+	}
+	return fmt.Sprintf("run:%d", o.RunID)
+}
+
+// Section is an entry of the bundle, as listed in its manifest
+type Section struct {
+	Name      string `json:"name"`
+	Bytes     int    `json:"bytes"`
+	Truncated bool   `json:"truncated,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// Manifest is the first entry of a bundle
+type Manifest struct {
+	CreatedAt time.Time `json:"created_at"`
+	Version   string    `json:"version"`
+	RunID     int64     `json:"run_id,omitempty"`
+	MaxBytes  int64     `json:"max_bytes"`
+	Sections  []Section `json:"sections"`
+}
+
+type section struct {
+	name    string
+	collect func(context.Context) ([]byte, error)
+}
+
+// Build writes a zip of the state of the server for bug reports: the version, the redacted
+// configuration, the schema version, health checks, Docker info, the recent server log and,
+// with a run, its detail, events and log tails. Everything is redacted and the content is
+// capped to support.max_bytes. Sections which fail or exceed support.timeout are listed
+// with their error in manifest.json instead of failing the bundle.
+func Build(ctx context.Context, DB *db.Queries, opts Options, w io.Writer) error {
+	if !building.TryLock() {
+		return ErrBusy
+	}
+	defer building.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, viper.GetDuration("support.timeout"))
+	defer cancel()
+
+	literals := secretValues()
+	sections := []section{
+		{"version.json", func(context.Context) ([]byte, error) { return versionInfo() }},
+		{"config.txt", func(context.Context) ([]byte, error) { return configDump(), nil }},
+		{"schema.json", func(context.Context) ([]byte, error) { return schemaInfo() }},
+		{"checks.json", func(ctx context.Context) ([]byte, error) { return checks(ctx, DB) }},
+		{"docker.json", dockerInfo},
+		{"server.log", func(context.Context) ([]byte, error) { return serverLog(opts.ServerLog) }},
+	}
+	if opts.RunID != 0 {
+		run, owner, err := loadRun(ctx, DB, opts.RunID)
+		if err != nil {
+			return err
+		}
+		literals = append(literals, owner.ID, owner.Email)
+		sections = append(sections, runSections(DB, run)...)
+	}
+	redactor := NewRedactor(literals...)
+
+	maxBytes := viper.GetInt64("support.max_bytes")
+	manifest := Manifest{CreatedAt: time.Now().UTC(), Version: version.Version, RunID: opts.RunID, MaxBytes: maxBytes}
+	contents := make([][]byte, len(sections))
+	remaining := maxBytes
+	for i, s := range sections {
+		entry := Section{Name: s.name}
+		content, err := s.collect(ctx)
+		if err != nil {
+			entry.Error = redactor.Redact(err.Error())
+		}
+		content = []byte(redactor.Redact(string(content)))
+		if maxBytes > 0 && int64(len(content)) > remaining {
+			content, entry.Truncated = content[:max(remaining, 0)], true
+		}
+		remaining -= int64(len(content))
+		entry.Bytes = len(content)
+		contents[i] = content
+		manifest.Sections = append(manifest.Sections, entry)
+	}
+
+	archive := zip.NewWriter(w)
+	manifestJSON, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeEntry(archive, "manifest.json", manifestJSON, manifest.CreatedAt); err != nil {
+		return err
+	}
+	for i, s := range sections {
+		if err := writeEntry(archive, s.name, contents[i], manifest.CreatedAt); err != nil {
+			return err
+		}
+	}
+	return archive.Close()
+}
+
+func writeEntry(archive *zip.Writer, name string, content []byte, modified time.Time) error {
+	entry, err := archive.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: modified})
+	if err != nil {
+		return err
+	}
+	_, err = entry.Write(content)
+	return err
+}
+
+// secretValues are the configured secrets, which are scrubbed wherever they occur
+func secretValues() []string {
+	var values []string
+	for _, key := range viper.AllKeys() {
+		if isSecretKey(key) {
+			if value := fmt.Sprint(viper.Get(key)); len(value) >= 4 {
+				values = append(values, value)
+			}
+		}
+	}
+	return values
+}
+
+func isSecretKey(key string) bool {
+	return helper.IsSecretName(key[strings.LastIndex(key, ".")+1:])
+}
+
+func versionInfo() ([]byte, error) {
+	return json.MarshalIndent(map[string]string{
+		"version":    version.Version,
+		"commit":     version.Commit,
+		"date":       version.Date,
+		"go_version": runtime.Version(),
+		"platform":   runtime.GOOS + "/" + runtime.GOARCH,
+	}, "", "  ")
+}
+
+// configDump is the effective configuration like gorun config show prints it
+func configDump() []byte {
+	var dump strings.Builder
+	if file := viper.ConfigFileUsed(); file != "" {
+		fmt.Fprintf(&dump, "# config file: %s\n", file)
+	}
+	keys := viper.AllKeys()
+	sort.Strings(keys)
+	for _, key := range keys {
+		value := viper.Get(key)
+		if isSecretKey(key) && fmt.Sprint(value) != "" {
+			value = "[redacted]"
+		}
+		fmt.Fprintf(&dump, "%s: %v\n", key, value)
+	}
+	return []byte(dump.String())
+}
+
+func schemaInfo() ([]byte, error) {
+	schemaVersion, err := gorunsql.SchemaVersion()
+	if err != nil {
+		return nil, err
+	}
+	return json.MarshalIndent(map[string]int64{"schema_version": schemaVersion}, "", "  ")
+}
+
+// Check is the outcome of one of the health checks of a bundle
+type Check struct {
+	Name   string `json:"name"`
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail"`
+}
+
+// checks tells if the database, the daemon and the directories of gorun are usable
+func checks(ctx context.Context, DB *db.Queries) ([]byte, error) {
+	var results []Check
+	if runs, err := DB.GetActiveRuns(ctx); err != nil {
+		results = append(results, Check{Name: "database", Detail: err.Error()})
+	} else {
+		results = append(results, Check{Name: "database", OK: true, Detail: fmt.Sprintf("%d active runs", len(runs))})
+	}
+	if err := dockerclient.Check(ctx); err != nil {
+		results = append(results, Check{Name: "docker", Detail: err.Error()})
+	} else {
+		results = append(results, Check{Name: "docker", OK: true, Detail: "the daemon is reachable"})
+	}
+	if store, err := storage.S3FromConfig(); err != nil {
+		results = append(results, Check{Name: "object_storage", Detail: err.Error()})
+	} else if store != nil {
+		if err := store.Check(ctx); err != nil {
+			results = append(results, Check{Name: "object_storage", Detail: err.Error()})
+		} else {
+			results = append(results, Check{Name: "object_storage", OK: true, Detail: fmt.Sprintf("the bucket %s is reachable", store.Bucket)})
+		}
+	}
+	for _, key := range []string{"path", "mount_path", "temp_path"} {
+		results = append(results, checkDirectory(key, viper.GetString(key)))
+	}
+	return json.MarshalIndent(results, "", "  ")
+}
+
+func checkDirectory(key string, dir string) Check {
+	check := Check{Name: key}
+	probe, err := os.CreateTemp(dir, ".support-probe-")
+	if err != nil {
+		check.Detail = fmt.Sprintf("%s is not writable: %v", dir, err)
+		return check
+	}
+	probe.Close()
+	os.Remove(probe.Name())
+	free, err := files.FreeBytes(dir)
+	if err != nil {
+		check.Detail = fmt.Sprintf("%s is writable, the free space is unknown: %v", dir, err)
+		return check
+	}
+	check.OK = true
+	check.Detail = fmt.Sprintf("%s is writable, %d MB free", dir, free>>20)
+	return check
+}
+
+func dockerInfo(ctx context.Context) ([]byte, error) {
+	c, err := dockerclient.Get()
+	if err != nil {
+		return nil, err
+	}
+	info, err := c.Info(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return json.MarshalIndent(info, "", "  ")
+}
+
+// serverLog reads the end of the given log file, or the log captured by this process
+func serverLog(logFile string) ([]byte, error) {
+	if logFile == "" {
+		if serverLogs == nil {
+			return nil, fmt.Errorf("the log of the server is not captured by this process, pass the log file instead")
+		}
+		return serverLogs.Bytes(), nil
+	}
+	file, err := os.Open(logFile)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	// the end of the log is the interesting part, the size cap applies later
+	limit := max(viper.GetInt64("support.max_bytes")/2, 64*1024)
+	offset := max(info.Size()-limit, 0)
+	return io.ReadAll(io.NewSectionReader(file, offset, info.Size()-offset))
+}
+
+func loadRun(ctx context.Context, DB *db.Queries, runID int64) (tool.Tool, db.User, error) {
+	ownerID, err := DB.GetRunOwner(ctx, runID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return tool.Tool{}, db.User{}, fmt.Errorf("the run %d was not found: %w", runID, tool.ErrNotFound)
+	}
+	if err != nil {
+		return tool.Tool{}, db.User{}, err
+	}
+	dbRun, err := tool.GetRun(ctx, DB, runID, ownerID)
+	if err != nil {
+		return tool.Tool{}, db.User{}, err
+	}
+	run, err := tool.FromDBRun(dbRun)
+	if err != nil {
+		return tool.Tool{}, db.User{}, err
+	}
+	owner, err := DB.GetUserByID(ctx, ownerID)
+	if err != nil {
+		owner = db.User{ID: ownerID}
+	}
+	return run, owner, nil
+}
+
+func runSections(DB *db.Queries, run tool.Tool) []section {
+	dir := fmt.Sprintf("run-%d/", run.ID)
+	sections := []section{
+		{dir + "detail.json", func(context.Context) ([]byte, error) { return json.MarshalIndent(run, "", "  ") }},
+		{dir + "events.json", func(ctx context.Context) ([]byte, error) {
+			events, err := DB.GetRunEvents(ctx, run.ID)
+			if err != nil {
+				return nil, err
+			}
+			return json.MarshalIndent(events, "", "  ")
+		}},
+	}
+	for _, name := range []string{"STDOUT.log", "STDERR.log"} {
+		sections = append(sections, section{dir + name, func(context.Context) ([]byte, error) {
+			tail, found, err := run.LogTail(name, runLogTailLines)
+			if err == nil && !found {
+				err = fmt.Errorf("the run has no %s", name)
+			}
+			return []byte(tail), err
+		}})
+	}
+	return sections
+}
@@ -0,0 +1,158 @@
+package tool
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/hydrocode-de/gorun/internal/db"
+	"github.com/hydrocode-de/gorun/internal/files"
+)
+
+// the sources of the annotations of result files
+const (
+	AnnotationSourceTool = "tool"
+	AnnotationSourceUser = "user"
+)
+
+// the characters a label of a result file may have
+const maxResultLabel = 200
+
+// ResultAnnotation marks a result file of a run as primary or labels it. The tool annotates
+// its results with a result line in _events.jsonl or the results of _metadata.json, the
+// user with PATCH /runs/{id}/results/{filename}. The tool never replaces an annotation of the user.
+type ResultAnnotation struct {
+	File    string `json:"file"`
+	Primary bool   `json:"primary"`
+	Label   string `json:"label,omitempty"`
+	// Source is tool or user
+	Source string `json:"source,omitempty"`
+}
+
+func (a ResultAnnotation) String() string {
+	message := "annotated the result " + a.File
+	if a.Primary {
+		message += " as primary"
+	}
+	if a.Label != "" {
+		message += ": " + a.Label
+	}
+	return message
+}
+
+// check tells if the file is a path below /out and the label is not too long
+func (a ResultAnnotation) check() error {
+	file := normalizeResultPath(a.File)
+	if a.File == "" || file == "." || file == ".." || strings.HasPrefix(file, "../") || strings.HasPrefix(file, "/") {
+		return fmt.Errorf("the result file %q is not a path relative to /out", a.File)
+	}
+	if utf8.RuneCountInString(a.Label) > maxResultLabel {
+		return fmt.Errorf("the label of the result %s is longer than %d characters", a.File, maxResultLabel)
+	}
+	return nil
+}
+
+// recordToolAnnotation stores an annotation the tool reported, unless the user annotated the file
+func recordToolAnnotation(ctx context.Context, DB *db.Queries, runID int64, annotation ResultAnnotation) error {
+	if err := annotation.check(); err != nil {
+		return err
+	}
+	return DB.SetToolResultAnnotation(ctx, db.SetToolResultAnnotationParams{
+		RunID:     runID,
+		RelPath:   normalizeResultPath(annotation.File),
+		IsPrimary: annotation.Primary,
+		Label:     annotation.Label,
+	})
+}
+
+// recordMetadataAnnotations stores the results the tool annotated in its _metadata.json
+func recordMetadataAnnotations(ctx context.Context, DB *db.Queries, runID int64, metadata *GotapMetadata) {
+	for _, annotation := range metadata.Results {
+		if err := recordToolAnnotation(ctx, DB, runID, annotation); err != nil {
+			RecordRunEvent(ctx, DB, runID, EventToolEventMalformed, fmt.Sprintf("the annotation of a result in _metadata.json was skipped: %v", err))
+		}
+	}
+}
+
+// AnnotateResult sets the annotation of a result file by the user. The fields which are nil
+// keep their value.
+func (t *Tool) AnnotateResult(ctx context.Context, DB *db.Queries, resultPath string, primary *bool, label *string) (ResultAnnotation, error) {
+	normalized := normalizeResultPath(resultPath)
+	results, err := t.DescribeResults(ctx, DB, false)
+	if err != nil {
+		return ResultAnnotation{}, err
+	}
+	flat, err := t.DescribeResults(ctx, DB, true)
+	if err != nil {
+		return ResultAnnotation{}, err
+	}
+	found := false
+	for _, result := range append(results, flat...) {
+		found = found || filepath.ToSlash(result.RelPath) == normalized
+	}
+	if !found {
+		return ResultAnnotation{}, fmt.Errorf("the result file %s was not found in the tool %s results: %w", resultPath, t.Name, ErrNotFound)
+	}
+
+	annotation := ResultAnnotation{File: normalized, Source: AnnotationSourceUser}
+	existing, err := DB.GetRunResultAnnotation(ctx, db.GetRunResultAnnotationParams{RunID: t.ID, RelPath: normalized})
+	if err == nil {
+		annotation.Primary, annotation.Label = existing.IsPrimary, existing.Label
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return ResultAnnotation{}, err
+	}
+	if primary != nil {
+		annotation.Primary = *primary
+	}
+	if label != nil {
+		annotation.Label = strings.TrimSpace(*label)
+	}
+	if err := annotation.check(); err != nil {
+		return ResultAnnotation{}, &ValidationError{Message: err.Error()}
+	}
+
+	err = DB.SetRunResultAnnotation(ctx, db.SetRunResultAnnotationParams{
+		RunID:     t.ID,
+		RelPath:   normalized,
+		IsPrimary: annotation.Primary,
+		Label:     annotation.Label,
+		Source:    annotation.Source,
+	})
+	if err != nil {
+		return ResultAnnotation{}, err
+	}
+	return annotation, nil
+}
+
+// ResultAnnotations returns the annotated results of the run by their path below /out
+func (t *Tool) ResultAnnotations(ctx context.Context, DB *db.Queries) (map[string]ResultAnnotation, error) {
+	records, err := DB.GetRunResultAnnotations(ctx, t.ID)
+	if err != nil {
+		return nil, err
+	}
+	annotations := make(map[string]ResultAnnotation, len(records))
+	for _, record := range records {
+		annotations[record.RelPath] = ResultAnnotation{File: record.RelPath, Primary: record.IsPrimary, Label: record.Label, Source: record.Source}
+	}
+	return annotations, nil
+}
+
+// withAnnotations sets the annotations of the listed results and lists the primary ones first
+func (t *Tool) withAnnotations(ctx context.Context, DB *db.Queries, results []files.ResultFile) ([]files.ResultFile, error) {
+	annotations, err := t.ResultAnnotations(ctx, DB)
+	if err != nil || len(annotations) == 0 {
+		return results, err
+	}
+	for i := range results {
+		if annotation, ok := annotations[filepath.ToSlash(results[i].RelPath)]; ok {
+			results[i].Primary, results[i].Label = annotation.Primary, annotation.Label
+		}
+	}
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Primary && !results[j].Primary })
+	return results, nil
+}
@@ -0,0 +1,195 @@
+package tool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hydrocode-de/gorun/internal/apptainer"
+	"github.com/hydrocode-de/gorun/internal/files"
+	"github.com/hydrocode-de/gorun/internal/toolImage"
+	"github.com/hydrocode-de/gorun/version"
+	"github.com/spf13/viper"
+)
+
+// the apptainer processes of this gorun process, to stop them when their run is deleted
+var apptainerRuns sync.Map
+
+// stopApptainerRun kills the apptainer process of the run, if it is running
+func stopApptainerRun(runID int64) {
+	if cancel, ok := apptainerRuns.Load(runID); ok {
+		cancel.(context.CancelFunc)()
+	}
+}
+
+// runApptainerAttempt executes the run with apptainer instead of the Docker daemon. The
+// image is converted to a SIF on first use. Apptainer runs have no container the watchdog
+// could inspect, so run.max_runtime is enforced by the attempt itself.
+func runApptainerAttempt(ctx context.Context, opt RunToolOptions, updateDB func(RunStatus, ErrorKind, error)) error {
+	tool := &opt.Tool
+	env, err := apptainerEnvironment(ctx)
+	if err != nil {
+		updateDB(StatusErrored, ErrorInfrastructure, err)
+		return err
+	}
+	recordExecutionEnvironment(ctx, opt, env)
+	if tool.Options.ScratchGB > 0 {
+		if scratchPath, ok := tool.Mounts[files.ScratchContainerPath]; ok {
+			// the scratch space is not part of the results and is removed after the run
+			defer os.RemoveAll(scratchPath)
+		}
+	}
+
+	sif, err := apptainer.Pull(ctx, tool.Image)
+	if err != nil {
+		updateDB(StatusErrored, ErrorInfrastructure, err)
+		return err
+	}
+	execOpts, runMode, err := newApptainerExec(ctx, tool, opt.Cmd, sif)
+	if err != nil {
+		updateDB(StatusErrored, specErrorKind(err), err)
+		return err
+	}
+	execOpts.Env = mergeEnv(execOpts.Env, opt.Env)
+	recordExecutionStrategy(ctx, opt, runMode)
+	fmt.Printf("running tool %v with the SIF %v\n", tool.Name, sif)
+
+	execCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	maxRuntime := viper.GetDuration("run.max_runtime")
+	if maxRuntime > 0 {
+		var stop context.CancelFunc
+		execCtx, stop = context.WithTimeout(execCtx, maxRuntime)
+		defer stop()
+	}
+	apptainerRuns.Store(opt.Tool.ID, cancel)
+	defer apptainerRuns.Delete(opt.Tool.ID)
+
+	if usesPrepare(tool, runMode) {
+		preparedAt := time.Now()
+		result, err := prepareApptainer(execCtx, opt, execOpts)
+		if err := finishPrepare(ctx, opt, result, err, time.Since(preparedAt), updateDB); err != nil {
+			return err
+		}
+	}
+
+	outDir := tool.Mounts["/out"]
+	updateDB(StatusRunning, "", nil)
+	startedAt := time.Now()
+	toolEvents := startToolEvents(ctx, opt.DB, opt.Tool.ID, outDir)
+	defer toolEvents.Stop()
+	var exitCode int64
+	err = captureLogs(ctx, opt, outDir, func(stdout io.Writer, stderr io.Writer) error {
+		execOpts.Stdout, execOpts.Stderr = stdout, stderr
+		var execErr error
+		exitCode, execErr = apptainer.Exec(execCtx, execOpts)
+		return execErr
+	})
+	finishedAt := time.Now()
+	toolEvents.Stop()
+	if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+		err = fmt.Errorf("the run exceeded the maximum runtime of %s", maxRuntime)
+		RecordRunEvent(ctx, opt.DB, opt.Tool.ID, EventRuntimeExceeded, err.Error())
+		updateDB(StatusErrored, ErrorTimeout, err)
+		return err
+	}
+	if errors.Is(err, context.Canceled) && ctx.Err() == nil {
+		err = fmt.Errorf("the apptainer process was stopped")
+		updateDB(StatusErrored, ErrorCancelled, err)
+		return err
+	}
+	if err != nil {
+		updateDB(StatusErrored, waitErrorKind(err), err)
+		return err
+	}
+	recordExitCode(ctx, opt, exitCode, finishedAt.Sub(startedAt))
+	return completeAttempt(ctx, opt, nil, "", env, runMode, outDir, startedAt, finishedAt, exitCode, updateDB)
+}
+
+// newApptainerExec binds the mounts of the run and picks the command like newContainerSpec.
+// Without a command, the runscript of the SIF starts the entrypoint and CMD of the image.
+// The entry file is always looked up unless run.spec_entry is never, as the default command
+// of the image is not known to the SIF.
+func newApptainerExec(ctx context.Context, tool *Tool, cmd []string, sif string) (apptainer.ExecOptions, string, error) {
+	execOpts := apptainer.ExecOptions{SIF: sif}
+	for containerPath, hostPath := range tool.Mounts {
+		execOpts.Binds = append(execOpts.Binds, apptainer.Bind{
+			Source: hostPath,
+			Target: containerPath,
+			// datasets mounted from the host are never writable by the tool
+			ReadOnly: strings.HasPrefix(containerPath, "/in/"),
+		})
+	}
+	for _, extra := range tool.Options.ExtraMounts {
+		execOpts.Binds = append(execOpts.Binds, apptainer.Bind{
+			Source:   extra.HostPath,
+			Target:   extra.ContainerPath,
+			ReadOnly: extra.ReadOnly,
+		})
+	}
+	sort.Slice(execOpts.Binds, func(i, j int) bool { return execOpts.Binds[i].Target < execOpts.Binds[j].Target })
+	if tool.Options.ParamEnv {
+		execOpts.Env = paramEnv(tool)
+	}
+
+	override := tool.Options.CommandOverride
+	switch {
+	case len(cmd) != 0:
+		execOpts.Command = cmd
+		return execOpts, StrategyOverride, nil
+	case override != nil:
+		execOpts.Command = append(append([]string{}, override.Entrypoint...), override.Cmd...)
+		return execOpts, StrategyOverride, nil
+	}
+	gotap, gotapFound, err := toolImage.ProbeApptainerGotapTemplate(ctx, sif)
+	if err != nil {
+		return apptainer.ExecOptions{}, "", err
+	}
+	switch {
+	case gotapFound:
+		args := gotap.RenderRunArgs(tool.Name)
+		if len(args) == 0 {
+			if args, err = gotapRunArgs(tool.Name, toolImage.ProbeApptainerGotapCapabilities(ctx, sif, gotap.Name)); err != nil {
+				return apptainer.ExecOptions{}, "", err
+			}
+		}
+		execOpts.Command = append([]string{gotap.Name}, args...)
+		return execOpts, StrategyGotap, nil
+	case len(tool.Options.SpecCommand) != 0:
+		execOpts.Command = tool.Options.SpecCommand
+		return execOpts, StrategySpecCommand, nil
+	}
+	if viper.GetString("run.spec_entry") != SpecEntryNever {
+		if entry, found := toolImage.FindApptainerEntryFile(ctx, sif); found {
+			execOpts.Command = entry.Command()
+			execOpts.WorkDir = "/src"
+			return execOpts, StrategySpecEntry, nil
+		}
+	}
+	return execOpts, StrategyImageDefault, nil
+}
+
+// apptainerEnvironment is the fingerprint of the local host, as there is no daemon to ask
+func apptainerEnvironment(ctx context.Context) (*ExecutionEnvironment, error) {
+	engineVersion, err := apptainer.Version(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("apptainer is not available: %w", err)
+	}
+	return &ExecutionEnvironment{
+		GorunVersion:    version.Version,
+		Engine:          "Apptainer",
+		EngineVersion:   engineVersion,
+		OperatingSystem: runtime.GOOS,
+		Architecture:    runtime.GOARCH,
+		CPUModel:        readCPUModel(),
+		CPUs:            runtime.NumCPU(),
+		GPUs:            readGPUs(),
+	}, nil
+}
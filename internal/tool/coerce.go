@@ -0,0 +1,91 @@
+package tool
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	toolspec "github.com/hydrocode-de/tool-spec-go"
+)
+
+// Coercion notes a parameter that was converted to the type declared by the spec
+type Coercion struct {
+	Parameter string `json:"parameter"`
+	Message   string `json:"message"`
+}
+
+// coerceParameters converts unambiguous values to the types of the spec, like "42" for an
+// integer, "true" for a boolean or a single value for an array. Lossy conversions, e.g. of
+// "1.5" to an integer, are not applied and left to the validation.
+func coerceParameters(spec toolspec.ToolSpec, parameters map[string]interface{}) (map[string]interface{}, []Coercion) {
+	coerced := make(map[string]interface{}, len(parameters))
+	notes := make([]Coercion, 0)
+	for name, value := range parameters {
+		paramSpec, ok := spec.Parameters[name]
+		if !ok || value == nil {
+			coerced[name] = value
+			continue
+		}
+
+		if paramSpec.IsArray {
+			values, isArray := value.([]interface{})
+			if !isArray {
+				values = []interface{}{value}
+				notes = append(notes, Coercion{Parameter: name, Message: "wrapped the single value into an array"})
+			}
+			elements := make([]interface{}, 0, len(values))
+			for i, element := range values {
+				converted, message := coerceValue(paramSpec, element)
+				if message != "" {
+					notes = append(notes, Coercion{Parameter: fmt.Sprintf("%s[%d]", name, i), Message: message})
+				}
+				elements = append(elements, converted)
+			}
+			coerced[name] = elements
+			continue
+		}
+
+		converted, message := coerceValue(paramSpec, value)
+		if message != "" {
+			notes = append(notes, Coercion{Parameter: name, Message: message})
+		}
+		coerced[name] = converted
+	}
+	sort.Slice(notes, func(i, j int) bool { return notes[i].Parameter < notes[j].Parameter })
+	return coerced, notes
+}
+
+// coerceValue returns the converted value and what was done, or the value itself and an empty message
+func coerceValue(spec toolspec.ParameterSpec, value interface{}) (interface{}, string) {
+	text, ok := value.(string)
+	if !ok {
+		return value, ""
+	}
+	trimmed := strings.TrimSpace(text)
+
+	switch spec.ToolType {
+	case "integer":
+		if number, err := strconv.ParseInt(trimmed, 10, 64); err == nil {
+			return float64(number), fmt.Sprintf("converted the string %q to the integer %d", text, number)
+		}
+	case "float":
+		if number, err := strconv.ParseFloat(trimmed, 64); err == nil && !math.IsInf(number, 0) && !math.IsNaN(number) {
+			return number, fmt.Sprintf("converted the string %q to the float %v", text, number)
+		}
+	case "boolean":
+		switch strings.ToLower(trimmed) {
+		case "true":
+			return true, fmt.Sprintf("converted the string %q to true", text)
+		case "false":
+			return false, fmt.Sprintf("converted the string %q to false", text)
+		}
+	case "enum":
+		// only trim, the value has to match one of the allowed values exactly
+		if trimmed != text {
+			return trimmed, fmt.Sprintf("trimmed the whitespace around %q", text)
+		}
+	}
+	return value, ""
+}
@@ -0,0 +1,51 @@
+package tool
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hydrocode-de/gorun/internal/db"
+	"github.com/hydrocode-de/tool-spec-go/validate"
+	"github.com/spf13/viper"
+)
+
+// CommandOverride replaces the entrypoint and the CMD of the image for a single run.
+// It takes precedence over gotap and the command of the tool spec.
+type CommandOverride struct {
+	Entrypoint []string `json:"entrypoint,omitempty"`
+	Cmd        []string `json:"cmd,omitempty"`
+}
+
+func (o CommandOverride) String() string {
+	return fmt.Sprintf("entrypoint=%q cmd=%q", o.Entrypoint, o.Cmd)
+}
+
+// checkCommandOverride only lets admins override the command, unless
+// run.allow_user_command_override is set
+func checkCommandOverride(ctx context.Context, DB *db.Queries, override *CommandOverride, userID string) error {
+	if override == nil {
+		return nil
+	}
+	if !viper.GetBool("run.allow_user_command_override") {
+		user, err := DB.GetUserByID(ctx, userID)
+		if err != nil || !user.IsAdmin {
+			return fmt.Errorf("only admins may override the command of a run: %w", ErrForbidden)
+		}
+	}
+	return nil
+}
+
+// validateCommandOverride rejects overrides which would not change anything
+func validateCommandOverride(override *CommandOverride) error {
+	if override == nil || len(override.Entrypoint) != 0 || len(override.Cmd) != 0 {
+		return nil
+	}
+	return &validate.ValidationError{
+		Field:    "command_override",
+		Name:     "command_override",
+		Type:     validate.NotAllowed,
+		Expected: "an entrypoint or a cmd",
+		Actual:   "{}",
+		Message:  "the command_override has to set the entrypoint, the cmd or both",
+	}
+}
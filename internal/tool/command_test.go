@@ -0,0 +1,136 @@
+package tool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/hydrocode-de/gorun/internal/dockertest"
+	"github.com/spf13/viper"
+)
+
+// the container of a run is started with an explicit override before gotap, gotap before
+// the command of the spec, and the command of the spec before the defaults of the image
+func TestContainerCommandPrecedence(t *testing.T) {
+	setTestConfig(t)
+	viper.Set("run.interactive_commands", []string{"bash", "python"})
+	daemon := dockertest.New(t)
+	override := &CommandOverride{Entrypoint: []string{"/bin/sh", "-c"}, Cmd: []string{"echo override"}}
+	specCommand := []string{"python", "/src/main.py"}
+
+	tests := []struct {
+		name  string
+		image dockertest.Image
+		// cmd is passed to the run by the caller, like the CLI does
+		cmd            []string
+		override       *CommandOverride
+		specCommand    []string
+		mode           string
+		wantEntrypoint []string
+		wantCmd        []string
+	}{
+		{
+			name:        "explicit cmd over everything",
+			image:       dockertest.Image{Commands: gotapCommands},
+			cmd:         []string{"/run.sh", "--debug"},
+			override:    override,
+			specCommand: specCommand,
+			mode:        StrategyOverride,
+			wantCmd:     []string{"/run.sh", "--debug"},
+		},
+		{
+			name:           "override over gotap",
+			image:          dockertest.Image{Commands: gotapCommands},
+			override:       override,
+			specCommand:    specCommand,
+			mode:           StrategyOverride,
+			wantEntrypoint: override.Entrypoint,
+			wantCmd:        override.Cmd,
+		},
+		{
+			name:           "gotap over the spec command",
+			image:          dockertest.Image{Commands: gotapCommands},
+			specCommand:    specCommand,
+			mode:           StrategyGotap,
+			wantEntrypoint: []string{"gotap"},
+			wantCmd:        []string{"run", testTool, "--input-file", "/in/inputs.json", "--spec-file", "/src/tool.yml", "--output-folder", "/out"},
+		},
+		{
+			name:        "spec command over the entry file",
+			image:       dockertest.Image{Cmd: []string{"bash"}, Files: map[string]string{"/src/run.py": "print('hi')"}},
+			specCommand: specCommand,
+			mode:        StrategySpecCommand,
+			wantCmd:     specCommand,
+		},
+		{
+			name:           "entry file of an image without a command",
+			image:          dockertest.Image{Cmd: []string{"bash"}, Files: map[string]string{"/src/run.py": "print('hi')"}},
+			mode:           StrategySpecEntry,
+			wantEntrypoint: []string{"python"},
+			wantCmd:        []string{"/src/run.py"},
+		},
+		{
+			name:  "image default",
+			image: dockertest.Image{Entrypoint: []string{"/run.sh"}},
+			mode:  StrategyImageDefault,
+		},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.image.RepoTags = []string{fmt.Sprintf("gorun-precedence-%d:1.0", i)}
+			daemon.AddImage(tt.image)
+			run := &Tool{
+				Name:  testTool,
+				Image: tt.image.RepoTags[0],
+				Options: RunOptions{
+					CommandOverride: tt.override,
+					SpecCommand:     tt.specCommand,
+				},
+			}
+			spec, err := newContainerSpec(context.Background(), daemon.Client(), run, tt.cmd)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if spec.Mode != tt.mode {
+				t.Errorf("the container is started as %s, want %s", spec.Mode, tt.mode)
+			}
+			if !slices.Equal(spec.Config.Entrypoint, tt.wantEntrypoint) || !slices.Equal(spec.Config.Cmd, tt.wantCmd) {
+				t.Errorf("the container runs %q %q, want %q %q", spec.Config.Entrypoint, spec.Config.Cmd, tt.wantEntrypoint, tt.wantCmd)
+			}
+		})
+	}
+}
+
+// only admins may override the command, unless users are allowed to, and the override is
+// recorded with the run
+func TestCommandOverrideAdminsOnly(t *testing.T) {
+	setTestConfig(t)
+	DB := newTestDB(t)
+	ctx := context.Background()
+	override := &CommandOverride{Cmd: []string{"/run.sh", "--debug"}}
+
+	if err := checkCommandOverride(ctx, DB, override, testUser); !errors.Is(err, ErrForbidden) {
+		t.Errorf("the override of a user returned %v, want ErrForbidden", err)
+	}
+	if err := checkCommandOverride(ctx, DB, override, testAdmin); err != nil {
+		t.Errorf("the override of an admin returned %v", err)
+	}
+	if err := checkCommandOverride(ctx, DB, nil, testUser); err != nil {
+		t.Errorf("a run without override returned %v", err)
+	}
+	viper.Set("run.allow_user_command_override", true)
+	if err := checkCommandOverride(ctx, DB, override, testUser); err != nil {
+		t.Errorf("the allowed override of a user returned %v", err)
+	}
+	if err := validateCommandOverride(&CommandOverride{}); err == nil {
+		t.Errorf("an empty override was accepted")
+	}
+
+	addTestImage(dockertest.New(t), writeMessage)
+	run := createTestRun(t, DB, CreateRunOptions{CommandOverride: override})
+	if run.Options.CommandOverride == nil || !slices.Equal(run.Options.CommandOverride.Cmd, override.Cmd) {
+		t.Errorf("the run records the override %+v", run.Options.CommandOverride)
+	}
+}
@@ -2,17 +2,19 @@ package tool
 
 import (
 	"context"
+	"database/sql"
 	"encoding/json"
 	"fmt"
+	"log"
 	"os"
 	"path"
 	"path/filepath"
+	"strings"
 
 	"github.com/hydrocode-de/gorun/internal/db"
 	"github.com/hydrocode-de/gorun/internal/files"
 	"github.com/hydrocode-de/gorun/internal/helper"
-	"github.com/hydrocode-de/gorun/internal/toolImage"
-	toolspec "github.com/hydrocode-de/tool-spec-go"
+	"github.com/hydrocode-de/gorun/internal/outputs"
 	"github.com/spf13/viper"
 )
 
@@ -20,71 +22,407 @@ type CreateRunOptions struct {
 	Name       string
 	Image      string
 	Parameters map[string]interface{}
-	Datasets   map[string]string
+	Datasets   map[string]DatasetRef
+	ScratchGB  int
+	DataMode   string
+	RunAsRoot  bool
+	Hardening  *HardeningOverride
+	MaxRetries int
+	// Platform is set if the image has to be emulated on the host
+	Platform string
+	Notify   *bool
+	// DefaultedParameters are filled from the defaults of the spec during validation
+	DefaultedParameters []string
+	// ExpandedDatasets lists the files the glob patterns of the datasets matched
+	ExpandedDatasets map[string]DatasetExpansion
+	// DOIDatasets lists the files of deposits the datasets referenced by DOI
+	DOIDatasets map[string][]DOIFile
+	// InlineDatasets lists the files the datasets gave with their content
+	InlineDatasets map[string][]InlineFile
+	// CoercedParameters were converted to the types of the spec during validation
+	CoercedParameters []Coercion
+	// Outputs are the outputs the spec of the tool declares
+	Outputs map[string]outputs.Spec
+	// CommandOverride replaces the entrypoint and cmd of the image, only admins may set it
+	CommandOverride *CommandOverride
+	// SpecCommand is the command the spec of the tool declares
+	SpecCommand []string
+	// Runtime is docker, apptainer or ssh, the server default run.runtime if empty
+	Runtime string
+	// UsePrepare overrides run.use_prepare for this run
+	UsePrepare *bool
+	// ProjectID is the project the run is created in, zero for the personal project
+	ProjectID int64
+	// Priority is low, normal or high, only admins may set high
+	Priority string
+	// MaxOutputBytes limits the size of /out, up to run.max_output_bytes
+	MaxOutputBytes int64
+	// ParamEnv overrides the param_env flag of the spec for this run
+	ParamEnv *bool
 }
 
-func CreateToolRun(ctx context.Context, mountStrategy string, opts CreateRunOptions, user_id string) (db.Run, error) {
-	DB := viper.Get("db").(*db.Queries)
-	mountPath := viper.GetString("mount_path")
+const (
+	DataModeCopy  = "copy"
+	DataModeMount = "mount"
+)
+
+// InputManifest records where the datasets of a run originally came from
+type InputManifest struct {
+	Tool     string                   `json:"tool"`
+	DataMode string                   `json:"data_mode"`
+	Datasets map[string]DatasetSource `json:"datasets"`
+	// DefaultedParameters were omitted by the caller and taken from the spec
+	DefaultedParameters []string `json:"defaulted_parameters,omitempty"`
+}
+
+// DatasetSource is a staged dataset. Datasets of multiple files are staged into the
+// directory ContainerPath and list their Files.
+type DatasetSource struct {
+	Source        string          `json:"source,omitempty"`
+	ContainerPath string          `json:"container_path"`
+	Files         []DatasetSource `json:"files,omitempty"`
+	// DOI and Checksum are set for files fetched from a deposit
+	DOI      string `json:"doi,omitempty"`
+	Checksum string `json:"checksum,omitempty"`
+	// Inline files were given with their content and are always copied
+	Inline bool `json:"inline,omitempty"`
+}
+
+// ResolveDataMode falls back to the server default and enforces copy mode
+// whenever host mounts are disallowed.
+func ResolveDataMode(requested string) (string, error) {
+	disallowMounts := viper.GetBool("security.disallow_host_mounts")
+	mode := requested
+	if mode == "" {
+		mode = viper.GetString("data_mode")
+		if disallowMounts {
+			mode = DataModeCopy
+		}
+	}
+
+	switch mode {
+	case DataModeCopy:
+		return mode, nil
+	case DataModeMount:
+		if disallowMounts {
+			return "", fmt.Errorf("mounting host paths into runs is disabled on this server, use data_mode 'copy'")
+		}
+		return mode, nil
+	default:
+		return "", fmt.Errorf("invalid data_mode %s. Has to be one of 'copy' or 'mount'", mode)
+	}
+}
+
+func CreateToolRun(ctx context.Context, DB *db.Queries, opts CreateRunOptions, user_id string) (db.Run, error) {
+	// uploaded datasets must not be cleaned from the temp path while they are staged
+	var dataPaths []string
+	for _, ref := range opts.Datasets {
+		dataPaths = append(dataPaths, ref.Paths...)
+	}
+	defer files.HoldTemp(dataPaths...)()
 
-	spec, err := toolImage.ReadToolSpec(ctx, opts.Image)
+	runtime, err := ResolveRuntime(opts.Runtime)
 	if err != nil {
 		return db.Run{}, err
 	}
-	toolSpec, err := spec.GetTool(opts.Name)
+	spec, compat, err := readImageSpec(ctx, runtime, opts.Image)
 	if err != nil {
 		return db.Run{}, err
 	}
-
-	mounts := files.CreateNewMountPaths(mountPath, mountStrategy)
-	datasets := make(map[string]string)
-
-	for dataName, dataPath := range opts.Datasets {
-		containerPath := path.Join(mounts["/in"], filepath.Base(dataPath))
-		err := helper.CopyFile(dataPath, containerPath)
-		if err != nil {
-			return db.Run{}, err
-		}
-		datasets[dataName] = path.Join("/in", filepath.Base(dataPath))
+	if !compat.IsSupported() {
+		return db.Run{}, fmt.Errorf("the tool-spec of image %s is not supported by gorun: %s", opts.Image, strings.Join(compat.Reasons, "; "))
+	}
+	toolSpec, err := spec.GetTool(opts.Name)
+	if err != nil {
+		return db.Run{}, err
 	}
 
-	// create the input file
-	inputJSON, err := json.MarshalIndent(toolspec.InputFile{
-		opts.Name: toolspec.ToolInput{
-			Parameters: opts.Parameters,
-			Datasets:   datasets,
-		},
-	}, "", "\t")
+	runOptions, err := newRunOptions(opts)
 	if err != nil {
 		return db.Run{}, err
 	}
-	err = os.WriteFile(path.Join(mounts["/in"], "inputs.json"), inputJSON, 0644)
+	projectID, err := resolveProject(ctx, DB, opts.ProjectID, user_id)
 	if err != nil {
 		return db.Run{}, err
 	}
-
-	// marshal the other stuff
 	parJSON, parErr := json.Marshal(opts.Parameters)
-	dataJSON, dataErr := json.Marshal(datasets)
-	mountJSON, mountErr := json.Marshal(mounts)
-	if dataErr != nil || mountErr != nil || parErr != nil {
-		return db.Run{}, fmt.Errorf("failed to marshal parameters and mount points")
+	optJSON, optErr := json.Marshal(runOptions)
+	if parErr != nil || optErr != nil {
+		return db.Run{}, fmt.Errorf("failed to marshal parameters and options")
 	}
 
-	// create the database entry
+	// create the database entry first, the directory of the run is named after its ID
 	runData, err := DB.CreateRun(ctx, db.CreateRunParams{
 		Name:        opts.Name,
 		Title:       toolSpec.Title,
 		Description: toolSpec.Description,
 		DockerImage: opts.Image,
 		Parameters:  string(parJSON),
-		Data:        string(dataJSON),
-		Mounts:      string(mountJSON),
+		Data:        "{}",
+		Mounts:      "{}",
+		Options:     string(optJSON),
 		UserID:      user_id,
+		ProjectID:   sql.NullInt64{Int64: projectID, Valid: true},
 	})
 	if err != nil {
 		return db.Run{}, err
 	}
+	var layout writtenLayout
+	runDir, err := files.RunDir(viper.GetString("files.run_dir_template"), viper.GetString("mount_path"), runData.ID, user_id, opts.Name)
+	if err == nil {
+		// the directory is recorded, the template may change while the run exists
+		err = DB.SetRunDir(ctx, db.SetRunDirParams{RunDir: sql.NullString{String: runDir, Valid: true}, ID: runData.ID})
+	}
+	if err == nil {
+		runData.RunDir = sql.NullString{String: runDir, Valid: true}
+		layout, err = writeRunLayout(ctx, DB, runData.ID, opts, runOptions, runDir)
+	}
+	if err != nil {
+		// without its directory the run cannot be started, so it is discarded again
+		if rmErr := os.RemoveAll(runDir); rmErr != nil {
+			log.Printf("failed to remove the directory of the discarded run %d: %v", runData.ID, rmErr)
+		}
+		if delErr := DB.DeleteRun(ctx, db.DeleteRunParams{ID: runData.ID, UserID: user_id}); delErr != nil {
+			log.Printf("failed to discard run %d: %v", runData.ID, delErr)
+		}
+		return db.Run{}, err
+	}
+	runData.Data, runData.Mounts = layout.data, layout.mounts
+	// the inputs in the /in mount may be purged, the recorded copy stays with the run
+	err = DB.CreateRunInputs(ctx, db.CreateRunInputsParams{RunID: runData.ID, Content: string(layout.inputs)})
+	if err != nil {
+		log.Printf("failed to record the inputs of run %d: %v", runData.ID, err)
+	}
 
 	return runData, nil
 }
+
+// writtenLayout is the recorded layout of a run whose mounts were written
+type writtenLayout struct {
+	data   string
+	mounts string
+	inputs []byte
+}
+
+// writeRunLayout creates the mounts of the run in runDir, stages the inputs and records the mounts
+func writeRunLayout(ctx context.Context, DB *db.Queries, runID int64, opts CreateRunOptions, runOptions RunOptions, runDir string) (writtenLayout, error) {
+	layout, err := newRunLayout(opts, runOptions, files.CreateNewMountPaths(path.Dir(runDir), path.Base(runDir)))
+	if err != nil {
+		return writtenLayout{}, err
+	}
+	if err := layout.write(); err != nil {
+		return writtenLayout{}, err
+	}
+
+	dataJSON, dataErr := json.Marshal(layout.Datasets)
+	mountJSON, mountErr := json.Marshal(layout.Mounts)
+	if dataErr != nil || mountErr != nil {
+		return writtenLayout{}, fmt.Errorf("failed to marshal the datasets and mount points")
+	}
+	err = DB.SetRunLayout(ctx, db.SetRunLayoutParams{
+		Data:   string(dataJSON),
+		Mounts: string(mountJSON),
+		ID:     runID,
+	})
+	if err != nil {
+		return writtenLayout{}, err
+	}
+	return writtenLayout{data: string(dataJSON), mounts: string(mountJSON), inputs: layout.Inputs}, nil
+}
+
+// newRunOptions checks the requested resources against the server limits
+func newRunOptions(opts CreateRunOptions) (RunOptions, error) {
+	extraMounts, err := files.ExtraMountsFromConfig()
+	if err != nil {
+		return RunOptions{}, err
+	}
+	maxScratch := viper.GetInt("max_scratch_gb")
+	if opts.ScratchGB < 0 || (maxScratch > 0 && opts.ScratchGB > maxScratch) {
+		return RunOptions{}, fmt.Errorf("the requested scratch space of %dGB is not within the allowed range of 0 to %dGB", opts.ScratchGB, maxScratch)
+	}
+	maxRetries := viper.GetInt("run.max_retries")
+	if opts.MaxRetries < 0 || opts.MaxRetries > maxRetries {
+		return RunOptions{}, fmt.Errorf("max_retries has to be within 0 and %d, got %d", maxRetries, opts.MaxRetries)
+	}
+	maxOutput := viper.GetInt64("run.max_output_bytes")
+	if opts.MaxOutputBytes < 0 || (maxOutput > 0 && opts.MaxOutputBytes > maxOutput) {
+		return RunOptions{}, fmt.Errorf("max_output_bytes has to be within 0 and %d, got %d", maxOutput, opts.MaxOutputBytes)
+	}
+	runOptions := RunOptions{
+		ExtraMounts:         extraMounts,
+		ScratchGB:           opts.ScratchGB,
+		MaxRetries:          opts.MaxRetries,
+		RunAsRoot:           opts.RunAsRoot,
+		Hardening:           HardeningFromConfig().WithOverride(opts.Hardening),
+		Platform:            opts.Platform,
+		Emulated:            opts.Platform != "",
+		Notify:              opts.Notify,
+		DefaultedParameters: opts.DefaultedParameters,
+		CoercedParameters:   opts.CoercedParameters,
+		ExpandedDatasets:    opts.ExpandedDatasets,
+		DOIDatasets:         opts.DOIDatasets,
+		InlineDatasets:      opts.InlineDatasets,
+		Outputs:             opts.Outputs,
+		CommandOverride:     opts.CommandOverride,
+		SpecCommand:         opts.SpecCommand,
+		UsePrepare:          viper.GetBool("run.use_prepare"),
+		MaxOutputBytes:      maxOutput,
+	}
+	if opts.MaxOutputBytes > 0 {
+		runOptions.MaxOutputBytes = opts.MaxOutputBytes
+	}
+	priority, err := ParsePriority(opts.Priority)
+	if err != nil {
+		return RunOptions{}, err
+	}
+	runOptions.Priority = string(priority)
+	if opts.UsePrepare != nil {
+		runOptions.UsePrepare = *opts.UsePrepare
+	}
+	runOptions.ParamEnv = opts.ParamEnv != nil && *opts.ParamEnv
+	if !opts.RunAsRoot {
+		runOptions.User = viper.GetString("run.user")
+		if runOptions.User == "" {
+			runOptions.User = files.DefaultRunUser()
+		}
+	}
+
+	dataMode, err := ResolveDataMode(opts.DataMode)
+	if err != nil {
+		return RunOptions{}, err
+	}
+	runOptions.DataMode = dataMode
+	runtime, err := ResolveRuntime(opts.Runtime)
+	if err != nil {
+		return RunOptions{}, err
+	}
+	runOptions.Runtime = runtime
+	if opts.ScratchGB > 0 {
+		runOptions.ScratchMode = viper.GetString("scratch_mode")
+		if runOptions.ScratchMode != "tmpfs" {
+			runOptions.ScratchMode = "host"
+		}
+	}
+	return runOptions, nil
+}
+
+// runLayout is the file system layout of a new run, before anything is written
+type runLayout struct {
+	Options  RunOptions
+	Mounts   map[string]string
+	Datasets map[string]DatasetRef
+	Manifest InputManifest
+	// Inputs is the content of the generated inputs.json
+	Inputs []byte
+}
+
+func newRunLayout(opts CreateRunOptions, runOptions RunOptions, mounts map[string]string) (runLayout, error) {
+	if runOptions.ScratchMode == "host" {
+		mounts[files.ScratchContainerPath] = files.ScratchPath(mounts)
+	}
+
+	datasets := make(map[string]DatasetRef)
+	manifest := InputManifest{
+		Tool:                opts.Name,
+		DataMode:            runOptions.DataMode,
+		Datasets:            make(map[string]DatasetSource),
+		DefaultedParameters: opts.DefaultedParameters,
+	}
+	for dataName, ref := range opts.Datasets {
+		// single files are staged into /in, multiple files into a directory per dataset
+		dataDir := "/in"
+		if ref.List {
+			dataDir = path.Join("/in", dataName)
+		}
+		staged := DatasetRef{List: ref.List}
+		files := make([]DatasetSource, 0, len(ref.Paths))
+		for _, dataPath := range ref.Paths {
+			containerPath := path.Join(dataDir, ref.stagedName(dataPath))
+			inline, isInline := inlineFile(opts.InlineDatasets[dataName], dataPath)
+			if runOptions.DataMode == DataModeMount && !isInline {
+				sourcePath, err := filepath.Abs(dataPath)
+				if err != nil {
+					return runLayout{}, err
+				}
+				mounts[containerPath] = sourcePath
+			}
+			staged.Paths = append(staged.Paths, containerPath)
+			source := DatasetSource{Source: dataPath, ContainerPath: containerPath}
+			if origin, ok := doiFile(opts.DOIDatasets[dataName], dataPath); ok {
+				source.DOI, source.Checksum = origin.DOI, origin.Checksum
+			}
+			if isInline {
+				source.Checksum, source.Inline = inline.Checksum, true
+			}
+			files = append(files, source)
+		}
+		datasets[dataName] = staged
+		if ref.List {
+			manifest.Datasets[dataName] = DatasetSource{ContainerPath: dataDir, Files: files}
+		} else if len(files) == 1 {
+			manifest.Datasets[dataName] = files[0]
+		}
+	}
+
+	// create the input file
+	inputJSON, err := json.MarshalIndent(map[string]toolInput{
+		opts.Name: {
+			Parameters: opts.Parameters,
+			Datasets:   datasets,
+		},
+	}, "", "\t")
+	if err != nil {
+		return runLayout{}, err
+	}
+
+	return runLayout{
+		Options:  runOptions,
+		Mounts:   mounts,
+		Datasets: datasets,
+		Manifest: manifest,
+		Inputs:   inputJSON,
+	}, nil
+}
+
+// write creates the scratch space, copies the datasets and writes the manifest and inputs.json
+func (l runLayout) write() error {
+	if scratchPath, ok := l.Mounts[files.ScratchContainerPath]; ok {
+		if err := os.MkdirAll(scratchPath, 0755); err != nil {
+			return err
+		}
+	}
+	for _, dataset := range l.Manifest.Datasets {
+		files := []DatasetSource{dataset}
+		if dataset.Files != nil {
+			files = dataset.Files
+		}
+		for _, file := range files {
+			// inline files are in temp_path only, which is cleaned
+			if l.Options.DataMode != DataModeCopy && !file.Inline {
+				continue
+			}
+			// expanded patterns keep the directories below the root of the pattern
+			if err := os.MkdirAll(path.Dir(l.hostPath(file.ContainerPath)), 0755); err != nil {
+				return err
+			}
+			if err := helper.CopyPath(file.Source, l.hostPath(file.ContainerPath)); err != nil {
+				return err
+			}
+		}
+	}
+
+	manifestJSON, err := json.MarshalIndent(l.Manifest, "", "\t")
+	if err != nil {
+		return err
+	}
+	err = os.WriteFile(path.Join(l.Mounts["/in"], "_manifest.json"), manifestJSON, 0644)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path.Join(l.Mounts["/in"], "inputs.json"), l.Inputs, 0644)
+}
+
+// hostPath returns the path on the host of a path in the /in mount
+func (l runLayout) hostPath(containerPath string) string {
+	return path.Join(l.Mounts["/in"], strings.TrimPrefix(containerPath, "/in"))
+}
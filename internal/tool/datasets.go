@@ -0,0 +1,99 @@
+package tool
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+)
+
+// DatasetRef is the path of a dataset, or the paths of a dataset of multiple files.
+// It is read from a JSON string or a list of strings and written back the same way.
+// Small files may be given with their content instead of a path, see InlineData.
+type DatasetRef struct {
+	Paths []string
+	// List is set if the dataset was given as list, even if it holds a single file
+	List bool
+	// root is set for expanded glob patterns, whose files keep their paths relative to it
+	root string
+	// inline holds the files given with their content at the index of their entry in Paths,
+	// which is a placeholder until stageInlineDatasets wrote them
+	inline []*InlineData
+}
+
+// InlineData is a file given with its content in the payload of a run,
+// like {"content_base64": "...", "filename": "points.geojson"}
+type InlineData struct {
+	ContentBase64 string `json:"content_base64"`
+	Filename      string `json:"filename"`
+}
+
+// the placeholder of inline files in the paths of a dataset
+const inlinePrefix = "inline:"
+
+// SinglePath references a dataset of one file
+func SinglePath(path string) DatasetRef {
+	return DatasetRef{Paths: []string{path}}
+}
+
+func (d *DatasetRef) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*d = SinglePath(single)
+		return nil
+	}
+	var entries []json.RawMessage
+	list := json.Unmarshal(data, &entries) == nil
+	if !list {
+		entries = []json.RawMessage{data}
+	}
+
+	ref := DatasetRef{Paths: make([]string, 0, len(entries)), List: list}
+	for i, entry := range entries {
+		var dataPath string
+		if err := json.Unmarshal(entry, &dataPath); err == nil {
+			ref.Paths = append(ref.Paths, dataPath)
+			continue
+		}
+		var inline InlineData
+		if err := json.Unmarshal(entry, &inline); err != nil || inline.ContentBase64 == "" {
+			return fmt.Errorf("a dataset has to be a path, an object with content_base64 and filename or a list of them")
+		}
+		if ref.inline == nil {
+			ref.inline = make([]*InlineData, len(entries))
+		}
+		ref.inline[i] = &inline
+		ref.Paths = append(ref.Paths, inlinePrefix+inline.Filename)
+	}
+	*d = ref
+	return nil
+}
+
+func (d DatasetRef) MarshalJSON() ([]byte, error) {
+	entries := make([]interface{}, len(d.Paths))
+	for i, dataPath := range d.Paths {
+		entries[i] = dataPath
+		if i < len(d.inline) && d.inline[i] != nil {
+			entries[i] = d.inline[i]
+		}
+	}
+	if !d.List && len(entries) == 1 {
+		return json.Marshal(entries[0])
+	}
+	return json.Marshal(entries)
+}
+
+// stagedName returns the path of a file of the dataset relative to the directory it is staged in
+func (d DatasetRef) stagedName(dataPath string) string {
+	if d.root != "" {
+		if rel, err := filepath.Rel(d.root, dataPath); err == nil {
+			return filepath.ToSlash(rel)
+		}
+	}
+	return filepath.Base(dataPath)
+}
+
+// toolInput is the toolspec.ToolInput of inputs.json, with lists for datasets of multiple files
+type toolInput struct {
+	Parameters map[string]interface{} `json:"parameters"`
+	Datasets   map[string]DatasetRef  `json:"data"`
+}
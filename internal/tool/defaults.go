@@ -0,0 +1,49 @@
+package tool
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	toolspec "github.com/hydrocode-de/tool-spec-go"
+)
+
+// fillDefaults adds the defaults declared by the spec for all parameters the caller omitted
+// and returns the names of the defaulted parameters. A parameter explicitly set to null is
+// not omitted and keeps its null value.
+func fillDefaults(spec toolspec.ToolSpec, parameters map[string]interface{}) (map[string]interface{}, []string, error) {
+	filled := make(map[string]interface{}, len(parameters))
+	for name, value := range parameters {
+		filled[name] = value
+	}
+
+	defaulted := make([]string, 0)
+	for name, paramSpec := range spec.Parameters {
+		if _, ok := parameters[name]; ok || paramSpec.Default == nil {
+			continue
+		}
+		value, err := normalizeDefault(paramSpec.Default)
+		if err != nil {
+			return nil, nil, fmt.Errorf("the default of parameter %s is invalid: %w", name, err)
+		}
+		filled[name] = value
+		defaulted = append(defaulted, name)
+	}
+	sort.Strings(defaulted)
+	return filled, defaulted, nil
+}
+
+// normalizeDefault converts a default parsed from the YAML spec into the value a JSON
+// payload would carry, e.g. float64 for numbers and RFC 3339 strings for timestamps, so
+// that a defaulted parameter is validated just like one the caller passed.
+func normalizeDefault(value interface{}) (interface{}, error) {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	var normalized interface{}
+	if err := json.Unmarshal(raw, &normalized); err != nil {
+		return nil, err
+	}
+	return normalized, nil
+}
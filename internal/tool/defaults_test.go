@@ -0,0 +1,200 @@
+package tool
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/hydrocode-de/gorun/internal/cache"
+	"github.com/hydrocode-de/gorun/internal/dockertest"
+	toolspec "github.com/hydrocode-de/tool-spec-go"
+	"github.com/hydrocode-de/tool-spec-go/validate"
+)
+
+// defaultsSpec declares a default for every parameter type of the tool-spec
+const defaultsSpec = `tools:
+  defaults:
+    title: Defaults
+    description: Declares a default for every parameter type
+    parameters:
+      text:
+        type: string
+        default: hello
+      count:
+        type: integer
+        default: 3
+      ratio:
+        type: float
+        default: 0.5
+      verbose:
+        type: boolean
+        default: false
+      method:
+        type: enum
+        values: [mean, median]
+        default: median
+      asset:
+        type: asset
+        default: /in/lookup.csv
+      sizes:
+        type: integer
+        array: true
+        default: [1, 2]
+      when:
+        type: datetime
+        default: 2026-01-01T10:00:00Z
+      day:
+        type: date
+        default: 2026-01-01
+      required:
+        type: string
+`
+
+func loadDefaultsSpec(t *testing.T) toolspec.ToolSpec {
+	t.Helper()
+	specFile, err := toolspec.LoadToolSpec([]byte(defaultsSpec))
+	if err != nil {
+		t.Fatal(err)
+	}
+	spec, err := specFile.GetTool("defaults")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return spec
+}
+
+func TestFillDefaults(t *testing.T) {
+	spec := loadDefaultsSpec(t)
+	// the defaults carry the values a JSON payload would
+	want := map[string]interface{}{
+		"text":    "hello",
+		"count":   float64(3),
+		"ratio":   0.5,
+		"verbose": false,
+		"method":  "median",
+		"asset":   "/in/lookup.csv",
+		"sizes":   []interface{}{float64(1), float64(2)},
+		"when":    "2026-01-01T10:00:00Z",
+		"day":     "2026-01-01T00:00:00Z",
+	}
+	filled, defaulted, err := fillDefaults(spec, map[string]interface{}{"required": "set"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, value := range want {
+		if !reflect.DeepEqual(filled[name], value) {
+			t.Errorf("the default of %s is %#v, want %#v", name, filled[name], value)
+		}
+	}
+	wantNames := []string{"asset", "count", "day", "method", "ratio", "sizes", "text", "verbose", "when"}
+	if !slices.Equal(defaulted, wantNames) {
+		t.Errorf("the defaulted parameters are %v, want %v", defaulted, wantNames)
+	}
+
+	// a defaulted parameter validates like the same value passed by the caller
+	explicit := make(map[string]interface{}, len(filled))
+	for name, value := range filled {
+		explicit[name] = value
+	}
+	raw, _ := json.Marshal(explicit)
+	json.Unmarshal(raw, &explicit)
+	for name, paramSpec := range spec.Parameters {
+		paramSpec.Name = name
+		defaultErr := validate.ValidateParameter(paramSpec, filled[name])
+		explicitErr := validate.ValidateParameter(paramSpec, explicit[name])
+		if (defaultErr == nil) != (explicitErr == nil) {
+			t.Errorf("the default of %s validates with %v, the explicit value with %v", name, defaultErr, explicitErr)
+		}
+		if paramSpec.ToolType != "datetime" && paramSpec.ToolType != "date" && defaultErr != nil {
+			t.Errorf("the default of %s is invalid: %v", name, defaultErr)
+		}
+	}
+}
+
+// values passed by the caller are kept, explicit nulls included
+func TestFillDefaultsKeepsPassedValues(t *testing.T) {
+	spec := loadDefaultsSpec(t)
+	parameters := map[string]interface{}{"required": "set", "method": "mean", "count": nil, "verbose": true}
+	filled, defaulted, err := fillDefaults(spec, parameters)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filled["method"] != "mean" || filled["verbose"] != true {
+		t.Errorf("the passed values were replaced: %v", filled)
+	}
+	if value, ok := filled["count"]; !ok || value != nil {
+		t.Errorf("the explicit null of count became %#v", value)
+	}
+	for _, name := range []string{"method", "count", "verbose", "required"} {
+		if slices.Contains(defaulted, name) {
+			t.Errorf("the passed parameter %s is listed as defaulted", name)
+		}
+	}
+	if len(parameters) != 4 {
+		t.Errorf("the parameters of the caller were changed: %v", parameters)
+	}
+	// the explicit null of a required parameter still fails
+	if err := validate.ValidateParameter(toolspec.ParameterSpec{Name: "count", ToolType: "integer"}, filled["count"]); err == nil {
+		t.Errorf("the explicit null of count was valid")
+	}
+}
+
+// the defaulted parameters are written to inputs.json and recorded in the run and its manifest
+func TestDefaultsOfCreatedRun(t *testing.T) {
+	setTestConfig(t)
+	DB := newTestDB(t)
+	daemon := dockertest.New(t)
+	addTestImage(daemon, writeMessage)
+	specCache := &cache.Cache{}
+	specCache.Reset()
+
+	dir := t.TempDir()
+	input := filepath.Join(dir, "input.txt")
+	if err := os.WriteFile(input, []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	runData, err := ValidateAndCreateRun(context.Background(), DB, specCache, CreateRunOptions{
+		Image:      testImage,
+		Name:       testTool,
+		Parameters: map[string]interface{}{"message": "hi"},
+		Datasets:   map[string]DatasetRef{"input": {Paths: []string{input}}},
+	}, testUser)
+	if err != nil {
+		t.Fatal(err)
+	}
+	run, err := FromDBRun(runData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(run.Options.DefaultedParameters, []string{"count"}) {
+		t.Errorf("the run lists the defaulted parameters %v, want [count]", run.Options.DefaultedParameters)
+	}
+
+	var inputs map[string]struct {
+		Parameters map[string]interface{} `json:"parameters"`
+	}
+	readJSON(t, filepath.Join(run.Mounts["/in"], "inputs.json"), &inputs)
+	if parameters := inputs[testTool].Parameters; parameters["count"] != float64(1) || parameters["message"] != "hi" {
+		t.Errorf("inputs.json has the parameters %v", parameters)
+	}
+	var manifest InputManifest
+	readJSON(t, filepath.Join(run.Mounts["/in"], "_manifest.json"), &manifest)
+	if !slices.Equal(manifest.DefaultedParameters, []string{"count"}) {
+		t.Errorf("the manifest lists the defaulted parameters %v, want [count]", manifest.DefaultedParameters)
+	}
+}
+
+func readJSON(t *testing.T, path string, v interface{}) {
+	t.Helper()
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(raw, v); err != nil {
+		t.Fatalf("cannot read %s: %v", path, err)
+	}
+}
@@ -0,0 +1,310 @@
+package tool
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/client"
+	"github.com/hydrocode-de/gorun/internal/audit"
+	"github.com/hydrocode-de/gorun/internal/db"
+	"github.com/hydrocode-de/gorun/internal/dockerclient"
+	"github.com/spf13/viper"
+)
+
+// The steps of a run deletion, in the order they are done
+const (
+	DeleteStepContainer = "container"
+	DeleteStepMetadata  = "metadata"
+	DeleteStepFiles     = "files"
+	DeleteStepRun       = "run"
+)
+
+var deleteSteps = []string{DeleteStepContainer, DeleteStepMetadata, DeleteStepFiles, DeleteStepRun}
+
+// DeletionError tells which step of a run deletion failed. Deleting the run
+// again resumes at this step.
+type DeletionError struct {
+	RunID int64
+	Step  string
+	Err   error
+}
+
+func (e *DeletionError) Error() string {
+	return fmt.Sprintf("the deletion of run %d failed at the %s step and can be resumed: %v", e.RunID, e.Step, e.Err)
+}
+
+func (e *DeletionError) Unwrap() error {
+	return e.Err
+}
+
+// DeleteRun removes the container, the recorded metadata, the files and finally the run itself.
+// A running run is refused, unless force cancels it first. Each step is recorded, so that a
+// deletion which failed half way resumes at the failed step.
+func DeleteRun(ctx context.Context, DB *db.Queries, run Tool, userID string, force bool) error {
+	if RunStatus(run.Status) == StatusRunning && !force {
+		return fmt.Errorf("%w: cancel it or delete it with force", ErrRunActive)
+	}
+
+	start := 0
+	if deletion, err := DB.GetRunDeletion(ctx, run.ID); err == nil {
+		for i, step := range deleteSteps {
+			if step == deletion.Step {
+				start = i
+			}
+		}
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	for _, step := range deleteSteps[start:] {
+		if err := DB.SetRunDeletion(ctx, db.SetRunDeletionParams{RunID: run.ID, Step: step}); err != nil {
+			return err
+		}
+
+		var stepErr error
+		switch step {
+		case DeleteStepContainer:
+			stepErr = removeRunContainer(ctx, DB, run, userID)
+		case DeleteStepMetadata:
+			stepErr = deleteRunMetadata(ctx, DB, run.ID)
+		case DeleteStepFiles:
+			if runDir, ok := run.RunDir(); ok {
+				stepErr = removeAll(runDir)
+			}
+		case DeleteStepRun:
+			stepErr = DB.DeleteRun(ctx, db.DeleteRunParams{ID: run.ID, ID_2: userID, UserID: userID})
+		}
+
+		if stepErr != nil {
+			err := DB.SetRunDeletion(ctx, db.SetRunDeletionParams{RunID: run.ID, Step: step, Error: stepErr.Error()})
+			if err != nil {
+				log.Printf("failed to record the failed deletion of run %d: %v", run.ID, err)
+			}
+			return &DeletionError{RunID: run.ID, Step: step, Err: stepErr}
+		}
+	}
+	return DB.DeleteRunDeletion(ctx, run.ID)
+}
+
+// removeAll is replaced by the tests, which may run as root and so are never denied by a read-only directory
+var removeAll = os.RemoveAll
+
+// removeRunContainer cancels a running run, then stops and removes its container before the
+// files are removed. Runs without a persisted container ID are looked up by their label.
+// The containers of finished runs are normally removed already, so failing to remove them
+// is only logged.
+func removeRunContainer(ctx context.Context, DB *db.Queries, run Tool, userID string) error {
+	dbRun, err := DB.GetRun(ctx, db.GetRunParams{ID: run.ID, ID_2: userID, UserID: userID})
+	if err != nil {
+		return err
+	}
+	if RunStatus(dbRun.Status) == StatusQueued {
+		if err := cancelQueuedRun(ctx, DB, run.ID, "the run was cancelled to delete it"); err != nil {
+			return err
+		}
+	}
+	running := RunStatus(dbRun.Status) == StatusRunning
+	if running {
+		// mark the run first, so that RunTool does not classify the stopped container as tool failure
+		err := transitionRun(ctx, DB, run.ID, StatusCancelled, func() (int64, error) {
+			return DB.CancelRun(ctx, db.CancelRunParams{
+				ID:           run.ID,
+				ErrorMessage: sql.NullString{String: "the run was cancelled to delete it", Valid: true},
+			})
+		})
+		if err != nil && !errors.Is(err, ErrIllegalTransition) {
+			return err
+		}
+	}
+	hasContainer := dbRun.ContainerID.Valid && dbRun.ContainerID.String != ""
+	if status := RunStatus(dbRun.Status); !hasContainer && (status == StatusPending || status == StatusExpired) {
+		// runs which were never started have no container
+		return nil
+	}
+	runtime := runtimeOf(dbRun)
+	if runtime == RuntimeApptainer {
+		// apptainer runs have no container, their process is stopped instead
+		if running {
+			stopApptainerRun(run.ID)
+		}
+		return nil
+	}
+
+	c, err := RuntimeClient(runtime)
+	if err == nil {
+		containerIDs := []string{dbRun.ContainerID.String}
+		if !hasContainer {
+			containerIDs, err = labeledContainers(ctx, c, run.ID)
+		}
+		for _, containerID := range containerIDs {
+			if err = stopAndRemoveContainer(ctx, c, containerID, running); err != nil {
+				break
+			}
+		}
+	}
+	if err != nil && !client.IsErrNotFound(err) {
+		if running {
+			return err
+		}
+		log.Printf("failed to remove the container of run %d: %v", run.ID, err)
+	}
+	return nil
+}
+
+// cancelQueuedRun cancels the run and takes it out of the queue, so that it never starts. A
+// run which waits for the backoff of a retry is not in the queue, its next attempt is refused
+// as the run is cancelled.
+func cancelQueuedRun(ctx context.Context, DB *db.Queries, runID int64, message string) error {
+	err := transitionRun(ctx, DB, runID, StatusCancelled, func() (int64, error) {
+		return DB.CancelRun(ctx, db.CancelRunParams{ID: runID, ErrorMessage: sql.NullString{String: message, Valid: true}})
+	})
+	if err != nil && !errors.Is(err, ErrIllegalTransition) {
+		return err
+	}
+	// the run is cancelled first, so that its RunTool does not mark it errored when it is dequeued
+	runScheduler.dequeue(runID)
+	return nil
+}
+
+// stopAndRemoveContainer gives a running container 10 seconds to stop, then removes it.
+// Containers which are gone already are fine.
+func stopAndRemoveContainer(ctx context.Context, c *client.Client, containerID string, running bool) error {
+	if running {
+		timeout := 10
+		if err := c.ContainerStop(ctx, containerID, container.StopOptions{Timeout: &timeout}); err != nil && !client.IsErrNotFound(err) {
+			return err
+		}
+	}
+	err := c.ContainerRemove(ctx, containerID, container.RemoveOptions{Force: true})
+	if client.IsErrNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// labeledContainers lists the containers labeled with the run, including stopped ones
+func labeledContainers(ctx context.Context, c *client.Client, runID int64) ([]string, error) {
+	containers, err := c.ContainerList(ctx, container.ListOptions{
+		All:     true,
+		Filters: filters.NewArgs(filters.Arg("label", fmt.Sprintf("%s=%d", dockerclient.LabelRunID, runID))),
+	})
+	if err != nil {
+		return nil, err
+	}
+	containerIDs := make([]string, len(containers))
+	for i, cont := range containers {
+		containerIDs[i] = cont.ID
+	}
+	return containerIDs, nil
+}
+
+// deleteRunMetadata removes the rows recorded for the run, as SQLite does not enforce the cascades
+func deleteRunMetadata(ctx context.Context, DB *db.Queries, runID int64) error {
+	// the uploaded results are removed from the object storage before their rows
+	deleteObjects := func(ctx context.Context, runID int64) error {
+		return deleteStoredResults(ctx, DB, runID)
+	}
+	for _, deleteRows := range []func(context.Context, int64) error{
+		deleteObjects,
+		DB.DeleteRunEvents,
+		DB.DeleteRunStats,
+		DB.DeleteRunShares,
+		DB.DeleteRunInputs,
+		DB.DeleteRunOutputs,
+		DB.DeleteRunResultAnnotations,
+	} {
+		if err := deleteRows(ctx, runID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// TrashRun moves the run to the trash. It is hidden from the listings and its files are kept
+// for run.trash_retention, until PurgeTrashedRuns deletes it or RestoreRun brings it back.
+// Like DeleteRun, a running run is refused unless force cancels it first. A queued run is
+// cancelled, as a trashed run cannot be started.
+func TrashRun(ctx context.Context, DB *db.Queries, run Tool, userID string, force bool) error {
+	if run.DeletedAt != nil {
+		return nil
+	}
+	status := RunStatus(run.Status)
+	if current, err := DB.GetRunStatusByID(ctx, run.ID); err == nil {
+		status = RunStatus(current)
+	}
+	switch status {
+	case StatusRunning:
+		if !force {
+			return fmt.Errorf("%w: cancel it or delete it with force", ErrRunActive)
+		}
+		if err := removeRunContainer(ctx, DB, run, userID); err != nil {
+			return err
+		}
+	case StatusQueued:
+		if err := cancelQueuedRun(ctx, DB, run.ID, "the run was cancelled to move it to the trash"); err != nil {
+			return err
+		}
+	}
+	if _, err := DB.TrashRun(ctx, run.ID); err != nil {
+		return err
+	}
+	RecordRunEvent(ctx, DB, run.ID, EventTrashed, fmt.Sprintf("the run was moved to the trash, its files are removed after %s", viper.GetDuration("run.trash_retention")))
+	return nil
+}
+
+// RestoreRun takes the run out of the trash
+func RestoreRun(ctx context.Context, DB *db.Queries, run Tool) error {
+	restored, err := DB.RestoreRun(ctx, run.ID)
+	if err != nil {
+		return err
+	}
+	if restored == 0 {
+		return fmt.Errorf("the run %d cannot be restored: %w", run.ID, ErrNotTrashed)
+	}
+	RecordRunEvent(ctx, DB, run.ID, EventRestored, "the run was restored from the trash")
+	return nil
+}
+
+// PurgeTrashedRuns deletes the runs which were in the trash for longer than the retention.
+// The files are removed first and written to the audit log, as the events of the run are
+// deleted with it, then the run is deleted like DeleteRun.
+// The IDs of the deleted runs are returned.
+func PurgeTrashedRuns(ctx context.Context, DB *db.Queries, retention time.Duration) ([]int64, error) {
+	cutoff := time.Now().UTC().Add(-retention).Format(time.DateTime)
+	runs, err := DB.GetExpiredTrashedRuns(ctx, cutoff)
+	if err != nil {
+		return nil, err
+	}
+
+	purged := make([]int64, 0, len(runs))
+	var errs []error
+	for _, dbRun := range runs {
+		run, err := FromDBRun(dbRun)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("run %d: %w", dbRun.ID, err))
+			continue
+		}
+		if runDir, ok := run.RunDir(); ok {
+			if err := os.RemoveAll(runDir); err != nil {
+				errs = append(errs, fmt.Errorf("run %d: %w", run.ID, err))
+				continue
+			}
+			log.Printf("removed the directory %s of run %d, it was in the trash since %s", runDir, run.ID, run.DeletedAt.Format(time.RFC3339))
+		}
+		audit.Write(ctx, DB, audit.Entry{Action: audit.ActionRunPurge, Target: fmt.Sprintf("run:%d", run.ID)})
+		// the owner passes the checks of the deletion, the run is not running anymore
+		if err := DeleteRun(ctx, DB, run, dbRun.UserID, true); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		purged = append(purged, run.ID)
+	}
+	return purged, errors.Join(errs...)
+}
@@ -0,0 +1,312 @@
+package tool
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/hydrocode-de/gorun/internal/audit"
+	"github.com/hydrocode-de/gorun/internal/db"
+	"github.com/hydrocode-de/gorun/internal/dockerclient"
+	"github.com/hydrocode-de/gorun/internal/dockertest"
+	"github.com/spf13/viper"
+)
+
+func TestTrashRunCancelsQueuedRun(t *testing.T) {
+	ctx := context.Background()
+	DB := newTestDB(t)
+	daemon := dockertest.New(t)
+	addTestImage(daemon, writeMessage)
+	viper.Set("run.max_concurrent", 1)
+	// another run holds the only slot, so the run waits in the queue
+	release, err := runScheduler.acquire(ctx, 0, PriorityNormal, func() {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+
+	run := createTestRun(t, DB, CreateRunOptions{})
+	done := make(chan error, 1)
+	go func() { done <- RunTool(ctx, RunToolOptions{DB: DB, Tool: run, UserId: testUser}) }()
+	waitFor(t, func() bool {
+		_, waiting := QueuePosition(run.ID)
+		return waiting
+	})
+
+	if err := TrashRun(ctx, DB, run, testUser, false); err != nil {
+		t.Fatalf("TrashRun failed: %v", err)
+	}
+	select {
+	case err := <-done:
+		if !errors.Is(err, ErrDequeued) {
+			t.Errorf("RunTool returned %v, want %v", err, ErrDequeued)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the trashed run still waits in the queue")
+	}
+	if status := runStatus(t, DB, run.ID); status != StatusCancelled {
+		t.Errorf("the trashed run is %s, want %s", status, StatusCancelled)
+	}
+	if containers := runContainers(daemon); len(containers) != 0 {
+		t.Errorf("%d containers were created for the trashed run", len(containers))
+	}
+}
+
+func TestStartRunRefusesTrashedRuns(t *testing.T) {
+	ctx := context.Background()
+	DB := newTestDB(t)
+	runID := createTestRunRecord(t, DB)
+	if _, err := DB.TrashRun(ctx, runID); err != nil {
+		t.Fatal(err)
+	}
+	_, err := DB.StartRun(ctx, db.StartRunParams{ID: runID, ID_2: testUser, UserID: testUser})
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("StartRun of a trashed run returned %v, want %v", err, sql.ErrNoRows)
+	}
+}
+
+func TestPurgeTrashedRunsWritesAuditLog(t *testing.T) {
+	ctx := context.Background()
+	DB := newTestDB(t)
+	addTestImage(dockertest.New(t), writeMessage)
+	run := createTestRun(t, DB, CreateRunOptions{})
+	if _, err := DB.TrashRun(ctx, run.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	// a negative retention purges the runs trashed just now
+	purged, err := PurgeTrashedRuns(ctx, DB, -time.Hour)
+	if err != nil {
+		t.Fatalf("PurgeTrashedRuns failed: %v", err)
+	}
+	if len(purged) != 1 || purged[0] != run.ID {
+		t.Fatalf("the runs %v were purged, want %d", purged, run.ID)
+	}
+	entries, err := DB.GetAuditLog(ctx, db.GetAuditLogParams{
+		UserID:      "",
+		Action:      string(audit.ActionRunPurge),
+		WindowStart: time.Now().UTC().Add(-time.Hour).Format(time.DateTime),
+		WindowEnd:   time.Now().UTC().Add(time.Hour).Format(time.DateTime),
+		Limit:       10,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Target != fmt.Sprintf("run:%d", run.ID) {
+		t.Errorf("the purge wrote the audit entries %v", entries)
+	}
+}
+
+func TestDeleteRunRemovesTemplatedRunDir(t *testing.T) {
+	ctx := context.Background()
+	DB := newTestDB(t)
+	viper.Set("files.run_dir_template", "{mount_path}/{user_id}/{tool}/run-{run_id}")
+	addTestImage(dockertest.New(t), writeMessage)
+	run := createTestRun(t, DB, CreateRunOptions{})
+	other := createTestRun(t, DB, CreateRunOptions{})
+
+	runDir := filepath.Join(viper.GetString("mount_path"), testUser, testTool, fmt.Sprintf("run-%d", run.ID))
+	if dir, ok := run.RunDir(); !ok || dir != runDir {
+		t.Fatalf("the directory of the run is %q, want %q", dir, runDir)
+	}
+	// the mounts do not tell the directory, it follows from the template
+	run.Mounts["/in"] = filepath.Join(viper.GetString("mount_path"), "elsewhere", "in")
+
+	if err := DeleteRun(ctx, DB, run, testUser, false); err != nil {
+		t.Fatalf("DeleteRun failed: %v", err)
+	}
+	if _, err := os.Stat(runDir); !os.IsNotExist(err) {
+		t.Errorf("the directory of the run was not removed: %v", err)
+	}
+	otherDir, _ := other.RunDir()
+	if _, err := os.Stat(otherDir); err != nil {
+		t.Errorf("the directory of the other run was removed: %v", err)
+	}
+}
+
+// the directory is recorded with the run, a changed template still finds the older runs
+func TestDeleteRunAfterTemplateChange(t *testing.T) {
+	ctx := context.Background()
+	DB := newTestDB(t)
+	viper.Set("files.run_dir_template", "{mount_path}/{user_id}/run-{run_id}")
+	addTestImage(dockertest.New(t), writeMessage)
+	created := createTestRun(t, DB, CreateRunOptions{})
+	runDir := filepath.Join(viper.GetString("mount_path"), testUser, fmt.Sprintf("run-%d", created.ID))
+
+	viper.Set("files.run_dir_template", "{mount_path}/{tool}/{run_id}")
+	runData, err := GetRun(ctx, DB, created.ID, testUser)
+	if err != nil {
+		t.Fatal(err)
+	}
+	run, err := FromDBRun(runData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dir, ok := run.RunDir(); !ok || dir != runDir {
+		t.Fatalf("the directory of the run is %q after the template changed, want %q", dir, runDir)
+	}
+	if err := DeleteRun(ctx, DB, run, testUser, false); err != nil {
+		t.Fatalf("DeleteRun failed: %v", err)
+	}
+	if _, err := os.Stat(runDir); !os.IsNotExist(err) {
+		t.Errorf("the directory of the run was not removed: %v", err)
+	}
+}
+
+func TestRunDirNeedsTheOwner(t *testing.T) {
+	setTestConfig(t)
+	viper.Set("files.run_dir_template", "{mount_path}/{user_id}/run-{run_id}")
+	if dir, ok := (&Tool{ID: 1, Name: testTool}).RunDir(); ok {
+		t.Errorf("a run without owner has the directory %s", dir)
+	}
+}
+
+// denyReadOnlyRemoval makes removing a file from a read-only directory fail, also for root
+func denyReadOnlyRemoval(t *testing.T) {
+	t.Helper()
+	t.Cleanup(func() { removeAll = os.RemoveAll })
+	removeAll = func(dir string) error {
+		err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if info, err := d.Info(); err == nil && d.IsDir() && info.Mode().Perm()&0200 == 0 {
+				return &fs.PathError{Op: "unlinkat", Path: p, Err: syscall.EACCES}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		return os.RemoveAll(dir)
+	}
+}
+
+func TestDeleteRunResumesAfterPartialFailure(t *testing.T) {
+	ctx := context.Background()
+	DB := newTestDB(t)
+	denyReadOnlyRemoval(t)
+	addTestImage(dockertest.New(t), writeMessage)
+	run := createTestRun(t, DB, CreateRunOptions{})
+	RecordRunEvent(ctx, DB, run.ID, EventStatusChanged, "a recorded event")
+	runDir, _ := run.RunDir()
+	if err := os.Chmod(run.Mounts["/out"], 0555); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chmod(run.Mounts["/out"], 0755) })
+
+	err := DeleteRun(ctx, DB, run, testUser, false)
+	var deletionErr *DeletionError
+	if !errors.As(err, &deletionErr) || deletionErr.Step != DeleteStepFiles {
+		t.Fatalf("DeleteRun returned %v, want a failure of the %s step", err, DeleteStepFiles)
+	}
+	deletion, err := DB.GetRunDeletion(ctx, run.ID)
+	if err != nil || deletion.Step != DeleteStepFiles || deletion.Error == "" {
+		t.Fatalf("the deletion was recorded as %+v, %v, want the failed %s step", deletion, err, DeleteStepFiles)
+	}
+	if events := runEventTypes(t, DB, run.ID); len(events) != 0 {
+		t.Errorf("the metadata step left the events %v", events)
+	}
+	if _, err := DB.GetRunStatusByID(ctx, run.ID); err != nil {
+		t.Fatalf("the run is gone after the failed deletion: %v", err)
+	}
+
+	// once the directory may be removed, deleting again resumes at the failed step
+	if err := os.Chmod(run.Mounts["/out"], 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := DeleteRun(ctx, DB, run, testUser, false); err != nil {
+		t.Fatalf("the resumed deletion failed: %v", err)
+	}
+	if _, err := os.Stat(runDir); !os.IsNotExist(err) {
+		t.Errorf("the directory of the run was not removed: %v", err)
+	}
+	if _, err := DB.GetRunStatusByID(ctx, run.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("the run still exists after the resumed deletion: %v", err)
+	}
+	if _, err := DB.GetRunDeletion(ctx, run.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("the deletion is still recorded: %v", err)
+	}
+}
+
+// deleting a running run stops and removes its container before its files are removed. The
+// container is found by its persisted ID, or by its labels for runs which never recorded it.
+func TestDeleteRunningRun(t *testing.T) {
+	tests := []struct {
+		name string
+		// forgetID clears the persisted container ID, like for runs started before it was kept
+		forgetID bool
+		// unlabeled strips the gorun labels of the run from the container
+		unlabeled bool
+	}{
+		{name: "by the container ID"},
+		{name: "by the labels", forgetID: true},
+		{name: "without labels", unlabeled: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			DB := newTestDB(t)
+			daemon := dockertest.New(t)
+			addTestImage(daemon, func(c *dockertest.Container) dockertest.Result {
+				if tt.unlabeled {
+					delete(c.Config.Labels, dockerclient.LabelRunID)
+					delete(c.Config.Labels, dockerclient.LabelUserID)
+				}
+				return dockertest.Result{Hang: true}
+			})
+			run := createTestRun(t, DB, CreateRunOptions{})
+			done := make(chan error, 1)
+			go func() { done <- RunTool(ctx, RunToolOptions{DB: DB, Tool: run, UserId: testUser}) }()
+			waitFor(t, func() bool { return len(daemon.Running()) == 1 && runStatus(t, DB, run.ID) == StatusRunning })
+			cont := daemon.Running()[0]
+			if !tt.unlabeled {
+				if id, user := cont.Config.Labels[dockerclient.LabelRunID], cont.Config.Labels[dockerclient.LabelUserID]; id != fmt.Sprint(run.ID) || user != testUser {
+					t.Errorf("the container is labeled with the run %q of %q, want %d of %s", id, user, run.ID, testUser)
+				}
+			}
+			if tt.forgetID {
+				if err := DB.SetRunContainerID(ctx, db.SetRunContainerIDParams{ID: run.ID}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			// the API deletes the run as it reads it, which is running by now
+			run.Status = string(StatusRunning)
+			if err := DeleteRun(ctx, DB, run, testUser, false); !errors.Is(err, ErrRunActive) {
+				t.Fatalf("deleting the running run without force returned %v, want %v", err, ErrRunActive)
+			}
+			// the files of the run are only removed once its container is gone
+			runningAtRemoval := -1
+			t.Cleanup(func() { removeAll = os.RemoveAll })
+			removeAll = func(dir string) error {
+				runningAtRemoval = len(daemon.Running())
+				return os.RemoveAll(dir)
+			}
+			if err := DeleteRun(ctx, DB, run, testUser, true); err != nil {
+				t.Fatalf("DeleteRun failed: %v", err)
+			}
+			if !daemon.Removed(cont.ID) {
+				t.Error("the container of the deleted run was not removed")
+			}
+			if runningAtRemoval != 0 {
+				t.Errorf("%d containers were running when the files were removed", runningAtRemoval)
+			}
+			if _, err := DB.GetRunStatusByID(ctx, run.ID); !errors.Is(err, sql.ErrNoRows) {
+				t.Errorf("the run is left after the deletion: %v", err)
+			}
+			select {
+			case <-done:
+			case <-time.After(5 * time.Second):
+				t.Fatal("RunTool still waits for the removed container")
+			}
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package tool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/hydrocode-de/gorun/internal/doi"
+	"github.com/hydrocode-de/tool-spec-go/validate"
+	"github.com/spf13/viper"
+)
+
+// DOIFile records the file of a deposit a dataset referenced by its DOI
+type DOIFile struct {
+	DOI      string `json:"doi"`
+	File     string `json:"file"`
+	Checksum string `json:"checksum"`
+	Size     int64  `json:"size"`
+	// Path is the downloaded file in datasets.cache_path, which the run is staged from
+	Path string `json:"path"`
+}
+
+// fetchDOIDatasets replaces the files given as doi:<doi>#<file> by their downloads in
+// datasets.cache_path. The downloads are cached by checksum, so a file is only fetched
+// once. References which cannot be resolved, or do not select a single file of the
+// deposit, are kept and reported.
+func fetchDOIDatasets(ctx context.Context, datasets map[string]DatasetRef) (map[string]DatasetRef, map[string][]DOIFile, []error) {
+	fetched := make(map[string]DatasetRef, len(datasets))
+	origins := make(map[string][]DOIFile)
+	errs := make([]error, 0)
+	client := doi.ClientFromConfig()
+	deposits := make(map[string]doi.Deposit)
+	maxSize := viper.GetInt64("max_upload_size")
+
+	for name, ref := range datasets {
+		fetched[name] = ref
+		hasReference := false
+		for _, dataPath := range ref.Paths {
+			hasReference = hasReference || doi.IsReference(dataPath)
+		}
+		if !hasReference {
+			continue
+		}
+
+		paths := make([]string, len(ref.Paths))
+		copy(paths, ref.Paths)
+		for i, dataPath := range ref.Paths {
+			if !doi.IsReference(dataPath) {
+				continue
+			}
+			dataErr := func(errType validate.ErrorType, expected string, message string) {
+				errs = append(errs, &validate.ValidationError{
+					Field:    validate.Data,
+					Name:     name,
+					Type:     errType,
+					Expected: expected,
+					Actual:   dataPath,
+					Message:  message,
+				})
+			}
+
+			reference, err := doi.ParseReference(dataPath)
+			if err != nil {
+				dataErr(validate.WrongType, "doi:<doi>#<file>", fmt.Sprintf("the data %s is invalid: %v", name, err))
+				continue
+			}
+			deposit, ok := deposits[reference.DOI]
+			if !ok {
+				deposit, err = client.Resolve(ctx, reference.DOI)
+				switch {
+				case errors.Is(err, doi.ErrUnsupported):
+					dataErr(validate.NotAllowed, "the DOI of a Zenodo deposit", fmt.Sprintf("the data %s cannot be fetched: %v", name, err))
+					continue
+				case err != nil:
+					dataErr(DataNotFound, "a resolvable DOI", fmt.Sprintf("the data %s cannot be fetched: %v", name, err))
+					continue
+				}
+				deposits[reference.DOI] = deposit
+			}
+			file, err := deposit.Select(reference.File)
+			if err != nil {
+				if reference.File == "" {
+					dataErr(validate.NotAllowed, "a single file of the deposit", fmt.Sprintf("the data %s is ambiguous: %v", name, err))
+				} else {
+					dataErr(DataNotFound, "a file of the deposit", fmt.Sprintf("the data %s cannot be fetched: %v", name, err))
+				}
+				continue
+			}
+			if maxSize > 0 && file.Size > maxSize {
+				dataErr(validate.OutOfRange, fmt.Sprintf("<= %d bytes", maxSize), fmt.Sprintf("the file %s of data %s has %d bytes, which exceeds the maximum size for fetched datasets", file.Key, name, file.Size))
+				continue
+			}
+			localPath, err := cachedDOIFile(ctx, client, file)
+			if err != nil {
+				dataErr(DataNotReadable, "a downloadable file", fmt.Sprintf("the file %s of data %s could not be fetched: %v", file.Key, name, err))
+				continue
+			}
+			paths[i] = localPath
+			origins[name] = append(origins[name], DOIFile{
+				DOI:      deposit.DOI,
+				File:     file.Key,
+				Checksum: file.Checksum,
+				Size:     file.Size,
+				Path:     localPath,
+			})
+		}
+		fetched[name] = DatasetRef{Paths: paths, List: ref.List, root: ref.root}
+	}
+	return fetched, origins, errs
+}
+
+// cachedDOIFile returns the download of the file, which is kept as
+// <datasets.cache_path>/<algorithm>/<checksum>/<name> and fetched if it is missing.
+// A download of the same content under another name is linked instead.
+func cachedDOIFile(ctx context.Context, client *doi.Client, file doi.File) (string, error) {
+	algorithm, checksum, ok := strings.Cut(file.Checksum, ":")
+	if !ok || checksum == "" || strings.ContainsAny(algorithm+checksum, `/\.`) {
+		return "", fmt.Errorf("the repository lists no usable checksum for %s", file.Key)
+	}
+	name := path.Base(file.Key)
+	if name == "." || name == "/" || name == ".." {
+		return "", fmt.Errorf("the file name %s cannot be staged", file.Key)
+	}
+	localPath := filepath.Join(viper.GetString("datasets.cache_path"), strings.ToLower(algorithm), strings.ToLower(checksum), name)
+	if info, err := os.Stat(localPath); err == nil && (file.Size <= 0 || info.Size() == file.Size) {
+		return localPath, nil
+	}
+	entries, _ := os.ReadDir(filepath.Dir(localPath))
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		if info, err := entry.Info(); err == nil && (file.Size <= 0 || info.Size() == file.Size) {
+			if os.Link(filepath.Join(filepath.Dir(localPath), entry.Name()), localPath) == nil {
+				return localPath, nil
+			}
+		}
+	}
+	if err := client.Download(ctx, file, localPath); err != nil {
+		return "", err
+	}
+	return localPath, nil
+}
+
+// doiFile returns the origin of a fetched file of a dataset
+func doiFile(origins []DOIFile, localPath string) (DOIFile, bool) {
+	for _, origin := range origins {
+		if origin.Path == localPath {
+			return origin, true
+		}
+	}
+	return DOIFile{}, false
+}
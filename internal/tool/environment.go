@@ -0,0 +1,125 @@
+package tool
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/docker/docker/client"
+	"github.com/hydrocode-de/gorun/version"
+)
+
+// ExecutionEnvironment is the fingerprint of the host a run was executed on
+type ExecutionEnvironment struct {
+	GorunVersion    string   `json:"gorun_version"`
+	Engine          string   `json:"engine,omitempty"`
+	EngineVersion   string   `json:"engine_version,omitempty"`
+	StorageDriver   string   `json:"storage_driver,omitempty"`
+	OperatingSystem string   `json:"operating_system,omitempty"`
+	KernelVersion   string   `json:"kernel_version,omitempty"`
+	Architecture    string   `json:"architecture,omitempty"`
+	CPUModel        string   `json:"cpu_model,omitempty"`
+	CPUs            int      `json:"cpus,omitempty"`
+	MemoryBytes     int64    `json:"memory_bytes,omitempty"`
+	GPUs            []string `json:"gpus,omitempty"`
+}
+
+// the fingerprint is gathered once per process and reset when the daemon connection failed
+var (
+	environmentMu     sync.Mutex
+	cachedEnvironment *ExecutionEnvironment
+)
+
+// hostEnvironment returns the cached fingerprint of the host, gathering it on first use
+func hostEnvironment(ctx context.Context, c *client.Client) (*ExecutionEnvironment, error) {
+	environmentMu.Lock()
+	defer environmentMu.Unlock()
+	if cachedEnvironment != nil {
+		return cachedEnvironment, nil
+	}
+
+	env, err := daemonEnvironment(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	env.CPUModel = readCPUModel()
+	env.GPUs = readGPUs()
+
+	cachedEnvironment = env
+	return env, nil
+}
+
+// daemonEnvironment is the fingerprint the daemon reports, without the CPU model and
+// the GPUs, which are only read from the local host
+func daemonEnvironment(ctx context.Context, c *client.Client) (*ExecutionEnvironment, error) {
+	info, err := c.Info(ctx)
+	if err != nil {
+		return nil, err
+	}
+	env := &ExecutionEnvironment{
+		GorunVersion:    version.Version,
+		Engine:          "Docker",
+		EngineVersion:   info.ServerVersion,
+		StorageDriver:   info.Driver,
+		OperatingSystem: info.OperatingSystem,
+		KernelVersion:   info.KernelVersion,
+		Architecture:    info.Architecture,
+		CPUs:            info.NCPU,
+		MemoryBytes:     info.MemTotal,
+	}
+	if serverVersion, err := c.ServerVersion(ctx); err == nil && serverVersion.Platform.Name != "" {
+		// Podman reports itself as Podman Engine through the Docker API
+		env.Engine = serverVersion.Platform.Name
+	}
+	return env, nil
+}
+
+// invalidateEnvironment makes the next run gather the fingerprint again, e.g. after the daemon restarted
+func invalidateEnvironment() {
+	environmentMu.Lock()
+	defer environmentMu.Unlock()
+	cachedEnvironment = nil
+}
+
+// readCPUModel reads the CPU model of the local host, as the daemon does not report it
+func readCPUModel() string {
+	file, err := os.Open("/proc/cpuinfo")
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		key, value, found := strings.Cut(scanner.Text(), ":")
+		if found && strings.TrimSpace(key) == "model name" {
+			return strings.TrimSpace(value)
+		}
+	}
+	return ""
+}
+
+// readGPUs lists the NVIDIA GPUs known to the driver of the local host
+func readGPUs() []string {
+	infoFiles, _ := filepath.Glob("/proc/driver/nvidia/gpus/*/information")
+	gpus := make([]string, 0, len(infoFiles))
+	for _, infoFile := range infoFiles {
+		content, err := os.ReadFile(infoFile)
+		if err != nil {
+			continue
+		}
+		for _, line := range strings.Split(string(content), "\n") {
+			if key, value, found := strings.Cut(line, ":"); found && strings.TrimSpace(key) == "Model" {
+				gpus = append(gpus, strings.TrimSpace(value))
+				break
+			}
+		}
+	}
+	if len(gpus) == 0 {
+		return nil
+	}
+	return gpus
+}
@@ -0,0 +1,65 @@
+package tool
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrNotFound     = errors.New("not found")
+	ErrForbidden    = errors.New("forbidden")
+	ErrUnauthorized = errors.New("unauthorized")
+
+	ErrPreviewUnavailable = errors.New("preview is not available")
+	ErrNotTabular         = errors.New("the file is not a table")
+	ErrResultTooLarge     = errors.New("the result file is too large")
+	ErrRunActive          = errors.New("the run is still running")
+	ErrProjectNotEmpty    = errors.New("the project still has runs")
+	ErrNotTrashed         = errors.New("the run is not in the trash")
+	ErrRunExpired         = errors.New("the run expired")
+	ErrNotStartable       = errors.New("the run was started already")
+)
+
+// ValidationError collects all problems found in a run payload
+type ValidationError struct {
+	Message string
+	Errors  []error
+}
+
+func (e *ValidationError) Error() string {
+	return e.Message
+}
+
+// ToolNotFoundError is returned if the requested tool is not provided by the image.
+// AvailableTools lists the tools the image provides instead.
+type ToolNotFoundError struct {
+	Image          string   `json:"image"`
+	Tool           string   `json:"tool"`
+	AvailableTools []string `json:"available_tools"`
+	// Cause tells why the image could not be read, if it was not cached
+	Cause error `json:"-"`
+}
+
+func (e *ToolNotFoundError) Error() string {
+	if e.Cause != nil {
+		return fmt.Sprintf("the image %s is not available or does not contain a tool-spec: %v", e.Image, e.Cause)
+	}
+	return fmt.Sprintf("the tool %s was not found in the image %s. Available tools: %v", e.Tool, e.Image, e.AvailableTools)
+}
+
+func (e *ToolNotFoundError) Unwrap() error {
+	return ErrNotFound
+}
+
+func IsValidationError(err error) bool {
+	var validationErr *ValidationError
+	return errors.As(err, &validationErr)
+}
+
+func IsNotFound(err error) bool {
+	return errors.Is(err, ErrNotFound)
+}
+
+func IsUnauthorized(err error) bool {
+	return errors.Is(err, ErrUnauthorized)
+}
@@ -0,0 +1,74 @@
+package tool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// only the errors wrapping ErrNotFound are not found, whatever the message says
+func TestIsNotFound(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"missing run", fmt.Errorf("the run 1 was not found: %w", ErrNotFound), true},
+		{"missing tool", &ToolNotFoundError{Image: testImage, Tool: "ecoh"}, true},
+		{"docker network", errors.New("Error response from daemon: network gorun_default not found"), false},
+		{"docker image", errors.New("Error response from daemon: No such image: gorun-test:1.0"), false},
+		{"missing file", &fs.PathError{Op: "open", Path: "/data/not found.txt", Err: fs.ErrNotExist}, false},
+		{"the same text", fmt.Errorf("copy: %w", errors.New("not found")), false},
+		{"nil", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsNotFound(tt.err); got != tt.want {
+				t.Errorf("IsNotFound(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNotFoundAtTheSource(t *testing.T) {
+	setTestConfig(t)
+	DB := newTestDB(t)
+	ctx := context.Background()
+	runID := createTestRunRecord(t, DB)
+
+	if _, err := GetRun(ctx, DB, runID+1, testUser); !IsNotFound(err) {
+		t.Errorf("GetRun of a missing run returned %v", err)
+	}
+	if _, err := GetRun(ctx, DB, runID, "mallory"); !IsNotFound(err) {
+		t.Errorf("GetRun of the run of another user returned %v", err)
+	}
+	if _, err := GetVisibleRun(ctx, DB, runID+1, testUser); !IsNotFound(err) {
+		t.Errorf("GetVisibleRun of a missing run returned %v", err)
+	}
+
+	out := t.TempDir()
+	if err := os.WriteFile(filepath.Join(out, "blob.bin"), []byte{0, 1, 2, 3}, 0644); err != nil {
+		t.Fatal(err)
+	}
+	run := Tool{Name: testTool, Status: string(StatusFinished), Mounts: map[string]string{"/out": out}}
+	if _, err := run.WriteResultFile("missing.csv", io.Discard); !IsNotFound(err) {
+		t.Errorf("WriteResultFile of a missing result returned %v", err)
+	}
+	if _, _, err := run.OpenResultFile("missing.csv"); !IsNotFound(err) {
+		t.Errorf("OpenResultFile of a missing result returned %v", err)
+	}
+
+	// the errors which are not about a missing run or result are not classified as one
+	if _, err := run.PreviewResultFile("blob.bin"); !errors.Is(err, ErrPreviewUnavailable) || IsNotFound(err) {
+		t.Errorf("the preview of a binary file returned %v, want ErrPreviewUnavailable", err)
+	}
+	removed := Tool{Name: testTool, Status: string(StatusFinished), Mounts: map[string]string{"/out": filepath.Join(out, "removed")}}
+	if _, err := removed.ListResults(); err == nil || IsNotFound(err) {
+		t.Errorf("listing a removed results directory returned %v, want an internal error", err)
+	}
+}
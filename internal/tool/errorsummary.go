@@ -0,0 +1,158 @@
+package tool
+
+import (
+	"context"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hydrocode-de/gorun/internal/db"
+)
+
+const (
+	// the default window of the error summary
+	errorSummaryWindow = 24 * time.Hour
+	// the runs listed per group of errors
+	errorExampleRuns = 5
+	// normalized messages are cut to this many characters
+	maxNormalizedError = 200
+)
+
+// ErrorGroup are the errored runs of one kind with the same normalized error message
+type ErrorGroup struct {
+	Kind          ErrorKind `json:"kind"`
+	Message       string    `json:"message"`
+	Count         int64     `json:"count"`
+	FirstSeen     time.Time `json:"first_seen"`
+	LastSeen      time.Time `json:"last_seen"`
+	AffectedUsers int       `json:"affected_users"`
+	// ExampleRunIDs are the latest runs of the group
+	ExampleRunIDs []int64 `json:"example_run_ids"`
+}
+
+// ParseErrorWindow reads the bounds like ParseUsageWindow, without bounds the summary
+// covers the last 24 hours
+func ParseErrorWindow(from string, to string) (time.Time, time.Time, error) {
+	start, end, err := ParseUsageWindow(from, to)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	if from == "" {
+		start = end.Add(-errorSummaryWindow)
+	}
+	return start, end, nil
+}
+
+// ErrorSummary groups the runs which errored in [from, to) by their error kind and
+// normalized message, the largest groups first
+func ErrorSummary(ctx context.Context, DB *db.Queries, from time.Time, to time.Time) ([]ErrorGroup, error) {
+	rows, err := DB.GetRunErrors(ctx, db.GetRunErrorsParams{
+		WindowStart: from.UTC().Format(time.DateTime),
+		WindowEnd:   to.UTC().Format(time.DateTime),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	type groupKey struct {
+		kind    ErrorKind
+		message string
+	}
+	groups := make(map[groupKey]*ErrorGroup)
+	users := make(map[groupKey]map[string]bool)
+	for _, row := range rows {
+		key := groupKey{kind: ErrorKind(row.ErrorKind), message: NormalizeErrorMessage(row.ErrorMessage)}
+		group, ok := groups[key]
+		if !ok {
+			group = &ErrorGroup{Kind: key.kind, Message: key.message, FirstSeen: row.FinishedAt.Time}
+			groups[key] = group
+			users[key] = make(map[string]bool)
+		}
+		// the rows are ordered by the time the runs errored
+		group.Count++
+		group.LastSeen = row.FinishedAt.Time
+		group.ExampleRunIDs = append(group.ExampleRunIDs, row.ID)
+		if len(group.ExampleRunIDs) > errorExampleRuns {
+			group.ExampleRunIDs = group.ExampleRunIDs[1:]
+		}
+		users[key][row.UserID] = true
+	}
+
+	summary := make([]ErrorGroup, 0, len(groups))
+	for key, group := range groups {
+		group.AffectedUsers = len(users[key])
+		summary = append(summary, *group)
+	}
+	sort.Slice(summary, func(i, j int) bool {
+		if summary[i].Count != summary[j].Count {
+			return summary[i].Count > summary[j].Count
+		}
+		return summary[i].LastSeen.After(summary[j].LastSeen)
+	})
+	return summary, nil
+}
+
+// RecentErrorCounts counts the runs which errored within the last window by their kind,
+// from the same aggregation as ErrorSummary
+func RecentErrorCounts(ctx context.Context, DB *db.Queries, window time.Duration) (map[ErrorKind]int64, error) {
+	now := time.Now().UTC()
+	summary, err := ErrorSummary(ctx, DB, now.Add(-window), now.Add(time.Second))
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[ErrorKind]int64)
+	for _, group := range summary {
+		counts[group.Kind] += group.Count
+	}
+	return counts, nil
+}
+
+// the prefix runAttempt puts in front of the error of every errored run
+var runErrorPrefix = regexp.MustCompile(`^the execution of the tool \(.*?\) container \(.*?\) errored unexpectedly: `)
+
+// the common errors of the Docker daemon, which are reduced to their cause
+var knownErrors = []struct {
+	pattern *regexp.Regexp
+	message string
+}{
+	{regexp.MustCompile(`(?i)cannot connect to the docker daemon|is the docker daemon running|error during connect|dial unix .*docker\.sock`), "the docker daemon is unreachable"},
+	{regexp.MustCompile(`(?i)no such image`), "no such image"},
+	{regexp.MustCompile(`(?i)mounts? denied`), "mount denied"},
+	{regexp.MustCompile(`(?i)exceeded its memory limit`), "the container exceeded its memory limit"},
+	{regexp.MustCompile(`(?i)oom.?killed|out of memory|ran out of memory|exited with status 137\b`), "out of memory, the container was killed"},
+	{regexp.MustCompile(`(?i)no space left on device|disk of the /out folder is full`), "no space left on device"},
+}
+
+// the variable parts of error messages, in the order they are replaced
+var errorVariables = []struct {
+	pattern     *regexp.Regexp
+	replacement string
+}{
+	{regexp.MustCompile(`sha256:[0-9a-f]{12,64}`), "<digest>"},
+	{regexp.MustCompile(`[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}`), "<uuid>"},
+	{regexp.MustCompile(`\b[0-9a-f]{12,64}\b`), "<id>"},
+	{regexp.MustCompile(`(^|[\s"'(=:])/[^\s"'):,]*`), "$1<path>"},
+	{regexp.MustCompile(`\b\d+\b`), "<n>"},
+	{regexp.MustCompile(`\s+`), " "},
+}
+
+// NormalizeErrorMessage strips the IDs, paths and numbers from the error of a run, so that
+// the same failure of different runs has the same message. The common errors of the Docker
+// daemon, like an unreachable daemon, are reduced to their cause.
+func NormalizeErrorMessage(message string) string {
+	message = runErrorPrefix.ReplaceAllString(strings.TrimSpace(message), "")
+	for _, known := range knownErrors {
+		if known.pattern.MatchString(message) {
+			return known.message
+		}
+	}
+	for _, variable := range errorVariables {
+		message = variable.pattern.ReplaceAllString(message, variable.replacement)
+	}
+	message = strings.TrimSpace(message)
+	if runes := []rune(message); len(runes) > maxNormalizedError {
+		message = string(runes[:maxNormalizedError]) + "..."
+	}
+	return message
+}
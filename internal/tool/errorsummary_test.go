@@ -0,0 +1,74 @@
+package tool
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNormalizeErrorMessage(t *testing.T) {
+	const prefix = "the execution of the tool (echo) container (3f1c2a9b7d4e) errored unexpectedly: "
+	tests := []struct {
+		name    string
+		message string
+		want    string
+	}{
+		{
+			name:    "no such image",
+			message: prefix + "Error response from daemon: No such image: ghcr.io/org/tool:1.0",
+			want:    "no such image",
+		},
+		{
+			name:    "mount denied",
+			message: prefix + "Error response from daemon: Mounts denied: The path /data/run-12/in is not shared from the host and is not known to Docker.",
+			want:    "mount denied",
+		},
+		{
+			name:    "OOM killed without a limit",
+			message: oomKilledError(0).Error(),
+			want:    "out of memory, the container was killed",
+		},
+		{
+			name:    "OOM killed by the exit code",
+			message: prefix + "the container exited with status 137",
+			want:    "out of memory, the container was killed",
+		},
+		{
+			name:    "memory limit",
+			message: oomKilledError(512 << 20).Error(),
+			want:    "the container exceeded its memory limit",
+		},
+		{
+			name:    "daemon unreachable",
+			message: "Cannot connect to the Docker daemon at unix:///var/run/docker.sock. Is the docker daemon running?",
+			want:    "the docker daemon is unreachable",
+		},
+		{
+			name:    "daemon socket",
+			message: prefix + "dial unix /var/run/docker.sock: connect: permission denied",
+			want:    "the docker daemon is unreachable",
+		},
+		{
+			name:    "unmatched",
+			message: prefix + "failed to copy /home/alice/data/input-3.csv into sha256:0123456789abcdef0123 after 3  attempts",
+			want:    "failed to copy <path> into <digest> after <n> attempts",
+		},
+		{
+			name:    "unmatched with IDs",
+			message: "run 42 of container 3f1c2a9b7d4e5f60 failed: job 123e4567-e89b-12d3-a456-426614174000 timed out",
+			want:    "run <n> of container <id> failed: job <uuid> timed out",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NormalizeErrorMessage(tt.message); got != tt.want {
+				t.Errorf("NormalizeErrorMessage(%q) = %q, want %q", tt.message, got, tt.want)
+			}
+		})
+	}
+
+	// long messages are cut, so that they still group
+	long := NormalizeErrorMessage(strings.Repeat("x", 2*maxNormalizedError))
+	if len([]rune(long)) != maxNormalizedError+3 || !strings.HasSuffix(long, "...") {
+		t.Errorf("the long message is normalized to %d characters: %s", len(long), long)
+	}
+}
@@ -0,0 +1,126 @@
+package tool
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"time"
+
+	dockerevents "github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/client"
+	"github.com/hydrocode-de/gorun/internal/files"
+)
+
+const (
+	// an /out folder with less free space is considered full
+	diskFullBytes = 1024 * 1024
+	// the end of STDERR.log searched for the error of a full disk
+	diskFullLogBytes = 64 * 1024
+	// how long the daemon is asked for the OOM events of a container
+	oomEventsTimeout = 2 * time.Second
+)
+
+var diskFullMessage = []byte("no space left on device")
+
+// exitCause explains a non-zero exit of a container by the OOM killer or a full /out
+// folder. It returns an empty kind if neither applies, or nothing could be checked.
+func exitCause(ctx context.Context, c *client.Client, containerID string, outDir string, startedAt time.Time) (ErrorKind, error) {
+	if c != nil && containerID != "" {
+		if killed, limit := oomKilled(ctx, c, containerID, startedAt); killed {
+			return ErrorOOMKilled, oomKilledError(limit)
+		}
+	}
+	if outDir != "" {
+		if full, free := diskFull(outDir); full {
+			return ErrorDiskFull, diskFullError(free)
+		}
+	}
+	return "", nil
+}
+
+// oomKilled tells if the kernel killed the container for its memory. State.OOMKilled is
+// only set if the container itself was killed, an OOM event also covers its child processes.
+func oomKilled(ctx context.Context, c *client.Client, containerID string, startedAt time.Time) (bool, int64) {
+	info, err := c.ContainerInspect(ctx, containerID)
+	if err != nil {
+		return false, 0
+	}
+	var limit int64
+	if info.HostConfig != nil {
+		limit = info.HostConfig.Memory
+	}
+	if info.State != nil && info.State.OOMKilled {
+		return true, limit
+	}
+	return hasOOMEvent(ctx, c, containerID, startedAt), limit
+}
+
+func hasOOMEvent(ctx context.Context, c *client.Client, containerID string, startedAt time.Time) bool {
+	ctx, cancel := context.WithTimeout(ctx, oomEventsTimeout)
+	defer cancel()
+	messages, errs := c.Events(ctx, dockerevents.ListOptions{
+		Since:   startedAt.Format(time.RFC3339Nano),
+		Until:   time.Now().Format(time.RFC3339Nano),
+		Filters: filters.NewArgs(filters.Arg("container", containerID), filters.Arg("event", string(dockerevents.ActionOOM))),
+	})
+	select {
+	case <-messages:
+		return true
+	case <-errs:
+		// the stream ends with io.EOF once the events until now were sent
+		return false
+	}
+}
+
+// diskFull tells if the filesystem of the /out folder is (nearly) full, or the tool
+// reported a full disk on STDERR
+func diskFull(outDir string) (bool, uint64) {
+	free, err := files.FreeBytes(outDir)
+	if err == nil && free < diskFullBytes {
+		return true, free
+	}
+	logFile, err := os.Open(path.Join(outDir, "STDERR.log"))
+	if err != nil {
+		return false, free
+	}
+	defer logFile.Close()
+	if stat, err := logFile.Stat(); err == nil && stat.Size() > diskFullLogBytes {
+		logFile.Seek(stat.Size()-diskFullLogBytes, 0)
+	}
+	tail := make([]byte, diskFullLogBytes)
+	n, _ := logFile.Read(tail)
+	return bytes.Contains(bytes.ToLower(tail[:n]), diskFullMessage), free
+}
+
+func oomKilledError(limit int64) error {
+	if limit > 0 {
+		return fmt.Errorf("the container exceeded its memory limit of %s and was killed, retry with a higher memory limit or less data", formatMemory(limit))
+	}
+	return fmt.Errorf("the container ran out of memory and was killed, the host has no memory left for the tool. Retry with less data or ask an admin for a host with more memory")
+}
+
+func diskFullError(free uint64) error {
+	if free >= diskFullBytes {
+		// the space was freed again, or the tool wrote to another full filesystem
+		return fmt.Errorf("the tool ran out of disk space (no space left on device), %s are left in the /out folder now. Free space on the host or make the tool write less output", formatMemory(int64(free)))
+	}
+	return fmt.Errorf("the disk of the /out folder is full (%s left), free space on the host or make the tool write less output", formatMemory(int64(free)))
+}
+
+// formatMemory writes the bytes the way docker reads memory limits, like 2g or 512m
+func formatMemory(size int64) string {
+	units := []string{"b", "k", "m", "g", "t"}
+	unit := 0
+	value := float64(size)
+	for value >= 1024 && unit < len(units)-1 {
+		value /= 1024
+		unit++
+	}
+	if value == float64(int64(value)) {
+		return fmt.Sprintf("%d%s", int64(value), units[unit])
+	}
+	return fmt.Sprintf("%.1f%s", value, units[unit])
+}
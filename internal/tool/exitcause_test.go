@@ -0,0 +1,134 @@
+package tool
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/hydrocode-de/gorun/internal/dockertest"
+	"github.com/spf13/viper"
+)
+
+// runFailure runs the test image with the script and returns the kind and message of the
+// error of the run
+func runFailure(t *testing.T, run dockertest.Script) (ErrorKind, string) {
+	t.Helper()
+	DB := newTestDB(t)
+	daemon := dockertest.New(t)
+	addTestImage(daemon, run)
+	created := createTestRun(t, DB, CreateRunOptions{})
+	if err := RunTool(context.Background(), RunToolOptions{DB: DB, Tool: created, UserId: testUser}); err == nil {
+		t.Fatal("RunTool did not fail")
+	}
+	record, err := GetRun(context.Background(), DB, created.ID, testUser)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if RunStatus(record.Status) != StatusErrored {
+		t.Fatalf("the run is %s, want %s", record.Status, StatusErrored)
+	}
+	return ErrorKind(record.ErrorKind.String), record.ErrorMessage.String
+}
+
+func TestRunToolExitCauses(t *testing.T) {
+	tests := []struct {
+		name     string
+		run      dockertest.Script
+		wantKind ErrorKind
+		// wantMessage is part of the error of the run
+		wantMessage string
+	}{
+		{
+			name: "the container is OOM killed",
+			run: func(*dockertest.Container) dockertest.Result {
+				return dockertest.Result{ExitCode: 137, OOMKilled: true}
+			},
+			wantKind:    ErrorOOMKilled,
+			wantMessage: "ran out of memory and was killed",
+		},
+		{
+			name: "a child process is OOM killed",
+			run: func(*dockertest.Container) dockertest.Result {
+				return dockertest.Result{ExitCode: 1, OOMEvent: true, Stderr: "worker killed\n"}
+			},
+			wantKind:    ErrorOOMKilled,
+			wantMessage: "ran out of memory and was killed",
+		},
+		{
+			name: "the limit of the container is exceeded",
+			run: func(c *dockertest.Container) dockertest.Result {
+				// the daemon applies a memory limit to the container
+				c.HostConfig.Memory = 2 << 30
+				return dockertest.Result{ExitCode: 137, OOMKilled: true}
+			},
+			wantKind:    ErrorOOMKilled,
+			wantMessage: "exceeded its memory limit of 2g",
+		},
+		{
+			name: "the tool reports a full disk",
+			run: func(*dockertest.Container) dockertest.Result {
+				return dockertest.Result{ExitCode: 1, Stderr: "write /out/result.csv: No space left on device\n"}
+			},
+			wantKind:    ErrorDiskFull,
+			wantMessage: "ran out of disk space",
+		},
+		{
+			name: "the tool fails",
+			run: func(*dockertest.Container) dockertest.Result {
+				return dockertest.Result{ExitCode: 2, Stderr: "invalid input\n"}
+			},
+			wantKind:    ErrorToolFailure,
+			wantMessage: "exited with status 2",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setTestConfig(t)
+			kind, message := runFailure(t, tt.run)
+			if kind != tt.wantKind || !strings.Contains(message, tt.wantMessage) {
+				t.Errorf("the run errored as %s with %q, want %s with %q", kind, message, tt.wantKind, tt.wantMessage)
+			}
+		})
+	}
+}
+
+// a tool which fills the filesystem of /out fails as disk_full, even if it does not say so
+func TestRunToolDiskFull(t *testing.T) {
+	setTestConfig(t)
+	mounts := viper.GetString("mount_path")
+	if err := os.MkdirAll(mounts, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := syscall.Mount("tmpfs", mounts, "tmpfs", 0, "size=2m"); err != nil {
+		t.Skipf("cannot mount a tmpfs to fill: %v", err)
+	}
+	t.Cleanup(func() { syscall.Unmount(mounts, 0) })
+
+	kind, message := runFailure(t, func(c *dockertest.Container) dockertest.Result {
+		os.WriteFile(filepath.Join(c.HostPath("/out"), "result.bin"), make([]byte, 1536*1024), 0644)
+		return dockertest.Result{ExitCode: 1, Stderr: "cannot write the result\n", Duration: time.Millisecond}
+	})
+	if kind != ErrorDiskFull || !strings.Contains(message, "the disk of the /out folder is full") {
+		t.Errorf("the run errored as %s with %q, want %s", kind, message, ErrorDiskFull)
+	}
+}
+
+func TestFormatMemory(t *testing.T) {
+	tests := map[int64]string{
+		512:              "512b",
+		512 << 20:        "512m",
+		2 << 30:          "2g",
+		3 << 29:          "1.5g",
+		5 << 40:          "5t",
+		(1 << 30) + 1000: "1.0g",
+	}
+	for size, want := range tests {
+		if got := formatMemory(size); got != want {
+			t.Errorf("formatMemory(%d) = %s, want %s", size, got, want)
+		}
+	}
+}
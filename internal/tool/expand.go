@@ -0,0 +1,101 @@
+package tool
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/hydrocode-de/gorun/internal/doi"
+	"github.com/hydrocode-de/tool-spec-go/validate"
+	"github.com/spf13/viper"
+)
+
+// DatasetExpansion records the files a glob pattern of a dataset matched
+type DatasetExpansion struct {
+	Pattern string   `json:"pattern"`
+	Files   []string `json:"files"`
+}
+
+func isGlobPattern(dataPath string) bool {
+	return strings.ContainsAny(dataPath, "*?[")
+}
+
+// globRoot returns the directories of the pattern in front of the first wildcard.
+// The matches are staged relative to it.
+func globRoot(pattern string) string {
+	dir := filepath.Dir(pattern)
+	for isGlobPattern(dir) {
+		dir = filepath.Dir(dir)
+	}
+	return dir
+}
+
+// expandDatasets replaces datasets given as single glob pattern by the list of matched files.
+// Directories matched by the pattern are walked. The expansion is bounded by max_dataset_files.
+func expandDatasets(datasets map[string]DatasetRef) (map[string]DatasetRef, map[string]DatasetExpansion, []error) {
+	expanded := make(map[string]DatasetRef, len(datasets))
+	expansions := make(map[string]DatasetExpansion)
+	errs := make([]error, 0)
+	maxFiles := viper.GetInt("max_dataset_files")
+
+	for name, ref := range datasets {
+		if ref.List || len(ref.Paths) != 1 || !isGlobPattern(ref.Paths[0]) || doi.IsReference(ref.Paths[0]) {
+			expanded[name] = ref
+			continue
+		}
+		// patterns which cannot be expanded are kept, so the dataset is not reported as missing
+		expanded[name] = ref
+		pattern := ref.Paths[0]
+		dataErr := func(errType validate.ErrorType, expected string, message string) {
+			errs = append(errs, &validate.ValidationError{
+				Field:    validate.Data,
+				Name:     name,
+				Type:     errType,
+				Expected: expected,
+				Actual:   pattern,
+				Message:  message,
+			})
+		}
+
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			dataErr(validate.WrongType, "a valid glob pattern", fmt.Sprintf("the pattern %s of data %s is invalid: %v", pattern, name, err))
+			continue
+		}
+		files := make([]string, 0, len(matches))
+		for _, match := range matches {
+			err := filepath.WalkDir(match, func(filePath string, entry fs.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+				if entry.Type().IsRegular() {
+					files = append(files, filePath)
+				}
+				if maxFiles > 0 && len(files) > maxFiles {
+					return fs.SkipAll
+				}
+				return nil
+			})
+			if err != nil && !os.IsNotExist(err) {
+				dataErr(DataNotReadable, "readable files", fmt.Sprintf("the files matching %s of data %s are not readable: %v", pattern, name, err))
+				break
+			}
+		}
+
+		switch {
+		case len(files) == 0:
+			dataErr(DataNotFound, "at least one matching file", fmt.Sprintf("the pattern %s of data %s does not match any file", pattern, name))
+			continue
+		case maxFiles > 0 && len(files) > maxFiles:
+			dataErr(validate.OutOfRange, fmt.Sprintf("at most %d files", maxFiles), fmt.Sprintf("the pattern %s of data %s matches more than %d files", pattern, name, maxFiles))
+			continue
+		}
+		sort.Strings(files)
+		expanded[name] = DatasetRef{Paths: files, List: true, root: globRoot(pattern)}
+		expansions[name] = DatasetExpansion{Pattern: pattern, Files: files}
+	}
+	return expanded, expansions, errs
+}
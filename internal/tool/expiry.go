@@ -0,0 +1,105 @@
+package tool
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/hydrocode-de/gorun/internal/db"
+	"github.com/spf13/viper"
+)
+
+const (
+	// ExpiredInputsDelete removes the directory of an expired run, ExpiredInputsKeep leaves it
+	ExpiredInputsDelete = "delete"
+	ExpiredInputsKeep   = "keep"
+)
+
+// ExpirePendingRuns moves the runs which were not started within the ttl to expired.
+// Their directory, which holds the staged inputs, is removed unless run.expired_inputs
+// is keep. The IDs of the expired runs are returned.
+func ExpirePendingRuns(ctx context.Context, DB *db.Queries, ttl time.Duration) ([]int64, error) {
+	cutoff := time.Now().UTC().Add(-ttl).Format(time.DateTime)
+	runs, err := DB.GetStalePendingRuns(ctx, cutoff)
+	if err != nil {
+		return nil, err
+	}
+
+	expired := make([]int64, 0, len(runs))
+	var errs []error
+	for _, dbRun := range runs {
+		run, err := FromDBRun(dbRun)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("run %d: %w", dbRun.ID, err))
+			continue
+		}
+		message := fmt.Sprintf("the run was not started within the run.pending_ttl of %s. Create a new run with the same payload to run it", ttl)
+		err = transitionRun(ctx, DB, run.ID, StatusExpired, func() (int64, error) {
+			return DB.ExpireRun(ctx, db.ExpireRunParams{
+				ErrorMessage: sql.NullString{String: message, Valid: true},
+				ID:           run.ID,
+			})
+		})
+		// the run was started in the meantime
+		if errors.Is(err, ErrIllegalTransition) {
+			continue
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("run %d: %w", run.ID, err))
+			continue
+		}
+		expired = append(expired, run.ID)
+
+		runDir, ok := run.RunDir()
+		if !ok || viper.GetString("run.expired_inputs") == ExpiredInputsKeep {
+			RecordRunEvent(ctx, DB, run.ID, EventExpired, fmt.Sprintf("the run was created at %s and never started, its inputs are kept", run.CreatedAt.Format(time.RFC3339)))
+			continue
+		}
+		if err := os.RemoveAll(runDir); err != nil {
+			errs = append(errs, fmt.Errorf("run %d: %w", run.ID, err))
+			continue
+		}
+		RecordRunEvent(ctx, DB, run.ID, EventExpired, fmt.Sprintf("the run was created at %s and never started, its directory %s was removed", run.CreatedAt.Format(time.RFC3339), runDir))
+	}
+	return expired, errors.Join(errs...)
+}
+
+// CheckStartable refuses to start runs which are not pending anymore. Runs which expired
+// are told apart, as their inputs may be gone.
+func CheckStartable(ctx context.Context, DB *db.Queries, runID int64) error {
+	status, err := DB.GetRunStatusByID(ctx, runID)
+	if err != nil {
+		return err
+	}
+	switch RunStatus(status) {
+	case StatusPending:
+		return nil
+	case StatusExpired:
+		return fmt.Errorf("the run %d expired before it was started and cannot be started anymore, create a new run with the same payload instead: %w", runID, ErrRunExpired)
+	}
+	return fmt.Errorf("the run %d is %s and cannot be started again, create a new run with the same payload instead: %w", runID, status, ErrNotStartable)
+}
+
+// ClaimRun moves the pending run to queued, if no one else started it in the meantime.
+// Only one of several concurrent starts of the same run succeeds, the others are
+// refused with the status the run has now.
+func ClaimRun(ctx context.Context, DB *db.Queries, runID int64) error {
+	if err := CheckStartable(ctx, DB, runID); err != nil {
+		return err
+	}
+	claimed, err := DB.ClaimRun(ctx, runID)
+	if err != nil {
+		return err
+	}
+	if claimed == 0 {
+		if err := CheckStartable(ctx, DB, runID); err != nil {
+			return err
+		}
+		return fmt.Errorf("the run %d was started already: %w", runID, ErrNotStartable)
+	}
+	RecordRunEvent(ctx, DB, runID, EventStatusChanged, fmt.Sprintf("%s -> %s", StatusPending, StatusQueued))
+	return nil
+}
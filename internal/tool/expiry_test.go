@@ -0,0 +1,118 @@
+package tool
+
+import (
+	"context"
+	"errors"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hydrocode-de/gorun/internal/dockertest"
+	"github.com/spf13/viper"
+)
+
+func TestExpirePendingRuns(t *testing.T) {
+	for _, inputs := range []string{ExpiredInputsDelete, ExpiredInputsKeep} {
+		t.Run(inputs, func(t *testing.T) {
+			ctx := context.Background()
+			setTestConfig(t)
+			conn, DB := newTestDBConn(t)
+			addTestImage(dockertest.New(t), writeMessage)
+			viper.Set("run.expired_inputs", inputs)
+			age := func(run Tool, created time.Duration) {
+				t.Helper()
+				at := time.Now().UTC().Add(-created).Format(time.DateTime)
+				if _, err := conn.Exec("UPDATE runs SET created_at = ? WHERE id = ?", at, run.ID); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			stale := createTestRun(t, DB, CreateRunOptions{})
+			age(stale, 2*time.Hour)
+			fresh := createTestRun(t, DB, CreateRunOptions{})
+			age(fresh, 30*time.Minute)
+			finished := createTestRun(t, DB, CreateRunOptions{})
+			age(finished, 2*time.Hour)
+			if _, err := conn.Exec("UPDATE runs SET status = 'finished' WHERE id = ?", finished.ID); err != nil {
+				t.Fatal(err)
+			}
+			trashed := createTestRun(t, DB, CreateRunOptions{})
+			age(trashed, 2*time.Hour)
+			if _, err := DB.TrashRun(ctx, trashed.ID); err != nil {
+				t.Fatal(err)
+			}
+
+			expired, err := ExpirePendingRuns(ctx, DB, time.Hour)
+			if err != nil {
+				t.Fatalf("ExpirePendingRuns failed: %v", err)
+			}
+			if !slices.Equal(expired, []int64{stale.ID}) {
+				t.Errorf("the runs %v expired, want only %d", expired, stale.ID)
+			}
+			for runID, want := range map[int64]RunStatus{stale.ID: StatusExpired, fresh.ID: StatusPending, finished.ID: StatusFinished, trashed.ID: StatusPending} {
+				if status := runStatus(t, DB, runID); status != want {
+					t.Errorf("the run %d is %s, want %s", runID, status, want)
+				}
+			}
+			record, err := GetRun(ctx, DB, stale.ID, testUser)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(record.ErrorMessage.String, "run.pending_ttl of 1h0m0s") {
+				t.Errorf("the expired run has the message %q", record.ErrorMessage.String)
+			}
+			if events := runEventTypes(t, DB, stale.ID); !slices.Contains(events, string(EventExpired)) {
+				t.Errorf("the expired run has the events %v, want %s", events, EventExpired)
+			}
+
+			staleDir, _ := stale.RunDir()
+			_, err = os.Stat(staleDir)
+			if kept := err == nil; kept != (inputs == ExpiredInputsKeep) {
+				t.Errorf("with run.expired_inputs %s the directory of the expired run is kept: %v", inputs, kept)
+			}
+			freshDir, _ := fresh.RunDir()
+			if _, err := os.Stat(freshDir); err != nil {
+				t.Errorf("the directory of the fresh run was removed: %v", err)
+			}
+
+			// a second pass finds nothing left to expire
+			if again, err := ExpirePendingRuns(ctx, DB, time.Hour); err != nil || len(again) != 0 {
+				t.Errorf("the second pass expired %v, %v", again, err)
+			}
+		})
+	}
+}
+
+// an expired run is refused with ErrRunExpired and never gets a container
+func TestStartExpiredRun(t *testing.T) {
+	ctx := context.Background()
+	setTestConfig(t)
+	conn, DB := newTestDBConn(t)
+	daemon := dockertest.New(t)
+	addTestImage(daemon, writeMessage)
+	run := createTestRun(t, DB, CreateRunOptions{})
+	if _, err := conn.Exec("UPDATE runs SET created_at = datetime('now', '-2 hours') WHERE id = ?", run.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ExpirePendingRuns(ctx, DB, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := CheckStartable(ctx, DB, run.ID); !errors.Is(err, ErrRunExpired) || !strings.Contains(err.Error(), "create a new run with the same payload") {
+		t.Errorf("CheckStartable returned %v, want %v", err, ErrRunExpired)
+	}
+	if err := ClaimRun(ctx, DB, run.ID); !errors.Is(err, ErrRunExpired) {
+		t.Errorf("ClaimRun returned %v, want %v", err, ErrRunExpired)
+	}
+	if err := RunTool(ctx, RunToolOptions{DB: DB, Tool: run, UserId: testUser}); !errors.Is(err, ErrRunExpired) {
+		t.Errorf("RunTool returned %v, want %v", err, ErrRunExpired)
+	}
+	if containers := runContainers(daemon); len(containers) != 0 {
+		t.Errorf("%d containers were created for the expired run", len(containers))
+	}
+	if status := runStatus(t, DB, run.ID); status != StatusExpired {
+		t.Errorf("the run is %s after the refused starts, want %s", status, StatusExpired)
+	}
+}
@@ -0,0 +1,66 @@
+package tool
+
+import (
+	"errors"
+
+	toolspec "github.com/hydrocode-de/tool-spec-go"
+	"github.com/hydrocode-de/tool-spec-go/validate"
+)
+
+// FieldError is a validation error of tool-spec-go with the constraints of the field from
+// the spec, so that callers can correct the payload without reading the spec.
+type FieldError struct {
+	*validate.ValidationError
+	Details FieldDetails `json:"details"`
+}
+
+// FieldDetails describes what the spec expects of a parameter or dataset and what was submitted
+type FieldDetails struct {
+	ExpectedType  string      `json:"expected_type,omitempty"`
+	Array         bool        `json:"array,omitempty"`
+	AllowedValues []string    `json:"allowed_values,omitempty"`
+	Min           *float64    `json:"min,omitempty"`
+	Max           *float64    `json:"max,omitempty"`
+	Extensions    []string    `json:"extensions,omitempty"`
+	Submitted     interface{} `json:"submitted"`
+}
+
+func (e *FieldError) Unwrap() error {
+	return e.ValidationError
+}
+
+// enrichErrors wraps the validation errors into FieldErrors. Errors of other fields than
+// the parameters and datasets only carry the submitted value.
+func enrichErrors(spec toolspec.ToolSpec, parameters map[string]interface{}, datasets map[string]DatasetRef, errs []error) []error {
+	enriched := make([]error, 0, len(errs))
+	for _, err := range errs {
+		var validationErr *validate.ValidationError
+		if !errors.As(err, &validationErr) {
+			enriched = append(enriched, err)
+			continue
+		}
+
+		details := FieldDetails{Submitted: validationErr.Actual}
+		switch validationErr.Field {
+		case validate.Parameters:
+			details.Submitted = parameters[validationErr.Name]
+			if paramSpec, ok := spec.Parameters[validationErr.Name]; ok {
+				details.ExpectedType = paramSpec.ToolType
+				details.Array = paramSpec.IsArray
+				details.AllowedValues = paramSpec.Values
+				details.Min = paramSpec.Min
+				details.Max = paramSpec.Max
+			}
+		case validate.Data:
+			details.Submitted = nil
+			if ref, ok := datasets[validationErr.Name]; ok {
+				details.Submitted = ref
+			}
+			if dataSpec, ok := spec.Data[validationErr.Name]; ok {
+				details.Extensions = dataSpec.Extensions
+			}
+		}
+		enriched = append(enriched, &FieldError{ValidationError: validationErr, Details: details})
+	}
+	return enriched
+}
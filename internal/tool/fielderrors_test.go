@@ -0,0 +1,149 @@
+package tool
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"slices"
+	"testing"
+
+	toolspec "github.com/hydrocode-de/tool-spec-go"
+	"github.com/hydrocode-de/tool-spec-go/validate"
+)
+
+// constraintsSpec declares a constraint of each kind the validator checks
+const constraintsSpec = `tools:
+  constraints:
+    title: Constraints
+    description: Declares a constraint of each kind
+    parameters:
+      count:
+        type: integer
+        min: 1
+        max: 10
+      method:
+        type: enum
+        values: [mean, median]
+      sizes:
+        type: integer
+        array: true
+      verbose:
+        type: boolean
+      name:
+        type: string
+    data:
+      table:
+        extension: [csv, txt]
+        description: A table
+      mask:
+        extension: tif
+        description: A mask
+`
+
+func floatPtr(value float64) *float64 {
+	return &value
+}
+
+// the errors of every category of the validator of tool-spec-go carry the constraints of the
+// spec and the submitted value
+func TestEnrichErrorsPerCategory(t *testing.T) {
+	specFile, err := toolspec.LoadToolSpec([]byte(constraintsSpec))
+	if err != nil {
+		t.Fatal(err)
+	}
+	spec, err := specFile.GetTool("constraints")
+	if err != nil {
+		t.Fatal(err)
+	}
+	parameters := map[string]interface{}{
+		"count":   float64(42),
+		"method":  "mode",
+		"sizes":   float64(3),
+		"verbose": "yes",
+	}
+	datasets := map[string]DatasetRef{"table": {Paths: []string{"/data/table.xlsx"}}}
+	errs := enrichErrors(spec, parameters, datasets, validateInputs(spec, parameters, datasets))
+
+	tests := []struct {
+		field   validate.AllowedField
+		name    string
+		errType validate.ErrorType
+		details FieldDetails
+	}{
+		{validate.Parameters, "count", validate.OutOfRange, FieldDetails{ExpectedType: "integer", Min: floatPtr(1), Max: floatPtr(10), Submitted: float64(42)}},
+		{validate.Parameters, "method", validate.NotInEnum, FieldDetails{ExpectedType: "enum", AllowedValues: []string{"mean", "median"}, Submitted: "mode"}},
+		{validate.Parameters, "sizes", validate.NotArray, FieldDetails{ExpectedType: "integer", Array: true, Submitted: float64(3)}},
+		{validate.Parameters, "verbose", validate.WrongType, FieldDetails{ExpectedType: "boolean", Submitted: "yes"}},
+		{validate.Parameters, "name", validate.Required, FieldDetails{ExpectedType: "string"}},
+		{validate.Data, "table", validate.WrongType, FieldDetails{Extensions: []string{"csv", "txt"}, Submitted: datasets["table"]}},
+		{validate.Data, "mask", validate.Required, FieldDetails{Extensions: []string{"tif"}}},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.errType)+" "+tt.name, func(t *testing.T) {
+			var found *FieldError
+			for _, err := range errs {
+				var fieldErr *FieldError
+				if errors.As(err, &fieldErr) && fieldErr.Field == tt.field && fieldErr.Name == tt.name && fieldErr.Type == tt.errType {
+					found = fieldErr
+				}
+			}
+			if found == nil {
+				t.Fatalf("no %s error of %s %s in %v", tt.errType, tt.field, tt.name, errs)
+			}
+			if !reflect.DeepEqual(found.Details, tt.details) {
+				t.Errorf("the details are %+v, want %+v", found.Details, tt.details)
+			}
+		})
+	}
+}
+
+// errors of other fields keep the submitted value, errors of other packages are kept as they are
+func TestEnrichOtherErrors(t *testing.T) {
+	other := errors.New("the runtime is not available")
+	scratch := &validate.ValidationError{Field: "scratch_gb", Name: "scratch_gb", Type: validate.OutOfRange, Expected: "<= 100", Actual: "500"}
+	unknown := &validate.ValidationError{Field: validate.Parameters, Name: "unknown", Type: validate.NotAllowed, Actual: "1"}
+	errs := enrichErrors(toolspec.ToolSpec{}, map[string]interface{}{"unknown": float64(1)}, nil, []error{other, scratch, unknown})
+
+	if errs[0] != other {
+		t.Errorf("the foreign error became %#v", errs[0])
+	}
+	var fieldErr *FieldError
+	if !errors.As(errs[1], &fieldErr) || fieldErr.Details.Submitted != "500" || fieldErr.Details.ExpectedType != "" {
+		t.Errorf("the scratch error became %+v", errs[1])
+	}
+	if !errors.As(errs[2], &fieldErr) || fieldErr.Details.Submitted != float64(1) || fieldErr.Details.ExpectedType != "" {
+		t.Errorf("the error of a parameter missing from the spec became %+v", errs[2])
+	}
+	var validationErr *validate.ValidationError
+	if !errors.As(errs[1], &validationErr) || validationErr != scratch {
+		t.Errorf("the enriched error does not unwrap to the error of the validator")
+	}
+}
+
+// the fields of the validator error stay at the top level of each problem, next to the details
+func TestFieldErrorJSON(t *testing.T) {
+	fieldErr := &FieldError{
+		ValidationError: &validate.ValidationError{Field: validate.Parameters, Name: "method", Type: validate.NotInEnum, Expected: "one of [mean median]", Actual: "mode", Message: "method must be one of [mean median]"},
+		Details:         FieldDetails{ExpectedType: "enum", AllowedValues: []string{"mean", "median"}, Submitted: "mode"},
+	}
+	raw, err := json.Marshal(fieldErr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var problem map[string]interface{}
+	if err := json.Unmarshal(raw, &problem); err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	for key := range problem {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	if want := []string{"actual", "details", "expected", "field", "message", "name", "type"}; !slices.Equal(keys, want) {
+		t.Errorf("the problem has the keys %v, want %v", keys, want)
+	}
+	details := problem["details"].(map[string]interface{})
+	if details["expected_type"] != "enum" || details["submitted"] != "mode" || len(details["allowed_values"].([]interface{})) != 2 {
+		t.Errorf("the details are %v", details)
+	}
+}
@@ -1,6 +1,10 @@
 package tool
 
 import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -8,15 +12,15 @@ import (
 	"os"
 	"path"
 	"path/filepath"
-	"slices"
 	"strings"
 	"unicode/utf8"
 
+	"github.com/hydrocode-de/gorun/internal/db"
 	"github.com/hydrocode-de/gorun/internal/files"
 )
 
 func (t *Tool) ListResults() ([]files.ResultFile, error) {
-	if t.Status != "finished" && t.Status != "errored" {
+	if t.Status != string(StatusFinished) && t.Status != string(StatusErrored) {
 		return nil, errors.New("unfinished tools cannot list results")
 	}
 
@@ -24,7 +28,49 @@ func (t *Tool) ListResults() ([]files.ResultFile, error) {
 	if !ok {
 		return nil, fmt.Errorf("tool %v did not mount /out. That means there is no folder with results", t.Name)
 	}
-	return files.ReadDir(hostOut, true, hostOut)
+	listed, err := files.ReadDir(hostOut, true, hostOut)
+	if err != nil {
+		return nil, err
+	}
+
+	// the generated previews are not results on their own
+	previews := make(map[string]bool)
+	results := make([]files.ResultFile, 0, len(listed))
+	for _, file := range listed {
+		if files.IsPreview(file.RelPath) {
+			previews[file.AbsPath] = true
+		} else {
+			results = append(results, file)
+		}
+	}
+	for i := range results {
+		if previewPath, _, ok := files.PreviewPath(hostOut, results[i].RelPath); ok {
+			results[i].HasPreview = previews[previewPath]
+		}
+	}
+	return results, nil
+}
+
+// DescribeResults lists the results with their detected format, including the results which
+// are only left in the object storage. Unless flat is set, Zarr stores and shapefiles are
+// listed as one entry with their files as members.
+func (t *Tool) DescribeResults(ctx context.Context, DB *db.Queries, flat bool) ([]files.ResultFile, error) {
+	results, err := t.ListResults()
+	if err != nil {
+		return nil, err
+	}
+	for i := range results {
+		if format, err := files.DetectFileFormat(results[i].AbsPath); err == nil {
+			results[i].Format, results[i].MimeType = format.Name, format.MimeType
+		}
+	}
+	if results, err = t.withStoredResults(ctx, DB, results); err != nil {
+		return nil, err
+	}
+	if !flat {
+		results = files.GroupResults(results)
+	}
+	return t.withAnnotations(ctx, DB, results)
 }
 
 func (t *Tool) resolveResultFile(resultPath string) (*files.ResultFile, error) {
@@ -33,10 +79,9 @@ func (t *Tool) resolveResultFile(resultPath string) (*files.ResultFile, error) {
 		return nil, err
 	}
 
-	normalized := filepath.ToSlash(path.Clean(strings.TrimSpace(resultPath)))
-	normalized = strings.TrimPrefix(normalized, "./")
+	normalized := normalizeResultPath(resultPath)
 	if normalized == "." || normalized == "" {
-		return nil, fmt.Errorf("the result file %s was not found in the tool %s results", resultPath, t.Name)
+		return nil, fmt.Errorf("the result file %s was not found in the tool %s results: %w", resultPath, t.Name, ErrNotFound)
 	}
 
 	for _, file := range results {
@@ -46,13 +91,28 @@ func (t *Tool) resolveResultFile(resultPath string) (*files.ResultFile, error) {
 		}
 	}
 
-	return nil, fmt.Errorf("the result file %s was not found in the tool %s results", resultPath, t.Name)
+	return nil, fmt.Errorf("the result file %s was not found in the tool %s results: %w", resultPath, t.Name, ErrNotFound)
+}
+
+// normalizeResultPath cleans the path of a result relative to /out
+func normalizeResultPath(resultPath string) string {
+	normalized := filepath.ToSlash(path.Clean(strings.TrimSpace(resultPath)))
+	return strings.TrimPrefix(normalized, "./")
 }
 
 type WriteFileMeta struct {
 	Filename string
 	MimeType string
+	// Format is the name of the detected format, empty if gorun does not know it
+	Format   string
 	FullPath string
+	Size     int64
+}
+
+// DetectMimeType tells the MIME type of the file from its first bytes and name,
+// see files.DetectFormat. Text types carry their charset.
+func DetectMimeType(name string, head []byte) string {
+	return files.DetectFormat(name, bytes.NewReader(head)).MimeType
 }
 
 func (t *Tool) WriteResultFile(resultPath string, w io.Writer) (*WriteFileMeta, error) {
@@ -61,32 +121,24 @@ func (t *Tool) WriteResultFile(resultPath string, w io.Writer) (*WriteFileMeta,
 		return nil, err
 	}
 
-	file, err := os.Open(result.AbsPath)
+	file, err := t.openResult(result)
 	if err != nil {
 		return nil, err
 	}
 	defer file.Close()
 
-	buffer := make([]byte, 512)
-	_, err = file.Read(buffer)
-	if err != nil && err != io.EOF {
-		return nil, err
-	}
-	mimeType := http.DetectContentType(buffer)
-	_, err = file.Seek(0, 0)
-	if err != nil {
-		return nil, err
-	}
-
-	_, err = io.Copy(w, file)
+	format := files.DetectFormat(result.RelPath, file)
+	written, err := io.Copy(w, file)
 	if err != nil {
 		return nil, err
 	}
 
 	return &WriteFileMeta{
 		Filename: path.Base(result.RelPath),
-		MimeType: mimeType,
+		MimeType: format.MimeType,
+		Format:   format.Name,
 		FullPath: result.AbsPath,
+		Size:     written,
 	}, nil
 }
 
@@ -96,10 +148,10 @@ type PreviewResultFileMeta struct {
 	Encoding  string `json:"encoding"`
 	Truncated bool   `json:"truncated"`
 	Content   string `json:"content"`
+	// Kind is the kind of a generated preview, empty for previews read from the file itself
+	Kind string `json:"kind,omitempty"`
 }
 
-var previewableExtensions = []string{".json", ".txt", ".log", ".md", ".csv"}
-
 const previewByteLimit = 64 * 1024
 
 func (t *Tool) PreviewResultFile(resultPath string) (*PreviewResultFileMeta, error) {
@@ -107,8 +159,11 @@ func (t *Tool) PreviewResultFile(resultPath string) (*PreviewResultFileMeta, err
 	if err != nil {
 		return nil, err
 	}
+	if result.HasPreview {
+		return t.generatedPreview(*result)
+	}
 
-	file, err := os.Open(result.AbsPath)
+	file, err := t.openResult(result)
 	if err != nil {
 		return nil, err
 	}
@@ -127,20 +182,82 @@ func (t *Tool) PreviewResultFile(resultPath string) (*PreviewResultFileMeta, err
 		truncated = true
 	}
 
-	mimeType := http.DetectContentType(contentBytes)
-	extension := strings.ToLower(path.Ext(result.RelPath))
-	if !strings.HasPrefix(mimeType, "text/") && mimeType != "application/json" && !slices.Contains(previewableExtensions, extension) {
-		return nil, fmt.Errorf("preview is not available for binary or unsupported file type: %s", result.RelPath)
+	format := files.DetectFormat(result.RelPath, bytes.NewReader(contentBytes))
+	if format.Name != "" && !format.IsText() {
+		return nil, fmt.Errorf("%w for %s files: %s", ErrPreviewUnavailable, format.Name, result.RelPath)
+	}
+	// files of unknown types, like scripts, are shown if they look like text
+	if !(format.IsText() || strings.HasPrefix(http.DetectContentType(contentBytes), "text/")) || !utf8.Valid(contentBytes) {
+		return nil, fmt.Errorf("%w for binary or unsupported file type: %s", ErrPreviewUnavailable, result.RelPath)
 	}
-	if !utf8.Valid(contentBytes) {
-		return nil, fmt.Errorf("preview is not available for binary or unsupported file type: %s", result.RelPath)
+	if !format.IsText() {
+		format.MimeType = "text/plain; charset=utf-8"
 	}
 
 	return &PreviewResultFileMeta{
 		Filename:  result.RelPath,
-		MimeType:  mimeType,
+		MimeType:  format.MimeType,
 		Encoding:  "utf-8",
 		Truncated: truncated,
 		Content:   string(contentBytes),
 	}, nil
 }
+
+// generatedPreview reads the preview generated for the result file after the run finished.
+// Thumbnails are base64 encoded PNGs, table previews JSON and text previews the head of the file.
+func (t *Tool) generatedPreview(result files.ResultFile) (*PreviewResultFileMeta, error) {
+	previewPath, kind, _ := files.PreviewPath(t.Mounts["/out"], result.RelPath)
+	content, err := os.ReadFile(previewPath)
+	if err != nil {
+		return nil, err
+	}
+
+	preview := &PreviewResultFileMeta{
+		Filename: result.RelPath,
+		Encoding: "utf-8",
+		Content:  string(content),
+		Kind:     kind,
+	}
+	switch kind {
+	case files.PreviewThumbnail:
+		preview.MimeType = "image/png"
+		preview.Encoding = "base64"
+		preview.Content = base64.StdEncoding.EncodeToString(content)
+	case files.PreviewTable:
+		preview.MimeType = "application/json"
+		var table files.TablePreview
+		if err := json.Unmarshal(content, &table); err == nil {
+			preview.Truncated = table.Truncated
+		}
+	default:
+		preview.MimeType = "text/plain; charset=utf-8"
+		preview.Truncated = int64(len(content)) < result.Size
+		if !utf8.Valid(content) {
+			return nil, fmt.Errorf("%w for binary or unsupported file type: %s", ErrPreviewUnavailable, result.RelPath)
+		}
+	}
+	return preview, nil
+}
+
+// OpenResultFile opens a single result file for reading. The caller closes the file.
+func (t *Tool) OpenResultFile(resultPath string) (*os.File, *files.ResultFile, error) {
+	result, err := t.resolveResultFile(resultPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	file, err := t.openResult(result)
+	if err != nil {
+		return nil, nil, err
+	}
+	return file, result, nil
+}
+
+// openResult opens the listed result file. A result which resolves outside of /out, like
+// a file below a directory the tool replaced by a symlink, is not found.
+func (t *Tool) openResult(result *files.ResultFile) (*os.File, error) {
+	file, err := files.OpenContained(t.Mounts["/out"], result.AbsPath)
+	if errors.Is(err, files.ErrOutsideDir) {
+		return nil, fmt.Errorf("the result file %s was not found in the tool %s results: %w", result.RelPath, t.Name, ErrNotFound)
+	}
+	return file, err
+}
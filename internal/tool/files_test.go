@@ -0,0 +1,49 @@
+package tool
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hydrocode-de/gorun/internal/files"
+)
+
+// a result whose directory is replaced by a symlink after it was listed is not opened
+func TestOpenResultStaysInOut(t *testing.T) {
+	base := t.TempDir()
+	outDir, hostDir := filepath.Join(base, "out"), filepath.Join(base, "host")
+	for _, dir := range []string{filepath.Join(outDir, "data"), hostDir} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, file := range []string{filepath.Join(outDir, "data", "result.txt"), filepath.Join(hostDir, "result.txt")} {
+		if err := os.WriteFile(file, []byte("content"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	run := &Tool{Name: "echo", Status: string(StatusFinished), Mounts: map[string]string{"/out": outDir}}
+	result, err := run.resolveResultFile("data/result.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := run.openResult(result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+
+	if err := os.RemoveAll(filepath.Join(outDir, "data")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(hostDir, filepath.Join(outDir, "data")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := run.openResult(result); !errors.Is(err, ErrNotFound) {
+		t.Errorf("the result below the symlink was opened: %v", err)
+	}
+	if listed, err := files.ReadDir(outDir, true, outDir); err != nil || len(listed) != 0 {
+		t.Errorf("the symlinked directory is listed as %v, %v", listed, err)
+	}
+}
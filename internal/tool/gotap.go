@@ -0,0 +1,98 @@
+package tool
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hydrocode-de/gorun/internal/toolImage"
+)
+
+// gotapArgument is passed to gotap run as the first of its flags gotap knows, or as
+// positional argument if the usage line of gotap names it instead
+type gotapArgument struct {
+	flags       []string
+	positionals []string
+	value       string
+	// required arguments fail the run if gotap takes them neither way
+	required bool
+}
+
+var gotapRunArguments = []gotapArgument{
+	{flags: []string{"input-file", "input"}, positionals: []string{"input-file", "input", "inputs"}, value: "/in/inputs.json", required: true},
+	{flags: []string{"spec-file", "spec"}, positionals: []string{"spec-file", "spec"}, value: "/src/tool.yml", required: true},
+	{flags: []string{"output-folder", "output-dir"}, value: "/out"},
+}
+
+// gotapRunArgs builds the arguments of gotap run from the capabilities of the gotap in
+// the image. If its help could not be read, the arguments known to all gotap versions
+// are passed.
+func gotapRunArgs(toolName string, caps toolImage.GotapCapabilities) ([]string, error) {
+	if !caps.Parsed {
+		return []string{"run", toolName, "--input-file", "/in/inputs.json", "--spec-file", "/src/tool.yml"}, nil
+	}
+
+	type positional struct {
+		index int
+		value string
+	}
+	var flags []string
+	var positionals []positional
+	for _, arg := range gotapRunArguments {
+		if flag, ok := firstGotapFlag(caps, arg.flags); ok {
+			flags = append(flags, "--"+flag, arg.value)
+			continue
+		}
+		if index, ok := firstGotapPositional(caps, arg.positionals); ok {
+			positionals = append(positionals, positional{index: index, value: arg.value})
+			continue
+		}
+		if arg.required {
+			return nil, fmt.Errorf("%s does not support --%s, which gorun needs to pass %s: %w", gotapVersion(caps), arg.flags[0], arg.value, toolImage.ErrGotapIncompatible)
+		}
+	}
+
+	// the positionals follow the tool in the order of the usage line, which must not
+	// name arguments gorun does not know in between
+	sort.Slice(positionals, func(i, j int) bool { return positionals[i].index < positionals[j].index })
+	args := []string{"run", toolName}
+	for i, p := range positionals {
+		if p.index != i+1 {
+			return nil, fmt.Errorf("%s expects the positional argument %s, which gorun does not know: %w", gotapVersion(caps), caps.Positionals[i+1], toolImage.ErrGotapIncompatible)
+		}
+		args = append(args, p.value)
+	}
+	return append(args, flags...), nil
+}
+
+// gotapVersion names the gotap in errors. gotap -v prints the name with the version, older
+// versions only the number.
+func gotapVersion(caps toolImage.GotapCapabilities) string {
+	switch {
+	case caps.Version == "":
+		return "gotap of unknown version"
+	case strings.HasPrefix(caps.Version, "gotap"):
+		return caps.Version
+	default:
+		return "gotap " + caps.Version
+	}
+}
+
+func firstGotapFlag(caps toolImage.GotapCapabilities, names []string) (string, bool) {
+	for _, name := range names {
+		if caps.Has(name) {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+func firstGotapPositional(caps toolImage.GotapCapabilities, names []string) (int, bool) {
+	for _, name := range names {
+		// the first positional is the tool
+		if index := caps.Positional(name); index > 0 {
+			return index, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,119 @@
+package tool
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/hydrocode-de/gorun/internal/dockertest"
+	"github.com/hydrocode-de/gorun/internal/toolImage"
+)
+
+func gotapCapabilities(version string, flags []string, positionals []string) toolImage.GotapCapabilities {
+	caps := toolImage.GotapCapabilities{Version: version, Flags: make(map[string]bool), Positionals: positionals, Parsed: true}
+	for _, flag := range flags {
+		caps.Flags[flag] = true
+	}
+	return caps
+}
+
+func TestGotapRunArgs(t *testing.T) {
+	tests := []struct {
+		name string
+		caps toolImage.GotapCapabilities
+		want []string
+		// wantErr starts the error, if gotap lacks a required argument
+		wantErr string
+	}{
+		{
+			name: "unreadable help",
+			caps: toolImage.GotapCapabilities{},
+			want: []string{"run", "echo", "--input-file", "/in/inputs.json", "--spec-file", "/src/tool.yml"},
+		},
+		{
+			name: "all flags",
+			caps: gotapCapabilities("gotap 0.4.0", []string{"input-file", "spec-file", "output-folder"}, nil),
+			want: []string{"run", "echo", "--input-file", "/in/inputs.json", "--spec-file", "/src/tool.yml", "--output-folder", "/out"},
+		},
+		{
+			name: "short flag names without output folder",
+			caps: gotapCapabilities("gotap 0.2.1", []string{"input", "spec"}, nil),
+			want: []string{"run", "echo", "--input", "/in/inputs.json", "--spec", "/src/tool.yml"},
+		},
+		{
+			name: "positional input",
+			caps: gotapCapabilities("gotap 0.3.0", []string{"spec-file", "output-dir"}, []string{"tool", "input-file"}),
+			want: []string{"run", "echo", "/in/inputs.json", "--spec-file", "/src/tool.yml", "--output-dir", "/out"},
+		},
+		{
+			name:    "missing spec file",
+			caps:    gotapCapabilities("gotap 0.1.0", []string{"input-file"}, nil),
+			wantErr: "gotap 0.1.0 does not support --spec-file",
+		},
+		{
+			name:    "version number only",
+			caps:    gotapCapabilities("0.1.0", []string{"spec-file"}, nil),
+			wantErr: "gotap 0.1.0 does not support --input-file",
+		},
+		{
+			name:    "unknown version",
+			caps:    gotapCapabilities("", []string{"spec-file"}, nil),
+			wantErr: "gotap of unknown version does not support --input-file",
+		},
+		{
+			name:    "unknown positional",
+			caps:    gotapCapabilities("gotap 0.3.0", []string{"spec-file"}, []string{"tool", "config", "input-file"}),
+			wantErr: "gotap 0.3.0 expects the positional argument config",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args, err := gotapRunArgs(testTool, tt.caps)
+			if tt.wantErr != "" {
+				if !errors.Is(err, toolImage.ErrGotapIncompatible) || !strings.HasPrefix(err.Error(), tt.wantErr) {
+					t.Fatalf("the arguments failed with %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(args, tt.want) {
+				t.Errorf("the arguments are %q, want %q", args, tt.want)
+			}
+		})
+	}
+}
+
+// a gotap without an argument gorun needs fails the run as invalid, naming the version and
+// the argument, before the run container is created
+func TestRunToolIncompatibleGotap(t *testing.T) {
+	DB := newTestDB(t)
+	daemon := dockertest.New(t)
+	img := addTestImage(daemon, writeMessage)
+	img.Commands = map[string]dockertest.Result{
+		"gotap -v":         {Stdout: "gotap 0.1.0\n"},
+		"gotap run --help": {Stdout: "Usage:\n  gotap run TOOL [flags]\n\nFlags:\n  --input-file string\n"},
+	}
+	run := createTestRun(t, DB, CreateRunOptions{})
+
+	err := RunTool(context.Background(), RunToolOptions{DB: DB, Tool: run, UserId: testUser})
+	if !errors.Is(err, toolImage.ErrGotapIncompatible) {
+		t.Fatalf("RunTool returned %v, want ErrGotapIncompatible", err)
+	}
+	if status, kind := runErrorKind(t, DB, run.ID); status != StatusErrored || kind != ErrorValidation {
+		t.Errorf("the run is %s (%s), want %s (%s)", status, kind, StatusErrored, ErrorValidation)
+	}
+	record, err := GetRun(context.Background(), DB, run.ID, testUser)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if message := record.ErrorMessage.String; !strings.Contains(message, "gotap 0.1.0") || !strings.Contains(message, "--spec-file") {
+		t.Errorf("the error of the run %q names neither the version nor the flag", message)
+	}
+	if created := runContainers(daemon); len(created) != 0 {
+		t.Errorf("%d run containers were created", len(created))
+	}
+}
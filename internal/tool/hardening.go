@@ -0,0 +1,95 @@
+package tool
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/spf13/viper"
+)
+
+// Hardening describes the security restrictions applied to a run container
+type Hardening struct {
+	DropAllCaps     bool     `json:"drop_all_caps"`
+	CapAdd          []string `json:"cap_add,omitempty"`
+	NoNewPrivileges bool     `json:"no_new_privileges"`
+	SeccompProfile  string   `json:"seccomp_profile,omitempty"`
+	ReadOnlyRootfs  bool     `json:"read_only_rootfs"`
+	PidsLimit       int64    `json:"pids_limit,omitempty"`
+}
+
+// HardeningOverride lets admins change single hardening options of a run
+type HardeningOverride struct {
+	DropAllCaps     *bool     `json:"drop_all_caps,omitempty"`
+	CapAdd          *[]string `json:"cap_add,omitempty"`
+	NoNewPrivileges *bool     `json:"no_new_privileges,omitempty"`
+	SeccompProfile  *string   `json:"seccomp_profile,omitempty"`
+	ReadOnlyRootfs  *bool     `json:"read_only_rootfs,omitempty"`
+	PidsLimit       *int64    `json:"pids_limit,omitempty"`
+}
+
+func HardeningFromConfig() Hardening {
+	return Hardening{
+		DropAllCaps:     viper.GetBool("security.drop_all_caps"),
+		CapAdd:          viper.GetStringSlice("security.cap_add"),
+		NoNewPrivileges: viper.GetBool("security.no_new_privileges"),
+		SeccompProfile:  viper.GetString("security.seccomp_profile"),
+		ReadOnlyRootfs:  viper.GetBool("security.read_only_rootfs"),
+		PidsLimit:       viper.GetInt64("security.pids_limit"),
+	}
+}
+
+func (h Hardening) WithOverride(override *HardeningOverride) Hardening {
+	if override == nil {
+		return h
+	}
+	if override.DropAllCaps != nil {
+		h.DropAllCaps = *override.DropAllCaps
+	}
+	if override.CapAdd != nil {
+		h.CapAdd = *override.CapAdd
+	}
+	if override.NoNewPrivileges != nil {
+		h.NoNewPrivileges = *override.NoNewPrivileges
+	}
+	if override.SeccompProfile != nil {
+		h.SeccompProfile = *override.SeccompProfile
+	}
+	if override.ReadOnlyRootfs != nil {
+		h.ReadOnlyRootfs = *override.ReadOnlyRootfs
+	}
+	if override.PidsLimit != nil {
+		h.PidsLimit = *override.PidsLimit
+	}
+	return h
+}
+
+// ApplyTo translates the hardening options into the HostConfig of the container
+func (h Hardening) ApplyTo(hostConfig *container.HostConfig) error {
+	if h.DropAllCaps {
+		hostConfig.CapDrop = []string{"ALL"}
+	}
+	if len(h.CapAdd) > 0 {
+		hostConfig.CapAdd = h.CapAdd
+	}
+	if h.NoNewPrivileges {
+		hostConfig.SecurityOpt = append(hostConfig.SecurityOpt, "no-new-privileges")
+	}
+	if h.SeccompProfile != "" {
+		// the Docker API expects the profile itself, not the path to it
+		profile, err := os.ReadFile(h.SeccompProfile)
+		if err != nil {
+			return fmt.Errorf("failed to read the seccomp profile %s: %w", h.SeccompProfile, err)
+		}
+		hostConfig.SecurityOpt = append(hostConfig.SecurityOpt, "seccomp="+string(profile))
+	}
+	if h.ReadOnlyRootfs {
+		hostConfig.ReadonlyRootfs = true
+		hostConfig.Tmpfs = map[string]string{"/tmp": "rw,exec"}
+	}
+	if h.PidsLimit > 0 {
+		pidsLimit := h.PidsLimit
+		hostConfig.PidsLimit = &pidsLimit
+	}
+	return nil
+}
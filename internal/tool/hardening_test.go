@@ -0,0 +1,110 @@
+package tool
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+	"github.com/hydrocode-de/gorun/internal/dockertest"
+	"github.com/hydrocode-de/gorun/internal/toolImage"
+	"github.com/spf13/viper"
+)
+
+func TestRunContainerHardening(t *testing.T) {
+	tests := []struct {
+		name                string
+		override            *HardeningOverride
+		wantCapDrop         bool
+		wantNoNewPrivileges bool
+	}{
+		{name: "defaults", wantCapDrop: true, wantNoNewPrivileges: true},
+		{name: "opt-out", override: &HardeningOverride{DropAllCaps: new(bool), NoNewPrivileges: new(bool)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			DB := newTestDB(t)
+			// the defaults of gorun serve, see initApplicationConfig
+			viper.Set("security.drop_all_caps", true)
+			viper.Set("security.no_new_privileges", true)
+			viper.Set("security.cap_add", []string{"CHOWN"})
+			daemon := dockertest.New(t)
+			addTestImage(daemon, writeMessage)
+			run := createTestRun(t, DB, CreateRunOptions{Hardening: tt.override})
+
+			if err := RunTool(context.Background(), RunToolOptions{DB: DB, Tool: run, UserId: testUser}); err != nil {
+				t.Fatalf("RunTool failed: %v", err)
+			}
+			containers := runContainers(daemon)
+			if len(containers) != 1 {
+				t.Fatalf("%d containers were created, want 1", len(containers))
+			}
+			hostConfig := containers[0].HostConfig
+			if capDrop := slices.Equal(hostConfig.CapDrop, []string{"ALL"}); capDrop != tt.wantCapDrop {
+				t.Errorf("the container drops the capabilities %v", hostConfig.CapDrop)
+			}
+			if !slices.Equal(hostConfig.CapAdd, []string{"CAP_CHOWN"}) {
+				t.Errorf("the container adds the capabilities %v, want [CAP_CHOWN]", hostConfig.CapAdd)
+			}
+			if noNewPrivileges := slices.Contains(hostConfig.SecurityOpt, "no-new-privileges"); noNewPrivileges != tt.wantNoNewPrivileges {
+				t.Errorf("the container has the security options %v", hostConfig.SecurityOpt)
+			}
+		})
+	}
+}
+
+// TestHardeningBlocksPrivilegedSyscalls needs a Docker daemon, it is skipped without one
+func TestHardeningBlocksPrivilegedSyscalls(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+	c, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		t.Skipf("no Docker client: %v", err)
+	}
+	defer c.Close()
+	if _, err := c.Ping(ctx); err != nil {
+		t.Skipf("no Docker daemon: %v", err)
+	}
+	const testImage = "alpine:3"
+	if _, err := toolImage.PullIfMissing(ctx, c, testImage, ""); err != nil {
+		t.Skipf("the image %s is not available: %v", testImage, err)
+	}
+
+	// chown needs CAP_CHOWN, which Docker grants to root by default
+	exitCode := func(hardening Hardening) int64 {
+		t.Helper()
+		hostConfig := &container.HostConfig{}
+		if err := hardening.ApplyTo(hostConfig); err != nil {
+			t.Fatal(err)
+		}
+		created, err := c.ContainerCreate(ctx, &container.Config{
+			Image: testImage,
+			User:  "root",
+			Cmd:   []string{"sh", "-c", "touch /tmp/file && chown 65534 /tmp/file"},
+		}, hostConfig, nil, nil, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.ContainerRemove(context.Background(), created.ID, container.RemoveOptions{Force: true})
+		if err := c.ContainerStart(ctx, created.ID, container.StartOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		statusCh, errCh := c.ContainerWait(ctx, created.ID, container.WaitConditionNotRunning)
+		select {
+		case status := <-statusCh:
+			return status.StatusCode
+		case err := <-errCh:
+			t.Fatal(err)
+		}
+		return -1
+	}
+
+	if code := exitCode(Hardening{}); code != 0 {
+		t.Fatalf("chown failed with status %d without hardening", code)
+	}
+	if code := exitCode(Hardening{DropAllCaps: true, NoNewPrivileges: true}); code == 0 {
+		t.Error("chown succeeded in a container without capabilities")
+	}
+}
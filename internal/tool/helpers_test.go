@@ -0,0 +1,214 @@
+package tool
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hydrocode-de/gorun/internal/db"
+	"github.com/hydrocode-de/gorun/internal/dockerclient"
+	"github.com/hydrocode-de/gorun/internal/dockertest"
+	"github.com/hydrocode-de/gorun/internal/files"
+	gorunsql "github.com/hydrocode-de/gorun/sql"
+	"github.com/spf13/viper"
+)
+
+const (
+	testUser  = "alice"
+	testAdmin = "admin"
+	testImage = "gorun-test:1.0"
+	testTool  = "echo"
+)
+
+// testSpec is the tool-spec of testImage, served from its spec label
+const testSpec = `tools:
+  echo:
+    title: Echo
+    description: Writes the message to /out/message.txt
+    parameters:
+      message:
+        type: string
+        description: The message
+      count:
+        type: integer
+        default: 1
+    data:
+      input:
+        extension: txt
+        description: A text file
+        optional: true
+`
+
+// setTestConfig sets the configuration gorun needs below a temporary directory. The
+// configuration is reset once the test ends, after the background work of its runs.
+func setTestConfig(t testing.TB) string {
+	t.Helper()
+	dir := t.TempDir()
+	viper.Reset()
+	t.Cleanup(func() {
+		background.Wait()
+		viper.Reset()
+	})
+	for key, value := range map[string]any{
+		"path":                      dir,
+		"db_path":                   filepath.Join(dir, "gorun.db"),
+		"mount_path":                filepath.Join(dir, "mounts"),
+		"temp_path":                 filepath.Join(dir, "temp"),
+		"data_mode":                 DataModeCopy,
+		"files.run_dir_template":    files.DefaultRunDirTemplate,
+		"max_dataset_files":         1000,
+		"datasets.max_inline_bytes": 1024 * 1024,
+		"run.runtime":               RuntimeDocker,
+		"run.spec_entry":            "auto",
+		"run.max_retries":           3,
+		"run.retry_backoff":         time.Millisecond,
+		"run.max_log_bytes":         1024 * 1024,
+		"run.stats_interval":        time.Hour,
+		"run.param_env_max_bytes":   4096,
+		"run.trash_retention":       7 * 24 * time.Hour,
+		"gotap.probe_names":         []string{"gotap"},
+		"gotap.run_args":            []string{},
+		"images.spec_label":         "org.toolspec.spec",
+		"images.citation_label":     "org.toolspec.citation",
+		"images.max_label_bytes":    256 * 1024,
+		"images.pull_missing":       false,
+		"scan.probe_timeout":        5 * time.Second,
+		"tools.load_on_demand":      true,
+		"tools.load_timeout":        10 * time.Second,
+		"previews.enabled":          false,
+	} {
+		viper.Set(key, value)
+	}
+	return dir
+}
+
+// newTestDB migrates a new database and adds the users testUser and testAdmin
+func newTestDB(t testing.TB) *db.Queries {
+	t.Helper()
+	_, DB := newTestDBConn(t)
+	return DB
+}
+
+// newTestDBConn is newTestDB, which also returns the connection for statements no query has
+func newTestDBConn(t testing.TB) (*sql.DB, *db.Queries) {
+	t.Helper()
+	if viper.GetString("db_path") == "" {
+		setTestConfig(t)
+	}
+	conn, err := gorunsql.CreateDB(viper.GetString("db_path"))
+	if err != nil {
+		t.Fatalf("cannot create the database: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	// the runs of a test touch the database from several goroutines
+	conn.SetMaxOpenConns(1)
+	DB := db.New(conn)
+	for _, user := range []db.CreateUserParams{
+		{ID: testUser, Email: "alice@example.org", PasswordHash: "x"},
+		{ID: testAdmin, Email: "admin@example.org", PasswordHash: "x", IsAdmin: true},
+	} {
+		if _, err := DB.CreateUser(context.Background(), user); err != nil {
+			t.Fatalf("cannot create the user %s: %v", user.ID, err)
+		}
+	}
+	return conn, DB
+}
+
+// createTestRunRecord adds a pending run of testUser to the database, without its directory
+func createTestRunRecord(t testing.TB, DB *db.Queries) int64 {
+	t.Helper()
+	run, err := DB.CreateRun(context.Background(), db.CreateRunParams{
+		Name:        testTool,
+		DockerImage: testImage,
+		Parameters:  "{}",
+		Data:        "{}",
+		Mounts:      "{}",
+		Options:     "{}",
+		UserID:      testUser,
+	})
+	if err != nil {
+		t.Fatalf("cannot create the run: %v", err)
+	}
+	return run.ID
+}
+
+// addTestImage adds testImage with testSpec as label to the fake daemon. The run
+// containers of the image execute run.
+func addTestImage(d *dockertest.Daemon, run dockertest.Script) *dockertest.Image {
+	return d.AddImage(dockertest.Image{
+		RepoTags:    []string{testImage},
+		RepoDigests: []string{"gorun-test@sha256:7f3a9c"},
+		Labels:      map[string]string{"org.toolspec.spec": testSpec},
+		Entrypoint:  []string{"/run.sh"},
+		Run:         run,
+	})
+}
+
+// gotapCommands are the probes of an image which ships gotap
+var gotapCommands = map[string]dockertest.Result{
+	"gotap -v":         {Stdout: "gotap 0.4.0\n"},
+	"gotap run --help": {Stdout: "Usage: gotap run TOOL [flags]\n\nFlags:\n  --input-file string\n  --spec-file string\n  --output-folder string\n"},
+}
+
+// runContainers returns the containers of runs, without those of the probes
+func runContainers(d *dockertest.Daemon) []*dockertest.Container {
+	var containers []*dockertest.Container
+	for _, c := range d.Created() {
+		if c.Purpose() == dockerclient.PurposeRun {
+			containers = append(containers, c)
+		}
+	}
+	return containers
+}
+
+// createTestRun creates a run of the echo tool of testImage for testUser
+func createTestRun(t *testing.T, DB *db.Queries, opts CreateRunOptions) Tool {
+	t.Helper()
+	if opts.Image == "" {
+		opts.Image = testImage
+	}
+	if opts.Name == "" {
+		opts.Name = testTool
+	}
+	if opts.Parameters == nil {
+		opts.Parameters = map[string]interface{}{"message": "hello"}
+	}
+	if opts.Datasets == nil {
+		opts.Datasets = map[string]DatasetRef{}
+	}
+	runData, err := CreateToolRun(context.Background(), DB, opts, testUser)
+	if err != nil {
+		t.Fatalf("cannot create the run: %v", err)
+	}
+	run, err := FromDBRun(runData)
+	if err != nil {
+		t.Fatalf("cannot read the run: %v", err)
+	}
+	return run
+}
+
+// runStatus reads the status of the run from the database
+func runStatus(t *testing.T, DB *db.Queries, runID int64) RunStatus {
+	t.Helper()
+	status, err := DB.GetRunStatusByID(context.Background(), runID)
+	if err != nil {
+		t.Fatalf("cannot read the status of run %d: %v", runID, err)
+	}
+	return RunStatus(status)
+}
+
+// runEventTypes lists the types of the events of the run in their order
+func runEventTypes(t *testing.T, DB *db.Queries, runID int64) []string {
+	t.Helper()
+	events, err := DB.GetRunEvents(context.Background(), runID)
+	if err != nil {
+		t.Fatalf("cannot read the events of run %d: %v", runID, err)
+	}
+	types := make([]string, 0, len(events))
+	for _, event := range events {
+		types = append(types, event.Type)
+	}
+	return types
+}
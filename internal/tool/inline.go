@@ -0,0 +1,131 @@
+package tool
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/hydrocode-de/tool-spec-go/validate"
+	"github.com/spf13/viper"
+)
+
+// InlineFile records a file of a dataset which was given with its content
+type InlineFile struct {
+	Filename string `json:"filename"`
+	Size     int64  `json:"size"`
+	Checksum string `json:"checksum"`
+	// Path is the decoded file in temp_path, which is copied into /in
+	Path string `json:"-"`
+}
+
+// stageInlineDatasets decodes the files given with their content into temp_path and
+// replaces them by their paths, so that they are validated and staged like any other
+// file. Files larger than datasets.max_inline_bytes are reported instead.
+func stageInlineDatasets(datasets map[string]DatasetRef) (map[string]DatasetRef, map[string][]InlineFile, []error) {
+	staged := make(map[string]DatasetRef, len(datasets))
+	inlined := make(map[string][]InlineFile)
+	errs := make([]error, 0)
+	maxBytes := viper.GetInt64("datasets.max_inline_bytes")
+
+	for name, ref := range datasets {
+		staged[name] = ref
+		if ref.inline == nil {
+			continue
+		}
+		paths := make([]string, len(ref.Paths))
+		copy(paths, ref.Paths)
+		for i, inline := range ref.inline {
+			if inline == nil {
+				continue
+			}
+			dataErr := func(errType validate.ErrorType, expected string, actual string, message string) {
+				errs = append(errs, &validate.ValidationError{
+					Field:    validate.Data,
+					Name:     name,
+					Type:     errType,
+					Expected: expected,
+					Actual:   actual,
+					Message:  message,
+				})
+			}
+
+			if inline.Filename == "" || inline.Filename != path.Base(inline.Filename) || inline.Filename == ".." || strings.ContainsRune(inline.Filename, '\\') {
+				dataErr(validate.WrongType, "a file name without directories", inline.Filename, fmt.Sprintf("the inline file of data %s needs a filename without directories", name))
+				continue
+			}
+			tooLarge := func(size int) {
+				dataErr(validate.OutOfRange, fmt.Sprintf("<= %d bytes", maxBytes), fmt.Sprintf("%d bytes", size), fmt.Sprintf("the inline file %s of data %s exceeds the %d bytes allowed inline. Upload it with POST /files and pass the returned path instead", inline.Filename, name, maxBytes))
+			}
+			// the padding makes up at most two bytes, so oversized content is rejected before it is decoded
+			if minSize := base64.StdEncoding.DecodedLen(len(inline.ContentBase64)) - 2; maxBytes > 0 && int64(minSize) > maxBytes {
+				tooLarge(minSize)
+				continue
+			}
+			content, err := base64.StdEncoding.DecodeString(inline.ContentBase64)
+			if err != nil {
+				dataErr(validate.WrongType, "base64 encoded content", inline.Filename, fmt.Sprintf("the content of the inline file %s of data %s is not valid base64: %v", inline.Filename, name, err))
+				continue
+			}
+			if maxBytes > 0 && int64(len(content)) > maxBytes {
+				tooLarge(len(content))
+				continue
+			}
+			filePath, err := writeInlineFile(inline.Filename, content)
+			if err != nil {
+				dataErr(DataNotReadable, "a writable temp_path", inline.Filename, fmt.Sprintf("the inline file %s of data %s could not be written: %v", inline.Filename, name, err))
+				continue
+			}
+			checksum := sha256.Sum256(content)
+			paths[i] = filePath
+			inlined[name] = append(inlined[name], InlineFile{
+				Filename: inline.Filename,
+				Size:     int64(len(content)),
+				Checksum: "sha256:" + hex.EncodeToString(checksum[:]),
+				Path:     filePath,
+			})
+		}
+		staged[name] = DatasetRef{Paths: paths, List: ref.List, root: ref.root}
+	}
+	return staged, inlined, errs
+}
+
+// removeInlineFiles removes the inline files staged for the options, each with its directory
+func removeInlineFiles(opts *CreateRunOptions) {
+	for _, inlined := range opts.InlineDatasets {
+		for _, file := range inlined {
+			if err := os.RemoveAll(filepath.Dir(file.Path)); err != nil {
+				log.Printf("failed to remove the staged inline file %s: %v", file.Path, err)
+			}
+		}
+	}
+}
+
+// writeInlineFile writes the content into a new directory below temp_path/inline
+func writeInlineFile(filename string, content []byte) (string, error) {
+	baseDir := filepath.Join(viper.GetString("temp_path"), "inline")
+	if err := os.MkdirAll(baseDir, 0755); err != nil {
+		return "", err
+	}
+	dir, err := os.MkdirTemp(baseDir, "")
+	if err != nil {
+		return "", err
+	}
+	filePath := filepath.Join(dir, filename)
+	return filePath, os.WriteFile(filePath, content, 0644)
+}
+
+// inlineFile returns the record of a staged inline file of a dataset
+func inlineFile(inlined []InlineFile, filePath string) (InlineFile, bool) {
+	for _, file := range inlined {
+		if file.Path == filePath {
+			return file, true
+		}
+	}
+	return InlineFile{}, false
+}
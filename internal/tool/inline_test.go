@@ -0,0 +1,315 @@
+package tool
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/hydrocode-de/gorun/internal/cache"
+	"github.com/hydrocode-de/gorun/internal/dockertest"
+	"github.com/hydrocode-de/tool-spec-go/validate"
+	"github.com/spf13/viper"
+)
+
+// inlineRef parses a dataset of the payload of a run
+func inlineRef(t *testing.T, payload string) DatasetRef {
+	t.Helper()
+	var ref DatasetRef
+	if err := json.Unmarshal([]byte(payload), &ref); err != nil {
+		t.Fatalf("cannot parse the dataset %s: %v", payload, err)
+	}
+	return ref
+}
+
+func encoded(content string) string {
+	return base64.StdEncoding.EncodeToString([]byte(content))
+}
+
+func TestInlineDatasetJSON(t *testing.T) {
+	tests := []struct {
+		name      string
+		payload   string
+		wantPaths []string
+	}{
+		{"single file", `{"content_base64": "` + encoded("a,b\n") + `", "filename": "table.csv"}`, []string{"inline:table.csv"}},
+		{"list", `["/data/a.csv", {"content_base64": "` + encoded("a") + `", "filename": "b.csv"}]`, []string{"/data/a.csv", "inline:b.csv"}},
+		{"path", `"/data/a.csv"`, []string{"/data/a.csv"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ref := inlineRef(t, tt.payload)
+			if strings.Join(ref.Paths, ",") != strings.Join(tt.wantPaths, ",") {
+				t.Errorf("the dataset has the paths %v, want %v", ref.Paths, tt.wantPaths)
+			}
+			// the payload is written back as it was given, with the content of the inline files
+			written, err := json.Marshal(ref)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got, want interface{}
+			json.Unmarshal(written, &got)
+			json.Unmarshal([]byte(tt.payload), &want)
+			if gotJSON, wantJSON := mustJSON(t, got), mustJSON(t, want); gotJSON != wantJSON {
+				t.Errorf("the dataset is written as %s, want %s", gotJSON, wantJSON)
+			}
+		})
+	}
+
+	for _, payload := range []string{`{"filename": "empty.csv"}`, `{"content_base64": 1}`, `42`, `["a", 1]`} {
+		var ref DatasetRef
+		if err := json.Unmarshal([]byte(payload), &ref); err == nil {
+			t.Errorf("the dataset %s was accepted as %+v", payload, ref)
+		}
+	}
+}
+
+func mustJSON(t *testing.T, v interface{}) string {
+	t.Helper()
+	raw, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(raw)
+}
+
+func TestStageInlineDatasets(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+		// wantErr is the type of the validation error, if the file is refused
+		wantErr    validate.ErrorType
+		wantSubstr string
+	}{
+		{name: "small file", payload: `{"content_base64": "` + encoded("hello") + `", "filename": "input.txt"}`},
+		{name: "at the limit", payload: `{"content_base64": "` + encoded(strings.Repeat("x", 64)) + `", "filename": "input.txt"}`},
+		{
+			name:       "over the limit",
+			payload:    `{"content_base64": "` + encoded(strings.Repeat("x", 65)) + `", "filename": "input.txt"}`,
+			wantErr:    validate.OutOfRange,
+			wantSubstr: "Upload it with POST /files",
+		},
+		{
+			// oversized content is refused by its length, before it is decoded
+			name:       "oversized invalid content",
+			payload:    `{"content_base64": "` + strings.Repeat("!", 1024) + `", "filename": "input.txt"}`,
+			wantErr:    validate.OutOfRange,
+			wantSubstr: "exceeds the 64 bytes allowed inline",
+		},
+		{
+			name:       "invalid content",
+			payload:    `{"content_base64": "not base64!", "filename": "input.txt"}`,
+			wantErr:    validate.WrongType,
+			wantSubstr: "is not valid base64",
+		},
+		{
+			name:       "directories in the filename",
+			payload:    `{"content_base64": "` + encoded("x") + `", "filename": "../input.txt"}`,
+			wantErr:    validate.WrongType,
+			wantSubstr: "needs a filename without directories",
+		},
+		{
+			name:       "missing filename",
+			payload:    `{"content_base64": "` + encoded("x") + `"}`,
+			wantErr:    validate.WrongType,
+			wantSubstr: "needs a filename without directories",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setTestConfig(t)
+			viper.Set("datasets.max_inline_bytes", 64)
+			datasets := map[string]DatasetRef{"input": inlineRef(t, tt.payload), "other": SinglePath("/data/other.txt")}
+
+			staged, inlined, errs := stageInlineDatasets(datasets)
+			if staged["other"].Paths[0] != "/data/other.txt" {
+				t.Errorf("the dataset given by path was changed to %v", staged["other"].Paths)
+			}
+			if tt.wantErr != "" {
+				var validationErr *validate.ValidationError
+				if len(errs) != 1 || !errors.As(errs[0], &validationErr) || validationErr.Type != tt.wantErr || !strings.Contains(validationErr.Message, tt.wantSubstr) {
+					t.Fatalf("the inline file returned the errors %v, want %s with %q", errs, tt.wantErr, tt.wantSubstr)
+				}
+				if validationErr.Field != validate.Data || validationErr.Name != "input" {
+					t.Errorf("the error is of %s %s, want of the data input", validationErr.Field, validationErr.Name)
+				}
+				if len(inlined["input"]) != 0 {
+					t.Errorf("the refused file was staged: %v", inlined["input"])
+				}
+				return
+			}
+			if len(errs) != 0 {
+				t.Fatalf("staging the inline file failed: %v", errs)
+			}
+			files := inlined["input"]
+			if len(files) != 1 || staged["input"].Paths[0] != files[0].Path {
+				t.Fatalf("the inline file was staged as %v, the dataset has the paths %v", files, staged["input"].Paths)
+			}
+			content, err := os.ReadFile(files[0].Path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checksum := sha256.Sum256(content)
+			if files[0].Filename != "input.txt" || files[0].Size != int64(len(content)) || files[0].Checksum != "sha256:"+hex.EncodeToString(checksum[:]) {
+				t.Errorf("the inline file is recorded as %+v", files[0])
+			}
+			// the files are staged in temp_path, each in its own directory
+			if dir := filepath.Dir(filepath.Dir(files[0].Path)); dir != filepath.Join(viper.GetString("temp_path"), "inline") || filepath.Base(files[0].Path) != "input.txt" {
+				t.Errorf("the inline file was staged at %s", files[0].Path)
+			}
+		})
+	}
+}
+
+// the inline files are copied into /in like any other dataset, also if the run mounts its
+// datasets, and the manifest records them with their checksum
+func TestCreateRunWithInlineData(t *testing.T) {
+	for _, dataMode := range []string{DataModeCopy, DataModeMount} {
+		t.Run(dataMode, func(t *testing.T) {
+			setTestConfig(t)
+			DB := newTestDB(t)
+			addTestImage(dockertest.New(t), writeMessage)
+			specCache := &cache.Cache{}
+			specCache.Reset()
+
+			runData, err := ValidateAndCreateRun(context.Background(), DB, specCache, CreateRunOptions{
+				Image:      testImage,
+				Name:       testTool,
+				Parameters: map[string]interface{}{"message": "hi"},
+				Datasets:   map[string]DatasetRef{"input": inlineRef(t, `{"content_base64": "`+encoded("inline data")+`", "filename": "input.txt"}`)},
+				DataMode:   dataMode,
+			}, testUser)
+			if err != nil {
+				t.Fatal(err)
+			}
+			run, err := FromDBRun(runData)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var manifest InputManifest
+			readJSON(t, filepath.Join(run.Mounts["/in"], "_manifest.json"), &manifest)
+			source := manifest.Datasets["input"]
+			if !source.Inline || !strings.HasPrefix(source.Checksum, "sha256:") {
+				t.Errorf("the manifest records the inline file as %+v", source)
+			}
+			content, err := os.ReadFile(filepath.Join(run.Mounts["/in"], strings.TrimPrefix(source.ContainerPath, "/in/")))
+			if err != nil || string(content) != "inline data" {
+				t.Errorf("the inline file in /in has the content %q, %v", content, err)
+			}
+		})
+	}
+}
+
+// a payload which fails the checks needing no dataset is refused before its inline files
+// are written
+func TestValidateRunChecksThePayloadFirst(t *testing.T) {
+	setTestConfig(t)
+	DB := newTestDB(t)
+	addTestImage(dockertest.New(t), writeMessage)
+	specCache := &cache.Cache{}
+	specCache.Reset()
+	inline := inlineRef(t, `{"content_base64": "`+encoded("inline data")+`", "filename": "input.txt"}`)
+
+	tests := []struct {
+		name string
+		opts CreateRunOptions
+		// wantField is the field of the error
+		wantField string
+	}{
+		{"invalid parameter", CreateRunOptions{Parameters: map[string]interface{}{"message": "hi", "count": "many"}}, string(validate.Parameters)},
+		{"invalid priority", CreateRunOptions{Priority: "urgent"}, "priority"},
+		{"invalid retries", CreateRunOptions{MaxRetries: -1}, "max_retries"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := tt.opts
+			opts.Image, opts.Name = testImage, testTool
+			if opts.Parameters == nil {
+				opts.Parameters = map[string]interface{}{"message": "hi"}
+			}
+			opts.Datasets = map[string]DatasetRef{"input": inline}
+			_, err := ValidateAndCreateRun(context.Background(), DB, specCache, opts, testUser)
+			var validationErr *ValidationError
+			if !errors.As(err, &validationErr) {
+				t.Fatalf("the payload returned %v, want a validation error", err)
+			}
+			fields := make([]string, 0, len(validationErr.Errors))
+			for _, fieldErr := range validationErr.Errors {
+				var e *FieldError
+				if errors.As(fieldErr, &e) {
+					fields = append(fields, string(e.Field))
+				}
+			}
+			if len(fields) != 1 || fields[0] != tt.wantField {
+				t.Errorf("the payload was refused for %v, want only %s", fields, tt.wantField)
+			}
+			if _, err := os.Stat(filepath.Join(viper.GetString("temp_path"), "inline")); !os.IsNotExist(err) {
+				t.Errorf("the inline files of the refused payload were written: %v", err)
+			}
+		})
+	}
+}
+
+// tempFiles lists the files below temp_path
+func tempFiles(t *testing.T) []string {
+	t.Helper()
+	found := make([]string, 0)
+	err := filepath.WalkDir(viper.GetString("temp_path"), func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			found = append(found, p)
+		}
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	return found
+}
+
+// a dry run leaves no inline file behind and counts against the rate limit
+func TestPlanRunWithInlineData(t *testing.T) {
+	setTestConfig(t)
+	DB := newTestDB(t)
+	resetRunBuckets(t)
+	viper.Set("limits.runs_per_minute", 1)
+	addTestImage(dockertest.New(t), writeMessage)
+	specCache := &cache.Cache{}
+	specCache.Reset()
+	// a plan only reads cached images
+	if _, err := LoadToolSpec(context.Background(), DB, specCache, testImage+"::"+testTool); err != nil {
+		t.Fatal(err)
+	}
+	before := tempFiles(t)
+
+	opts := CreateRunOptions{
+		Image:      testImage,
+		Name:       testTool,
+		Parameters: map[string]interface{}{"message": "hi"},
+		Datasets:   map[string]DatasetRef{"input": inlineRef(t, `{"content_base64": "`+encoded("inline data")+`", "filename": "input.txt"}`)},
+	}
+	plan, err := PlanRun(context.Background(), DB, specCache, opts, testUser)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if source := plan.Manifest.Datasets["input"]; !source.Inline {
+		t.Errorf("the plan records the inline file as %+v", source)
+	}
+	if after := tempFiles(t); !slices.Equal(after, before) {
+		t.Errorf("the plan left the files %v in temp_path, before there were %v", after, before)
+	}
+
+	if _, err := PlanRun(context.Background(), DB, specCache, opts, testUser); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("the second plan within the limit of one run returned %v, want %v", err, ErrRateLimited)
+	}
+}
@@ -0,0 +1,62 @@
+package tool
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+
+	"github.com/hydrocode-de/gorun/internal/db"
+	"github.com/hydrocode-de/gorun/internal/helper"
+)
+
+// RunInputs returns the inputs.json the run was created with. Runs created before the inputs
+// were recorded fall back to the file in the /in mount, as long as it was not purged.
+func RunInputs(ctx context.Context, DB *db.Queries, run Tool) ([]byte, error) {
+	content, err := DB.GetRunInputs(ctx, run.ID)
+	if err == nil {
+		return []byte(content), nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	inputs, err := os.ReadFile(path.Join(run.Mounts["/in"], "inputs.json"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("the inputs of run %d were not recorded: %w", run.ID, ErrNotFound)
+	}
+	return inputs, err
+}
+
+// RedactInputs masks the parameters named like secrets, the same way gorun config show does.
+// The datasets and any other fields of the inputs are kept.
+func RedactInputs(inputs []byte) ([]byte, error) {
+	var file map[string]map[string]json.RawMessage
+	if err := json.Unmarshal(inputs, &file); err != nil {
+		return nil, fmt.Errorf("the recorded inputs are not a valid inputs.json: %w", err)
+	}
+	for toolName, toolInput := range file {
+		raw, ok := toolInput["parameters"]
+		if !ok {
+			continue
+		}
+		var parameters map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &parameters); err != nil {
+			return nil, fmt.Errorf("the recorded parameters of %s are invalid: %w", toolName, err)
+		}
+		for name := range parameters {
+			if helper.IsSecretName(name) {
+				parameters[name] = json.RawMessage(`"[redacted]"`)
+			}
+		}
+		redacted, err := json.Marshal(parameters)
+		if err != nil {
+			return nil, err
+		}
+		toolInput["parameters"] = redacted
+	}
+	return json.MarshalIndent(file, "", "\t")
+}
@@ -0,0 +1,75 @@
+package tool
+
+import (
+	"bytes"
+	"context"
+	"log"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/hydrocode-de/gorun/internal/events"
+)
+
+// LogLine is published on the logs channel of a run for every line the container writes
+type LogLine struct {
+	Stream string `json:"stream"`
+	Line   string `json:"line"`
+}
+
+// linePublisher splits a log stream into lines and publishes them
+type linePublisher struct {
+	channel string
+	stream  string
+	partial []byte
+}
+
+func (p *linePublisher) Write(b []byte) (int, error) {
+	n := len(b)
+	for {
+		newline := bytes.IndexByte(b, '\n')
+		if newline < 0 {
+			break
+		}
+		p.publish(append(p.partial, b[:newline]...))
+		p.partial, b = p.partial[:0], b[newline+1:]
+	}
+	// overly long lines are published in pieces instead of growing the buffer
+	p.partial = append(p.partial, b...)
+	if len(p.partial) >= logTailLineLimit*4 {
+		p.flush()
+	}
+	return n, nil
+}
+
+func (p *linePublisher) publish(line []byte) {
+	events.Publish(p.channel, "log", LogLine{Stream: p.stream, Line: sanitizeLogLine(string(line))})
+}
+
+func (p *linePublisher) flush() {
+	if len(p.partial) > 0 {
+		p.publish(p.partial)
+		p.partial = p.partial[:0]
+	}
+}
+
+// streamLogs follows the logs of the running container and publishes them on the logs
+// channel of the run, until the container stopped. The log files of the run are written
+// independently once the container exited.
+func streamLogs(ctx context.Context, c *client.Client, runID int64, containerID string) {
+	reader, err := c.ContainerLogs(ctx, containerID, container.LogsOptions{ShowStdout: true, ShowStderr: true, Follow: true})
+	if err != nil {
+		log.Printf("could not follow the logs of run %d: %v", runID, err)
+		return
+	}
+	defer reader.Close()
+
+	channel := events.RunChannel(runID, events.TopicLogs)
+	stdout := &linePublisher{channel: channel, stream: "stdout"}
+	stderr := &linePublisher{channel: channel, stream: "stderr"}
+	if _, err := stdcopy.StdCopy(stdout, stderr, reader); err != nil && ctx.Err() == nil {
+		log.Printf("stopped following the logs of run %d: %v", runID, err)
+	}
+	stdout.flush()
+	stderr.flush()
+}
@@ -0,0 +1,209 @@
+package tool
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"sync/atomic"
+	"unicode"
+
+	"github.com/hydrocode-de/gorun/internal/db"
+)
+
+// logWriter streams a container log into a file. Once more than limit bytes were
+// written, only the first and the last limit/2 bytes are kept. The tail is written
+// into a ring file on disk, so that the log is never held in memory.
+type logWriter struct {
+	name    string
+	file    *os.File
+	ring    *os.File
+	limit   int64
+	written int64
+}
+
+func newLogWriter(dir string, name string, limit int64) (*logWriter, error) {
+	file, err := os.OpenFile(path.Join(dir, name), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &logWriter{name: name, file: file, limit: limit}, nil
+}
+
+func (l *logWriter) headLimit() int64 {
+	return l.limit / 2
+}
+
+func (l *logWriter) tailLimit() int64 {
+	return l.limit - l.headLimit()
+}
+
+func (l *logWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	if l.limit <= 0 {
+		written, err := l.file.Write(p)
+		l.written += int64(written)
+		return written, err
+	}
+
+	// the head goes straight into the log file
+	if l.written < l.headLimit() {
+		chunk := min(int64(len(p)), l.headLimit()-l.written)
+		if _, err := l.file.Write(p[:chunk]); err != nil {
+			return 0, err
+		}
+		l.written += chunk
+		p = p[chunk:]
+	}
+
+	// everything after the head is kept in the ring file, which holds the last tailLimit bytes
+	for len(p) > 0 {
+		if l.ring == nil {
+			ring, err := os.CreateTemp(path.Dir(l.file.Name()), "."+l.name+".tail-*")
+			if err != nil {
+				return 0, err
+			}
+			l.ring = ring
+		}
+		offset := (l.written - l.headLimit()) % l.tailLimit()
+		chunk := min(int64(len(p)), l.tailLimit()-offset)
+		if _, err := l.ring.WriteAt(p[:chunk], offset); err != nil {
+			return 0, err
+		}
+		l.written += chunk
+		p = p[chunk:]
+	}
+	return n, nil
+}
+
+// truncatedLogs counts the logs truncated since the process started
+var truncatedLogs atomic.Int64
+
+// TruncatedLogCount returns the number of run logs truncated since the process started
+func TruncatedLogCount() int64 {
+	return truncatedLogs.Load()
+}
+
+// Truncated reports how many bytes of the log were dropped
+func (l *logWriter) Truncated() int64 {
+	if l.limit <= 0 || l.written <= l.limit {
+		return 0
+	}
+	return l.written - l.limit
+}
+
+// Close appends the tail to the log file, separated by a marker line if bytes were dropped
+func (l *logWriter) Close() error {
+	defer l.file.Close()
+	if l.ring == nil {
+		return nil
+	}
+	defer os.Remove(l.ring.Name())
+	defer l.ring.Close()
+
+	tailSize := l.written - l.headLimit()
+	start := int64(0)
+	if dropped := l.Truncated(); dropped > 0 {
+		if _, err := fmt.Fprintf(l.file, "\n[gorun] ... %d bytes of %s were truncated, the log exceeded run.max_log_bytes ...\n", dropped, l.name); err != nil {
+			return err
+		}
+		tailSize = l.tailLimit()
+		start = (l.written - l.headLimit()) % l.tailLimit()
+	}
+
+	// the oldest bytes of a full ring start right after the last write
+	if _, err := io.Copy(l.file, io.NewSectionReader(l.ring, start, tailSize-start)); err != nil {
+		return err
+	}
+	if start > 0 {
+		if _, err := io.Copy(l.file, io.NewSectionReader(l.ring, 0, start)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// TruncatedLogs returns the names of the logs of a run which were truncated
+func TruncatedLogs(ctx context.Context, DB *db.Queries, runID int64) map[string]bool {
+	truncated := make(map[string]bool)
+	events, err := DB.GetRunEvents(ctx, runID)
+	if err != nil {
+		return truncated
+	}
+	for _, event := range events {
+		if event.Type != EventLogTruncated {
+			continue
+		}
+		if name, _, ok := strings.Cut(event.Message, " "); ok {
+			truncated[name] = true
+		}
+	}
+	return truncated
+}
+
+const (
+	// logTailByteLimit caps how much of a log is read for its tail
+	logTailByteLimit = 64 * 1024
+	// logTailLineLimit caps the length of a single line of a log tail
+	logTailLineLimit = 1000
+)
+
+// LogTail returns the last lines of a log in the /out mount of the run. The
+// second return value is false if the log does not exist. Invalid UTF-8 and
+// control characters are replaced and overly long lines are cut.
+func (t *Tool) LogTail(name string, lines int) (string, bool, error) {
+	hostOut, ok := t.Mounts["/out"]
+	if !ok {
+		return "", false, nil
+	}
+	file, err := os.Open(path.Join(hostOut, name))
+	if os.IsNotExist(err) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return "", false, err
+	}
+	offset := max(info.Size()-logTailByteLimit, 0)
+	content, err := io.ReadAll(io.NewSectionReader(file, offset, info.Size()-offset))
+	if err != nil {
+		return "", false, err
+	}
+	// from within the file, the first line is most likely incomplete
+	if offset > 0 {
+		if newline := bytes.IndexByte(content, '\n'); newline >= 0 {
+			content = content[newline+1:]
+		}
+	}
+
+	tail := strings.Split(strings.TrimRight(string(content), "\n"), "\n")
+	if lines > 0 && len(tail) > lines {
+		tail = tail[len(tail)-lines:]
+	}
+	for i, line := range tail {
+		tail[i] = sanitizeLogLine(line)
+	}
+	return strings.Join(tail, "\n"), true, nil
+}
+
+func sanitizeLogLine(line string) string {
+	line = strings.ToValidUTF8(strings.TrimSuffix(line, "\r"), "\uFFFD")
+	line = strings.Map(func(r rune) rune {
+		if r != '\t' && unicode.IsControl(r) {
+			return '\uFFFD'
+		}
+		return r
+	}, line)
+	if runes := []rune(line); len(runes) > logTailLineLimit {
+		line = string(runes[:logTailLineLimit]) + "…"
+	}
+	return line
+}
@@ -0,0 +1,180 @@
+package tool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+
+	"github.com/docker/docker/client"
+	"github.com/hydrocode-de/gorun/internal/cache"
+	"github.com/hydrocode-de/gorun/internal/db"
+	"github.com/hydrocode-de/gorun/internal/specversion"
+	"github.com/hydrocode-de/gorun/internal/toolImage"
+	toolspec "github.com/hydrocode-de/tool-spec-go"
+	"github.com/spf13/viper"
+	"golang.org/x/sync/singleflight"
+)
+
+// concurrent cache misses for the same image share a single probe of the Docker daemon
+var imageLoads singleflight.Group
+
+// lookupToolSpec returns the spec of the tool from the cache. If loadOnDemand is set and
+// tools.load_on_demand is not disabled, images which are not cached yet are read from the
+// Docker daemon, bounded by tools.load_timeout. If the image does not provide the tool,
+// a ToolNotFoundError lists the tools it provides instead.
+func lookupToolSpec(ctx context.Context, Cache *cache.Cache, runtime string, imageName string, toolName string, loadOnDemand bool) (*toolspec.ToolSpec, error) {
+	toolSlug := fmt.Sprintf("%s::%s", imageName, toolName)
+	if spec, ok := Cache.GetToolSpec(toolSlug); ok {
+		return spec, nil
+	}
+
+	_, cached := Cache.GetImageSpec(imageName)
+	if !cached && !loadOnDemand {
+		return nil, &ToolNotFoundError{Image: imageName, Tool: toolName, AvailableTools: []string{}, Cause: errors.New("the image is not cached yet")}
+	}
+	if !cached && viper.GetBool("tools.load_on_demand") {
+		if err := loadImageSpec(ctx, Cache, runtime, imageName, toolSlug); err != nil {
+			if client.IsErrConnectionFailed(err) {
+				return nil, err
+			}
+			return nil, &ToolNotFoundError{Image: imageName, Tool: toolName, AvailableTools: []string{}, Cause: err}
+		}
+		if spec, ok := Cache.GetToolSpec(toolSlug); ok {
+			return spec, nil
+		}
+	}
+
+	return nil, &ToolNotFoundError{Image: imageName, Tool: toolName, AvailableTools: availableTools(Cache, imageName)}
+}
+
+// LoadToolSpec returns the spec of the tool slug <image>::<tool>. An image which is not
+// cached yet, e.g. while the initial scan is running, is read on demand if the image
+// policy allows it.
+func LoadToolSpec(ctx context.Context, DB *db.Queries, Cache *cache.Cache, toolSlug string) (*toolspec.ToolSpec, error) {
+	imageName, toolName, ok := strings.Cut(toolSlug, "::")
+	if !ok {
+		return nil, fmt.Errorf("the tool %s was not found in the cache. Try to call like <image-name>::<tool-name>: %w", toolSlug, toolImage.ErrToolNotFound)
+	}
+	policy, err := toolImage.LoadPolicy(ctx, DB)
+	if err != nil {
+		return nil, err
+	}
+	if err := policy.Check(ctx, imageName); err != nil {
+		return nil, err
+	}
+	return lookupToolSpec(ctx, Cache, RuntimeDocker, imageName, toolName, true)
+}
+
+// loadImageSpec reads the tool-spec of the image into the cache. The probe is not bound
+// to the context of a single request, as other requests may wait for it as well.
+func loadImageSpec(ctx context.Context, Cache *cache.Cache, runtime string, imageName string, toolSlug string) error {
+	result := imageLoads.DoChan(runtime+"/"+imageName, func() (interface{}, error) {
+		if _, ok := Cache.GetImageSpec(imageName); ok {
+			return nil, nil
+		}
+		loadCtx, cancel := context.WithTimeout(context.Background(), viper.GetDuration("tools.load_timeout"))
+		defer cancel()
+
+		if runtime == RuntimeApptainer {
+			log.Printf("the image %s is not cached, reading its tool-spec from the SIF", imageName)
+			err := toolImage.LoadApptainerToolSpec(loadCtx, toolSlug, Cache)
+			if errors.Is(err, toolImage.ErrToolNotFound) {
+				return nil, nil
+			}
+			return nil, err
+		}
+
+		c, err := RuntimeClient(runtime)
+		if err != nil {
+			return nil, err
+		}
+
+		log.Printf("the image %s is not cached, reading its tool-spec", imageName)
+		_, err = toolImage.LoadToolSpec(loadCtx, c, toolSlug, Cache)
+		// the image was read, even if it does not provide this tool
+		if errors.Is(err, toolImage.ErrToolNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	})
+
+	select {
+	case res := <-result:
+		return res.Err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// refreshStaleSpec reads the spec of a local image again if its tag now points to another
+// image than the cached spec was read from, bounded by tools.load_timeout. It returns a
+// note on the refresh for the run events, or an empty string if the spec is current.
+func refreshStaleSpec(ctx context.Context, Cache *cache.Cache, runtime string, imageName string) (string, error) {
+	if !viper.GetBool("tools.check_image_id") || runtime == RuntimeApptainer {
+		return "", nil
+	}
+	origin, ok := Cache.GetOrigin(imageName)
+	if !ok || origin.Source != cache.SourceLocal || origin.ImageID == "" {
+		return "", nil
+	}
+	c, err := RuntimeClient(runtime)
+	if err != nil {
+		return "", err
+	}
+	currentID, err := toolImage.ImageID(ctx, c, imageName)
+	if err != nil || currentID == origin.ImageID {
+		// a removed image is left to the validation and the pull of the run
+		return "", nil
+	}
+
+	log.Printf("the image %s was rebuilt, reading its tool-spec again", imageName)
+	result := imageLoads.DoChan("refresh/"+runtime+"/"+imageName, func() (interface{}, error) {
+		loadCtx, cancel := context.WithTimeout(context.Background(), viper.GetDuration("tools.load_timeout"))
+		defer cancel()
+		return nil, toolImage.RefreshToolSpec(loadCtx, c, imageName, Cache)
+	})
+	select {
+	case res := <-result:
+		if res.Err != nil {
+			return "", fmt.Errorf("the image %s was rebuilt and its tool-spec could not be read again: %w", imageName, res.Err)
+		}
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+	return fmt.Sprintf("the image %s was rebuilt from %s to %s, its tool-spec was read again", imageName, shortImageID(origin.ImageID), shortImageID(currentID)), nil
+}
+
+// shortImageID shortens an image ID like the Docker CLI
+func shortImageID(id string) string {
+	id = strings.TrimPrefix(id, "sha256:")
+	if len(id) > 12 {
+		return id[:12]
+	}
+	return id
+}
+
+// readImageSpec reads the tool-spec from the image itself, through the runtime of the run
+func readImageSpec(ctx context.Context, runtime string, imageName string) (toolspec.SpecFile, specversion.Compatibility, error) {
+	if runtime == RuntimeApptainer {
+		return toolImage.ReadApptainerToolSpec(ctx, imageName)
+	}
+	c, err := RuntimeClient(runtime)
+	if err != nil {
+		return toolspec.SpecFile{}, specversion.Compatibility{}, err
+	}
+	return toolImage.ReadToolSpecWith(ctx, c, imageName)
+}
+
+func availableTools(Cache *cache.Cache, imageName string) []string {
+	names := make([]string, 0)
+	if spec, ok := Cache.GetImageSpec(imageName); ok {
+		for name := range spec.Tools {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	return names
+}
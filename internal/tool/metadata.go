@@ -0,0 +1,138 @@
+package tool
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path"
+	"time"
+
+	"github.com/docker/docker/client"
+	"github.com/hydrocode-de/gorun/version"
+)
+
+// GotapMetadata is the provenance information found in /out/_metadata.json.
+// It is written by gotap, or synthesized by gorun for images without gotap,
+// in which case GeneratedBy is set to "gorun" and the ExecutionEnvironment is added.
+type GotapMetadata struct {
+	GeneratedBy          string                 `json:"generated_by,omitempty"`
+	GorunVersion         string                 `json:"gorun_version,omitempty"`
+	GotapVersion         string                 `json:"gotap_version,omitempty"`
+	Tool                 string                 `json:"tool,omitempty"`
+	Image                string                 `json:"image,omitempty"`
+	ImageDigest          string                 `json:"image_digest,omitempty"`
+	Parameters           map[string]interface{} `json:"parameters,omitempty"`
+	Datasets             map[string]DatasetRef  `json:"datasets,omitempty"`
+	StartedAt            *time.Time             `json:"started_at,omitempty"`
+	FinishedAt           *time.Time             `json:"finished_at,omitempty"`
+	DurationMs           *int64                 `json:"duration_ms,omitempty"`
+	ExitCode             *int64                 `json:"exit_code,omitempty"`
+	Platform             string                 `json:"platform,omitempty"`
+	Emulated             bool                   `json:"emulated,omitempty"`
+	ExecutionEnvironment *ExecutionEnvironment  `json:"execution_environment,omitempty"`
+	Files                []string               `json:"files,omitempty"`
+	Validation           *GotapValidation       `json:"validation,omitempty"`
+	// Results are the result files the tool annotated, see ResultAnnotation
+	Results []ResultAnnotation `json:"results,omitempty"`
+}
+
+type GotapValidation struct {
+	Valid  bool     `json:"valid"`
+	Errors []string `json:"errors,omitempty"`
+}
+
+// UnmarshalJSON accepts the field names of older gotap releases as well and
+// derives the duration from the timestamps if it was not reported.
+func (m *GotapMetadata) UnmarshalJSON(data []byte) error {
+	type metadataAlias GotapMetadata
+	var raw struct {
+		metadataAlias
+		ToolName    string   `json:"tool_name"`
+		Duration    *float64 `json:"duration"`
+		ExitStatus  *int64   `json:"exit_status"`
+		OutputFiles []string `json:"output_files"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	*m = GotapMetadata(raw.metadataAlias)
+	if m.Tool == "" {
+		m.Tool = raw.ToolName
+	}
+	if m.ExitCode == nil {
+		m.ExitCode = raw.ExitStatus
+	}
+	if m.Files == nil {
+		m.Files = raw.OutputFiles
+	}
+	if m.DurationMs == nil && raw.Duration != nil {
+		durationMs := int64(*raw.Duration * 1000)
+		m.DurationMs = &durationMs
+	}
+	if m.DurationMs == nil && m.StartedAt != nil && m.FinishedAt != nil {
+		durationMs := m.FinishedAt.Sub(*m.StartedAt).Milliseconds()
+		m.DurationMs = &durationMs
+	}
+	return nil
+}
+
+func ParseGotapMetadata(raw string) (*GotapMetadata, error) {
+	var metadata GotapMetadata
+	if err := json.Unmarshal([]byte(raw), &metadata); err != nil {
+		return nil, err
+	}
+	return &metadata, nil
+}
+
+func imageDigest(ctx context.Context, c *client.Client, imageName string) string {
+	// runs executed without the Docker daemon have no image to inspect
+	if c == nil {
+		return ""
+	}
+	info, err := c.ImageInspect(ctx, imageName)
+	if err != nil {
+		return ""
+	}
+	if len(info.RepoDigests) > 0 {
+		return info.RepoDigests[0]
+	}
+	return info.ID
+}
+
+func writeGeneratedMetadata(ctx context.Context, c *client.Client, tool *Tool, env *ExecutionEnvironment, outDir string, startedAt time.Time, finishedAt time.Time, exitCode int64) error {
+	datasets := make(map[string]DatasetRef, len(tool.Data))
+	for name, ref := range tool.Data {
+		names := DatasetRef{List: ref.List}
+		for _, dataPath := range ref.Paths {
+			names.Paths = append(names.Paths, path.Base(dataPath))
+		}
+		datasets[name] = names
+	}
+
+	startedAt = startedAt.UTC()
+	finishedAt = finishedAt.UTC()
+	durationMs := finishedAt.Sub(startedAt).Milliseconds()
+	metadata := GotapMetadata{
+		GeneratedBy:          "gorun",
+		GorunVersion:         version.Version,
+		Tool:                 tool.Name,
+		Image:                tool.Image,
+		ImageDigest:          imageDigest(ctx, c, tool.Image),
+		Parameters:           tool.Parameters,
+		Datasets:             datasets,
+		StartedAt:            &startedAt,
+		FinishedAt:           &finishedAt,
+		DurationMs:           &durationMs,
+		ExitCode:             &exitCode,
+		Platform:             tool.Options.Platform,
+		Emulated:             tool.Options.Emulated,
+		ExecutionEnvironment: env,
+	}
+
+	metadataJSON, err := json.MarshalIndent(metadata, "", "\t")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path.Join(outDir, "_metadata.json"), metadataJSON, 0644)
+}
@@ -0,0 +1,105 @@
+package tool
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// the fixtures are the _metadata.json of the gotap releases before and after the field
+// renames, the one gorun synthesizes and one of a newer gotap with fields gorun does not know
+const metadataFixtures = "testdata/metadata"
+
+func readMetadataFixture(t *testing.T, name string) *GotapMetadata {
+	t.Helper()
+	raw, err := os.ReadFile(filepath.Join(metadataFixtures, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	metadata, err := ParseGotapMetadata(string(raw))
+	if err != nil {
+		t.Fatalf("%s is not parsed: %v", name, err)
+	}
+	return metadata
+}
+
+func TestParseGotapMetadata(t *testing.T) {
+	tests := []struct {
+		file         string
+		wantTool     string
+		wantExitCode int64
+		wantDuration int64
+		wantFiles    []string
+	}{
+		{file: "gotap-legacy.json", wantTool: "echo", wantExitCode: 0, wantDuration: 2500, wantFiles: []string{"result.json", "STDOUT.log"}},
+		// the duration is derived from the timestamps
+		{file: "gotap.json", wantTool: "echo", wantExitCode: 1, wantDuration: 1200, wantFiles: []string{"result.json"}},
+		{file: "gorun.json", wantTool: "echo", wantExitCode: 0, wantDuration: 4000},
+		{file: "gotap-unknown-fields.json", wantTool: "echo", wantExitCode: 0, wantDuration: 150},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			metadata := readMetadataFixture(t, tt.file)
+			if metadata.Tool != tt.wantTool {
+				t.Errorf("the tool is %q, want %q", metadata.Tool, tt.wantTool)
+			}
+			if metadata.ExitCode == nil || *metadata.ExitCode != tt.wantExitCode {
+				t.Errorf("the exit code is %v, want %d", metadata.ExitCode, tt.wantExitCode)
+			}
+			if metadata.DurationMs == nil || *metadata.DurationMs != tt.wantDuration {
+				t.Errorf("the duration is %v, want %d ms", metadata.DurationMs, tt.wantDuration)
+			}
+			if !slices.Equal(metadata.Files, tt.wantFiles) {
+				t.Errorf("the files are %v, want %v", metadata.Files, tt.wantFiles)
+			}
+		})
+	}
+}
+
+func TestParseGotapMetadataFields(t *testing.T) {
+	current := readMetadataFixture(t, "gotap.json")
+	if current.GotapVersion != "0.4.0" || current.Platform != "linux/amd64" || current.ImageDigest == "" {
+		t.Errorf("the image fields are parsed as %+v", current)
+	}
+	if want := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC); current.StartedAt == nil || !current.StartedAt.Equal(want) {
+		t.Errorf("the run started at %v, want %v", current.StartedAt, want)
+	}
+	if input, layers := current.Datasets["input"], current.Datasets["layers"]; !slices.Equal(input.Paths, []string{"input.csv"}) || input.List ||
+		!slices.Equal(layers.Paths, []string{"a.tif", "b.tif"}) || !layers.List {
+		t.Errorf("the datasets are parsed as %+v", current.Datasets)
+	}
+	if current.Validation == nil || current.Validation.Valid || !slices.Equal(current.Validation.Errors, []string{"iterations has to be at least 5"}) {
+		t.Errorf("the validation is parsed as %+v", current.Validation)
+	}
+	if want := []ResultAnnotation{{File: "result.json", Primary: true, Label: "Result", Source: "tool"}}; !slices.Equal(current.Results, want) {
+		t.Errorf("the results are parsed as %+v, want %+v", current.Results, want)
+	}
+
+	generated := readMetadataFixture(t, "gorun.json")
+	env := generated.ExecutionEnvironment
+	if generated.GeneratedBy != "gorun" || !generated.Emulated || env == nil || env.Engine != "docker" || env.CPUs != 8 || env.MemoryBytes != 16<<30 {
+		t.Errorf("the synthesized metadata is parsed as %+v, %+v", generated, env)
+	}
+
+	// the fields gorun does not know are dropped, the known ones around them are kept
+	newer := readMetadataFixture(t, "gotap-unknown-fields.json")
+	if newer.Validation == nil || !newer.Validation.Valid || len(newer.Results) != 1 || newer.Results[0].File != "result.json" {
+		t.Errorf("the metadata with unknown fields is parsed as %+v", newer)
+	}
+}
+
+func TestParseGotapMetadataRejectsMismatches(t *testing.T) {
+	for _, raw := range []string{
+		`not json`,
+		`["a", "list"]`,
+		`{"exit_code": "zero"}`,
+		`{"parameters": ["message"]}`,
+		`{"datasets": {"input": 42}}`,
+	} {
+		if metadata, err := ParseGotapMetadata(raw); err == nil {
+			t.Errorf("%s is parsed as %+v", raw, metadata)
+		}
+	}
+}
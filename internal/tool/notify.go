@@ -0,0 +1,105 @@
+package tool
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/hydrocode-de/gorun/internal/db"
+	"github.com/hydrocode-de/gorun/internal/notify"
+	"github.com/spf13/viper"
+)
+
+// the number of STDERR.log lines included in the notification of a failed run
+const notifyErrorTailLines = 20
+
+// runNotifiers returns the channels the owner of a run is notified through. Emails are
+// sent if the user opted in, chat messages whenever a Slack webhook or Matrix room is
+// configured for the user or globally. A notify option of false on the run disables all
+// channels, true sends an email regardless of the preference.
+func runNotifiers(ctx context.Context, DB *db.Queries, run Tool, userID string) ([]notify.Notifier, error) {
+	notifiers := make([]notify.Notifier, 0)
+	if run.Options.Notify != nil && !*run.Options.Notify {
+		return notifiers, nil
+	}
+	preference, err := DB.GetUserNotifications(ctx, userID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	wantsEmail := preference.Email || (run.Options.Notify != nil && *run.Options.Notify)
+	if email := notify.EmailFromConfig(); email != nil && wantsEmail {
+		notifiers = append(notifiers, email)
+	}
+	if slack := notify.SlackFromConfig(preference.SlackWebhookUrl); slack != nil {
+		notifiers = append(notifiers, slack)
+	}
+	if matrix := notify.MatrixFromConfig(preference.MatrixRoomID); matrix != nil {
+		notifiers = append(notifiers, matrix)
+	}
+	return notifiers, nil
+}
+
+// notifyCompletion notifies the owner of a completed run through all configured channels.
+// Failed deliveries are logged and recorded as run event, they never change the run.
+func notifyCompletion(ctx context.Context, DB *db.Queries, runID int64) {
+	owner, err := DB.GetRunOwner(ctx, runID)
+	if err != nil {
+		return
+	}
+	run, err := GetRun(ctx, DB, runID, owner)
+	if err != nil {
+		return
+	}
+	// cancelled runs were stopped on purpose and purged runs have no results anymore
+	if status := RunStatus(run.Status); status != StatusFinished && status != StatusErrored {
+		return
+	}
+	t, err := FromDBRun(run)
+	if err != nil {
+		return
+	}
+	notifiers, err := runNotifiers(ctx, DB, t, owner)
+	if err != nil {
+		log.Printf("failed to read the notification preferences of run %d: %v", runID, err)
+		return
+	}
+	if len(notifiers) == 0 {
+		return
+	}
+	user, err := DB.GetUserByID(ctx, owner)
+	if err != nil {
+		log.Printf("failed to load the owner of run %d: %v", runID, err)
+		return
+	}
+
+	n := notify.Notification{
+		RunID:     t.ID,
+		Tool:      t.Name,
+		Title:     t.Title,
+		Status:    t.Status,
+		Error:     t.Error,
+		ErrorKind: string(t.ErrorKind),
+		Email:     user.Email,
+	}
+	if t.DurationMs != nil {
+		n.Duration = time.Duration(*t.DurationMs) * time.Millisecond
+	}
+	if t.Status == string(StatusErrored) {
+		if tail, found, err := t.LogTail("STDERR.log", notifyErrorTailLines); err == nil && found {
+			n.ErrorTail = tail
+		}
+	}
+	if baseURL := strings.TrimSuffix(viper.GetString("notify.base_url"), "/"); baseURL != "" {
+		n.ResultsURL = fmt.Sprintf("%s/runs/%d/files/", baseURL, t.ID)
+	}
+
+	notify.Dispatch(ctx, owner, notifiers, n, func(runID int64, notifier string, err error) {
+		log.Printf("failed to send the %s notification of run %d: %v", notifier, runID, err)
+		RecordRunEvent(ctx, DB, runID, EventNotificationFailed, fmt.Sprintf("%s: %v", notifier, err))
+	})
+}
@@ -0,0 +1,72 @@
+package tool
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/docker/docker/client"
+	"github.com/hydrocode-de/gorun/internal/db"
+	"github.com/hydrocode-de/gorun/internal/events"
+	"github.com/hydrocode-de/gorun/internal/files"
+	"github.com/spf13/viper"
+)
+
+// outputLimit is the size /out of the run may reach. Runs created before the limit
+// existed fall back to run.max_output_bytes.
+func outputLimit(tool Tool) int64 {
+	if tool.Options.MaxOutputBytes > 0 {
+		return tool.Options.MaxOutputBytes
+	}
+	return viper.GetInt64("run.max_output_bytes")
+}
+
+// recordOutputBytes measures the size of the /out folder and keeps it with the stats of the run
+func recordOutputBytes(ctx context.Context, DB *db.Queries, runID int64, outDir string) (int64, error) {
+	size, err := files.DiskUsage(outDir)
+	if err != nil {
+		return 0, err
+	}
+	err = DB.SetRunOutputBytes(ctx, db.SetRunOutputBytesParams{
+		RunID:       runID,
+		OutputBytes: size,
+		UpdatedAt:   time.Now().UTC(),
+	})
+	if err != nil {
+		log.Printf("failed to persist the output size of run %d: %v", runID, err)
+	}
+	events.Publish(events.RunChannel(runID, events.TopicStats), "output_bytes", map[string]int64{"output_bytes": size})
+	return size, nil
+}
+
+// checkOutputSize measures /out of a running run and kills its container once it exceeds
+// the output limit. It tells if the run was killed. ssh runs write /out on the remote host,
+// it is measured once it was copied back.
+func (w *Watchdog) checkOutputSize(ctx context.Context, c *client.Client, run db.Run, containerID string) bool {
+	if runtimeOf(run) != RuntimeDocker {
+		return false
+	}
+	tool, err := FromDBRun(run)
+	if err != nil || tool.Mounts["/out"] == "" {
+		return false
+	}
+	size, err := recordOutputBytes(ctx, w.DB, run.ID, tool.Mounts["/out"])
+	if err != nil {
+		log.Printf("the watchdog failed to measure the output of run %d: %v", run.ID, err)
+		return false
+	}
+	limit := outputLimit(tool)
+	if limit <= 0 || size <= limit {
+		return false
+	}
+
+	err = fmt.Errorf("the /out folder grew to %s, beyond the limit of %s for the outputs of the run", formatMemory(size), formatMemory(limit))
+	RecordRunEvent(ctx, w.DB, run.ID, EventOutputExceeded, err.Error())
+	// mark the run first, so that RunTool does not classify the killed container as tool failure
+	w.reconcile(ctx, run, StatusErrored, ErrorOutputQuotaExceeded, err, "")
+	if err := c.ContainerKill(ctx, containerID, "SIGKILL"); err != nil {
+		log.Printf("failed to kill the container of run %d: %v", run.ID, err)
+	}
+	return true
+}
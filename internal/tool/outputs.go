@@ -0,0 +1,66 @@
+package tool
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/hydrocode-de/gorun/internal/db"
+	"github.com/hydrocode-de/gorun/internal/outputs"
+	"github.com/spf13/viper"
+)
+
+// verifyOutputs compares the out directory of a successful run with the outputs its spec
+// declares. Missing and unexpected files are recorded as run events. With run.strict_outputs,
+// missing required outputs fail the run.
+func verifyOutputs(ctx context.Context, opt RunToolOptions, outDir string) error {
+	declared := opt.Tool.Options.Outputs
+	if outDir == "" || len(declared) == 0 {
+		return nil
+	}
+
+	verification, err := outputs.Verify(outDir, declared)
+	if err != nil {
+		log.Printf("failed to verify the outputs of run %d: %v", opt.Tool.ID, err)
+		return nil
+	}
+	if len(verification.Missing) > 0 {
+		RecordRunEvent(ctx, opt.DB, opt.Tool.ID, EventOutputsMissing, fmt.Sprintf("the declared outputs %s were not found in /out", strings.Join(verification.Missing, ", ")))
+	}
+	if len(verification.Unexpected) > 0 {
+		RecordRunEvent(ctx, opt.DB, opt.Tool.ID, EventOutputsUnexpected, fmt.Sprintf("the files %s in /out do not belong to any declared output", strings.Join(verification.Unexpected, ", ")))
+	}
+
+	verificationJSON, err := json.Marshal(verification)
+	if err == nil {
+		err = opt.DB.SetRunOutputs(ctx, db.SetRunOutputsParams{
+			RunID:        opt.Tool.ID,
+			Complete:     verification.Complete,
+			Verification: string(verificationJSON),
+		})
+	}
+	if err != nil {
+		log.Printf("failed to persist the output verification of run %d: %v", opt.Tool.ID, err)
+	}
+
+	if !verification.Complete && viper.GetBool("run.strict_outputs") {
+		return fmt.Errorf("the required outputs %s are missing", strings.Join(verification.Missing, ", "))
+	}
+	return nil
+}
+
+// RunOutputs returns the verification of the outputs of a finished run
+func RunOutputs(ctx context.Context, DB *db.Queries, runID int64) (outputs.Verification, error) {
+	recorded, err := DB.GetRunOutputs(ctx, runID)
+	if err != nil {
+		return outputs.Verification{}, err
+	}
+	var verification outputs.Verification
+	if err := json.Unmarshal([]byte(recorded.Verification), &verification); err != nil {
+		return outputs.Verification{}, err
+	}
+	verification.Complete = recorded.Complete
+	return verification, nil
+}
@@ -0,0 +1,138 @@
+package tool
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hydrocode-de/gorun/internal/helper"
+	"github.com/hydrocode-de/tool-spec-go/validate"
+	"github.com/spf13/viper"
+)
+
+// the prefixes of the environment variables a run exports with the param_env option
+const (
+	ParamEnvPrefix = "TOOL_PARAM_"
+	DataEnvPrefix  = "TOOL_DATA_"
+)
+
+// paramEnvName is the environment variable of a parameter or dataset, e.g. TOOL_DATA_DEM_FILE for dem-file
+func paramEnvName(prefix string, name string) string {
+	return prefix + strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9'):
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+// paramEnvValue formats a scalar parameter. Lists, objects and null are not exported.
+func paramEnvValue(value interface{}) (string, bool) {
+	switch v := value.(type) {
+	case string:
+		return escapeEnvValue(v), true
+	case bool:
+		return strconv.FormatBool(v), true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case int, int64, json.Number:
+		return fmt.Sprint(v), true
+	}
+	return "", false
+}
+
+// escapeEnvValue escapes control characters like newlines and NUL bytes as in Go strings,
+// e.g. \n or \x00, as an environment variable cannot carry all of them
+func escapeEnvValue(value string) string {
+	isControl := func(r rune) bool { return r < 0x20 || r == 0x7f }
+	if !strings.ContainsFunc(value, isControl) {
+		return value
+	}
+	var escaped strings.Builder
+	for _, r := range value {
+		if isControl(r) {
+			quoted := strconv.QuoteRune(r)
+			escaped.WriteString(quoted[1 : len(quoted)-1])
+			continue
+		}
+		escaped.WriteRune(r)
+	}
+	return escaped.String()
+}
+
+// paramEnv lists TOOL_PARAM_<NAME> for the scalar parameters and TOOL_DATA_<NAME> for the
+// container paths of the datasets, the files of a list joined by colons
+func paramEnv(tool *Tool) []string {
+	env := make([]string, 0, len(tool.Parameters)+len(tool.Data))
+	for name, value := range tool.Parameters {
+		if formatted, ok := paramEnvValue(value); ok {
+			env = append(env, paramEnvName(ParamEnvPrefix, name)+"="+formatted)
+		}
+	}
+	for name, ref := range tool.Data {
+		env = append(env, paramEnvName(DataEnvPrefix, name)+"="+strings.Join(ref.Paths, ":"))
+	}
+	sort.Strings(env)
+	return env
+}
+
+// checkParamEnv rejects the scalar parameters whose exported value would exceed run.param_env_max_bytes
+func checkParamEnv(parameters map[string]interface{}) []error {
+	maxBytes := viper.GetInt("run.param_env_max_bytes")
+	errs := make([]error, 0)
+	if maxBytes <= 0 {
+		return errs
+	}
+	for name, value := range parameters {
+		formatted, ok := paramEnvValue(value)
+		if !ok || len(formatted) <= maxBytes {
+			continue
+		}
+		errs = append(errs, &validate.ValidationError{
+			Field:    validate.Parameters,
+			Name:     name,
+			Type:     validate.OutOfRange,
+			Expected: fmt.Sprintf("<= %d bytes", maxBytes),
+			Actual:   fmt.Sprintf("%d bytes", len(formatted)),
+			Message:  fmt.Sprintf("the parameter %s exceeds the %d bytes allowed in the environment variable %s. Disable param_env or pass the value as a file", name, maxBytes, paramEnvName(ParamEnvPrefix, name)),
+		})
+	}
+	return errs
+}
+
+// mergeEnv adds the explicit variables to the generated ones. An explicit variable wins
+// over a generated one of the same name.
+func mergeEnv(generated []string, explicit []string) []string {
+	if len(explicit) == 0 {
+		return generated
+	}
+	names := make(map[string]bool, len(explicit))
+	for _, env := range explicit {
+		name, _, _ := strings.Cut(env, "=")
+		names[name] = true
+	}
+	merged := make([]string, 0, len(generated)+len(explicit))
+	for _, env := range generated {
+		if name, _, _ := strings.Cut(env, "="); !names[name] {
+			merged = append(merged, env)
+		}
+	}
+	return append(merged, explicit...)
+}
+
+// redactEnv masks the values of the variables named like secrets, e.g. TOOL_PARAM_API_TOKEN
+func redactEnv(env []string) []string {
+	redacted := make([]string, 0, len(env))
+	for _, variable := range env {
+		if name, _, _ := strings.Cut(variable, "="); helper.IsSecretName(name) {
+			variable = name + "=[redacted]"
+		}
+		redacted = append(redacted, variable)
+	}
+	return redacted
+}
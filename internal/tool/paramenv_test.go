@@ -0,0 +1,75 @@
+package tool
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/hydrocode-de/gorun/internal/dockertest"
+)
+
+func TestParamEnv(t *testing.T) {
+	run := &Tool{
+		Parameters: map[string]interface{}{
+			"message":    "line one\nline two",
+			"dem-file":   "dem.tif",
+			"count":      float64(3),
+			"verbose":    true,
+			"thresholds": []interface{}{1, 2},
+			"nothing":    nil,
+		},
+		Data: map[string]DatasetRef{
+			"input":  {Paths: []string{"/in/input.txt"}},
+			"frames": {Paths: []string{"/in/frames/a.tif", "/in/frames/b.tif"}, List: true},
+		},
+	}
+	want := []string{
+		"TOOL_DATA_FRAMES=/in/frames/a.tif:/in/frames/b.tif",
+		"TOOL_DATA_INPUT=/in/input.txt",
+		"TOOL_PARAM_COUNT=3",
+		"TOOL_PARAM_DEM_FILE=dem.tif",
+		`TOOL_PARAM_MESSAGE=line one\nline two`,
+		"TOOL_PARAM_VERBOSE=true",
+	}
+	if env := paramEnv(run); !slices.Equal(env, want) {
+		t.Errorf("the generated environment is\n%v\nwant\n%v", env, want)
+	}
+}
+
+func TestMergeEnvExplicitWins(t *testing.T) {
+	generated := []string{"TOOL_PARAM_COUNT=3", "TOOL_PARAM_MESSAGE=generated"}
+	explicit := []string{"TOOL_PARAM_MESSAGE=explicit", "OTHER=1"}
+
+	want := []string{"TOOL_PARAM_COUNT=3", "TOOL_PARAM_MESSAGE=explicit", "OTHER=1"}
+	if merged := mergeEnv(generated, explicit); !slices.Equal(merged, want) {
+		t.Errorf("the merged environment is %v, want %v", merged, want)
+	}
+	if merged := mergeEnv(generated, nil); !slices.Equal(merged, generated) {
+		t.Errorf("without explicit variables the environment is %v, want %v", merged, generated)
+	}
+}
+
+// an explicit variable of the run options replaces the generated one in the container
+func TestRunToolParamEnvCollision(t *testing.T) {
+	DB := newTestDB(t)
+	daemon := dockertest.New(t)
+	addTestImage(daemon, writeMessage)
+	enabled := true
+	run := createTestRun(t, DB, CreateRunOptions{ParamEnv: &enabled, Parameters: map[string]interface{}{"message": "generated", "count": 2}})
+
+	err := RunTool(context.Background(), RunToolOptions{DB: DB, Tool: run, UserId: testUser, Env: []string{"TOOL_PARAM_MESSAGE=explicit"}})
+	if err != nil {
+		t.Fatalf("RunTool failed: %v", err)
+	}
+	containers := runContainers(daemon)
+	if len(containers) != 1 {
+		t.Fatalf("%d run containers were created, want 1", len(containers))
+	}
+	env := containers[0].Config.Env
+	if !slices.Contains(env, "TOOL_PARAM_MESSAGE=explicit") || slices.Contains(env, "TOOL_PARAM_MESSAGE=generated") {
+		t.Errorf("the explicit variable did not win over the generated one: %v", env)
+	}
+	if !slices.Contains(env, "TOOL_PARAM_COUNT=2") {
+		t.Errorf("the generated variables without collision are missing: %v", env)
+	}
+}
@@ -0,0 +1,258 @@
+package tool
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/docker/docker/api/types/mount"
+	"github.com/hydrocode-de/gorun/internal/apptainer"
+	"github.com/hydrocode-de/gorun/internal/cache"
+	"github.com/hydrocode-de/gorun/internal/db"
+	"github.com/hydrocode-de/gorun/internal/files"
+	"github.com/spf13/viper"
+)
+
+// RunPlan is the container a run would be executed in. It is returned by dry runs,
+// which neither create the run nor write to the mount path.
+type RunPlan struct {
+	Tool        string          `json:"tool"`
+	Title       string          `json:"title"`
+	Image       string          `json:"image"`
+	ImageID     string          `json:"image_id,omitempty"`
+	RepoDigests []string        `json:"repo_digests,omitempty"`
+	Platform    string          `json:"platform,omitempty"`
+	Runtime     string          `json:"runtime"`
+	Mode        string          `json:"mode"`
+	Entrypoint  []string        `json:"entrypoint,omitempty"`
+	Cmd         []string        `json:"cmd,omitempty"`
+	User        string          `json:"user,omitempty"`
+	Env         []string        `json:"env,omitempty"`
+	Network     string          `json:"network"`
+	Mounts      []PlannedMount  `json:"mounts"`
+	Hardening   Hardening       `json:"hardening"`
+	Options     RunOptions      `json:"options"`
+	Inputs      json.RawMessage `json:"inputs"`
+	Manifest    InputManifest   `json:"manifest"`
+	// DockerRun are the arguments of an equivalent docker run invocation
+	DockerRun []string `json:"docker_run,omitempty"`
+	// ApptainerExec are the arguments of the apptainer invocation of apptainer runs
+	ApptainerExec []string `json:"apptainer_exec,omitempty"`
+	// PrepareCmd is run by a first container of the same mounts, see run.use_prepare
+	PrepareCmd []string `json:"prepare_cmd,omitempty"`
+}
+
+// PlannedMount is a bind or tmpfs mount of the planned container. The host paths of
+// the run do not exist yet.
+type PlannedMount struct {
+	Type      string `json:"type"`
+	Source    string `json:"source,omitempty"`
+	Target    string `json:"target"`
+	ReadOnly  bool   `json:"read_only,omitempty"`
+	SizeBytes int64  `json:"size_bytes,omitempty"`
+}
+
+// PlanRun validates the payload like ValidateAndCreateRun and builds the container of
+// the run without creating it. Besides the cached gotap probe, no container is created,
+// so the image has to be cached already. The validation stages the datasets like for a
+// created run: the inline files are removed again once the plan is built, the deposits
+// referenced by DOI stay in datasets.cache_path. So a plan counts against the rate limit
+// of the user as well.
+func PlanRun(ctx context.Context, DB *db.Queries, Cache *cache.Cache, opts CreateRunOptions, userID string) (RunPlan, error) {
+	if err := takeRunToken(ctx, DB, userID); err != nil {
+		return RunPlan{}, err
+	}
+	defer removeInlineFiles(&opts)
+	toolSpec, err := validateRun(ctx, DB, Cache, &opts, userID, false)
+	if err != nil {
+		return RunPlan{}, err
+	}
+	runOptions, err := newRunOptions(opts)
+	if err != nil {
+		return RunPlan{}, err
+	}
+	layout, err := newRunLayout(opts, runOptions, files.NewMountPaths(viper.GetString("mount_path"), "_random"))
+	if err != nil {
+		return RunPlan{}, err
+	}
+
+	run := &Tool{
+		Name:       opts.Name,
+		Title:      toolSpec.Title,
+		Image:      opts.Image,
+		Parameters: opts.Parameters,
+		Data:       layout.Datasets,
+		Mounts:     layout.Mounts,
+		Options:    layout.Options,
+	}
+	if runOptions.Runtime == RuntimeApptainer {
+		return planApptainerRun(ctx, run, layout)
+	}
+
+	c, err := RuntimeClient(runOptions.Runtime)
+	if err != nil {
+		return RunPlan{}, err
+	}
+
+	spec, err := newContainerSpec(ctx, c, run, nil)
+	if err != nil {
+		return RunPlan{}, err
+	}
+
+	plan := RunPlan{
+		Tool:       opts.Name,
+		Title:      toolSpec.Title,
+		Image:      opts.Image,
+		Runtime:    runOptions.Runtime,
+		Platform:   runOptions.Platform,
+		Mode:       spec.Mode,
+		Entrypoint: spec.Config.Entrypoint,
+		Cmd:        spec.Config.Cmd,
+		User:       spec.Config.User,
+		Env:        redactEnv(spec.Config.Env),
+		Network:    string(spec.HostConfig.NetworkMode),
+		Mounts:     make([]PlannedMount, 0, len(spec.HostConfig.Mounts)),
+		Hardening:  runOptions.Hardening,
+		Options:    runOptions,
+		Inputs:     json.RawMessage(layout.Inputs),
+		Manifest:   layout.Manifest,
+	}
+	if info, err := c.ImageInspect(ctx, opts.Image); err == nil {
+		plan.ImageID = info.ID
+		plan.RepoDigests = info.RepoDigests
+	}
+	for _, m := range spec.HostConfig.Mounts {
+		planned := PlannedMount{
+			Type:     string(m.Type),
+			Source:   m.Source,
+			Target:   m.Target,
+			ReadOnly: m.ReadOnly,
+		}
+		if m.TmpfsOptions != nil {
+			planned.SizeBytes = m.TmpfsOptions.SizeBytes
+		}
+		plan.Mounts = append(plan.Mounts, planned)
+	}
+	if usesPrepare(run, spec.Mode) {
+		plan.PrepareCmd = prepareArgs(run.Name)
+	}
+	if plan.Network == "" {
+		plan.Network = "default"
+	}
+	plan.DockerRun = plan.dockerRunArgs()
+	return plan, nil
+}
+
+// planApptainerRun plans the apptainer invocation of the run. Unlike the Docker plan,
+// the image is pulled into a SIF if it was not converted yet.
+func planApptainerRun(ctx context.Context, run *Tool, layout runLayout) (RunPlan, error) {
+	sif, err := apptainer.Pull(ctx, run.Image)
+	if err != nil {
+		return RunPlan{}, err
+	}
+	execOpts, mode, err := newApptainerExec(ctx, run, nil, sif)
+	if err != nil {
+		return RunPlan{}, err
+	}
+	plan := RunPlan{
+		Tool:      run.Name,
+		Title:     run.Title,
+		Image:     run.Image,
+		Runtime:   RuntimeApptainer,
+		Mode:      mode,
+		Cmd:       execOpts.Command,
+		User:      files.DefaultRunUser(),
+		Env:       redactEnv(execOpts.Env),
+		Network:   "host",
+		Mounts:    make([]PlannedMount, 0, len(execOpts.Binds)),
+		Hardening: run.Options.Hardening,
+		Options:   run.Options,
+		Inputs:    json.RawMessage(layout.Inputs),
+		Manifest:  layout.Manifest,
+	}
+	if usesPrepare(run, mode) {
+		plan.PrepareCmd = append([]string{execOpts.Command[0]}, prepareArgs(run.Name)...)
+	}
+	for _, bind := range execOpts.Binds {
+		plan.Mounts = append(plan.Mounts, PlannedMount{Type: "bind", Source: bind.Source, Target: bind.Target, ReadOnly: bind.ReadOnly})
+	}
+	execOpts.Env = plan.Env
+	plan.ApptainerExec = append([]string{apptainer.Binary()}, execOpts.Args()...)
+	return plan, nil
+}
+
+// dockerRunArgs translates the plan into the arguments of docker run. The seccomp
+// profile is passed as path, as the docker CLI reads it itself.
+func (p RunPlan) dockerRunArgs() []string {
+	args := []string{"docker", "run", "--rm"}
+	if p.Platform != "" {
+		args = append(args, "--platform", p.Platform)
+	}
+	if p.User != "" {
+		args = append(args, "--user", p.User)
+	}
+	if p.Network != "default" {
+		args = append(args, "--network", p.Network)
+	}
+	for _, env := range p.Env {
+		args = append(args, "-e", env)
+	}
+	for _, m := range p.Mounts {
+		if m.Type == string(mount.TypeTmpfs) {
+			args = append(args, "--mount", fmt.Sprintf("type=tmpfs,destination=%s,tmpfs-size=%d", m.Target, m.SizeBytes))
+			continue
+		}
+		volume := m.Source + ":" + m.Target
+		if m.ReadOnly {
+			volume += ":ro"
+		}
+		args = append(args, "-v", volume)
+	}
+
+	h := p.Hardening
+	if h.DropAllCaps {
+		args = append(args, "--cap-drop", "ALL")
+	}
+	for _, capability := range h.CapAdd {
+		args = append(args, "--cap-add", capability)
+	}
+	if h.NoNewPrivileges {
+		args = append(args, "--security-opt", "no-new-privileges")
+	}
+	if h.SeccompProfile != "" {
+		args = append(args, "--security-opt", "seccomp="+h.SeccompProfile)
+	}
+	if h.ReadOnlyRootfs {
+		args = append(args, "--read-only", "--tmpfs", "/tmp:rw,exec")
+	}
+	if h.PidsLimit > 0 {
+		args = append(args, "--pids-limit", fmt.Sprint(h.PidsLimit))
+	}
+
+	// docker run only takes the first element of the entrypoint, the rest is prepended to the command
+	cmd := p.Cmd
+	if len(p.Entrypoint) > 0 {
+		args = append(args, "--entrypoint", p.Entrypoint[0])
+		cmd = append(append([]string{}, p.Entrypoint[1:]...), p.Cmd...)
+	}
+	args = append(args, p.Image)
+	return append(args, cmd...)
+}
+
+// CommandLine quotes the docker run or apptainer arguments for a POSIX shell
+func (p RunPlan) CommandLine() string {
+	args := p.DockerRun
+	if p.Runtime == RuntimeApptainer {
+		args = p.ApptainerExec
+	}
+	quoted := make([]string, 0, len(args))
+	for _, arg := range args {
+		if arg != "" && strings.Trim(arg, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_./:=,@") == "" {
+			quoted = append(quoted, arg)
+			continue
+		}
+		quoted = append(quoted, "'"+strings.ReplaceAll(arg, "'", `'"'"'`)+"'")
+	}
+	return strings.Join(quoted, " ")
+}
@@ -0,0 +1,160 @@
+package tool
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/hydrocode-de/gorun/internal/apptainer"
+	"github.com/hydrocode-de/gorun/internal/dockerclient"
+	"github.com/hydrocode-de/gorun/internal/toolImage"
+)
+
+// the output of gotap prepare recorded with the run events, per stream
+const prepareOutputLimit = 4 * 1024
+
+// prepareArgs are the arguments of gotap to prepare the inputs of the tool
+func prepareArgs(toolName string) []string {
+	return []string{"prepare", toolName, "--input-file", "/in/inputs.json", "--spec-file", "/src/tool.yml"}
+}
+
+// usesPrepare reports if the inputs of the run are prepared by gotap before the tool runs
+func usesPrepare(tool *Tool, runMode string) bool {
+	return tool.Options.UsePrepare && runMode == StrategyGotap
+}
+
+// cappedBuffer keeps the first bytes written to it and drops the rest
+type cappedBuffer struct {
+	bytes.Buffer
+	limit   int
+	dropped int
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	n := len(p)
+	if room := max(b.limit-b.Len(), 0); room < n {
+		b.dropped += n - room
+		p = p[:room]
+	}
+	b.Buffer.Write(p)
+	return n, nil
+}
+
+func (b *cappedBuffer) String() string {
+	output := strings.TrimSpace(b.Buffer.String())
+	if b.dropped > 0 {
+		output += fmt.Sprintf(" [%d bytes dropped]", b.dropped)
+	}
+	return output
+}
+
+// prepareResult is the outcome of gotap prepare
+type prepareResult struct {
+	exitCode int64
+	stdout   cappedBuffer
+	stderr   cappedBuffer
+}
+
+func newPrepareResult() *prepareResult {
+	return &prepareResult{
+		stdout: cappedBuffer{limit: prepareOutputLimit},
+		stderr: cappedBuffer{limit: prepareOutputLimit},
+	}
+}
+
+// prepareContainer runs gotap prepare in a container of the same image and mounts as the
+// container of the run, which is created only if the preparation succeeded
+func prepareContainer(ctx context.Context, opt RunToolOptions, c *client.Client, spec containerSpec) (*prepareResult, error) {
+	config := spec.Config
+	config.Cmd = prepareArgs(opt.Tool.Name)
+	config.Labels = runLabels(opt, dockerclient.PurposePrepare)
+	hostConfig := spec.HostConfig
+
+	RecordRunEvent(ctx, opt.DB, opt.Tool.ID, EventPrepareStarted, fmt.Sprintf("gotap %s", strings.Join(config.Cmd, " ")))
+	cont, err := c.ContainerCreate(ctx, &config, &hostConfig, nil, toolImage.ParsePlatform(opt.Tool.Options.Platform), "")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		cleanupCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), time.Minute)
+		defer cancel()
+		c.ContainerRemove(cleanupCtx, cont.ID, container.RemoveOptions{Force: true})
+	}()
+	if err := c.ContainerStart(ctx, cont.ID, container.StartOptions{}); err != nil {
+		return nil, err
+	}
+
+	result := newPrepareResult()
+	statusCh, errCh := c.ContainerWait(ctx, cont.ID, container.WaitConditionNotRunning)
+	select {
+	case err := <-errCh:
+		return nil, err
+	case status := <-statusCh:
+		if status.Error != nil {
+			return nil, errors.New(status.Error.Message)
+		}
+		result.exitCode = status.StatusCode
+	}
+
+	logReader, err := c.ContainerLogs(ctx, cont.ID, container.LogsOptions{ShowStdout: true, ShowStderr: true})
+	if err != nil {
+		return nil, err
+	}
+	defer logReader.Close()
+	if _, err := stdcopy.StdCopy(&result.stdout, &result.stderr, logReader); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// prepareApptainer runs gotap prepare with the binds of the run. The command of the run
+// starts with the gotap found in the SIF.
+func prepareApptainer(ctx context.Context, opt RunToolOptions, execOpts apptainer.ExecOptions) (*prepareResult, error) {
+	execOpts.Command = append([]string{execOpts.Command[0]}, prepareArgs(opt.Tool.Name)...)
+	RecordRunEvent(ctx, opt.DB, opt.Tool.ID, EventPrepareStarted, strings.Join(execOpts.Command, " "))
+
+	result := newPrepareResult()
+	execOpts.Stdout, execOpts.Stderr = &result.stdout, &result.stderr
+	exitCode, err := apptainer.Exec(ctx, execOpts)
+	if err != nil {
+		return nil, err
+	}
+	result.exitCode = exitCode
+	return result, nil
+}
+
+// finishPrepare records the outcome of gotap prepare. If it failed, gotap rejected the
+// inputs and the run errored with kind validation, including the STDERR of gotap. The
+// run may also have been cancelled while it was prepared.
+func finishPrepare(ctx context.Context, opt RunToolOptions, result *prepareResult, err error, duration time.Duration, updateDB func(RunStatus, ErrorKind, error)) error {
+	if err != nil {
+		err = fmt.Errorf("could not run gotap prepare: %w", err)
+		updateDB(StatusErrored, waitErrorKind(err), err)
+		return err
+	}
+
+	message := fmt.Sprintf("gotap prepare exited with status %d after %s", result.exitCode, duration.Round(time.Millisecond))
+	if stdout := result.stdout.String(); stdout != "" {
+		message += "\nSTDOUT: " + stdout
+	}
+	if stderr := result.stderr.String(); stderr != "" {
+		message += "\nSTDERR: " + stderr
+	}
+	RecordRunEvent(ctx, opt.DB, opt.Tool.ID, EventPrepareFinished, message)
+
+	if result.exitCode != 0 {
+		err := fmt.Errorf("gotap prepare exited with status %d: %s", result.exitCode, result.stderr.String())
+		updateDB(StatusErrored, ErrorValidation, err)
+		return err
+	}
+	if current, err := opt.DB.GetRunStatusByID(ctx, opt.Tool.ID); err == nil && RunStatus(current).IsTerminal() {
+		return fmt.Errorf("the run %d was %s while its inputs were prepared", opt.Tool.ID, current)
+	}
+	return nil
+}
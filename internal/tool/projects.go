@@ -0,0 +1,312 @@
+package tool
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hydrocode-de/gorun/internal/db"
+)
+
+// the name of the project every user runs tools in by default
+const PersonalProjectName = "personal"
+
+// Project groups runs, whose members see each other's runs
+type Project struct {
+	ID          int64           `json:"id"`
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	OwnerID     string          `json:"owner_id"`
+	Personal    bool            `json:"personal"`
+	CreatedAt   time.Time       `json:"created_at"`
+	Members     []ProjectMember `json:"members,omitempty"`
+}
+
+type ProjectMember struct {
+	UserID    string    `json:"user_id"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func fromDBProject(project db.Project) Project {
+	return Project{
+		ID:          project.ID,
+		Name:        project.Name,
+		Description: project.Description,
+		OwnerID:     project.OwnerID,
+		Personal:    project.Personal,
+		CreatedAt:   project.CreatedAt,
+	}
+}
+
+// PersonalProject returns the personal project of the user, which is created on first use
+// for users created after the projects were introduced
+func PersonalProject(ctx context.Context, DB *db.Queries, userID string) (db.Project, error) {
+	project, err := DB.GetPersonalProject(ctx, userID)
+	if err == nil {
+		return project, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return db.Project{}, err
+	}
+	project, err = DB.CreateProject(ctx, db.CreateProjectParams{
+		Name:     PersonalProjectName,
+		OwnerID:  userID,
+		Personal: true,
+	})
+	if err != nil {
+		return db.Project{}, err
+	}
+	if err := DB.AddProjectMember(ctx, db.AddProjectMemberParams{ProjectID: project.ID, UserID: userID}); err != nil {
+		return db.Project{}, err
+	}
+	return project, nil
+}
+
+// loadProject returns the project if the user is a member or an admin. Projects of
+// others are reported as not found, so their IDs are not disclosed.
+func loadProject(ctx context.Context, DB *db.Queries, projectID int64, userID string) (db.Project, bool, error) {
+	notFound := fmt.Errorf("the project %d was not found: %w", projectID, ErrNotFound)
+	project, err := DB.GetProject(ctx, projectID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return db.Project{}, false, notFound
+	}
+	if err != nil {
+		return db.Project{}, false, err
+	}
+	user, err := DB.GetUserByID(ctx, userID)
+	if err != nil {
+		return db.Project{}, false, fmt.Errorf("unknown user %s: %w", userID, ErrUnauthorized)
+	}
+	if user.IsAdmin {
+		return project, true, nil
+	}
+	member, err := DB.IsProjectMember(ctx, db.IsProjectMemberParams{ProjectID: projectID, UserID: userID})
+	if err != nil {
+		return db.Project{}, false, err
+	}
+	if !member {
+		return db.Project{}, false, notFound
+	}
+	return project, false, nil
+}
+
+// manageProject returns the project if the user owns it or is an admin
+func manageProject(ctx context.Context, DB *db.Queries, projectID int64, userID string) (db.Project, error) {
+	project, isAdmin, err := loadProject(ctx, DB, projectID, userID)
+	if err != nil {
+		return db.Project{}, err
+	}
+	if !isAdmin && project.OwnerID != userID {
+		return db.Project{}, fmt.Errorf("only the owner of the project %d may change it: %w", projectID, ErrForbidden)
+	}
+	return project, nil
+}
+
+// checkProject makes sure the user may run tools in the project, zero is the personal project
+func checkProject(ctx context.Context, DB *db.Queries, projectID int64, userID string) error {
+	if projectID == 0 {
+		return nil
+	}
+	_, _, err := loadProject(ctx, DB, projectID, userID)
+	return err
+}
+
+// resolveProject returns the project a new run is created in
+func resolveProject(ctx context.Context, DB *db.Queries, projectID int64, userID string) (int64, error) {
+	if projectID == 0 {
+		project, err := PersonalProject(ctx, DB, userID)
+		if err != nil {
+			return 0, fmt.Errorf("could not load the personal project: %w", err)
+		}
+		return project.ID, nil
+	}
+	if err := checkProject(ctx, DB, projectID, userID); err != nil {
+		return 0, err
+	}
+	return projectID, nil
+}
+
+// ListProjects returns the projects the user is a member of, or all projects for admins
+// if all is set
+func ListProjects(ctx context.Context, DB *db.Queries, userID string, all bool) ([]Project, error) {
+	if _, err := PersonalProject(ctx, DB, userID); err != nil {
+		return nil, err
+	}
+	var rows []db.Project
+	var err error
+	if all {
+		user, userErr := DB.GetUserByID(ctx, userID)
+		if userErr != nil || !user.IsAdmin {
+			return nil, fmt.Errorf("only admins may list all projects: %w", ErrForbidden)
+		}
+		rows, err = DB.GetAllProjects(ctx)
+	} else {
+		rows, err = DB.GetProjectsByMember(ctx, userID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	projects := make([]Project, 0, len(rows))
+	for _, row := range rows {
+		projects = append(projects, fromDBProject(row))
+	}
+	return projects, nil
+}
+
+// GetProject returns the project along with its members
+func GetProject(ctx context.Context, DB *db.Queries, projectID int64, userID string) (Project, error) {
+	row, _, err := loadProject(ctx, DB, projectID, userID)
+	if err != nil {
+		return Project{}, err
+	}
+	return withMembers(ctx, DB, row)
+}
+
+func withMembers(ctx context.Context, DB *db.Queries, row db.Project) (Project, error) {
+	members, err := DB.GetProjectMembers(ctx, row.ID)
+	if err != nil {
+		return Project{}, err
+	}
+	project := fromDBProject(row)
+	project.Members = make([]ProjectMember, 0, len(members))
+	for _, member := range members {
+		project.Members = append(project.Members, ProjectMember{UserID: member.UserID, Email: member.Email, CreatedAt: member.CreatedAt})
+	}
+	return project, nil
+}
+
+func validateProjectName(name string) error {
+	if strings.TrimSpace(name) == "" {
+		return &ValidationError{Message: "the name of the project is required"}
+	}
+	if strings.EqualFold(strings.TrimSpace(name), PersonalProjectName) {
+		return &ValidationError{Message: fmt.Sprintf("the name %s is reserved for the personal project", PersonalProjectName)}
+	}
+	return nil
+}
+
+// CreateProject creates a project owned by the user, who is its first member
+func CreateProject(ctx context.Context, DB *db.Queries, name string, description string, userID string) (Project, error) {
+	if err := validateProjectName(name); err != nil {
+		return Project{}, err
+	}
+	row, err := DB.CreateProject(ctx, db.CreateProjectParams{
+		Name:        strings.TrimSpace(name),
+		Description: description,
+		OwnerID:     userID,
+	})
+	if err != nil {
+		if strings.Contains(err.Error(), "UNIQUE constraint failed") {
+			return Project{}, &ValidationError{Message: fmt.Sprintf("you already own a project named %s", name)}
+		}
+		return Project{}, err
+	}
+	if err := DB.AddProjectMember(ctx, db.AddProjectMemberParams{ProjectID: row.ID, UserID: userID}); err != nil {
+		return Project{}, err
+	}
+	return withMembers(ctx, DB, row)
+}
+
+// UpdateProject changes the name or description of the project, nil values are kept.
+// The personal project cannot be renamed.
+func UpdateProject(ctx context.Context, DB *db.Queries, projectID int64, name *string, description *string, userID string) (Project, error) {
+	row, err := manageProject(ctx, DB, projectID, userID)
+	if err != nil {
+		return Project{}, err
+	}
+	params := db.UpdateProjectParams{ID: row.ID, Name: row.Name, Description: row.Description}
+	if name != nil && *name != row.Name {
+		if row.Personal {
+			return Project{}, &ValidationError{Message: "the personal project cannot be renamed"}
+		}
+		if err := validateProjectName(*name); err != nil {
+			return Project{}, err
+		}
+		params.Name = strings.TrimSpace(*name)
+	}
+	if description != nil {
+		params.Description = *description
+	}
+	row, err = DB.UpdateProject(ctx, params)
+	if err != nil {
+		if strings.Contains(err.Error(), "UNIQUE constraint failed") {
+			return Project{}, &ValidationError{Message: fmt.Sprintf("the owner already has a project named %s", params.Name)}
+		}
+		return Project{}, err
+	}
+	return withMembers(ctx, DB, row)
+}
+
+// DeleteProject deletes an empty project. Personal projects are never deleted.
+func DeleteProject(ctx context.Context, DB *db.Queries, projectID int64, userID string) error {
+	row, err := manageProject(ctx, DB, projectID, userID)
+	if err != nil {
+		return err
+	}
+	if row.Personal {
+		return fmt.Errorf("the personal project cannot be deleted: %w", ErrForbidden)
+	}
+	runs, err := DB.CountProjectRuns(ctx, row.ID)
+	if err != nil {
+		return err
+	}
+	if runs > 0 {
+		return fmt.Errorf("the project %d has %d runs, delete them first: %w", row.ID, runs, ErrProjectNotEmpty)
+	}
+	return DB.DeleteProject(ctx, row.ID)
+}
+
+// AddProjectMember lets the member see the runs of the project and run tools in it
+func AddProjectMember(ctx context.Context, DB *db.Queries, projectID int64, memberID string, userID string) (Project, error) {
+	row, err := manageProject(ctx, DB, projectID, userID)
+	if err != nil {
+		return Project{}, err
+	}
+	if row.Personal {
+		return Project{}, &ValidationError{Message: "the personal project cannot be shared, create a project instead"}
+	}
+	if _, err := DB.GetUserByID(ctx, memberID); err != nil {
+		return Project{}, fmt.Errorf("the user %s was not found: %w", memberID, ErrNotFound)
+	}
+	if err := DB.AddProjectMember(ctx, db.AddProjectMemberParams{ProjectID: row.ID, UserID: memberID}); err != nil {
+		return Project{}, err
+	}
+	return withMembers(ctx, DB, row)
+}
+
+// RemoveProjectMember removes the member, the runs they created stay with the project
+func RemoveProjectMember(ctx context.Context, DB *db.Queries, projectID int64, memberID string, userID string) (Project, error) {
+	row, err := manageProject(ctx, DB, projectID, userID)
+	if err != nil {
+		return Project{}, err
+	}
+	if memberID == row.OwnerID {
+		return Project{}, &ValidationError{Message: "the owner cannot be removed from the project"}
+	}
+	removed, err := DB.RemoveProjectMember(ctx, db.RemoveProjectMemberParams{ProjectID: row.ID, UserID: memberID})
+	if err != nil {
+		return Project{}, err
+	}
+	if removed == 0 {
+		return Project{}, fmt.Errorf("the user %s is not a member of the project %d: %w", memberID, row.ID, ErrNotFound)
+	}
+	return withMembers(ctx, DB, row)
+}
+
+// GetVisibleRun loads a run the user may read: an own run, any run for admins or a
+// run of a project the user is a member of. A missing run wraps ErrNotFound.
+func GetVisibleRun(ctx context.Context, DB *db.Queries, id int64, userID string) (db.Run, error) {
+	run, err := GetRun(ctx, DB, id, userID)
+	if !IsNotFound(err) {
+		return run, err
+	}
+	run, err = DB.GetProjectRun(ctx, db.GetProjectRunParams{ID: id, UserID: userID})
+	if errors.Is(err, sql.ErrNoRows) {
+		return db.Run{}, fmt.Errorf("the run %d was not found: %w", id, ErrNotFound)
+	}
+	return run, err
+}
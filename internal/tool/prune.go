@@ -0,0 +1,178 @@
+package tool
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/hydrocode-de/gorun/internal/db"
+	"github.com/hydrocode-de/gorun/internal/files"
+	"github.com/spf13/viper"
+)
+
+// OrphanedDir is a directory below the mount path which no run owns
+type OrphanedDir struct {
+	Path       string    `json:"path"`
+	RunID      *int64    `json:"run_id,omitempty"`
+	ModifiedAt time.Time `json:"modified_at"`
+	Removed    bool      `json:"removed"`
+}
+
+// RunDir returns the directory holding the mounts of the run, as files.run_dir_template
+// placed it when the run was created, so that a changed template does not lose the older
+// runs. Runs created before the directory was recorded fall back to the current template.
+// The directory is always below mount_path, so that deleting a run never removes anything
+// else. A run loaded without its owner has no directory if the template needs it.
+func (t *Tool) RunDir() (string, bool) {
+	if t.runDir != "" {
+		return t.runDir, true
+	}
+	template := viper.GetString("files.run_dir_template")
+	if t.userID == "" && strings.Contains(template, "{user_id}") {
+		return "", false
+	}
+	runDir, err := files.RunDir(template, viper.GetString("mount_path"), t.ID, t.userID, t.Name)
+	if err != nil {
+		return "", false
+	}
+	return runDir, true
+}
+
+// ownedRunDirs returns the absolute directories below mountPath the runs in the database use:
+// the parent of their /in and /out mounts and all other mounts inside the mount path
+func ownedRunDirs(ctx context.Context, DB *db.Queries, mountPath string) (map[string]bool, error) {
+	runs, err := DB.GetRunMounts(ctx)
+	if err != nil {
+		return nil, err
+	}
+	owned := make(map[string]bool, len(runs))
+	for _, run := range runs {
+		// a run which is being created has no mounts yet, its directory may exist in the default layout
+		owned[filepath.Join(mountPath, files.RunDirName(run.ID))] = true
+
+		var mounts map[string]string
+		if err := json.Unmarshal([]byte(run.Mounts), &mounts); err != nil {
+			continue
+		}
+		for containerPath, hostPath := range mounts {
+			abs, err := filepath.Abs(hostPath)
+			if err != nil {
+				continue
+			}
+			if containerPath == "/in" || containerPath == "/out" {
+				abs = filepath.Dir(abs)
+			}
+			rel, err := filepath.Rel(mountPath, abs)
+			if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+				continue
+			}
+			owned[abs] = true
+		}
+	}
+	return owned, nil
+}
+
+// HeldTempPaths returns the host paths below temp_path which the unfinished runs mount. With
+// data_mode mount, a run mounts the uploads it was created from until it ends, so that cleaning
+// the temp path must keep them.
+func HeldTempPaths(ctx context.Context, DB *db.Queries) ([]string, error) {
+	tempPath, err := filepath.Abs(viper.GetString("temp_path"))
+	if err != nil {
+		return nil, err
+	}
+	runs, err := DB.GetUnfinishedRunMounts(ctx)
+	if err != nil {
+		return nil, err
+	}
+	held := make([]string, 0)
+	for _, run := range runs {
+		var mounts map[string]string
+		if err := json.Unmarshal([]byte(run.Mounts), &mounts); err != nil {
+			continue
+		}
+		for _, hostPath := range mounts {
+			abs, err := filepath.Abs(hostPath)
+			if err != nil {
+				continue
+			}
+			if rel, err := filepath.Rel(tempPath, abs); err == nil && rel != "." && !strings.HasPrefix(rel, "..") {
+				held = append(held, abs)
+			}
+		}
+	}
+	return held, nil
+}
+
+// containsOwned reports if one of the owned directories is below dir
+func containsOwned(owned map[string]bool, dir string) bool {
+	for ownedDir := range owned {
+		if strings.HasPrefix(ownedDir, dir+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// PruneRunDirs removes the directories below mount_path which no run owns and which were not
+// modified within the grace period. Directories holding the run directories of a nested layout,
+// like {mount_path}/{user_id}/{run_id}, are descended into. With dryRun, the directories are only reported.
+func PruneRunDirs(ctx context.Context, DB *db.Queries, gracePeriod time.Duration, dryRun bool) ([]OrphanedDir, error) {
+	mountPath, err := filepath.Abs(viper.GetString("mount_path"))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(mountPath); err != nil {
+		return nil, fmt.Errorf("cannot read the mount path %s: %v", mountPath, err)
+	}
+	// the runs are read after the mount path was checked, so a run created in between is not missed
+	owned, err := ownedRunDirs(ctx, DB, mountPath)
+	if err != nil {
+		return nil, err
+	}
+
+	orphaned := make([]OrphanedDir, 0)
+	threshold := time.Now().Add(-gracePeriod)
+	err = filepath.WalkDir(mountPath, func(dirPath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			// a directory removed in the meantime is no reason to stop
+			if dirPath == mountPath {
+				return err
+			}
+			return nil
+		}
+		if dirPath == mountPath || !entry.IsDir() {
+			return nil
+		}
+		if owned[dirPath] {
+			return fs.SkipDir
+		}
+		if containsOwned(owned, dirPath) {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil || info.ModTime().After(threshold) {
+			return fs.SkipDir
+		}
+
+		dir := OrphanedDir{Path: dirPath, ModifiedAt: info.ModTime()}
+		if runID, ok := files.ParseRunDirName(entry.Name()); ok {
+			dir.RunID = &runID
+		}
+		if !dryRun {
+			if err := os.RemoveAll(dir.Path); err != nil {
+				log.Printf("failed to remove the orphaned run directory %s: %v", dir.Path, err)
+			} else {
+				dir.Removed = true
+			}
+		}
+		orphaned = append(orphaned, dir)
+		return fs.SkipDir
+	})
+	return orphaned, err
+}
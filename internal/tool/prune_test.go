@@ -0,0 +1,45 @@
+package tool
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestHeldTempPaths(t *testing.T) {
+	conn, DB := newTestDBConn(t)
+	upload := func(name string) string {
+		return filepath.Join(viper.GetString("temp_path"), "uploads", name, "data.txt")
+	}
+	// only the unfinished runs hold their uploads, the mounts outside temp_path are no uploads
+	for status, hostPath := range map[RunStatus]string{
+		StatusPending:  upload("pending"),
+		StatusQueued:   upload("queued"),
+		StatusRunning:  upload("running"),
+		StatusFinished: upload("finished"),
+		StatusErrored:  upload("errored"),
+	} {
+		runID := createTestRunRecord(t, DB)
+		mounts, _ := json.Marshal(map[string]string{
+			"/in/data.txt": hostPath,
+			"/out":         filepath.Join(viper.GetString("mount_path"), "out"),
+		})
+		if _, err := conn.Exec("UPDATE runs SET status = ?, mounts = ? WHERE id = ?", status, string(mounts), runID); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	held, err := HeldTempPaths(context.Background(), DB)
+	if err != nil {
+		t.Fatalf("HeldTempPaths failed: %v", err)
+	}
+	slices.Sort(held)
+	want := []string{upload("pending"), upload("queued"), upload("running")}
+	if !slices.Equal(held, want) {
+		t.Errorf("the held temp paths are %v, want %v", held, want)
+	}
+}
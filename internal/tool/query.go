@@ -0,0 +1,466 @@
+package tool
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/hydrocode-de/gorun/internal/files"
+	"github.com/spf13/viper"
+)
+
+const defaultQueryLimit = 100
+
+// TableQuery selects rows and aggregates of a tabular result file
+type TableQuery struct {
+	// Select are the columns of the returned rows, all columns if empty
+	Select []string `json:"select,omitempty"`
+	// Filter keeps the rows matching all conditions, like discharge > 10 and station == "A"
+	Filter    string        `json:"filter,omitempty"`
+	Limit     int           `json:"limit,omitempty"`
+	Aggregate []Aggregation `json:"aggregate,omitempty"`
+}
+
+// Aggregation is one of count, sum, mean, min or max over the filtered rows of a column
+type Aggregation struct {
+	Op     string `json:"op"`
+	Column string `json:"column,omitempty"`
+}
+
+func (a Aggregation) key() string {
+	return fmt.Sprintf("%s(%s)", a.Op, a.Column)
+}
+
+// TableColumn is a column of the file with the type inferred from its values
+type TableColumn struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+type TableQueryResult struct {
+	Filename     string                   `json:"filename"`
+	Columns      []TableColumn            `json:"columns"`
+	Rows         []map[string]interface{} `json:"rows"`
+	Aggregations map[string]interface{}   `json:"aggregations,omitempty"`
+	ScannedRows  int64                    `json:"scanned_rows"`
+	MatchedRows  int64                    `json:"matched_rows"`
+	// Truncated is set if more rows matched than the limit
+	Truncated bool `json:"truncated"`
+}
+
+// QueryError is a problem with a field of a query
+type QueryError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func (e *QueryError) Error() string {
+	return e.Message
+}
+
+// tableDelimiters are the delimiters of the formats which can be queried
+var tableDelimiters = map[string]rune{
+	files.FormatCSV: ',',
+	files.FormatTSV: '\t',
+}
+
+var aggregationOps = []string{"count", "sum", "mean", "min", "max"}
+
+// condition is a single comparison of a filter
+type condition struct {
+	column  int
+	op      string
+	value   string
+	number  float64
+	numeric bool
+}
+
+func (c condition) matches(record []string) bool {
+	if c.column >= len(record) {
+		return false
+	}
+	cell := record[c.column]
+	cmp := 0
+	if c.numeric {
+		number, err := strconv.ParseFloat(strings.TrimSpace(cell), 64)
+		if err != nil {
+			return c.op == "!="
+		}
+		switch {
+		case number < c.number:
+			cmp = -1
+		case number > c.number:
+			cmp = 1
+		}
+	} else {
+		cmp = strings.Compare(cell, c.value)
+	}
+
+	switch c.op {
+	case "==", "=":
+		return cmp == 0
+	case "!=":
+		return cmp != 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	}
+	return false
+}
+
+type filterToken struct {
+	text   string
+	quoted bool
+}
+
+// tokenizeFilter splits a filter into words, quoted strings and comparison operators
+func tokenizeFilter(filter string) ([]filterToken, error) {
+	tokens := make([]filterToken, 0)
+	for i := 0; i < len(filter); {
+		switch char := filter[i]; {
+		case char == ' ' || char == '\t':
+			i++
+		case char == '"' || char == '\'':
+			end := strings.IndexByte(filter[i+1:], char)
+			if end < 0 {
+				return nil, fmt.Errorf("the quote at position %d of the filter is not closed", i)
+			}
+			tokens = append(tokens, filterToken{text: filter[i+1 : i+1+end], quoted: true})
+			i += end + 2
+		case strings.ContainsRune("=!<>", rune(char)):
+			op := filter[i : i+1]
+			if i+1 < len(filter) && filter[i+1] == '=' {
+				op = filter[i : i+2]
+			}
+			tokens = append(tokens, filterToken{text: op})
+			i += len(op)
+		default:
+			end := strings.IndexAny(filter[i:], " \t=!<>\"'")
+			if end < 0 {
+				end = len(filter) - i
+			}
+			tokens = append(tokens, filterToken{text: filter[i : i+end]})
+			i += end
+		}
+	}
+	return tokens, nil
+}
+
+// parseFilter reads conditions like column op value, joined by and
+func parseFilter(filter string, columns []string) ([]condition, error) {
+	tokens, err := tokenizeFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+	conditions := make([]condition, 0)
+	for i := 0; i < len(tokens); {
+		if len(conditions) > 0 {
+			if tokens[i].quoted || !strings.EqualFold(tokens[i].text, "and") {
+				return nil, fmt.Errorf("expected 'and' between the conditions of the filter, got %s", tokens[i].text)
+			}
+			i++
+		}
+		if i+3 > len(tokens) {
+			return nil, fmt.Errorf("incomplete condition in the filter. Use column op value, like discharge > 10")
+		}
+		column, op, value := tokens[i], tokens[i+1], tokens[i+2]
+		i += 3
+
+		index := slices.Index(columns, column.text)
+		if index < 0 {
+			return nil, fmt.Errorf("the filter uses the unknown column %s", column.text)
+		}
+		if op.quoted || !slices.Contains([]string{"==", "=", "!=", ">", ">=", "<", "<="}, op.text) {
+			return nil, fmt.Errorf("unknown operator %s in the filter. Use one of ==, !=, >, >=, <, <=", op.text)
+		}
+		cond := condition{column: index, op: op.text, value: value.text}
+		if !value.quoted {
+			if number, err := strconv.ParseFloat(value.text, 64); err == nil {
+				cond.number, cond.numeric = number, true
+			}
+		}
+		conditions = append(conditions, cond)
+	}
+	return conditions, nil
+}
+
+// columnType narrows the inferred type of a column by one of its values
+func columnType(current string, value string) string {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return current
+	}
+	_, intErr := strconv.ParseInt(value, 10, 64)
+	_, floatErr := strconv.ParseFloat(value, 64)
+	_, boolErr := strconv.ParseBool(value)
+	switch {
+	case current == "" && intErr == nil:
+		return "integer"
+	case (current == "" || current == "integer" || current == "float") && floatErr == nil:
+		if current == "integer" && intErr == nil {
+			return "integer"
+		}
+		return "float"
+	case (current == "" || current == "boolean") && boolErr == nil && intErr != nil:
+		return "boolean"
+	}
+	return "string"
+}
+
+// typedValue converts a cell to the inferred type of its column
+func typedValue(columnType string, value string) interface{} {
+	trimmed := strings.TrimSpace(value)
+	if trimmed == "" {
+		return nil
+	}
+	switch columnType {
+	case "integer":
+		if number, err := strconv.ParseInt(trimmed, 10, 64); err == nil {
+			return number
+		}
+	case "float":
+		if number, err := strconv.ParseFloat(trimmed, 64); err == nil {
+			return number
+		}
+	case "boolean":
+		if boolean, err := strconv.ParseBool(trimmed); err == nil {
+			return boolean
+		}
+	}
+	return value
+}
+
+// aggregator collects the values of a column for an aggregation
+type aggregator struct {
+	Aggregation
+	column   int
+	count    int64
+	numbers  int64
+	sum      float64
+	min, max float64
+	minText  string
+	maxText  string
+	seenText bool
+}
+
+func (a *aggregator) add(record []string) {
+	if a.Column == "" {
+		a.count++
+		return
+	}
+	if a.column >= len(record) || strings.TrimSpace(record[a.column]) == "" {
+		return
+	}
+	cell := strings.TrimSpace(record[a.column])
+	a.count++
+	if number, err := strconv.ParseFloat(cell, 64); err == nil {
+		if a.numbers == 0 || number < a.min {
+			a.min = number
+		}
+		if a.numbers == 0 || number > a.max {
+			a.max = number
+		}
+		a.sum += number
+		a.numbers++
+		return
+	}
+	if !a.seenText || cell < a.minText {
+		a.minText = cell
+	}
+	if !a.seenText || cell > a.maxText {
+		a.maxText = cell
+	}
+	a.seenText = true
+}
+
+// result is nil if the column had no values the aggregation could use
+func (a *aggregator) result() interface{} {
+	switch a.Op {
+	case "count":
+		return a.count
+	case "sum":
+		if a.numbers > 0 {
+			return a.sum
+		}
+	case "mean":
+		if a.numbers > 0 {
+			return a.sum / float64(a.numbers)
+		}
+	case "min":
+		if a.seenText && a.numbers == 0 {
+			return a.minText
+		}
+		if a.numbers > 0 {
+			return a.min
+		}
+	case "max":
+		if a.seenText && a.numbers == 0 {
+			return a.maxText
+		}
+		if a.numbers > 0 {
+			return a.max
+		}
+	}
+	return nil
+}
+
+// QueryResultFile evaluates the query over a CSV or TSV result file while streaming it.
+// Files larger than results.query_max_bytes are rejected and at most results.query_max_rows
+// rows are returned.
+func (t *Tool) QueryResultFile(resultPath string, query TableQuery) (*TableQueryResult, error) {
+	result, err := t.resolveResultFile(resultPath)
+	if err != nil {
+		return nil, err
+	}
+	format, err := files.DetectFileFormat(result.AbsPath)
+	if err != nil {
+		return nil, err
+	}
+	delimiter, ok := tableDelimiters[format.Name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s is no CSV or TSV file", ErrNotTabular, result.RelPath)
+	}
+	if maxBytes := viper.GetInt64("results.query_max_bytes"); maxBytes > 0 && result.Size > maxBytes {
+		return nil, fmt.Errorf("%w: %s has %d bytes, queries are limited to %d bytes", ErrResultTooLarge, result.RelPath, result.Size, maxBytes)
+	}
+
+	maxRows := viper.GetInt("results.query_max_rows")
+	limit := query.Limit
+	if limit == 0 {
+		limit = min(defaultQueryLimit, maxRows)
+	}
+	if limit < 0 || limit > maxRows {
+		return nil, &ValidationError{
+			Message: "the query is invalid",
+			Errors:  []error{&QueryError{Field: "limit", Message: fmt.Sprintf("limit has to be within 1 and %d, got %d", maxRows, query.Limit)}},
+		}
+	}
+
+	file, err := t.openResult(result)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(bufio.NewReader(file))
+	reader.Comma = delimiter
+	reader.FieldsPerRecord = -1
+	reader.ReuseRecord = true
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s has no readable header: %v", ErrNotTabular, result.RelPath, err)
+	}
+	columns := slices.Clone(header)
+
+	// the query is checked against the header, so that all problems are reported at once
+	queryErrs := make([]error, 0)
+	selected := make([]int, 0, len(query.Select))
+	for _, name := range query.Select {
+		index := slices.Index(columns, name)
+		if index < 0 {
+			queryErrs = append(queryErrs, &QueryError{Field: "select", Message: fmt.Sprintf("the selected column %s does not exist", name)})
+		}
+		selected = append(selected, index)
+	}
+	if len(query.Select) == 0 {
+		for i := range columns {
+			selected = append(selected, i)
+		}
+	}
+	conditions, err := parseFilter(query.Filter, columns)
+	if err != nil {
+		queryErrs = append(queryErrs, &QueryError{Field: "filter", Message: err.Error()})
+	}
+	aggregators := make([]*aggregator, 0, len(query.Aggregate))
+	for _, aggregation := range query.Aggregate {
+		if !slices.Contains(aggregationOps, aggregation.Op) {
+			queryErrs = append(queryErrs, &QueryError{Field: "aggregate", Message: fmt.Sprintf("unknown aggregation %s. Use one of %s", aggregation.Op, strings.Join(aggregationOps, ", "))})
+			continue
+		}
+		index := slices.Index(columns, aggregation.Column)
+		if index < 0 && (aggregation.Column != "" || aggregation.Op != "count") {
+			queryErrs = append(queryErrs, &QueryError{Field: "aggregate", Message: fmt.Sprintf("the aggregation %s uses the unknown column %s", aggregation.key(), aggregation.Column)})
+			continue
+		}
+		aggregators = append(aggregators, &aggregator{Aggregation: aggregation, column: index})
+	}
+	if len(queryErrs) > 0 {
+		return nil, &ValidationError{Message: "the query is invalid", Errors: queryErrs}
+	}
+
+	types := make([]string, len(columns))
+	rows := make([][]string, 0)
+	queryResult := &TableQueryResult{Filename: result.RelPath}
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s could not be read: %v", ErrNotTabular, result.RelPath, err)
+		}
+		queryResult.ScannedRows++
+		for i := range types {
+			if i < len(record) {
+				types[i] = columnType(types[i], record[i])
+			}
+		}
+
+		matched := true
+		for _, cond := range conditions {
+			if !cond.matches(record) {
+				matched = false
+				break
+			}
+		}
+		if !matched {
+			continue
+		}
+		queryResult.MatchedRows++
+		for _, agg := range aggregators {
+			agg.add(record)
+		}
+		if len(rows) < limit {
+			rows = append(rows, slices.Clone(record))
+		} else {
+			queryResult.Truncated = true
+		}
+	}
+
+	queryResult.Columns = make([]TableColumn, len(columns))
+	for i, name := range columns {
+		if types[i] == "" {
+			types[i] = "string"
+		}
+		queryResult.Columns[i] = TableColumn{Name: name, Type: types[i]}
+	}
+	queryResult.Rows = make([]map[string]interface{}, 0, len(rows))
+	for _, record := range rows {
+		row := make(map[string]interface{}, len(selected))
+		for _, index := range selected {
+			var value interface{}
+			if index < len(record) {
+				value = typedValue(types[index], record[index])
+			}
+			row[columns[index]] = value
+		}
+		queryResult.Rows = append(queryResult.Rows, row)
+	}
+	if len(aggregators) > 0 {
+		queryResult.Aggregations = make(map[string]interface{}, len(aggregators))
+		for _, agg := range aggregators {
+			queryResult.Aggregations[agg.key()] = agg.result()
+		}
+	}
+	return queryResult, nil
+}
@@ -0,0 +1,122 @@
+package tool
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/hydrocode-de/gorun/internal/db"
+	"github.com/spf13/viper"
+)
+
+var ErrRateLimited = errors.New("rate limited")
+
+// RateLimitError is returned if a user created more runs than allowed.
+// RetryAfter tells when the next run may be created.
+type RateLimitError struct {
+	Limit      int64         `json:"runs_per_minute"`
+	RetryAfter time.Duration `json:"-"`
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("at most %d runs per minute may be created, retry in %s", e.Limit, e.RetryAfter.Round(time.Second))
+}
+
+func (e *RateLimitError) Unwrap() error {
+	return ErrRateLimited
+}
+
+// tokenBucket holds up to one minute worth of runs and refills continuously
+type tokenBucket struct {
+	tokens  float64
+	limit   int64
+	updated time.Time
+}
+
+// the buckets live in memory and start full after a restart of gorun
+var (
+	runBucketsMu sync.Mutex
+	runBuckets   = make(map[string]*tokenBucket)
+)
+
+// rateLimitedRuns counts the run creations refused since the process started
+var rateLimitedRuns atomic.Int64
+
+// RateLimitedRuns returns the number of run creations refused by the rate limit since the process started
+func RateLimitedRuns() int64 {
+	return rateLimitedRuns.Load()
+}
+
+// RunBucket is the state of the token bucket of a user
+type RunBucket struct {
+	UserID string  `json:"user_id"`
+	Tokens float64 `json:"tokens"`
+	Limit  int64   `json:"runs_per_minute"`
+}
+
+// RunBuckets returns the buckets of the users who created runs since the process started, refilled until
+// now and ordered by the user
+func RunBuckets(now time.Time) []RunBucket {
+	runBucketsMu.Lock()
+	defer runBucketsMu.Unlock()
+
+	buckets := make([]RunBucket, 0, len(runBuckets))
+	for userID, bucket := range runBuckets {
+		buckets = append(buckets, RunBucket{UserID: userID, Tokens: bucket.refilled(now), Limit: bucket.limit})
+	}
+	sort.Slice(buckets, func(i, j int) bool { return buckets[i].UserID < buckets[j].UserID })
+	return buckets
+}
+
+// refilled returns the tokens of the bucket at now
+func (b *tokenBucket) refilled(now time.Time) float64 {
+	return math.Min(float64(b.limit), b.tokens+max(now.Sub(b.updated).Seconds(), 0)*float64(b.limit)/60)
+}
+
+// RunLimit returns the runs per minute the user may create. The override stored by an admin
+// has precedence over limits.runs_per_minute. 0 means unlimited.
+func RunLimit(ctx context.Context, DB *db.Queries, userID string) (int64, error) {
+	limit, err := DB.GetUserRunLimit(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return viper.GetInt64("limits.runs_per_minute"), nil
+	}
+	return limit, err
+}
+
+// takeRunToken takes a token from the bucket of the user, or returns a RateLimitError
+func takeRunToken(ctx context.Context, DB *db.Queries, userID string) error {
+	limit, err := RunLimit(ctx, DB, userID)
+	if err != nil {
+		return err
+	}
+	if limit <= 0 {
+		return nil
+	}
+
+	runBucketsMu.Lock()
+	defer runBucketsMu.Unlock()
+
+	now := time.Now()
+	bucket, ok := runBuckets[userID]
+	if !ok || bucket.limit != limit {
+		bucket = &tokenBucket{tokens: float64(limit), limit: limit, updated: now}
+		runBuckets[userID] = bucket
+	}
+	perSecond := float64(limit) / 60
+	bucket.tokens = bucket.refilled(now)
+	bucket.updated = now
+
+	if bucket.tokens < 1 {
+		rateLimitedRuns.Add(1)
+		wait := time.Duration((1 - bucket.tokens) / perSecond * float64(time.Second))
+		return &RateLimitError{Limit: limit, RetryAfter: wait}
+	}
+	bucket.tokens--
+	return nil
+}
@@ -0,0 +1,54 @@
+package tool
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// resetRunBuckets empties the buckets, so that a test starts with full ones
+func resetRunBuckets(t *testing.T) {
+	t.Helper()
+	empty := func() {
+		runBucketsMu.Lock()
+		defer runBucketsMu.Unlock()
+		runBuckets = make(map[string]*tokenBucket)
+	}
+	empty()
+	t.Cleanup(empty)
+}
+
+func TestRunBuckets(t *testing.T) {
+	ctx := context.Background()
+	DB := newTestDB(t)
+	resetRunBuckets(t)
+	viper.Set("limits.runs_per_minute", 2)
+	refused := RateLimitedRuns()
+
+	for i := 0; i < 2; i++ {
+		if err := takeRunToken(ctx, DB, testUser); err != nil {
+			t.Fatalf("run %d was refused: %v", i+1, err)
+		}
+	}
+	if err := takeRunToken(ctx, DB, testUser); !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("the third run returned %v, want %v", err, ErrRateLimited)
+	}
+	if n := RateLimitedRuns() - refused; n != 1 {
+		t.Errorf("%d refused runs were counted, want 1", n)
+	}
+
+	buckets := RunBuckets(time.Now())
+	if len(buckets) != 1 || buckets[0].UserID != testUser || buckets[0].Limit != 2 || buckets[0].Tokens >= 1 {
+		t.Fatalf("the buckets are %+v, want an empty bucket of %s for 2 runs", buckets, testUser)
+	}
+	// the state refills over time, but never beyond the limit
+	if tokens := RunBuckets(time.Now().Add(30 * time.Second))[0].Tokens; tokens < 1 || tokens > 2 {
+		t.Errorf("the bucket holds %g tokens after 30s, want one more", tokens)
+	}
+	if tokens := RunBuckets(time.Now().Add(time.Hour))[0].Tokens; tokens != 2 {
+		t.Errorf("the bucket holds %g tokens after an hour, want 2", tokens)
+	}
+}
@@ -0,0 +1,93 @@
+package tool
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/client"
+	"github.com/hydrocode-de/gorun/internal/db"
+	"github.com/hydrocode-de/gorun/internal/dockerclient"
+)
+
+// StaleContainer is a container gorun created and left behind
+type StaleContainer struct {
+	ID        string    `json:"id"`
+	Purpose   string    `json:"purpose"`
+	RunID     *int64    `json:"run_id,omitempty"`
+	State     string    `json:"state"`
+	CreatedAt time.Time `json:"created_at"`
+	Removed   bool      `json:"removed"`
+}
+
+// the containers removed by ReapContainers since the process started
+var reapedContainers atomic.Int64
+
+// ReapedContainers returns the number of stale containers removed since the process started
+func ReapedContainers() int64 {
+	return reapedContainers.Load()
+}
+
+// ReapContainers removes the containers labeled by gorun which were created or exited before
+// the grace period. They are left behind if gorun stopped while it executed a run or probed an
+// image. The containers of runs which are not finished are never touched, as their run may
+// still collect them. With dryRun, the containers are only reported.
+func ReapContainers(ctx context.Context, DB *db.Queries, gracePeriod time.Duration, dryRun bool) ([]StaleContainer, error) {
+	c, err := dockerclient.Get()
+	if err != nil {
+		return nil, err
+	}
+	containers, err := c.ContainerList(ctx, container.ListOptions{
+		All: true,
+		Filters: filters.NewArgs(
+			filters.Arg("label", dockerclient.LabelManaged+"=true"),
+			filters.Arg("status", "created"),
+			filters.Arg("status", "exited"),
+		),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	stale := make([]StaleContainer, 0)
+	threshold := time.Now().Add(-gracePeriod)
+	for _, cont := range containers {
+		createdAt := time.Unix(cont.Created, 0)
+		if createdAt.After(threshold) {
+			continue
+		}
+		entry := StaleContainer{ID: cont.ID, Purpose: cont.Labels[dockerclient.LabelPurpose], State: cont.State, CreatedAt: createdAt}
+		if label, ok := cont.Labels[dockerclient.LabelRunID]; ok {
+			runID, err := strconv.ParseInt(label, 10, 64)
+			if err != nil {
+				continue
+			}
+			entry.RunID = &runID
+			// the containers of deleted runs are stale, the ones of unfinished runs are kept
+			status, err := DB.GetRunStatusByID(ctx, runID)
+			if err != nil && !errors.Is(err, sql.ErrNoRows) {
+				continue
+			}
+			if err == nil && !RunStatus(status).IsTerminal() {
+				continue
+			}
+		}
+		if !dryRun {
+			err := c.ContainerRemove(ctx, cont.ID, container.RemoveOptions{})
+			if err != nil && !client.IsErrNotFound(err) {
+				log.Printf("failed to remove the stale container %s: %v", cont.ID, err)
+			} else {
+				entry.Removed = true
+				reapedContainers.Add(1)
+			}
+		}
+		stale = append(stale, entry)
+	}
+	return stale, nil
+}
@@ -0,0 +1,350 @@
+package tool
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hydrocode-de/gorun/internal/db"
+	"github.com/hydrocode-de/gorun/internal/files"
+	"github.com/hydrocode-de/gorun/internal/outputs"
+	"github.com/hydrocode-de/gorun/internal/storage"
+	"github.com/spf13/viper"
+)
+
+// StorageS3 marks the results which are only left in the object storage
+const StorageS3 = "s3"
+
+// the runs whose results are uploaded right now, so that the retries skip them
+var uploading sync.Map
+
+// resultObjectKey is the key of a result in the bucket, the results of a run are under runs/{id}/
+func resultObjectKey(runID int64, relPath string) string {
+	return fmt.Sprintf("runs/%d/%s", runID, filepath.ToSlash(relPath))
+}
+
+// UploadResults copies the results of a finished run into the object storage of storage.s3,
+// if one is configured. The run is storage_pending until all files are uploaded. A failed
+// upload keeps the local files and is retried by RetryPendingUploads, the files uploaded
+// with the same checksum before are skipped.
+func UploadResults(ctx context.Context, DB *db.Queries, runID int64, outDir string) error {
+	store, err := storage.S3FromConfig()
+	if err != nil || store == nil {
+		return err
+	}
+	if _, busy := uploading.LoadOrStore(runID, true); busy {
+		return nil
+	}
+	defer uploading.Delete(runID)
+
+	if err := DB.SetRunStoragePending(ctx, db.SetRunStoragePendingParams{StoragePending: true, ID: runID}); err != nil {
+		return err
+	}
+	uploaded, size, err := uploadResults(ctx, DB, store, runID, outDir)
+	if err != nil {
+		RecordRunEvent(ctx, DB, runID, EventStorageFailed, fmt.Sprintf("the upload of the results failed, the local files are kept and the upload is retried: %v", err))
+		return err
+	}
+	if err := DB.SetRunStoragePending(ctx, db.SetRunStoragePendingParams{StoragePending: false, ID: runID}); err != nil {
+		return err
+	}
+	RecordRunEvent(ctx, DB, runID, EventStorageUploaded, fmt.Sprintf("uploaded %d files (%d bytes) of the results to s3://%s/%s", uploaded, size, store.Bucket, resultObjectKey(runID, "")))
+	return nil
+}
+
+func uploadResults(ctx context.Context, DB *db.Queries, store *storage.S3, runID int64, outDir string) (int, int64, error) {
+	listed, err := files.ReadDir(outDir, true, outDir)
+	if err != nil {
+		return 0, 0, err
+	}
+	records, err := DB.GetRunResults(ctx, runID)
+	if err != nil {
+		return 0, 0, err
+	}
+	uploadedChecksums := make(map[string]string, len(records))
+	for _, record := range records {
+		uploadedChecksums[record.RelPath] = record.Checksum
+	}
+
+	var uploaded int
+	var size int64
+	for _, file := range listed {
+		relPath := filepath.ToSlash(file.RelPath)
+		// the previews stay next to the local results only
+		if files.IsPreview(relPath) {
+			continue
+		}
+		checksum, err := fileChecksum(outDir, file.AbsPath)
+		if errors.Is(err, files.ErrOutsideDir) {
+			log.Printf("skipped the result %s of run %d, it resolves outside of /out", relPath, runID)
+			continue
+		}
+		if err != nil {
+			return uploaded, size, err
+		}
+		if uploadedChecksums[relPath] == "sha256:"+checksum {
+			continue
+		}
+		format, err := files.DetectFileFormat(file.AbsPath)
+		if err != nil {
+			return uploaded, size, err
+		}
+		key := resultObjectKey(runID, relPath)
+		if err := putResult(ctx, store, key, outDir, file, checksum, format.MimeType); err != nil {
+			return uploaded, size, fmt.Errorf("%s: %w", relPath, err)
+		}
+		err = DB.SetRunResult(ctx, db.SetRunResultParams{
+			RunID:     runID,
+			RelPath:   relPath,
+			ObjectKey: key,
+			Size:      file.Size,
+			Checksum:  "sha256:" + checksum,
+			Format:    format.Name,
+			MimeType:  format.MimeType,
+		})
+		if err != nil {
+			return uploaded, size, err
+		}
+		uploaded++
+		size += file.Size
+	}
+	return uploaded, size, nil
+}
+
+func putResult(ctx context.Context, store *storage.S3, key string, outDir string, result files.ResultFile, checksum string, mimeType string) error {
+	file, err := files.OpenContained(outDir, result.AbsPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return store.Put(ctx, key, file, result.Size, checksum, mimeType)
+}
+
+// fileChecksum is the hex encoded SHA-256 of the file, which has to resolve inside of dir
+func fileChecksum(dir string, filePath string) (string, error) {
+	file, err := files.OpenContained(dir, filePath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// RetryPendingUploads uploads the results of the runs whose upload failed before
+func RetryPendingUploads(ctx context.Context, DB *db.Queries) error {
+	if store, err := storage.S3FromConfig(); err != nil || store == nil {
+		return err
+	}
+	runs, err := DB.GetStoragePendingRuns(ctx)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, dbRun := range runs {
+		run, err := FromDBRun(dbRun)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("run %d: %w", dbRun.ID, err))
+			continue
+		}
+		outDir, ok := run.Mounts["/out"]
+		if !ok {
+			// nothing to upload, the run does not wait for the storage anymore
+			errs = append(errs, DB.SetRunStoragePending(ctx, db.SetRunStoragePendingParams{StoragePending: false, ID: run.ID}))
+			continue
+		}
+		if err := UploadResults(ctx, DB, run.ID, outDir); err != nil {
+			errs = append(errs, fmt.Errorf("run %d: %w", run.ID, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// RemoveUploadedResults removes the local copies of the results which are in the object
+// storage for longer than the grace period. The files gorun itself reads, like the logs,
+// and the previews are kept, as are files which changed since their upload. The IDs of
+// the runs whose files were removed are returned.
+func RemoveUploadedResults(ctx context.Context, DB *db.Queries, grace time.Duration) ([]int64, error) {
+	cutoff := time.Now().UTC().Add(-grace).Format(time.DateTime)
+	runs, err := DB.GetRunsWithLocalResults(ctx, cutoff)
+	if err != nil {
+		return nil, err
+	}
+
+	removed := make([]int64, 0, len(runs))
+	var errs []error
+	for _, dbRun := range runs {
+		if _, busy := uploading.Load(dbRun.ID); busy {
+			continue
+		}
+		run, err := FromDBRun(dbRun)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("run %d: %w", dbRun.ID, err))
+			continue
+		}
+		if err := removeUploadedResults(ctx, DB, run); err != nil {
+			errs = append(errs, fmt.Errorf("run %d: %w", run.ID, err))
+			continue
+		}
+		removed = append(removed, run.ID)
+	}
+	return removed, errors.Join(errs...)
+}
+
+func removeUploadedResults(ctx context.Context, DB *db.Queries, run Tool) error {
+	records, err := DB.GetRunResults(ctx, run.ID)
+	if err != nil {
+		return err
+	}
+	outDir, ok := run.Mounts["/out"]
+	if !ok {
+		return DB.SetRunResultsLocalRemoved(ctx, run.ID)
+	}
+
+	var count int
+	var size int64
+	for _, record := range records {
+		if outputs.IsGorunFile(record.RelPath) {
+			continue
+		}
+		localPath := filepath.Join(outDir, filepath.FromSlash(record.RelPath))
+		checksum, err := fileChecksum(outDir, localPath)
+		if os.IsNotExist(err) || errors.Is(err, files.ErrOutsideDir) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if "sha256:"+checksum != record.Checksum {
+			log.Printf("kept the result %s of run %d, it changed since its upload", record.RelPath, run.ID)
+			continue
+		}
+		if err := os.Remove(localPath); err != nil {
+			return err
+		}
+		count++
+		size += record.Size
+	}
+	removeEmptyDirs(outDir)
+	if err := DB.SetRunResultsLocalRemoved(ctx, run.ID); err != nil {
+		return err
+	}
+	RecordRunEvent(ctx, DB, run.ID, EventLocalRemoved, fmt.Sprintf("removed the local copies of %d uploaded results (%d bytes), they are served from the object storage", count, size))
+	return nil
+}
+
+// removeEmptyDirs removes the directories below dir which are left empty, the deepest first
+func removeEmptyDirs(dir string) {
+	var dirs []string
+	filepath.WalkDir(dir, func(p string, entry os.DirEntry, err error) error {
+		if err == nil && entry.IsDir() && p != dir {
+			dirs = append(dirs, p)
+		}
+		return nil
+	})
+	sort.Slice(dirs, func(i, j int) bool { return len(dirs[i]) > len(dirs[j]) })
+	for _, d := range dirs {
+		// removing a directory which is not empty fails, which keeps it
+		os.Remove(d)
+	}
+}
+
+// withStoredResults adds the uploaded results whose local copy was removed to the listing,
+// and the checksum to the results which were uploaded
+func (t *Tool) withStoredResults(ctx context.Context, DB *db.Queries, results []files.ResultFile) ([]files.ResultFile, error) {
+	records, err := DB.GetRunResults(ctx, t.ID)
+	if err != nil || len(records) == 0 {
+		return results, err
+	}
+	local := make(map[string]int, len(results))
+	for i, result := range results {
+		local[filepath.ToSlash(result.RelPath)] = i
+	}
+	for _, record := range records {
+		if i, ok := local[record.RelPath]; ok {
+			results[i].Checksum = record.Checksum
+			continue
+		}
+		result := files.ResultFile{
+			Name:         path.Base(record.RelPath),
+			RelPath:      record.RelPath,
+			Size:         record.Size,
+			LastModified: record.UploadedAt,
+			Format:       record.Format,
+			MimeType:     record.MimeType,
+			Checksum:     record.Checksum,
+			Storage:      StorageS3,
+		}
+		if previewPath, _, ok := files.PreviewPath(t.Mounts["/out"], record.RelPath); ok {
+			if _, err := os.Stat(previewPath); err == nil {
+				result.HasPreview = true
+			}
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// StoredResult returns the upload of a result whose local copy was removed
+func (t *Tool) StoredResult(ctx context.Context, DB *db.Queries, resultPath string) (db.RunResult, error) {
+	normalized := normalizeResultPath(resultPath)
+	record, err := DB.GetRunResult(ctx, db.GetRunResultParams{RunID: t.ID, RelPath: normalized})
+	if errors.Is(err, sql.ErrNoRows) {
+		return db.RunResult{}, fmt.Errorf("the result file %s was not found in the tool %s results: %w", resultPath, t.Name, ErrNotFound)
+	}
+	return record, err
+}
+
+// PresignResult returns a URL which downloads the uploaded result from the object storage
+// with the given Content-Disposition, valid for storage.s3.presign_expiry
+func PresignResult(record db.RunResult, disposition string) (string, error) {
+	store, err := storage.S3FromConfig()
+	if err != nil {
+		return "", err
+	}
+	if store == nil {
+		return "", fmt.Errorf("the result %s is only in the object storage, which is not configured anymore", record.RelPath)
+	}
+	params := url.Values{
+		"response-content-disposition": {disposition},
+		"response-content-type":        {record.MimeType},
+	}
+	return store.PresignGet(record.ObjectKey, viper.GetDuration("storage.s3.presign_expiry"), params), nil
+}
+
+// deleteStoredResults removes the uploaded results of a deleted run from the object storage
+func deleteStoredResults(ctx context.Context, DB *db.Queries, runID int64) error {
+	records, err := DB.GetRunResults(ctx, runID)
+	if err != nil || len(records) == 0 {
+		return err
+	}
+	store, err := storage.S3FromConfig()
+	if err != nil {
+		return err
+	}
+	if store == nil {
+		log.Printf("the %d uploaded results of run %d are left in the object storage, which is not configured anymore", len(records), runID)
+		return DB.DeleteRunResults(ctx, runID)
+	}
+	for _, record := range records {
+		if err := store.Delete(ctx, record.ObjectKey); err != nil {
+			return fmt.Errorf("%s: %w", record.ObjectKey, err)
+		}
+	}
+	return DB.DeleteRunResults(ctx, runID)
+}
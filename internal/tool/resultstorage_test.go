@@ -0,0 +1,75 @@
+package tool
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+// fakeBucket answers the uploads to the object storage and records their keys and content
+func fakeBucket(t *testing.T) map[string]string {
+	t.Helper()
+	var mu sync.Mutex
+	objects := make(map[string]string)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		objects[r.URL.Path] = string(body)
+		mu.Unlock()
+	}))
+	t.Cleanup(server.Close)
+	viper.Set("storage.s3.endpoint", server.URL)
+	viper.Set("storage.s3.bucket", "results")
+	viper.Set("storage.s3.region", "us-east-1")
+	viper.Set("storage.s3.path_style", true)
+	return objects
+}
+
+// symlinks in /out are not uploaded, they may point to any file of the host
+func TestUploadResultsSkipsSymlinks(t *testing.T) {
+	dir := setTestConfig(t)
+	DB := newTestDB(t)
+	objects := fakeBucket(t)
+	runID := createTestRunRecord(t, DB)
+
+	outDir, hostDir := filepath.Join(dir, "out"), filepath.Join(dir, "host")
+	for _, d := range []string{outDir, hostDir} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(outDir, "result.txt"), []byte("result"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(hostDir, "config.yaml"), []byte("secret: leaked"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	for link, target := range map[string]string{"secret.yaml": filepath.Join(hostDir, "config.yaml"), "linked": hostDir} {
+		if err := os.Symlink(target, filepath.Join(outDir, link)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := UploadResults(context.Background(), DB, runID, outDir); err != nil {
+		t.Fatal(err)
+	}
+	keys := make([]string, 0, len(objects))
+	for key := range objects {
+		keys = append(keys, key)
+	}
+	if want := "/results/" + resultObjectKey(runID, "result.txt"); !slices.Equal(keys, []string{want}) || objects[want] != "result" {
+		t.Errorf("the upload stored %v, want only %s", objects, want)
+	}
+	records, err := DB.GetRunResults(context.Background(), runID)
+	if err != nil || len(records) != 1 || records[0].RelPath != "result.txt" {
+		t.Errorf("the uploads are recorded as %+v, %v", records, err)
+	}
+}
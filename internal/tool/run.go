@@ -1,23 +1,31 @@
 package tool
 
 import (
-	"bytes"
 	"context"
 	"database/sql"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"path"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/mount"
 	"github.com/docker/docker/client"
 	"github.com/docker/docker/pkg/stdcopy"
 	"github.com/hydrocode-de/gorun/internal/db"
+	"github.com/hydrocode-de/gorun/internal/dockerclient"
+	"github.com/hydrocode-de/gorun/internal/files"
 	"github.com/hydrocode-de/gorun/internal/toolImage"
+	"github.com/spf13/viper"
 )
 
 type RunToolOptions struct {
@@ -26,97 +34,354 @@ type RunToolOptions struct {
 	Env    []string
 	Cmd    []string
 	UserId string
+	// RequestID is the ID of the API request that started the run
+	RequestID string
+	// Claimed tells that the caller claimed the run with ClaimRun already
+	Claimed bool
 }
 
+// gotap reports invalid inputs on stderr before it executes the tool
+const gotapValidationMarker = "validation failed"
+
+// isGotapValidationFailure checks if gotap rejected the inputs, either in the
+// validation section of the metadata or with its marker at the start of STDERR.log.
+func isGotapValidationFailure(outDir string) bool {
+	if outDir == "" {
+		return false
+	}
+	if raw, err := os.ReadFile(path.Join(outDir, "_metadata.json")); err == nil {
+		if metadata, err := ParseGotapMetadata(string(raw)); err == nil && metadata.Validation != nil && !metadata.Validation.Valid {
+			return true
+		}
+	}
+
+	stderr, err := os.Open(path.Join(outDir, "STDERR.log"))
+	if err != nil {
+		return false
+	}
+	defer stderr.Close()
+	// gotap validates before the tool is executed, so the marker is found at the start
+	head := make([]byte, 64*1024)
+	n, _ := io.ReadFull(stderr, head)
+	return strings.Contains(strings.ToLower(string(head[:n])), gotapValidationMarker)
+}
+
+// writeLogs demultiplexes the container logs into STDOUT.log and STDERR.log,
+// each capped to run.max_log_bytes. Truncated logs are recorded as run event.
+func writeLogs(ctx context.Context, opt RunToolOptions, outDir string, logReader io.Reader) error {
+	return captureLogs(ctx, opt, outDir, func(stdout io.Writer, stderr io.Writer) error {
+		_, err := stdcopy.StdCopy(stdout, stderr, logReader)
+		return err
+	})
+}
+
+// captureLogs passes the writers of STDOUT.log and STDERR.log to capture, like writeLogs.
+// Without an /out mount, the logs are discarded.
+func captureLogs(ctx context.Context, opt RunToolOptions, outDir string, capture func(stdout io.Writer, stderr io.Writer) error) error {
+	if outDir == "" {
+		return capture(io.Discard, io.Discard)
+	}
+
+	limit := viper.GetInt64("run.max_log_bytes")
+	stdout, err := newLogWriter(outDir, "STDOUT.log", limit)
+	if err != nil {
+		return err
+	}
+	stderr, err := newLogWriter(outDir, "STDERR.log", limit)
+	if err != nil {
+		stdout.Close()
+		return err
+	}
+
+	copyErr := capture(stdout, stderr)
+	for _, logFile := range []*logWriter{stdout, stderr} {
+		if err := logFile.Close(); err != nil && copyErr == nil {
+			copyErr = err
+		}
+		if dropped := logFile.Truncated(); dropped > 0 {
+			truncatedLogs.Add(1)
+			RecordRunEvent(ctx, opt.DB, opt.Tool.ID, EventLogTruncated, fmt.Sprintf("%s was truncated to %d bytes, %d bytes were dropped", logFile.name, limit, dropped))
+		}
+	}
+	return copyErr
+}
+
+// waitErrorKind classifies an error that interrupted waiting for the container
+func waitErrorKind(err error) ErrorKind {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return ErrorTimeout
+	case errors.Is(err, context.Canceled):
+		return ErrorCancelled
+	default:
+		return ErrorInfrastructure
+	}
+}
+
+// specErrorKind classifies an error building the container of the run. An image whose
+// gotap lacks arguments, or which configures gotap wrongly, is not retried.
+func specErrorKind(err error) ErrorKind {
+	if errors.Is(err, toolImage.ErrGotapIncompatible) || errors.Is(err, toolImage.ErrInvalidGotapOverride) {
+		return ErrorValidation
+	}
+	return ErrorInfrastructure
+}
+
+// retryBackoff doubles the configured run.retry_backoff with every attempt, up to five minutes
+func retryBackoff(attempt int) time.Duration {
+	backoff := viper.GetDuration("run.retry_backoff") << (attempt - 1)
+	if backoff <= 0 || backoff > 5*time.Minute {
+		return 5 * time.Minute
+	}
+	return backoff
+}
+
+// RunTool executes the run. Runs failing with an infrastructure error are
+// retried in a fresh container with the same mounts, up to the max_retries of the run.
+// Each attempt waits for a slot of run.max_concurrent, in the order of the run priority.
+// The run is claimed first, so that a run is never executed twice. A run RunTool gives
+// up on is never left queued or running.
 func RunTool(ctx context.Context, opt RunToolOptions) error {
+	if !opt.Claimed {
+		if err := ClaimRun(ctx, opt.DB, opt.Tool.ID); err != nil {
+			return err
+		}
+	}
+	defer notifyCompletion(context.WithoutCancel(ctx), opt.DB, opt.Tool.ID)
+	err := runAttempts(ctx, opt)
+	if err != nil {
+		abandonRun(context.WithoutCancel(ctx), opt, err)
+	}
+	return err
+}
+
+// abandonRun marks a run errored which RunTool stopped executing before the run reached
+// a terminal status, or cancelled if the context was cancelled, e.g. while it waited for a retry
+func abandonRun(ctx context.Context, opt RunToolOptions, runErr error) {
+	current, err := opt.DB.GetRunStatusByID(ctx, opt.Tool.ID)
+	if err != nil || RunStatus(current).IsTerminal() {
+		return
+	}
+	kind := waitErrorKind(runErr)
+	message := sql.NullString{String: fmt.Sprintf("the execution of the tool (%v) stopped before it finished: %v", opt.Tool.Name, runErr), Valid: true}
+	next := StatusErrored
+	if kind == ErrorCancelled {
+		next = StatusCancelled
+	}
+	err = transitionRun(ctx, opt.DB, opt.Tool.ID, next, func() (int64, error) {
+		if next == StatusCancelled {
+			return opt.DB.CancelRun(ctx, db.CancelRunParams{ID: opt.Tool.ID, ErrorMessage: message})
+		}
+		return opt.DB.RunErrored(ctx, db.RunErroredParams{
+			ID:           opt.Tool.ID,
+			ErrorKind:    sql.NullString{String: string(kind), Valid: true},
+			ErrorMessage: message,
+		})
+	})
+	if err != nil && !errors.Is(err, ErrIllegalTransition) {
+		log.Printf("failed to mark the abandoned run %d as %s: %v", opt.Tool.ID, next, err)
+	}
+}
+
+// requeueRun moves the run back to queued before it is retried. A run whose attempt
+// failed before its container was started is still queued.
+func requeueRun(ctx context.Context, opt RunToolOptions) error {
+	current, err := opt.DB.GetRunStatusByID(ctx, opt.Tool.ID)
+	if err != nil {
+		return err
+	}
+	if RunStatus(current) == StatusQueued {
+		return nil
+	}
+	return transitionRun(ctx, opt.DB, opt.Tool.ID, StatusQueued, func() (int64, error) {
+		return opt.DB.QueueRun(ctx, opt.Tool.ID)
+	})
+}
+
+// runAttempts executes the attempts of the run until one succeeds or must not be retried
+func runAttempts(ctx context.Context, opt RunToolOptions) error {
+	maxRetries := opt.Tool.Options.MaxRetries
+	for attempt := 1; ; attempt++ {
+		release, err := acquireRunSlot(ctx, opt)
+		if err != nil {
+			return err
+		}
+		if err := opt.DB.SetRunAttempts(ctx, db.SetRunAttemptsParams{Attempts: int64(attempt), ID: opt.Tool.ID}); err != nil {
+			log.Printf("failed to persist the attempt of run %d: %v", opt.Tool.ID, err)
+		}
+		RecordRunEvent(ctx, opt.DB, opt.Tool.ID, EventAttempt, fmt.Sprintf("attempt %d of %d", attempt, maxRetries+1))
+
+		lastAttempt := attempt > maxRetries
+		kind, err := runAttempt(ctx, opt, lastAttempt)
+		release()
+		if client.IsErrConnectionFailed(err) {
+			invalidateEnvironment()
+		}
+		if err == nil || kind != ErrorInfrastructure || lastAttempt {
+			return err
+		}
+
+		backoff := retryBackoff(attempt)
+		RecordRunEvent(ctx, opt.DB, opt.Tool.ID, EventRetry, fmt.Sprintf("attempt %d failed with an infrastructure error, retrying in %s: %v", attempt, backoff, err))
+		if err := requeueRun(ctx, opt); err != nil {
+			return err
+		}
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// runAttempt executes the run in a new container. Unless it is the last attempt,
+// an infrastructure failure does not mark the run as errored, as it will be retried.
+// The returned kind tells why the attempt failed.
+func runAttempt(ctx context.Context, opt RunToolOptions, lastAttempt bool) (ErrorKind, error) {
+	var failedWith ErrorKind
 	// create a function to update the database
-	updateDB := func(status string, origError error) {
-		switch status {
-		case "started":
-			_, err := opt.DB.StartRun(ctx, db.StartRunParams{
-				ID:     opt.Tool.ID,
-				UserID: opt.UserId,
-			})
-			if err != nil {
-				log.Fatal(err)
+	updateDB := func(status RunStatus, kind ErrorKind, origError error) {
+		if status == StatusErrored {
+			failedWith = kind
+			if kind == ErrorInfrastructure && !lastAttempt {
+				return
 			}
-		case "finished":
-			_, err := opt.DB.FinishRun(ctx, opt.Tool.ID)
-			if err != nil {
-				log.Fatal(err)
-			}
-		case "errored":
-			_, err := opt.DB.RunErrored(ctx, db.RunErroredParams{
-				ID: opt.Tool.ID,
-				ErrorMessage: sql.NullString{
-					String: fmt.Sprintf("the execution of the tool (%v) container (%v) errored unexpectedly: %v", opt.Tool.Name, opt.Tool.Image, origError),
-					Valid:  true,
-				},
-			})
-			if err != nil {
-				log.Fatal(err)
+		}
+		// the watchdog may already have reconciled the run, e.g. after it exceeded the max runtime
+		if current, err := opt.DB.GetRunStatusByID(ctx, opt.Tool.ID); err == nil && status.IsTerminal() && RunStatus(current).IsTerminal() {
+			return
+		}
+		// an interrupted run did not fail, it is cancelled
+		if status == StatusErrored && kind == ErrorCancelled {
+			status = StatusCancelled
+		}
+		message := sql.NullString{
+			String: fmt.Sprintf("the execution of the tool (%v) container (%v) errored unexpectedly: %v", opt.Tool.Name, opt.Tool.Image, origError),
+			Valid:  true,
+		}
+		err := transitionRun(ctx, opt.DB, opt.Tool.ID, status, func() (int64, error) {
+			switch status {
+			case StatusRunning:
+				_, err := opt.DB.StartRun(ctx, db.StartRunParams{
+					ID:     opt.Tool.ID,
+					UserID: opt.UserId,
+				})
+				// the run was cancelled or deleted while its container was started
+				if errors.Is(err, sql.ErrNoRows) {
+					return 0, nil
+				}
+				return 1, err
+			case StatusFinished:
+				return opt.DB.FinishRun(ctx, opt.Tool.ID)
+			case StatusCancelled:
+				return opt.DB.CancelRun(ctx, db.CancelRunParams{ID: opt.Tool.ID, ErrorMessage: message})
+			default:
+				return opt.DB.RunErrored(ctx, db.RunErroredParams{
+					ID:           opt.Tool.ID,
+					ErrorKind:    sql.NullString{String: string(kind), Valid: kind != ""},
+					ErrorMessage: message,
+				})
 			}
+		})
+		// a cancelled context is handled by abandonRun
+		if err != nil && !errors.Is(err, ErrIllegalTransition) && ctx.Err() == nil {
+			log.Fatal(err)
 		}
 	}
 
-	c, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if opt.RequestID != "" {
+		log.Printf("run %d was started by request %s", opt.Tool.ID, opt.RequestID)
+	}
+	if opt.Tool.Options.Runtime == RuntimeApptainer {
+		err := runApptainerAttempt(ctx, opt, updateDB)
+		return failedWith, err
+	}
+	if opt.Tool.Options.Runtime == RuntimeSSH {
+		err := runSSHAttempt(ctx, opt, updateDB)
+		return failedWith, err
+	}
+
+	c, err := dockerclient.Get()
 	if err != nil {
-		return err
+		updateDB(StatusErrored, ErrorInfrastructure, err)
+		return failedWith, err
 	}
-	defer c.Close()
 	tool := &opt.Tool
-	mounts := make([]mount.Mount, 0, len(tool.Mounts))
-	for containerPath, hostPath := range tool.Mounts {
-		mounts = append(mounts, mount.Mount{
-			Type:   mount.TypeBind,
-			Source: hostPath,
-			Target: containerPath,
-		})
-	}
-	//fmt.Println(mounts)
 
-	config := container.Config{
-		Image:        tool.Image,
-		Tty:          false,
-		AttachStdin:  false,
-		AttachStdout: true,
-		AttachStderr: true,
+	env, err := hostEnvironment(ctx, c)
+	if err != nil {
+		updateDB(StatusErrored, ErrorInfrastructure, err)
+		return failedWith, err
+	}
+	recordExecutionEnvironment(ctx, opt, env)
+	if tool.Options.ScratchGB > 0 && tool.Options.ScratchMode != "tmpfs" {
+		if scratchPath, ok := tool.Mounts[files.ScratchContainerPath]; ok {
+			// the scratch space is not part of the results and is removed after the run
+			defer os.RemoveAll(scratchPath)
+		}
+	}
+	if tool.Options.User != "" {
+		ownedPaths := []string{tool.Mounts["/in"], tool.Mounts["/out"]}
+		if scratchPath, ok := tool.Mounts[files.ScratchContainerPath]; ok {
+			ownedPaths = append(ownedPaths, scratchPath)
+		}
+		if err := files.PrepareMountOwnership(ownedPaths, tool.Options.User); err != nil {
+			updateDB(StatusErrored, ErrorInfrastructure, err)
+			return failedWith, err
+		}
 	}
 
-	runMode := "default"
 	if len(opt.Cmd) != 0 {
 		fmt.Printf("Custom CMD: %v\n", opt.Cmd)
-		config.Cmd = opt.Cmd
-	} else {
-		gotapPath, gotapFound, probeErr := toolImage.ProbeGotap(ctx, c, tool.Image)
-		if probeErr != nil {
-			updateDB("errored", probeErr)
-			return probeErr
-		}
-		if gotapFound {
-			config.Entrypoint = []string{gotapPath}
-			config.Cmd = []string{"run", tool.Name, "--input-file", "/in/inputs.json", "--spec-file", "/src/tool.yml"}
-			runMode = "gotap"
-			fmt.Printf("detected gotap shim at %s\n", gotapPath)
+	}
+	spec, err := newContainerSpec(ctx, c, tool, opt.Cmd)
+	if err != nil {
+		updateDB(StatusErrored, specErrorKind(err), err)
+		return failedWith, err
+	}
+	spec.Config.Labels = runLabels(opt, dockerclient.PurposeRun)
+	spec.Config.Env = mergeEnv(spec.Config.Env, opt.Env)
+	config, hostConfig, runMode, mounts := spec.Config, spec.HostConfig, spec.Mode, spec.HostConfig.Mounts
+	recordExecutionStrategy(ctx, opt, runMode)
+	recordImageDigest(ctx, opt, c)
+	if runMode == StrategyGotap {
+		fmt.Printf("detected gotap shim at %s\n", config.Entrypoint[0])
+	}
+	if usesPrepare(tool, runMode) {
+		preparedAt := time.Now()
+		result, err := prepareContainer(ctx, opt, c, spec)
+		if err := finishPrepare(ctx, opt, result, err, time.Since(preparedAt), updateDB); err != nil {
+			return failedWith, err
 		}
 	}
 	fmt.Printf("running tool %v with image: %v\n", tool.Name, tool.Image)
-	cont, err := c.ContainerCreate(ctx, &config, &container.HostConfig{
-		Mounts: mounts,
-	}, nil, nil, "")
+	cont, err := c.ContainerCreate(ctx, &config, &hostConfig, nil, toolImage.ParsePlatform(tool.Options.Platform), "")
 	if err != nil {
-		updateDB("errored", err)
-		return err
+		updateDB(StatusErrored, ErrorInfrastructure, err)
+		return failedWith, err
 	}
 	defer c.ContainerRemove(ctx, cont.ID, container.RemoveOptions{})
+	err = opt.DB.SetRunContainerID(ctx, db.SetRunContainerIDParams{
+		ContainerID: sql.NullString{String: cont.ID, Valid: true},
+		ID:          opt.Tool.ID,
+	})
+	if err != nil {
+		log.Printf("failed to persist the container of run %d: %v", opt.Tool.ID, err)
+	}
 	fmt.Printf("container created: %v\n", cont)
 
 	if err = c.ContainerStart(ctx, cont.ID, container.StartOptions{}); err != nil {
-		updateDB("errored", err)
+		updateDB(StatusErrored, ErrorInfrastructure, err)
 		fmt.Println("starting container failed")
-		return err
+		return failedWith, err
 	}
-	updateDB("started", nil)
+	updateDB(StatusRunning, "", nil)
+	startedAt := time.Now()
+	sampler := startStatsSampler(ctx, opt.DB, c, opt.Tool.ID, cont.ID, startedAt)
+	defer sampler.Stop()
+	go streamLogs(ctx, c, opt.Tool.ID, cont.ID)
+	toolEvents := startToolEvents(ctx, opt.DB, opt.Tool.ID, tool.Mounts["/out"])
+	defer toolEvents.Stop()
 
 	statusCh, errCh := c.ContainerWait(ctx, cont.ID, container.WaitConditionNotRunning)
 	var exitCode int64
@@ -124,54 +389,139 @@ func RunTool(ctx context.Context, opt RunToolOptions) error {
 	case err := <-errCh:
 		if err != nil {
 			fmt.Println(err)
-			updateDB("errored", err)
-			return err
+			updateDB(StatusErrored, waitErrorKind(err), err)
+			return failedWith, err
 		}
 	case status := <-statusCh:
 		if status.Error != nil {
 			err := errors.New(status.Error.Message)
-			updateDB("errored", err)
-			return err
+			updateDB(StatusErrored, ErrorInfrastructure, err)
+			return failedWith, err
 		}
 		exitCode = status.StatusCode
 		fmt.Println("container finished")
 	}
+	finishedAt := time.Now()
+	sampler.Stop()
+	toolEvents.Stop()
+	recordExitCode(ctx, opt, exitCode, finishedAt.Sub(startedAt))
 
 	logReader, err := c.ContainerLogs(ctx, cont.ID, container.LogsOptions{ShowStdout: true, ShowStderr: true})
 	if err != nil {
-		return err
+		return failedWith, err
 	}
 	defer logReader.Close()
 
-	stdout := new(bytes.Buffer)
-	stderr := new(bytes.Buffer)
-	if _, err := stdcopy.StdCopy(stdout, stderr, logReader); err != nil {
-		updateDB("errored", err)
-		return err
-	}
-
-	// create log files in the mounted out volume
+	// stream the logs into the mounted out volume
 	var outDir string
 	for _, mount := range mounts {
 		if mount.Target == "/out" {
 			outDir = mount.Source
-			os.WriteFile(path.Join(mount.Source, "STDOUT.log"), stdout.Bytes(), 0644)
-			os.WriteFile(path.Join(mount.Source, "STDERR.log"), stderr.Bytes(), 0644)
 			break
 		}
 	}
+	if err := writeLogs(ctx, opt, outDir, logReader); err != nil {
+		updateDB(StatusErrored, logsErrorKind(err), err)
+		return failedWith, err
+	}
+	err = completeAttempt(ctx, opt, c, cont.ID, env, runMode, outDir, startedAt, finishedAt, exitCode, updateDB)
+	return failedWith, err
+}
+
+func recordExecutionEnvironment(ctx context.Context, opt RunToolOptions, env *ExecutionEnvironment) {
+	envJSON, err := json.Marshal(env)
+	if err != nil {
+		return
+	}
+	err = opt.DB.SetRunExecutionEnvironment(ctx, db.SetRunExecutionEnvironmentParams{
+		ExecutionEnvironment: sql.NullString{String: string(envJSON), Valid: true},
+		ID:                   opt.Tool.ID,
+	})
+	if err != nil {
+		log.Printf("failed to persist the execution environment of run %d: %v", opt.Tool.ID, err)
+	}
+}
+
+func recordExecutionStrategy(ctx context.Context, opt RunToolOptions, strategy string) {
+	err := opt.DB.SetRunExecutionStrategy(ctx, db.SetRunExecutionStrategyParams{
+		ExecutionStrategy: sql.NullString{String: strategy, Valid: true},
+		ID:                opt.Tool.ID,
+	})
+	if err != nil {
+		log.Printf("failed to persist the execution strategy of run %d: %v", opt.Tool.ID, err)
+	}
+}
+
+// recordImageDigest keeps the digest the image of the run resolved to, as its tag may move later
+func recordImageDigest(ctx context.Context, opt RunToolOptions, c *client.Client) {
+	digest := imageDigest(ctx, c, opt.Tool.Image)
+	if digest == "" {
+		return
+	}
+	err := opt.DB.SetRunImageDigest(ctx, db.SetRunImageDigestParams{
+		ImageDigest: sql.NullString{String: digest, Valid: true},
+		ID:          opt.Tool.ID,
+	})
+	if err != nil {
+		log.Printf("failed to persist the image digest of run %d: %v", opt.Tool.ID, err)
+	}
+}
 
+func recordExitCode(ctx context.Context, opt RunToolOptions, exitCode int64, duration time.Duration) {
+	_, err := opt.DB.SetRunExitCode(ctx, db.SetRunExitCodeParams{
+		ExitCode:   sql.NullInt64{Int64: exitCode, Valid: true},
+		DurationMs: sql.NullInt64{Int64: duration.Milliseconds(), Valid: true},
+		ID:         opt.Tool.ID,
+	})
+	if err != nil {
+		log.Printf("failed to persist the exit code of run %d: %v", opt.Tool.ID, err)
+	}
+}
+
+// logsErrorKind tells a full /out folder from other failures to store the logs
+func logsErrorKind(err error) ErrorKind {
+	if errors.Is(err, syscall.ENOSPC) {
+		return ErrorDiskFull
+	}
+	return ErrorInfrastructure
+}
+
+// completeAttempt reads the metadata of the exited container, classifies its exit code and
+// verifies the outputs, before the run is marked as finished. The containerID is empty if
+// the runtime has no container the Docker daemon knows.
+func completeAttempt(ctx context.Context, opt RunToolOptions, c *client.Client, containerID string, env *ExecutionEnvironment, runMode string, outDir string, startedAt time.Time, finishedAt time.Time, exitCode int64, updateDB func(RunStatus, ErrorKind, error)) error {
+	tool := &opt.Tool
 	if outDir != "" {
+		if _, err := recordOutputBytes(ctx, opt.DB, opt.Tool.ID, outDir); err != nil {
+			log.Printf("failed to measure the output of run %d: %v", opt.Tool.ID, err)
+		}
 		metadataPath := path.Join(outDir, "_metadata.json")
+		if runMode != StrategyGotap {
+			if _, err := os.Stat(metadataPath); os.IsNotExist(err) {
+				if err := writeGeneratedMetadata(ctx, c, tool, env, outDir, startedAt, finishedAt, exitCode); err != nil {
+					log.Printf("failed to write generated metadata for run %d: %v", opt.Tool.ID, err)
+				}
+			}
+		}
 		metadataBytes, err := os.ReadFile(metadataPath)
 		if err == nil {
 			if json.Valid(metadataBytes) {
+				var durationMs sql.NullInt64
+				if metadata, err := ParseGotapMetadata(string(metadataBytes)); err == nil {
+					if metadata.DurationMs != nil {
+						durationMs = sql.NullInt64{Int64: *metadata.DurationMs, Valid: true}
+					}
+					recordMetadataAnnotations(ctx, opt.DB, opt.Tool.ID, metadata)
+				} else {
+					log.Printf("gotap metadata at %s does not match the known format: %v", metadataPath, err)
+				}
 				_, dbErr := opt.DB.SetRunGotapMetadata(ctx, db.SetRunGotapMetadataParams{
 					GotapMetadata: sql.NullString{
 						String: strings.TrimSpace(string(metadataBytes)),
 						Valid:  true,
 					},
-					ID: opt.Tool.ID,
+					DurationMs: durationMs,
+					ID:         opt.Tool.ID,
 				})
 				if dbErr != nil {
 					log.Printf("failed to persist gotap metadata for run %d: %v", opt.Tool.ID, dbErr)
@@ -186,9 +536,182 @@ func RunTool(ctx context.Context, opt RunToolOptions) error {
 
 	if exitCode != 0 {
 		runErr := fmt.Errorf("%s execution exited with status %d", runMode, exitCode)
-		updateDB("errored", runErr)
+		runErrKind := ErrorToolFailure
+		if kind, err := exitCause(ctx, c, containerID, outDir, startedAt); kind != "" {
+			runErr, runErrKind = fmt.Errorf("%s execution exited with status %d: %w", runMode, exitCode, err), kind
+		} else if runMode == StrategyGotap && isGotapValidationFailure(outDir) {
+			runErrKind = ErrorValidation
+		}
+		updateDB(StatusErrored, runErrKind, runErr)
 		return runErr
 	}
-	updateDB("finished", nil)
+	if err := verifyOutputs(ctx, opt, outDir); err != nil {
+		updateDB(StatusErrored, ErrorToolFailure, err)
+		return err
+	}
+	updateDB(StatusFinished, "", nil)
+	if outDir != "" && viper.GetBool("previews.enabled") {
+		inBackground(func() { generatePreviews(opt.Tool.ID, outDir) })
+	}
+	if outDir != "" {
+		inBackground(func() { uploadResultsInBackground(opt.DB, opt.Tool.ID, outDir) })
+	}
 	return nil
 }
+
+// background tracks the work runs leave to the background, like the previews and uploads of
+// finished runs or the resumed queued runs
+var background sync.WaitGroup
+
+func inBackground(work func()) {
+	background.Add(1)
+	go func() {
+		defer background.Done()
+		work()
+	}()
+}
+
+// StartRun runs the tool in the background, tracked with the other background work of runs.
+// The run outlives the request starting it, so it does not share its context.
+func StartRun(opt RunToolOptions) {
+	inBackground(func() { RunTool(context.Background(), opt) })
+}
+
+// generatePreviews runs in the background of a finished run, bounded by previews.timeout
+func generatePreviews(runID int64, outDir string) {
+	ctx, cancel := context.WithTimeout(context.Background(), viper.GetDuration("previews.timeout"))
+	defer cancel()
+
+	generated, err := files.GeneratePreviews(ctx, outDir, viper.GetInt64("previews.max_bytes"))
+	if err != nil {
+		log.Printf("generated %d previews of run %d before it failed: %v", generated, runID, err)
+	}
+}
+
+// uploadResultsInBackground copies the results of a finished run into the object storage,
+// failed uploads are retried by RetryPendingUploads
+func uploadResultsInBackground(DB *db.Queries, runID int64, outDir string) {
+	if err := UploadResults(context.Background(), DB, runID, outDir); err != nil {
+		log.Printf("failed to upload the results of run %d: %v", runID, err)
+	}
+}
+
+// runLabels are the labels of the containers gorun creates for the run, which find them
+// without a persisted container ID
+func runLabels(opt RunToolOptions, purpose string) map[string]string {
+	labels := dockerclient.Labels(purpose)
+	labels[dockerclient.LabelRunID] = strconv.FormatInt(opt.Tool.ID, 10)
+	labels[dockerclient.LabelUserID] = opt.UserId
+	return labels
+}
+
+// containerSpec is the container a run is executed in
+type containerSpec struct {
+	Config     container.Config
+	HostConfig container.HostConfig
+	// Mode is the execution strategy, like gotap if the image ships the gotap shim
+	Mode string
+}
+
+// newContainerSpec builds the container configuration of the run. Unless a custom command
+// is passed, the image is probed for gotap and its entry file, which is cached per image.
+func newContainerSpec(ctx context.Context, c *client.Client, tool *Tool, cmd []string) (containerSpec, error) {
+	mounts := make([]mount.Mount, 0, len(tool.Mounts))
+	for containerPath, hostPath := range tool.Mounts {
+		mounts = append(mounts, mount.Mount{
+			Type:   mount.TypeBind,
+			Source: hostPath,
+			Target: containerPath,
+			// datasets mounted from the host are never writable by the tool
+			ReadOnly: strings.HasPrefix(containerPath, "/in/"),
+		})
+	}
+	for _, extra := range tool.Options.ExtraMounts {
+		mounts = append(mounts, mount.Mount{
+			Type:     mount.TypeBind,
+			Source:   extra.HostPath,
+			Target:   extra.ContainerPath,
+			ReadOnly: extra.ReadOnly,
+		})
+	}
+	if tool.Options.ScratchGB > 0 && tool.Options.ScratchMode == "tmpfs" {
+		mounts = append(mounts, mount.Mount{
+			Type:   mount.TypeTmpfs,
+			Target: files.ScratchContainerPath,
+			TmpfsOptions: &mount.TmpfsOptions{
+				SizeBytes: int64(tool.Options.ScratchGB) << 30,
+			},
+		})
+	}
+	// the map of mounts has no order, the plan of a dry run should be stable
+	sort.Slice(mounts, func(i, j int) bool { return mounts[i].Target < mounts[j].Target })
+
+	spec := containerSpec{
+		Config: container.Config{
+			Image:        tool.Image,
+			User:         tool.Options.User,
+			Tty:          false,
+			AttachStdin:  false,
+			AttachStdout: true,
+			AttachStderr: true,
+		},
+		HostConfig: container.HostConfig{
+			Mounts: mounts,
+		},
+		Mode: StrategyImageDefault,
+	}
+	// an explicit command wins over gotap, which wins over the command and the entry file of the spec
+	override := tool.Options.CommandOverride
+	switch {
+	case len(cmd) != 0:
+		spec.Config.Cmd = cmd
+		spec.Mode = StrategyOverride
+	case override != nil:
+		spec.Config.Entrypoint = override.Entrypoint
+		spec.Config.Cmd = override.Cmd
+		spec.Mode = StrategyOverride
+	default:
+		gotap, gotapFound, err := toolImage.ProbeGotapTemplate(ctx, c, tool.Image)
+		if err != nil {
+			return containerSpec{}, err
+		}
+		if gotapFound {
+			args := gotap.RenderRunArgs(tool.Name)
+			if len(args) == 0 {
+				caps, err := toolImage.ProbeGotapCapabilities(ctx, c, tool.Image, gotap.Name)
+				if err != nil {
+					return containerSpec{}, err
+				}
+				if args, err = gotapRunArgs(tool.Name, caps); err != nil {
+					return containerSpec{}, err
+				}
+			}
+			spec.Config.Entrypoint = []string{gotap.Name}
+			spec.Config.Cmd = args
+			spec.Mode = StrategyGotap
+			break
+		}
+		if len(tool.Options.SpecCommand) != 0 {
+			spec.Config.Cmd = tool.Options.SpecCommand
+			spec.Mode = StrategySpecCommand
+			break
+		}
+		entry, found, err := specEntry(ctx, c, tool.Image)
+		if err != nil {
+			return containerSpec{}, err
+		}
+		if found {
+			spec.Config.Entrypoint = entry.Interpreter
+			spec.Config.Cmd = []string{entry.Path}
+			spec.Config.WorkingDir = "/src"
+			spec.Mode = StrategySpecEntry
+		}
+	}
+	if tool.Options.ParamEnv {
+		spec.Config.Env = paramEnv(tool)
+	}
+	if err := tool.Options.Hardening.ApplyTo(&spec.HostConfig); err != nil {
+		return containerSpec{}, err
+	}
+	return spec, nil
+}
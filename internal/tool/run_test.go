@@ -0,0 +1,372 @@
+package tool
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hydrocode-de/gorun/internal/db"
+	"github.com/hydrocode-de/gorun/internal/dockertest"
+	"github.com/spf13/viper"
+)
+
+// writeMessage is the run script of the test image, it writes the message parameter to /out
+func writeMessage(c *dockertest.Container) dockertest.Result {
+	inputs, _ := os.ReadFile(filepath.Join(c.HostPath("/in"), "inputs.json"))
+	os.WriteFile(filepath.Join(c.HostPath("/out"), "message.txt"), inputs, 0644)
+	return dockertest.Result{Stdout: "done\n", Stderr: "a warning\n"}
+}
+
+// runErrorKind reads the status and the error kind of the run
+func runErrorKind(t *testing.T, DB *db.Queries, runID int64) (RunStatus, ErrorKind) {
+	t.Helper()
+	record, err := GetRun(context.Background(), DB, runID, testUser)
+	if err != nil {
+		t.Fatalf("cannot read run %d: %v", runID, err)
+	}
+	return RunStatus(record.Status), ErrorKind(record.ErrorKind.String)
+}
+
+func TestRunToolFinishes(t *testing.T) {
+	DB := newTestDB(t)
+	daemon := dockertest.New(t)
+	addTestImage(daemon, writeMessage)
+	run := createTestRun(t, DB, CreateRunOptions{})
+
+	err := RunTool(context.Background(), RunToolOptions{DB: DB, Tool: run, UserId: testUser})
+	if err != nil {
+		t.Fatalf("RunTool failed: %v", err)
+	}
+	if status, kind := runErrorKind(t, DB, run.ID); status != StatusFinished || kind != "" {
+		t.Fatalf("the run is %s (%s), want %s", status, kind, StatusFinished)
+	}
+	message, err := os.ReadFile(filepath.Join(run.Mounts["/out"], "message.txt"))
+	if err != nil || !strings.Contains(string(message), "hello") {
+		t.Errorf("the tool did not see its parameters: %q, %v", message, err)
+	}
+	for file, want := range map[string]string{"STDOUT.log": "done\n", "STDERR.log": "a warning\n"} {
+		if got, _ := os.ReadFile(filepath.Join(run.Mounts["/out"], file)); string(got) != want {
+			t.Errorf("%s is %q, want %q", file, got, want)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(run.Mounts["/out"], "_metadata.json")); err != nil {
+		t.Errorf("no metadata was generated for the run: %v", err)
+	}
+
+	created := runContainers(daemon)
+	if len(created) != 1 {
+		t.Fatalf("%d containers were created, want 1", len(created))
+	}
+	if !daemon.Removed(created[0].ID) {
+		t.Error("the run container was not removed")
+	}
+	events := runEventTypes(t, DB, run.ID)
+	if !slices.Contains(events, EventAttempt) || slices.Contains(events, EventRetry) {
+		t.Errorf("the run recorded the events %v", events)
+	}
+}
+
+// the runs started in the background are waited for with the other background work
+func TestStartRunIsTracked(t *testing.T) {
+	DB := newTestDB(t)
+	daemon := dockertest.New(t)
+	addTestImage(daemon, func(c *dockertest.Container) dockertest.Result {
+		result := writeMessage(c)
+		result.Duration = 50 * time.Millisecond
+		return result
+	})
+	run := createTestRun(t, DB, CreateRunOptions{})
+
+	StartRun(RunToolOptions{DB: DB, Tool: run, UserId: testUser})
+	background.Wait()
+	if status := runStatus(t, DB, run.ID); status != StatusFinished {
+		t.Errorf("the run is %s once the background work is done, want %s", status, StatusFinished)
+	}
+}
+
+func TestRunToolTruncatesLogs(t *testing.T) {
+	DB := newTestDB(t)
+	viper.Set("run.max_log_bytes", 16)
+	daemon := dockertest.New(t)
+	addTestImage(daemon, func(c *dockertest.Container) dockertest.Result {
+		return dockertest.Result{Stdout: strings.Repeat("x", 64), Stderr: "a warning\n"}
+	})
+	run := createTestRun(t, DB, CreateRunOptions{})
+	truncated := TruncatedLogCount()
+
+	if err := RunTool(context.Background(), RunToolOptions{DB: DB, Tool: run, UserId: testUser}); err != nil {
+		t.Fatalf("RunTool failed: %v", err)
+	}
+	if n := TruncatedLogCount() - truncated; n != 1 {
+		t.Errorf("%d truncated logs were counted, want 1", n)
+	}
+	if logs := TruncatedLogs(context.Background(), DB, run.ID); !logs["STDOUT.log"] || logs["STDERR.log"] {
+		t.Errorf("the truncated logs are %v, want only STDOUT.log", logs)
+	}
+}
+
+func TestRunToolRunsOnce(t *testing.T) {
+	DB := newTestDB(t)
+	daemon := dockertest.New(t)
+	addTestImage(daemon, writeMessage)
+	run := createTestRun(t, DB, CreateRunOptions{})
+
+	if err := RunTool(context.Background(), RunToolOptions{DB: DB, Tool: run, UserId: testUser}); err != nil {
+		t.Fatalf("RunTool failed: %v", err)
+	}
+	err := RunTool(context.Background(), RunToolOptions{DB: DB, Tool: run, UserId: testUser})
+	if !errors.Is(err, ErrNotStartable) {
+		t.Errorf("the second start returned %v, want %v", err, ErrNotStartable)
+	}
+	if n := len(runContainers(daemon)); n != 1 {
+		t.Errorf("%d containers were created, want 1", n)
+	}
+}
+
+func TestRunToolErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		// run scripts the run container, fail the endpoints of the daemon
+		run      dockertest.Script
+		fail     map[string]string
+		wantKind ErrorKind
+	}{
+		{
+			name:     "the tool exits with an error",
+			run:      func(*dockertest.Container) dockertest.Result { return dockertest.Result{ExitCode: 2, Stderr: "boom\n"} },
+			wantKind: ErrorToolFailure,
+		},
+		{
+			name: "the tool is OOM killed",
+			run: func(*dockertest.Container) dockertest.Result {
+				return dockertest.Result{ExitCode: 137, OOMKilled: true}
+			},
+			wantKind: ErrorOOMKilled,
+		},
+		{
+			name:     "the container cannot be created",
+			run:      writeMessage,
+			fail:     map[string]string{"create_run": "no space left for the container"},
+			wantKind: ErrorInfrastructure,
+		},
+		{
+			name:     "the container cannot be started",
+			run:      func(*dockertest.Container) dockertest.Result { return dockertest.Result{StartError: "cannot start"} },
+			wantKind: ErrorInfrastructure,
+		},
+		{
+			name:     "waiting for the container fails",
+			run:      writeMessage,
+			fail:     map[string]string{"wait": "the daemon went away"},
+			wantKind: ErrorInfrastructure,
+		},
+		{
+			name:     "the daemon info cannot be read",
+			run:      writeMessage,
+			fail:     map[string]string{"info": "the daemon is restarting"},
+			wantKind: ErrorInfrastructure,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			DB := newTestDB(t)
+			daemon := dockertest.New(t)
+			addTestImage(daemon, tt.run)
+			run := createTestRun(t, DB, CreateRunOptions{})
+			invalidateEnvironment()
+			for endpoint, message := range tt.fail {
+				daemon.Fail[endpoint] = message
+			}
+
+			err := RunTool(context.Background(), RunToolOptions{DB: DB, Tool: run, UserId: testUser})
+			if err == nil {
+				t.Fatal("RunTool did not fail")
+			}
+			if status, kind := runErrorKind(t, DB, run.ID); status != StatusErrored || kind != tt.wantKind {
+				t.Errorf("the run is %s (%s), want %s (%s)", status, kind, StatusErrored, tt.wantKind)
+			}
+			if running := daemon.Running(); len(running) != 0 {
+				t.Errorf("%d containers are still running", len(running))
+			}
+		})
+	}
+}
+
+func TestRunToolRetriesInfrastructureErrors(t *testing.T) {
+	DB := newTestDB(t)
+	daemon := dockertest.New(t)
+	starts := 0
+	addTestImage(daemon, func(c *dockertest.Container) dockertest.Result {
+		if starts++; starts == 1 {
+			return dockertest.Result{StartError: "the network is not ready"}
+		}
+		return writeMessage(c)
+	})
+	run := createTestRun(t, DB, CreateRunOptions{MaxRetries: 2})
+
+	if err := RunTool(context.Background(), RunToolOptions{DB: DB, Tool: run, UserId: testUser}); err != nil {
+		t.Fatalf("RunTool failed: %v", err)
+	}
+	if status := runStatus(t, DB, run.ID); status != StatusFinished {
+		t.Errorf("the run is %s, want %s", status, StatusFinished)
+	}
+	if n := len(runContainers(daemon)); n != 2 {
+		t.Errorf("%d containers were created, want 2", n)
+	}
+	if events := runEventTypes(t, DB, run.ID); !slices.Contains(events, EventRetry) {
+		t.Errorf("the retry was not recorded: %v", events)
+	}
+}
+
+// a run whose attempt failed before its container started is still queued, which must
+// neither block the retry nor leave the run queued once the retries are exhausted
+func TestRunToolEarlyFailureIsNotStranded(t *testing.T) {
+	DB := newTestDB(t)
+	daemon := dockertest.New(t)
+	addTestImage(daemon, writeMessage)
+	daemon.Fail["create_run"] = "the daemon is overloaded"
+	run := createTestRun(t, DB, CreateRunOptions{MaxRetries: 2})
+
+	if err := RunTool(context.Background(), RunToolOptions{DB: DB, Tool: run, UserId: testUser}); err == nil {
+		t.Fatal("RunTool did not fail")
+	}
+	if status, kind := runErrorKind(t, DB, run.ID); status != StatusErrored || kind != ErrorInfrastructure {
+		t.Errorf("the run is %s (%s), want %s (%s)", status, kind, StatusErrored, ErrorInfrastructure)
+	}
+	if n := daemon.Calls("create_run"); n != 3 {
+		t.Errorf("the container was created %d times, want 3", n)
+	}
+	if events := runEventTypes(t, DB, run.ID); slices.Contains(events, EventIllegalTransition) {
+		t.Errorf("the retries recorded an illegal transition: %v", events)
+	}
+}
+
+func TestRunToolCancelledDuringBackoff(t *testing.T) {
+	DB := newTestDB(t)
+	viper.Set("run.retry_backoff", time.Hour)
+	daemon := dockertest.New(t)
+	addTestImage(daemon, writeMessage)
+	daemon.Fail["create_run"] = "the daemon is overloaded"
+	run := createTestRun(t, DB, CreateRunOptions{MaxRetries: 1})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- RunTool(ctx, RunToolOptions{DB: DB, Tool: run, UserId: testUser}) }()
+	waitFor(t, func() bool { return slices.Contains(runEventTypes(t, DB, run.ID), EventRetry) })
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("RunTool returned %v, want %v", err, context.Canceled)
+	}
+	if status, kind := runErrorKind(t, DB, run.ID); status != StatusCancelled || kind != ErrorCancelled {
+		t.Errorf("the run is %s (%s), want %s (%s)", status, kind, StatusCancelled, ErrorCancelled)
+	}
+}
+
+func TestRunToolWithGotap(t *testing.T) {
+	DB := newTestDB(t)
+	daemon := dockertest.New(t)
+	img := addTestImage(daemon, func(c *dockertest.Container) dockertest.Result {
+		if c.Config.Entrypoint[0] != "gotap" {
+			return dockertest.Result{ExitCode: 1, Stderr: "not started by gotap\n"}
+		}
+		os.WriteFile(filepath.Join(c.HostPath("/out"), "_metadata.json"), []byte(`{"tool":"echo","duration_ms":42}`), 0644)
+		return writeMessage(c)
+	})
+	img.Commands = gotapCommands
+	run := createTestRun(t, DB, CreateRunOptions{})
+
+	if err := RunTool(context.Background(), RunToolOptions{DB: DB, Tool: run, UserId: testUser}); err != nil {
+		t.Fatalf("RunTool failed: %v", err)
+	}
+	if status := runStatus(t, DB, run.ID); status != StatusFinished {
+		t.Fatalf("the run is %s, want %s", status, StatusFinished)
+	}
+	want := "gotap run echo --input-file /in/inputs.json --spec-file /src/tool.yml --output-folder /out"
+	if created := runContainers(daemon); len(created) != 1 || created[0].Command() != want {
+		t.Fatalf("the run container was not started as %q", want)
+	}
+	record, err := GetRun(context.Background(), DB, run.ID, testUser)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !record.GotapMetadata.Valid || record.DurationMs.Int64 != 42 {
+		t.Errorf("the gotap metadata was not recorded: %+v %+v", record.GotapMetadata, record.DurationMs)
+	}
+}
+
+func TestRunToolGotapValidationFailure(t *testing.T) {
+	DB := newTestDB(t)
+	daemon := dockertest.New(t)
+	img := addTestImage(daemon, func(c *dockertest.Container) dockertest.Result {
+		return dockertest.Result{ExitCode: 1, Stderr: "Error: " + gotapValidationMarker + ": message is required\n"}
+	})
+	img.Commands = gotapCommands
+	run := createTestRun(t, DB, CreateRunOptions{})
+
+	if err := RunTool(context.Background(), RunToolOptions{DB: DB, Tool: run, UserId: testUser}); err == nil {
+		t.Fatal("RunTool did not fail")
+	}
+	if status, kind := runErrorKind(t, DB, run.ID); status != StatusErrored || kind != ErrorValidation {
+		t.Errorf("the run is %s (%s), want %s (%s)", status, kind, StatusErrored, ErrorValidation)
+	}
+}
+
+// waitFor polls the condition for up to five seconds
+func waitFor(t *testing.T, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("the condition was not met in time")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestRunToolConcurrentStarts(t *testing.T) {
+	DB := newTestDB(t)
+	daemon := dockertest.New(t)
+	addTestImage(daemon, func(c *dockertest.Container) dockertest.Result {
+		result := writeMessage(c)
+		result.Duration = 50 * time.Millisecond
+		return result
+	})
+	run := createTestRun(t, DB, CreateRunOptions{})
+
+	const starts = 8
+	errs := make(chan error, starts)
+	var ready sync.WaitGroup
+	ready.Add(starts)
+	for range starts {
+		go func() {
+			ready.Done()
+			ready.Wait()
+			errs <- RunTool(context.Background(), RunToolOptions{DB: DB, Tool: run, UserId: testUser})
+		}()
+	}
+	succeeded := 0
+	for range starts {
+		err := <-errs
+		switch {
+		case err == nil:
+			succeeded++
+		case !errors.Is(err, ErrNotStartable):
+			t.Errorf("a refused start returned %v, want %v", err, ErrNotStartable)
+		}
+	}
+	if succeeded != 1 {
+		t.Errorf("%d of the concurrent starts succeeded, want 1", succeeded)
+	}
+	if n := daemon.Calls("create_run"); n != 1 {
+		t.Errorf("%d run containers were created, want 1", n)
+	}
+	if status := runStatus(t, DB, run.ID); status != StatusFinished {
+		t.Errorf("the run is %s, want %s", status, StatusFinished)
+	}
+}
@@ -0,0 +1,141 @@
+package tool
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/docker/docker/client"
+	"github.com/hydrocode-de/gorun/internal/db"
+	"github.com/hydrocode-de/gorun/internal/dockerclient"
+	"github.com/hydrocode-de/gorun/internal/files"
+	"github.com/hydrocode-de/gorun/internal/sshremote"
+	"github.com/hydrocode-de/tool-spec-go/validate"
+	"github.com/spf13/viper"
+)
+
+// the container runtimes a run can be executed with
+const (
+	RuntimeDocker    = "docker"
+	RuntimeApptainer = "apptainer"
+	RuntimeSSH       = "ssh"
+)
+
+// ResolveRuntime falls back to the server default run.runtime if no runtime was requested
+func ResolveRuntime(requested string) (string, error) {
+	runtime := requested
+	if runtime == "" {
+		runtime = viper.GetString("run.runtime")
+	}
+	switch runtime {
+	case RuntimeDocker, RuntimeApptainer, RuntimeSSH:
+		return runtime, nil
+	default:
+		return "", fmt.Errorf("invalid runtime %s. Has to be one of 'docker', 'apptainer' or 'ssh'", runtime)
+	}
+}
+
+// checkRuntime only lets admins move a run to the remote host of the ssh runtime,
+// unless it is the server default anyway
+func checkRuntime(ctx context.Context, DB *db.Queries, requested string, userID string) error {
+	if requested != RuntimeSSH || viper.GetString("run.runtime") == RuntimeSSH {
+		return nil
+	}
+	user, err := DB.GetUserByID(ctx, userID)
+	if err != nil || !user.IsAdmin {
+		return fmt.Errorf("only admins may run tools with the ssh runtime: %w", ErrForbidden)
+	}
+	return nil
+}
+
+// RuntimeClient returns the Docker client of the runtime, the remote daemon for ssh runs
+func RuntimeClient(runtime string) (*client.Client, error) {
+	if runtime == RuntimeSSH {
+		return sshremote.DockerClient()
+	}
+	return dockerclient.Get()
+}
+
+// runtimeOf reads the runtime of a stored run, runs created before the runtimes existed used docker
+func runtimeOf(run db.Run) string {
+	var options struct {
+		Runtime string `json:"runtime"`
+	}
+	if err := json.Unmarshal([]byte(run.Options), &options); err != nil || options.Runtime == "" {
+		return RuntimeDocker
+	}
+	return options.Runtime
+}
+
+// validateRuntime rejects the options of a run which the runtime cannot apply. Apptainer
+// runs the tool as the user of gorun, without seccomp profiles, process limits or tmpfs mounts.
+func validateRuntime(opts *CreateRunOptions, runtime string) []error {
+	if runtime == RuntimeSSH {
+		return validateSSHRuntime()
+	}
+	if runtime != RuntimeApptainer {
+		return nil
+	}
+	errs := make([]error, 0)
+	unsupported := func(name string, actual string, message string) {
+		errs = append(errs, &validate.ValidationError{
+			Field:    "runtime",
+			Name:     name,
+			Type:     validate.NotAllowed,
+			Expected: "an option supported by apptainer",
+			Actual:   actual,
+			Message:  fmt.Sprintf("the apptainer runtime %s", message),
+		})
+	}
+
+	hardening := HardeningFromConfig().WithOverride(opts.Hardening)
+	if hardening.SeccompProfile != "" {
+		unsupported("seccomp_profile", hardening.SeccompProfile, "does not apply seccomp profiles")
+	}
+	if hardening.PidsLimit > 0 {
+		unsupported("pids_limit", fmt.Sprint(hardening.PidsLimit), "does not limit the number of processes")
+	}
+	if len(hardening.CapAdd) > 0 {
+		unsupported("cap_add", fmt.Sprint(hardening.CapAdd), "does not grant capabilities to unprivileged containers")
+	}
+	if opts.Platform != "" {
+		unsupported("platform", opts.Platform, "does not emulate images of other platforms")
+	}
+	if opts.RunAsRoot {
+		unsupported("run_as_root", "true", "runs the tool as the user of gorun and not as root")
+	}
+	if user := viper.GetString("run.user"); user != "" && user != files.DefaultRunUser() {
+		unsupported("user", user, fmt.Sprintf("runs the tool as the user of gorun %s and not as run.user", files.DefaultRunUser()))
+	}
+	if opts.ScratchGB > 0 && viper.GetString("scratch_mode") == "tmpfs" {
+		unsupported("scratch_mode", "tmpfs", "does not support tmpfs scratch space, use the scratch_mode host")
+	}
+	return errs
+}
+
+// validateSSHRuntime rejects ssh runs if no remote host is configured. The extra_mounts
+// of the server are paths on the gorun host, which do not exist on the remote host.
+func validateSSHRuntime() []error {
+	errs := make([]error, 0)
+	if !sshremote.Configured() {
+		errs = append(errs, &validate.ValidationError{
+			Field:    "runtime",
+			Name:     "runtime",
+			Type:     validate.NotAllowed,
+			Expected: "a configured runtime.ssh.host",
+			Actual:   RuntimeSSH,
+			Message:  sshremote.ErrNotConfigured.Error(),
+		})
+	}
+	if extraMounts, err := files.ExtraMountsFromConfig(); err == nil && len(extraMounts) > 0 {
+		errs = append(errs, &validate.ValidationError{
+			Field:    "runtime",
+			Name:     "extra_mounts",
+			Type:     validate.NotAllowed,
+			Expected: "no extra_mounts",
+			Actual:   fmt.Sprint(len(extraMounts)),
+			Message:  "the ssh runtime cannot bind the extra_mounts of the server on the remote host",
+		})
+	}
+	return errs
+}
@@ -0,0 +1,276 @@
+package tool
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hydrocode-de/gorun/internal/db"
+	"github.com/spf13/viper"
+)
+
+// Priority orders the runs waiting for a free slot, see run.max_concurrent
+type Priority string
+
+const (
+	PriorityLow    Priority = "low"
+	PriorityNormal Priority = "normal"
+	PriorityHigh   Priority = "high"
+)
+
+// ErrDequeued is returned to a run which was removed from the queue while it waited
+var ErrDequeued = errors.New("the run was removed from the queue")
+
+// ParsePriority defaults to the normal priority
+func ParsePriority(priority string) (Priority, error) {
+	switch Priority(priority) {
+	case "":
+		return PriorityNormal, nil
+	case PriorityLow, PriorityNormal, PriorityHigh:
+		return Priority(priority), nil
+	}
+	return "", fmt.Errorf("invalid priority %s. Has to be one of 'low', 'normal' or 'high'", priority)
+}
+
+func (p Priority) level() int {
+	switch p {
+	case PriorityLow:
+		return 0
+	case PriorityHigh:
+		return 2
+	default:
+		return 1
+	}
+}
+
+// checkPriority only lets admins run with high priority
+func checkPriority(ctx context.Context, DB *db.Queries, priority string, userID string) error {
+	if Priority(priority) != PriorityHigh {
+		return nil
+	}
+	user, err := DB.GetUserByID(ctx, userID)
+	if err != nil || !user.IsAdmin {
+		return fmt.Errorf("only admins may run with high priority: %w", ErrForbidden)
+	}
+	return nil
+}
+
+// queuedRun waits in the scheduler until a slot is granted on ready
+type queuedRun struct {
+	runID    int64
+	priority Priority
+	seq      uint64
+	queuedAt time.Time
+	ready    chan error
+}
+
+// rank is the priority of the run, promoted by one level per aging interval it waited,
+// so that low priority runs eventually start under sustained load of high priority runs
+func (q *queuedRun) rank(now time.Time, aging time.Duration) int {
+	rank := q.priority.level()
+	if aging > 0 {
+		rank += int(now.Sub(q.queuedAt) / aging)
+	}
+	return min(rank, PriorityHigh.level())
+}
+
+// scheduler limits the runs executing at the same time. Waiting runs are started by
+// their rank, runs of the same rank in the order they were queued.
+type scheduler struct {
+	mu      sync.Mutex
+	running int
+	seq     uint64
+	waiting []*queuedRun
+	// limit and aging are read from run.max_concurrent and run.priority_aging, if nil
+	limit func() int
+	aging func() time.Duration
+	now   func() time.Time
+}
+
+var runScheduler = &scheduler{
+	limit: func() int { return viper.GetInt("run.max_concurrent") },
+	aging: func() time.Duration { return viper.GetDuration("run.priority_aging") },
+	now:   time.Now,
+}
+
+// hasSlot tells if another run may start, s.mu has to be held
+func (s *scheduler) hasSlot() bool {
+	limit := s.limit()
+	return limit <= 0 || s.running < limit
+}
+
+// acquire returns at once if a slot is free and no other run waits. Otherwise queued is
+// called before the run waits for its turn, the context or its removal from the queue.
+func (s *scheduler) acquire(ctx context.Context, runID int64, priority Priority, queued func()) (func(), error) {
+	s.mu.Lock()
+	if len(s.waiting) == 0 && s.hasSlot() {
+		s.running++
+		s.mu.Unlock()
+		return s.release, nil
+	}
+	s.seq++
+	entry := &queuedRun{runID: runID, priority: priority, seq: s.seq, queuedAt: s.now(), ready: make(chan error, 1)}
+	s.waiting = append(s.waiting, entry)
+	s.mu.Unlock()
+
+	queued()
+	select {
+	case err := <-entry.ready:
+		if err != nil {
+			return nil, err
+		}
+		return s.release, nil
+	case <-ctx.Done():
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.remove(entry) {
+			return nil, ctx.Err()
+		}
+		// the slot was granted meanwhile, so it is handed on
+		if err := <-entry.ready; err == nil {
+			s.running--
+			s.dispatch()
+		}
+		return nil, ctx.Err()
+	}
+}
+
+// release frees the slot of a run and starts the next waiting ones
+func (s *scheduler) release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.running--
+	s.dispatch()
+}
+
+// dispatch grants the free slots to the waiting runs of the highest rank, s.mu has to be held
+func (s *scheduler) dispatch() {
+	for len(s.waiting) > 0 && s.hasSlot() {
+		next := s.ordered()[0]
+		s.remove(next)
+		s.running++
+		next.ready <- nil
+	}
+}
+
+// ordered sorts the waiting runs by the order they will start in, s.mu has to be held
+func (s *scheduler) ordered() []*queuedRun {
+	now, aging := s.now(), s.aging()
+	ordered := append([]*queuedRun{}, s.waiting...)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		ri, rj := ordered[i].rank(now, aging), ordered[j].rank(now, aging)
+		if ri != rj {
+			return ri > rj
+		}
+		return ordered[i].seq < ordered[j].seq
+	})
+	return ordered
+}
+
+// remove drops the entry from the waiting runs, s.mu has to be held
+func (s *scheduler) remove(entry *queuedRun) bool {
+	for i, waiting := range s.waiting {
+		if waiting == entry {
+			s.waiting = append(s.waiting[:i], s.waiting[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// position is the 1-based place of the run among the waiting runs
+func (s *scheduler) position(runID int64) (int, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, waiting := range s.ordered() {
+		if waiting.runID == runID {
+			return i + 1, true
+		}
+	}
+	return 0, false
+}
+
+// dequeue removes the run from the waiting runs, its RunTool returns ErrDequeued
+func (s *scheduler) dequeue(runID int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, waiting := range s.waiting {
+		if waiting.runID == runID {
+			s.remove(waiting)
+			waiting.ready <- ErrDequeued
+			return
+		}
+	}
+}
+
+// QueuePosition tells the place of a queued run among the runs waiting for a free slot
+// of run.max_concurrent, starting at 1. Runs which do not wait have no position.
+func QueuePosition(runID int64) (int, bool) {
+	return runScheduler.position(runID)
+}
+
+// ResumeQueuedRuns executes the queued runs again, which lost their RunTool when gorun
+// stopped while they waited for a slot or for the backoff of a retry. It is called once on
+// startup of the server, before it accepts requests. Trashed runs and runs which cannot be
+// read anymore are marked errored with ErrorInfrastructure instead. The resumed runs wait
+// for a slot in the order they were created.
+func ResumeQueuedRuns(ctx context.Context, DB *db.Queries) ([]int64, error) {
+	runs, err := DB.GetQueuedRuns(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	resumed := make([]int64, 0, len(runs))
+	for _, run := range runs {
+		queued, err := FromDBRun(run)
+		if err == nil && run.DeletedAt.Valid {
+			err = fmt.Errorf("the run is in the trash")
+		}
+		if err != nil {
+			err := transitionRun(ctx, DB, run.ID, StatusErrored, func() (int64, error) {
+				return DB.RunErrored(ctx, db.RunErroredParams{
+					ID:           run.ID,
+					ErrorKind:    sql.NullString{String: string(ErrorInfrastructure), Valid: true},
+					ErrorMessage: sql.NullString{String: fmt.Sprintf("the queued run could not be resumed after a restart: %v", err), Valid: true},
+				})
+			})
+			if err != nil && !errors.Is(err, ErrIllegalTransition) {
+				log.Printf("failed to mark the queued run %d as errored: %v", run.ID, err)
+			}
+			continue
+		}
+
+		RecordRunEvent(ctx, DB, run.ID, EventReconciled, "the queued run was resumed after a restart")
+		inBackground(func() {
+			RunTool(ctx, RunToolOptions{DB: DB, Tool: queued, Env: []string{}, UserId: run.UserID, Claimed: true})
+		})
+		resumed = append(resumed, run.ID)
+	}
+	return resumed, nil
+}
+
+// acquireRunSlot waits for a slot of run.max_concurrent. A run which has to wait is
+// set to queued, unless it already is after a failed attempt.
+func acquireRunSlot(ctx context.Context, opt RunToolOptions) (func(), error) {
+	priority, err := ParsePriority(opt.Tool.Options.Priority)
+	if err != nil {
+		return nil, err
+	}
+	return runScheduler.acquire(ctx, opt.Tool.ID, priority, func() {
+		if current, err := opt.DB.GetRunStatusByID(ctx, opt.Tool.ID); err == nil && RunStatus(current) != StatusQueued {
+			err := transitionRun(ctx, opt.DB, opt.Tool.ID, StatusQueued, func() (int64, error) {
+				return opt.DB.QueueRun(ctx, opt.Tool.ID)
+			})
+			if err != nil && !errors.Is(err, ErrIllegalTransition) {
+				RecordRunEvent(ctx, opt.DB, opt.Tool.ID, EventQueued, fmt.Sprintf("failed to mark the run as queued: %v", err))
+			}
+		}
+		position, _ := QueuePosition(opt.Tool.ID)
+		RecordRunEvent(ctx, opt.DB, opt.Tool.ID, EventQueued, fmt.Sprintf("waiting for a free slot with %s priority at position %d", priority, position))
+	})
+}
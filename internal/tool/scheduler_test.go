@@ -0,0 +1,196 @@
+package tool
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hydrocode-de/gorun/internal/dockertest"
+)
+
+// testScheduler has one slot and a clock which only moves with advance
+type testScheduler struct {
+	*scheduler
+	clock   time.Time
+	started chan startedRun
+}
+
+type startedRun struct {
+	runID   int64
+	release func()
+	err     error
+}
+
+func newTestScheduler(aging time.Duration) *testScheduler {
+	s := &testScheduler{clock: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), started: make(chan startedRun, 16)}
+	s.scheduler = &scheduler{
+		limit: func() int { return 1 },
+		aging: func() time.Duration { return aging },
+		// the clock is only advanced while no run is acquired
+		now: func() time.Time { return s.clock },
+	}
+	return s
+}
+
+// enqueue acquires a slot for the run in the background and returns once the run waits
+func (s *testScheduler) enqueue(runID int64, priority Priority) {
+	waiting := make(chan struct{})
+	go func() {
+		release, err := s.acquire(context.Background(), runID, priority, func() { close(waiting) })
+		s.started <- startedRun{runID: runID, release: release, err: err}
+	}()
+	<-waiting
+}
+
+// next waits for the run which got the slot
+func (s *testScheduler) next(t *testing.T) startedRun {
+	t.Helper()
+	select {
+	case run := <-s.started:
+		return run
+	case <-time.After(5 * time.Second):
+		t.Fatal("no run got the free slot")
+	}
+	return startedRun{}
+}
+
+func (s *testScheduler) advance(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.clock = s.clock.Add(d)
+}
+
+// startLoad lets a high priority run hold the only slot
+func startLoad(t *testing.T, s *testScheduler) func() {
+	t.Helper()
+	release, err := s.acquire(context.Background(), 1, PriorityHigh, func() { t.Error("the first run had to wait") })
+	if err != nil {
+		t.Fatal(err)
+	}
+	return release
+}
+
+// sustainHighLoad queues a high priority run whenever the slot is released, for the
+// given number of steps. It returns the step the low priority run 2 started at, or -1.
+func sustainHighLoad(t *testing.T, s *testScheduler, release func(), steps int) int {
+	t.Helper()
+	for step := 0; step < steps; step++ {
+		s.enqueue(int64(100+step), PriorityHigh)
+		s.advance(30 * time.Second)
+		release()
+		run := s.next(t)
+		if run.err != nil {
+			t.Fatal(run.err)
+		}
+		if run.runID == 2 {
+			run.release()
+			return step
+		}
+		release = run.release
+	}
+	release()
+	return -1
+}
+
+func TestSchedulerAgingPreventsStarvation(t *testing.T) {
+	s := newTestScheduler(time.Minute)
+	release := startLoad(t, s)
+	s.enqueue(2, PriorityLow)
+
+	// the low priority run reaches the high priority after two minutes of waiting and
+	// then starts before the high priority runs queued after it
+	step := sustainHighLoad(t, s, release, 20)
+	if step != 3 {
+		t.Fatalf("the low priority run started at step %d, want 3", step)
+	}
+}
+
+func TestSchedulerWithoutAgingStarves(t *testing.T) {
+	s := newTestScheduler(0)
+	release := startLoad(t, s)
+	s.enqueue(2, PriorityLow)
+
+	if step := sustainHighLoad(t, s, release, 20); step != -1 {
+		t.Fatalf("the low priority run started at step %d without aging", step)
+	}
+	if run := s.next(t); run.runID != 2 {
+		t.Fatalf("run %d started once the load ended, want 2", run.runID)
+	}
+}
+
+func TestSchedulerOrder(t *testing.T) {
+	s := newTestScheduler(time.Hour)
+	release := startLoad(t, s)
+	// runs of the same priority start in the order they were queued
+	for _, queued := range []struct {
+		runID    int64
+		priority Priority
+	}{{2, PriorityLow}, {3, PriorityNormal}, {4, PriorityHigh}, {5, PriorityNormal}, {6, PriorityHigh}} {
+		s.enqueue(queued.runID, queued.priority)
+	}
+	if position, ok := s.position(4); !ok || position != 1 {
+		t.Errorf("the first high priority run is at position %d, want 1", position)
+	}
+
+	want := []int64{4, 6, 3, 5, 2}
+	for _, runID := range want {
+		release()
+		run := s.next(t)
+		if run.runID != runID {
+			t.Fatalf("run %d started, want %d", run.runID, runID)
+		}
+		release = run.release
+	}
+	release()
+	if s.running != 0 || len(s.waiting) != 0 {
+		t.Errorf("%d runs hold a slot and %d wait after all finished", s.running, len(s.waiting))
+	}
+}
+
+func TestSchedulerDequeue(t *testing.T) {
+	s := newTestScheduler(time.Hour)
+	release := startLoad(t, s)
+	s.enqueue(2, PriorityNormal)
+	s.enqueue(3, PriorityNormal)
+
+	s.dequeue(2)
+	if run := s.next(t); run.runID != 2 || !errors.Is(run.err, ErrDequeued) {
+		t.Fatalf("the dequeued run returned %v", run.err)
+	}
+	if _, ok := s.position(2); ok {
+		t.Error("the dequeued run still has a position")
+	}
+	release()
+	if run := s.next(t); run.runID != 3 || run.err != nil {
+		t.Fatalf("run %d started with %v, want run 3", run.runID, run.err)
+	}
+}
+
+func TestResumeQueuedRuns(t *testing.T) {
+	ctx := context.Background()
+	DB := newTestDB(t)
+	addTestImage(dockertest.New(t), writeMessage)
+	queued := createTestRun(t, DB, CreateRunOptions{})
+	trashed := createTestRun(t, DB, CreateRunOptions{})
+	for _, runID := range []int64{queued.ID, trashed.ID} {
+		if err := ClaimRun(ctx, DB, runID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := DB.TrashRun(ctx, trashed.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	resumed, err := ResumeQueuedRuns(ctx, DB)
+	if err != nil {
+		t.Fatalf("ResumeQueuedRuns failed: %v", err)
+	}
+	if len(resumed) != 1 || resumed[0] != queued.ID {
+		t.Fatalf("the runs %v were resumed, want %d", resumed, queued.ID)
+	}
+	waitFor(t, func() bool { return runStatus(t, DB, queued.ID) == StatusFinished })
+	if status, kind := runErrorKind(t, DB, trashed.ID); status != StatusErrored || kind != ErrorInfrastructure {
+		t.Errorf("the trashed run is %s (%s), want %s (%s)", status, kind, StatusErrored, ErrorInfrastructure)
+	}
+}
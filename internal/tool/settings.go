@@ -0,0 +1,113 @@
+package tool
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hydrocode-de/gorun/internal/db"
+)
+
+// UserSettings are the defaults of a user for the fields a new run omits. The per-run
+// values in the payload always win, so unset settings are nil.
+type UserSettings struct {
+	ScratchGB  *int    `json:"scratch_gb,omitempty"`
+	DataMode   *string `json:"data_mode,omitempty"`
+	MaxRetries *int    `json:"max_retries,omitempty"`
+	Notify     *bool   `json:"notify,omitempty"`
+	ProjectID  *int64  `json:"project_id,omitempty"`
+	Runtime    *string `json:"runtime,omitempty"`
+	UsePrepare *bool   `json:"use_prepare,omitempty"`
+	Priority   *string `json:"priority,omitempty"`
+	// UpdatedAt is set on read, it is not stored as setting
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+}
+
+// GetUserSettings loads the settings of the user, a user without settings has empty ones
+func GetUserSettings(ctx context.Context, DB *db.Queries, userID string) (UserSettings, error) {
+	row, err := DB.GetUserSettings(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return UserSettings{}, nil
+	}
+	if err != nil {
+		return UserSettings{}, err
+	}
+	var settings UserSettings
+	if err := json.Unmarshal([]byte(row.Settings), &settings); err != nil {
+		return UserSettings{}, fmt.Errorf("the settings of user %s are corrupt: %w", userID, err)
+	}
+	settings.UpdatedAt = &row.UpdatedAt
+	return settings, nil
+}
+
+// SetUserSettings replaces the settings of the user. They are checked against the same
+// bounds and permissions as the options of a run, so that no illegal defaults are stored.
+func SetUserSettings(ctx context.Context, DB *db.Queries, userID string, settings UserSettings) (UserSettings, error) {
+	if err := validateUserSettings(ctx, DB, settings, userID); err != nil {
+		return UserSettings{}, err
+	}
+	settings.UpdatedAt = nil
+	content, err := json.Marshal(settings)
+	if err != nil {
+		return UserSettings{}, err
+	}
+	if err := DB.SetUserSettings(ctx, db.SetUserSettingsParams{UserID: userID, Settings: string(content)}); err != nil {
+		return UserSettings{}, err
+	}
+	return GetUserSettings(ctx, DB, userID)
+}
+
+func validateUserSettings(ctx context.Context, DB *db.Queries, settings UserSettings, userID string) error {
+	if settings.Runtime != nil {
+		if err := checkRuntime(ctx, DB, *settings.Runtime, userID); err != nil {
+			return err
+		}
+	}
+	if settings.ProjectID != nil {
+		if err := checkProject(ctx, DB, *settings.ProjectID, userID); err != nil {
+			return err
+		}
+	}
+	if settings.Priority != nil {
+		if err := checkPriority(ctx, DB, *settings.Priority, userID); err != nil {
+			return err
+		}
+	}
+
+	errs := make([]error, 0)
+	if settings.ScratchGB != nil {
+		if err := scratchGBError(*settings.ScratchGB); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if settings.MaxRetries != nil {
+		if err := maxRetriesError(*settings.MaxRetries); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if settings.DataMode != nil {
+		if _, err := ResolveDataMode(*settings.DataMode); err != nil {
+			errs = append(errs, dataModeError(*settings.DataMode, err))
+		}
+	}
+	if settings.Runtime != nil {
+		if _, err := ResolveRuntime(*settings.Runtime); err != nil {
+			errs = append(errs, runtimeError(*settings.Runtime, err))
+		}
+	}
+	if settings.Priority != nil {
+		if _, err := ParsePriority(*settings.Priority); err != nil {
+			errs = append(errs, priorityError(*settings.Priority, err))
+		}
+	}
+	if len(errs) > 0 {
+		return &ValidationError{
+			Message: "the provided settings are invalid",
+			Errors:  errs,
+		}
+	}
+	return nil
+}
@@ -0,0 +1,198 @@
+package tool
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+	"github.com/hydrocode-de/gorun/internal/db"
+	"github.com/hydrocode-de/gorun/internal/dockerclient"
+	"github.com/hydrocode-de/gorun/internal/files"
+	"github.com/hydrocode-de/gorun/internal/sshremote"
+	"github.com/hydrocode-de/gorun/internal/toolImage"
+	"github.com/spf13/viper"
+)
+
+// remoteRunDir is the directory of the run below runtime.ssh.work_path on the remote host
+func remoteRunDir(runID int64) string {
+	return path.Join(viper.GetString("runtime.ssh.work_path"), fmt.Sprintf("run-%d", runID))
+}
+
+// runSSHAttempt executes the run with the Docker daemon of the remote host. The mounts are
+// copied to the remote host before the start and /out is copied back once the container
+// exited. The image has to be available to the remote daemon.
+func runSSHAttempt(ctx context.Context, opt RunToolOptions, updateDB func(RunStatus, ErrorKind, error)) error {
+	c, err := sshremote.DockerClient()
+	if err != nil {
+		updateDB(StatusErrored, ErrorInfrastructure, err)
+		return err
+	}
+	env, err := daemonEnvironment(ctx, c)
+	if err != nil {
+		updateDB(StatusErrored, ErrorInfrastructure, err)
+		return err
+	}
+	recordExecutionEnvironment(ctx, opt, env)
+
+	remoteDir := remoteRunDir(opt.Tool.ID)
+	defer func() {
+		// remove the copies with a fresh deadline, the run may have been cancelled
+		cleanupCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), time.Minute)
+		defer cancel()
+		if err := sshremote.Run(cleanupCtx, "rm -rf "+sshremote.Quote(remoteDir), nil, io.Discard); err != nil {
+			log.Printf("failed to remove the remote directory of run %d: %v", opt.Tool.ID, err)
+		}
+	}()
+	remoteTool, err := uploadMounts(ctx, opt.Tool, remoteDir)
+	if err != nil {
+		updateDB(StatusErrored, ErrorInfrastructure, err)
+		return err
+	}
+	if tool := &opt.Tool; tool.Options.ScratchGB > 0 && tool.Options.ScratchMode != "tmpfs" {
+		// the local scratch directory was only created to be copied
+		if scratchPath, ok := tool.Mounts[files.ScratchContainerPath]; ok {
+			defer os.RemoveAll(scratchPath)
+		}
+	}
+
+	spec, err := newContainerSpec(ctx, c, &remoteTool, opt.Cmd)
+	if err != nil {
+		updateDB(StatusErrored, specErrorKind(err), err)
+		return err
+	}
+	spec.Config.Labels = runLabels(opt, dockerclient.PurposeRun)
+	spec.Config.Env = mergeEnv(spec.Config.Env, opt.Env)
+	recordExecutionStrategy(ctx, opt, spec.Mode)
+	recordImageDigest(ctx, opt, c)
+	if usesPrepare(&remoteTool, spec.Mode) {
+		preparedAt := time.Now()
+		result, err := prepareContainer(ctx, opt, c, spec)
+		if err := finishPrepare(ctx, opt, result, err, time.Since(preparedAt), updateDB); err != nil {
+			return err
+		}
+	}
+	fmt.Printf("running tool %v with image %v on %v\n", remoteTool.Name, remoteTool.Image, sshremote.Host())
+	cont, err := c.ContainerCreate(ctx, &spec.Config, &spec.HostConfig, nil, toolImage.ParsePlatform(remoteTool.Options.Platform), "")
+	if err != nil {
+		updateDB(StatusErrored, ErrorInfrastructure, err)
+		return err
+	}
+	defer func() {
+		cleanupCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), time.Minute)
+		defer cancel()
+		c.ContainerRemove(cleanupCtx, cont.ID, container.RemoveOptions{Force: true})
+	}()
+	err = opt.DB.SetRunContainerID(ctx, db.SetRunContainerIDParams{
+		ContainerID: sql.NullString{String: cont.ID, Valid: true},
+		ID:          opt.Tool.ID,
+	})
+	if err != nil {
+		log.Printf("failed to persist the container of run %d: %v", opt.Tool.ID, err)
+	}
+
+	if err = c.ContainerStart(ctx, cont.ID, container.StartOptions{}); err != nil {
+		updateDB(StatusErrored, ErrorInfrastructure, err)
+		return err
+	}
+	updateDB(StatusRunning, "", nil)
+	startedAt := time.Now()
+	exitCode, err := waitRemoteContainer(ctx, opt, c, cont.ID)
+	if err != nil {
+		updateDB(StatusErrored, waitErrorKind(err), err)
+		return err
+	}
+	finishedAt := time.Now()
+	recordExitCode(ctx, opt, exitCode, finishedAt.Sub(startedAt))
+
+	outDir := opt.Tool.Mounts["/out"]
+	if err := sshremote.Download(ctx, remoteTool.Mounts["/out"], outDir); err != nil {
+		err = fmt.Errorf("could not copy /out back from %s: %w", sshremote.Host(), err)
+		updateDB(StatusErrored, ErrorInfrastructure, err)
+		return err
+	}
+	logReader, err := c.ContainerLogs(ctx, cont.ID, container.LogsOptions{ShowStdout: true, ShowStderr: true})
+	if err != nil {
+		updateDB(StatusErrored, ErrorInfrastructure, err)
+		return err
+	}
+	defer logReader.Close()
+	if err := writeLogs(ctx, opt, outDir, logReader); err != nil {
+		updateDB(StatusErrored, ErrorInfrastructure, err)
+		return err
+	}
+	return completeAttempt(ctx, opt, c, cont.ID, env, spec.Mode, outDir, startedAt, finishedAt, exitCode, updateDB)
+}
+
+// uploadMounts copies the mounts of the run below remoteDir and returns the run with the
+// remote paths as mounts. /out and the scratch space are created empty and writable for
+// the user of the container, who is not the ssh user.
+func uploadMounts(ctx context.Context, tool Tool, remoteDir string) (Tool, error) {
+	remoteTool := tool
+	remoteTool.Mounts = make(map[string]string, len(tool.Mounts))
+	containerPaths := make([]string, 0, len(tool.Mounts))
+	for containerPath := range tool.Mounts {
+		containerPaths = append(containerPaths, containerPath)
+	}
+	// the datasets mounted below /in are copied after /in itself
+	sort.Strings(containerPaths)
+
+	writable := make([]string, 0)
+	for _, containerPath := range containerPaths {
+		remotePath := path.Join(remoteDir, "mounts", containerPath)
+		remoteTool.Mounts[containerPath] = remotePath
+		if containerPath == "/out" || containerPath == files.ScratchContainerPath {
+			writable = append(writable, sshremote.Quote(remotePath))
+			continue
+		}
+		if err := sshremote.Upload(ctx, tool.Mounts[containerPath], remotePath); err != nil {
+			return Tool{}, fmt.Errorf("could not copy %s to %s: %w", containerPath, sshremote.Host(), err)
+		}
+	}
+	if len(writable) > 0 {
+		paths := strings.Join(writable, " ")
+		if err := sshremote.Run(ctx, fmt.Sprintf("mkdir -p %s && chmod 0777 %s", paths, paths), nil, io.Discard); err != nil {
+			return Tool{}, err
+		}
+	}
+	return remoteTool, nil
+}
+
+// waitRemoteContainer waits for the container to exit. If the connection to the remote
+// host is lost, it reconnects up to runtime.ssh.reconnect_attempts times and waits on the
+// container again, which keeps running on the remote host in the meantime.
+func waitRemoteContainer(ctx context.Context, opt RunToolOptions, c *client.Client, containerID string) (int64, error) {
+	maxAttempts := viper.GetInt("runtime.ssh.reconnect_attempts")
+	for attempt := 1; ; attempt++ {
+		statusCh, errCh := c.ContainerWait(ctx, containerID, container.WaitConditionNotRunning)
+		var err error
+		select {
+		case err = <-errCh:
+		case status := <-statusCh:
+			if status.Error != nil {
+				return 0, errors.New(status.Error.Message)
+			}
+			return status.StatusCode, nil
+		}
+		if ctx.Err() != nil || !sshremote.IsConnectionLoss(err) || attempt > maxAttempts {
+			return 0, err
+		}
+
+		backoff := retryBackoff(attempt)
+		RecordRunEvent(ctx, opt.DB, opt.Tool.ID, EventReconnect, fmt.Sprintf("lost the connection to %s, reconnecting in %s (%d of %d): %v", sshremote.Host(), backoff, attempt, maxAttempts, err))
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		}
+	}
+}
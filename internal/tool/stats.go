@@ -0,0 +1,180 @@
+package tool
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+	"github.com/hydrocode-de/gorun/internal/db"
+	"github.com/hydrocode-de/gorun/internal/events"
+	"github.com/spf13/viper"
+)
+
+// statsSampler polls one-shot stats of a running container every run.stats_interval
+// and keeps the peaks and totals in the run_stats table up to date.
+type statsSampler struct {
+	DB          *db.Queries
+	c           *client.Client
+	runID       int64
+	containerID string
+	startedAt   time.Time
+
+	mu       sync.Mutex
+	stats    db.SetRunStatsParams
+	cpuNanos uint64
+	cpuRead  time.Time
+
+	cancel   context.CancelFunc
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// startStatsSampler starts sampling the container in the background. It returns nil
+// if run.stats_interval is 0, Stop may be called on the nil sampler anyway.
+func startStatsSampler(ctx context.Context, DB *db.Queries, c *client.Client, runID int64, containerID string, startedAt time.Time) *statsSampler {
+	interval := viper.GetDuration("run.stats_interval")
+	if interval <= 0 {
+		return nil
+	}
+
+	// the sampler is stopped by the run, not by the context of a single request
+	sampleCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	s := &statsSampler{
+		DB:          DB,
+		c:           c,
+		runID:       runID,
+		containerID: containerID,
+		startedAt:   startedAt,
+		stats:       db.SetRunStatsParams{RunID: runID},
+		cancel:      cancel,
+		done:        make(chan struct{}),
+	}
+	go s.loop(sampleCtx, interval)
+	return s
+}
+
+func (s *statsSampler) loop(ctx context.Context, interval time.Duration) {
+	defer close(s.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := s.sample(ctx); err != nil {
+			// a broken stats stream ends the sampling, never the run
+			if ctx.Err() == nil {
+				log.Printf("stopped sampling the resource usage of run %d: %v", s.runID, err)
+			}
+			return
+		}
+		s.persist(context.WithoutCancel(ctx), false)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Stop ends the sampling, reads the final snapshot of the exited container and
+// finalizes the run_stats row. It does not wait longer than a few seconds on the daemon.
+func (s *statsSampler) Stop() {
+	if s == nil {
+		return
+	}
+	s.stopOnce.Do(func() {
+		s.cancel()
+		<-s.done
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := s.sample(ctx); err != nil {
+			log.Printf("failed to read the final resource usage of run %d: %v", s.runID, err)
+		}
+		s.persist(ctx, true)
+	})
+}
+
+func (s *statsSampler) sample(ctx context.Context) error {
+	reader, err := s.c.ContainerStatsOneShot(ctx, s.containerID)
+	if err != nil {
+		return err
+	}
+	defer reader.Body.Close()
+
+	var stats container.StatsResponse
+	if err := json.NewDecoder(reader.Body).Decode(&stats); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.add(stats)
+	return nil
+}
+
+// add merges a snapshot into the totals. An exited container reports empty stats,
+// so all values are only ever raised.
+func (s *statsSampler) add(stats container.StatsResponse) {
+	s.stats.Samples++
+	s.stats.PeakMemoryBytes = max(s.stats.PeakMemoryBytes, memoryUsage(stats.MemoryStats))
+
+	if cpuNanos := stats.CPUStats.CPUUsage.TotalUsage; cpuNanos > s.cpuNanos {
+		s.cpuNanos, s.cpuRead = cpuNanos, stats.Read
+		// CPU time over wall time since the start, 100% is one fully used core
+		if elapsed := s.cpuRead.Sub(s.startedAt); elapsed > 0 {
+			s.stats.AvgCpuPercent = float64(s.cpuNanos) / float64(elapsed.Nanoseconds()) * 100
+		}
+	}
+
+	var blockRead, blockWrite int64
+	for _, entry := range stats.BlkioStats.IoServiceBytesRecursive {
+		switch strings.ToLower(entry.Op) {
+		case "read":
+			blockRead += int64(entry.Value)
+		case "write":
+			blockWrite += int64(entry.Value)
+		}
+	}
+	s.stats.BlockReadBytes = max(s.stats.BlockReadBytes, blockRead)
+	s.stats.BlockWriteBytes = max(s.stats.BlockWriteBytes, blockWrite)
+
+	var netRx, netTx int64
+	for _, network := range stats.Networks {
+		netRx += int64(network.RxBytes)
+		netTx += int64(network.TxBytes)
+	}
+	s.stats.NetRxBytes = max(s.stats.NetRxBytes, netRx)
+	s.stats.NetTxBytes = max(s.stats.NetTxBytes, netTx)
+}
+
+// memoryUsage returns the resident memory without the page cache, like docker stats does
+func memoryUsage(stats container.MemoryStats) int64 {
+	usage := stats.Usage
+	// cgroup v2 reports inactive_file, cgroup v1 total_inactive_file
+	for _, key := range []string{"inactive_file", "total_inactive_file"} {
+		if inactive, ok := stats.Stats[key]; ok && inactive < usage {
+			usage -= inactive
+			break
+		}
+	}
+	return int64(usage)
+}
+
+func (s *statsSampler) persist(ctx context.Context, finalized bool) {
+	s.mu.Lock()
+	params := s.stats
+	s.mu.Unlock()
+
+	params.Finalized = finalized
+	params.UpdatedAt = time.Now().UTC()
+	if err := s.DB.SetRunStats(ctx, params); err != nil {
+		log.Printf("failed to persist the resource usage of run %d: %v", s.runID, err)
+	}
+	events.Publish(events.RunChannel(s.runID, events.TopicStats), "stats", params)
+}
@@ -0,0 +1,163 @@
+package tool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/hydrocode-de/gorun/internal/db"
+	"github.com/hydrocode-de/gorun/internal/events"
+)
+
+type RunStatus string
+
+const (
+	StatusPending   RunStatus = "pending"
+	StatusQueued    RunStatus = "queued"
+	StatusRunning   RunStatus = "running"
+	StatusFinished  RunStatus = "finished"
+	StatusErrored   RunStatus = "errored"
+	StatusCancelled RunStatus = "cancelled"
+	StatusExpired   RunStatus = "expired"
+	StatusPurged    RunStatus = "purged"
+)
+
+// ErrorKind tells where the failure of an errored run occurred
+type ErrorKind string
+
+const (
+	ErrorToolFailure    ErrorKind = "tool_failure"
+	ErrorInfrastructure ErrorKind = "infrastructure"
+	ErrorTimeout        ErrorKind = "timeout"
+	ErrorCancelled      ErrorKind = "cancelled"
+	ErrorValidation     ErrorKind = "validation"
+	// the tool was killed for exceeding its memory, or its /out folder ran out of space
+	ErrorOOMKilled ErrorKind = "oom_killed"
+	ErrorDiskFull  ErrorKind = "disk_full"
+	// the /out folder grew beyond the max_output_bytes of the run
+	ErrorOutputQuotaExceeded ErrorKind = "output_quota_exceeded"
+)
+
+func ParseErrorKind(kind string) (ErrorKind, error) {
+	switch ErrorKind(kind) {
+	case ErrorToolFailure, ErrorInfrastructure, ErrorTimeout, ErrorCancelled, ErrorValidation, ErrorOOMKilled, ErrorDiskFull, ErrorOutputQuotaExceeded:
+		return ErrorKind(kind), nil
+	}
+	return "", fmt.Errorf("unknown error kind %s", kind)
+}
+
+var ErrIllegalTransition = errors.New("illegal run status transition")
+
+// runTransitions lists the statuses a run may move to from its current status
+var runTransitions = map[RunStatus][]RunStatus{
+	StatusPending: {StatusQueued, StatusRunning, StatusErrored, StatusCancelled, StatusExpired, StatusPurged},
+	StatusQueued:  {StatusRunning, StatusErrored, StatusCancelled, StatusPurged},
+	// a running run is queued again to retry after an infrastructure failure
+	StatusRunning:   {StatusFinished, StatusErrored, StatusCancelled, StatusQueued},
+	StatusFinished:  {StatusPurged},
+	StatusErrored:   {StatusPurged},
+	StatusCancelled: {StatusPurged},
+	StatusExpired:   {StatusPurged},
+	StatusPurged:    {},
+}
+
+func ParseRunStatus(status string) (RunStatus, error) {
+	runStatus := RunStatus(status)
+	if _, ok := runTransitions[runStatus]; !ok {
+		return "", fmt.Errorf("unknown run status %s", status)
+	}
+	return runStatus, nil
+}
+
+func (s RunStatus) CanTransitionTo(next RunStatus) bool {
+	for _, allowed := range runTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+// IsTerminal reports if the run does not execute anymore
+func (s RunStatus) IsTerminal() bool {
+	return s == StatusFinished || s == StatusErrored || s == StatusCancelled || s == StatusExpired || s == StatusPurged
+}
+
+// Run event types
+const (
+	EventStatusChanged      = "status_changed"
+	EventIllegalTransition  = "illegal_transition"
+	EventAttempt            = "attempt"
+	EventRetry              = "retry"
+	EventReconciled         = "reconciled"
+	EventRuntimeWarning     = "runtime_warning"
+	EventRuntimeExceeded    = "runtime_exceeded"
+	EventPossiblyStalled    = "possibly_stalled"
+	EventLogTruncated       = "log_truncated"
+	EventNotificationFailed = "notification_failed"
+	EventOutputsMissing     = "outputs_missing"
+	EventOutputsUnexpected  = "outputs_unexpected"
+	EventReconnect          = "reconnect"
+	EventPrepareStarted     = "prepare_started"
+	EventPrepareFinished    = "prepare_finished"
+	EventTrashed            = "trashed"
+	EventRestored           = "restored"
+	EventToolEvent          = "tool_event"
+	EventToolEventMalformed = "tool_event_malformed"
+	EventQueued             = "queued"
+	EventSpecRefreshed      = "spec_refreshed"
+	EventOutputExceeded     = "output_quota_exceeded"
+	EventStorageUploaded    = "storage_uploaded"
+	EventStorageFailed      = "storage_failed"
+	EventLocalRemoved       = "local_results_removed"
+	EventExpired            = "expired"
+)
+
+// RecordRunEvent stores an event of the run and publishes it on the status channel of
+// the run. Failing to do so is only logged, as events must never break the run itself.
+func RecordRunEvent(ctx context.Context, DB *db.Queries, runID int64, eventType string, message string) {
+	event, err := DB.CreateRunEvent(ctx, db.CreateRunEventParams{
+		RunID:   runID,
+		Type:    eventType,
+		Message: message,
+	})
+	if err != nil {
+		log.Printf("failed to record the %s event of run %d: %v", eventType, runID, err)
+		return
+	}
+	events.Publish(events.RunChannel(runID, events.TopicStatus), eventType, event)
+}
+
+// transitionRun moves the run to the next status with the update. The update has to compare
+// and swap: it only changes the run while its status may move to next, and returns the number
+// of runs it changed. An illegal transition, also one the run took in the meantime by another
+// update, is logged and recorded as run event and an error wrapping ErrIllegalTransition is returned.
+func transitionRun(ctx context.Context, DB *db.Queries, runID int64, next RunStatus, update func() (int64, error)) error {
+	current, err := DB.GetRunStatusByID(ctx, runID)
+	if err != nil {
+		return err
+	}
+	if !RunStatus(current).CanTransitionTo(next) {
+		return illegalTransition(ctx, DB, runID, current, next)
+	}
+	updated, err := update()
+	if err != nil {
+		return err
+	}
+	if updated == 0 {
+		if now, err := DB.GetRunStatusByID(ctx, runID); err == nil {
+			current = now
+		}
+		return illegalTransition(ctx, DB, runID, current, next)
+	}
+	RecordRunEvent(ctx, DB, runID, EventStatusChanged, fmt.Sprintf("%s -> %s", current, next))
+	return nil
+}
+
+func illegalTransition(ctx context.Context, DB *db.Queries, runID int64, current string, next RunStatus) error {
+	err := fmt.Errorf("run %d cannot change from %s to %s: %w", runID, current, next, ErrIllegalTransition)
+	log.Println(err)
+	RecordRunEvent(ctx, DB, runID, EventIllegalTransition, fmt.Sprintf("%s -> %s", current, next))
+	return err
+}
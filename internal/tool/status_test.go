@@ -0,0 +1,112 @@
+package tool
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/hydrocode-de/gorun/internal/db"
+)
+
+var allStatuses = []RunStatus{StatusPending, StatusQueued, StatusRunning, StatusFinished, StatusErrored, StatusCancelled, StatusExpired, StatusPurged}
+
+func TestRunTransitionMatrix(t *testing.T) {
+	// want lists every legal transition, all others are illegal
+	want := map[RunStatus][]RunStatus{
+		StatusPending:   {StatusQueued, StatusRunning, StatusErrored, StatusCancelled, StatusExpired, StatusPurged},
+		StatusQueued:    {StatusRunning, StatusErrored, StatusCancelled, StatusPurged},
+		StatusRunning:   {StatusFinished, StatusErrored, StatusCancelled, StatusQueued},
+		StatusFinished:  {StatusPurged},
+		StatusErrored:   {StatusPurged},
+		StatusCancelled: {StatusPurged},
+		StatusExpired:   {StatusPurged},
+		StatusPurged:    {},
+	}
+	for _, from := range allStatuses {
+		for _, to := range allStatuses {
+			if got, legal := from.CanTransitionTo(to), slices.Contains(want[from], to); got != legal {
+				t.Errorf("%s -> %s is legal: %v, want %v", from, to, got, legal)
+			}
+		}
+	}
+}
+
+// statusUpdates are the queries which move a run to a status
+func statusUpdates(ctx context.Context, DB *db.Queries, runID int64) map[RunStatus]func() (int64, error) {
+	message := sql.NullString{String: "test", Valid: true}
+	return map[RunStatus]func() (int64, error){
+		StatusQueued: func() (int64, error) { return DB.QueueRun(ctx, runID) },
+		StatusRunning: func() (int64, error) {
+			_, err := DB.StartRun(ctx, db.StartRunParams{ID: runID, UserID: testUser})
+			if errors.Is(err, sql.ErrNoRows) {
+				return 0, nil
+			}
+			return 1, err
+		},
+		StatusFinished: func() (int64, error) { return DB.FinishRun(ctx, runID) },
+		StatusErrored: func() (int64, error) {
+			return DB.RunErrored(ctx, db.RunErroredParams{ID: runID, ErrorMessage: message, ErrorKind: sql.NullString{String: string(ErrorToolFailure), Valid: true}})
+		},
+		StatusCancelled: func() (int64, error) { return DB.CancelRun(ctx, db.CancelRunParams{ID: runID, ErrorMessage: message}) },
+		StatusExpired:   func() (int64, error) { return DB.ExpireRun(ctx, db.ExpireRunParams{ID: runID, ErrorMessage: message}) },
+	}
+}
+
+// the updates compare and swap, so they only apply to the runs which may take the transition
+func TestRunStatusUpdatesCompareAndSwap(t *testing.T) {
+	ctx := context.Background()
+	conn, DB := newTestDBConn(t)
+	run := createTestRunRecord(t, DB)
+
+	for _, from := range allStatuses {
+		for to, update := range statusUpdates(ctx, DB, run) {
+			if _, err := conn.Exec("UPDATE runs SET status = ? WHERE id = ?", from, run); err != nil {
+				t.Fatal(err)
+			}
+			updated, err := update()
+			if err != nil {
+				t.Fatalf("%s -> %s failed: %v", from, to, err)
+			}
+			if legal := from.CanTransitionTo(to); (updated == 1) != legal {
+				t.Errorf("%s -> %s updated %d runs, the transition is legal: %v", from, to, updated, legal)
+			}
+		}
+	}
+}
+
+func TestTransitionRun(t *testing.T) {
+	ctx := context.Background()
+	conn, DB := newTestDBConn(t)
+	run := createTestRunRecord(t, DB)
+	updates := statusUpdates(ctx, DB, run)
+
+	if err := transitionRun(ctx, DB, run, StatusQueued, updates[StatusQueued]); err != nil {
+		t.Fatalf("pending -> queued failed: %v", err)
+	}
+	if err := transitionRun(ctx, DB, run, StatusFinished, updates[StatusFinished]); !errors.Is(err, ErrIllegalTransition) {
+		t.Errorf("queued -> finished returned %v, want %v", err, ErrIllegalTransition)
+	}
+	if status := runStatus(t, DB, run); status != StatusQueued {
+		t.Errorf("the illegal transition changed the run to %s", status)
+	}
+
+	// another update finishes the run between the check and the update
+	err := transitionRun(ctx, DB, run, StatusErrored, func() (int64, error) {
+		if _, err := conn.Exec("UPDATE runs SET status = 'cancelled' WHERE id = ?", run); err != nil {
+			return 0, err
+		}
+		return updates[StatusErrored]()
+	})
+	if !errors.Is(err, ErrIllegalTransition) {
+		t.Errorf("the raced transition returned %v, want %v", err, ErrIllegalTransition)
+	}
+	if status := runStatus(t, DB, run); status != StatusCancelled {
+		t.Errorf("the raced transition changed the run to %s", status)
+	}
+	want := []string{EventStatusChanged, EventIllegalTransition, EventIllegalTransition}
+	if events := runEventTypes(t, DB, run); !slices.Equal(events, want) {
+		t.Errorf("the transitions recorded %v, want %v", events, want)
+	}
+}
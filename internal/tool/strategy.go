@@ -0,0 +1,63 @@
+package tool
+
+import (
+	"context"
+	"log"
+	"path"
+	"slices"
+
+	"github.com/docker/docker/client"
+	"github.com/hydrocode-de/gorun/internal/toolImage"
+	"github.com/spf13/viper"
+)
+
+// the execution strategy decides how the container of a run is started
+const (
+	StrategyOverride     = "override"
+	StrategyGotap        = "gotap"
+	StrategySpecCommand  = "spec_command"
+	StrategySpecEntry    = "spec_entry"
+	StrategyImageDefault = "image_default"
+)
+
+// the values of run.spec_entry
+const (
+	SpecEntryAuto   = "auto"
+	SpecEntryAlways = "always"
+	SpecEntryNever  = "never"
+)
+
+// specEntry returns the run file of the image to execute instead of its default command.
+// With run.spec_entry set to auto, it is only used if the default command of the image looks
+// unsuitable: there is no entrypoint and the CMD is missing or one of run.interactive_commands,
+// i.e. a shell or an interpreter waiting for input.
+func specEntry(ctx context.Context, c *client.Client, imageName string) (toolImage.EntryFile, bool, error) {
+	mode := viper.GetString("run.spec_entry")
+	switch mode {
+	case SpecEntryNever:
+		return toolImage.EntryFile{}, false, nil
+	case SpecEntryAlways:
+	default:
+		if mode != SpecEntryAuto {
+			log.Printf("unknown run.spec_entry %s, using %s", mode, SpecEntryAuto)
+		}
+		info, err := c.ImageInspect(ctx, imageName)
+		if err != nil {
+			return toolImage.EntryFile{}, false, err
+		}
+		if info.Config != nil && !defaultCommandUnsuitable(info.Config.Entrypoint, info.Config.Cmd) {
+			return toolImage.EntryFile{}, false, nil
+		}
+	}
+	return toolImage.FindEntryFile(ctx, c, imageName)
+}
+
+func defaultCommandUnsuitable(entrypoint []string, cmd []string) bool {
+	if len(entrypoint) != 0 {
+		return false
+	}
+	if len(cmd) == 0 {
+		return true
+	}
+	return slices.Contains(viper.GetStringSlice("run.interactive_commands"), path.Base(cmd[0]))
+}
@@ -0,0 +1,104 @@
+package tool
+
+import (
+	"time"
+
+	"github.com/hydrocode-de/gorun/internal/db"
+	"github.com/hydrocode-de/gorun/internal/files"
+)
+
+// RunSummary is the projection of a run used for listings. Unlike FromDBRun, it does not
+// parse the JSON columns of the run, only the path of the /out mount is read by the query.
+type RunSummary struct {
+	ID          int64     `json:"id"`
+	Name        string    `json:"name"`
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	Image       string    `json:"image"`
+	Status      string    `json:"status"`
+	CreatedAt   time.Time `json:"created_at"`
+	StartedAt   time.Time `json:"started_at,omitempty"`
+	FinishedAt  time.Time `json:"finished_at,omitempty"`
+	DurationMs  *int64    `json:"duration_ms,omitempty"`
+	ExitCode    *int64    `json:"exit_code,omitempty"`
+	Error       string    `json:"error,omitempty"`
+	ErrorKind   ErrorKind `json:"error_kind,omitempty"`
+	Attempts    int64     `json:"attempts"`
+	// ExecutionStrategy is how the container was started, like gotap or spec_entry
+	ExecutionStrategy string     `json:"execution_strategy,omitempty"`
+	ProjectID         *int64     `json:"project_id,omitempty"`
+	DeletedAt         *time.Time `json:"deleted_at,omitempty"`
+	Progress          *float64   `json:"progress,omitempty"`
+	outPath           string
+}
+
+func SummaryFromDBRow(row db.GetRunSummariesRow) RunSummary {
+	summary := RunSummary{
+		ID:          row.ID,
+		Name:        row.Name,
+		Title:       row.Title,
+		Description: row.Description,
+		Image:       row.DockerImage,
+		Status:      row.Status,
+		CreatedAt:   row.CreatedAt,
+		StartedAt:   row.StartedAt.Time,
+		FinishedAt:  row.FinishedAt.Time,
+		Error:       row.ErrorMessage.String,
+		ErrorKind:   ErrorKind(row.ErrorKind.String),
+		Attempts:    row.Attempts,
+
+		ExecutionStrategy: row.ExecutionStrategy.String,
+		outPath:           row.OutPath,
+	}
+	if row.DurationMs.Valid {
+		summary.DurationMs = &row.DurationMs.Int64
+	}
+	if row.ExitCode.Valid {
+		summary.ExitCode = &row.ExitCode.Int64
+	}
+	if row.ProjectID.Valid {
+		summary.ProjectID = &row.ProjectID.Int64
+	}
+	if row.DeletedAt.Valid {
+		summary.DeletedAt = &row.DeletedAt.Time
+	}
+	if row.Progress.Valid {
+		summary.Progress = &row.Progress.Float64
+	}
+	return summary
+}
+
+// Summary returns the listing projection of a fully loaded run
+func (t *Tool) Summary() RunSummary {
+	return RunSummary{
+		ID:          t.ID,
+		Name:        t.Name,
+		Title:       t.Title,
+		Description: t.Description,
+		Image:       t.Image,
+		Status:      t.Status,
+		CreatedAt:   t.CreatedAt,
+		StartedAt:   t.StartedAt,
+		FinishedAt:  t.FinishedAt,
+		DurationMs:  t.DurationMs,
+		ExitCode:    t.ExitCode,
+		Error:       t.Error,
+		ErrorKind:   t.ErrorKind,
+		Attempts:    t.Attempts,
+
+		ExecutionStrategy: t.ExecutionStrategy,
+		ProjectID:         t.ProjectID,
+		DeletedAt:         t.DeletedAt,
+		Progress:          t.Progress,
+		outPath:           t.Mounts["/out"],
+	}
+}
+
+// ListResults lists the result files of the run like Tool.ListResults
+func (s RunSummary) ListResults() ([]files.ResultFile, error) {
+	run := Tool{ID: s.ID, Name: s.Name, Status: s.Status}
+	if s.outPath != "" {
+		run.Mounts = map[string]string{"/out": s.outPath}
+	}
+	return run.ListResults()
+}
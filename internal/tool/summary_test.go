@@ -0,0 +1,120 @@
+package tool
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/hydrocode-de/gorun/internal/db"
+)
+
+// addListedRuns adds n finished runs of testUser with parameters, data, mounts and options
+// of the size real runs carry
+func addListedRuns(t testing.TB, conn *sql.DB, n int) {
+	t.Helper()
+	parameters := make(map[string]interface{})
+	for i := range 20 {
+		parameters[fmt.Sprintf("parameter_%02d", i)] = fmt.Sprintf("a value of the parameter %d", i)
+	}
+	parametersJSON, _ := json.Marshal(parameters)
+	tx, err := conn.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	insert, err := tx.Prepare(`INSERT INTO runs (name, title, description, docker_image, parameters, data, mounts, options, user_id, created_at, status, started_at, finished_at, duration_ms, exit_code)
+		VALUES (?, 'Echo', 'Writes the message', ?, ?, ?, ?, ?, ?, '2026-01-01 09:00:00', 'finished', '2026-01-01 10:00:00', '2026-01-01 10:01:00', 60000, 0)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range n {
+		mounts := fmt.Sprintf(`{"/in": "/data/mounts/%[1]d/in", "/out": "/data/mounts/%[1]d/out", "/scratch": "/data/mounts/%[1]d/scratch"}`, i)
+		data := fmt.Sprintf(`{"input": "/data/inputs/%d/input.txt"}`, i)
+		options := `{"max_retries": 3, "user": "1000:1000", "hardening": {"read_only": true, "cap_drop": ["ALL"]}, "outputs": {"result.csv": {"type": "table"}}}`
+		if _, err := insert.Exec(testTool, testImage, string(parametersJSON), data, mounts, options, testUser); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// the summary read by the listing query equals the summary of the fully loaded run
+func TestSummaryFromDBRow(t *testing.T) {
+	setTestConfig(t)
+	conn, DB := newTestDBConn(t)
+	ctx := context.Background()
+	addListedRuns(t, conn, 2)
+	// a pending run without mounts and an errored run in the trash
+	createTestRunRecord(t, DB)
+	errored := createTestRunRecord(t, DB)
+	if _, err := conn.Exec(`UPDATE runs SET status = 'errored', error_message = 'the tool failed', error_kind = 'tool_failure', exit_code = 2,
+		attempts = 2, execution_strategy = 'gotap', progress = 0.5, deleted_at = '2026-01-02 10:00:00', mounts = '{"/out": "/data/errored/out"}' WHERE id = ?`, errored); err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := DB.GetRunSummaries(ctx, db.GetRunSummariesParams{UserID: testUser, UserID_2: testUser})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 4 {
+		t.Fatalf("the listing has %d runs, want 4", len(rows))
+	}
+	for _, row := range rows {
+		run, err := GetRun(ctx, DB, row.ID, testUser)
+		if err != nil {
+			t.Fatal(err)
+		}
+		full, err := FromDBRun(run)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := SummaryFromDBRow(row), full.Summary(); !reflect.DeepEqual(got, want) {
+			t.Errorf("the summary of run %d is\n%+v\nwant\n%+v", row.ID, got, want)
+		}
+	}
+}
+
+// BenchmarkListRuns compares the listing of 5000 runs as summaries with the listing of
+// the fully loaded runs
+func BenchmarkListRuns(b *testing.B) {
+	setTestConfig(b)
+	conn, DB := newTestDBConn(b)
+	ctx := context.Background()
+	addListedRuns(b, conn, 5000)
+
+	b.Run("summaries", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			rows, err := DB.GetRunSummaries(ctx, db.GetRunSummariesParams{UserID: testUser, UserID_2: testUser})
+			if err != nil {
+				b.Fatal(err)
+			}
+			summaries := make([]RunSummary, 0, len(rows))
+			for _, row := range rows {
+				summaries = append(summaries, SummaryFromDBRow(row))
+			}
+		}
+	})
+	b.Run("full", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			runs, err := DB.GetAllRuns(ctx, db.GetAllRunsParams{UserID: testUser, UserID_2: testUser})
+			if err != nil {
+				b.Fatal(err)
+			}
+			summaries := make([]RunSummary, 0, len(runs))
+			for _, run := range runs {
+				full, err := FromDBRun(run)
+				if err != nil {
+					b.Fatal(err)
+				}
+				summaries = append(summaries, full.Summary())
+			}
+		}
+	})
+}
@@ -1,12 +1,63 @@
 package tool
 
 import (
+	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"time"
 
 	"github.com/hydrocode-de/gorun/internal/db"
+	"github.com/hydrocode-de/gorun/internal/files"
+	"github.com/hydrocode-de/gorun/internal/outputs"
 )
 
+// RunOptions holds the per-run execution settings, which are stored as JSON with the run
+type RunOptions struct {
+	ExtraMounts []files.ExtraMount `json:"extra_mounts,omitempty"`
+	ScratchGB   int                `json:"scratch_gb,omitempty"`
+	ScratchMode string             `json:"scratch_mode,omitempty"`
+	DataMode    string             `json:"data_mode,omitempty"`
+	User        string             `json:"user,omitempty"`
+	RunAsRoot   bool               `json:"run_as_root,omitempty"`
+	MaxRetries  int                `json:"max_retries,omitempty"`
+	Hardening   Hardening          `json:"hardening"`
+	// Platform is passed to Docker for images which do not match the host,
+	// the results of such emulated runs may differ from native ones
+	Platform string `json:"platform,omitempty"`
+	Emulated bool   `json:"emulated,omitempty"`
+	// Notify overrides the notification preference of the user for this run
+	Notify *bool `json:"notify,omitempty"`
+	// DefaultedParameters were omitted when the run was created and filled from the spec
+	DefaultedParameters []string `json:"defaulted_parameters,omitempty"`
+	// CoercedParameters lists the values converted to the types of the spec
+	CoercedParameters []Coercion `json:"coerced_parameters,omitempty"`
+	// ExpandedDatasets lists the files the glob patterns of the datasets matched
+	ExpandedDatasets map[string]DatasetExpansion `json:"expanded_datasets,omitempty"`
+	// DOIDatasets lists the files of deposits the datasets referenced by DOI
+	DOIDatasets map[string][]DOIFile `json:"doi_datasets,omitempty"`
+	// InlineDatasets lists the files the datasets gave with their content
+	InlineDatasets map[string][]InlineFile `json:"inline_datasets,omitempty"`
+	// Outputs are declared by the spec and verified after the run finished
+	Outputs map[string]outputs.Spec `json:"outputs,omitempty"`
+	// CommandOverride was set by an admin and replaces the entrypoint and cmd of the image
+	CommandOverride *CommandOverride `json:"command_override,omitempty"`
+	// SpecCommand is declared by the spec and used if the image has no gotap
+	SpecCommand []string `json:"spec_command,omitempty"`
+	// Runtime executes the run, docker, apptainer or ssh
+	Runtime string `json:"runtime,omitempty"`
+	// UsePrepare runs gotap prepare before the tool, if the image has gotap
+	UsePrepare bool `json:"use_prepare,omitempty"`
+	// Priority orders the run among the runs waiting for a slot, low, normal or high
+	Priority string `json:"priority,omitempty"`
+	// MaxOutputBytes is the size /out may reach before the run is killed, 0 is unlimited
+	MaxOutputBytes int64 `json:"max_output_bytes,omitempty"`
+	// ParamEnv exports the scalar parameters and the container paths of the datasets
+	// as TOOL_PARAM_<NAME> and TOOL_DATA_<NAME> environment variables
+	ParamEnv bool `json:"param_env,omitempty"`
+}
+
 type Tool struct {
 	ID          int64                  `json:"id"`
 	Name        string                 `json:"name"`
@@ -14,13 +65,50 @@ type Tool struct {
 	Description string                 `json:"description"`
 	Image       string                 `json:"image"`
 	Parameters  map[string]interface{} `json:"parameters,omitempty"`
-	Data        map[string]string      `json:"data,omitempty"`
+	Data        map[string]DatasetRef  `json:"data,omitempty"`
 	Mounts      map[string]string      `json:"mounts,omitempty"`
+	Options     RunOptions             `json:"options"`
 	Status      string                 `json:"status"`
 	CreatedAt   time.Time              `json:"created_at"`
 	StartedAt   time.Time              `json:"started_at,omitempty"`
 	FinishedAt  time.Time              `json:"finished_at,omitempty"`
+	DurationMs  *int64                 `json:"duration_ms,omitempty"`
+	ExitCode    *int64                 `json:"exit_code,omitempty"`
 	Error       string                 `json:"error,omitempty"`
+	ErrorKind   ErrorKind              `json:"error_kind,omitempty"`
+	Attempts    int64                  `json:"attempts"`
+	// ExecutionStrategy is how the container was started, like gotap or spec_entry
+	ExecutionStrategy string `json:"execution_strategy,omitempty"`
+	// ImageDigest is the digest the requested Image resolved to when the run was started
+	ImageDigest string `json:"image_digest,omitempty"`
+	// ProjectID is the project the run belongs to
+	ProjectID *int64 `json:"project_id,omitempty"`
+	// DeletedAt is set while the run is in the trash
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	// Progress is the last progress between 0 and 1 the tool reported in /out/_events.jsonl
+	Progress *float64 `json:"progress,omitempty"`
+	// QueuePosition is the place of a queued run among the runs waiting for a slot
+	QueuePosition *int `json:"queue_position,omitempty"`
+	// StoragePending is set while the results are not uploaded to the object storage yet
+	StoragePending bool `json:"storage_pending,omitempty"`
+
+	// userID is the owner of the run, which files.run_dir_template may place its directory by
+	userID string
+	// runDir is the directory the template resolved to when the run was created
+	runDir string
+}
+
+// GetRun loads a run of the user from the database. A missing run wraps ErrNotFound.
+func GetRun(ctx context.Context, DB *db.Queries, id int64, userID string) (db.Run, error) {
+	run, err := DB.GetRun(ctx, db.GetRunParams{
+		ID:     id,
+		ID_2:   userID,
+		UserID: userID,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return db.Run{}, fmt.Errorf("the run %d was not found: %w", id, ErrNotFound)
+	}
+	return run, err
 }
 
 func FromDBRun(run db.Run) (Tool, error) {
@@ -38,6 +126,33 @@ func FromDBRun(run db.Run) (Tool, error) {
 		StartedAt:   run.StartedAt.Time,
 		FinishedAt:  run.FinishedAt.Time,
 		Error:       run.ErrorMessage.String,
+		ErrorKind:   ErrorKind(run.ErrorKind.String),
+		Attempts:    run.Attempts,
+
+		ExecutionStrategy: run.ExecutionStrategy.String,
+		ImageDigest:       run.ImageDigest.String,
+		StoragePending:    run.StoragePending,
+
+		userID: run.UserID,
+		runDir: run.RunDir.String,
+	}
+	if run.DurationMs.Valid {
+		tool.DurationMs = &run.DurationMs.Int64
+	}
+	if run.ExitCode.Valid {
+		tool.ExitCode = &run.ExitCode.Int64
+	}
+	if run.ProjectID.Valid {
+		tool.ProjectID = &run.ProjectID.Int64
+	}
+	if run.DeletedAt.Valid {
+		tool.DeletedAt = &run.DeletedAt.Time
+	}
+	if run.Progress.Valid {
+		tool.Progress = &run.Progress.Float64
+	}
+	if position, ok := QueuePosition(run.ID); ok {
+		tool.QueuePosition = &position
 	}
 	err := json.Unmarshal([]byte(run.Parameters), &tool.Parameters)
 	if err != nil {
@@ -51,6 +166,10 @@ func FromDBRun(run db.Run) (Tool, error) {
 	if err != nil {
 		return Tool{}, err
 	}
+	err = json.Unmarshal([]byte(run.Options), &tool.Options)
+	if err != nil {
+		return Tool{}, err
+	}
 
 	return tool, nil
 }
@@ -0,0 +1,253 @@
+package tool
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hydrocode-de/gorun/internal/db"
+	"github.com/hydrocode-de/gorun/internal/events"
+)
+
+// ToolEventsFile is appended to by the tool, one JSON object per line, to report
+// messages and its progress while it runs
+const ToolEventsFile = "_events.jsonl"
+
+const (
+	// how often the events file is read while the run executes
+	toolEventsInterval = time.Second
+	// the events recorded per run, later ones only update the progress
+	maxToolEvents = 1000
+	// longer lines are skipped as malformed
+	maxToolEventLine = 64 * 1024
+)
+
+// ToolEvent is a line of the events file
+type ToolEvent struct {
+	Timestamp *time.Time `json:"timestamp,omitempty"`
+	Level     string     `json:"level,omitempty"`
+	Message   string     `json:"message,omitempty"`
+	// Progress is between 0 and 1
+	Progress *float64 `json:"progress,omitempty"`
+	// Result annotates a result file, see ResultAnnotation
+	Result *ResultAnnotation `json:"result,omitempty"`
+}
+
+// ParseToolEvent reads a line of the events file. The level defaults to info.
+func ParseToolEvent(line []byte) (ToolEvent, error) {
+	var event ToolEvent
+	if err := json.Unmarshal(line, &event); err != nil {
+		return ToolEvent{}, err
+	}
+	if event.Message == "" && event.Progress == nil && event.Result == nil {
+		return ToolEvent{}, fmt.Errorf("the event has neither a message, a progress nor a result")
+	}
+	if event.Progress != nil && (*event.Progress < 0 || *event.Progress > 1) {
+		return ToolEvent{}, fmt.Errorf("the progress %v is not between 0 and 1", *event.Progress)
+	}
+	if event.Result != nil {
+		if err := event.Result.check(); err != nil {
+			return ToolEvent{}, err
+		}
+		event.Result.File = normalizeResultPath(event.Result.File)
+	}
+	switch event.Level = strings.ToLower(event.Level); event.Level {
+	case "":
+		event.Level = "info"
+	case "debug", "info", "warning", "error":
+	default:
+		return ToolEvent{}, fmt.Errorf("unknown level %q, use debug, info, warning or error", event.Level)
+	}
+	return event, nil
+}
+
+func (e ToolEvent) String() string {
+	parts := []string{fmt.Sprintf("[%s]", e.Level)}
+	if e.Message != "" {
+		parts = append(parts, e.Message)
+	}
+	if e.Progress != nil {
+		parts = append(parts, fmt.Sprintf("(%.0f%%)", *e.Progress*100))
+	}
+	if e.Result != nil {
+		parts = append(parts, e.Result.String())
+	}
+	return strings.Join(parts, " ")
+}
+
+// toolEventTailer reads the lines appended to the events file of a run and records them
+// as run events, the last progress is kept on the run
+type toolEventTailer struct {
+	DB    *db.Queries
+	runID int64
+	path  string
+
+	offset   int64
+	lineNo   int
+	recorded int
+	partial  []byte
+	// skipping is set while the rest of an overly long line is discarded
+	skipping bool
+
+	cancel   context.CancelFunc
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// startToolEvents follows the events file in the /out folder of the run. It returns nil
+// without an /out folder, Stop may be called on the nil tailer anyway.
+func startToolEvents(ctx context.Context, DB *db.Queries, runID int64, outDir string) *toolEventTailer {
+	if outDir == "" {
+		return nil
+	}
+	// the tailer is stopped by the run, not by the context of a single request
+	tailCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	t := &toolEventTailer{
+		DB:     DB,
+		runID:  runID,
+		path:   path.Join(outDir, ToolEventsFile),
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	go t.loop(tailCtx)
+	return t
+}
+
+func (t *toolEventTailer) loop(ctx context.Context) {
+	defer close(t.done)
+
+	ticker := time.NewTicker(toolEventsInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			t.read(ctx, false)
+		}
+	}
+}
+
+// Stop reads the lines written until the tool exited, including a last one without newline
+func (t *toolEventTailer) Stop() {
+	if t == nil {
+		return
+	}
+	t.stopOnce.Do(func() {
+		t.cancel()
+		<-t.done
+		t.read(context.Background(), true)
+	})
+}
+
+func (t *toolEventTailer) read(ctx context.Context, final bool) {
+	file, err := os.Open(t.path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("could not read the events of run %d: %v", t.runID, err)
+		}
+		return
+	}
+	defer file.Close()
+	if _, err := file.Seek(t.offset, io.SeekStart); err != nil {
+		log.Printf("could not read the events of run %d: %v", t.runID, err)
+		return
+	}
+	chunk, err := io.ReadAll(io.LimitReader(file, 4*maxToolEventLine))
+	if err != nil {
+		log.Printf("could not read the events of run %d: %v", t.runID, err)
+		return
+	}
+	t.offset += int64(len(chunk))
+
+	var progress *float64
+	data := append(t.partial, chunk...)
+	for {
+		newline := bytes.IndexByte(data, '\n')
+		if newline < 0 {
+			break
+		}
+		if t.skipping {
+			t.skipping = false
+		} else if p := t.handle(ctx, data[:newline]); p != nil {
+			progress = p
+		}
+		data = data[newline+1:]
+	}
+	t.partial = append([]byte(nil), data...)
+	switch {
+	case t.skipping:
+		t.partial = nil
+	case len(t.partial) > maxToolEventLine:
+		t.handle(ctx, t.partial)
+		t.partial, t.skipping = nil, true
+	case final && len(t.partial) > 0:
+		if p := t.handle(ctx, t.partial); p != nil {
+			progress = p
+		}
+		t.partial = nil
+	}
+	if progress != nil {
+		t.setProgress(ctx, *progress)
+	}
+	// the rest of a large file is read right away
+	if final && len(chunk) == 4*maxToolEventLine {
+		t.read(ctx, final)
+	}
+}
+
+// handle records a line and returns the progress it reported
+func (t *toolEventTailer) handle(ctx context.Context, line []byte) *float64 {
+	t.lineNo++
+	line = bytes.TrimSpace(line)
+	if len(line) == 0 {
+		return nil
+	}
+	if t.recorded >= maxToolEvents {
+		if event, err := ParseToolEvent(line); err == nil {
+			return event.Progress
+		}
+		return nil
+	}
+
+	t.recorded++
+	if len(line) > maxToolEventLine {
+		RecordRunEvent(ctx, t.DB, t.runID, EventToolEventMalformed, fmt.Sprintf("line %d of %s is longer than %d bytes and was skipped", t.lineNo, ToolEventsFile, maxToolEventLine))
+		return nil
+	}
+	event, err := ParseToolEvent(line)
+	if err != nil {
+		RecordRunEvent(ctx, t.DB, t.runID, EventToolEventMalformed, fmt.Sprintf("line %d of %s was skipped: %v", t.lineNo, ToolEventsFile, err))
+		return nil
+	}
+	if event.Result != nil {
+		if err := recordToolAnnotation(ctx, t.DB, t.runID, *event.Result); err != nil {
+			log.Printf("failed to persist the annotation of a result of run %d: %v", t.runID, err)
+		}
+	}
+	RecordRunEvent(ctx, t.DB, t.runID, EventToolEvent, event.String())
+	if t.recorded == maxToolEvents {
+		RecordRunEvent(ctx, t.DB, t.runID, EventLogTruncated, fmt.Sprintf("the run reported %d events, later ones only update the progress", maxToolEvents))
+	}
+	return event.Progress
+}
+
+func (t *toolEventTailer) setProgress(ctx context.Context, progress float64) {
+	err := t.DB.SetRunProgress(ctx, db.SetRunProgressParams{
+		Progress: sql.NullFloat64{Float64: progress, Valid: true},
+		ID:       t.runID,
+	})
+	if err != nil {
+		log.Printf("failed to persist the progress of run %d: %v", t.runID, err)
+	}
+	events.Publish(events.RunChannel(t.runID, events.TopicStatus), "progress", map[string]float64{"progress": progress})
+}
@@ -0,0 +1,172 @@
+package tool
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hydrocode-de/gorun/internal/db"
+)
+
+// the rollup of the tool usage is recomputed from the runs once a day
+const toolUsageInterval = 24 * time.Hour
+
+// the window of the recent runs of a tool
+const toolUsageRecentDays = 30
+
+var (
+	toolUsageMu        sync.Mutex
+	toolUsageRefreshed time.Time
+)
+
+// ToolUsage tells how much a tool is used. The users are only counted, never named.
+type ToolUsage struct {
+	Tool       string `json:"tool"`
+	TotalRuns  int64  `json:"total_runs"`
+	RecentRuns int64  `json:"runs_last_30_days"`
+	// SuccessRate is the share of finished runs among the finished and errored ones
+	SuccessRate      *float64  `json:"success_rate,omitempty"`
+	MedianDurationMs *int64    `json:"median_duration_ms,omitempty"`
+	DistinctUsers    int64     `json:"distinct_users"`
+	ComputedAt       time.Time `json:"computed_at"`
+}
+
+func toolUsageFromDB(row db.ToolUsage) ToolUsage {
+	usage := ToolUsage{
+		Tool:          row.Tool,
+		TotalRuns:     row.TotalRuns,
+		RecentRuns:    row.RecentRuns,
+		DistinctUsers: row.DistinctUsers,
+		ComputedAt:    row.ComputedAt,
+	}
+	if completed := row.FinishedRuns + row.ErroredRuns; completed > 0 {
+		rate := float64(row.FinishedRuns) / float64(completed)
+		usage.SuccessRate = &rate
+	}
+	if row.MedianDurationMs.Valid {
+		usage.MedianDurationMs = &row.MedianDurationMs.Int64
+	}
+	return usage
+}
+
+// GetToolUsage returns the usage of the tool <image>::<name> from the daily rollup.
+// A tool without runs has a zero usage.
+func GetToolUsage(ctx context.Context, DB *db.Queries, slug string) (ToolUsage, error) {
+	computedAt, err := ensureToolUsage(ctx, DB)
+	if err != nil {
+		return ToolUsage{}, err
+	}
+	row, err := DB.GetToolUsage(ctx, slug)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ToolUsage{Tool: slug, ComputedAt: computedAt}, nil
+	}
+	if err != nil {
+		return ToolUsage{}, err
+	}
+	return toolUsageFromDB(row), nil
+}
+
+// ListToolUsage ranks the tools by their recent and total runs
+func ListToolUsage(ctx context.Context, DB *db.Queries) ([]ToolUsage, error) {
+	if _, err := ensureToolUsage(ctx, DB); err != nil {
+		return nil, err
+	}
+	rows, err := DB.ListToolUsage(ctx)
+	if err != nil {
+		return nil, err
+	}
+	usage := make([]ToolUsage, 0, len(rows))
+	for _, row := range rows {
+		usage = append(usage, toolUsageFromDB(row))
+	}
+	return usage, nil
+}
+
+// ensureToolUsage recomputes the rollup if it is older than a day, also after a restart
+func ensureToolUsage(ctx context.Context, DB *db.Queries) (time.Time, error) {
+	toolUsageMu.Lock()
+	defer toolUsageMu.Unlock()
+	if toolUsageRefreshed.IsZero() {
+		if computedAt, err := DB.GetToolUsageComputedAt(ctx); err == nil {
+			toolUsageRefreshed = computedAt
+		}
+	}
+	if time.Since(toolUsageRefreshed) < toolUsageInterval {
+		return toolUsageRefreshed, nil
+	}
+	return toolUsageRefreshed, refreshToolUsage(ctx, DB)
+}
+
+// RefreshToolUsage recomputes the rollup of the tool usage right away
+func RefreshToolUsage(ctx context.Context, DB *db.Queries) error {
+	toolUsageMu.Lock()
+	defer toolUsageMu.Unlock()
+	return refreshToolUsage(ctx, DB)
+}
+
+// refreshToolUsage aggregates all runs per tool, toolUsageMu has to be held
+func refreshToolUsage(ctx context.Context, DB *db.Queries) error {
+	runs, err := DB.GetToolUsageRuns(ctx)
+	if err != nil {
+		return err
+	}
+	// the timestamps are compared as stored, so they are kept in whole seconds of UTC
+	now := time.Now().UTC().Truncate(time.Second)
+	recentSince := now.AddDate(0, 0, -toolUsageRecentDays)
+
+	type aggregate struct {
+		params    db.SetToolUsageParams
+		users     map[string]bool
+		durations []int64
+	}
+	tools := make(map[string]*aggregate)
+	for _, run := range runs {
+		agg, ok := tools[run.Tool]
+		if !ok {
+			agg = &aggregate{params: db.SetToolUsageParams{Tool: run.Tool, ComputedAt: now}, users: make(map[string]bool)}
+			tools[run.Tool] = agg
+		}
+		agg.params.TotalRuns++
+		if run.CreatedAt.After(recentSince) {
+			agg.params.RecentRuns++
+		}
+		switch RunStatus(run.Status) {
+		case StatusFinished:
+			agg.params.FinishedRuns++
+			if run.DurationMs.Valid {
+				agg.durations = append(agg.durations, run.DurationMs.Int64)
+			}
+		case StatusErrored:
+			agg.params.ErroredRuns++
+		}
+		agg.users[run.UserID] = true
+	}
+
+	for _, agg := range tools {
+		agg.params.DistinctUsers = int64(len(agg.users))
+		if len(agg.durations) > 0 {
+			agg.params.MedianDurationMs = sql.NullInt64{Int64: median(agg.durations), Valid: true}
+		}
+		if err := DB.SetToolUsage(ctx, agg.params); err != nil {
+			return err
+		}
+	}
+	// tools whose runs were all deleted are dropped from the rollup
+	if err := DB.DeleteStaleToolUsage(ctx, now); err != nil {
+		return err
+	}
+	toolUsageRefreshed = now
+	return nil
+}
+
+func median(values []int64) int64 {
+	sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+	middle := len(values) / 2
+	if len(values)%2 == 0 {
+		return (values[middle-1] + values[middle]) / 2
+	}
+	return values[middle]
+}
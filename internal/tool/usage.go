@@ -0,0 +1,124 @@
+package tool
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/hydrocode-de/gorun/internal/db"
+)
+
+// UsageGroup is the resource usage of all runs of one user, tool or project within a report window
+type UsageGroup struct {
+	Group             string  `json:"group"`
+	Runs              int64   `json:"runs"`
+	DurationSeconds   float64 `json:"duration_seconds"`
+	CPUSeconds        float64 `json:"cpu_seconds"`
+	PeakMemoryGBHours float64 `json:"peak_memory_gb_hours"`
+}
+
+// UsageReport aggregates the runs started in [from, to) per user, tool or project.
+// Projects are keyed by <id>::<name>, as the names are unique per owner only.
+// If userID is not empty, only the runs of this user are included.
+func UsageReport(ctx context.Context, DB *db.Queries, from time.Time, to time.Time, groupBy string, userID string) ([]UsageGroup, error) {
+	// the timestamps of the runs are stored in UTC by sqlite
+	start, end := from.UTC().Format(time.DateTime), to.UTC().Format(time.DateTime)
+
+	groups := make([]UsageGroup, 0)
+	switch groupBy {
+	case "user":
+		rows, err := DB.GetUsageByUser(ctx, db.GetUsageByUserParams{WindowStart: start, WindowEnd: end, UserID: userID})
+		if err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			groups = append(groups, usageGroup(row.GroupKey, row.Runs, row.DurationMs, row.CpuSeconds, row.PeakMemoryGbHours))
+		}
+	case "tool":
+		rows, err := DB.GetUsageByTool(ctx, db.GetUsageByToolParams{WindowStart: start, WindowEnd: end, UserID: userID})
+		if err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			groups = append(groups, usageGroup(row.GroupKey, row.Runs, row.DurationMs, row.CpuSeconds, row.PeakMemoryGbHours))
+		}
+	case "project":
+		rows, err := DB.GetUsageByProject(ctx, db.GetUsageByProjectParams{WindowStart: start, WindowEnd: end, UserID: userID})
+		if err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			groups = append(groups, usageGroup(row.GroupKey, row.Runs, row.DurationMs, row.CpuSeconds, row.PeakMemoryGbHours))
+		}
+	default:
+		return nil, fmt.Errorf("invalid group_by %s. Use 'user', 'tool' or 'project'", groupBy)
+	}
+	return groups, nil
+}
+
+func usageGroup(key string, runs int64, durationMs int64, cpuSeconds float64, peakMemoryGBHours float64) UsageGroup {
+	return UsageGroup{
+		Group:             key,
+		Runs:              runs,
+		DurationSeconds:   float64(durationMs) / 1000,
+		CPUSeconds:        cpuSeconds,
+		PeakMemoryGBHours: peakMemoryGBHours,
+	}
+}
+
+// WriteUsageCSV writes the report with a header line
+func WriteUsageCSV(w io.Writer, groups []UsageGroup) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write([]string{"group", "runs", "duration_seconds", "cpu_seconds", "peak_memory_gb_hours"}); err != nil {
+		return err
+	}
+	for _, group := range groups {
+		err := writer.Write([]string{
+			group.Group,
+			strconv.FormatInt(group.Runs, 10),
+			strconv.FormatFloat(group.DurationSeconds, 'f', 3, 64),
+			strconv.FormatFloat(group.CPUSeconds, 'f', 3, 64),
+			strconv.FormatFloat(group.PeakMemoryGBHours, 'f', 6, 64),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// ParseUsageWindow reads the bounds of a report as RFC 3339 timestamps or dates.
+// Without bounds, the report covers the last 30 days.
+func ParseUsageWindow(from string, to string) (time.Time, time.Time, error) {
+	end := time.Now().UTC()
+	if to != "" {
+		parsed, err := parseReportTime(to)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid to %s: %v", to, err)
+		}
+		end = parsed
+	}
+	start := end.AddDate(0, 0, -30)
+	if from != "" {
+		parsed, err := parseReportTime(from)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid from %s: %v", from, err)
+		}
+		start = parsed
+	}
+	if !start.Before(end) {
+		return time.Time{}, time.Time{}, fmt.Errorf("the report window from %s to %s is empty", start.Format(time.RFC3339), end.Format(time.RFC3339))
+	}
+	return start, end, nil
+}
+
+func parseReportTime(value string) (time.Time, error) {
+	if date, err := time.Parse(time.DateOnly, value); err == nil {
+		return date, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
@@ -0,0 +1,138 @@
+package tool
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+)
+
+// addUsageRow backdates a finished run of the user and records its stats, unless the
+// peak memory is negative
+func addUsageRow(t *testing.T, conn *sql.DB, runID int64, userID string, name string, startedAt string, durationMs int64, cpuPercent float64, peakMemoryBytes int64) {
+	t.Helper()
+	if _, err := conn.Exec("UPDATE runs SET user_id = ?, name = ?, status = 'finished', started_at = ?, duration_ms = ? WHERE id = ?", userID, name, startedAt, durationMs, runID); err != nil {
+		t.Fatal(err)
+	}
+	if peakMemoryBytes < 0 {
+		return
+	}
+	if _, err := conn.Exec("INSERT INTO run_stats (run_id, samples, peak_memory_bytes, avg_cpu_percent, finalized) VALUES (?, 1, ?, ?, TRUE)", runID, peakMemoryBytes, cpuPercent); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// the window includes the runs started at its start and excludes those started at its end
+func TestUsageReportWindow(t *testing.T) {
+	setTestConfig(t)
+	conn, DB := newTestDBConn(t)
+	ctx := context.Background()
+	const gib = 1 << 30
+	rows := []struct {
+		user       string
+		name       string
+		startedAt  string
+		durationMs int64
+		cpuPercent float64
+		peakMemory int64
+	}{
+		{testUser, testTool, "2026-01-01 00:00:00", 3600000, 50, gib},
+		{testUser, testTool, "2026-01-31 23:59:59", 1000, 0, -1},
+		{testUser, testTool, "2026-02-01 00:00:00", 3600000, 100, gib},
+		{testUser, testTool, "2025-12-31 23:59:59", 3600000, 100, gib},
+		{testAdmin, "other", "2026-01-15 12:00:00", 7200000, 200, 2 * gib},
+	}
+	for _, row := range rows {
+		addUsageRow(t, conn, createTestRunRecord(t, DB), row.user, row.name, row.startedAt, row.durationMs, row.cpuPercent, row.peakMemory)
+	}
+	// a run which never started is not in any window
+	createTestRunRecord(t, DB)
+
+	from := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		from    time.Time
+		groupBy string
+		userID  string
+		want    []UsageGroup
+	}{
+		{
+			name: "by user", from: from, groupBy: "user",
+			want: []UsageGroup{
+				{Group: testAdmin, Runs: 1, DurationSeconds: 7200, CPUSeconds: 14400, PeakMemoryGBHours: 4},
+				{Group: testUser, Runs: 2, DurationSeconds: 3601, CPUSeconds: 1800, PeakMemoryGBHours: 1},
+			},
+		},
+		{
+			name: "by tool", from: from, groupBy: "tool",
+			want: []UsageGroup{
+				{Group: testImage + "::" + testTool, Runs: 2, DurationSeconds: 3601, CPUSeconds: 1800, PeakMemoryGBHours: 1},
+				{Group: testImage + "::other", Runs: 1, DurationSeconds: 7200, CPUSeconds: 14400, PeakMemoryGBHours: 4},
+			},
+		},
+		{
+			name: "of one user", from: from, groupBy: "tool", userID: testUser,
+			want: []UsageGroup{
+				{Group: testImage + "::" + testTool, Runs: 2, DurationSeconds: 3601, CPUSeconds: 1800, PeakMemoryGBHours: 1},
+			},
+		},
+		{
+			// the bounds are compared in UTC, whatever their zone
+			name: "bounds in another zone", from: from.In(time.FixedZone("CET", 3600)), groupBy: "user", userID: testUser,
+			want: []UsageGroup{
+				{Group: testUser, Runs: 2, DurationSeconds: 3601, CPUSeconds: 1800, PeakMemoryGBHours: 1},
+			},
+		},
+		{
+			name: "one second later", from: from.Add(time.Second), groupBy: "user", userID: testUser,
+			want: []UsageGroup{
+				{Group: testUser, Runs: 1, DurationSeconds: 1},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := UsageReport(ctx, DB, tt.from, to, tt.groupBy, tt.userID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("the report has the groups %+v, want %+v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("group %d is %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+
+	if _, err := UsageReport(ctx, DB, from, to, "image", ""); err == nil {
+		t.Errorf("an unknown group_by was accepted")
+	}
+}
+
+func TestParseUsageWindow(t *testing.T) {
+	from, to, err := ParseUsageWindow("2026-01-01", "2026-02-01T12:00:00+02:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !from.Equal(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)) || !to.Equal(time.Date(2026, 2, 1, 10, 0, 0, 0, time.UTC)) {
+		t.Errorf("the window is %s to %s", from, to)
+	}
+
+	from, to, err = ParseUsageWindow("", "2026-02-01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if to.Sub(from) != 30*24*time.Hour {
+		t.Errorf("the default window is %s to %s, want the 30 days before the end", from, to)
+	}
+
+	for _, bounds := range [][2]string{{"2026-02-01", "2026-02-01"}, {"2026-03-01", "2026-02-01"}, {"yesterday", ""}, {"", "01.02.2026"}} {
+		if _, _, err := ParseUsageWindow(bounds[0], bounds[1]); err == nil {
+			t.Errorf("the window from %q to %q was accepted", bounds[0], bounds[1])
+		}
+	}
+}
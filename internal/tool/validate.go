@@ -0,0 +1,487 @@
+package tool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hydrocode-de/gorun/internal/cache"
+	"github.com/hydrocode-de/gorun/internal/db"
+	"github.com/hydrocode-de/gorun/internal/doi"
+	"github.com/hydrocode-de/gorun/internal/specversion"
+	"github.com/hydrocode-de/gorun/internal/toolImage"
+	toolspec "github.com/hydrocode-de/tool-spec-go"
+	"github.com/hydrocode-de/tool-spec-go/validate"
+	"github.com/spf13/viper"
+)
+
+const (
+	DataNotFound    validate.ErrorType = "not-found"
+	DataNotReadable validate.ErrorType = "not-readable"
+)
+
+// ValidateAndCreateRun checks the payload against the cached tool spec and the
+// host file system before the run is created. Every call counts against the rate limit
+// of the user, even if the payload turns out to be invalid.
+func ValidateAndCreateRun(ctx context.Context, DB *db.Queries, Cache *cache.Cache, opts CreateRunOptions, userID string) (db.Run, error) {
+	if err := takeRunToken(ctx, DB, userID); err != nil {
+		return db.Run{}, err
+	}
+	// a tag rebuilt since the spec was cached is validated against the spec of the new image
+	var refreshed string
+	if runtime, err := ResolveRuntime(opts.Runtime); err == nil {
+		if refreshed, err = refreshStaleSpec(ctx, Cache, runtime, opts.Image); err != nil {
+			return db.Run{}, err
+		}
+	}
+	if _, err := validateRun(ctx, DB, Cache, &opts, userID, true); err != nil {
+		return db.Run{}, err
+	}
+	if err := pullIfMissing(ctx, Cache, opts); err != nil {
+		return db.Run{}, err
+	}
+
+	runData, err := CreateToolRun(ctx, DB, opts, userID)
+	if err == nil && refreshed != "" {
+		RecordRunEvent(ctx, DB, runData.ID, EventSpecRefreshed, refreshed)
+	}
+	return runData, err
+}
+
+// pullIfMissing pulls the image of a tool only known from a registry or the catalog,
+// unless images.pull_missing is disabled. Apptainer converts the image on its own.
+func pullIfMissing(ctx context.Context, Cache *cache.Cache, opts CreateRunOptions) error {
+	origin, ok := Cache.GetOrigin(opts.Image)
+	if !ok || origin.Available {
+		return nil
+	}
+	runtime, err := ResolveRuntime(opts.Runtime)
+	if err != nil || runtime == RuntimeApptainer {
+		return err
+	}
+	if !viper.GetBool("images.pull_missing") {
+		return fmt.Errorf("the image %s is only known from the %s and images.pull_missing is disabled", opts.Image, origin.Source)
+	}
+	c, err := RuntimeClient(runtime)
+	if err != nil {
+		return err
+	}
+	if _, err := toolImage.PullIfMissing(ctx, c, opts.Image, opts.Platform); err != nil {
+		return fmt.Errorf("could not pull the image %s: %w", opts.Image, err)
+	}
+	if runtime == RuntimeDocker {
+		origin.Available = true
+		Cache.SetImageOrigin(opts.Image, origin)
+	}
+	return nil
+}
+
+// validateRun checks the payload of a new run and sets the platform of emulated images.
+// Images which are not cached are only read from the daemon if loadOnDemand is set.
+func validateRun(ctx context.Context, DB *db.Queries, Cache *cache.Cache, opts *CreateRunOptions, userID string, loadOnDemand bool) (*toolspec.ToolSpec, error) {
+	policy, err := toolImage.LoadPolicy(ctx, DB)
+	if err != nil {
+		return nil, err
+	}
+	if err := policy.Check(ctx, opts.Image); err != nil {
+		return nil, err
+	}
+	if err := toolImage.CheckScan(ctx, DB, Cache, opts.Image); err != nil {
+		return nil, err
+	}
+
+	toolSlug := fmt.Sprintf("%s::%s", opts.Image, opts.Name)
+	runtime, runtimeErr := ResolveRuntime(opts.Runtime)
+	toolSpec, err := lookupToolSpec(ctx, Cache, runtime, opts.Image, opts.Name, loadOnDemand)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.Hardening != nil {
+		user, err := DB.GetUserByID(ctx, userID)
+		if err != nil || !user.IsAdmin {
+			return nil, fmt.Errorf("only admins may override the container hardening: %w", ErrForbidden)
+		}
+	}
+	if err := checkCommandOverride(ctx, DB, opts.CommandOverride, userID); err != nil {
+		return nil, err
+	}
+	if err := checkPriority(ctx, DB, opts.Priority, userID); err != nil {
+		return nil, err
+	}
+	if err := checkRuntime(ctx, DB, opts.Runtime, userID); err != nil {
+		return nil, err
+	}
+	if err := checkProject(ctx, DB, opts.ProjectID, userID); err != nil {
+		return nil, err
+	}
+
+	if viper.GetBool("validation.coerce_types") {
+		opts.Parameters, opts.CoercedParameters = coerceParameters(*toolSpec, opts.Parameters)
+	}
+	parameters, defaulted, err := fillDefaults(*toolSpec, opts.Parameters)
+	if err != nil {
+		return nil, err
+	}
+	opts.Parameters, opts.DefaultedParameters = parameters, defaulted
+
+	if declared, ok := Cache.GetOutputs(toolSlug); ok {
+		opts.Outputs = declared
+	}
+	if command, ok := Cache.GetCommand(toolSlug); ok {
+		opts.SpecCommand = command
+	}
+	if opts.ParamEnv == nil && Cache.GetParamEnv(toolSlug) {
+		declared := true
+		opts.ParamEnv = &declared
+	}
+
+	// the checks which need no dataset come first, so that an invalid payload neither
+	// decodes its inline files nor fetches its deposits nor expands its patterns
+	_, errs := splitDataErrors(validateInputs(*toolSpec, opts.Parameters, nil))
+	if opts.ParamEnv != nil && *opts.ParamEnv {
+		errs = append(errs, checkParamEnv(opts.Parameters)...)
+	}
+	if err := validateCommandOverride(opts.CommandOverride); err != nil {
+		errs = append(errs, err)
+	}
+	if compat, ok := Cache.GetCompatibility(toolSlug); ok && !compat.IsSupported() {
+		errs = append(errs, &validate.ValidationError{
+			Field:    "spec",
+			Name:     "version",
+			Type:     validate.NotAllowed,
+			Expected: fmt.Sprintf("a tool-spec version from %s to %s", specversion.MinSupported, specversion.LatestSupported),
+			Actual:   compat.Version,
+			Message:  fmt.Sprintf("the tool-spec of %s is not supported: %s", toolSlug, strings.Join(compat.Reasons, "; ")),
+		})
+	}
+	if imagePlatform, ok := Cache.GetPlatform(toolSlug); ok {
+		daemonPlatform, err := toolImage.ReadDaemonPlatform(ctx)
+		if err == nil && !toolImage.PlatformMatches(imagePlatform, daemonPlatform) {
+			if viper.GetBool("run.allow_emulation") {
+				opts.Platform = imagePlatform
+			} else {
+				errs = append(errs, &validate.ValidationError{
+					Field:    "docker_image",
+					Name:     "platform",
+					Type:     validate.NotAllowed,
+					Expected: daemonPlatform,
+					Actual:   imagePlatform,
+					Message:  fmt.Sprintf("the image %s is built for %s, but the host runs %s. Enable run.allow_emulation to run it emulated", opts.Image, imagePlatform, daemonPlatform),
+				})
+			}
+		}
+	}
+	if runtimeErr != nil {
+		errs = append(errs, runtimeError(opts.Runtime, runtimeErr))
+	}
+	errs = append(errs, validateRuntime(opts, runtime)...)
+	dataMode, err := ResolveDataMode(opts.DataMode)
+	if err != nil {
+		errs = append(errs, dataModeError(opts.DataMode, err))
+	}
+	if err := scratchGBError(opts.ScratchGB); err != nil {
+		errs = append(errs, err)
+	}
+	if err := maxRetriesError(opts.MaxRetries); err != nil {
+		errs = append(errs, err)
+	}
+	if err := maxOutputBytesError(opts.MaxOutputBytes); err != nil {
+		errs = append(errs, err)
+	}
+	if _, err := ParsePriority(opts.Priority); err != nil {
+		errs = append(errs, priorityError(opts.Priority, err))
+	}
+	if len(errs) > 0 {
+		return nil, payloadError(*toolSpec, toolSlug, opts, errs)
+	}
+
+	datasets, inlineFiles, inlineErrs := stageInlineDatasets(opts.Datasets)
+	opts.Datasets, opts.InlineDatasets = datasets, inlineFiles
+	datasets, doiFiles, fetchErrs := fetchDOIDatasets(ctx, opts.Datasets)
+	opts.Datasets, opts.DOIDatasets = datasets, doiFiles
+	datasets, expansions, expandErrs := expandDatasets(opts.Datasets)
+	opts.Datasets, opts.ExpandedDatasets = datasets, expansions
+
+	errs, _ = splitDataErrors(validateInputs(*toolSpec, opts.Parameters, opts.Datasets))
+	errs = append(errs, inlineErrs...)
+	errs = append(errs, fetchErrs...)
+	errs = append(errs, expandErrs...)
+	errs = append(errs, validateDatasetPaths(ctx, DB, *toolSpec, opts.Datasets, dataMode, userID)...)
+	if len(errs) > 0 {
+		return nil, payloadError(*toolSpec, toolSlug, opts, errs)
+	}
+	return toolSpec, nil
+}
+
+func payloadError(spec toolspec.ToolSpec, toolSlug string, opts *CreateRunOptions, errs []error) error {
+	return &ValidationError{
+		Message: fmt.Sprintf("the provided payload is invalid for the tool %s", toolSlug),
+		Errors:  enrichErrors(spec, opts.Parameters, opts.Datasets, errs),
+	}
+}
+
+// splitDataErrors separates the errors of the datasets from the others
+func splitDataErrors(errs []error) ([]error, []error) {
+	dataErrs, others := make([]error, 0), make([]error, 0)
+	for _, err := range errs {
+		var validationErr *validate.ValidationError
+		if errors.As(err, &validationErr) && validationErr.Field == validate.Data {
+			dataErrs = append(dataErrs, err)
+		} else {
+			others = append(others, err)
+		}
+	}
+	return dataErrs, others
+}
+
+func runtimeError(requested string, err error) error {
+	return &validate.ValidationError{
+		Field:    "runtime",
+		Name:     "runtime",
+		Type:     validate.NotAllowed,
+		Expected: "one of [docker apptainer ssh]",
+		Actual:   requested,
+		Message:  err.Error(),
+	}
+}
+
+func dataModeError(requested string, err error) error {
+	return &validate.ValidationError{
+		Field:    "data_mode",
+		Name:     "data_mode",
+		Type:     validate.NotAllowed,
+		Expected: "one of [copy mount]",
+		Actual:   requested,
+		Message:  err.Error(),
+	}
+}
+
+func priorityError(requested string, err error) error {
+	return &validate.ValidationError{
+		Field:    "priority",
+		Name:     "priority",
+		Type:     validate.NotAllowed,
+		Expected: "one of [low normal high]",
+		Actual:   requested,
+		Message:  err.Error(),
+	}
+}
+
+// scratchGBError checks the scratch space against max_scratch_gb, nil if it is allowed
+func scratchGBError(scratchGB int) error {
+	maxScratch := viper.GetInt("max_scratch_gb")
+	if scratchGB >= 0 && (maxScratch <= 0 || scratchGB <= maxScratch) {
+		return nil
+	}
+	return &validate.ValidationError{
+		Field:    "scratch_gb",
+		Name:     "scratch_gb",
+		Type:     validate.OutOfRange,
+		Expected: fmt.Sprintf("0 to %d", maxScratch),
+		Actual:   fmt.Sprint(scratchGB),
+		Message:  fmt.Sprintf("the requested scratch space of %dGB is not within the allowed range of 0 to %dGB", scratchGB, maxScratch),
+	}
+}
+
+// maxRetriesError checks the retries against run.max_retries, nil if they are allowed
+func maxRetriesError(retries int) error {
+	maxRetries := viper.GetInt("run.max_retries")
+	if retries >= 0 && retries <= maxRetries {
+		return nil
+	}
+	return &validate.ValidationError{
+		Field:    "max_retries",
+		Name:     "max_retries",
+		Type:     validate.OutOfRange,
+		Expected: fmt.Sprintf("0 to %d", maxRetries),
+		Actual:   fmt.Sprint(retries),
+		Message:  fmt.Sprintf("max_retries has to be within 0 and %d", maxRetries),
+	}
+}
+
+// maxOutputBytesError checks the output limit of a run against run.max_output_bytes,
+// nil if the run may lower it to this size
+func maxOutputBytesError(maxOutputBytes int64) error {
+	maxOutput := viper.GetInt64("run.max_output_bytes")
+	if maxOutputBytes >= 0 && (maxOutput <= 0 || maxOutputBytes <= maxOutput) {
+		return nil
+	}
+	return &validate.ValidationError{
+		Field:    "max_output_bytes",
+		Name:     "max_output_bytes",
+		Type:     validate.OutOfRange,
+		Expected: fmt.Sprintf("0 to %d", maxOutput),
+		Actual:   fmt.Sprint(maxOutputBytes),
+		Message:  fmt.Sprintf("max_output_bytes has to be within 0 and %d", maxOutput),
+	}
+}
+
+// validateInputs runs the validation of tool-spec-go, which knows single files only.
+// The further files of a list are checked for the extensions of the dataset one by one.
+func validateInputs(spec toolspec.ToolSpec, parameters map[string]interface{}, datasets map[string]DatasetRef) []error {
+	firstFiles := make(map[string]string, len(datasets))
+	for name, ref := range datasets {
+		if len(ref.Paths) > 0 {
+			firstFiles[name] = ref.Paths[0]
+		}
+	}
+	_, errs := validate.ValidateInputs(spec, toolspec.ToolInput{
+		Parameters: parameters,
+		Datasets:   firstFiles,
+	})
+
+	for name, ref := range datasets {
+		dataSpec, ok := spec.Data[name]
+		if !ok || len(ref.Paths) < 2 {
+			continue
+		}
+		single := toolspec.ToolSpec{Data: map[string]toolspec.DataSpec{name: dataSpec}}
+		for _, dataPath := range ref.Paths[1:] {
+			_, fileErrs := validate.ValidateData(single, map[string]string{name: dataPath})
+			errs = append(errs, fileErrs...)
+		}
+	}
+	return errs
+}
+
+func validateDatasetPaths(ctx context.Context, DB *db.Queries, spec toolspec.ToolSpec, datasets map[string]DatasetRef, dataMode string, userID string) []error {
+	errs := make([]error, 0)
+	var ownDirs []string
+	maxCopySize := viper.GetInt64("max_upload_size")
+
+	mountPath := resolvePath(viper.GetString("mount_path"))
+	for name, ref := range datasets {
+		dataErr := func(errType validate.ErrorType, expected string, actual string, message string) {
+			errs = append(errs, &validate.ValidationError{
+				Field:    validate.Data,
+				Name:     name,
+				Type:     errType,
+				Expected: expected,
+				Actual:   actual,
+				Message:  message,
+			})
+		}
+		if !ref.List && len(ref.Paths) == 1 && isGlobPattern(ref.Paths[0]) {
+			// the pattern did not expand, which expandDatasets reported already
+			continue
+		}
+		if len(ref.Paths) == 0 {
+			dataErr(validate.Required, "at least one file", "[]", fmt.Sprintf("the data %s is an empty list", name))
+			continue
+		}
+
+		// the files of a list are staged into one directory and need distinct names
+		fileNames := make(map[string]string, len(ref.Paths))
+		for _, dataPath := range ref.Paths {
+			if doi.IsReference(dataPath) || strings.HasPrefix(dataPath, inlinePrefix) {
+				// the file was not fetched or written, which was reported already
+				continue
+			}
+			if other, ok := fileNames[ref.stagedName(dataPath)]; ok && ref.List {
+				dataErr(validate.NotAllowed, "distinct file names", dataPath, fmt.Sprintf("the files %s and %s of data %s have the same name", other, dataPath, name))
+				continue
+			}
+			fileNames[ref.stagedName(dataPath)] = dataPath
+
+			absPath, err := filepath.Abs(dataPath)
+			if err != nil {
+				dataErr(DataNotFound, "an existing file", dataPath, fmt.Sprintf("the path %s of data %s is invalid: %v", dataPath, name, err))
+				continue
+			}
+
+			// files in the mount directory may only be used by the owner of the run that created
+			// them. The path is compared after resolving its symlinks, and the mount directory
+			// itself or one of its parents holds the runs of all users.
+			realPath := resolvePath(absPath)
+			if isWithin(realPath, mountPath) || isWithin(mountPath, realPath) {
+				if ownDirs == nil {
+					ownDirs = userRunDirs(ctx, DB, userID)
+				}
+				owned := false
+				for _, dir := range ownDirs {
+					if isWithin(realPath, dir) {
+						owned = true
+						break
+					}
+				}
+				if !owned {
+					dataErr(validate.NotAllowed, "a file of your own runs", dataPath, fmt.Sprintf("the data %s references a file of a run that does not belong to you", name))
+					continue
+				}
+			}
+
+			info, err := os.Stat(absPath)
+			if err != nil {
+				dataErr(DataNotFound, "an existing file", dataPath, fmt.Sprintf("the file %s of data %s does not exist", dataPath, name))
+				continue
+			}
+			if !info.Mode().IsRegular() && !info.IsDir() {
+				dataErr(validate.WrongType, "a file or directory", info.Mode().Type().String(), fmt.Sprintf("the path %s of data %s is neither a regular file nor a directory", dataPath, name))
+				continue
+			}
+			if dataSpec, ok := spec.Data[name]; ok && len(dataSpec.Extensions) > 0 && info.IsDir() {
+				dataErr(validate.WrongType, "a file", "directory", fmt.Sprintf("the data %s expects a file with one of the extensions %v, but %s is a directory", name, dataSpec.Extensions, dataPath))
+				continue
+			}
+
+			file, err := os.Open(absPath)
+			if err != nil {
+				dataErr(DataNotReadable, "a readable file", dataPath, fmt.Sprintf("the file %s of data %s is not readable: %v", dataPath, name, err))
+				continue
+			}
+			file.Close()
+
+			if dataMode == DataModeCopy && info.Mode().IsRegular() && maxCopySize > 0 && info.Size() > maxCopySize {
+				dataErr(validate.OutOfRange, fmt.Sprintf("<= %d bytes", maxCopySize), fmt.Sprintf("%d bytes", info.Size()), fmt.Sprintf("the file %s of data %s exceeds the maximum size for copied datasets", dataPath, name))
+			}
+		}
+	}
+
+	return errs
+}
+
+// userRunDirs returns the mount directories of all runs visible to the user
+func userRunDirs(ctx context.Context, DB *db.Queries, userID string) []string {
+	runs, err := DB.GetAllRuns(ctx, db.GetAllRunsParams{
+		ID:       userID,
+		UserID:   userID,
+		UserID_2: userID,
+	})
+	if err != nil {
+		return []string{}
+	}
+
+	dirs := make([]string, 0, len(runs))
+	for _, run := range runs {
+		tool, err := FromDBRun(run)
+		if err != nil {
+			continue
+		}
+		if dir, ok := tool.RunDir(); ok {
+			dirs = append(dirs, resolvePath(dir))
+		}
+	}
+	return dirs
+}
+
+// resolvePath returns the absolute path with its symlinks resolved. A path which does not
+// exist (yet) is only made absolute.
+func resolvePath(path string) string {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	if realPath, err := filepath.EvalSymlinks(absPath); err == nil {
+		return realPath
+	}
+	return absPath
+}
+
+// isWithin reports whether the path is the directory dir or below it
+func isWithin(path string, dir string) bool {
+	return path == dir || strings.HasPrefix(path, dir+string(filepath.Separator))
+}
@@ -0,0 +1,149 @@
+package tool
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hydrocode-de/gorun/internal/cache"
+	"github.com/hydrocode-de/gorun/internal/db"
+	"github.com/hydrocode-de/gorun/internal/dockertest"
+	toolspec "github.com/hydrocode-de/tool-spec-go"
+	"github.com/hydrocode-de/tool-spec-go/validate"
+	"github.com/spf13/viper"
+)
+
+func TestValidateDatasetPathsOfOtherRuns(t *testing.T) {
+	dir := setTestConfig(t)
+	// the mount directory is reached through a symlink, which the checks must resolve
+	realMounts := filepath.Join(dir, "real-mounts")
+	if err := os.MkdirAll(realMounts, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(realMounts, filepath.Join(dir, "mounts")); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	DB := newTestDB(t)
+	if _, err := DB.CreateUser(ctx, db.CreateUserParams{ID: "bob", Email: "bob@example.org", PasswordHash: "x"}); err != nil {
+		t.Fatal(err)
+	}
+	daemon := dockertest.New(t)
+	addTestImage(daemon, writeMessage)
+
+	own := createTestRun(t, DB, CreateRunOptions{})
+	otherData, err := CreateToolRun(ctx, DB, CreateRunOptions{Image: testImage, Name: testTool, Parameters: map[string]interface{}{"message": "hi"}, Datasets: map[string]DatasetRef{}}, "bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := FromDBRun(otherData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ownFile := filepath.Join(own.Mounts["/out"], "result.txt")
+	otherFile := filepath.Join(other.Mounts["/out"], "result.txt")
+	outside := filepath.Join(dir, "outside.txt")
+	for _, file := range []string{ownFile, otherFile, outside} {
+		if err := os.WriteFile(file, []byte("data"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	otherLink := filepath.Join(dir, "link.txt")
+	if err := os.Symlink(otherFile, otherLink); err != nil {
+		t.Fatal(err)
+	}
+	mountsLink := filepath.Join(dir, "mounts-link")
+	if err := os.Symlink(realMounts, mountsLink); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		path    string
+		allowed bool
+	}{
+		{name: "own run", path: ownFile, allowed: true},
+		{name: "file outside the mounts", path: outside, allowed: true},
+		{name: "other run", path: otherFile},
+		{name: "other run by its real path", path: filepath.Join(realMounts, mustRel(t, filepath.Join(dir, "mounts"), otherFile))},
+		{name: "symlink to another run", path: otherLink},
+		{name: "mount path", path: viper.GetString("mount_path")},
+		{name: "symlink to the mount path", path: mountsLink},
+		{name: "parent of the mount path", path: dir},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			datasets := map[string]DatasetRef{"input": {Paths: []string{tt.path}}}
+			errs := validateDatasetPaths(ctx, DB, toolspec.ToolSpec{}, datasets, DataModeCopy, testUser)
+			denied := false
+			for _, err := range errs {
+				if validationErr, ok := err.(*validate.ValidationError); ok && validationErr.Type == validate.NotAllowed {
+					denied = true
+				}
+			}
+			if denied == tt.allowed {
+				t.Errorf("%s is allowed: %v, want %v (%v)", tt.path, !denied, tt.allowed, errs)
+			}
+		})
+	}
+}
+
+func mustRel(t *testing.T, base string, path string) string {
+	t.Helper()
+	rel, err := filepath.Rel(base, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rel
+}
+
+// a run of an unknown tool fails with the tools its image provides, an image which is not
+// cached yet is read from the daemon first
+func TestValidateUnknownTools(t *testing.T) {
+	dir := setTestConfig(t)
+	ctx := context.Background()
+	DB := newTestDB(t)
+	daemon := dockertest.New(t)
+	addTestImage(daemon, writeMessage)
+	specCache := &cache.Cache{}
+	specCache.Reset()
+	input := filepath.Join(dir, "input.txt")
+	if err := os.WriteFile(input, []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	opts := func(image string, name string) CreateRunOptions {
+		return CreateRunOptions{
+			Image:      image,
+			Name:       name,
+			Parameters: map[string]interface{}{"message": "hi"},
+			Datasets:   map[string]DatasetRef{"input": {Paths: []string{input}}},
+		}
+	}
+
+	// the image is not cached, but present on the daemon
+	if _, err := ValidateAndCreateRun(ctx, DB, specCache, opts(testImage, testTool), testUser); err != nil {
+		t.Fatalf("the run of the uncached image failed: %v", err)
+	}
+	if _, ok := specCache.GetToolSpec(testImage + "::" + testTool); !ok {
+		t.Errorf("the tools of the image read on demand are not cached")
+	}
+
+	_, err := ValidateAndCreateRun(ctx, DB, specCache, opts(testImage, "ecoh"), testUser)
+	var notFound *ToolNotFoundError
+	if !errors.As(err, &notFound) || !IsNotFound(err) {
+		t.Fatalf("the run of a typo returned %v, want a ToolNotFoundError", err)
+	}
+	if notFound.Cause != nil || len(notFound.AvailableTools) != 1 || notFound.AvailableTools[0] != testTool {
+		t.Errorf("the typo lists the tools %v (cause %v), want [%s]", notFound.AvailableTools, notFound.Cause, testTool)
+	}
+
+	_, err = ValidateAndCreateRun(ctx, DB, specCache, opts("gorun-missing:1.0", testTool), testUser)
+	if !errors.As(err, &notFound) || !IsNotFound(err) {
+		t.Fatalf("the run of a missing image returned %v, want a ToolNotFoundError", err)
+	}
+	if notFound.Cause == nil || notFound.Image != "gorun-missing:1.0" || len(notFound.AvailableTools) != 0 {
+		t.Errorf("the missing image returned %+v, want the cause and no tools", notFound)
+	}
+}
@@ -0,0 +1,231 @@
+package tool
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"path/filepath"
+	"time"
+
+	"github.com/docker/docker/client"
+	"github.com/hydrocode-de/gorun/internal/db"
+	"github.com/spf13/viper"
+)
+
+// Watchdog periodically inspects the containers of all running runs in a single loop.
+// It reconciles runs whose container exited without RunTool noticing, enforces
+// run.max_runtime and the output limit of the runs and reports runs whose /out mount did
+// not change for run.stall_threshold.
+type Watchdog struct {
+	DB *db.Queries
+	// runtimeWarned holds the runs that already got the runtime warning
+	runtimeWarned map[int64]bool
+	// stalledSince holds the last /out modification a stall was reported for
+	stalledSince map[int64]time.Time
+}
+
+func NewWatchdog(DB *db.Queries) *Watchdog {
+	return &Watchdog{
+		DB:            DB,
+		runtimeWarned: make(map[int64]bool),
+		stalledSince:  make(map[int64]time.Time),
+	}
+}
+
+// Run checks the active runs every run.watchdog_interval until the context is done
+func (w *Watchdog) Run(ctx context.Context) {
+	interval := viper.GetDuration("run.watchdog_interval")
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := w.Check(ctx); err != nil {
+				log.Printf("the run watchdog failed: %v", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Check inspects the containers of all running runs once
+func (w *Watchdog) Check(ctx context.Context) error {
+	runs, err := w.DB.GetActiveRuns(ctx)
+	if err != nil {
+		return err
+	}
+	if len(runs) == 0 {
+		return nil
+	}
+
+	active := make(map[int64]bool, len(runs))
+	for _, run := range runs {
+		active[run.ID] = true
+		if !run.ContainerID.Valid {
+			continue
+		}
+		// the containers of ssh runs are inspected on the remote daemon
+		c, err := RuntimeClient(runtimeOf(run))
+		if err != nil {
+			log.Printf("the watchdog has no client for the container of run %d: %v", run.ID, err)
+			continue
+		}
+		w.checkRun(ctx, c, run)
+	}
+
+	// forget the runs which are not active anymore
+	for id := range w.runtimeWarned {
+		if !active[id] {
+			delete(w.runtimeWarned, id)
+		}
+	}
+	for id := range w.stalledSince {
+		if !active[id] {
+			delete(w.stalledSince, id)
+		}
+	}
+	return nil
+}
+
+func (w *Watchdog) checkRun(ctx context.Context, c *client.Client, run db.Run) {
+	info, err := c.ContainerInspect(ctx, run.ContainerID.String)
+	if client.IsErrNotFound(err) {
+		w.reconcile(ctx, run, StatusErrored, ErrorInfrastructure, nil, "the container of the run does not exist anymore")
+		return
+	}
+	if err != nil {
+		log.Printf("the watchdog failed to inspect the container of run %d: %v", run.ID, err)
+		return
+	}
+
+	startedAt, _ := time.Parse(time.RFC3339Nano, info.State.StartedAt)
+	if !info.State.Running {
+		finishedAt, _ := time.Parse(time.RFC3339Nano, info.State.FinishedAt)
+		// give RunTool the time to collect the logs of a container that just exited
+		if time.Since(finishedAt) < viper.GetDuration("run.watchdog_interval") {
+			return
+		}
+
+		w.persistExitCode(ctx, run.ID, int64(info.State.ExitCode), startedAt, finishedAt)
+		if info.State.ExitCode == 0 {
+			w.reconcile(ctx, run, StatusFinished, "", nil, "the container exited unnoticed with status 0")
+		} else {
+			exitErr := fmt.Errorf("the container exited with status %d", info.State.ExitCode)
+			exitKind := ErrorToolFailure
+			if info.State.OOMKilled {
+				var limit int64
+				if info.HostConfig != nil {
+					limit = info.HostConfig.Memory
+				}
+				exitErr = fmt.Errorf("the container exited with status %d: %w", info.State.ExitCode, oomKilledError(limit))
+				exitKind = ErrorOOMKilled
+			}
+			w.reconcile(ctx, run, StatusErrored, exitKind, exitErr, fmt.Sprintf("the container exited unnoticed with status %d", info.State.ExitCode))
+		}
+		return
+	}
+
+	if w.checkOutputSize(ctx, c, run, info.ID) {
+		return
+	}
+
+	runtime := time.Since(startedAt)
+	if maxRuntime := viper.GetDuration("run.max_runtime"); maxRuntime > 0 {
+		if runtime >= maxRuntime {
+			err := fmt.Errorf("the run exceeded the maximum runtime of %s", maxRuntime)
+			RecordRunEvent(ctx, w.DB, run.ID, EventRuntimeExceeded, err.Error())
+			// mark the run first, so that RunTool does not classify the killed container as tool failure
+			w.reconcile(ctx, run, StatusErrored, ErrorTimeout, err, "")
+			if err := c.ContainerKill(ctx, info.ID, "SIGKILL"); err != nil {
+				log.Printf("failed to kill the container of run %d: %v", run.ID, err)
+			}
+			return
+		}
+		if runtime >= maxRuntime*8/10 && !w.runtimeWarned[run.ID] {
+			w.runtimeWarned[run.ID] = true
+			RecordRunEvent(ctx, w.DB, run.ID, EventRuntimeWarning, fmt.Sprintf("the run is running for %s, which is 80%% of the maximum runtime of %s", runtime.Round(time.Second), maxRuntime))
+		}
+	}
+
+	if threshold := viper.GetDuration("run.stall_threshold"); threshold > 0 {
+		tool, err := FromDBRun(run)
+		if err != nil {
+			return
+		}
+		lastChange := lastModification(tool.Mounts["/out"], startedAt)
+		if time.Since(lastChange) >= threshold && !w.stalledSince[run.ID].Equal(lastChange) {
+			w.stalledSince[run.ID] = lastChange
+			RecordRunEvent(ctx, w.DB, run.ID, EventPossiblyStalled, fmt.Sprintf("/out did not change since %s", lastChange.UTC().Format(time.RFC3339)))
+		}
+	}
+}
+
+// reconcile moves the run to the given terminal status, if this is still a legal transition
+func (w *Watchdog) reconcile(ctx context.Context, run db.Run, status RunStatus, kind ErrorKind, runErr error, message string) {
+	err := transitionRun(ctx, w.DB, run.ID, status, func() (int64, error) {
+		switch status {
+		case StatusFinished:
+			return w.DB.FinishRun(ctx, run.ID)
+		case StatusErrored:
+			if runErr == nil {
+				runErr = fmt.Errorf("%s", message)
+			}
+			return w.DB.RunErrored(ctx, db.RunErroredParams{
+				ID:           run.ID,
+				ErrorKind:    sql.NullString{String: string(kind), Valid: kind != ""},
+				ErrorMessage: sql.NullString{String: runErr.Error(), Valid: true},
+			})
+		}
+		return 0, fmt.Errorf("the watchdog does not reconcile runs to %s", status)
+	})
+	if err != nil {
+		if !errors.Is(err, ErrIllegalTransition) {
+			log.Printf("the watchdog failed to update run %d: %v", run.ID, err)
+		}
+		return
+	}
+	if message != "" {
+		RecordRunEvent(ctx, w.DB, run.ID, EventReconciled, message)
+	}
+}
+
+func (w *Watchdog) persistExitCode(ctx context.Context, runID int64, exitCode int64, startedAt time.Time, finishedAt time.Time) {
+	var durationMs sql.NullInt64
+	if !startedAt.IsZero() && !finishedAt.IsZero() {
+		durationMs = sql.NullInt64{Int64: finishedAt.Sub(startedAt).Milliseconds(), Valid: true}
+	}
+	_, err := w.DB.SetRunExitCode(ctx, db.SetRunExitCodeParams{
+		ExitCode:   sql.NullInt64{Int64: exitCode, Valid: true},
+		DurationMs: durationMs,
+		ID:         runID,
+	})
+	if err != nil {
+		log.Printf("failed to persist the exit code of run %d: %v", runID, err)
+	}
+}
+
+// lastModification returns the latest modification time below dir, but never
+// anything before since
+func lastModification(dir string, since time.Time) time.Time {
+	latest := since
+	if dir == "" {
+		return latest
+	}
+	filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if info, err := d.Info(); err == nil && info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+		return nil
+	})
+	return latest
+}
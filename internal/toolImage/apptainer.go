@@ -0,0 +1,129 @@
+package toolImage
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/hydrocode-de/gorun/internal/apptainer"
+	"github.com/hydrocode-de/gorun/internal/cache"
+	"github.com/hydrocode-de/gorun/internal/outputs"
+	"github.com/hydrocode-de/gorun/internal/specversion"
+	toolspec "github.com/hydrocode-de/tool-spec-go"
+)
+
+// ReadApptainerToolSpec reads the tool-spec of the image from its SIF, which is pulled
+// on first use. Unlike readToolSpec, gotap is not asked for the spec.
+func ReadApptainerToolSpec(ctx context.Context, imageName string) (toolspec.SpecFile, specversion.Compatibility, error) {
+	spec, raw, err := readApptainerToolSpec(ctx, imageName)
+	if err != nil {
+		return toolspec.SpecFile{}, specversion.Compatibility{}, err
+	}
+	return spec, specversion.FromSpec(raw), nil
+}
+
+func readApptainerToolSpec(ctx context.Context, imageName string) (toolspec.SpecFile, []byte, error) {
+	sif, err := apptainer.Pull(ctx, imageName)
+	if err != nil {
+		return toolspec.SpecFile{}, nil, err
+	}
+	raw, err := apptainer.Output(ctx, sif, "cat", "/src/tool.yml")
+	if err != nil {
+		return toolspec.SpecFile{}, nil, err
+	}
+	spec, err := toolspec.LoadToolSpec(raw)
+	if err != nil {
+		return toolspec.SpecFile{}, nil, fmt.Errorf("the SIF of %s did not contain a valid tool-spec at /src/tool.yml: %v", imageName, err)
+	}
+	return spec, raw, nil
+}
+
+// LoadApptainerToolSpec caches the tool-spec of the image read from its SIF, like
+// LoadToolSpec does through the Docker daemon. The citation and platform are not read.
+func LoadApptainerToolSpec(ctx context.Context, toolSlug string, cache *cache.Cache) error {
+	imageName, toolName, _ := strings.Cut(toolSlug, "::")
+	spec, raw, err := readApptainerToolSpec(ctx, imageName)
+	if err != nil {
+		return err
+	}
+	cache.SetImageSpec(imageName, spec)
+	cache.SetImageCompatibility(imageName, specversion.FromSpec(raw))
+	cache.SetImageOutputs(imageName, outputs.FromSpec(raw))
+	cache.SetImageCommands(imageName, CommandsFromSpec(raw))
+	cache.SetImageParamEnv(imageName, ParamEnvFromSpec(raw))
+	for name, tool := range spec.Tools {
+		tool.ID = fmt.Sprintf("%s::%s", imageName, name)
+		cache.SetToolSpec(tool.ID, &tool)
+	}
+	if _, ok := spec.Tools[toolName]; !ok {
+		return fmt.Errorf("the tool %s was not found in the image %s: %w", toolName, imageName, ErrToolNotFound)
+	}
+	return nil
+}
+
+// the probes of a SIF, which does not change once it was pulled
+var (
+	sifProbesMu sync.Mutex
+	sifGotap    = make(map[string]*GotapTemplate)
+	sifEntries  = make(map[string]*EntryFile)
+
+	sifGotapCapabilities = make(map[string]GotapCapabilities)
+)
+
+// ProbeApptainerGotap checks if the SIF ships the gotap shim, like ProbeGotap
+func ProbeApptainerGotap(ctx context.Context, sif string) bool {
+	_, found, _ := ProbeApptainerGotapTemplate(ctx, sif)
+	return found
+}
+
+// ProbeApptainerGotapTemplate is ProbeGotapTemplate for a SIF file. A SIF has no labels
+// gorun reads, only its companion file overrides the configuration.
+func ProbeApptainerGotapTemplate(ctx context.Context, sif string) (GotapTemplate, bool, error) {
+	sifProbesMu.Lock()
+	probe, ok := sifGotap[sif]
+	sifProbesMu.Unlock()
+	if ok {
+		return templateOf(probe)
+	}
+
+	companion, err := apptainer.Output(ctx, sif, "cat", CompanionFile)
+	if err != nil {
+		companion = nil
+	}
+	override, err := gotapOverride(sif, nil, companion)
+	if err != nil {
+		return GotapTemplate{}, false, err
+	}
+	for _, name := range override.probeNames() {
+		stdout, err := apptainer.Output(ctx, sif, name, "-v")
+		if err == nil && strings.TrimSpace(string(stdout)) != "" {
+			probe = &GotapTemplate{Name: name, RunArgs: override.runArgs()}
+			break
+		}
+	}
+	sifProbesMu.Lock()
+	sifGotap[sif] = probe
+	sifProbesMu.Unlock()
+	return templateOf(probe)
+}
+
+// FindApptainerEntryFile looks up the first of the EntryFiles in the SIF, like FindEntryFile
+func FindApptainerEntryFile(ctx context.Context, sif string) (EntryFile, bool) {
+	sifProbesMu.Lock()
+	entry, ok := sifEntries[sif]
+	sifProbesMu.Unlock()
+	if !ok {
+		for _, candidate := range EntryFiles {
+			if _, err := apptainer.Output(ctx, sif, "test", "-f", candidate.Path); err == nil {
+				entry = &candidate
+				break
+			}
+		}
+		sifProbesMu.Lock()
+		sifEntries[sif] = entry
+		sifProbesMu.Unlock()
+	}
+	found, ok, _ := entryOrEmpty(entry)
+	return found, ok
+}
@@ -0,0 +1,154 @@
+package toolImage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/hydrocode-de/gorun/internal/cache"
+	"github.com/hydrocode-de/gorun/internal/registry"
+	toolspec "github.com/hydrocode-de/tool-spec-go"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+// CatalogIndex lists published tool images. It is read as YAML, which includes JSON.
+type CatalogIndex struct {
+	Tools []CatalogEntry `yaml:"tools"`
+}
+
+// CatalogEntry is one image of the catalog. Without a spec, the tool-spec is read from
+// the registry of the image.
+type CatalogEntry struct {
+	Image    string `yaml:"image"`
+	Digest   string `yaml:"digest"`
+	Platform string `yaml:"platform"`
+	// Spec is the content of /src/tool.yml, as nested document or as string
+	Spec     yaml.Node `yaml:"spec"`
+	Citation string    `yaml:"citation"`
+}
+
+// rawSpec returns the spec of the entry as the bytes of a tool.yml, if it has one
+func (e CatalogEntry) rawSpec() ([]byte, error) {
+	switch e.Spec.Kind {
+	case 0:
+		return nil, nil
+	case yaml.ScalarNode:
+		return []byte(e.Spec.Value), nil
+	default:
+		return yaml.Marshal(&e.Spec)
+	}
+}
+
+// FetchCatalogIndex reads the index from an http(s) URL or a local file
+func FetchCatalogIndex(ctx context.Context, location string) (CatalogIndex, error) {
+	var content []byte
+	if strings.HasPrefix(location, "http://") || strings.HasPrefix(location, "https://") {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, location, nil)
+		if err != nil {
+			return CatalogIndex{}, err
+		}
+		resp, err := (&http.Client{Timeout: viper.GetDuration("catalog.timeout")}).Do(req)
+		if err != nil {
+			return CatalogIndex{}, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return CatalogIndex{}, fmt.Errorf("the catalog index %s responded with %s", location, resp.Status)
+		}
+		if content, err = io.ReadAll(io.LimitReader(resp.Body, 64<<20)); err != nil {
+			return CatalogIndex{}, err
+		}
+	} else {
+		var err error
+		if content, err = os.ReadFile(strings.TrimPrefix(location, "file://")); err != nil {
+			return CatalogIndex{}, err
+		}
+	}
+
+	var index CatalogIndex
+	if err := yaml.Unmarshal(content, &index); err != nil {
+		return CatalogIndex{}, fmt.Errorf("the catalog index %s is invalid: %w", location, err)
+	}
+	return index, nil
+}
+
+// SyncCatalog merges the tools of the catalog index into the cache, marked with the source
+// catalog. Entries without a spec are read from their registry. Images read from the Docker
+// host are kept, a catalog entry of the same digest with another spec is only logged.
+func SyncCatalog(ctx context.Context, location string, specCache *cache.Cache, policy Policy) ([]string, error) {
+	index, err := FetchCatalogIndex(ctx, location)
+	if err != nil {
+		return nil, err
+	}
+
+	tools := make([]string, 0)
+	var errs []error
+	for _, entry := range index.Tools {
+		found, err := syncCatalogEntry(ctx, entry, specCache, policy)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("catalog entry %s: %w", entry.Image, err))
+			continue
+		}
+		tools = append(tools, found...)
+	}
+	return tools, errors.Join(errs...)
+}
+
+func syncCatalogEntry(ctx context.Context, entry CatalogEntry, specCache *cache.Cache, policy Policy) ([]string, error) {
+	ref, err := registry.ParseReference(entry.Image)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := entry.rawSpec()
+	if err != nil {
+		return nil, err
+	}
+	if raw == nil {
+		return discoverRegistryImage(ctx, registry.NewClient(ref), ref, specCache, policy, cache.SourceCatalog)
+	}
+
+	var digests []string
+	if entry.Digest != "" {
+		digests = append(digests, ref.Name+"@"+entry.Digest)
+	}
+	if !policy.Allows(ref.Name, digests) {
+		return nil, fmt.Errorf("the image %s is not on the image allowlist: %w", ref.Name, ErrPolicyViolation)
+	}
+
+	if origin, ok := specCache.GetOrigin(ref.Name); ok && origin.Source == cache.SourceLocal {
+		local, _ := specCache.GetImageSpec(ref.Name)
+		checkCatalogDiscrepancy(ctx, ref.Name, entry, raw, *local)
+		return toolSlugs(ref.Name, *local), nil
+	}
+	read := registryImage{raw: raw, citation: []byte(entry.Citation), platform: entry.Platform}
+	return cacheRemoteSpec(ctx, specCache, ref.Name, read, cache.SourceCatalog)
+}
+
+// checkCatalogDiscrepancy logs if the catalog describes the local image differently. Entries
+// of another digest describe another build of the tag and are not compared.
+func checkCatalogDiscrepancy(ctx context.Context, imageName string, entry CatalogEntry, raw []byte, local toolspec.SpecFile) {
+	if entry.Digest != "" {
+		sameImage := slices.ContainsFunc(readRepoDigests(ctx, imageName), func(repoDigest string) bool {
+			return referenceDigest(repoDigest) == entry.Digest
+		})
+		if !sameImage {
+			return
+		}
+	}
+	catalogSpec, err := toolspec.LoadToolSpec(raw)
+	if err != nil {
+		log.Printf("the catalog entry of the local image %s has an invalid tool-spec: %v", imageName, err)
+		return
+	}
+	if !reflect.DeepEqual(catalogSpec.Tools, local.Tools) {
+		log.Printf("the catalog entry of %s differs from the tool-spec of the local image, the local one is used", imageName)
+	}
+}
@@ -0,0 +1,76 @@
+package toolImage
+
+import (
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Command is the command a tool declares in its tool.yml. tool-spec-go does not model
+// it, so it is read from the raw spec. It is either a list of arguments or a string,
+// which is split at white space:
+//
+//	tools:
+//	  my_tool:
+//	    command: ["python", "/src/run.py"]
+//
+// The command is only used if the image has no gotap, it replaces the CMD of the image.
+type Command []string
+
+func (c *Command) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*c = strings.Fields(node.Value)
+		return nil
+	}
+	var args []string
+	if err := node.Decode(&args); err != nil {
+		return err
+	}
+	*c = args
+	return nil
+}
+
+// CommandsFromSpec reads the declared command of each tool of a raw tool.yml.
+// Tools without a command are left out.
+func CommandsFromSpec(raw []byte) map[string][]string {
+	var spec struct {
+		Tools map[string]struct {
+			Command Command `yaml:"command"`
+		} `yaml:"tools"`
+	}
+	declared := make(map[string][]string)
+	if err := yaml.Unmarshal(raw, &spec); err != nil {
+		return declared
+	}
+	for name, tool := range spec.Tools {
+		if len(tool.Command) == 0 {
+			continue
+		}
+		declared[name] = tool.Command
+	}
+	return declared
+}
+
+// ParamEnvFromSpec reads which tools of a raw tool.yml ask for their parameters as
+// environment variables, for images which do not read /in/inputs.json:
+//
+//	tools:
+//	  my_tool:
+//	    param_env: true
+func ParamEnvFromSpec(raw []byte) map[string]bool {
+	var spec struct {
+		Tools map[string]struct {
+			ParamEnv bool `yaml:"param_env"`
+		} `yaml:"tools"`
+	}
+	declared := make(map[string]bool)
+	if err := yaml.Unmarshal(raw, &spec); err != nil {
+		return declared
+	}
+	for name, tool := range spec.Tools {
+		if tool.ParamEnv {
+			declared[name] = true
+		}
+	}
+	return declared
+}
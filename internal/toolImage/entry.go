@@ -0,0 +1,89 @@
+package toolImage
+
+import (
+	"context"
+	"sync"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+	"github.com/hydrocode-de/gorun/internal/dockerclient"
+)
+
+// EntryFile is a run file of the tool-spec and the interpreter it is executed with
+type EntryFile struct {
+	Path        string
+	Interpreter []string
+}
+
+// Command is the command executing the entry file
+func (e EntryFile) Command() []string {
+	return append(append([]string{}, e.Interpreter...), e.Path)
+}
+
+// EntryFiles are the run files an image without gotap may ship, in the order they are looked up
+var EntryFiles = []EntryFile{
+	{Path: "/src/run.py", Interpreter: []string{"python"}},
+	{Path: "/src/run.R", Interpreter: []string{"Rscript"}},
+	{Path: "/src/run.js", Interpreter: []string{"node"}},
+	{Path: "/src/run.m", Interpreter: []string{"octave", "--no-gui"}},
+}
+
+// like the gotap probe, the entry file only depends on the content of the image
+var (
+	entryProbesMu sync.Mutex
+	entryProbes   = make(map[string]*EntryFile)
+)
+
+// FindEntryFile looks up the first of the EntryFiles which exists in the image. The files
+// are read from the file system of a container which is created, but never started.
+func FindEntryFile(ctx context.Context, c *client.Client, imageName string) (EntryFile, bool, error) {
+	var imageID string
+	if info, err := c.ImageInspect(ctx, imageName); err == nil {
+		imageID = info.ID
+		entryProbesMu.Lock()
+		entry, ok := entryProbes[imageID]
+		entryProbesMu.Unlock()
+		if ok {
+			return entryOrEmpty(entry)
+		}
+	}
+
+	// the entrypoint is never executed, it only has to be set for images without a command
+	cont, err := c.ContainerCreate(ctx, &container.Config{
+		Image:      imageName,
+		Entrypoint: []string{"/bin/true"},
+		Labels:     dockerclient.Labels(dockerclient.PurposeProbe),
+	}, &container.HostConfig{}, nil, nil, "")
+	if err != nil {
+		return EntryFile{}, false, err
+	}
+	defer c.ContainerRemove(ctx, cont.ID, container.RemoveOptions{Force: true})
+
+	var found *EntryFile
+	for _, entry := range EntryFiles {
+		stat, err := c.ContainerStatPath(ctx, cont.ID, entry.Path)
+		if client.IsErrNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return EntryFile{}, false, err
+		}
+		if !stat.Mode.IsDir() {
+			found = &entry
+			break
+		}
+	}
+	if imageID != "" {
+		entryProbesMu.Lock()
+		entryProbes[imageID] = found
+		entryProbesMu.Unlock()
+	}
+	return entryOrEmpty(found)
+}
+
+func entryOrEmpty(entry *EntryFile) (EntryFile, bool, error) {
+	if entry == nil {
+		return EntryFile{}, false, nil
+	}
+	return *entry, true, nil
+}
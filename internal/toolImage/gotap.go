@@ -3,29 +3,143 @@ package toolImage
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"log"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/client"
 	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/hydrocode-de/gorun/internal/dockerclient"
+	"github.com/spf13/viper"
 )
 
+// the result of a probe only depends on the content of the image, so it is cached per image ID
+var (
+	gotapProbesMu sync.Mutex
+	gotapProbes   = make(map[string]*GotapTemplate)
+
+	gotapCapabilities = make(map[string]GotapCapabilities)
+)
+
+// ProbeGotap checks if the image ships the gotap shim by running gotap -v in a container.
+// The container is only created once per image ID. The name of the executable is returned.
 func ProbeGotap(ctx context.Context, c *client.Client, imageName string) (string, bool, error) {
-	stdout, _, exitCode, err := runContainerCommand(ctx, c, imageName, []string{"gotap"}, []string{"-v"})
+	template, found, err := ProbeGotapTemplate(ctx, c, imageName)
+	return template.Name, found, err
+}
+
+// ProbeGotapTemplate checks the gotap.probe_names in the image, or the name of its override,
+// and returns how gotap is started in it
+func ProbeGotapTemplate(ctx context.Context, c *client.Client, imageName string) (GotapTemplate, bool, error) {
+	var imageID string
+	var labels map[string]string
+	if info, err := c.ImageInspect(ctx, imageName); err == nil {
+		imageID = info.ID
+		if info.Config != nil {
+			labels = info.Config.Labels
+		}
+		gotapProbesMu.Lock()
+		probe, ok := gotapProbes[imageID]
+		gotapProbesMu.Unlock()
+		if ok {
+			return templateOf(probe)
+		}
+	}
+
+	companion, _, exitCode, err := runContainerCommand(ctx, c, imageName, []string{"cat"}, []string{CompanionFile})
+	if err != nil || exitCode != 0 {
+		companion = ""
+	}
+	override, err := gotapOverride(imageName, labels, []byte(companion))
 	if err != nil {
-		return "", false, err
+		return GotapTemplate{}, false, err
+	}
+
+	var probe *GotapTemplate
+	timedOut := false
+	for _, name := range override.probeNames() {
+		stdout, _, exitCode, err := runContainerCommand(ctx, c, imageName, []string{name}, []string{"-v"})
+		if isExecutableMissing(err) {
+			continue
+		}
+		// a probe which hangs counts as no gotap
+		if errors.Is(err, ErrProbeTimeout) {
+			timedOut = true
+			continue
+		}
+		if err != nil {
+			return GotapTemplate{}, false, err
+		}
+		if exitCode == 0 && strings.TrimSpace(stdout) != "" {
+			probe = &GotapTemplate{Name: name, RunArgs: override.runArgs()}
+			break
+		}
 	}
-	if exitCode != 0 {
-		return "", false, nil
+	// the timeout may have been a busy daemon, so the image is probed again next time
+	if imageID != "" && (probe != nil || !timedOut) {
+		gotapProbesMu.Lock()
+		gotapProbes[imageID] = probe
+		gotapProbesMu.Unlock()
 	}
-	if strings.TrimSpace(stdout) == "" {
-		return "", false, nil
+	return templateOf(probe)
+}
+
+func templateOf(probe *GotapTemplate) (GotapTemplate, bool, error) {
+	if probe == nil {
+		return GotapTemplate{}, false, nil
 	}
-	return "gotap", true, nil
+	return *probe, true, nil
 }
 
+// isExecutableMissing tells if a container could not start, as its entrypoint does not exist
+func isExecutableMissing(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "executable file not found")
+}
+
+// ErrProbeTimeout is returned for probe containers which did not exit within scan.probe_timeout
+var ErrProbeTimeout = errors.New("the probe container did not exit in time")
+
+// the probes which timed out per image, until ReadAllTools reports them
+var (
+	probeTimeoutsMu sync.Mutex
+	probeTimeouts   = make(map[string]int)
+)
+
+// takeProbeTimeouts returns the number of probes of the image which timed out and resets it
+func takeProbeTimeouts(imageName string) int {
+	probeTimeoutsMu.Lock()
+	defer probeTimeoutsMu.Unlock()
+	count := probeTimeouts[imageName]
+	delete(probeTimeouts, imageName)
+	return count
+}
+
+// runContainerCommand runs the command in a new container of the image and returns its output.
+// The container is force removed if it does not exit within scan.probe_timeout.
 func runContainerCommand(ctx context.Context, c *client.Client, imageName string, entrypoint []string, cmd []string) (string, string, int64, error) {
+	probeCtx, cancel := ctx, context.CancelFunc(func() {})
+	timeout := viper.GetDuration("scan.probe_timeout")
+	if timeout > 0 {
+		probeCtx, cancel = context.WithTimeout(ctx, timeout)
+	}
+	defer cancel()
+	stdout, stderr, exitCode, err := runProbeContainer(probeCtx, c, imageName, entrypoint, cmd)
+	if err != nil && errors.Is(probeCtx.Err(), context.DeadlineExceeded) && ctx.Err() == nil {
+		command := strings.Join(append(append([]string{}, entrypoint...), cmd...), " ")
+		log.Printf("warning: %s in the image %s did not exit within %s, the container was removed", command, imageName, timeout)
+		probeTimeoutsMu.Lock()
+		probeTimeouts[imageName]++
+		probeTimeoutsMu.Unlock()
+		return "", "", 0, fmt.Errorf("%w: %s in the image %s ran for more than %s", ErrProbeTimeout, command, imageName, timeout)
+	}
+	return stdout, stderr, exitCode, err
+}
+
+func runProbeContainer(ctx context.Context, c *client.Client, imageName string, entrypoint []string, cmd []string) (string, string, int64, error) {
 	cont, err := c.ContainerCreate(ctx, &container.Config{
 		Image:        imageName,
 		Entrypoint:   entrypoint,
@@ -33,11 +147,17 @@ func runContainerCommand(ctx context.Context, c *client.Client, imageName string
 		AttachStdout: true,
 		AttachStderr: true,
 		Tty:          false,
+		Labels:       dockerclient.Labels(dockerclient.PurposeProbe),
 	}, &container.HostConfig{}, nil, nil, "")
 	if err != nil {
 		return "", "", 0, err
 	}
-	defer c.ContainerRemove(ctx, cont.ID, container.RemoveOptions{})
+	// the container is still running if the deadline passed, so it is removed by force
+	defer func() {
+		cleanupCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), time.Minute)
+		defer cancel()
+		c.ContainerRemove(cleanupCtx, cont.ID, container.RemoveOptions{Force: true})
+	}()
 
 	if err = c.ContainerStart(ctx, cont.ID, container.StartOptions{}); err != nil {
 		return "", "", 0, err
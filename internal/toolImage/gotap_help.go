@@ -0,0 +1,152 @@
+package toolImage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+
+	"github.com/docker/docker/client"
+	"github.com/hydrocode-de/gorun/internal/apptainer"
+)
+
+// ErrGotapIncompatible is wrapped by the errors of runs whose gotap lacks an argument
+// gorun needs to pass
+var ErrGotapIncompatible = errors.New("incompatible gotap")
+
+// GotapCapabilities describe gotap run in an image, as read from gotap run --help
+type GotapCapabilities struct {
+	Version string
+	// Flags are the long flags of gotap run, without the dashes
+	Flags map[string]bool
+	// Positionals are the arguments of the usage line, the first one is the tool
+	Positionals []string
+	// Parsed is false if the help could not be read, gorun passes its defaults then
+	Parsed bool
+}
+
+// Has tells if gotap run takes the flag
+func (g GotapCapabilities) Has(flag string) bool {
+	return g.Flags[flag]
+}
+
+// Positional returns the position of the argument on the usage line, or -1
+func (g GotapCapabilities) Positional(name string) int {
+	for i, positional := range g.Positionals {
+		if positional == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// a flag listed in the help, like "  -i, --input-file string" of cobra, "  -input-file string"
+// of the flag package or "  -i, --input-file <INPUT_FILE>" of clap
+var helpFlagPattern = regexp.MustCompile(`(?m)^\s+(?:-[A-Za-z0-9],\s*)?--?([A-Za-z][A-Za-z0-9_-]*)`)
+
+// an argument of the usage line, like <TOOL>, [input-file] or <input_file>...
+var usageArgPattern = regexp.MustCompile(`^[<\[]([A-Za-z][A-Za-z0-9_-]*)[>\]](?:\.\.\.)?$`)
+
+// ParseGotapHelp reads the flags and positional arguments from the help of gotap run
+func ParseGotapHelp(help string) GotapCapabilities {
+	caps := GotapCapabilities{Flags: make(map[string]bool)}
+	for _, match := range helpFlagPattern.FindAllStringSubmatch(help, -1) {
+		caps.Flags[normalizeGotapArg(match[1])] = true
+	}
+	delete(caps.Flags, "h")
+
+	lines := strings.Split(help, "\n")
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if !strings.HasPrefix(strings.ToLower(trimmed), "usage:") {
+			continue
+		}
+		usage := strings.TrimSpace(trimmed[len("usage:"):])
+		// cobra prints the usage on the next line
+		if usage == "" && i+1 < len(lines) {
+			usage = strings.TrimSpace(lines[i+1])
+		}
+		fields := strings.Fields(usage)
+		for j, field := range fields {
+			if field != "run" {
+				continue
+			}
+			for _, arg := range fields[j+1:] {
+				match := usageArgPattern.FindStringSubmatch(arg)
+				if match == nil {
+					continue
+				}
+				name := normalizeGotapArg(match[1])
+				if name == "flags" || name == "options" {
+					continue
+				}
+				caps.Positionals = append(caps.Positionals, name)
+			}
+			break
+		}
+		break
+	}
+	caps.Parsed = len(caps.Flags) > 0 || len(caps.Positionals) > 0
+	return caps
+}
+
+func normalizeGotapArg(name string) string {
+	return strings.ReplaceAll(strings.ToLower(name), "_", "-")
+}
+
+// ProbeGotapCapabilities runs gotap -v and gotap run --help in the image, which has to ship
+// gotap under the name found by ProbeGotapTemplate. Like ProbeGotap, the result is cached
+// per image ID.
+func ProbeGotapCapabilities(ctx context.Context, c *client.Client, imageName string, gotapName string) (GotapCapabilities, error) {
+	var imageID string
+	if info, err := c.ImageInspect(ctx, imageName); err == nil {
+		imageID = info.ID
+		gotapProbesMu.Lock()
+		caps, ok := gotapCapabilities[imageID]
+		gotapProbesMu.Unlock()
+		if ok {
+			return caps, nil
+		}
+	}
+
+	version, _, _, err := runContainerCommand(ctx, c, imageName, []string{gotapName}, []string{"-v"})
+	if err != nil {
+		return GotapCapabilities{}, err
+	}
+	// older versions print the help to STDERR
+	stdout, stderr, _, err := runContainerCommand(ctx, c, imageName, []string{gotapName}, []string{"run", "--help"})
+	if err != nil {
+		return GotapCapabilities{}, err
+	}
+	caps := ParseGotapHelp(stdout + "\n" + stderr)
+	caps.Version = strings.TrimSpace(version)
+	if imageID != "" {
+		gotapProbesMu.Lock()
+		gotapCapabilities[imageID] = caps
+		gotapProbesMu.Unlock()
+	}
+	return caps, nil
+}
+
+// ProbeApptainerGotapCapabilities is ProbeGotapCapabilities for a SIF file
+func ProbeApptainerGotapCapabilities(ctx context.Context, sif string, gotapName string) GotapCapabilities {
+	sifProbesMu.Lock()
+	caps, ok := sifGotapCapabilities[sif]
+	sifProbesMu.Unlock()
+	if ok {
+		return caps
+	}
+
+	// older versions print the help to STDERR
+	help := new(bytes.Buffer)
+	apptainer.Exec(ctx, apptainer.ExecOptions{SIF: sif, Command: []string{gotapName, "run", "--help"}, Stdout: help, Stderr: help})
+	caps = ParseGotapHelp(help.String())
+	if version, err := apptainer.Output(ctx, sif, gotapName, "-v"); err == nil {
+		caps.Version = strings.TrimSpace(string(version))
+	}
+	sifProbesMu.Lock()
+	sifGotapCapabilities[sif] = caps
+	sifProbesMu.Unlock()
+	return caps
+}
@@ -0,0 +1,106 @@
+package toolImage
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/hydrocode-de/gorun/internal/dockertest"
+)
+
+// the help of gotap run as printed by the CLI libraries gotap was built with
+const (
+	cobraHelp = `Run a tool of the image
+
+Usage:
+  gotap run TOOL [flags]
+
+Flags:
+  -i, --input-file string      the inputs.json of the run
+  -s, --spec-file string       the tool.yml of the image
+  -o, --output-folder string   the folder of the results
+  -h, --help                   help for run
+`
+	// the flag package of older versions prints the help to STDERR
+	flagHelp = `Usage of run:
+  -input string
+    	the inputs.json of the run
+  -spec string
+    	the tool.yml of the image
+`
+	clapHelp = `Run a tool of the image
+
+Usage: gotap run <TOOL> <INPUT_FILE> [OPTIONS]
+
+Arguments:
+  <TOOL>        The name of the tool
+  <INPUT_FILE>  The inputs.json of the run
+
+Options:
+  -s, --spec-file <SPEC_FILE>  The tool.yml of the image
+  -h, --help                   Print help
+`
+)
+
+func TestParseGotapHelp(t *testing.T) {
+	tests := []struct {
+		name            string
+		help            string
+		wantFlags       []string
+		wantPositionals []string
+		wantParsed      bool
+	}{
+		{name: "cobra", help: cobraHelp, wantFlags: []string{"help", "input-file", "output-folder", "spec-file"}, wantParsed: true},
+		{name: "flag package", help: flagHelp, wantFlags: []string{"input", "spec"}, wantParsed: true},
+		{name: "clap", help: clapHelp, wantFlags: []string{"help", "spec-file"}, wantPositionals: []string{"tool", "input-file"}, wantParsed: true},
+		{name: "no help", help: "exec: unknown command run\n", wantParsed: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			caps := ParseGotapHelp(tt.help)
+			var flags []string
+			for flag := range caps.Flags {
+				flags = append(flags, flag)
+			}
+			slices.Sort(flags)
+			if !slices.Equal(flags, tt.wantFlags) {
+				t.Errorf("the flags are %v, want %v", flags, tt.wantFlags)
+			}
+			if !slices.Equal(caps.Positionals, tt.wantPositionals) {
+				t.Errorf("the positionals are %v, want %v", caps.Positionals, tt.wantPositionals)
+			}
+			if caps.Parsed != tt.wantParsed {
+				t.Errorf("the help is parsed: %v, want %v", caps.Parsed, tt.wantParsed)
+			}
+		})
+	}
+}
+
+// the capabilities are read from STDOUT or STDERR once per image
+func TestProbeGotapCapabilities(t *testing.T) {
+	setImageConfig(t)
+	daemon := dockertest.New(t)
+	daemon.AddImage(dockertest.Image{
+		RepoTags: []string{"gorun-gotap-old:1.0"},
+		Commands: map[string]dockertest.Result{
+			"gotap -v":         {Stdout: "gotap 0.2.1\n"},
+			"gotap run --help": {Stderr: flagHelp, ExitCode: 2},
+		},
+	})
+	ctx := context.Background()
+
+	caps, err := ProbeGotapCapabilities(ctx, daemon.Client(), "gorun-gotap-old:1.0", "gotap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if caps.Version != "gotap 0.2.1" || !caps.Has("input") || !caps.Has("spec") || caps.Has("output-folder") {
+		t.Errorf("the capabilities are %+v", caps)
+	}
+	probes := daemon.Calls("create")
+	if _, err := ProbeGotapCapabilities(ctx, daemon.Client(), "gorun-gotap-old:1.0", "gotap"); err != nil {
+		t.Fatal(err)
+	}
+	if n := daemon.Calls("create"); n != probes {
+		t.Errorf("the cached capabilities were probed again with %d containers", n-probes)
+	}
+}
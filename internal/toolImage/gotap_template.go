@@ -0,0 +1,148 @@
+package toolImage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+// CompanionFile configures how gorun starts the tools of an image, besides its labels
+const CompanionFile = "/src/gorun.yml"
+
+// the labels overriding the gotap configuration for an image. The run args are a JSON list.
+const (
+	LabelGotapName    = "org.gorun.gotap.name"
+	LabelGotapRunArgs = "org.gorun.gotap.run_args"
+)
+
+// the placeholders of gotap.run_args and their values in the container
+var gotapPlaceholders = map[string]string{
+	"{tool}":          "",
+	"{input_file}":    "/in/inputs.json",
+	"{spec_file}":     "/src/tool.yml",
+	"{output_folder}": "/out",
+}
+
+// ErrInvalidGotapOverride is wrapped by the errors of images whose labels or companion file
+// configure gotap wrongly
+var ErrInvalidGotapOverride = errors.New("invalid gotap override")
+
+var placeholderPattern = regexp.MustCompile(`\{[^{}]*\}`)
+
+// GotapTemplate is how gotap is started in an image
+type GotapTemplate struct {
+	// Name is the executable, the first of gotap.probe_names found in the image
+	Name string
+	// RunArgs are the arguments of gotap run. If empty, they are adapted to the help of gotap.
+	RunArgs []string
+}
+
+// RenderRunArgs replaces the placeholders of the run args
+func (t GotapTemplate) RenderRunArgs(toolName string) []string {
+	values := []string{"{tool}", toolName}
+	for placeholder, value := range gotapPlaceholders {
+		if placeholder != "{tool}" {
+			values = append(values, placeholder, value)
+		}
+	}
+	replacer := strings.NewReplacer(values...)
+	args := make([]string, 0, len(t.RunArgs))
+	for _, arg := range t.RunArgs {
+		args = append(args, replacer.Replace(arg))
+	}
+	return args
+}
+
+// ParseRunArgs checks a gotap.run_args template. It has to name the tool and may only
+// use the known placeholders.
+func ParseRunArgs(args []string) error {
+	hasTool := false
+	for _, arg := range args {
+		for _, placeholder := range placeholderPattern.FindAllString(arg, -1) {
+			if _, ok := gotapPlaceholders[placeholder]; !ok {
+				return fmt.Errorf("unknown placeholder %s in the gotap run args, use {tool}, {input_file}, {spec_file} or {output_folder}", placeholder)
+			}
+			hasTool = hasTool || placeholder == "{tool}"
+		}
+		if rest := placeholderPattern.ReplaceAllString(arg, ""); strings.ContainsAny(rest, "{}") {
+			return fmt.Errorf("unbalanced braces in the gotap run arg %q", arg)
+		}
+	}
+	if len(args) > 0 && !hasTool {
+		return fmt.Errorf("the gotap run args %v have to contain the {tool} placeholder", args)
+	}
+	return nil
+}
+
+// ValidateGotapConfig checks gotap.probe_names and gotap.run_args when the configuration is
+// loaded, so that a broken template never reaches a run
+func ValidateGotapConfig() error {
+	if len(probeNames()) == 0 {
+		return fmt.Errorf("gotap.probe_names must name at least one executable")
+	}
+	if err := ParseRunArgs(viper.GetStringSlice("gotap.run_args")); err != nil {
+		return fmt.Errorf("invalid gotap.run_args: %w", err)
+	}
+	return nil
+}
+
+func probeNames() []string {
+	names := make([]string, 0)
+	for _, name := range viper.GetStringSlice("gotap.probe_names") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// imageGotap is the gotap configuration of an image, from its labels or companion file
+type imageGotap struct {
+	Name    string   `yaml:"name"`
+	RunArgs []string `yaml:"run_args"`
+}
+
+func (o imageGotap) probeNames() []string {
+	if o.Name != "" {
+		return []string{o.Name}
+	}
+	return probeNames()
+}
+
+func (o imageGotap) runArgs() []string {
+	if len(o.RunArgs) > 0 {
+		return o.RunArgs
+	}
+	return viper.GetStringSlice("gotap.run_args")
+}
+
+// gotapOverride reads the gotap section of the companion file, which the labels of the
+// image take precedence over
+func gotapOverride(imageName string, labels map[string]string, companion []byte) (imageGotap, error) {
+	var file struct {
+		Gotap imageGotap `yaml:"gotap"`
+	}
+	if len(companion) > 0 {
+		if err := yaml.Unmarshal(companion, &file); err != nil {
+			return imageGotap{}, fmt.Errorf("invalid %s in the image %s: %v: %w", CompanionFile, imageName, err, ErrInvalidGotapOverride)
+		}
+	}
+	override := file.Gotap
+	if name := labels[LabelGotapName]; name != "" {
+		override.Name = name
+	}
+	if raw := labels[LabelGotapRunArgs]; raw != "" {
+		if err := json.Unmarshal([]byte(raw), &override.RunArgs); err != nil {
+			return imageGotap{}, fmt.Errorf("the label %s of the image %s has to be a JSON list: %v: %w", LabelGotapRunArgs, imageName, err, ErrInvalidGotapOverride)
+		}
+	}
+	if err := ParseRunArgs(override.RunArgs); err != nil {
+		return imageGotap{}, fmt.Errorf("invalid gotap run args of the image %s: %v: %w", imageName, err, ErrInvalidGotapOverride)
+	}
+	return override, nil
+}
@@ -0,0 +1,144 @@
+package toolImage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hydrocode-de/gorun/internal/cache"
+	"github.com/hydrocode-de/gorun/internal/dockertest"
+	"github.com/spf13/viper"
+)
+
+// hanging is an image whose probes never exit, like an entrypoint waiting on a TTY
+var hanging = dockertest.Image{
+	RepoTags: []string{"hanging:1.0"},
+	Commands: map[string]dockertest.Result{
+		"gotap -v":          {Hang: true},
+		"cat /src/tool.yml": {Hang: true},
+	},
+}
+
+// hangingProbes counts the probe containers started with a command which never exits
+func hangingProbes(daemon *dockertest.Daemon) int {
+	n := 0
+	for _, c := range daemon.Created() {
+		if _, ok := hanging.Commands[c.Command()]; ok && c.Image == hanging.RepoTags[0] {
+			n++
+		}
+	}
+	return n
+}
+
+// captureLog collects the log output of the test
+func captureLog(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+	return &buf
+}
+
+func TestRunContainerCommandTimeout(t *testing.T) {
+	setImageConfig(t)
+	viper.Set("scan.probe_timeout", 50*time.Millisecond)
+	logs := captureLog(t)
+	daemon := dockertest.New(t)
+	daemon.AddImage(hanging)
+
+	started := time.Now()
+	_, _, _, err := runContainerCommand(context.Background(), daemon.Client(), "hanging:1.0", []string{"cat"}, []string{"/src/tool.yml"})
+	if !errors.Is(err, ErrProbeTimeout) {
+		t.Fatalf("the hanging probe returned %v, want %v", err, ErrProbeTimeout)
+	}
+	if elapsed := time.Since(started); elapsed > 2*time.Second {
+		t.Errorf("the hanging probe returned after %s", elapsed)
+	}
+	created := daemon.Created()
+	if len(created) != 1 || !daemon.Removed(created[0].ID) {
+		t.Errorf("the container of the hanging probe was not removed")
+	}
+	if !strings.Contains(logs.String(), "warning: cat /src/tool.yml in the image hanging:1.0 did not exit within 50ms") {
+		t.Errorf("the timeout was not logged: %s", logs)
+	}
+	if n := takeProbeTimeouts("hanging:1.0"); n != 1 {
+		t.Errorf("%d timeouts were counted, want 1", n)
+	}
+	if n := takeProbeTimeouts("hanging:1.0"); n != 0 {
+		t.Errorf("the timeouts were not reset, %d are left", n)
+	}
+
+	// the caller giving up is no timeout of the probe
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	viper.Set("scan.probe_timeout", time.Minute)
+	if _, _, _, err := runContainerCommand(ctx, daemon.Client(), "hanging:1.0", []string{"cat"}, []string{"/src/tool.yml"}); err == nil || errors.Is(err, ErrProbeTimeout) {
+		t.Errorf("the cancelled probe returned %v, want the cancellation", err)
+	}
+	if n := takeProbeTimeouts("hanging:1.0"); n != 0 {
+		t.Errorf("the cancelled probe counted %d timeouts", n)
+	}
+}
+
+// a gotap probe which times out counts as no gotap, and is probed again the next time
+func TestProbeGotapTimeout(t *testing.T) {
+	setImageConfig(t)
+	viper.Set("scan.probe_timeout", 50*time.Millisecond)
+	captureLog(t)
+	daemon := dockertest.New(t)
+	daemon.AddImage(hanging)
+
+	for probe := 1; probe <= 2; probe++ {
+		if path, found, err := ProbeGotap(context.Background(), daemon.Client(), "hanging:1.0"); err != nil || found {
+			t.Fatalf("probe %d found gotap at %q, %v, want no gotap", probe, path, err)
+		}
+		if n := hangingProbes(daemon); n != probe {
+			t.Errorf("gotap was probed %d times by probe %d, the timeout was cached", n, probe)
+		}
+	}
+	if running := daemon.Running(); len(running) != 0 {
+		t.Errorf("%d probe containers are left running", len(running))
+	}
+}
+
+// the scan completes despite an image whose probes hang, and reports its timeouts
+func TestReadAllToolsWithHangingProbes(t *testing.T) {
+	setImageConfig(t)
+	viper.Set("scan.probe_timeout", 50*time.Millisecond)
+	logs := captureLog(t)
+	daemon := dockertest.New(t)
+	daemon.AddImage(hanging)
+	daemon.AddImage(dockertest.Image{RepoTags: []string{"mytool:1.0"}, Labels: map[string]string{specLabel: specOf("tool")}})
+	c := &cache.Cache{}
+	c.Reset()
+	// a probe before the scan does not add to the timeouts the scan reports
+	if _, found, err := ProbeGotap(context.Background(), daemon.Client(), "hanging:1.0"); err != nil || found {
+		t.Fatalf("the probe before the scan found gotap: %v", err)
+	}
+	before := hangingProbes(daemon)
+
+	done := make(chan []string, 1)
+	go func() { done <- scanTools(t, c) }()
+	select {
+	case tools := <-done:
+		if !slices.Equal(tools, []string{"mytool:1.0::tool"}) {
+			t.Errorf("the scan found the tools %v, want only mytool:1.0::tool", tools)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the scan waits for the hanging probes")
+	}
+	if !strings.Contains(logs.String(), "probe containers of 1 images did not exit within scan.probe_timeout of 50ms") ||
+		!strings.Contains(logs.String(), fmt.Sprintf("hanging:1.0 (%d)", hangingProbes(daemon)-before)) {
+		t.Errorf("the summary of the scan does not report the timeouts: %s", logs)
+	}
+	if running := daemon.Running(); len(running) != 0 {
+		t.Errorf("%d probe containers are left running", len(running))
+	}
+}
@@ -1,45 +1,89 @@
 package toolImage
 
 import (
-	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"reflect"
+	"slices"
 	"strings"
 
 	"github.com/alexander-lindner/go-cff"
-	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/image"
 	"github.com/docker/docker/client"
-	"github.com/docker/docker/pkg/stdcopy"
 	"github.com/hydrocode-de/gorun/internal/cache"
+	"github.com/hydrocode-de/gorun/internal/dockerclient"
+	"github.com/hydrocode-de/gorun/internal/outputs"
+	"github.com/hydrocode-de/gorun/internal/specversion"
 	toolspec "github.com/hydrocode-de/tool-spec-go"
+	"github.com/spf13/viper"
 )
 
-func ReadAllTools(ctx context.Context, cache *cache.Cache, verbose bool) ([]string, error) {
-	c, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+var ErrToolNotFound = errors.New("tool not found")
+
+// the origin of the specs read from the images of the Docker host
+var localOrigin = cache.Origin{Source: cache.SourceLocal, Available: true}
+
+// readOrigin is the local origin of a spec read with the reader
+func readOrigin(reader string) cache.Origin {
+	origin := localOrigin
+	origin.Reader = reader
+	return origin
+}
+
+// ReadAllTools caches the tool-specs of all local images. Images not allowed by the policy are never probed.
+// The progress is reported by CurrentScan.
+func ReadAllTools(ctx context.Context, cache *cache.Cache, policy Policy, verbose bool) ([]string, error) {
+	beginScan()
+	tools, err := readAllTools(ctx, cache, policy, verbose)
+	finishScan(len(tools), err)
+	return tools, err
+}
+
+func readAllTools(ctx context.Context, cache *cache.Cache, policy Policy, verbose bool) ([]string, error) {
+	c, err := dockerclient.Get()
 	if err != nil {
 		return nil, err
 	}
-	defer c.Close()
 
 	summary, err := c.ImageList(ctx, image.ListOptions{})
 	if err != nil {
 		return nil, err
 	}
 
-	// Filter images with tags
+	// Filter images with tags. An image is read once under its canonical tag, the other tags are aliases.
 	var imagesWithTags []string
+	imageIDs := make(map[string]string)
+	aliases := make(map[string][]string)
 	for _, img := range summary {
-		if len(img.RepoTags) > 0 {
-			imagesWithTags = append(imagesWithTags, img.RepoTags[0])
+		var tags []string
+		for _, tag := range img.RepoTags {
+			if !policy.Allows(tag, img.RepoDigests) {
+				if verbose {
+					log.Printf("image %s is not on the image allowlist", tag)
+				}
+				continue
+			}
+			tags = append(tags, tag)
 		}
+		if len(tags) == 0 {
+			continue
+		}
+		canonical, others := canonicalTag(tags)
+		imagesWithTags = append(imagesWithTags, canonical)
+		imageIDs[canonical] = img.ID
+		aliases[canonical] = others
 	}
+	updateScan(func(status *ScanStatus) { status.Total = len(imagesWithTags) })
 
 	// Use a channel to collect results from goroutines
 	type result struct {
+		tag   string
 		tools []string
 		err   error
+		// timeouts are the probes of the image which did not exit within scan.probe_timeout
+		timeouts int
 	}
 	resultChan := make(chan result, len(imagesWithTags))
 
@@ -47,32 +91,59 @@ func ReadAllTools(ctx context.Context, cache *cache.Cache, verbose bool) ([]stri
 	for _, imgTag := range imagesWithTags {
 		go func(tag string) {
 			var tools []string
+			// the probes which timed out before, like those of an on demand load, are not of this scan
+			takeProbeTimeouts(tag)
 
-			// Check if already cached
+			// Check if already cached. Specs of the registry or the catalog are replaced by the local read.
 			image, ok := cache.GetImageSpec(tag)
+			var remote *toolspec.SpecFile
+			cached, known := cache.GetOrigin(tag)
+			if ok && known && cached.Source != localOrigin.Source {
+				remote, ok = image, false
+			}
+			// a tag rebuilt since the last scan is read again
+			rebuilt := ok && known && cached.ImageID != "" && cached.ImageID != imageIDs[tag]
+			if rebuilt {
+				ok = false
+			}
 			if !ok {
-				// Create a new Docker client for this goroutine
-				client, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
-				if err != nil {
-					resultChan <- result{nil, err}
-					return
-				}
-				defer client.Close()
-
-				spec, err := readToolSpec(ctx, client, tag)
+				spec, raw, reader, err := readToolSpec(ctx, c, tag)
 				if err != nil {
 					if verbose {
-						log.Printf("image %s does not contain a tool-spec", tag)
+						log.Printf("image %s does not contain a tool-spec: %v", tag, err)
 					}
-					resultChan <- result{tools, nil}
+					cache.SetImageAliases(tag, nil)
+					resultChan <- result{tag: tag, tools: tools, timeouts: takeProbeTimeouts(tag)}
 					return
 				}
-				citation, citationErr := readToolCitation(ctx, client, tag)
+				compat := specversion.FromSpec(raw)
+				if compat.Status != specversion.StatusSupported {
+					log.Printf("the tool-spec of image %s is %s: %s", tag, compat.Status, strings.Join(compat.Reasons, "; "))
+				}
+				citation, citationErr := readToolCitation(ctx, c, tag)
 				if citationErr != nil && verbose {
 					log.Printf("image %s does not contain a CITATION.cff", tag)
 				}
 
+				if remote != nil && !reflect.DeepEqual(remote.Tools, spec.Tools) {
+					log.Printf("the tool-spec of the local image %s differs from the one read before, the local one is used", tag)
+				}
+				if rebuilt {
+					log.Printf("the image %s was rebuilt or retagged, its tool-spec was read again", tag)
+					cache.RemoveImage(tag)
+				}
+
 				cache.SetImageSpec(tag, spec)
+				cache.SetImageCompatibility(tag, compat)
+				cache.SetImageOutputs(tag, outputs.FromSpec(raw))
+				cache.SetImageCommands(tag, CommandsFromSpec(raw))
+				cache.SetImageParamEnv(tag, ParamEnvFromSpec(raw))
+				origin := readOrigin(reader)
+				origin.ImageID = imageIDs[tag]
+				cache.SetImageOrigin(tag, origin)
+				if platform, err := readImagePlatform(ctx, c, tag); err == nil {
+					cache.SetImagePlatform(tag, platform)
+				}
 				for name, tool := range spec.Tools {
 					slug := fmt.Sprintf("%s::%s", tag, name)
 					tool.ID = slug
@@ -91,13 +162,15 @@ func ReadAllTools(ctx context.Context, cache *cache.Cache, verbose bool) ([]stri
 					tools = append(tools, slug)
 				}
 			}
+			cache.SetImageAliases(tag, aliases[tag])
 
-			resultChan <- result{tools, nil}
+			resultChan <- result{tag: tag, tools: tools, timeouts: takeProbeTimeouts(tag)}
 		}(imgTag)
 	}
 
 	// Collect results
 	var allTools []string
+	var timedOut []string
 	for i := 0; i < len(imagesWithTags); i++ {
 		select {
 		case res := <-resultChan:
@@ -105,21 +178,46 @@ func ReadAllTools(ctx context.Context, cache *cache.Cache, verbose bool) ([]stri
 				return nil, res.err
 			}
 			allTools = append(allTools, res.tools...)
+			updateScan(func(status *ScanStatus) { status.Done++ })
+			if res.timeouts > 0 {
+				timedOut = append(timedOut, fmt.Sprintf("%s (%d)", res.tag, res.timeouts))
+			}
 		case <-ctx.Done():
 			return nil, ctx.Err()
 		}
 	}
+	if len(timedOut) > 0 {
+		slices.Sort(timedOut)
+		log.Printf("probe containers of %d images did not exit within scan.probe_timeout of %s, the timed out probes count as no tool-spec or gotap: %s", len(timedOut), viper.GetDuration("scan.probe_timeout"), strings.Join(timedOut, ", "))
+	}
 
 	cache.SetInitialised(true)
 	return allTools, nil
 }
 
+// canonicalTag picks the tag an image with several tags is cached under, regardless of
+// the order the daemon lists them in. Tags other than latest are preferred.
+func canonicalTag(tags []string) (string, []string) {
+	sorted := slices.Clone(tags)
+	slices.SortFunc(sorted, func(a, b string) int {
+		aLatest, bLatest := strings.HasSuffix(a, ":latest"), strings.HasSuffix(b, ":latest")
+		if aLatest != bLatest {
+			if aLatest {
+				return 1
+			}
+			return -1
+		}
+		return strings.Compare(a, b)
+	})
+	return sorted[0], sorted[1:]
+}
+
 func LoadToolSpec(ctx context.Context, c *client.Client, toolSlug string, cache *cache.Cache) (toolspec.ToolSpec, error) {
 	chunks := strings.Split(toolSlug, "::")
 	if len(chunks) == 1 {
 		spec, ok := cache.GetToolSpec(toolSlug)
 		if !ok {
-			return toolspec.ToolSpec{}, fmt.Errorf("the tool %s was not found in the cache. Try to call like <image-name>::<tool-name>", toolSlug)
+			return toolspec.ToolSpec{}, fmt.Errorf("the tool %s was not found in the cache. Try to call like <image-name>::<tool-name>: %w", toolSlug, ErrToolNotFound)
 		}
 		return *spec, nil
 	}
@@ -129,31 +227,18 @@ func LoadToolSpec(ctx context.Context, c *client.Client, toolSlug string, cache
 		toolName := chunks[1]
 		spec, ok := cache.GetImageSpec(imageName)
 		if !ok {
-			specFile, err := readToolSpec(ctx, c, imageName)
-			if err != nil {
+			if err := cacheImageSpec(ctx, c, imageName, cache, false); err != nil {
 				return toolspec.ToolSpec{}, err
 			}
-			citation, citationErr := readToolCitation(ctx, c, imageName)
-			if citationErr != nil {
-				log.Printf("image %s does not contain a CITATION.cff", imageName)
-			}
-			cache.SetImageSpec(imageName, specFile)
-			for name, tool := range specFile.Tools {
-				cache.SetToolSpec(name, &tool)
-			}
-			tool, ok := specFile.Tools[toolName]
+			tool, ok := cache.GetToolSpec(toolSlug)
 			if !ok {
-				return toolspec.ToolSpec{}, fmt.Errorf("the tool %s was not found in the image %s", toolName, imageName)
-			}
-			tool.ID = toolSlug
-			if citationErr == nil {
-				tool.Citation = citation
+				return toolspec.ToolSpec{}, fmt.Errorf("the tool %s was not found in the image %s: %w", toolName, imageName, ErrToolNotFound)
 			}
-			return tool, nil
+			return *tool, nil
 		} else {
 			tool, ok := spec.Tools[toolName]
 			if !ok {
-				return toolspec.ToolSpec{}, fmt.Errorf("the tool %s was not found in the image %s", toolName, imageName)
+				return toolspec.ToolSpec{}, fmt.Errorf("the tool %s was not found in the image %s: %w", toolName, imageName, ErrToolNotFound)
 			}
 			tool.ID = toolSlug
 			return tool, nil
@@ -162,20 +247,111 @@ func LoadToolSpec(ctx context.Context, c *client.Client, toolSlug string, cache
 	return toolspec.ToolSpec{}, fmt.Errorf("invalid tool slug: %s", toolSlug)
 }
 
-func ReadToolSpec(ctx context.Context, imageName string) (toolspec.SpecFile, error) {
-	c, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+// RefreshToolSpec reads the spec of an image again, e.g. after its tag was rebuilt, and
+// replaces the cached one. Tools the image does not provide anymore are dropped.
+func RefreshToolSpec(ctx context.Context, c *client.Client, imageName string, cache *cache.Cache) error {
+	return cacheImageSpec(ctx, c, imageName, cache, true)
+}
+
+// cacheImageSpec reads the spec of the image and stores it with its tools. With replace,
+// the previously cached spec is dropped once the new one was read.
+func cacheImageSpec(ctx context.Context, c *client.Client, imageName string, cache *cache.Cache, replace bool) error {
+	imageID, idErr := ImageID(ctx, c, imageName)
+	// another tag of an image read already resolves to its spec
+	if !replace && idErr == nil {
+		if canonical, ok := cache.FindLocalImage(imageID); ok && canonical != imageName {
+			cache.AddImageAlias(imageName, canonical)
+			return nil
+		}
+	}
+
+	specFile, raw, reader, err := readToolSpec(ctx, c, imageName)
+	if err != nil {
+		return err
+	}
+	citation, citationErr := readToolCitation(ctx, c, imageName)
+	if citationErr != nil {
+		log.Printf("image %s does not contain a CITATION.cff", imageName)
+	}
+	platform, platformErr := readImagePlatform(ctx, c, imageName)
+	origin := readOrigin(reader)
+	if idErr == nil {
+		origin.ImageID = imageID
+	}
+
+	if replace {
+		cache.RemoveImage(imageName)
+	}
+	cache.SetImageSpec(imageName, specFile)
+	cache.SetImageCompatibility(imageName, specversion.FromSpec(raw))
+	cache.SetImageOutputs(imageName, outputs.FromSpec(raw))
+	cache.SetImageCommands(imageName, CommandsFromSpec(raw))
+	cache.SetImageParamEnv(imageName, ParamEnvFromSpec(raw))
+	cache.SetImageOrigin(imageName, origin)
+	if platformErr == nil {
+		cache.SetImagePlatform(imageName, platform)
+	}
+	for name, tool := range specFile.Tools {
+		tool.ID = fmt.Sprintf("%s::%s", imageName, name)
+		if citationErr == nil {
+			tool.Citation = citation
+		}
+		cache.SetToolSpec(tool.ID, &tool)
+	}
+	return nil
+}
+
+// ImageID returns the ID of the local image, which changes when its tag is rebuilt
+func ImageID(ctx context.Context, c *client.Client, imageName string) (string, error) {
+	info, err := c.ImageInspect(ctx, imageName)
 	if err != nil {
-		return toolspec.SpecFile{}, err
+		return "", err
 	}
-	defer c.Close()
+	return info.ID, nil
+}
 
-	return readToolSpec(ctx, c, imageName)
+func ReadToolSpec(ctx context.Context, imageName string) (toolspec.SpecFile, specversion.Compatibility, error) {
+	c, err := dockerclient.Get()
+	if err != nil {
+		return toolspec.SpecFile{}, specversion.Compatibility{}, err
+	}
+	return ReadToolSpecWith(ctx, c, imageName)
 }
 
-func readToolSpec(ctx context.Context, c *client.Client, imageName string) (toolspec.SpecFile, error) {
+// ReadToolSpecWith reads the tool-spec through the given client, e.g. of a remote daemon
+func ReadToolSpecWith(ctx context.Context, c *client.Client, imageName string) (toolspec.SpecFile, specversion.Compatibility, error) {
+	spec, raw, _, err := readToolSpec(ctx, c, imageName)
+	if err != nil {
+		return toolspec.SpecFile{}, specversion.Compatibility{}, err
+	}
+	return spec, specversion.FromSpec(raw), nil
+}
+
+// readToolSpec reads the tool-spec of the image. The raw spec is returned as well,
+// for the fields tool-spec-go does not parse, like the version and the outputs, and the
+// reader it was read with. The label of images.spec_label is tried first, as it needs no
+// container.
+func readToolSpec(ctx context.Context, c *client.Client, imageName string) (toolspec.SpecFile, []byte, string, error) {
+	labels, err := imageLabels(ctx, c, imageName)
+	if err != nil {
+		return toolspec.SpecFile{}, nil, "", err
+	}
+	label := viper.GetString("images.spec_label")
+	raw, found, err := readLabel(labels, label, imageName, "/src/tool.yml")
+	if err != nil {
+		return toolspec.SpecFile{}, nil, "", err
+	}
+	if found {
+		spec, err := toolspec.LoadToolSpec(raw)
+		if err != nil {
+			return toolspec.SpecFile{}, nil, "", fmt.Errorf("the label %s of the image %s is not a valid tool-spec: %v", label, imageName, err)
+		}
+		return spec, raw, ReaderLabel, nil
+	}
+
 	gotapPath, gotapFound, err := ProbeGotap(ctx, c, imageName)
 	if err != nil {
-		return toolspec.SpecFile{}, err
+		return toolspec.SpecFile{}, nil, "", err
 	}
 
 	if gotapFound {
@@ -191,73 +367,61 @@ func readToolSpec(ctx context.Context, c *client.Client, imageName string) (tool
 			}
 			spec, parseErr := toolspec.LoadToolSpec([]byte(stdout))
 			if parseErr == nil {
-				return spec, nil
+				return spec, []byte(stdout), ReaderGotap, nil
 			}
 		}
 	}
 
 	stdout, stderr, exitCode, err := runContainerCommand(ctx, c, imageName, []string{"cat"}, []string{"/src/tool.yml"})
 	if err != nil {
-		return toolspec.SpecFile{}, err
+		return toolspec.SpecFile{}, nil, "", err
 	}
 	if exitCode != 0 {
-		return toolspec.SpecFile{}, fmt.Errorf("the container errored while identifying the tool spec: %v", strings.TrimSpace(stderr))
+		return toolspec.SpecFile{}, nil, "", fmt.Errorf("the container errored while identifying the tool spec: %v", strings.TrimSpace(stderr))
 	}
 	if strings.TrimSpace(stdout) == "" {
-		return toolspec.SpecFile{}, fmt.Errorf("the container did not respond")
+		return toolspec.SpecFile{}, nil, "", fmt.Errorf("the container did not respond")
 	}
 
 	spec, err := toolspec.LoadToolSpec([]byte(stdout))
 	if err != nil {
-		return toolspec.SpecFile{}, fmt.Errorf("the container %s did not contain a valid tool-spec at /src/tool.yml: %v", imageName, err)
+		return toolspec.SpecFile{}, nil, "", fmt.Errorf("the container %s did not contain a valid tool-spec at /src/tool.yml: %v", imageName, err)
 	}
 
-	return spec, nil
+	return spec, []byte(stdout), ReaderFile, nil
 }
 
+// readToolCitation reads the CITATION.cff of the image, from the label of
+// images.citation_label or from /src/CITATION.cff
 func readToolCitation(ctx context.Context, c *client.Client, imageName string) (cff.Cff, error) {
-	cont, err := c.ContainerCreate(ctx, &container.Config{
-		Image:      imageName,
-		Entrypoint: []string{"cat"},
-		Cmd:        []string{"/src/CITATION.cff"},
-	}, &container.HostConfig{}, nil, nil, "")
+	labels, err := imageLabels(ctx, c, imageName)
 	if err != nil {
 		return cff.Cff{}, err
 	}
-	defer c.ContainerRemove(ctx, cont.ID, container.RemoveOptions{})
-
-	if err = c.ContainerStart(ctx, cont.ID, container.StartOptions{}); err != nil {
+	raw, found, err := readLabel(labels, viper.GetString("images.citation_label"), imageName, "/src/CITATION.cff")
+	if err != nil {
 		return cff.Cff{}, err
 	}
-
-	statusCh, errCh := c.ContainerWait(ctx, cont.ID, container.WaitConditionNotRunning)
-	select {
-	case err := <-errCh:
-		return cff.Cff{}, err
-	case <-statusCh:
+	if found {
+		citation, err := cff.Parse(string(raw))
+		if err != nil {
+			return cff.Cff{}, fmt.Errorf("Error while parsing the CITATION.cff label: %v", err)
+		}
+		return citation, nil
 	}
 
-	logReader, err := c.ContainerLogs(ctx, cont.ID, container.LogsOptions{
-		ShowStdout: true,
-		ShowStderr: true,
-	})
+	stdout, stderr, _, err := runContainerCommand(ctx, c, imageName, []string{"cat"}, []string{"/src/CITATION.cff"})
 	if err != nil {
 		return cff.Cff{}, err
 	}
-	defer logReader.Close()
-
-	stdout := new(bytes.Buffer)
-	stderr := new(bytes.Buffer)
-	stdcopy.StdCopy(stdout, stderr, logReader)
-
-	if stderr.Len() != 0 {
-		return cff.Cff{}, fmt.Errorf("Error while reading CITATION.cff: %v", stderr.String())
+	if stderr != "" {
+		return cff.Cff{}, fmt.Errorf("Error while reading CITATION.cff: %v", stderr)
 	}
-	if stdout.Len() == 0 {
+	if stdout == "" {
 		return cff.Cff{}, fmt.Errorf("No CITATION.cff found in the container %s", imageName)
 	}
 
-	citation, err := cff.Parse(stdout.String())
+	citation, err := cff.Parse(stdout)
 	if err != nil {
 		return cff.Cff{}, fmt.Errorf("Error while parsing CITATION.cff: %v", err)
 	}
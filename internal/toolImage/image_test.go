@@ -0,0 +1,258 @@
+package toolImage
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hydrocode-de/gorun/internal/cache"
+	"github.com/hydrocode-de/gorun/internal/dockertest"
+	"github.com/spf13/viper"
+)
+
+const specLabel = "org.toolspec.spec"
+
+func specOf(tool string) string {
+	return "tools:\n  " + tool + ":\n    title: " + tool + "\n    description: A test tool\n"
+}
+
+func setImageConfig(t *testing.T) {
+	t.Helper()
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+	viper.Set("images.spec_label", specLabel)
+	viper.Set("images.max_label_bytes", 1024)
+	viper.Set("gotap.probe_names", []string{"gotap"})
+	viper.Set("scan.probe_timeout", 5*time.Second)
+}
+
+func TestReadToolSpecFallbacks(t *testing.T) {
+	tests := []struct {
+		name       string
+		image      dockertest.Image
+		wantTool   string
+		wantReader string
+		// wantErr is part of the error, if reading the spec fails
+		wantErr string
+	}{
+		{
+			name:       "plain label",
+			image:      dockertest.Image{Labels: map[string]string{specLabel: specOf("label")}},
+			wantTool:   "label",
+			wantReader: ReaderLabel,
+		},
+		{
+			name:       "base64 label",
+			image:      dockertest.Image{Labels: map[string]string{specLabel: base64.StdEncoding.EncodeToString([]byte(specOf("encoded")))}},
+			wantTool:   "encoded",
+			wantReader: ReaderLabel,
+		},
+		{
+			name: "label wins over gotap and the file",
+			image: dockertest.Image{
+				Labels:   map[string]string{specLabel: specOf("label")},
+				Files:    map[string]string{"/src/tool.yml": specOf("file")},
+				Commands: map[string]dockertest.Result{"gotap -v": {Stdout: "0.4.0"}},
+			},
+			wantTool:   "label",
+			wantReader: ReaderLabel,
+		},
+		{
+			name:    "oversized label",
+			image:   dockertest.Image{Labels: map[string]string{specLabel: specOf(strings.Repeat("x", 2048))}},
+			wantErr: "images.max_label_bytes",
+		},
+		{
+			name:    "invalid label",
+			image:   dockertest.Image{Labels: map[string]string{specLabel: "tools: [}"}},
+			wantErr: "is not a valid tool-spec",
+		},
+		{
+			name: "gotap metadata",
+			image: dockertest.Image{Commands: map[string]dockertest.Result{
+				"gotap -v": {Stdout: "0.4.0"},
+				"gotap metadata --spec-file /src/tool.yml": {Stdout: specOf("metadata")},
+			}},
+			wantTool:   "metadata",
+			wantReader: ReaderGotap,
+		},
+		{
+			name: "gotap parse with flag",
+			image: dockertest.Image{Commands: map[string]dockertest.Result{
+				"gotap -v": {Stdout: "0.4.0"},
+				"gotap metadata --spec-file /src/tool.yml": {ExitCode: 2, Stderr: "unknown command metadata"},
+				"gotap parse --spec-file /src/tool.yml":    {Stdout: specOf("parsed")},
+			}},
+			wantTool:   "parsed",
+			wantReader: ReaderGotap,
+		},
+		{
+			name: "gotap parse positional",
+			image: dockertest.Image{Commands: map[string]dockertest.Result{
+				"gotap -v":                  {Stdout: "0.3.0"},
+				"gotap parse /src/tool.yml": {Stdout: specOf("positional")},
+			}},
+			wantTool:   "positional",
+			wantReader: ReaderGotap,
+		},
+		{
+			name: "gotap without a spec falls back to the file",
+			image: dockertest.Image{
+				Commands: map[string]dockertest.Result{"gotap -v": {Stdout: "0.4.0"}},
+				Files:    map[string]string{"/src/tool.yml": specOf("file")},
+			},
+			wantTool:   "file",
+			wantReader: ReaderFile,
+		},
+		{
+			name:       "file",
+			image:      dockertest.Image{Files: map[string]string{"/src/tool.yml": specOf("file")}},
+			wantTool:   "file",
+			wantReader: ReaderFile,
+		},
+		{
+			name:    "no spec",
+			image:   dockertest.Image{},
+			wantErr: "errored while identifying the tool spec",
+		},
+		{
+			name:    "empty file",
+			image:   dockertest.Image{Files: map[string]string{"/src/tool.yml": "  \n"}},
+			wantErr: "did not respond",
+		},
+		{
+			name:    "invalid file",
+			image:   dockertest.Image{Files: map[string]string{"/src/tool.yml": "tools: [}"}},
+			wantErr: "did not contain a valid tool-spec",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setImageConfig(t)
+			daemon := dockertest.New(t)
+			tt.image.RepoTags = []string{"spec-test:latest"}
+			daemon.AddImage(tt.image)
+
+			spec, raw, reader, err := readToolSpec(context.Background(), daemon.Client(), "spec-test:latest")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("readToolSpec returned %v, want an error with %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("readToolSpec failed: %v", err)
+			}
+			if reader != tt.wantReader {
+				t.Errorf("the spec was read with %s, want %s", reader, tt.wantReader)
+			}
+			if _, ok := spec.Tools[tt.wantTool]; !ok {
+				t.Errorf("the spec has no tool %s: %s", tt.wantTool, raw)
+			}
+		})
+	}
+}
+
+func TestReadToolSpecMissingImage(t *testing.T) {
+	setImageConfig(t)
+	daemon := dockertest.New(t)
+	if _, _, _, err := readToolSpec(context.Background(), daemon.Client(), "missing:latest"); err == nil {
+		t.Fatal("the spec of a missing image was read")
+	}
+	if n := daemon.Calls("create"); n != 0 {
+		t.Errorf("%d containers were created for a missing image", n)
+	}
+}
+
+// scanTools reads all images like the periodic scan and returns the sorted slugs
+func scanTools(t *testing.T, c *cache.Cache) []string {
+	t.Helper()
+	tools, err := ReadAllTools(context.Background(), c, Policy{}, false)
+	if err != nil {
+		t.Fatalf("ReadAllTools failed: %v", err)
+	}
+	slices.Sort(tools)
+	return tools
+}
+
+func TestReadAllToolsWithSeveralTags(t *testing.T) {
+	// the daemon lists the tags in either order, the canonical tag is the same
+	for _, tags := range [][]string{{"mytool:1.2", "mytool:latest"}, {"mytool:latest", "mytool:1.2"}} {
+		setImageConfig(t)
+		daemon := dockertest.New(t)
+		daemon.AddImage(dockertest.Image{RepoTags: tags, Labels: map[string]string{specLabel: specOf("tool")}})
+		c := &cache.Cache{}
+		c.Reset()
+
+		if tools := scanTools(t, c); !slices.Equal(tools, []string{"mytool:1.2::tool"}) {
+			t.Errorf("the image tagged %v has the tools %v, want only mytool:1.2::tool", tags, tools)
+		}
+		if aliases := c.GetImageAliases("mytool:1.2"); !slices.Equal(aliases, []string{"mytool:latest"}) {
+			t.Errorf("the aliases of mytool:1.2 are %v, want mytool:latest", aliases)
+		}
+		if _, ok := c.GetToolSpec("mytool:latest::tool"); !ok {
+			t.Error("the alias mytool:latest::tool does not resolve")
+		}
+	}
+}
+
+func TestReadAllToolsAfterRetagging(t *testing.T) {
+	setImageConfig(t)
+	daemon := dockertest.New(t)
+	old := daemon.AddImage(dockertest.Image{RepoTags: []string{"mytool:1.2", "mytool:latest"}, Labels: map[string]string{specLabel: specOf("old")}})
+	c := &cache.Cache{}
+	c.Reset()
+	scanTools(t, c)
+
+	// a new build takes over latest and the old image gets another tag
+	fresh := daemon.AddImage(dockertest.Image{Labels: map[string]string{specLabel: specOf("new")}})
+	daemon.Tag(fresh.ID, "mytool:latest")
+	daemon.Tag(old.ID, "mytool:1.1")
+
+	want := []string{"mytool:1.1::old", "mytool:latest::new"}
+	if tools := scanTools(t, c); !slices.Equal(tools, want) {
+		t.Errorf("after the retagging the tools are %v, want %v", tools, want)
+	}
+	if aliases := c.GetImageAliases("mytool:1.1"); !slices.Equal(aliases, []string{"mytool:1.2"}) {
+		t.Errorf("the aliases of the old image are %v, want mytool:1.2", aliases)
+	}
+	if aliases := c.GetImageAliases("mytool:latest"); len(aliases) != 0 {
+		t.Errorf("the new image has the aliases %v", aliases)
+	}
+	// latest resolves to the new build, the old tags keep the old spec
+	if _, ok := c.GetToolSpec("mytool:latest::new"); !ok {
+		t.Error("mytool:latest does not resolve to the new build")
+	}
+	if _, ok := c.GetToolSpec("mytool:latest::old"); ok {
+		t.Error("mytool:latest still resolves to the old build")
+	}
+	if _, ok := c.GetToolSpec("mytool:1.2::old"); !ok {
+		t.Error("the alias mytool:1.2 of the old build does not resolve")
+	}
+}
+
+func TestLoadToolSpecNotFound(t *testing.T) {
+	setImageConfig(t)
+	daemon := dockertest.New(t)
+	daemon.AddImage(dockertest.Image{RepoTags: []string{"spec-test:latest"}, Labels: map[string]string{specLabel: specOf("echo")}})
+	specCache := &cache.Cache{}
+	specCache.Reset()
+
+	for _, slug := range []string{"echo", "spec-test:latest::ecoh"} {
+		if _, err := LoadToolSpec(context.Background(), daemon.Client(), slug, specCache); !errors.Is(err, ErrToolNotFound) {
+			t.Errorf("LoadToolSpec(%s) returned %v, want ErrToolNotFound", slug, err)
+		}
+	}
+	// the image is cached now, a typo is not found either
+	if _, err := LoadToolSpec(context.Background(), daemon.Client(), "spec-test:latest::ecoh", specCache); !errors.Is(err, ErrToolNotFound) {
+		t.Errorf("LoadToolSpec of the cached image returned %v, want ErrToolNotFound", err)
+	}
+	// a missing image is an error of the daemon, not a missing tool
+	if _, err := LoadToolSpec(context.Background(), daemon.Client(), "missing:latest::echo", specCache); err == nil || errors.Is(err, ErrToolNotFound) {
+		t.Errorf("LoadToolSpec of a missing image returned %v", err)
+	}
+}
@@ -0,0 +1,49 @@
+package toolImage
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/docker/docker/client"
+	"github.com/spf13/viper"
+)
+
+// the readers a local spec is read with, recorded in the origin of the cached spec
+const (
+	ReaderLabel = "label"
+	ReaderGotap = "gotap"
+	ReaderFile  = "file"
+)
+
+// imageLabels returns the labels of the image, without starting a container
+func imageLabels(ctx context.Context, c *client.Client, imageName string) (map[string]string, error) {
+	info, err := c.ImageInspect(ctx, imageName)
+	if err != nil {
+		return nil, err
+	}
+	if info.Config == nil {
+		return nil, nil
+	}
+	return info.Config.Labels, nil
+}
+
+// readLabel returns the content of the label, which is plain text or base64. Labels
+// larger than images.max_label_bytes are rejected, the file should be shipped in /src instead.
+func readLabel(labels map[string]string, label string, imageName string, file string) ([]byte, bool, error) {
+	if label == "" {
+		return nil, false, nil
+	}
+	value, ok := labels[label]
+	if !ok || strings.TrimSpace(value) == "" {
+		return nil, false, nil
+	}
+	if limit := viper.GetInt("images.max_label_bytes"); limit > 0 && len(value) > limit {
+		return nil, false, fmt.Errorf("the label %s of the image %s has %d bytes, more than the %d bytes of images.max_label_bytes. Ship the file at %s instead", label, imageName, len(value), limit, file)
+	}
+	if decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value)); err == nil {
+		return decoded, true, nil
+	}
+	return []byte(value), true, nil
+}
@@ -0,0 +1,59 @@
+package toolImage
+
+import (
+	"context"
+	"strings"
+
+	"github.com/docker/docker/client"
+	"github.com/hydrocode-de/gorun/internal/dockerclient"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// readImagePlatform returns the platform of a local image as os/arch[/variant]
+func readImagePlatform(ctx context.Context, c *client.Client, imageName string) (string, error) {
+	info, err := c.ImageInspect(ctx, imageName)
+	if err != nil {
+		return "", err
+	}
+	platform := info.Os + "/" + info.Architecture
+	if info.Variant != "" {
+		platform += "/" + info.Variant
+	}
+	return platform, nil
+}
+
+// ReadDaemonPlatform returns the native platform of the Docker daemon as os/arch
+func ReadDaemonPlatform(ctx context.Context) (string, error) {
+	c, err := dockerclient.Get()
+	if err != nil {
+		return "", err
+	}
+
+	version, err := c.ServerVersion(ctx)
+	if err != nil {
+		return "", err
+	}
+	return version.Os + "/" + version.Arch, nil
+}
+
+// PlatformMatches compares the os and architecture of two platforms, the variant is ignored
+func PlatformMatches(imagePlatform string, daemonPlatform string) bool {
+	image, daemon := ParsePlatform(imagePlatform), ParsePlatform(daemonPlatform)
+	if image == nil || daemon == nil {
+		return true
+	}
+	return image.OS == daemon.OS && image.Architecture == daemon.Architecture
+}
+
+// ParsePlatform reads a platform like linux/arm64/v8. An empty platform returns nil
+func ParsePlatform(platform string) *ocispec.Platform {
+	parts := strings.Split(platform, "/")
+	if platform == "" || len(parts) < 2 {
+		return nil
+	}
+	parsed := &ocispec.Platform{OS: parts[0], Architecture: parts[1]}
+	if len(parts) > 2 {
+		parsed.Variant = parts[2]
+	}
+	return parsed
+}
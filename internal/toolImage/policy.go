@@ -0,0 +1,141 @@
+package toolImage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/hydrocode-de/gorun/internal/db"
+	"github.com/hydrocode-de/gorun/internal/dockerclient"
+	"github.com/spf13/viper"
+)
+
+var ErrPolicyViolation = errors.New("image policy violation")
+
+// Policy restricts the tool images gorun probes and runs. An empty
+// allowlist allows all images.
+type Policy struct {
+	// Allowlist holds glob patterns over repository names like ghcr.io/org/*,
+	// digests like sha256:abc... or both, like ghcr.io/org/tool@sha256:abc...
+	Allowlist []string
+	// RequireDigest refuses runs of images referenced by a mutable tag
+	RequireDigest bool
+}
+
+// LoadPolicy merges the images.allowlist of the config with the patterns stored in the database
+func LoadPolicy(ctx context.Context, DB *db.Queries) (Policy, error) {
+	policy := Policy{
+		Allowlist:     viper.GetStringSlice("images.allowlist"),
+		RequireDigest: viper.GetBool("images.require_digest"),
+	}
+	stored, err := DB.GetImagePolicy(ctx)
+	if err != nil {
+		return Policy{}, err
+	}
+	for _, entry := range stored {
+		policy.Allowlist = append(policy.Allowlist, entry.Pattern)
+	}
+	return policy, nil
+}
+
+// imageRepository strips the tag and the digest from an image reference
+func imageRepository(ref string) string {
+	if at := strings.Index(ref, "@"); at >= 0 {
+		ref = ref[:at]
+	}
+	// a colon after the last slash separates the tag, before it the registry port
+	if colon := strings.LastIndex(ref, ":"); colon > strings.LastIndex(ref, "/") {
+		ref = ref[:colon]
+	}
+	return ref
+}
+
+// referenceDigest returns the digest an image reference is pinned to, if any
+func referenceDigest(ref string) string {
+	_, digest, _ := strings.Cut(ref, "@")
+	return digest
+}
+
+func isDigestPattern(pattern string) bool {
+	return strings.HasPrefix(pattern, "sha256:") || strings.Contains(pattern, "@sha256:")
+}
+
+// Allows checks the image against the allowlist. digests holds the repo digests
+// of the local image, which are matched against digest patterns.
+func (p Policy) Allows(ref string, digests []string) bool {
+	if len(p.Allowlist) == 0 {
+		return true
+	}
+
+	repo := imageRepository(ref)
+	candidates := make([]string, 0, len(digests)+1)
+	if digest := referenceDigest(ref); digest != "" {
+		candidates = append(candidates, digest)
+	}
+	// repo digests look like ghcr.io/org/tool@sha256:abc...
+	for _, digest := range digests {
+		candidates = append(candidates, referenceDigest(digest))
+	}
+
+	for _, pattern := range p.Allowlist {
+		if !isDigestPattern(pattern) {
+			if match, _ := path.Match(pattern, repo); match {
+				return true
+			}
+			if match, _ := path.Match(pattern, ref); match {
+				return true
+			}
+			continue
+		}
+
+		patternRepo, patternDigest, pinned := strings.Cut(pattern, "@")
+		if !pinned {
+			patternRepo, patternDigest = "", pattern
+		}
+		if patternRepo != "" {
+			if match, _ := path.Match(patternRepo, repo); !match {
+				continue
+			}
+		}
+		for _, digest := range candidates {
+			if digest == patternDigest {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Check returns an error wrapping ErrPolicyViolation if the image may not be run
+func (p Policy) Check(ctx context.Context, ref string) error {
+	if p.RequireDigest && referenceDigest(ref) == "" {
+		return fmt.Errorf("the image %s has to be referenced by digest (image@sha256:...) on this server: %w", ref, ErrPolicyViolation)
+	}
+
+	var digests []string
+	for _, pattern := range p.Allowlist {
+		if isDigestPattern(pattern) {
+			digests = readRepoDigests(ctx, ref)
+			break
+		}
+	}
+	if !p.Allows(ref, digests) {
+		return fmt.Errorf("the image %s is not on the image allowlist of this server: %w", ref, ErrPolicyViolation)
+	}
+	return nil
+}
+
+func readRepoDigests(ctx context.Context, ref string) []string {
+	c, err := dockerclient.Get()
+	if err != nil {
+		return nil
+	}
+
+	info, err := c.ImageInspect(ctx, ref)
+	if err != nil {
+		return nil
+	}
+	return info.RepoDigests
+}
@@ -0,0 +1,44 @@
+package toolImage
+
+import (
+	"context"
+	"io"
+	"log"
+
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/jsonmessage"
+	"github.com/hydrocode-de/gorun/internal/registry"
+)
+
+// PullIfMissing pulls the image, unless the Docker host has it already. It reports if
+// the image was pulled. The logins of docker login are used for private registries.
+func PullIfMissing(ctx context.Context, c *client.Client, imageName string, platform string) (bool, error) {
+	_, err := c.ImageInspect(ctx, imageName)
+	if err == nil {
+		return false, nil
+	}
+	if !client.IsErrNotFound(err) {
+		return false, err
+	}
+
+	ref, err := registry.ParseReference(imageName)
+	if err != nil {
+		return false, err
+	}
+	auth, err := registry.PullAuth(ref)
+	if err != nil {
+		return false, err
+	}
+	log.Printf("the image %s is not on the Docker host, pulling it", imageName)
+	resp, err := c.ImagePull(ctx, imageName, image.PullOptions{RegistryAuth: auth, Platform: platform})
+	if err != nil {
+		return false, err
+	}
+	defer resp.Close()
+	// the pull reports its errors in the stream of messages
+	if err := jsonmessage.DisplayJSONMessagesStream(resp, io.Discard, 0, false, nil); err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,162 @@
+package toolImage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/alexander-lindner/go-cff"
+	"github.com/hydrocode-de/gorun/internal/cache"
+	"github.com/hydrocode-de/gorun/internal/dockerclient"
+	"github.com/hydrocode-de/gorun/internal/outputs"
+	"github.com/hydrocode-de/gorun/internal/registry"
+	"github.com/hydrocode-de/gorun/internal/specversion"
+	toolspec "github.com/hydrocode-de/tool-spec-go"
+)
+
+// registryFiles are read from the layers, the tool-spec is required
+var registryFiles = []string{"/src/tool.yml", "/src/CITATION.cff"}
+
+// registryImage is what was read from the layers of one manifest
+type registryImage struct {
+	raw      []byte
+	citation []byte
+	platform string
+}
+
+// the files read from the registries, by manifest digest. A digest never changes its
+// content, so a moved tag is the only reason to download layers again.
+var registryImages = struct {
+	sync.Mutex
+	byDigest map[string]registryImage
+}{byDigest: make(map[string]registryImage)}
+
+// DiscoverRegistryTools caches the tool-specs of the repository without pulling the images.
+// Without a tag, only latest is read, unless allTags lists the tags of the repository.
+// Specs read from the local image are not replaced.
+func DiscoverRegistryTools(ctx context.Context, repository string, allTags bool, specCache *cache.Cache, policy Policy) ([]string, error) {
+	ref, err := registry.ParseReference(repository)
+	if err != nil {
+		return nil, err
+	}
+	c := registry.NewClient(ref)
+
+	refs := []registry.Reference{ref}
+	if allTags {
+		tags, err := c.Tags(ctx, ref)
+		if err != nil {
+			return nil, err
+		}
+		refs = refs[:0]
+		for _, tag := range tags {
+			tagged, err := ref.WithTag(tag)
+			if err != nil {
+				return nil, err
+			}
+			refs = append(refs, tagged)
+		}
+	}
+
+	tools := make([]string, 0)
+	var errs []error
+	for _, ref := range refs {
+		found, err := discoverRegistryImage(ctx, c, ref, specCache, policy, cache.SourceRegistry)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		tools = append(tools, found...)
+	}
+	return tools, errors.Join(errs...)
+}
+
+func discoverRegistryImage(ctx context.Context, c *registry.Client, ref registry.Reference, specCache *cache.Cache, policy Policy, source string) ([]string, error) {
+	image, err := c.Image(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	digests := []string{ref.Name + "@" + image.Digest}
+	if !policy.Allows(ref.Name, digests) {
+		return nil, fmt.Errorf("the image %s is not on the image allowlist: %w", ref.Name, ErrPolicyViolation)
+	}
+	if origin, ok := specCache.GetOrigin(ref.Name); ok && origin.Source == cache.SourceLocal {
+		spec, _ := specCache.GetImageSpec(ref.Name)
+		return toolSlugs(ref.Name, *spec), nil
+	}
+
+	registryImages.Lock()
+	read, ok := registryImages.byDigest[image.Digest]
+	registryImages.Unlock()
+	if !ok {
+		files, err := c.ReadFiles(ctx, ref, image, registryFiles)
+		if err != nil {
+			return nil, err
+		}
+		read = registryImage{raw: files["/src/tool.yml"], citation: files["/src/CITATION.cff"], platform: image.Platform}
+		registryImages.Lock()
+		registryImages.byDigest[image.Digest] = read
+		registryImages.Unlock()
+	}
+
+	return cacheRemoteSpec(ctx, specCache, ref.Name, read, source)
+}
+
+// imageAvailable reports if the Docker host has the image
+func imageAvailable(ctx context.Context, imageName string) bool {
+	c, err := dockerclient.Get()
+	if err != nil {
+		return false
+	}
+	_, err = c.ImageInspect(ctx, imageName)
+	return err == nil
+}
+
+// cacheRemoteSpec caches the tool-spec which was not read from a local image, along with
+// its source and whether the Docker host has the image anyway
+func cacheRemoteSpec(ctx context.Context, specCache *cache.Cache, imageName string, read registryImage, source string) ([]string, error) {
+	spec, err := toolspec.LoadToolSpec(read.raw)
+	if err != nil {
+		return nil, fmt.Errorf("the image %s did not contain a valid tool-spec at /src/tool.yml: %v", imageName, err)
+	}
+	compat := specversion.FromSpec(read.raw)
+	if compat.Status != specversion.StatusSupported {
+		log.Printf("the tool-spec of image %s is %s: %s", imageName, compat.Status, strings.Join(compat.Reasons, "; "))
+	}
+	var citation *cff.Cff
+	if len(read.citation) > 0 {
+		if parsed, err := cff.Parse(string(read.citation)); err == nil {
+			citation = &parsed
+		} else {
+			log.Printf("Error while parsing CITATION.cff of %s: %v", imageName, err)
+		}
+	}
+
+	specCache.SetImageSpec(imageName, spec)
+	specCache.SetImageCompatibility(imageName, compat)
+	specCache.SetImageOutputs(imageName, outputs.FromSpec(read.raw))
+	specCache.SetImageCommands(imageName, CommandsFromSpec(read.raw))
+	specCache.SetImageParamEnv(imageName, ParamEnvFromSpec(read.raw))
+	specCache.SetImageOrigin(imageName, cache.Origin{Source: source, Available: imageAvailable(ctx, imageName)})
+	if read.platform != "" {
+		specCache.SetImagePlatform(imageName, read.platform)
+	}
+	for name, tool := range spec.Tools {
+		tool.ID = fmt.Sprintf("%s::%s", imageName, name)
+		if citation != nil {
+			tool.Citation = *citation
+		}
+		specCache.SetToolSpec(tool.ID, &tool)
+	}
+	return toolSlugs(imageName, spec), nil
+}
+
+func toolSlugs(imageName string, spec toolspec.SpecFile) []string {
+	slugs := make([]string, 0, len(spec.Tools))
+	for name := range spec.Tools {
+		slugs = append(slugs, fmt.Sprintf("%s::%s", imageName, name))
+	}
+	return slugs
+}
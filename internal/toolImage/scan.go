@@ -0,0 +1,162 @@
+package toolImage
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/hydrocode-de/gorun/internal/cache"
+	"github.com/hydrocode-de/gorun/internal/db"
+	"github.com/spf13/viper"
+)
+
+// ScanResult summarizes the vulnerabilities found in an image
+type ScanResult struct {
+	Scanner  string
+	Critical int64
+	High     int64
+}
+
+// Scanner reports the vulnerabilities of a local image
+type Scanner interface {
+	Scan(ctx context.Context, imageName string) (ScanResult, error)
+}
+
+// TrivyScanner shells out to the trivy binary. If Server is set, the
+// vulnerability database of a trivy server is used.
+type TrivyScanner struct {
+	Binary string
+	Server string
+}
+
+func (t TrivyScanner) Scan(ctx context.Context, imageName string) (ScanResult, error) {
+	args := []string{"image", "--quiet", "--format", "json", "--severity", "CRITICAL,HIGH"}
+	if t.Server != "" {
+		args = append(args, "--server", t.Server)
+	}
+	args = append(args, imageName)
+
+	stdout := new(bytes.Buffer)
+	stderr := new(bytes.Buffer)
+	cmd := exec.CommandContext(ctx, t.Binary, args...)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	if err := cmd.Run(); err != nil {
+		return ScanResult{}, fmt.Errorf("trivy failed to scan %s: %v: %s", imageName, err, strings.TrimSpace(stderr.String()))
+	}
+
+	var report struct {
+		Results []struct {
+			Vulnerabilities []struct {
+				Severity string `json:"Severity"`
+			} `json:"Vulnerabilities"`
+		} `json:"Results"`
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &report); err != nil {
+		return ScanResult{}, fmt.Errorf("the trivy report of %s is invalid: %v", imageName, err)
+	}
+
+	result := ScanResult{Scanner: "trivy"}
+	for _, target := range report.Results {
+		for _, vulnerability := range target.Vulnerabilities {
+			switch vulnerability.Severity {
+			case "CRITICAL":
+				result.Critical++
+			case "HIGH":
+				result.High++
+			}
+		}
+	}
+	return result, nil
+}
+
+// ScannerFromConfig returns the configured scanner, or nil if scanning is disabled
+func ScannerFromConfig() Scanner {
+	binary := viper.GetString("scan.trivy_path")
+	if binary == "" {
+		return nil
+	}
+	return TrivyScanner{Binary: binary, Server: viper.GetString("scan.trivy_server")}
+}
+
+// ScanImage scans the image and stores the summary in the cache and the database
+func ScanImage(ctx context.Context, DB *db.Queries, cache *cache.Cache, scanner Scanner, imageName string) (db.ImageScan, error) {
+	result, err := scanner.Scan(ctx, imageName)
+	if err != nil {
+		return db.ImageScan{}, err
+	}
+
+	scan, err := DB.SetImageScan(ctx, db.SetImageScanParams{
+		Image:     imageName,
+		Scanner:   result.Scanner,
+		Critical:  result.Critical,
+		High:      result.High,
+		ScannedAt: time.Now().UTC(),
+	})
+	if err != nil {
+		return db.ImageScan{}, err
+	}
+	cache.SetImageScan(imageName, scan)
+	return scan, nil
+}
+
+// GetImageScan returns the last scan of an image or tool slug, from the cache or the database
+func GetImageScan(ctx context.Context, DB *db.Queries, cache *cache.Cache, key string) (db.ImageScan, bool) {
+	if scan, ok := cache.GetScan(key); ok {
+		return scan, true
+	}
+	imageName, _, _ := strings.Cut(key, "::")
+	scan, err := DB.GetImageScan(ctx, imageName)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("failed to read the scan of image %s: %v", imageName, err)
+		}
+		return db.ImageScan{}, false
+	}
+	cache.SetImageScan(imageName, scan)
+	return scan, true
+}
+
+// ScanUnscannedImages scans all cached images, which were not scanned before
+func ScanUnscannedImages(ctx context.Context, DB *db.Queries, cache *cache.Cache, scanner Scanner) {
+	for _, imageName := range cache.ListImageNames() {
+		if _, ok := GetImageScan(ctx, DB, cache, imageName); ok {
+			continue
+		}
+		scan, err := ScanImage(ctx, DB, cache, scanner, imageName)
+		if err != nil {
+			log.Printf("failed to scan image %s: %v", imageName, err)
+			continue
+		}
+		log.Printf("scanned image %s: %d critical, %d high vulnerabilities", imageName, scan.Critical, scan.High)
+	}
+}
+
+// CheckScan returns an error wrapping ErrPolicyViolation if the last scan of the
+// image exceeds scan.block_severity. Images which were not scanned are not blocked.
+func CheckScan(ctx context.Context, DB *db.Queries, cache *cache.Cache, imageName string) error {
+	severity := strings.ToLower(viper.GetString("scan.block_severity"))
+	if severity == "" {
+		return nil
+	}
+	scan, ok := GetImageScan(ctx, DB, cache, imageName)
+	if !ok {
+		return nil
+	}
+
+	blocked := scan.Critical > 0
+	if severity == "high" {
+		blocked = blocked || scan.High > 0
+	}
+	if blocked {
+		return fmt.Errorf("the image %s has %d critical and %d high vulnerabilities, runs of images with %s vulnerabilities are blocked: %w", imageName, scan.Critical, scan.High, severity, ErrPolicyViolation)
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package toolImage
+
+import (
+	"sync"
+	"time"
+)
+
+// the states of the scan of the local images
+const (
+	ScanPending    = "pending"
+	ScanInProgress = "in_progress"
+	ScanComplete   = "complete"
+	ScanFailed     = "failed"
+)
+
+// ScanStatus is the progress of the last scan of the local images by ReadAllTools
+type ScanStatus struct {
+	State string `json:"state"`
+	// Total is the number of images to read, Done the ones read so far
+	Total      int        `json:"total"`
+	Done       int        `json:"done"`
+	Tools      int        `json:"tools"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	Error      string     `json:"error,omitempty"`
+}
+
+var (
+	scanStatusMu sync.Mutex
+	scanStatus   = ScanStatus{State: ScanPending}
+)
+
+// CurrentScan returns the progress of the running or the last scan of the local images
+func CurrentScan() ScanStatus {
+	scanStatusMu.Lock()
+	defer scanStatusMu.Unlock()
+	return scanStatus
+}
+
+func updateScan(update func(status *ScanStatus)) {
+	scanStatusMu.Lock()
+	defer scanStatusMu.Unlock()
+	update(&scanStatus)
+}
+
+func beginScan() {
+	now := time.Now().UTC()
+	updateScan(func(status *ScanStatus) {
+		*status = ScanStatus{State: ScanInProgress, StartedAt: &now}
+	})
+}
+
+func finishScan(tools int, err error) {
+	now := time.Now().UTC()
+	updateScan(func(status *ScanStatus) {
+		status.FinishedAt = &now
+		status.Tools = tools
+		if err != nil {
+			status.State, status.Error = ScanFailed, err.Error()
+			return
+		}
+		status.State = ScanComplete
+	})
+}
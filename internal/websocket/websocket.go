@@ -0,0 +1,268 @@
+// Package websocket implements the server side of RFC 6455, as far as gorun needs it:
+// text messages from and to the client, ping/pong and the closing handshake.
+package websocket
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// the opcodes of the frames
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xA
+)
+
+// close codes sent to the client
+const (
+	CloseNormal        = 1000
+	CloseGoingAway     = 1001
+	CloseProtocolError = 1002
+	CloseTooLarge      = 1009
+)
+
+// the GUID the handshake key is hashed with
+const acceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// ErrClosed is returned by ReadMessage once the client closed the connection
+var ErrClosed = errors.New("the websocket was closed")
+
+// Conn is an upgraded connection. ReadMessage must be called from a single goroutine,
+// the write methods may be called concurrently.
+type Conn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	// MaxMessageSize caps the messages read from the client
+	MaxMessageSize int64
+	// OnPong is called for every pong received, from within ReadMessage
+	OnPong func()
+
+	writeMu sync.Mutex
+	closed  bool
+}
+
+func headerContains(h http.Header, name string, token string) bool {
+	for _, value := range h.Values(name) {
+		for _, part := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// IsUpgrade tells if the request asks for a websocket
+func IsUpgrade(r *http.Request) bool {
+	return headerContains(r.Header, "Connection", "upgrade") && headerContains(r.Header, "Upgrade", "websocket")
+}
+
+// Upgrade completes the handshake and takes over the connection of the request.
+// If it fails, an error response was already written.
+func Upgrade(w http.ResponseWriter, r *http.Request) (*Conn, error) {
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if r.Method != http.MethodGet || !IsUpgrade(r) || key == "" {
+		http.Error(w, "a websocket upgrade is required", http.StatusUpgradeRequired)
+		return nil, fmt.Errorf("not a websocket upgrade")
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "unsupported websocket version", http.StatusUpgradeRequired)
+		return nil, fmt.Errorf("unsupported websocket version %q", r.Header.Get("Sec-WebSocket-Version"))
+	}
+
+	conn, buf, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		http.Error(w, "the connection cannot be upgraded", http.StatusInternalServerError)
+		return nil, err
+	}
+	// the timeouts of the HTTP server do not apply to the websocket
+	conn.SetDeadline(time.Time{})
+
+	hash := sha1.Sum([]byte(key + acceptGUID))
+	response := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + base64.StdEncoding.EncodeToString(hash[:]) + "\r\n\r\n"
+	if _, err := conn.Write([]byte(response)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &Conn{conn: conn, reader: buf.Reader, MaxMessageSize: 64 * 1024}, nil
+}
+
+// SetReadDeadline fails ReadMessage if nothing is received until t
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	return c.conn.SetReadDeadline(t)
+}
+
+type frame struct {
+	fin     bool
+	opcode  byte
+	payload []byte
+}
+
+func (c *Conn) readFrame() (frame, error) {
+	var head [2]byte
+	if _, err := io.ReadFull(c.reader, head[:]); err != nil {
+		return frame{}, err
+	}
+	f := frame{fin: head[0]&0x80 != 0, opcode: head[0] & 0x0F}
+	if head[0]&0x70 != 0 {
+		return frame{}, c.fail(CloseProtocolError, "reserved bits are set")
+	}
+	if head[1]&0x80 == 0 {
+		return frame{}, c.fail(CloseProtocolError, "frames of the client have to be masked")
+	}
+
+	length := int64(head[1] & 0x7F)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.reader, ext[:]); err != nil {
+			return frame{}, err
+		}
+		length = int64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.reader, ext[:]); err != nil {
+			return frame{}, err
+		}
+		length = int64(binary.BigEndian.Uint64(ext[:]) & (1<<63 - 1))
+	}
+	if f.opcode >= opClose && (length > 125 || !f.fin) {
+		return frame{}, c.fail(CloseProtocolError, "invalid control frame")
+	}
+	if length > c.MaxMessageSize {
+		return frame{}, c.fail(CloseTooLarge, "the message is too large")
+	}
+
+	var mask [4]byte
+	if _, err := io.ReadFull(c.reader, mask[:]); err != nil {
+		return frame{}, err
+	}
+	f.payload = make([]byte, length)
+	if _, err := io.ReadFull(c.reader, f.payload); err != nil {
+		return frame{}, err
+	}
+	for i := range f.payload {
+		f.payload[i] ^= mask[i%4]
+	}
+	return f, nil
+}
+
+// ReadMessage returns the next text or binary message of the client. Pings are
+// answered and the closing handshake is completed, which returns ErrClosed.
+func (c *Conn) ReadMessage() ([]byte, error) {
+	var message []byte
+	started := false
+	for {
+		f, err := c.readFrame()
+		if err != nil {
+			return nil, err
+		}
+		switch f.opcode {
+		case opPing:
+			if err := c.writeFrame(opPong, f.payload); err != nil {
+				return nil, err
+			}
+		case opPong:
+			if c.OnPong != nil {
+				c.OnPong()
+			}
+		case opClose:
+			code := CloseNormal
+			if len(f.payload) >= 2 {
+				code = int(binary.BigEndian.Uint16(f.payload[:2]))
+			}
+			c.Close(code, "")
+			return nil, ErrClosed
+		case opText, opBinary, opContinuation:
+			if (f.opcode == opContinuation) != started {
+				return nil, c.fail(CloseProtocolError, "unexpected continuation frame")
+			}
+			started = true
+			message = append(message, f.payload...)
+			if int64(len(message)) > c.MaxMessageSize {
+				return nil, c.fail(CloseTooLarge, "the message is too large")
+			}
+			if f.fin {
+				return message, nil
+			}
+		default:
+			return nil, c.fail(CloseProtocolError, fmt.Sprintf("unknown opcode %d", f.opcode))
+		}
+	}
+}
+
+func (c *Conn) fail(code int, reason string) error {
+	c.Close(code, reason)
+	return fmt.Errorf("websocket protocol error: %s", reason)
+}
+
+func (c *Conn) writeFrame(opcode byte, payload []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if c.closed {
+		return ErrClosed
+	}
+
+	head := []byte{0x80 | opcode}
+	switch length := len(payload); {
+	case length <= 125:
+		head = append(head, byte(length))
+	case length <= 0xFFFF:
+		head = append(head, 126)
+		head = binary.BigEndian.AppendUint16(head, uint16(length))
+	default:
+		head = append(head, 127)
+		head = binary.BigEndian.AppendUint64(head, uint64(length))
+	}
+	// a stuck client must not block the writer forever
+	c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	if _, err := c.conn.Write(append(head, payload...)); err != nil {
+		return err
+	}
+	return nil
+}
+
+// WriteText sends a text message
+func (c *Conn) WriteText(payload []byte) error {
+	return c.writeFrame(opText, payload)
+}
+
+// Ping sends a ping, the client answers with a pong
+func (c *Conn) Ping() error {
+	return c.writeFrame(opPing, nil)
+}
+
+// Close sends a close frame and closes the connection. It may be called repeatedly.
+func (c *Conn) Close(code int, reason string) error {
+	payload := binary.BigEndian.AppendUint16(nil, uint16(code))
+	if len(reason) > 123 {
+		reason = reason[:123]
+	}
+	c.writeFrame(opClose, append(payload, reason...))
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	return c.conn.Close()
+}
@@ -0,0 +1,326 @@
+package websocket
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// the key and accept value of the handshake example of RFC 6455, section 1.3
+const (
+	exampleKey    = "dGhlIHNhbXBsZSBub25jZQ=="
+	exampleAccept = "s3pPLMBiTxaQ9kYGzzhZRbK+xOo="
+)
+
+// client is the raw connection of a websocket client to a server running handle
+type client struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func dial(t *testing.T, handle func(c *Conn)) *client {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := Upgrade(w, r)
+		if err != nil {
+			return
+		}
+		handle(c)
+	}))
+	t.Cleanup(server.Close)
+
+	conn, err := net.Dial("tcp", server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	c := &client{conn: conn, reader: bufio.NewReader(conn)}
+	if resp := c.handshake(t, "13"); resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("the handshake answered %s", resp.Status)
+	}
+	return c
+}
+
+func (c *client) handshake(t *testing.T, version string) *http.Response {
+	t.Helper()
+	request := "GET /ws HTTP/1.1\r\nHost: gorun.example.org\r\nConnection: keep-alive, Upgrade\r\nUpgrade: websocket\r\n" +
+		"Sec-WebSocket-Key: " + exampleKey + "\r\nSec-WebSocket-Version: " + version + "\r\n\r\n"
+	if _, err := c.conn.Write([]byte(request)); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.ReadResponse(c.reader, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+// clientFrame encodes a frame of the client, masked unless the test breaks the protocol
+func clientFrame(fin bool, opcode byte, payload []byte, masked bool) []byte {
+	head := []byte{opcode}
+	if fin {
+		head[0] |= 0x80
+	}
+	maskBit := byte(0)
+	if masked {
+		maskBit = 0x80
+	}
+	switch length := len(payload); {
+	case length <= 125:
+		head = append(head, maskBit|byte(length))
+	case length <= 0xFFFF:
+		head = binary.BigEndian.AppendUint16(append(head, maskBit|126), uint16(length))
+	default:
+		head = binary.BigEndian.AppendUint64(append(head, maskBit|127), uint64(length))
+	}
+	if !masked {
+		return append(head, payload...)
+	}
+	mask := []byte{0x37, 0xfa, 0x21, 0x3d}
+	head = append(head, mask...)
+	for i, b := range payload {
+		head = append(head, b^mask[i%4])
+	}
+	return head
+}
+
+func (c *client) send(t *testing.T, frames ...[]byte) {
+	t.Helper()
+	for _, f := range frames {
+		if _, err := c.conn.Write(f); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// receive reads a frame of the server, which are never masked
+func (c *client) receive(t *testing.T) (opcode byte, payload []byte) {
+	t.Helper()
+	var head [2]byte
+	if _, err := io.ReadFull(c.reader, head[:]); err != nil {
+		t.Fatal(err)
+	}
+	if head[0]&0x80 == 0 || head[1]&0x80 != 0 {
+		t.Fatalf("the server sent a fragmented or masked frame: %x", head)
+	}
+	length := uint64(head[1] & 0x7F)
+	switch length {
+	case 126:
+		var ext [2]byte
+		io.ReadFull(c.reader, ext[:])
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		io.ReadFull(c.reader, ext[:])
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+	payload = make([]byte, length)
+	if _, err := io.ReadFull(c.reader, payload); err != nil {
+		t.Fatal(err)
+	}
+	return head[0] & 0x0F, payload
+}
+
+// expectClose reads the close frame of the server and checks its code
+func (c *client) expectClose(t *testing.T, wantCode int) {
+	t.Helper()
+	opcode, payload := c.receive(t)
+	if opcode != opClose || len(payload) < 2 {
+		t.Fatalf("the server sent the frame %d with %q, want a close frame", opcode, payload)
+	}
+	if code := int(binary.BigEndian.Uint16(payload)); code != wantCode {
+		t.Errorf("the server closed with %d (%s), want %d", code, payload[2:], wantCode)
+	}
+	if _, err := c.reader.ReadByte(); err != io.EOF {
+		t.Errorf("the connection is still open after the close frame: %v", err)
+	}
+}
+
+// echo answers every message of the client with the same text and reports the error ending the reads
+func echo(errs chan<- error) func(c *Conn) {
+	return func(c *Conn) {
+		for {
+			message, err := c.ReadMessage()
+			if err != nil {
+				errs <- err
+				return
+			}
+			if err := c.WriteText(message); err != nil {
+				errs <- err
+				return
+			}
+		}
+	}
+}
+
+func TestUpgradeAcceptKey(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if c, err := Upgrade(w, r); err == nil {
+			c.Close(CloseNormal, "")
+		}
+	}))
+	defer server.Close()
+
+	for _, tt := range []struct {
+		version    string
+		wantStatus int
+	}{{"13", http.StatusSwitchingProtocols}, {"8", http.StatusUpgradeRequired}} {
+		conn, err := net.Dial("tcp", server.Listener.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+		resp := (&client{conn: conn, reader: bufio.NewReader(conn)}).handshake(t, tt.version)
+		if resp.StatusCode != tt.wantStatus {
+			t.Errorf("the handshake of version %s answered %s, want %d", tt.version, resp.Status, tt.wantStatus)
+		}
+		if accept := resp.Header.Get("Sec-WebSocket-Accept"); tt.wantStatus == http.StatusSwitchingProtocols && accept != exampleAccept {
+			t.Errorf("the accept key is %q, want %q", accept, exampleAccept)
+		}
+		conn.Close()
+	}
+
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUpgradeRequired {
+		t.Errorf("a plain request answered %s, want %d", resp.Status, http.StatusUpgradeRequired)
+	}
+}
+
+func TestReadMessageMasked(t *testing.T) {
+	errs := make(chan error, 1)
+	c := dial(t, echo(errs))
+
+	// the masked "Hello" of RFC 6455, section 5.7, is echoed unmasked
+	c.send(t, []byte{0x81, 0x85, 0x37, 0xfa, 0x21, 0x3d, 0x7f, 0x9f, 0x4d, 0x51, 0x58})
+	var echoed [7]byte
+	if _, err := io.ReadFull(c.reader, echoed[:]); err != nil {
+		t.Fatal(err)
+	}
+	if want := []byte{0x81, 0x05, 'H', 'e', 'l', 'l', 'o'}; !bytes.Equal(echoed[:], want) {
+		t.Errorf("the server sent %x, want %x", echoed, want)
+	}
+
+	// the lengths of 16 bit are used in both directions
+	long := strings.Repeat("gorun", 100)
+	c.send(t, clientFrame(true, opText, []byte(long), true))
+	if opcode, payload := c.receive(t); opcode != opText || string(payload) != long {
+		t.Errorf("the long message is echoed as %d with %d bytes", opcode, len(payload))
+	}
+}
+
+func TestReadMessageRejectsUnmaskedFrames(t *testing.T) {
+	errs := make(chan error, 1)
+	c := dial(t, echo(errs))
+
+	c.send(t, clientFrame(true, opText, []byte("Hello"), false))
+	c.expectClose(t, CloseProtocolError)
+	if err := <-errs; err == nil || !strings.Contains(err.Error(), "masked") {
+		t.Errorf("the unmasked frame returned %v", err)
+	}
+}
+
+func TestReadMessageFragmented(t *testing.T) {
+	errs := make(chan error, 1)
+	c := dial(t, echo(errs))
+
+	// the fragments of RFC 6455, section 5.7, with a ping in between which is answered first
+	c.send(t,
+		clientFrame(false, opText, []byte("Hel"), true),
+		clientFrame(true, opPing, []byte("ping"), true),
+		clientFrame(true, opContinuation, []byte("lo"), true),
+	)
+	if opcode, payload := c.receive(t); opcode != opPong || string(payload) != "ping" {
+		t.Errorf("the ping is answered with %d and %q", opcode, payload)
+	}
+	if opcode, payload := c.receive(t); opcode != opText || string(payload) != "Hello" {
+		t.Errorf("the fragments are echoed as %d with %q", opcode, payload)
+	}
+
+	// a continuation needs a fragment before it
+	c.send(t, clientFrame(true, opContinuation, []byte("lo"), true))
+	c.expectClose(t, CloseProtocolError)
+	if err := <-errs; err == nil || !strings.Contains(err.Error(), "continuation") {
+		t.Errorf("the unexpected continuation returned %v", err)
+	}
+}
+
+func TestReadMessageTooLarge(t *testing.T) {
+	t.Run("frame", func(t *testing.T) {
+		errs := make(chan error, 1)
+		c := dial(t, echo(errs))
+
+		// the frame is refused by its length, before its payload is read
+		head := clientFrame(true, opBinary, make([]byte, 64*1024+1), true)[:2+8]
+		c.send(t, head)
+		c.expectClose(t, CloseTooLarge)
+		if err := <-errs; err == nil || !strings.Contains(err.Error(), "too large") {
+			t.Errorf("the large frame returned %v", err)
+		}
+	})
+
+	t.Run("fragments", func(t *testing.T) {
+		errs := make(chan error, 1)
+		c := dial(t, echo(errs))
+
+		fragment := make([]byte, 40*1024)
+		c.send(t, clientFrame(false, opText, fragment, true), clientFrame(true, opContinuation, fragment, true))
+		c.expectClose(t, CloseTooLarge)
+		if err := <-errs; err == nil || !strings.Contains(err.Error(), "too large") {
+			t.Errorf("the large message returned %v", err)
+		}
+	})
+
+	t.Run("at the limit", func(t *testing.T) {
+		errs := make(chan error, 1)
+		c := dial(t, echo(errs))
+
+		message := strings.Repeat("x", 64*1024)
+		c.send(t, clientFrame(true, opText, []byte(message), true))
+		if opcode, payload := c.receive(t); opcode != opText || string(payload) != message {
+			t.Errorf("the message of 64KiB is echoed as %d with %d bytes", opcode, len(payload))
+		}
+	})
+}
+
+func TestCloseHandshake(t *testing.T) {
+	errs := make(chan error, 1)
+	written := make(chan error, 1)
+	c := dial(t, func(conn *Conn) {
+		echo(errs)(conn)
+		written <- conn.WriteText([]byte("late"))
+	})
+
+	// the close code of the client is echoed and the connection is closed by the server
+	c.send(t, clientFrame(true, opClose, binary.BigEndian.AppendUint16(nil, CloseGoingAway), true))
+	c.expectClose(t, CloseGoingAway)
+	if err := <-errs; !errors.Is(err, ErrClosed) {
+		t.Errorf("ReadMessage returned %v, want ErrClosed", err)
+	}
+	if err := <-written; !errors.Is(err, ErrClosed) {
+		t.Errorf("writing to the closed connection returned %v, want ErrClosed", err)
+	}
+}
+
+func TestCloseWithoutCode(t *testing.T) {
+	errs := make(chan error, 1)
+	c := dial(t, echo(errs))
+
+	c.send(t, clientFrame(true, opClose, nil, true))
+	c.expectClose(t, CloseNormal)
+	if err := <-errs; !errors.Is(err, ErrClosed) {
+		t.Errorf("ReadMessage returned %v, want ErrClosed", err)
+	}
+}
@@ -45,3 +45,22 @@ export const formatDurationFromNanoseconds = (nanoseconds: number): string => {
 
     return `${(nanoseconds / 1_000_000_000).toFixed(2)} s`;
 }
+
+export interface ApiError {
+    code: string;
+    message: string;
+    details?: unknown;
+}
+
+export const readApiError = async (response: Response): Promise<ApiError> => {
+    const text = await response.text();
+    try {
+        const body = JSON.parse(text);
+        if (typeof body?.message === 'string') {
+            return { code: typeof body.code === 'string' ? body.code : 'internal_error', message: body.message, details: body.details };
+        }
+    } catch (_error) {
+        // not an error envelope, use the plain text
+    }
+    return { code: 'internal_error', message: text || `Request failed (${response.status})` };
+}
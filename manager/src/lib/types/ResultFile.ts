@@ -6,6 +6,7 @@ export interface ResultFile {
     absPath: string;
     size: number;
     lastModified?: Date;
+    truncated?: boolean;
 }
 
 export interface ClassifiedResultFile extends ResultFile {
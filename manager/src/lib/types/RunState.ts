@@ -21,12 +21,52 @@ export interface RunState {
     data?: {
         [name: string]: string
     },
-    status: "pending" | "running" | "finished" | "errored",
+    status: "pending" | "queued" | "running" | "finished" | "errored" | "cancelled" | "purged",
     created_at: Date,
     started_at?: Date,
     finished_at?: Date,
+    duration_ms?: number,
+    exit_code?: number,
+    error_kind?: "tool_failure" | "infrastructure" | "timeout" | "cancelled" | "validation",
+    attempts: number,
+    execution_strategy?: "override" | "gotap" | "spec_command" | "spec_entry" | "image_default",
+    project_id?: number,
+    deleted_at?: Date,
     has_errored: boolean,
     error_message?: string,
     gotap_metadata?: Record<string, unknown>,
-    result_summary?: RunResultSummary
+    gotap_metadata_raw?: unknown,
+    execution_environment?: ExecutionEnvironment,
+    stdout_tail?: string,
+    stderr_tail?: string,
+    result_summary?: RunResultSummary,
+    peak_memory_bytes?: number,
+    stats?: RunStats
+}
+
+export interface ExecutionEnvironment {
+    gorun_version: string,
+    engine?: string,
+    engine_version?: string,
+    storage_driver?: string,
+    operating_system?: string,
+    kernel_version?: string,
+    architecture?: string,
+    cpu_model?: string,
+    cpus?: number,
+    memory_bytes?: number,
+    gpus?: string[]
+}
+
+export interface RunStats {
+    runId: number,
+    samples: number,
+    peakMemoryBytes: number,
+    avgCpuPercent: number,
+    blockReadBytes: number,
+    blockWriteBytes: number,
+    netRxBytes: number,
+    netTxBytes: number,
+    finalized: boolean,
+    updatedAt: Date
 }
@@ -9,6 +9,23 @@ export interface ToolSpec {
     parameters?: Record<string, ParameterSpec>;
     data?: Record<string, DataSpec>;
     citation?: CitationFile;
+    compatibility?: SpecCompatibility;
+    platform?: string;
+    scan?: ImageScan;
+}
+
+export interface ImageScan {
+    image: string;
+    scanner: string;
+    critical: number;
+    high: number;
+    scannedAt: Date;
+}
+
+export interface SpecCompatibility {
+    status: "supported" | "degraded" | "unsupported";
+    version?: string;
+    reasons?: string[];
 }
 
 export interface ParameterSpec {
@@ -0,0 +1,16 @@
+-- name: CreateAuditEntry :exec
+INSERT INTO audit_log (user_id, action, target, remote_addr, request_id)
+VALUES (?, ?, ?, ?, ?);
+
+-- name: GetAuditLog :many
+SELECT * FROM audit_log
+WHERE (@user_id = '' OR user_id = @user_id)
+AND (@action = '' OR action = @action)
+AND datetime(created_at) >= datetime(@window_start)
+AND datetime(created_at) < datetime(@window_end)
+ORDER BY created_at DESC, id DESC
+LIMIT @limit OFFSET @offset;
+
+-- name: DeleteAuditEntriesBefore :execrows
+DELETE FROM audit_log
+WHERE datetime(created_at) < datetime(?);
@@ -0,0 +1,11 @@
+-- name: AllowImage :exec
+INSERT OR IGNORE INTO image_policy (pattern)
+VALUES (?);
+
+-- name: DenyImage :execrows
+DELETE FROM image_policy
+WHERE pattern = ?;
+
+-- name: GetImagePolicy :many
+SELECT * FROM image_policy
+ORDER BY pattern;
@@ -0,0 +1,13 @@
+-- name: SetImageScan :one
+INSERT INTO image_scans (image, scanner, critical, high, scanned_at)
+VALUES (?, ?, ?, ?, ?)
+ON CONFLICT (image) DO UPDATE SET
+    scanner = excluded.scanner,
+    critical = excluded.critical,
+    high = excluded.high,
+    scanned_at = excluded.scanned_at
+RETURNING *;
+
+-- name: GetImageScan :one
+SELECT * FROM image_scans
+WHERE image = ?;
@@ -0,0 +1,53 @@
+-- name: CreateProject :one
+INSERT INTO projects (name, description, owner_id, personal)
+VALUES (?, ?, ?, ?)
+RETURNING *;
+
+-- name: GetProject :one
+SELECT * FROM projects
+WHERE id = ?;
+
+-- name: GetPersonalProject :one
+SELECT * FROM projects
+WHERE owner_id = ? AND personal = TRUE;
+
+-- name: GetProjectsByMember :many
+SELECT p.* FROM projects p
+JOIN project_members m ON m.project_id = p.id
+WHERE m.user_id = ?
+ORDER BY p.personal DESC, p.name;
+
+-- name: GetAllProjects :many
+SELECT * FROM projects
+ORDER BY owner_id, personal DESC, name;
+
+-- name: UpdateProject :one
+UPDATE projects SET name = ?, description = ?
+WHERE id = ?
+RETURNING *;
+
+-- name: DeleteProject :exec
+DELETE FROM projects
+WHERE id = ?;
+
+-- name: AddProjectMember :exec
+INSERT OR IGNORE INTO project_members (project_id, user_id)
+VALUES (?, ?);
+
+-- name: RemoveProjectMember :execrows
+DELETE FROM project_members
+WHERE project_id = ? AND user_id = ?;
+
+-- name: GetProjectMembers :many
+SELECT m.user_id, u.email, m.created_at FROM project_members m
+JOIN users u ON u.id = m.user_id
+WHERE m.project_id = ?
+ORDER BY m.created_at;
+
+-- name: IsProjectMember :one
+SELECT COUNT(*) > 0 FROM project_members
+WHERE project_id = ? AND user_id = ?;
+
+-- name: CountProjectRuns :one
+SELECT COUNT(*) FROM runs
+WHERE project_id = ?;
@@ -0,0 +1,15 @@
+-- name: SetRunDeletion :exec
+INSERT INTO run_deletions (run_id, step, error)
+VALUES (?, ?, ?)
+ON CONFLICT (run_id) DO UPDATE SET
+    step = excluded.step,
+    error = excluded.error,
+    updated_at = CURRENT_TIMESTAMP;
+
+-- name: GetRunDeletion :one
+SELECT * FROM run_deletions
+WHERE run_id = ?;
+
+-- name: DeleteRunDeletion :exec
+DELETE FROM run_deletions
+WHERE run_id = ?;
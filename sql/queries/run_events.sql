@@ -0,0 +1,13 @@
+-- name: CreateRunEvent :one
+INSERT INTO run_events (run_id, type, message)
+VALUES (?, ?, ?)
+RETURNING *;
+
+-- name: GetRunEvents :many
+SELECT * FROM run_events
+WHERE run_id = ?
+ORDER BY created_at, id;
+
+-- name: DeleteRunEvents :exec
+DELETE FROM run_events
+WHERE run_id = ?;
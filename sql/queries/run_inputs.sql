@@ -0,0 +1,11 @@
+-- name: CreateRunInputs :exec
+INSERT INTO run_inputs (run_id, content)
+VALUES (?, ?);
+
+-- name: GetRunInputs :one
+SELECT content FROM run_inputs
+WHERE run_id = ?;
+
+-- name: DeleteRunInputs :exec
+DELETE FROM run_inputs
+WHERE run_id = ?;
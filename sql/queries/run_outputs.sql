@@ -0,0 +1,15 @@
+-- name: SetRunOutputs :exec
+INSERT INTO run_outputs (run_id, complete, verification)
+VALUES (?, ?, ?)
+ON CONFLICT (run_id) DO UPDATE SET
+    complete = excluded.complete,
+    verification = excluded.verification,
+    created_at = CURRENT_TIMESTAMP;
+
+-- name: GetRunOutputs :one
+SELECT * FROM run_outputs
+WHERE run_id = ?;
+
+-- name: DeleteRunOutputs :exec
+DELETE FROM run_outputs
+WHERE run_id = ?;
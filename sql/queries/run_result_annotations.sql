@@ -0,0 +1,30 @@
+-- name: SetRunResultAnnotation :exec
+INSERT INTO run_result_annotations (run_id, rel_path, is_primary, label, source)
+VALUES (?, ?, ?, ?, ?)
+ON CONFLICT (run_id, rel_path) DO UPDATE SET
+    is_primary = excluded.is_primary,
+    label = excluded.label,
+    source = excluded.source,
+    updated_at = CURRENT_TIMESTAMP;
+
+-- name: SetToolResultAnnotation :exec
+INSERT INTO run_result_annotations (run_id, rel_path, is_primary, label, source)
+VALUES (?, ?, ?, ?, 'tool')
+ON CONFLICT (run_id, rel_path) DO UPDATE SET
+    is_primary = excluded.is_primary,
+    label = excluded.label,
+    updated_at = CURRENT_TIMESTAMP
+WHERE run_result_annotations.source = 'tool';
+
+-- name: GetRunResultAnnotations :many
+SELECT * FROM run_result_annotations
+WHERE run_id = ?
+ORDER BY rel_path;
+
+-- name: GetRunResultAnnotation :one
+SELECT * FROM run_result_annotations
+WHERE run_id = ? AND rel_path = ?;
+
+-- name: DeleteRunResultAnnotations :exec
+DELETE FROM run_result_annotations
+WHERE run_id = ?;
@@ -0,0 +1,36 @@
+-- name: SetRunResult :exec
+INSERT INTO run_results (run_id, rel_path, object_key, size, checksum, format, mime_type)
+VALUES (?, ?, ?, ?, ?, ?, ?)
+ON CONFLICT (run_id, rel_path) DO UPDATE SET
+    object_key = excluded.object_key,
+    size = excluded.size,
+    checksum = excluded.checksum,
+    format = excluded.format,
+    mime_type = excluded.mime_type,
+    uploaded_at = CURRENT_TIMESTAMP,
+    local_removed = FALSE;
+
+-- name: GetRunResults :many
+SELECT * FROM run_results
+WHERE run_id = ?
+ORDER BY rel_path;
+
+-- name: GetRunResult :one
+SELECT * FROM run_results
+WHERE run_id = ? AND rel_path = ?;
+
+-- name: GetRunsWithLocalResults :many
+SELECT r.* FROM runs r
+WHERE r.storage_pending = FALSE AND r.id IN (
+  SELECT rr.run_id FROM run_results rr
+  WHERE rr.local_removed = FALSE AND datetime(rr.uploaded_at) < datetime(@cutoff)
+)
+ORDER BY r.id;
+
+-- name: SetRunResultsLocalRemoved :exec
+UPDATE run_results SET local_removed = TRUE
+WHERE run_id = ?;
+
+-- name: DeleteRunResults :exec
+DELETE FROM run_results
+WHERE run_id = ?;
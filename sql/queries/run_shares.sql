@@ -0,0 +1,21 @@
+-- name: CreateRunShare :one
+INSERT INTO run_shares (token, run_id, user_id, expires_at)
+VALUES (?, ?, ?, ?)
+RETURNING *;
+
+-- name: GetRunShare :one
+SELECT * FROM run_shares
+WHERE token = ?;
+
+-- name: GetRunShares :many
+SELECT * FROM run_shares
+WHERE run_id = ?
+ORDER BY created_at DESC;
+
+-- name: DeleteRunShare :execrows
+DELETE FROM run_shares
+WHERE token = ? AND run_id = ?;
+
+-- name: DeleteRunShares :exec
+DELETE FROM run_shares
+WHERE run_id = ?;
@@ -0,0 +1,76 @@
+-- name: SetRunStats :exec
+INSERT INTO run_stats (run_id, samples, peak_memory_bytes, avg_cpu_percent, block_read_bytes, block_write_bytes, net_rx_bytes, net_tx_bytes, finalized, updated_at)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+ON CONFLICT (run_id) DO UPDATE SET
+    samples = excluded.samples,
+    peak_memory_bytes = excluded.peak_memory_bytes,
+    avg_cpu_percent = excluded.avg_cpu_percent,
+    block_read_bytes = excluded.block_read_bytes,
+    block_write_bytes = excluded.block_write_bytes,
+    net_rx_bytes = excluded.net_rx_bytes,
+    net_tx_bytes = excluded.net_tx_bytes,
+    finalized = excluded.finalized,
+    updated_at = excluded.updated_at;
+
+-- name: SetRunOutputBytes :exec
+INSERT INTO run_stats (run_id, output_bytes, updated_at)
+VALUES (?, ?, ?)
+ON CONFLICT (run_id) DO UPDATE SET
+    output_bytes = excluded.output_bytes,
+    updated_at = excluded.updated_at;
+
+-- name: GetRunStats :one
+SELECT * FROM run_stats
+WHERE run_id = ?;
+
+-- name: GetRunStatsByUser :many
+SELECT run_stats.* FROM run_stats
+JOIN runs ON runs.id = run_stats.run_id
+WHERE runs.user_id = ?;
+
+-- name: GetUsageByUser :many
+SELECT runs.user_id AS group_key,
+    COUNT(*) AS runs,
+    CAST(COALESCE(SUM(runs.duration_ms), 0) AS INTEGER) AS duration_ms,
+    CAST(COALESCE(SUM(run_stats.avg_cpu_percent / 100.0 * runs.duration_ms / 1000.0), 0) AS REAL) AS cpu_seconds,
+    CAST(COALESCE(SUM(run_stats.peak_memory_bytes / 1073741824.0 * runs.duration_ms / 3600000.0), 0) AS REAL) AS peak_memory_gb_hours
+FROM runs
+LEFT JOIN run_stats ON run_stats.run_id = runs.id
+WHERE datetime(runs.started_at) >= datetime(@window_start)
+AND datetime(runs.started_at) < datetime(@window_end)
+AND (@user_id = '' OR runs.user_id = @user_id)
+GROUP BY runs.user_id
+ORDER BY runs.user_id;
+
+-- name: GetUsageByTool :many
+SELECT CAST(runs.docker_image || '::' || runs.name AS TEXT) AS group_key,
+    COUNT(*) AS runs,
+    CAST(COALESCE(SUM(runs.duration_ms), 0) AS INTEGER) AS duration_ms,
+    CAST(COALESCE(SUM(run_stats.avg_cpu_percent / 100.0 * runs.duration_ms / 1000.0), 0) AS REAL) AS cpu_seconds,
+    CAST(COALESCE(SUM(run_stats.peak_memory_bytes / 1073741824.0 * runs.duration_ms / 3600000.0), 0) AS REAL) AS peak_memory_gb_hours
+FROM runs
+LEFT JOIN run_stats ON run_stats.run_id = runs.id
+WHERE datetime(runs.started_at) >= datetime(@window_start)
+AND datetime(runs.started_at) < datetime(@window_end)
+AND (@user_id = '' OR runs.user_id = @user_id)
+GROUP BY runs.docker_image, runs.name
+ORDER BY group_key;
+
+-- name: GetUsageByProject :many
+SELECT CAST(COALESCE(projects.id || '::' || projects.name, '') AS TEXT) AS group_key,
+    COUNT(*) AS runs,
+    CAST(COALESCE(SUM(runs.duration_ms), 0) AS INTEGER) AS duration_ms,
+    CAST(COALESCE(SUM(run_stats.avg_cpu_percent / 100.0 * runs.duration_ms / 1000.0), 0) AS REAL) AS cpu_seconds,
+    CAST(COALESCE(SUM(run_stats.peak_memory_bytes / 1073741824.0 * runs.duration_ms / 3600000.0), 0) AS REAL) AS peak_memory_gb_hours
+FROM runs
+LEFT JOIN run_stats ON run_stats.run_id = runs.id
+LEFT JOIN projects ON projects.id = runs.project_id
+WHERE datetime(runs.started_at) >= datetime(@window_start)
+AND datetime(runs.started_at) < datetime(@window_end)
+AND (@user_id = '' OR runs.user_id = @user_id)
+GROUP BY runs.project_id
+ORDER BY group_key;
+
+-- name: DeleteRunStats :exec
+DELETE FROM run_stats
+WHERE run_id = ?;
@@ -1,6 +1,6 @@
 -- name: CreateRun :one
-INSERT INTO runs (name, title, description, docker_image, parameters, data, mounts, created_at, user_id)
-VALUES (?,?,?,?,?,?,?,datetime('now'),?)
+INSERT INTO runs (name, title, description, docker_image, parameters, data, mounts, options, created_at, user_id, project_id)
+VALUES (?,?,?,?,?,?,?,?,datetime('now'),?,?)
 RETURNING *;
 
 -- name: GetRun :one
@@ -10,6 +10,11 @@ WHERE r.id = ? AND (
   OR r.user_id = ?
 );
 
+-- name: GetProjectRun :one
+SELECT r.* FROM runs r
+JOIN project_members m ON m.project_id = r.project_id
+WHERE r.id = ? AND m.user_id = ?;
+
 -- name: DeleteRun :exec
 DELETE FROM runs
 WHERE runs.id = ? AND (
@@ -20,31 +25,79 @@ WHERE runs.id = ? AND (
 -- name: StartRun :one
 UPDATE runs
 SET status = 'running', started_at = datetime('now')
-WHERE runs.id = ? AND (
+WHERE runs.id = ? AND runs.status IN ('pending', 'queued') AND runs.deleted_at IS NULL AND (
   (SELECT u.is_admin FROM users u WHERE u.id = ?) = TRUE 
   OR runs.user_id = ?
 )
 RETURNING *;
 
--- name: FinishRun :one
+-- name: FinishRun :execrows
 UPDATE runs SET status = 'finished', finished_at = datetime('now')
-WHERE runs.id = ?
-RETURNING *;
+WHERE runs.id = ? AND runs.status = 'running';
 
--- name: RunErrored :one
-UPDATE runs SET status = 'errored', error_message = ?, finished_at = datetime('now'), has_errored = TRUE
+-- name: RunErrored :execrows
+UPDATE runs SET status = 'errored', error_message = ?, error_kind = ?, finished_at = datetime('now'), has_errored = TRUE
+WHERE runs.id = ? AND runs.status IN ('pending', 'queued', 'running');
+
+-- name: CancelRun :execrows
+UPDATE runs SET status = 'cancelled', error_message = ?, error_kind = 'cancelled', finished_at = datetime('now')
+WHERE runs.id = ? AND runs.status IN ('pending', 'queued', 'running');
+
+-- name: SetRunGotapMetadata :one
+UPDATE runs SET gotap_metadata = ?, duration_ms = COALESCE(?, duration_ms)
 WHERE runs.id = ?
 RETURNING *;
 
--- name: SetRunGotapMetadata :one
-UPDATE runs SET gotap_metadata = ?
+-- name: SetRunExitCode :one
+UPDATE runs SET exit_code = ?, duration_ms = ?
 WHERE runs.id = ?
 RETURNING *;
 
+-- name: SetRunAttempts :exec
+UPDATE runs SET attempts = ?
+WHERE runs.id = ?;
+
+-- name: SetRunContainerID :exec
+UPDATE runs SET container_id = ?
+WHERE runs.id = ?;
+
+-- name: SetRunExecutionEnvironment :exec
+UPDATE runs SET execution_environment = ?
+WHERE runs.id = ?;
+
+-- name: SetRunExecutionStrategy :exec
+UPDATE runs SET execution_strategy = ?
+WHERE runs.id = ?;
+
+-- name: SetRunImageDigest :exec
+UPDATE runs SET image_digest = ?
+WHERE runs.id = ?;
+
+-- name: SetRunDir :exec
+UPDATE runs SET run_dir = ?
+WHERE runs.id = ?;
+
+-- name: SetRunProgress :exec
+UPDATE runs SET progress = ?
+WHERE runs.id = ?;
+
+-- name: SetRunStoragePending :exec
+UPDATE runs SET storage_pending = ?
+WHERE runs.id = ?;
+
+-- name: SetRunLayout :exec
+UPDATE runs SET data = ?, mounts = ?
+WHERE runs.id = ?;
+
+-- name: QueueRun :execrows
+UPDATE runs SET status = 'queued'
+WHERE runs.id = ? AND runs.status IN ('pending', 'running');
+
 -- name: GetAllRuns :many
 SELECT r.* FROM runs r
 WHERE (SELECT u.is_admin FROM users u WHERE u.id = ?) = TRUE 
-   OR r.user_id = ?;
+   OR r.user_id = ?
+   OR r.project_id IN (SELECT m.project_id FROM project_members m WHERE m.user_id = ?);
 
 -- name: GetIdleRuns :many
 SELECT r.* FROM runs r
@@ -60,6 +113,20 @@ WHERE r.status = 'running' AND (
   OR r.user_id = ?
 );
 
+-- name: GetStoragePendingRuns :many
+SELECT * FROM runs
+WHERE storage_pending = TRUE AND deleted_at IS NULL
+ORDER BY id;
+
+-- name: GetActiveRuns :many
+SELECT * FROM runs
+WHERE status = 'running';
+
+-- name: GetQueuedRuns :many
+SELECT * FROM runs
+WHERE status = 'queued'
+ORDER BY id;
+
 -- name: GetFinishedRuns :many
 SELECT r.* FROM runs r
 WHERE r.status = 'finished' AND (
@@ -73,3 +140,67 @@ WHERE r.status = 'errored' AND (
   (SELECT u.is_admin FROM users u WHERE u.id = ?) = TRUE 
   OR r.user_id = ?
 );
+
+-- name: GetRunStatusByID :one
+SELECT status FROM runs
+WHERE id = ?;
+
+-- name: GetRunOwner :one
+SELECT user_id FROM runs
+WHERE id = ?;
+
+-- name: GetRunMounts :many
+SELECT id, mounts FROM runs;
+
+-- name: GetUnfinishedRunMounts :many
+SELECT id, mounts FROM runs
+WHERE status IN ('pending', 'queued', 'running');
+
+-- name: GetRunSummaries :many
+SELECT r.id, r.name, r.title, r.description, r.docker_image, r.created_at, r.started_at, r.finished_at, r.status,
+  r.gotap_metadata, r.duration_ms, r.exit_code, r.error_message, r.error_kind, r.attempts, r.execution_strategy, r.project_id, r.deleted_at, r.progress,
+  CAST(COALESCE(json_extract(r.mounts, '$."/out"'), '') AS TEXT) AS out_path
+FROM runs r
+WHERE (SELECT u.is_admin FROM users u WHERE u.id = ?) = TRUE 
+   OR r.user_id = ?
+   OR r.project_id IN (SELECT m.project_id FROM project_members m WHERE m.user_id = ?);
+
+-- name: TrashRun :execrows
+UPDATE runs SET deleted_at = datetime('now')
+WHERE id = ? AND deleted_at IS NULL;
+
+-- name: RestoreRun :execrows
+UPDATE runs SET deleted_at = NULL
+WHERE id = ? AND deleted_at IS NOT NULL;
+
+-- name: GetStalePendingRuns :many
+SELECT * FROM runs
+WHERE status = 'pending' AND deleted_at IS NULL AND datetime(created_at) < datetime(@cutoff)
+ORDER BY id;
+
+-- name: ExpireRun :execrows
+UPDATE runs SET status = 'expired', error_message = ?
+WHERE id = ? AND status = 'pending';
+
+-- name: ClaimRun :execrows
+UPDATE runs SET status = 'queued'
+WHERE id = ? AND status = 'pending' AND deleted_at IS NULL;
+
+-- name: CountExpiredRuns :one
+SELECT COUNT(*) FROM runs
+WHERE status = 'expired' AND deleted_at IS NULL;
+
+-- name: GetExpiredTrashedRuns :many
+SELECT * FROM runs
+WHERE deleted_at IS NOT NULL AND datetime(deleted_at) < datetime(@cutoff);
+
+-- name: GetRunErrors :many
+SELECT id, user_id,
+    CAST(COALESCE(error_kind, '') AS TEXT) AS error_kind,
+    CAST(COALESCE(error_message, '') AS TEXT) AS error_message,
+    finished_at
+FROM runs
+WHERE status = 'errored'
+AND datetime(finished_at) >= datetime(@window_start)
+AND datetime(finished_at) < datetime(@window_end)
+ORDER BY finished_at, id;
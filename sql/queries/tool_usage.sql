@@ -0,0 +1,31 @@
+-- name: GetToolUsageRuns :many
+SELECT CAST(docker_image || '::' || name AS TEXT) AS tool, user_id, status, duration_ms, created_at FROM runs;
+
+-- name: SetToolUsage :exec
+INSERT INTO tool_usage (tool, total_runs, recent_runs, finished_runs, errored_runs, median_duration_ms, distinct_users, computed_at)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+ON CONFLICT (tool) DO UPDATE SET
+    total_runs = excluded.total_runs,
+    recent_runs = excluded.recent_runs,
+    finished_runs = excluded.finished_runs,
+    errored_runs = excluded.errored_runs,
+    median_duration_ms = excluded.median_duration_ms,
+    distinct_users = excluded.distinct_users,
+    computed_at = excluded.computed_at;
+
+-- name: DeleteStaleToolUsage :exec
+DELETE FROM tool_usage
+WHERE computed_at < ?;
+
+-- name: GetToolUsage :one
+SELECT * FROM tool_usage
+WHERE tool = ?;
+
+-- name: ListToolUsage :many
+SELECT * FROM tool_usage
+ORDER BY recent_runs DESC, total_runs DESC, tool;
+
+-- name: GetToolUsageComputedAt :one
+SELECT computed_at FROM tool_usage
+ORDER BY computed_at DESC
+LIMIT 1;
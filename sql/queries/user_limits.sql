@@ -0,0 +1,13 @@
+-- name: SetUserRunLimit :exec
+INSERT INTO user_limits (user_id, runs_per_minute)
+VALUES (?, ?)
+ON CONFLICT (user_id) DO UPDATE SET
+    runs_per_minute = excluded.runs_per_minute;
+
+-- name: GetUserRunLimit :one
+SELECT runs_per_minute FROM user_limits
+WHERE user_id = ?;
+
+-- name: DeleteUserRunLimit :exec
+DELETE FROM user_limits
+WHERE user_id = ?;
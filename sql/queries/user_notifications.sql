@@ -0,0 +1,17 @@
+-- name: SetUserEmailNotifications :exec
+INSERT INTO user_notifications (user_id, email)
+VALUES (?, ?)
+ON CONFLICT (user_id) DO UPDATE SET
+    email = excluded.email;
+
+-- name: SetUserNotifications :exec
+INSERT INTO user_notifications (user_id, email, slack_webhook_url, matrix_room_id)
+VALUES (?, ?, ?, ?)
+ON CONFLICT (user_id) DO UPDATE SET
+    email = excluded.email,
+    slack_webhook_url = excluded.slack_webhook_url,
+    matrix_room_id = excluded.matrix_room_id;
+
+-- name: GetUserNotifications :one
+SELECT * FROM user_notifications
+WHERE user_id = ?;
@@ -0,0 +1,10 @@
+-- name: GetUserSettings :one
+SELECT * FROM user_settings
+WHERE user_id = ?;
+
+-- name: SetUserSettings :exec
+INSERT INTO user_settings (user_id, settings, updated_at)
+VALUES (?, ?, CURRENT_TIMESTAMP)
+ON CONFLICT (user_id) DO UPDATE SET
+    settings = excluded.settings,
+    updated_at = excluded.updated_at;
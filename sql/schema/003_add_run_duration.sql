@@ -0,0 +1,5 @@
+-- +goose Up
+ALTER TABLE runs ADD COLUMN duration_ms INTEGER;
+
+-- +goose Down
+ALTER TABLE runs DROP COLUMN duration_ms;
@@ -0,0 +1,15 @@
+-- +goose Up
+CREATE TABLE run_events (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    run_id INTEGER NOT NULL,
+    type text NOT NULL,
+    message text NOT NULL DEFAULT '',
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (run_id) REFERENCES runs(id) ON DELETE CASCADE ON UPDATE CASCADE
+);
+
+CREATE INDEX idx_run_events_run_id ON run_events(run_id);
+
+-- +goose Down
+DROP INDEX idx_run_events_run_id;
+DROP TABLE run_events;
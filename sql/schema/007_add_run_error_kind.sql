@@ -0,0 +1,5 @@
+-- +goose Up
+ALTER TABLE runs ADD COLUMN error_kind TEXT;
+
+-- +goose Down
+ALTER TABLE runs DROP COLUMN error_kind;
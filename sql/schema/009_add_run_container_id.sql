@@ -0,0 +1,5 @@
+-- +goose Up
+ALTER TABLE runs ADD COLUMN container_id TEXT;
+
+-- +goose Down
+ALTER TABLE runs DROP COLUMN container_id;
@@ -0,0 +1,8 @@
+-- +goose Up
+CREATE TABLE image_policy (
+    pattern text PRIMARY KEY,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- +goose Down
+DROP TABLE image_policy;
@@ -0,0 +1,11 @@
+-- +goose Up
+CREATE TABLE image_scans (
+    image text PRIMARY KEY,
+    scanner text NOT NULL,
+    critical INTEGER NOT NULL DEFAULT 0,
+    high INTEGER NOT NULL DEFAULT 0,
+    scanned_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- +goose Down
+DROP TABLE image_scans;
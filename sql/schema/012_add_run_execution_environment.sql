@@ -0,0 +1,5 @@
+-- +goose Up
+ALTER TABLE runs ADD COLUMN execution_environment TEXT;
+
+-- +goose Down
+ALTER TABLE runs DROP COLUMN execution_environment;
@@ -0,0 +1,17 @@
+-- +goose Up
+CREATE TABLE run_stats (
+    run_id INTEGER PRIMARY KEY,
+    samples INTEGER NOT NULL DEFAULT 0,
+    peak_memory_bytes INTEGER NOT NULL DEFAULT 0,
+    avg_cpu_percent REAL NOT NULL DEFAULT 0,
+    block_read_bytes INTEGER NOT NULL DEFAULT 0,
+    block_write_bytes INTEGER NOT NULL DEFAULT 0,
+    net_rx_bytes INTEGER NOT NULL DEFAULT 0,
+    net_tx_bytes INTEGER NOT NULL DEFAULT 0,
+    finalized BOOLEAN NOT NULL DEFAULT FALSE,
+    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (run_id) REFERENCES runs(id) ON DELETE CASCADE ON UPDATE CASCADE
+);
+
+-- +goose Down
+DROP TABLE run_stats;
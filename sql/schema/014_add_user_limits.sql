@@ -0,0 +1,9 @@
+-- +goose Up
+CREATE TABLE user_limits (
+    user_id text PRIMARY KEY,
+    runs_per_minute INTEGER NOT NULL,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE ON UPDATE CASCADE
+);
+
+-- +goose Down
+DROP TABLE user_limits;
@@ -0,0 +1,16 @@
+-- +goose Up
+CREATE TABLE audit_log (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id text NOT NULL DEFAULT '',
+    action text NOT NULL,
+    target text NOT NULL DEFAULT '',
+    remote_addr text NOT NULL DEFAULT '',
+    request_id text NOT NULL DEFAULT '',
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_audit_log_created_at ON audit_log(created_at);
+
+-- +goose Down
+DROP INDEX idx_audit_log_created_at;
+DROP TABLE audit_log;
@@ -0,0 +1,15 @@
+-- +goose Up
+CREATE TABLE run_shares (
+    token text PRIMARY KEY,
+    run_id INTEGER NOT NULL,
+    user_id text NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at DATETIME,
+    FOREIGN KEY (run_id) REFERENCES runs(id) ON DELETE CASCADE ON UPDATE CASCADE
+);
+
+CREATE INDEX idx_run_shares_run_id ON run_shares(run_id);
+
+-- +goose Down
+DROP INDEX idx_run_shares_run_id;
+DROP TABLE run_shares;
@@ -0,0 +1,9 @@
+-- +goose Up
+CREATE TABLE user_notifications (
+    user_id text PRIMARY KEY,
+    email BOOLEAN NOT NULL DEFAULT FALSE,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE ON UPDATE CASCADE
+);
+
+-- +goose Down
+DROP TABLE user_notifications;
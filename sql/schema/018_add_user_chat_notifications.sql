@@ -0,0 +1,7 @@
+-- +goose Up
+ALTER TABLE user_notifications ADD COLUMN slack_webhook_url TEXT NOT NULL DEFAULT '';
+ALTER TABLE user_notifications ADD COLUMN matrix_room_id TEXT NOT NULL DEFAULT '';
+
+-- +goose Down
+ALTER TABLE user_notifications DROP COLUMN matrix_room_id;
+ALTER TABLE user_notifications DROP COLUMN slack_webhook_url;
@@ -0,0 +1,9 @@
+-- +goose Up
+CREATE TABLE run_inputs (
+    run_id INTEGER PRIMARY KEY,
+    content TEXT NOT NULL,
+    FOREIGN KEY (run_id) REFERENCES runs(id) ON DELETE CASCADE ON UPDATE CASCADE
+);
+
+-- +goose Down
+DROP TABLE run_inputs;
@@ -0,0 +1,11 @@
+-- +goose Up
+CREATE TABLE run_outputs (
+    run_id INTEGER PRIMARY KEY,
+    complete BOOLEAN NOT NULL,
+    verification TEXT NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (run_id) REFERENCES runs(id) ON DELETE CASCADE ON UPDATE CASCADE
+);
+
+-- +goose Down
+DROP TABLE run_outputs;
@@ -0,0 +1,10 @@
+-- +goose Up
+CREATE TABLE run_deletions (
+    run_id INTEGER PRIMARY KEY,
+    step TEXT NOT NULL,
+    error TEXT NOT NULL DEFAULT '',
+    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- +goose Down
+DROP TABLE run_deletions;
@@ -0,0 +1,5 @@
+-- +goose Up
+ALTER TABLE runs ADD COLUMN execution_strategy TEXT;
+
+-- +goose Down
+ALTER TABLE runs DROP COLUMN execution_strategy;
@@ -0,0 +1,41 @@
+-- +goose Up
+CREATE TABLE projects (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    owner_id TEXT NOT NULL,
+    personal BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (owner_id, name),
+    FOREIGN KEY (owner_id) REFERENCES users(id) ON DELETE CASCADE ON UPDATE CASCADE
+);
+
+CREATE TABLE project_members (
+    project_id INTEGER NOT NULL,
+    user_id TEXT NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (project_id, user_id),
+    FOREIGN KEY (project_id) REFERENCES projects(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE ON UPDATE CASCADE
+);
+
+CREATE INDEX idx_project_members_user_id ON project_members(user_id);
+
+ALTER TABLE runs ADD COLUMN project_id INTEGER;
+
+-- every user gets a personal project holding the existing runs
+INSERT INTO projects (name, owner_id, personal)
+SELECT 'personal', id, TRUE FROM users;
+
+INSERT INTO project_members (project_id, user_id)
+SELECT id, owner_id FROM projects;
+
+UPDATE runs SET project_id = (
+    SELECT p.id FROM projects p WHERE p.owner_id = runs.user_id AND p.personal = TRUE
+);
+
+-- +goose Down
+ALTER TABLE runs DROP COLUMN project_id;
+DROP INDEX idx_project_members_user_id;
+DROP TABLE project_members;
+DROP TABLE projects;
@@ -0,0 +1,5 @@
+-- +goose Up
+ALTER TABLE runs ADD COLUMN deleted_at DATETIME;
+
+-- +goose Down
+ALTER TABLE runs DROP COLUMN deleted_at;
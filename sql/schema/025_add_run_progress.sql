@@ -0,0 +1,5 @@
+-- +goose Up
+ALTER TABLE runs ADD COLUMN progress REAL;
+
+-- +goose Down
+ALTER TABLE runs DROP COLUMN progress;
@@ -0,0 +1,14 @@
+-- +goose Up
+CREATE TABLE tool_usage (
+    tool TEXT PRIMARY KEY,
+    total_runs INTEGER NOT NULL,
+    recent_runs INTEGER NOT NULL,
+    finished_runs INTEGER NOT NULL,
+    errored_runs INTEGER NOT NULL,
+    median_duration_ms INTEGER,
+    distinct_users INTEGER NOT NULL,
+    computed_at DATETIME NOT NULL
+);
+
+-- +goose Down
+DROP TABLE tool_usage;
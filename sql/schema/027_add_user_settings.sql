@@ -0,0 +1,10 @@
+-- +goose Up
+CREATE TABLE user_settings (
+    user_id text PRIMARY KEY,
+    settings TEXT NOT NULL DEFAULT '{}',
+    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE ON UPDATE CASCADE
+);
+
+-- +goose Down
+DROP TABLE user_settings;
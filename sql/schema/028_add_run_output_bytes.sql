@@ -0,0 +1,5 @@
+-- +goose Up
+ALTER TABLE run_stats ADD COLUMN output_bytes INTEGER NOT NULL DEFAULT 0;
+
+-- +goose Down
+ALTER TABLE run_stats DROP COLUMN output_bytes;
@@ -0,0 +1,20 @@
+-- +goose Up
+ALTER TABLE runs ADD COLUMN storage_pending BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE TABLE run_results (
+    run_id INTEGER NOT NULL,
+    rel_path TEXT NOT NULL,
+    object_key TEXT NOT NULL,
+    size INTEGER NOT NULL,
+    checksum TEXT NOT NULL,
+    format TEXT NOT NULL,
+    mime_type TEXT NOT NULL,
+    uploaded_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    local_removed BOOLEAN NOT NULL DEFAULT FALSE,
+    PRIMARY KEY (run_id, rel_path),
+    FOREIGN KEY (run_id) REFERENCES runs(id) ON DELETE CASCADE ON UPDATE CASCADE
+);
+
+-- +goose Down
+DROP TABLE run_results;
+ALTER TABLE runs DROP COLUMN storage_pending;
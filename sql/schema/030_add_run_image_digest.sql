@@ -0,0 +1,5 @@
+-- +goose Up
+ALTER TABLE runs ADD COLUMN image_digest TEXT;
+
+-- +goose Down
+ALTER TABLE runs DROP COLUMN image_digest;
@@ -0,0 +1,14 @@
+-- +goose Up
+CREATE TABLE run_result_annotations (
+    run_id INTEGER NOT NULL,
+    rel_path TEXT NOT NULL,
+    is_primary BOOLEAN NOT NULL DEFAULT FALSE,
+    label TEXT NOT NULL DEFAULT '',
+    source TEXT NOT NULL,
+    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (run_id, rel_path),
+    FOREIGN KEY (run_id) REFERENCES runs(id) ON DELETE CASCADE ON UPDATE CASCADE
+);
+
+-- +goose Down
+DROP TABLE run_result_annotations;
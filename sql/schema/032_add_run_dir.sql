@@ -0,0 +1,5 @@
+-- +goose Up
+ALTER TABLE runs ADD COLUMN run_dir TEXT;
+
+-- +goose Down
+ALTER TABLE runs DROP COLUMN run_dir;
@@ -3,6 +3,8 @@ package sql
 import (
 	"database/sql"
 	"embed"
+	"strconv"
+	"strings"
 
 	"github.com/pressly/goose/v3"
 	"github.com/spf13/viper"
@@ -35,3 +37,19 @@ func CreateDB(dbPath string) (*sql.DB, error) {
 
 	return drv, nil
 }
+
+// SchemaVersion is the latest migration embedded into gorun, which CreateDB applied
+func SchemaVersion() (int64, error) {
+	entries, err := embedMigrations.ReadDir("schema")
+	if err != nil {
+		return 0, err
+	}
+	var latest int64
+	for _, entry := range entries {
+		prefix, _, _ := strings.Cut(entry.Name(), "_")
+		if version, err := strconv.ParseInt(prefix, 10, 64); err == nil {
+			latest = max(latest, version)
+		}
+	}
+	return latest, nil
+}